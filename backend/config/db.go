@@ -39,7 +39,9 @@ func InitDB(path string) (*DB, error) {
 	// Auto migrate
 	if err := gdb.AutoMigrate(
 		&models.File{},
+		&models.PartialUpload{},
 		&models.YamlConfig{},
+		&models.YamlConfigVersion{},
 		&models.Tag{},
 		&models.SearchResult{},
 		&models.Note{},
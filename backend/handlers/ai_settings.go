@@ -3,11 +3,29 @@ package handlers
 import (
 	"binary-annotator-pro/config"
 	"binary-annotator-pro/models"
+	"binary-annotator-pro/services"
+	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/labstack/echo/v4"
 )
 
+// defaultAISettings fills in what a user hasn't configured
+var defaultAISettings = models.AISettings{
+	Provider:    "ollama",
+	OllamaURL:   "http://localhost:11434",
+	OllamaModel: "llama2",
+	OpenAIModel: "gpt-4",
+	ClaudeModel: "claude-3-5-sonnet-20241022",
+	GeminiModel: "gemini-3-pro-preview",
+}
+
+// maxAIModelName bounds model names; real ones are a few dozen characters
+const maxAIModelName = 128
+
 // AISettingsHandler handles AI settings operations
 type AISettingsHandler struct {
 	db *config.DB
@@ -32,12 +50,12 @@ func (h *AISettingsHandler) GetAISettings(c echo.Context) error {
 		// Return default settings if not found
 		if result.RowsAffected == 0 {
 			return c.JSON(http.StatusOK, map[string]interface{}{
-				"provider":      "ollama",
-				"ollama_url":    "http://localhost:11434",
-				"ollama_model":  "llama2",
-				"openai_model":  "gpt-4",
-				"claude_model":  "claude-3-5-sonnet-20241022",
-				"gemini_model":  "gemini-3-pro-preview",
+				"provider":      defaultAISettings.Provider,
+				"ollama_url":    defaultAISettings.OllamaURL,
+				"ollama_model":  defaultAISettings.OllamaModel,
+				"openai_model":  defaultAISettings.OpenAIModel,
+				"claude_model":  defaultAISettings.ClaudeModel,
+				"gemini_model":  defaultAISettings.GeminiModel,
 				"user_id":       userID,
 				"thinking":      false,
 				"is_configured": false,
@@ -81,55 +99,78 @@ func (h *AISettingsHandler) GetAISettings(c echo.Context) error {
 	return c.JSON(http.StatusOK, response)
 }
 
-// SaveAISettings creates or updates AI settings for a user
+// SaveAISettings creates or updates AI settings for a user. Fields left
+// empty keep their stored value (or the default on creation), so a client
+// can switch providers or rotate one key without resending the others. The
+// settings are validated as a whole: the active provider must have a key,
+// or a URL for Ollama.
 func (h *AISettingsHandler) SaveAISettings(c echo.Context) error {
 	userID := c.Param("userId")
 	if userID == "" {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "missing user_id"})
 	}
 
-	var req models.AISettings
+	var req struct {
+		models.AISettings
+		Thinking *bool `json:"thinking"` // nil keeps the stored value
+	}
 	if err := c.Bind(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
 	}
 
-	// Ensure user_id matches
-	req.UserID = userID
-
 	// Check if settings exist
 	var existing models.AISettings
-	result := h.db.GormDB.Where("user_id = ?", userID).First(&existing)
+	result := h.db.GormDB.Where("user_id = ?", userID).Limit(1).Find(&existing)
+	if result.Error != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "database error"})
+	}
+	created := result.RowsAffected == 0
+	if created {
+		existing = defaultAISettings
+		existing.UserID = userID
+	}
 
-	if result.RowsAffected == 0 {
-		// Create new settings
-		if err := h.db.GormDB.Create(&req).Error; err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to create settings"})
+	// Only update fields that were provided (non-empty)
+	for _, field := range []struct {
+		dst *string
+		src string
+	}{
+		{&existing.Provider, req.Provider},
+		{&existing.OllamaURL, req.OllamaURL},
+		{&existing.OllamaModel, req.OllamaModel},
+		{&existing.OpenAIKey, req.OpenAIKey},
+		{&existing.OpenAIModel, req.OpenAIModel},
+		{&existing.ClaudeKey, req.ClaudeKey},
+		{&existing.ClaudeModel, req.ClaudeModel},
+		{&existing.GeminiKey, req.GeminiKey},
+		{&existing.GeminiModel, req.GeminiModel},
+	} {
+		if v := strings.TrimSpace(field.src); v != "" {
+			*field.dst = v
 		}
-		return c.JSON(http.StatusCreated, map[string]interface{}{
-			"id":      req.ID,
-			"user_id": req.UserID,
-			"message": "AI settings created",
-		})
+	}
+	if req.Thinking != nil {
+		existing.Thinking = *req.Thinking
 	}
 
-	// Update existing settings
-	existing.Provider = req.Provider
-	existing.OllamaURL = req.OllamaURL
-	existing.OllamaModel = req.OllamaModel
-	existing.OpenAIModel = req.OpenAIModel
-	existing.ClaudeModel = req.ClaudeModel
-	existing.GeminiModel = req.GeminiModel
-	existing.Thinking = req.Thinking
-
-	// Only update API keys if provided (non-empty)
-	if req.OpenAIKey != "" {
-		existing.OpenAIKey = req.OpenAIKey
+	if err := validateAISettings(&existing); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
-	if req.ClaudeKey != "" {
-		existing.ClaudeKey = req.ClaudeKey
+
+	if err := encryptAIKeys(&existing); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to encrypt API keys"})
 	}
-	if req.GeminiKey != "" {
-		existing.GeminiKey = req.GeminiKey
+
+	if created {
+		if err := h.db.GormDB.Create(&existing).Error; err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to create settings"})
+		}
+		return c.JSON(http.StatusCreated, map[string]interface{}{
+			"id":       existing.ID,
+			"user_id":  existing.UserID,
+			"provider": existing.Provider,
+			"message":  "AI settings created",
+		})
 	}
 
 	if err := h.db.GormDB.Save(&existing).Error; err != nil {
@@ -137,12 +178,126 @@ func (h *AISettingsHandler) SaveAISettings(c echo.Context) error {
 	}
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
-		"id":      existing.ID,
-		"user_id": existing.UserID,
-		"message": "AI settings updated",
+		"id":       existing.ID,
+		"user_id":  existing.UserID,
+		"provider": existing.Provider,
+		"message":  "AI settings updated",
 	})
 }
 
+// aiKeyField is an API key field of settings and the scope its ciphertext is
+// bound to, so a key cannot be moved to another user or provider
+type aiKeyField struct {
+	value *string
+	scope string
+}
+
+// aiKeyFields returns the API key fields of settings
+func aiKeyFields(s *models.AISettings) []aiKeyField {
+	scope := "ai_settings/" + s.UserID + "/"
+	return []aiKeyField{
+		{&s.OpenAIKey, scope + "openai_key"},
+		{&s.ClaudeKey, scope + "claude_key"},
+		{&s.GeminiKey, scope + "gemini_key"},
+	}
+}
+
+// encryptAIKeys encrypts the API keys of settings that are still plaintext,
+// when AI_SETTINGS_KEY is set
+func encryptAIKeys(s *models.AISettings) error {
+	for _, key := range aiKeyFields(s) {
+		encrypted, err := services.EncryptSecret(*key.value, key.scope)
+		if err != nil {
+			return err
+		}
+		*key.value = encrypted
+	}
+	return nil
+}
+
+// decryptAIKeys replaces the stored API keys of settings with their
+// plaintext, right before they are handed to a provider client
+func decryptAIKeys(s *models.AISettings) error {
+	for _, key := range aiKeyFields(s) {
+		plaintext, err := services.DecryptSecret(*key.value, key.scope)
+		if err != nil {
+			return fmt.Errorf("cannot read the stored API key: %w", err)
+		}
+		*key.value = plaintext
+	}
+	return nil
+}
+
+// EncryptStoredAIKeys encrypts the API keys saved before AI_SETTINGS_KEY was
+// set, and re-encrypts legacy ciphertexts bound to no scope. Without the key
+// it only warns when API keys are stored in plaintext. It returns the number
+// of settings rows it changed.
+func EncryptStoredAIKeys(db *config.DB) (int, error) {
+	if !services.SecretsEnabled() {
+		var plaintext int64
+		err := db.GormDB.Model(&models.AISettings{}).
+			Where("(open_ai_key <> '' AND open_ai_key NOT LIKE 'enc:%') OR (claude_key <> '' AND claude_key NOT LIKE 'enc:%') OR (gemini_key <> '' AND gemini_key NOT LIKE 'enc:%')").
+			Count(&plaintext).Error
+		if err != nil {
+			return 0, err
+		}
+		if plaintext > 0 {
+			log.Printf("WARNING: %d AI settings store API keys in plaintext; set %s to encrypt them at rest", plaintext, services.SecretsKeyEnv)
+		}
+		return 0, nil
+	}
+	var all []models.AISettings
+	if err := db.GormDB.Find(&all).Error; err != nil {
+		return 0, err
+	}
+	changed := 0
+	for i := range all {
+		before := all[i]
+		if err := encryptAIKeys(&all[i]); err != nil {
+			return changed, err
+		}
+		if all[i].OpenAIKey == before.OpenAIKey && all[i].ClaudeKey == before.ClaudeKey && all[i].GeminiKey == before.GeminiKey {
+			continue
+		}
+		if err := db.GormDB.Model(&all[i]).Select("OpenAIKey", "ClaudeKey", "GeminiKey").Updates(&all[i]).Error; err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+// validateAISettings checks the provider is known and usable, the Ollama URL
+// is an http(s) URL and keys and model names are single tokens
+func validateAISettings(s *models.AISettings) error {
+	keys := map[string]string{"openai": s.OpenAIKey, "claude": s.ClaudeKey, "gemini": s.GeminiKey}
+	switch s.Provider {
+	case "ollama":
+	case "openai", "claude", "gemini":
+		if keys[s.Provider] == "" {
+			return fmt.Errorf("%s_key is required to use the %s provider", s.Provider, s.Provider)
+		}
+	default:
+		return fmt.Errorf("unknown provider %q: use ollama, openai, claude or gemini", s.Provider)
+	}
+
+	if u, err := url.Parse(s.OllamaURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("ollama_url must be an http or https URL")
+	}
+	for provider, key := range keys {
+		if strings.ContainsAny(key, " \t\r\n") {
+			return fmt.Errorf("%s_key must not contain whitespace", provider)
+		}
+	}
+	for field, model := range map[string]string{"ollama_model": s.OllamaModel, "openai_model": s.OpenAIModel,
+		"claude_model": s.ClaudeModel, "gemini_model": s.GeminiModel} {
+		if len(model) > maxAIModelName || strings.ContainsAny(model, " \t\r\n") {
+			return fmt.Errorf("%s must be a model name without whitespace, at most %d characters", field, maxAIModelName)
+		}
+	}
+	return nil
+}
+
 // DeleteAISettings deletes AI settings for a user
 func (h *AISettingsHandler) DeleteAISettings(c echo.Context) error {
 	userID := c.Param("userId")
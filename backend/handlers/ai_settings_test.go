@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"binary-annotator-pro/models"
+	"binary-annotator-pro/services"
+)
+
+func putAISettings(t *testing.T, h *AISettingsHandler, userID string, body map[string]interface{}, wantStatus int) map[string]interface{} {
+	t.Helper()
+	c, rec := newJSONContext(http.MethodPut, "/settings/"+userID, body)
+	c.SetParamNames("userId")
+	c.SetParamValues(userID)
+	if err := h.SaveAISettings(c); err != nil {
+		t.Fatalf("SaveAISettings() error = %v", err)
+	}
+	var resp map[string]interface{}
+	decodeJSON(t, rec, wantStatus, &resp)
+	return resp
+}
+
+func getAISettings(t *testing.T, h *AISettingsHandler, userID string) (map[string]interface{}, string) {
+	t.Helper()
+	c, rec := newJSONContext(http.MethodGet, "/settings/"+userID, nil)
+	c.SetParamNames("userId")
+	c.SetParamValues(userID)
+	if err := h.GetAISettings(c); err != nil {
+		t.Fatalf("GetAISettings() error = %v", err)
+	}
+	body := rec.Body.String()
+	var resp map[string]interface{}
+	decodeJSON(t, rec, http.StatusOK, &resp)
+	return resp, body
+}
+
+// TestSaveAISettings creates settings with defaults, switches provider while
+// keeping the stored key, and never returns keys on read
+func TestSaveAISettings(t *testing.T) {
+	h := NewAISettingsHandler(newTestHandler(t).db)
+	const user = "5f0c9a52-user"
+
+	resp := putAISettings(t, h, user, map[string]interface{}{"provider": "ollama", "ollama_model": "mistral"}, http.StatusCreated)
+	if resp["provider"] != "ollama" {
+		t.Fatalf("create response = %v", resp)
+	}
+	got, _ := getAISettings(t, h, user)
+	if got["ollama_model"] != "mistral" || got["ollama_url"] != defaultAISettings.OllamaURL || got["is_configured"] != true {
+		t.Errorf("settings after create = %v, want mistral on the default URL", got)
+	}
+
+	// A cloud provider needs its key
+	resp = putAISettings(t, h, user, map[string]interface{}{"provider": "claude"}, http.StatusBadRequest)
+	if !strings.Contains(resp["error"].(string), "claude_key") {
+		t.Errorf("error = %v, want claude_key required", resp["error"])
+	}
+	putAISettings(t, h, user, map[string]interface{}{"provider": "claude", "claude_key": "sk-ant-secret-1"}, http.StatusOK)
+
+	// Switching away and back keeps the key stored earlier
+	putAISettings(t, h, user, map[string]interface{}{"provider": "ollama"}, http.StatusOK)
+	putAISettings(t, h, user, map[string]interface{}{"provider": "claude"}, http.StatusOK)
+
+	// Thinking is only changed when sent
+	putAISettings(t, h, user, map[string]interface{}{"thinking": true}, http.StatusOK)
+	putAISettings(t, h, user, map[string]interface{}{"provider": "ollama"}, http.StatusOK)
+	putAISettings(t, h, user, map[string]interface{}{"provider": "claude"}, http.StatusOK)
+
+	got, body := getAISettings(t, h, user)
+	if got["provider"] != "claude" || got["has_claude_key"] != true || got["ollama_model"] != "mistral" || got["thinking"] != true {
+		t.Errorf("settings after switching = %v", got)
+	}
+	putAISettings(t, h, user, map[string]interface{}{"thinking": false}, http.StatusOK)
+	if got, _ := getAISettings(t, h, user); got["thinking"] != false {
+		t.Errorf("thinking = %v after turning it off", got["thinking"])
+	}
+	if strings.Contains(body, "sk-ant-secret-1") || strings.Contains(body, `"claude_key"`) {
+		t.Errorf("GET leaked the key: %s", body)
+	}
+
+	var stored models.AISettings
+	h.db.GormDB.Where("user_id = ?", user).First(&stored)
+	if stored.ClaudeKey != "sk-ant-secret-1" {
+		t.Errorf("stored claude key = %q", stored.ClaudeKey)
+	}
+
+	for name, body := range map[string]map[string]interface{}{
+		"unknown provider": {"provider": "mystery"},
+		"bad ollama url":   {"ollama_url": "localhost:11434"},
+		"spaced key":       {"openai_key": "sk one"},
+		"spaced model":     {"gemini_model": "gemini pro"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			putAISettings(t, h, user, body, http.StatusBadRequest)
+		})
+	}
+}
+
+// TestAIKeysEncryptedAtRest stores keys as ciphertext once AI_SETTINGS_KEY is
+// set, encrypts rows saved before, and decrypts them for provider calls
+func TestAIKeysEncryptedAtRest(t *testing.T) {
+	h := NewAISettingsHandler(newTestHandler(t).db)
+
+	// Saved while encryption was off
+	putAISettings(t, h, "legacy", map[string]interface{}{"provider": "gemini", "gemini_key": "AIza-legacy"}, http.StatusCreated)
+	if n, err := EncryptStoredAIKeys(h.db); err != nil || n != 0 {
+		t.Fatalf("EncryptStoredAIKeys() without a key = %d, %v, want 0 rows", n, err)
+	}
+
+	t.Setenv(services.SecretsKeyEnv, "test master key")
+	putAISettings(t, h, "new", map[string]interface{}{"provider": "openai", "openai_key": "sk-new-secret"}, http.StatusCreated)
+
+	if n, err := EncryptStoredAIKeys(h.db); err != nil || n != 1 {
+		t.Fatalf("EncryptStoredAIKeys() = %d, %v, want 1 row", n, err)
+	}
+	if n, _ := EncryptStoredAIKeys(h.db); n != 0 {
+		t.Errorf("second EncryptStoredAIKeys() changed %d rows, want 0", n)
+	}
+
+	for user, want := range map[string]string{"legacy": "AIza-legacy", "new": "sk-new-secret"} {
+		var raw string
+		h.db.GormDB.Raw("SELECT open_ai_key || gemini_key FROM ai_settings WHERE user_id = ?", user).Scan(&raw)
+		if !services.IsEncryptedSecret(raw) || strings.Contains(raw, want) {
+			t.Errorf("%s: stored key column = %q, want ciphertext", user, raw)
+		}
+
+		var settings models.AISettings
+		h.db.GormDB.Where("user_id = ?", user).First(&settings)
+		if err := decryptAIKeys(&settings); err != nil {
+			t.Fatalf("%s: decryptAIKeys() error = %v", user, err)
+		}
+		if got := settings.OpenAIKey + settings.GeminiKey; got != want {
+			t.Errorf("%s: decrypted key = %q, want %q", user, got, want)
+		}
+	}
+
+	// Updating other fields keeps the stored key usable
+	putAISettings(t, h, "new", map[string]interface{}{"openai_model": "gpt-4o"}, http.StatusOK)
+	var settings models.AISettings
+	h.db.GormDB.Where("user_id = ?", "new").First(&settings)
+	if err := decryptAIKeys(&settings); err != nil || settings.OpenAIKey != "sk-new-secret" {
+		t.Errorf("key after update = %q, %v", settings.OpenAIKey, err)
+	}
+}
+
+// TestAIKeysBoundToRow refuses a stored key copied to another user or
+// provider field
+func TestAIKeysBoundToRow(t *testing.T) {
+	h := NewAISettingsHandler(newTestHandler(t).db)
+	t.Setenv(services.SecretsKeyEnv, "test master key")
+	putAISettings(t, h, "alice", map[string]interface{}{"provider": "openai", "openai_key": "sk-alice"}, http.StatusCreated)
+	putAISettings(t, h, "mallory", map[string]interface{}{"provider": "openai", "openai_key": "sk-mallory"}, http.StatusCreated)
+
+	var alice models.AISettings
+	h.db.GormDB.Where("user_id = ?", "alice").First(&alice)
+
+	swapped := models.AISettings{UserID: "mallory", OpenAIKey: alice.OpenAIKey}
+	if err := decryptAIKeys(&swapped); err == nil {
+		t.Errorf("key copied to another user decrypted to %q", swapped.OpenAIKey)
+	}
+	moved := models.AISettings{UserID: "alice", ClaudeKey: alice.OpenAIKey}
+	if err := decryptAIKeys(&moved); err == nil {
+		t.Errorf("key copied to another field decrypted to %q", moved.ClaudeKey)
+	}
+	if err := decryptAIKeys(&alice); err != nil || alice.OpenAIKey != "sk-alice" {
+		t.Errorf("decryptAIKeys() = %q, %v, want sk-alice", alice.OpenAIKey, err)
+	}
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"binary-annotator-pro/models"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// File summary limits. The summary is meant to be cheap enough to fetch on
+// every file open, so the pattern count only looks at the start of a file.
+const (
+	summaryHeaderBytes        = 64
+	summaryPatternLength      = 4
+	summaryPatternScanBytes   = 1 << 20
+	summaryTopPatterns        = 3
+	summaryEntropyWindow      = 1024
+	summaryHighEntropy        = 7.0
+	summaryMaxEntropyRegions  = 100
+	summaryMaxPeriodicResults = 5
+)
+
+// RepeatedPattern is a byte sequence found several times in a file
+type RepeatedPattern struct {
+	Bytes       string `json:"bytes"` // hex
+	FirstOffset int    `json:"first_offset"`
+	Occurrences int    `json:"occurrences"`
+}
+
+// PeriodicStructure is a record size the data repeats at. Confidence is the
+// share of records that match the next one.
+type PeriodicStructure struct {
+	Period     int     `json:"period"`
+	Confidence float64 `json:"confidence"`
+}
+
+// EntropyRegion is a run of windows whose entropy reaches summaryHighEntropy,
+// typically compressed or encrypted data
+type EntropyRegion struct {
+	Offset  int     `json:"offset"`
+	Length  int     `json:"length"`
+	Entropy float64 `json:"entropy"` // highest window entropy in the region
+}
+
+// FileSummaryResponse is the overview returned by GET /files/:id/analyze
+type FileSummaryResponse struct {
+	FileID             uint                `json:"file_id"`
+	Name               string              `json:"name"`
+	Size               int                 `json:"size"`
+	Entropy            float64             `json:"entropy"`
+	Header             string              `json:"header"` // hex of the first 64 bytes
+	Patterns           []RepeatedPattern   `json:"patterns"`
+	PeriodicStructures []PeriodicStructure `json:"periodic_structures"`
+	HighEntropyRegions []EntropyRegion     `json:"high_entropy_regions"`
+}
+
+// AnalyzeFile returns an overview of a file in one call: size, entropy,
+// header bytes, the most repeated patterns, record periodicity and the high
+// entropy regions
+func (h *Handler) AnalyzeFile(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid file id")
+	}
+	var file models.File
+	if err := h.db.GormDB.First(&file, id).Error; err != nil {
+		return apiError(c, http.StatusNotFound, ErrCodeFileNotFound, "file not found")
+	}
+	if file.Entropy == nil {
+		file.Entropy = fileEntropy(file.Data)
+		h.db.GormDB.Model(&file).Update("entropy", *file.Entropy)
+	}
+
+	header := file.Data
+	if len(header) > summaryHeaderBytes {
+		header = header[:summaryHeaderBytes]
+	}
+	return c.JSON(http.StatusOK, FileSummaryResponse{
+		FileID:             file.ID,
+		Name:               file.Name,
+		Size:               len(file.Data),
+		Entropy:            *file.Entropy,
+		Header:             hex.EncodeToString(header),
+		Patterns:           repeatedPatterns(file.Data),
+		PeriodicStructures: periodicStructures(file.Data, 32, 4096),
+		HighEntropyRegions: highEntropyRegions(file.Data),
+	})
+}
+
+// repeatedPatterns returns the summaryTopPatterns most frequent 4-byte
+// sequences of the start of data, counting non-overlapping occurrences.
+// Runs of a single byte value are padding rather than structure and are left
+// out.
+func repeatedPatterns(data []byte) []RepeatedPattern {
+	if len(data) > summaryPatternScanBytes {
+		data = data[:summaryPatternScanBytes]
+	}
+	type seen struct {
+		first, last, count int
+	}
+	counts := map[string]*seen{}
+	for i := 0; i+summaryPatternLength <= len(data); i++ {
+		gram := data[i : i+summaryPatternLength]
+		if uniformBytes(gram) {
+			continue
+		}
+		s, ok := counts[string(gram)]
+		if !ok {
+			counts[string(gram)] = &seen{first: i, last: i, count: 1}
+			continue
+		}
+		if i >= s.last+summaryPatternLength {
+			s.last = i
+			s.count++
+		}
+	}
+
+	patterns := []RepeatedPattern{}
+	for gram, s := range counts {
+		if s.count > 1 {
+			patterns = append(patterns, RepeatedPattern{Bytes: hex.EncodeToString([]byte(gram)), FirstOffset: s.first, Occurrences: s.count})
+		}
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if patterns[i].Occurrences != patterns[j].Occurrences {
+			return patterns[i].Occurrences > patterns[j].Occurrences
+		}
+		return patterns[i].FirstOffset < patterns[j].FirstOffset
+	})
+	if len(patterns) > summaryTopPatterns {
+		patterns = patterns[:summaryTopPatterns]
+	}
+	return patterns
+}
+
+func uniformBytes(b []byte) bool {
+	for _, v := range b[1:] {
+		if v != b[0] {
+			return false
+		}
+	}
+	return true
+}
+
+// periodicStructures tries power-of-two record sizes between minPeriod and
+// maxPeriod and keeps those where most records start like the next one
+// (more than 80% of their first 32 bytes equal). It follows the frontend's
+// findPeriodicStructures so both report the same periods.
+func periodicStructures(data []byte, minPeriod, maxPeriod int) []PeriodicStructure {
+	results := []PeriodicStructure{}
+	for period := minPeriod; period <= maxPeriod; period *= 2 {
+		compareSize := min(32, period)
+		matches, total := 0, 0
+		for i := 0; i+period*2 < len(data); i += period {
+			total++
+			same := 0
+			for j := 0; j < compareSize; j++ {
+				if data[i+j] == data[i+period+j] {
+					same++
+				}
+			}
+			if float64(same) > float64(compareSize)*0.8 {
+				matches++
+			}
+		}
+		if total == 0 {
+			continue
+		}
+		if confidence := float64(matches) / float64(total); confidence > 0.5 && matches > 3 {
+			results = append(results, PeriodicStructure{Period: period, Confidence: confidence})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Confidence > results[j].Confidence })
+	if len(results) > summaryMaxPeriodicResults {
+		results = results[:summaryMaxPeriodicResults]
+	}
+	return results
+}
+
+// highEntropyRegions splits data into summaryEntropyWindow-byte windows and
+// merges consecutive windows at or above summaryHighEntropy into regions. A
+// trailing window shorter than a full one is skipped: too few bytes to
+// reach a high entropy.
+func highEntropyRegions(data []byte) []EntropyRegion {
+	regions := []EntropyRegion{}
+	var current *EntropyRegion
+	for offset := 0; offset+summaryEntropyWindow <= len(data); offset += summaryEntropyWindow {
+		entropy := *fileEntropy(data[offset : offset+summaryEntropyWindow])
+		if entropy < summaryHighEntropy {
+			current = nil
+			continue
+		}
+		if current == nil {
+			if len(regions) == summaryMaxEntropyRegions {
+				break
+			}
+			regions = append(regions, EntropyRegion{Offset: offset})
+			current = &regions[len(regions)-1]
+		}
+		current.Length += summaryEntropyWindow
+		current.Entropy = max(current.Entropy, entropy)
+	}
+	return regions
+}
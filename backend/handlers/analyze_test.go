@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// TestAnalyzeFile summarizes a file made of a header, 200 64-byte records and
+// a block of pseudo-random bytes
+func TestAnalyzeFile(t *testing.T) {
+	h := newTestHandler(t)
+	data := []byte("HDR1")
+	for i := 4; i < 64; i++ {
+		data = append(data, byte(i))
+	}
+	for i := 0; i < 200; i++ {
+		record := make([]byte, 64)
+		copy(record, "REC\x01")
+		record[4] = byte(i) | 0x80
+		copy(record[8:], "sensor-a")
+		data = append(data, record...)
+	}
+	randomStart := len(data)
+	state := uint32(7)
+	for i := 0; i < 4096; i++ {
+		state = state*1664525 + 1013904223
+		data = append(data, byte(state>>24))
+	}
+	file := createTestFile(t, h, "records.bin", data)
+
+	c, rec := newJSONContext(http.MethodGet, fmt.Sprintf("/files/%d/analyze", file.ID), nil)
+	c.SetParamNames("id")
+	c.SetParamValues(fmt.Sprint(file.ID))
+	if err := h.AnalyzeFile(c); err != nil {
+		t.Fatalf("AnalyzeFile() error = %v", err)
+	}
+	var resp FileSummaryResponse
+	decodeJSON(t, rec, http.StatusOK, &resp)
+
+	if resp.Size != len(data) {
+		t.Errorf("size = %d, want %d", resp.Size, len(data))
+	}
+	if resp.Entropy <= 0 || resp.Entropy >= 8 {
+		t.Errorf("entropy = %v, want between 0 and 8", resp.Entropy)
+	}
+	if want := hex.EncodeToString(data[:64]); resp.Header != want {
+		t.Errorf("header = %s, want %s", resp.Header, want)
+	}
+
+	if len(resp.Patterns) != 3 {
+		t.Fatalf("patterns = %+v, want 3", resp.Patterns)
+	}
+	if top := resp.Patterns[0]; top.Bytes != hex.EncodeToString([]byte("REC\x01")) || top.Occurrences != 200 || top.FirstOffset != 64 {
+		t.Errorf("top pattern = %+v, want REC\\x01 x200 at 64", top)
+	}
+
+	found := false
+	for _, p := range resp.PeriodicStructures {
+		if p.Period == 64 && p.Confidence > 0.5 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("periodic structures = %+v, want period 64", resp.PeriodicStructures)
+	}
+
+	if len(resp.HighEntropyRegions) != 1 {
+		t.Fatalf("high entropy regions = %+v, want 1", resp.HighEntropyRegions)
+	}
+	region := resp.HighEntropyRegions[0]
+	if region.Offset < randomStart-summaryEntropyWindow || region.Offset+region.Length > len(data) || region.Length < 2*summaryEntropyWindow {
+		t.Errorf("high entropy region = %+v, want inside the random block at %d", region, randomStart)
+	}
+}
@@ -2,11 +2,14 @@ package handlers
 
 import (
 	"binary-annotator-pro/models"
+	"errors"
 	"fmt"
-	"math"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
 )
 
 type DeleteBinaryRequest struct {
@@ -16,20 +19,20 @@ type DeleteBinaryRequest struct {
 func (h *Handler) DeleteBinaryFile(c echo.Context) error {
 	name := c.Param("name")
 	if name == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "missing file name",
-		})
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "missing file name")
 	}
 	fmt.Printf("Deleting binary file: %s\n", name)
 
+	var ids []uint
+	h.db.GormDB.Model(&models.File{}).Where("name = ?", name).Pluck("id", &ids)
+
 	// Delete from DB (hard delete with Unscoped to allow re-uploading with same name)
 	res := h.db.GormDB.Unscoped().Where("name = ?", name).Delete(&models.File{})
 	if res.Error != nil {
 		fmt.Printf("Error deleting file from DB: %v\n", res.Error)
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": res.Error.Error(),
-		})
+		return apiError(c, http.StatusInternalServerError, ErrCodeInternal, res.Error.Error())
 	}
+	h.files.remove(ids...)
 
 	return c.JSON(http.StatusOK, map[string]string{
 		"message": "file deleted",
@@ -41,7 +44,7 @@ func (h *Handler) DeleteBinaryFile(c echo.Context) error {
 func (h *Handler) RenameBinaryFile(c echo.Context) error {
 	oldName := c.Param("name")
 	if oldName == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "name required"})
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "name required")
 	}
 
 	var req struct {
@@ -49,11 +52,11 @@ func (h *Handler) RenameBinaryFile(c echo.Context) error {
 	}
 
 	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid request body")
 	}
 
 	if req.NewName == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "new_name required"})
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "new_name required")
 	}
 
 	fmt.Printf("Renaming binary file: %s -> %s\n", oldName, req.NewName)
@@ -61,20 +64,21 @@ func (h *Handler) RenameBinaryFile(c echo.Context) error {
 	// Check if old file exists
 	var file models.File
 	if err := h.db.GormDB.Where("name = ?", oldName).First(&file).Error; err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "file not found"})
+		return apiError(c, http.StatusNotFound, ErrCodeFileNotFound, "file not found")
 	}
 
 	// Check if new name already exists
 	var existing models.File
 	if err := h.db.GormDB.Where("name = ?", req.NewName).First(&existing).Error; err == nil {
-		return c.JSON(http.StatusConflict, map[string]string{"error": "file with new name already exists"})
+		return apiError(c, http.StatusConflict, ErrCodeConflict, "file with new name already exists")
 	}
 
 	// Update the file name
 	file.Name = req.NewName
 	if err := h.db.GormDB.Save(&file).Error; err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return apiError(c, http.StatusInternalServerError, ErrCodeInternal, err.Error())
 	}
+	h.files.remove(file.ID)
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"message":  "renamed",
@@ -88,7 +92,7 @@ func (h *Handler) RenameBinaryFile(c echo.Context) error {
 func (h *Handler) GetBinaryChunk(c echo.Context) error {
 	fileID := c.Param("id")
 	if fileID == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "file ID required"})
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "file ID required")
 	}
 
 	// Parse query params
@@ -104,21 +108,22 @@ func (h *Handler) GetBinaryChunk(c echo.Context) error {
 
 	// Validate
 	if offset < 0 {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "offset must be non-negative"})
+		return apiError(c, http.StatusBadRequest, ErrCodeOutOfRange, "offset must be non-negative")
 	}
 	if length <= 0 || length > 10*1024*1024 { // Max 10MB per chunk
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "length must be between 1 and 10MB"})
+		return apiError(c, http.StatusBadRequest, ErrCodeOutOfRange, "length must be between 1 and 10MB")
 	}
 
-	// Load file from DB (only metadata first)
+	// Load file from DB, the contents from the cache when the viewer
+	// already fetched a chunk of it
 	var file models.File
-	if err := h.db.GormDB.First(&file, fileID).Error; err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "file not found"})
+	if err := h.files.load(h.db.GormDB, &file, fileID); err != nil {
+		return apiError(c, http.StatusNotFound, ErrCodeFileNotFound, "file not found")
 	}
 
 	// Validate offset against file size
 	if offset >= len(file.Data) {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "offset exceeds file size"})
+		return apiError(c, http.StatusBadRequest, ErrCodeOutOfRange, "offset exceeds file size")
 	}
 
 	// Calculate actual end offset
@@ -130,16 +135,60 @@ func (h *Handler) GetBinaryChunk(c echo.Context) error {
 	// Extract chunk
 	chunk := file.Data[offset:endOffset]
 
+	resp := map[string]interface{}{
+		"file_id":   file.ID,
+		"file_name": file.Name,
+		"file_size": len(file.Data),
+		"offset":    offset,
+		"length":    len(chunk),
+		"has_more":  endOffset < len(file.Data),
+	}
+
+	// ?format=hexdump returns the chunk formatted for display instead of raw data
+	switch c.QueryParam("format") {
+	case "", "raw":
+		resp["data"] = chunk // Will be base64 encoded by Go JSON
+	case "hexdump":
+		resp["hexdump"] = formatHexdump(chunk, offset)
+	default:
+		return apiError(c, http.StatusBadRequest, ErrCodeUnsupported, "format must be raw or hexdump")
+	}
+
 	// Return chunk data
-	return c.JSON(http.StatusOK, map[string]interface{}{
-		"file_id":    file.ID,
-		"file_name":  file.Name,
-		"file_size":  len(file.Data),
-		"offset":     offset,
-		"length":     len(chunk),
-		"data":       chunk, // Will be base64 encoded by Go JSON
-		"has_more":   endOffset < len(file.Data),
-	})
+	return c.JSON(http.StatusOK, resp)
+}
+
+// formatHexdump renders data like `hexdump -C`: 16 bytes per line with the
+// file offset, two groups of 8 hex bytes and the printable ASCII characters
+// ('.' for the rest). Short last lines are padded so the columns line up.
+func formatHexdump(data []byte, baseOffset int) string {
+	var b strings.Builder
+	for lineStart := 0; lineStart < len(data); lineStart += 16 {
+		line := data[lineStart:min(lineStart+16, len(data))]
+
+		fmt.Fprintf(&b, "%08x  ", baseOffset+lineStart)
+		for i := 0; i < 16; i++ {
+			if i < len(line) {
+				fmt.Fprintf(&b, "%02x ", line[i])
+			} else {
+				b.WriteString("   ")
+			}
+			if i == 7 {
+				b.WriteByte(' ')
+			}
+		}
+
+		b.WriteString(" |")
+		for _, v := range line {
+			if v >= 0x20 && v < 0x7f {
+				b.WriteByte(v)
+			} else {
+				b.WriteByte('.')
+			}
+		}
+		b.WriteString("|\n")
+	}
+	return b.String()
 }
 
 // Trigram represents a 3-byte sequence with position
@@ -157,61 +206,187 @@ type TrigramResponse struct {
 	Sampled  bool      `json:"sampled"`
 }
 
-// GetBinaryTrigrams calculates trigrams for a binary file
+// Trigram sampling: max_samples defaults to defaultTrigramSamples and may not
+// exceed maxTrigramSamples, which bounds the response size for any file
+const (
+	defaultTrigramSamples = 50000
+	maxTrigramSamples     = 500000
+)
+
+// GetBinaryTrigrams calculates trigrams for a binary file. Files with more
+// trigrams than max_samples are sampled at evenly spaced positions from the
+// first trigram to the last, and only the samples are built.
 func (h *Handler) GetBinaryTrigrams(c echo.Context) error {
 	fileName := c.Param("name")
 	if fileName == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "missing file name",
-		})
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "missing file name")
 	}
 
-	// Get max samples from query param (default 50000)
-	maxSamples := 50000
+	maxSamples := defaultTrigramSamples
 	if ms := c.QueryParam("max_samples"); ms != "" {
-		fmt.Sscanf(ms, "%d", &maxSamples)
+		v, err := strconv.Atoi(ms)
+		if err != nil || v < 1 || v > maxTrigramSamples {
+			return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("max_samples must be 1-%d", maxTrigramSamples))
+		}
+		maxSamples = v
 	}
 
 	// Load file from DB
 	var file models.File
 	if err := h.db.GormDB.Where("name = ?", fileName).First(&file).Error; err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "file not found",
-		})
+		return apiError(c, http.StatusNotFound, ErrCodeFileNotFound, "file not found")
+	}
+
+	trigrams := sampleTrigrams(file.Data, maxSamples)
+	sampled := len(trigrams) < len(file.Data)-2
+
+	fmt.Printf("Generated %d trigrams for file %s (sampled: %v)\n",
+		len(trigrams), fileName, sampled)
+
+	return c.JSON(http.StatusOK, TrigramResponse{
+		Trigrams: trigrams,
+		Total:    len(trigrams),
+		Sampled:  sampled,
+	})
+}
+
+// sampleTrigrams returns at most maxSamples trigrams evenly spread over data.
+// Position runs from 0 (first trigram) to 1 (last trigram).
+func sampleTrigrams(data []byte, maxSamples int) []Trigram {
+	n := len(data) - 2 // trigram count
+	if n < 1 {
+		return []Trigram{}
+	}
+	count := n
+	if count > maxSamples {
+		count = maxSamples
+	}
+
+	trigrams := make([]Trigram, count)
+	for k := range trigrams {
+		i := 0
+		if count > 1 {
+			i = int(int64(k) * int64(n-1) / int64(count-1))
+		}
+		t := Trigram{X: data[i], Y: data[i+1], Z: data[i+2]}
+		if n > 1 {
+			t.Position = float64(i) / float64(n-1)
+		}
+		trigrams[k] = t
 	}
+	return trigrams
+}
+
+// BulkFilesRequest selects files by name and/or ID for bulk operations
+type BulkFilesRequest struct {
+	Names  []string `json:"names"`
+	IDs    []uint   `json:"ids"`
+	Vendor *string  `json:"vendor,omitempty"` // bulk-vendor only
+}
 
-	data := file.Data
-	dataLen := len(data)
+// BulkItemResult reports the outcome for one requested file
+type BulkItemResult struct {
+	Name    string `json:"name,omitempty"`
+	ID      uint   `json:"id,omitempty"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// BulkFilesResponse lists per-item results in request order (names first, then IDs)
+type BulkFilesResponse struct {
+	Results   []BulkItemResult `json:"results"`
+	Succeeded int              `json:"succeeded"`
+	Failed    int              `json:"failed"`
+}
 
-	if dataLen < 3 {
-		return c.JSON(http.StatusOK, TrigramResponse{
-			Trigrams: []Trigram{},
-			Total:    0,
-			Sampled:  false,
-		})
+// BulkDeleteFiles hard-deletes many files in one transaction
+func (h *Handler) BulkDeleteFiles(c echo.Context) error {
+	var req BulkFilesRequest
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid request body")
+	}
+	if len(req.Names) == 0 && len(req.IDs) == 0 {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "names or ids required")
 	}
 
-	// Calculate step size for sampling
-	step := int(math.Max(1, math.Floor(float64(dataLen-2)/float64(maxSamples))))
-	sampled := step > 1
+	resp, err := h.applyBulk(req, func(tx *gorm.DB, file *models.File) error {
+		// Unscoped so the names can be re-uploaded, as in DeleteBinaryFile
+		return tx.Unscoped().Delete(file).Error
+	})
+	if err != nil {
+		return apiError(c, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+	}
+	for _, r := range resp.Results {
+		if r.Success {
+			h.files.remove(r.ID)
+		}
+	}
 
-	trigrams := make([]Trigram, 0, maxSamples)
+	fmt.Printf("Bulk delete: %d deleted, %d failed\n", resp.Succeeded, resp.Failed)
+	return c.JSON(http.StatusOK, resp)
+}
 
-	for i := 0; i < dataLen-2; i += step {
-		trigrams = append(trigrams, Trigram{
-			X:        data[i],
-			Y:        data[i+1],
-			Z:        data[i+2],
-			Position: float64(i) / float64(dataLen),
-		})
+// BulkSetVendor sets the vendor on many files in one transaction
+func (h *Handler) BulkSetVendor(c echo.Context) error {
+	var req BulkFilesRequest
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid request body")
+	}
+	if len(req.Names) == 0 && len(req.IDs) == 0 {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "names or ids required")
+	}
+	if req.Vendor == nil {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "vendor required")
 	}
 
-	fmt.Printf("Generated %d trigrams for file %s (sampled: %v, step: %d)\n",
-		len(trigrams), fileName, sampled, step)
+	resp, err := h.applyBulk(req, func(tx *gorm.DB, file *models.File) error {
+		return tx.Model(file).Update("vendor", *req.Vendor).Error
+	})
+	if err != nil {
+		return apiError(c, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+	}
 
-	return c.JSON(http.StatusOK, TrigramResponse{
-		Trigrams: trigrams,
-		Total:    len(trigrams),
-		Sampled:  sampled,
+	return c.JSON(http.StatusOK, resp)
+}
+
+// applyBulk resolves each requested file and applies op inside a single transaction.
+// Missing files are reported per item; a database error rolls everything back.
+func (h *Handler) applyBulk(req BulkFilesRequest, op func(tx *gorm.DB, file *models.File) error) (BulkFilesResponse, error) {
+	resp := BulkFilesResponse{Results: []BulkItemResult{}}
+
+	err := h.db.GormDB.Transaction(func(tx *gorm.DB) error {
+		apply := func(item BulkItemResult, lookup *gorm.DB) error {
+			var file models.File
+			if err := lookup.Select("id, name").First(&file).Error; err != nil {
+				if !errors.Is(err, gorm.ErrRecordNotFound) {
+					return err
+				}
+				item.Error = "file not found"
+				resp.Results = append(resp.Results, item)
+				resp.Failed++
+				return nil
+			}
+			if err := op(tx, &file); err != nil {
+				return err
+			}
+			item.Name, item.ID, item.Success = file.Name, file.ID, true
+			resp.Results = append(resp.Results, item)
+			resp.Succeeded++
+			return nil
+		}
+
+		for _, name := range req.Names {
+			if err := apply(BulkItemResult{Name: name}, tx.Where("name = ?", name)); err != nil {
+				return err
+			}
+		}
+		for _, id := range req.IDs {
+			if err := apply(BulkItemResult{ID: id}, tx.Where("id = ?", id)); err != nil {
+				return err
+			}
+		}
+		return nil
 	})
+
+	return resp, err
 }
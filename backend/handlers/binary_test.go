@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"binary-annotator-pro/models"
+)
+
+// TestBulkDeleteFiles deletes three of five files and checks survivors and counts
+func TestBulkDeleteFiles(t *testing.T) {
+	h := newTestHandler(t)
+
+	var files []models.File
+	for i := 0; i < 5; i++ {
+		files = append(files, createTestFile(t, h, fmt.Sprintf("sample%d.bin", i), []byte{byte(i)}))
+	}
+
+	c, rec := newJSONContext(http.MethodPost, "/files/bulk-delete", BulkFilesRequest{
+		Names: []string{"sample0.bin", "sample2.bin", "missing.bin"},
+		IDs:   []uint{files[4].ID},
+	})
+	if err := h.BulkDeleteFiles(c); err != nil {
+		t.Fatalf("BulkDeleteFiles() error = %v", err)
+	}
+
+	var resp BulkFilesResponse
+	decodeJSON(t, rec, http.StatusOK, &resp)
+
+	if resp.Succeeded != 3 || resp.Failed != 1 {
+		t.Errorf("succeeded/failed = %d/%d, want 3/1", resp.Succeeded, resp.Failed)
+	}
+	if len(resp.Results) != 4 {
+		t.Fatalf("got %d results, want 4", len(resp.Results))
+	}
+	if resp.Results[2].Success || resp.Results[2].Name != "missing.bin" {
+		t.Errorf("missing file result = %+v, want failure for missing.bin", resp.Results[2])
+	}
+
+	var survivors []models.File
+	h.db.GormDB.Unscoped().Order("name").Find(&survivors)
+	assertFileNames(t, survivors, []string{"sample1.bin", "sample3.bin"})
+}
+
+// TestBulkSetVendor sets the vendor on several files at once
+func TestBulkSetVendor(t *testing.T) {
+	h := newTestHandler(t)
+	createTestFile(t, h, "a.bin", []byte{0x01})
+	b := createTestFile(t, h, "b.bin", []byte{0x02})
+	createTestFile(t, h, "c.bin", []byte{0x03})
+
+	vendor := "schiller"
+	c, rec := newJSONContext(http.MethodPost, "/files/bulk-vendor", BulkFilesRequest{
+		Names:  []string{"a.bin"},
+		IDs:    []uint{b.ID, 9999},
+		Vendor: &vendor,
+	})
+	if err := h.BulkSetVendor(c); err != nil {
+		t.Fatalf("BulkSetVendor() error = %v", err)
+	}
+
+	var resp BulkFilesResponse
+	decodeJSON(t, rec, http.StatusOK, &resp)
+	if resp.Succeeded != 2 || resp.Failed != 1 {
+		t.Errorf("succeeded/failed = %d/%d, want 2/1", resp.Succeeded, resp.Failed)
+	}
+
+	var tagged []models.File
+	h.db.GormDB.Where("vendor = ?", vendor).Order("name").Find(&tagged)
+	assertFileNames(t, tagged, []string{"a.bin", "b.bin"})
+
+	c, rec = newJSONContext(http.MethodPost, "/files/bulk-vendor", BulkFilesRequest{Names: []string{"a.bin"}})
+	h.BulkSetVendor(c)
+	decodeJSON(t, rec, http.StatusBadRequest, nil)
+}
+
+// TestGetBinaryChunkHexdump checks hexdump lines are aligned, use file offsets
+// and show non-printable bytes as dots
+func TestGetBinaryChunkHexdump(t *testing.T) {
+	h := newTestHandler(t)
+	data := append([]byte("xxxxHello, world!\x00\x01\x7f\xff"), []byte("ABCDEFGH")...)
+	file := createTestFile(t, h, "dump.bin", data)
+
+	c, rec := newJSONContext(http.MethodGet, "/binary/1/chunk?offset=4&length=29&format=hexdump", nil)
+	c.SetParamNames("id")
+	c.SetParamValues(fmt.Sprint(file.ID))
+	if err := h.GetBinaryChunk(c); err != nil {
+		t.Fatalf("GetBinaryChunk() error = %v", err)
+	}
+	var resp struct {
+		Hexdump string  `json:"hexdump"`
+		Data    *string `json:"data"`
+	}
+	decodeJSON(t, rec, http.StatusOK, &resp)
+
+	want := "" +
+		"00000004  48 65 6c 6c 6f 2c 20 77  6f 72 6c 64 21 00 01 7f  |Hello, world!...|\n" +
+		"00000014  ff 41 42 43 44 45 46 47  48                       |.ABCDEFGH|\n"
+	if resp.Hexdump != want {
+		t.Errorf("hexdump =\n%s\nwant\n%s", resp.Hexdump, want)
+	}
+	if resp.Data != nil {
+		t.Error("hexdump response also carries raw data")
+	}
+
+	c, rec = newJSONContext(http.MethodGet, "/binary/1/chunk?format=xml", nil)
+	c.SetParamNames("id")
+	c.SetParamValues(fmt.Sprint(file.ID))
+	if err := h.GetBinaryChunk(c); err != nil {
+		t.Fatalf("GetBinaryChunk() error = %v", err)
+	}
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown format: status = %d, want 400", rec.Code)
+	}
+}
+
+// TestGetBinaryTrigramsSampling samples a large file down to max_samples
+// trigrams spread over the whole file
+func TestGetBinaryTrigramsSampling(t *testing.T) {
+	h := newTestHandler(t)
+	data := make([]byte, 1<<20)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	createTestFile(t, h, "big.bin", data)
+
+	c, rec := newJSONContext(http.MethodGet, "/analysis/trigrams/big.bin?max_samples=1000", nil)
+	c.SetParamNames("name")
+	c.SetParamValues("big.bin")
+	if err := h.GetBinaryTrigrams(c); err != nil {
+		t.Fatalf("GetBinaryTrigrams() error = %v", err)
+	}
+	var resp TrigramResponse
+	decodeJSON(t, rec, http.StatusOK, &resp)
+
+	if resp.Total > 1000 || len(resp.Trigrams) != resp.Total {
+		t.Fatalf("total = %d, %d trigrams; want at most 1000", resp.Total, len(resp.Trigrams))
+	}
+	if !resp.Sampled {
+		t.Error("sampled = false, want true")
+	}
+	first, last := resp.Trigrams[0], resp.Trigrams[len(resp.Trigrams)-1]
+	if first.Position != 0 || last.Position != 1 {
+		t.Errorf("positions span %v..%v, want 0..1", first.Position, last.Position)
+	}
+	for i := 1; i < len(resp.Trigrams); i++ {
+		if resp.Trigrams[i].Position <= resp.Trigrams[i-1].Position {
+			t.Fatalf("position %d = %v is not after %v", i, resp.Trigrams[i].Position, resp.Trigrams[i-1].Position)
+		}
+	}
+
+	c, rec = newJSONContext(http.MethodGet, "/analysis/trigrams/big.bin?max_samples=0", nil)
+	c.SetParamNames("name")
+	c.SetParamValues("big.bin")
+	if err := h.GetBinaryTrigrams(c); err != nil {
+		t.Fatalf("GetBinaryTrigrams() error = %v", err)
+	}
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("max_samples=0: status = %d, want 400", rec.Code)
+	}
+}
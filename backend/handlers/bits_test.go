@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"testing"
+)
+
+// TestExtractBitFieldAcrossBytes reads a 6-bit field spanning two bytes in both bit orders
+func TestExtractBitFieldAcrossBytes(t *testing.T) {
+	h := newTestHandler(t)
+	// 0xA5 = 1010 0101, 0x3C = 0011 1100
+	file := createTestFile(t, h, "hdr.bin", []byte{0x00, 0xA5, 0x3C, 0xFF})
+
+	tests := []struct {
+		order     string
+		wantValue uint64
+		wantBits  string
+	}{
+		// MSB-first: bits 5-7 of 0xA5 ("101") then bits 0-2 of 0x3C ("001")
+		{"msb", 0x29, "101001"},
+		// LSB-first: bits 5-7 of 0xA5 (1,0,1) then bits 0-2 of 0x3C (0,0,1), first bit least significant
+		{"lsb", 0x25, "100101"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.order, func(t *testing.T) {
+			c, rec := newJSONContext(http.MethodPost, "/files/1/bits", BitFieldRequest{
+				Offset: 1, BitOffset: 5, BitLength: 6, BitOrder: tt.order,
+			})
+			c.SetParamNames("id")
+			c.SetParamValues(fmt.Sprint(file.ID))
+			h.ExtractBitField(c)
+
+			var resp BitFieldResponse
+			decodeJSON(t, rec, http.StatusOK, &resp)
+			if resp.Value != tt.wantValue || resp.Bits != tt.wantBits {
+				t.Errorf("value = %#x bits = %s, want %#x %s", resp.Value, resp.Bits, tt.wantValue, tt.wantBits)
+			}
+		})
+	}
+
+	for _, req := range []BitFieldRequest{
+		{Offset: 3, BitOffset: 4, BitLength: 8},
+		{Offset: 1<<60 + 1, BitLength: 8}, // offset*8 wraps around
+		{BitOffset: math.MaxInt64, BitLength: 8},
+	} {
+		c, rec := newJSONContext(http.MethodPost, "/files/1/bits", req)
+		c.SetParamNames("id")
+		c.SetParamValues(fmt.Sprint(file.ID))
+		h.ExtractBitField(c)
+		decodeJSON(t, rec, http.StatusBadRequest, nil)
+	}
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"binary-annotator-pro/models"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ExtractBlockRequest selects the region of a file to save as a block
+type ExtractBlockRequest struct {
+	Name   string `json:"name"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+}
+
+// ExtractBlock copies data[offset:offset+size] of a file into an ExtractedBlock
+func (h *Handler) ExtractBlock(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid file id"})
+	}
+
+	var req ExtractBlockRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	var file models.File
+	if err := h.files.load(h.db.GormDB, &file, id); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "file not found"})
+	}
+
+	fileSize := int64(len(file.Data))
+	if req.Offset < 0 || req.Size <= 0 || req.Size > fileSize-req.Offset {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": fmt.Sprintf("block 0x%X+%d is outside the file (size %d)", req.Offset, req.Size, fileSize),
+		})
+	}
+	if req.Name == "" {
+		req.Name = fmt.Sprintf("block_0x%X", req.Offset)
+	}
+
+	block := models.ExtractedBlock{
+		FileID:    file.ID,
+		BlockName: req.Name,
+		Offset:    req.Offset,
+		Size:      req.Size,
+		Data:      append([]byte(nil), file.Data[req.Offset:req.Offset+req.Size]...),
+	}
+	if err := h.db.GormDB.Create(&block).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to save block"})
+	}
+	return c.JSON(http.StatusCreated, block)
+}
+
+// SliceFileRequest selects the region of a file to copy into a new File
+type SliceFileRequest struct {
+	Name   string `json:"name"`
+	Offset int64  `json:"offset"`
+	Length int64  `json:"length"`
+}
+
+// SliceFile copies data[offset:offset+length] of a file into a new File, which,
+// unlike an extracted block, can be searched, checksummed and analysed like an upload
+func (h *Handler) SliceFile(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid file id"})
+	}
+
+	var req SliceFileRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	var file models.File
+	if err := h.files.load(h.db.GormDB, &file, id); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "file not found"})
+	}
+
+	fileSize := int64(len(file.Data))
+	if req.Offset < 0 || req.Length <= 0 || req.Length > fileSize-req.Offset {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": fmt.Sprintf("slice 0x%X+%d is outside the file (size %d)", req.Offset, req.Length, fileSize),
+		})
+	}
+	if req.Name == "" {
+		req.Name = fmt.Sprintf("%s.0x%X-0x%X", file.Name, req.Offset, req.Offset+req.Length)
+	}
+
+	data := append([]byte(nil), file.Data[req.Offset:req.Offset+req.Length]...)
+	slice := models.File{
+		Name:    req.Name,
+		Vendor:  file.Vendor,
+		Size:    req.Length,
+		Hash:    contentHash(data),
+		Entropy: fileEntropy(data),
+		Data:    data,
+	}
+	if err := h.db.GormDB.Create(&slice).Error; err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "file with that name already exists"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to save slice"})
+	}
+	h.files.remove(slice.ID)
+
+	return c.JSON(http.StatusCreated, map[string]any{
+		"id":   slice.ID,
+		"name": slice.Name,
+		"size": slice.Size,
+		"hash": slice.Hash,
+		"source": map[string]any{
+			"file_id": file.ID,
+			"offset":  req.Offset,
+			"length":  req.Length,
+		},
+	})
+}
+
+// ListBlocks returns the extracted blocks of a file (without data), ordered by offset
+func (h *Handler) ListBlocks(c echo.Context) error {
+	file, status, err := h.findAnnotatedFile(c)
+	if err != nil {
+		return c.JSON(status, map[string]string{"error": err.Error()})
+	}
+
+	blocks := []models.ExtractedBlock{}
+	if err := h.db.GormDB.
+		Select("id, created_at, file_id, block_name, offset, size").
+		Where("file_id = ?", file.ID).
+		Order("offset, id").
+		Find(&blocks).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, blocks)
+}
+
+// DownloadBlock streams the bytes of an extracted block
+func (h *Handler) DownloadBlock(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid block id"})
+	}
+
+	var block models.ExtractedBlock
+	if err := h.db.GormDB.First(&block, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "block not found"})
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=\"%s.bin\"", filepath.Base(block.BlockName)))
+	return c.Blob(http.StatusOK, "application/octet-stream", block.Data)
+}
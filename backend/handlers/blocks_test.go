@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"binary-annotator-pro/models"
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestExtractBlockBounds rejects regions that don't fit in the file
+func TestExtractBlockBounds(t *testing.T) {
+	h := newTestHandler(t)
+	file := createTestFile(t, h, "ecg.bin", make([]byte, 32))
+
+	for _, req := range []ExtractBlockRequest{
+		{Name: "tail", Offset: 30, Size: 4},
+		{Name: "outside", Offset: 32, Size: 1},
+		{Name: "negative", Offset: -1, Size: 4},
+		{Name: "empty", Offset: 0, Size: 0},
+		{Name: "overflow", Offset: 2, Size: math.MaxInt64},
+	} {
+		c, rec := newJSONContext(http.MethodPost, "/files/1/extract", req)
+		c.SetParamNames("id")
+		c.SetParamValues(fmt.Sprint(file.ID))
+		h.ExtractBlock(c)
+		decodeJSON(t, rec, http.StatusBadRequest, nil)
+	}
+
+	var count int64
+	h.db.GormDB.Model(&models.ExtractedBlock{}).Count(&count)
+	if count != 0 {
+		t.Errorf("blocks = %d, want none saved", count)
+	}
+}
+
+// TestExtractAndDownloadBlock saves a region and reads the exact bytes back
+func TestExtractAndDownloadBlock(t *testing.T) {
+	h := newTestHandler(t)
+	data := make([]byte, 256)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	file := createTestFile(t, h, "ecg.bin", data)
+
+	extract := func(req ExtractBlockRequest) models.ExtractedBlock {
+		c, rec := newJSONContext(http.MethodPost, "/files/1/extract", req)
+		c.SetParamNames("id")
+		c.SetParamValues(fmt.Sprint(file.ID))
+		h.ExtractBlock(c)
+		var block models.ExtractedBlock
+		decodeJSON(t, rec, http.StatusCreated, &block)
+		return block
+	}
+	leadII := extract(ExtractBlockRequest{Name: "lead_ii", Offset: 0x80, Size: 64})
+	extract(ExtractBlockRequest{Name: "lead_i", Offset: 0x10, Size: 16})
+
+	c, rec := newJSONContext(http.MethodGet, "/files/1/blocks", nil)
+	c.SetParamNames("id")
+	c.SetParamValues(fmt.Sprint(file.ID))
+	h.ListBlocks(c)
+	var blocks []models.ExtractedBlock
+	decodeJSON(t, rec, http.StatusOK, &blocks)
+	if len(blocks) != 2 || blocks[0].BlockName != "lead_i" || blocks[1].BlockName != "lead_ii" {
+		t.Fatalf("blocks = %+v, want lead_i then lead_ii", blocks)
+	}
+
+	c, rec = newJSONContext(http.MethodGet, "/blocks/1/download", nil)
+	c.SetParamNames("id")
+	c.SetParamValues(fmt.Sprint(leadII.ID))
+	if err := h.DownloadBlock(c); err != nil {
+		t.Fatalf("DownloadBlock() error = %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if want := data[0x80 : 0x80+64]; !bytes.Equal(rec.Body.Bytes(), want) {
+		t.Errorf("downloaded % X, want % X", rec.Body.Bytes(), want)
+	}
+}
+
+// TestSliceFile copies a region into a new file with the same bytes
+func TestSliceFile(t *testing.T) {
+	h := newTestHandler(t)
+	data := make([]byte, 256)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	file := createTestFile(t, h, "ecg.bin", data)
+
+	slice := func(req SliceFileRequest) *httptest.ResponseRecorder {
+		c, rec := newJSONContext(http.MethodPost, "/files/1/slice", req)
+		c.SetParamNames("id")
+		c.SetParamValues(fmt.Sprint(file.ID))
+		h.SliceFile(c)
+		return rec
+	}
+
+	var resp struct {
+		ID   uint   `json:"id"`
+		Name string `json:"name"`
+		Size int64  `json:"size"`
+	}
+	decodeJSON(t, slice(SliceFileRequest{Offset: 0x40, Length: 32}), http.StatusCreated, &resp)
+	if resp.Name != "ecg.bin.0x40-0x60" || resp.Size != 32 {
+		t.Errorf("slice = %+v, want ecg.bin.0x40-0x60 of 32 bytes", resp)
+	}
+
+	var got models.File
+	if err := h.db.GormDB.First(&got, resp.ID).Error; err != nil {
+		t.Fatalf("load slice: %v", err)
+	}
+	if !bytes.Equal(got.Data, data[0x40:0x60]) || got.Size != 32 || got.Hash != contentHash(data[0x40:0x60]) {
+		t.Errorf("slice data = % x (size %d), want % x", got.Data, got.Size, data[0x40:0x60])
+	}
+
+	decodeJSON(t, slice(SliceFileRequest{Offset: 0x40, Length: 32}), http.StatusConflict, nil)
+	decodeJSON(t, slice(SliceFileRequest{Name: "tail", Offset: 250, Length: 8}), http.StatusBadRequest, nil)
+	decodeJSON(t, slice(SliceFileRequest{Name: "overflow", Offset: 2, Length: math.MaxInt64}), http.StatusBadRequest, nil)
+}
@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"binary-annotator-pro/models"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxCarveResults caps the embedded files reported by one carve
+const maxCarveResults = 1000
+
+// CarveRequest selects the signatures to look for, all by default, and
+// whether to copy what is found into new files
+type CarveRequest struct {
+	Types   []string `json:"types,omitempty"` // png, jpeg, zip, pdf, gzip
+	Extract bool     `json:"extract,omitempty"`
+}
+
+// CarvedFile is an embedded file found by its signature. End is exclusive.
+type CarvedFile struct {
+	Type  string `json:"type"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Size  int    `json:"size"`
+	// With extract: the new File, or why it couldn't be created
+	FileID *uint  `json:"file_id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// CarveResponse lists the embedded files of a file, by start offset
+type CarveResponse struct {
+	FileID    uint         `json:"file_id"`
+	Files     []CarvedFile `json:"files"`
+	Truncated bool         `json:"truncated,omitempty"`
+}
+
+// carveSignature recognises a file format by its header and finds where the
+// file ends. end returns the exclusive end offset of a file starting at
+// data[0], or -1 when it doesn't end within data.
+// nests is set for formats that may hold a file of their own kind (a JPEG
+// thumbnail in a JPEG); for the others a header inside a file already found,
+// like the local file headers of a ZIP, is part of it.
+type carveSignature struct {
+	name   string
+	ext    string
+	header []byte
+	end    func(data []byte) int
+	nests  bool
+}
+
+var carveSignatures = []carveSignature{
+	{name: "png", ext: "png", header: []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1A, '\n'}, end: pngEnd},
+	{name: "jpeg", ext: "jpg", header: []byte{0xFF, 0xD8, 0xFF}, end: jpegEnd, nests: true},
+	{name: "zip", ext: "zip", header: []byte("PK\x03\x04"), end: zipEnd},
+	{name: "pdf", ext: "pdf", header: []byte("%PDF-"), end: pdfEnd},
+	{name: "gzip", ext: "gz", header: []byte{0x1F, 0x8B, 0x08}, end: gzipEnd},
+}
+
+// CarveFile looks for files embedded in a file, such as report images or
+// archives inside a device container, by their header signature, and checks
+// each candidate by finding its end from the format's structure (PNG chunks
+// up to IEND, JPEG segments up to EOI, the ZIP end of central directory, the
+// PDF %%EOF, the end of the gzip stream). Candidates without a valid end are
+// left out. With extract, each one is copied into a new File.
+func (h *Handler) CarveFile(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid file id")
+	}
+	var req CarveRequest
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid request")
+	}
+	signatures, err := selectCarveSignatures(req.Types)
+	if err != nil {
+		return apiError(c, http.StatusBadRequest, ErrCodeUnsupported, err.Error())
+	}
+
+	var file models.File
+	if err := h.db.GormDB.First(&file, id).Error; err != nil {
+		return apiError(c, http.StatusNotFound, ErrCodeFileNotFound, "file not found")
+	}
+
+	found, truncated := carve(file.Data, signatures)
+	if req.Extract {
+		for i := range found {
+			h.extractCarved(file, &found[i])
+		}
+	}
+	return c.JSON(http.StatusOK, CarveResponse{FileID: file.ID, Files: found, Truncated: truncated})
+}
+
+// selectCarveSignatures returns the signatures named by types, all of them
+// when types is empty
+func selectCarveSignatures(types []string) ([]carveSignature, error) {
+	if len(types) == 0 {
+		return carveSignatures, nil
+	}
+	var selected []carveSignature
+	for _, t := range types {
+		i := -1
+		for j, sig := range carveSignatures {
+			if sig.name == t {
+				i = j
+			}
+		}
+		if i < 0 {
+			return nil, fmt.Errorf("unsupported type %q (png, jpeg, zip, pdf or gzip)", t)
+		}
+		selected = append(selected, carveSignatures[i])
+	}
+	return selected, nil
+}
+
+// carve finds the embedded files of data. Files nested in others (a JPEG in
+// a ZIP, a thumbnail in a JPEG) are reported too.
+func carve(data []byte, signatures []carveSignature) ([]CarvedFile, bool) {
+	found := []CarvedFile{}
+	lastEnd := map[string]int{} // end of the last file found of each type
+	for start := 0; start < len(data); start++ {
+		for _, sig := range signatures {
+			if !bytes.HasPrefix(data[start:], sig.header) {
+				continue
+			}
+			if !sig.nests && start < lastEnd[sig.name] {
+				continue
+			}
+			n := sig.end(data[start:])
+			if n <= 0 {
+				continue
+			}
+			if len(found) == maxCarveResults {
+				return found, true
+			}
+			found = append(found, CarvedFile{Type: sig.name, Start: start, End: start + n, Size: n})
+			lastEnd[sig.name] = start + n
+		}
+	}
+	return found, false
+}
+
+// extractCarved copies an embedded file into a new File named after its
+// source, offset and format
+func (h *Handler) extractCarved(file models.File, carved *CarvedFile) {
+	ext := carved.Type
+	for _, sig := range carveSignatures {
+		if sig.name == carved.Type {
+			ext = sig.ext
+		}
+	}
+	data := append([]byte(nil), file.Data[carved.Start:carved.End]...)
+	extracted := models.File{
+		Name:    fmt.Sprintf("%s.0x%X.%s", file.Name, carved.Start, ext),
+		Vendor:  file.Vendor,
+		Size:    int64(len(data)),
+		Hash:    contentHash(data),
+		Entropy: fileEntropy(data),
+		Data:    data,
+	}
+	if err := h.db.GormDB.Create(&extracted).Error; err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			carved.Error = "a file named " + extracted.Name + " already exists"
+		} else {
+			carved.Error = "failed to save file"
+		}
+		return
+	}
+	carved.FileID = &extracted.ID
+}
+
+// pngEnd walks the chunks (length, type, data, CRC) up to IEND
+func pngEnd(data []byte) int {
+	pos := 8
+	for pos+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		if length > len(data) {
+			return -1
+		}
+		next := pos + 12 + length
+		if next > len(data) {
+			return -1
+		}
+		if string(data[pos+4:pos+8]) == "IEND" {
+			return next
+		}
+		pos = next
+	}
+	return -1
+}
+
+// jpegEnd walks the marker segments to the start of scan, then the entropy
+// coded data, where a 0xFF byte is only a marker when not followed by 0x00 or
+// a restart marker, up to EOI
+func jpegEnd(data []byte) int {
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return -1
+		}
+		marker := data[pos+1]
+		switch {
+		case marker == 0xFF: // fill byte
+			pos++
+			continue
+		case marker == 0xD9:
+			return pos + 2
+		case marker >= 0xD0 && marker <= 0xD7, marker == 0x01:
+			pos += 2
+			continue
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 {
+			return -1
+		}
+		pos += 2 + length
+		if marker != 0xDA {
+			continue
+		}
+		// Entropy coded data up to the next marker
+		for pos+1 < len(data) {
+			if data[pos] == 0xFF && data[pos+1] != 0x00 && (data[pos+1] < 0xD0 || data[pos+1] > 0xD7) {
+				break
+			}
+			pos++
+		}
+	}
+	if pos+2 <= len(data) && data[pos] == 0xFF && data[pos+1] == 0xD9 {
+		return pos + 2
+	}
+	return -1
+}
+
+// zipEnd finds the end of central directory record and its comment
+func zipEnd(data []byte) int {
+	i := bytes.Index(data, []byte("PK\x05\x06"))
+	if i < 0 || i+22 > len(data) {
+		return -1
+	}
+	end := i + 22 + int(binary.LittleEndian.Uint16(data[i+20:]))
+	if end > len(data) {
+		return -1
+	}
+	return end
+}
+
+// pdfEnd finds the last %%EOF before the next PDF header, so incremental
+// updates (each ending with %%EOF) stay part of the document, plus the end
+// of line after it
+func pdfEnd(data []byte) int {
+	limit := len(data)
+	if next := bytes.Index(data[1:], []byte("%PDF-")); next >= 0 {
+		limit = next + 1
+	}
+	i := bytes.LastIndex(data[:limit], []byte("%%EOF"))
+	if i < 0 {
+		return -1
+	}
+	end := i + 5
+	if end < len(data) && data[end] == '\r' {
+		end++
+	}
+	if end < len(data) && data[end] == '\n' {
+		end++
+	}
+	return end
+}
+
+// gzipEnd decompresses one gzip member to find where it ends; its CRC and
+// size are checked on the way
+func gzipEnd(data []byte) int {
+	r := bytes.NewReader(data)
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return -1
+	}
+	zr.Multistream(false)
+	n, err := io.Copy(io.Discard, io.LimitReader(zr, nativeMaxDecompressed+1))
+	if err != nil || n > nativeMaxDecompressed {
+		return -1
+	}
+	// bytes.Reader is an io.ByteReader, so the decompressor reads no further
+	// than the end of the member
+	return len(data) - r.Len()
+}
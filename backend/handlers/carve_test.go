@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"testing"
+
+	"binary-annotator-pro/models"
+)
+
+// TestCarveEmbeddedFiles hides a PNG, a JPEG, a gzip stream and a ZIP between
+// record bytes and checks each is found with its exact bounds and extracted
+func TestCarveEmbeddedFiles(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i * 13)
+	}
+	img.Set(3, 3, color.RGBA{255, 0, 0, 255})
+	var pngData, jpegData, gzData bytes.Buffer
+	if err := png.Encode(&pngData, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := jpeg.Encode(&jpegData, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	zw := gzip.NewWriter(&gzData)
+	zw.Write(bytes.Repeat([]byte("ECG report "), 50))
+	zw.Close()
+	var zipData bytes.Buffer
+	archive := zip.NewWriter(&zipData)
+	for _, name := range []string{"report.txt", "leads.csv"} {
+		w, _ := archive.Create(name)
+		w.Write([]byte("lead,value\nI,1\n"))
+	}
+	archive.SetComment("exported")
+	archive.Close()
+
+	filler := func(n int) []byte {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = byte(i*7 + 1)
+		}
+		return b
+	}
+	var data []byte
+	data = append(data, "ECGCONTAINER"...)
+	pngStart := len(data)
+	data = append(data, pngData.Bytes()...)
+	data = append(data, filler(100)...)
+	jpegStart := len(data)
+	data = append(data, jpegData.Bytes()...)
+	data = append(data, filler(33)...)
+	gzStart := len(data)
+	data = append(data, gzData.Bytes()...)
+	zipStart := len(data)
+	data = append(data, zipData.Bytes()...)
+	data = append(data, "TRAILER"...)
+	// A lone PNG header with no chunks after it isn't a file
+	data = append(data, 0x89, 'P', 'N', 'G', '\r', '\n', 0x1A, '\n', 0, 0)
+
+	h := newTestHandler(t)
+	file := createTestFile(t, h, "container.bin", data)
+
+	c, rec := newJSONContext(http.MethodPost, "/files/1/carve", CarveRequest{Extract: true})
+	c.SetParamNames("id")
+	c.SetParamValues(fmt.Sprint(file.ID))
+	if err := h.CarveFile(c); err != nil {
+		t.Fatal(err)
+	}
+	var resp CarveResponse
+	decodeJSON(t, rec, http.StatusOK, &resp)
+
+	want := []struct {
+		typ        string
+		start, end int
+		content    []byte
+	}{
+		{"png", pngStart, pngStart + pngData.Len(), pngData.Bytes()},
+		{"jpeg", jpegStart, jpegStart + jpegData.Len(), jpegData.Bytes()},
+		{"gzip", gzStart, gzStart + gzData.Len(), gzData.Bytes()},
+		// Its second local file header is part of it, not another archive
+		{"zip", zipStart, zipStart + zipData.Len(), zipData.Bytes()},
+	}
+	if len(resp.Files) != len(want) {
+		t.Fatalf("found %+v, want %d files", resp.Files, len(want))
+	}
+	for i, w := range want {
+		got := resp.Files[i]
+		if got.Type != w.typ || got.Start != w.start || got.End != w.end || got.Size != w.end-w.start {
+			t.Errorf("file %d = %+v, want %s at %d-%d", i, got, w.typ, w.start, w.end)
+			continue
+		}
+		if got.FileID == nil {
+			t.Errorf("%s was not extracted: %s", w.typ, got.Error)
+			continue
+		}
+		var extracted models.File
+		h.db.GormDB.First(&extracted, *got.FileID)
+		if !bytes.Equal(extracted.Data, w.content) || extracted.Name != fmt.Sprintf("container.bin.0x%X.%s", w.start, map[string]string{"png": "png", "jpeg": "jpg", "gzip": "gz", "zip": "zip"}[w.typ]) {
+			t.Errorf("%s extracted as %q with %d bytes", w.typ, extracted.Name, len(extracted.Data))
+		}
+	}
+
+	// Restricted to one type
+	c, rec = newJSONContext(http.MethodPost, "/files/1/carve", CarveRequest{Types: []string{"png"}})
+	c.SetParamNames("id")
+	c.SetParamValues(fmt.Sprint(file.ID))
+	if err := h.CarveFile(c); err != nil {
+		t.Fatal(err)
+	}
+	resp = CarveResponse{}
+	decodeJSON(t, rec, http.StatusOK, &resp)
+	if len(resp.Files) != 1 || resp.Files[0].Type != "png" || resp.Files[0].FileID != nil {
+		t.Errorf("png only: got %+v", resp.Files)
+	}
+}
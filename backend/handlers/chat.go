@@ -2,12 +2,17 @@ package handlers
 
 import (
 	"binary-annotator-pro/config"
+	"binary-annotator-pro/logging"
 	"binary-annotator-pro/models"
 	"binary-annotator-pro/services"
-	"encoding/json"
+	"context"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -20,8 +25,23 @@ type ChatHandler struct {
 	mcpDockerHandler *MCPDockerHandler
 	ragService       *services.RAGService
 	approvalChannels map[uint]chan bool // Map session ID to approval channel
+
+	// Open connections and in-flight replies, so Shutdown can let replies
+	// finish before closing the connections
+	mu      sync.Mutex
+	conns   map[*websocket.Conn]struct{}
+	streams sync.WaitGroup
+	closing bool
 }
 
+// Chat connection heartbeat. A client that misses a pong for chatPongWait is
+// treated as gone. Variables so tests can shorten them.
+var (
+	chatPongWait   = 60 * time.Second
+	chatPingPeriod = chatPongWait * 9 / 10
+	chatWriteWait  = 10 * time.Second
+)
+
 // NewChatHandler creates a new chat handler
 func NewChatHandler(db *config.DB) *ChatHandler {
 	return &ChatHandler{
@@ -29,9 +49,66 @@ func NewChatHandler(db *config.DB) *ChatHandler {
 		mcpDockerHandler: NewMCPDockerHandler(),
 		ragService:       services.NewRAGService(""),
 		approvalChannels: make(map[uint]chan bool),
+		conns:            make(map[*websocket.Conn]struct{}),
 	}
 }
 
+// Shutdown stops accepting chat messages, waits for in-flight replies to
+// finish (or ctx to expire), then closes every chat connection
+func (ch *ChatHandler) Shutdown(ctx context.Context) error {
+	ch.mu.Lock()
+	ch.closing = true
+	ch.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		ch.streams.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("chat replies still running: %w", ctx.Err())
+	}
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	closeMsg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	for ws := range ch.conns {
+		ws.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(chatWriteWait))
+		ws.Close()
+	}
+	return err
+}
+
+// beginStream registers an in-flight reply, unless the handler is shutting down
+func (ch *ChatHandler) beginStream() bool {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if ch.closing {
+		return false
+	}
+	ch.streams.Add(1)
+	return true
+}
+
+// chatRAGMinScore is the similarity threshold for RAG context in chat, from
+// RAG_CHAT_MIN_SCORE. It returns 0 (the RAG service default) when unset or invalid.
+func chatRAGMinScore() float64 {
+	v := os.Getenv("RAG_CHAT_MIN_SCORE")
+	if v == "" {
+		return 0
+	}
+	score, err := strconv.ParseFloat(v, 64)
+	if err != nil || score < 0 || score > 1 {
+		log.Printf("Ignoring invalid RAG_CHAT_MIN_SCORE %q", v)
+		return 0
+	}
+	return score
+}
+
 // ToolApprovalRequest represents a tool call awaiting approval
 type ToolApprovalRequest struct {
 	ToolName  string                 `json:"tool_name"`
@@ -75,21 +152,43 @@ type ChatWSResponse struct {
 
 // HandleChat handles WebSocket connections for chat
 func (ch *ChatHandler) HandleChat(c echo.Context) error {
+	logger := logging.FromContext(c.Request().Context())
 	ws, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
 	if err != nil {
-		log.Printf("chat websocket upgrade error: %v", err)
+		logger.Warn("chat websocket upgrade failed", "error", err)
 		return err
 	}
 	defer ws.Close()
 
-	log.Println("Chat WebSocket client connected")
+	ch.mu.Lock()
+	ch.conns[ws] = struct{}{}
+	ch.mu.Unlock()
+	defer func() {
+		ch.mu.Lock()
+		delete(ch.conns, ws)
+		ch.mu.Unlock()
+	}()
+
+	logger.Info("chat websocket connected")
+
+	// Cancelled when the connection ends, releasing pending tool approvals.
+	// It keeps the upgrade request's logger, so the whole session is logged
+	// under its request ID.
+	ctx, cancel := context.WithCancel(context.WithoutCancel(c.Request().Context()))
+	defer cancel()
+
+	ws.SetReadDeadline(time.Now().Add(chatPongWait))
+	ws.SetPongHandler(func(string) error {
+		return ws.SetReadDeadline(time.Now().Add(chatPongWait))
+	})
+	go ch.pingChat(ctx, ws)
 
 	for {
 		var msg ChatWSMessage
 		err := ws.ReadJSON(&msg)
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("chat websocket read error: %v", err)
+				logger.Warn("chat websocket read failed", "error", err)
 			}
 			break
 		}
@@ -102,20 +201,30 @@ func (ch *ChatHandler) HandleChat(c echo.Context) error {
 			continue
 		}
 
-		log.Printf("Chat message received: type=%s, user=%s", msg.Type, msg.UserID)
+		logger.Info("chat message received", "type", msg.Type, "user_id", msg.UserID)
 
 		switch msg.Type {
 		case "new_session":
-			ch.handleNewSession(ws, msg)
+			ch.handleNewSession(ctx, ws, msg)
 		case "load_session":
-			ch.handleLoadSession(ws, msg)
+			ch.handleLoadSession(ctx, ws, msg)
 		case "list_sessions":
-			ch.handleListSessions(ws, msg)
+			ch.handleListSessions(ctx, ws, msg)
 		case "message":
+			if !ch.beginStream() {
+				ws.WriteJSON(&ChatWSResponse{
+					Type:  "error",
+					Error: "server is shutting down",
+				})
+				continue
+			}
 			// Run in goroutine to not block WebSocket read loop (needed for tool approval)
-			go ch.handleChatMessage(ws, msg)
+			go func() {
+				defer ch.streams.Done()
+				ch.handleChatMessage(ctx, ws, msg)
+			}()
 		case "tool_approval":
-			ch.handleToolApproval(ws, msg)
+			ch.handleToolApproval(ctx, ws, msg)
 		default:
 			ws.WriteJSON(&ChatWSResponse{
 				Type:  "error",
@@ -124,12 +233,32 @@ func (ch *ChatHandler) HandleChat(c echo.Context) error {
 		}
 	}
 
-	log.Println("Chat WebSocket client disconnected")
+	logger.Info("chat websocket disconnected")
 	return nil
 }
 
+// pingChat pings the client every chatPingPeriod until ctx is done. A failed
+// ping closes the connection, which ends the read loop in HandleChat.
+func (ch *ChatHandler) pingChat(ctx context.Context, ws *websocket.Conn) {
+	ticker := time.NewTicker(chatPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(chatWriteWait)); err != nil {
+				logging.FromContext(ctx).Warn("chat websocket ping failed", "error", err)
+				ws.Close()
+				return
+			}
+		}
+	}
+}
+
 // handleNewSession creates a new chat session
-func (ch *ChatHandler) handleNewSession(ws *websocket.Conn, msg ChatWSMessage) {
+func (ch *ChatHandler) handleNewSession(ctx context.Context, ws *websocket.Conn, msg ChatWSMessage) {
 	session := models.ChatSession{
 		UserID: msg.UserID,
 		Title:  "New Chat",
@@ -137,7 +266,7 @@ func (ch *ChatHandler) handleNewSession(ws *websocket.Conn, msg ChatWSMessage) {
 	}
 
 	if err := ch.db.GormDB.Create(&session).Error; err != nil {
-		log.Printf("Failed to create session: %v", err)
+		logging.FromContext(ctx).Error("failed to create chat session", "user_id", msg.UserID, "error", err)
 		ws.WriteJSON(&ChatWSResponse{
 			Type:  "error",
 			Error: "failed to create session",
@@ -152,7 +281,7 @@ func (ch *ChatHandler) handleNewSession(ws *websocket.Conn, msg ChatWSMessage) {
 }
 
 // handleLoadSession loads chat history for a session
-func (ch *ChatHandler) handleLoadSession(ws *websocket.Conn, msg ChatWSMessage) {
+func (ch *ChatHandler) handleLoadSession(ctx context.Context, ws *websocket.Conn, msg ChatWSMessage) {
 	if msg.SessionID == nil {
 		ws.WriteJSON(&ChatWSResponse{
 			Type:  "error",
@@ -165,7 +294,7 @@ func (ch *ChatHandler) handleLoadSession(ws *websocket.Conn, msg ChatWSMessage)
 	if err := ch.db.GormDB.Where("session_id = ?", *msg.SessionID).
 		Order("created_at asc").
 		Find(&messages).Error; err != nil {
-		log.Printf("Failed to load messages: %v", err)
+		logging.FromContext(ctx).Error("failed to load chat messages", "session_id", *msg.SessionID, "error", err)
 		ws.WriteJSON(&ChatWSResponse{
 			Type:  "error",
 			Error: "failed to load messages",
@@ -180,12 +309,12 @@ func (ch *ChatHandler) handleLoadSession(ws *websocket.Conn, msg ChatWSMessage)
 }
 
 // handleListSessions lists all sessions for a user
-func (ch *ChatHandler) handleListSessions(ws *websocket.Conn, msg ChatWSMessage) {
+func (ch *ChatHandler) handleListSessions(ctx context.Context, ws *websocket.Conn, msg ChatWSMessage) {
 	var sessions []models.ChatSession
 	if err := ch.db.GormDB.Where("user_id = ?", msg.UserID).
 		Order("updated_at desc").
 		Find(&sessions).Error; err != nil {
-		log.Printf("Failed to load sessions: %v", err)
+		logging.FromContext(ctx).Error("failed to load chat sessions", "user_id", msg.UserID, "error", err)
 		ws.WriteJSON(&ChatWSResponse{
 			Type:  "error",
 			Error: "failed to load sessions",
@@ -200,7 +329,7 @@ func (ch *ChatHandler) handleListSessions(ws *websocket.Conn, msg ChatWSMessage)
 }
 
 // handleToolApproval handles tool approval responses from the user
-func (ch *ChatHandler) handleToolApproval(ws *websocket.Conn, msg ChatWSMessage) {
+func (ch *ChatHandler) handleToolApproval(ctx context.Context, ws *websocket.Conn, msg ChatWSMessage) {
 	if msg.SessionID == nil {
 		ws.WriteJSON(&ChatWSResponse{
 			Type:  "error",
@@ -220,7 +349,7 @@ func (ch *ChatHandler) handleToolApproval(ws *websocket.Conn, msg ChatWSMessage)
 	// Find the approval channel for this session
 	approvalChan, exists := ch.approvalChannels[*msg.SessionID]
 	if !exists {
-		log.Printf("No pending tool approval for session %d", *msg.SessionID)
+		logging.FromContext(ctx).Warn("no pending tool approval", "session_id", *msg.SessionID)
 		return
 	}
 
@@ -229,7 +358,7 @@ func (ch *ChatHandler) handleToolApproval(ws *websocket.Conn, msg ChatWSMessage)
 }
 
 // handleChatMessage processes a chat message and streams response
-func (ch *ChatHandler) handleChatMessage(ws *websocket.Conn, msg ChatWSMessage) {
+func (ch *ChatHandler) handleChatMessage(ctx context.Context, ws *websocket.Conn, msg ChatWSMessage) {
 	if msg.SessionID == nil {
 		ws.WriteJSON(&ChatWSResponse{
 			Type:  "error",
@@ -238,6 +367,9 @@ func (ch *ChatHandler) handleChatMessage(ws *websocket.Conn, msg ChatWSMessage)
 		return
 	}
 
+	ctx = logging.With(ctx, "session_id", *msg.SessionID, "user_id", msg.UserID)
+	logger := logging.FromContext(ctx)
+
 	// Check for MCP commands
 	if len(msg.Message) > 0 && msg.Message[0] == '/' {
 		ch.handleMCPCommand(ws, msg)
@@ -253,6 +385,13 @@ func (ch *ChatHandler) handleChatMessage(ws *websocket.Conn, msg ChatWSMessage)
 		})
 		return
 	}
+	if err := decryptAIKeys(&settings); err != nil {
+		ws.WriteJSON(&ChatWSResponse{
+			Type:  "error",
+			Error: err.Error(),
+		})
+		return
+	}
 
 	// Validate provider is configured
 	switch settings.Provider {
@@ -293,7 +432,7 @@ func (ch *ChatHandler) handleChatMessage(ws *websocket.Conn, msg ChatWSMessage)
 		Content:   msg.Message,
 	}
 	if err := ch.db.GormDB.Create(&userMsg).Error; err != nil {
-		log.Printf("Failed to save user message: %v", err)
+		logger.Error("failed to save user message", "error", err)
 	}
 
 	// Update session title if this is the first message
@@ -309,10 +448,11 @@ func (ch *ChatHandler) handleChatMessage(ws *websocket.Conn, msg ChatWSMessage)
 	// Get MCP tools from Docker Manager
 	ollamaTools, toolToServer, err := ch.getMCPToolsFromDocker()
 	if err != nil {
-		log.Printf("Warning: failed to get MCP tools: %v", err)
+		logger.Warn("failed to get MCP tools", "error", err)
 		ollamaTools = []services.Tool{} // Continue without tools
 	}
-	log.Printf("Loaded %d MCP tools from Docker Manager", len(ollamaTools))
+	logger.Info("loaded MCP tools", "count", len(ollamaTools))
+	toolSchemas := mcpToolSchemas(ollamaTools)
 
 	// Get conversation history
 	var messages []models.ChatMessage
@@ -568,7 +708,7 @@ Next steps : lire les 128 premiers octets du fichier pour confirmer la structure
 
 	// Add hex selection context if available
 	if msg.HexSelection != nil {
-		log.Printf("Hex selection provided: offset=0x%X, size=%d bytes", msg.HexSelection.Offset, msg.HexSelection.Size)
+		logger.Info("hex selection provided", "offset", msg.HexSelection.Offset, "size", msg.HexSelection.Size)
 
 		// Format hex selection context for the AI
 		hexContext := fmt.Sprintf(`HEX SELECTION CONTEXT:
@@ -585,25 +725,23 @@ Please analyze this hex selection in the context of the user's question.`,
 			msg.HexSelection.RawBytes)
 
 		userMessage = fmt.Sprintf("%s\n\n%s", hexContext, msg.Message)
-		log.Printf("Enhanced user message with hex selection context (total length: %d bytes)", len(userMessage))
+		logger.Debug("added hex selection context", "message_bytes", len(userMessage))
 	}
 
 	if msg.RAGEnabled {
-		log.Printf("RAG is enabled, searching for relevant context...")
-		ragResp, err := ch.ragService.Search(msg.Message, nil, 5, 0.18)
+		ragResp, err := ch.ragService.Search(msg.Message, nil, 0, chatRAGMinScore())
 		if err != nil {
-			log.Printf("Warning: RAG search failed: %v", err)
+			logger.Warn("RAG search failed", "error", err)
 		} else if ragResp != nil && len(ragResp.Results) > 0 {
-			log.Printf("Found %d relevant RAG results", len(ragResp.Results))
 			ragContext := services.FormatRAGContext(ragResp.Results)
-			log.Printf("RAG Context generated (length: %d bytes)", len(ragContext))
+			logger.Info("found RAG context", "results", len(ragResp.Results), "context_bytes", len(ragContext))
 
 			// Combine hex selection + RAG data with user prompt:
 			// "Using this data: {data}. {hex_context}. Respond to this prompt: {input}"
 			userMessage = fmt.Sprintf("Using this data:\n\n%s\n\nRespond to this prompt: %s", ragContext, userMessage)
-			log.Printf("Enhanced user message with RAG context (total length: %d bytes)", len(userMessage))
+			logger.Debug("added RAG context", "message_bytes", len(userMessage))
 		} else {
-			log.Printf("No relevant RAG results found (query: %s)", msg.Message)
+			logger.Info("no relevant RAG results")
 		}
 	}
 
@@ -632,7 +770,7 @@ Please analyze this hex selection in the context of the user's question.`,
 				thinkParam = true // Default to boolean true for most models
 			}
 
-			log.Printf("Starting Ollama streaming with %d messages (thinking: %v)...", len(chatMessages), thinkParam)
+			logger.Info("starting chat stream", "provider", "ollama", "messages", len(chatMessages), "thinking", settings.Thinking)
 			err = chatService.StreamChatWithTools(services.ChatRequest{
 				Model:    settings.OllamaModel,
 				Messages: chatMessages,
@@ -670,8 +808,8 @@ Please analyze this hex selection in the context of the user's question.`,
 			// Gemini streaming
 			geminiService := services.NewGeminiService(settings.GeminiKey)
 
-			log.Printf("Starting Gemini streaming with %d messages...", len(chatMessages))
-			err = geminiService.StreamChatWithTools(settings.GeminiModel, chatMessages, func(resp services.StreamResponse) error {
+			logger.Info("starting chat stream", "provider", "gemini", "messages", len(chatMessages))
+			err = geminiService.StreamChatWithTools(settings.GeminiModel, chatMessages, ollamaTools, func(resp services.StreamResponse) error {
 				// Handle content chunks
 				if resp.Content != "" {
 					fullResponse += resp.Content
@@ -682,7 +820,7 @@ Please analyze this hex selection in the context of the user's question.`,
 					})
 				}
 
-				// Collect tool calls (Gemini doesn't support tool calls in basic mode)
+				// Collect tool calls (from Gemini functionCall parts)
 				if len(resp.ToolCalls) > 0 {
 					toolCalls = append(toolCalls, resp.ToolCalls...)
 				}
@@ -691,16 +829,15 @@ Please analyze this hex selection in the context of the user's question.`,
 			})
 		}
 
-		log.Printf("Streaming completed. fullResponse length: %d, toolCalls: %d", len(fullResponse), len(toolCalls))
-
 		if err != nil {
-			log.Printf("Chat stream error: %v", err)
+			logger.Error("chat stream failed", "error", err)
 			ws.WriteJSON(&ChatWSResponse{
 				Type:  "error",
 				Error: err.Error(),
 			})
 			return
 		}
+		logger.Info("chat stream completed", "response_bytes", len(fullResponse), "tool_calls", len(toolCalls))
 
 		// If no tool calls, we're done
 		if len(toolCalls) == 0 {
@@ -711,24 +848,25 @@ Please analyze this hex selection in the context of the user's question.`,
 				Content:   fullResponse,
 			}
 			if err := ch.db.GormDB.Create(&assistantMsg).Error; err != nil {
-				log.Printf("Failed to save assistant message: %v", err)
+				logger.Error("failed to save assistant message", "error", err)
 			}
 
 			// Index conversation in RAG (asynchronously to not block response)
 			if msg.RAGEnabled {
 				go func() {
-					// Create a conversation exchange document for RAG
-					conversationText := fmt.Sprintf("User: %s\n\nAssistant: %s", msg.Message, fullResponse)
+					// One document per session, replaced with the whole
+					// conversation so far after each exchange
 					title := fmt.Sprintf("Chat - Session %d", *msg.SessionID)
 					metadata := map[string]string{
 						"user_id":    msg.UserID,
 						"session_id": fmt.Sprintf("%d", *msg.SessionID),
 					}
+					source := fmt.Sprintf("session_%d", *msg.SessionID)
 
-					if resp, err := ch.ragService.IndexDocument("chat", title, conversationText, fmt.Sprintf("session_%d", *msg.SessionID), metadata, 256, 50); err != nil {
-						log.Printf("Warning: Failed to index conversation in RAG: %v", err)
+					if resp, err := ch.ragService.UpsertDocument(source, "chat", title, ch.sessionTranscript(*msg.SessionID), source, metadata); err != nil {
+						logger.Warn("failed to index conversation in RAG", "error", err)
 					} else {
-						log.Printf("Successfully indexed conversation in RAG (ID: %d, Chunks: %d)", resp.DocumentID, resp.ChunkCount)
+						logger.Info("indexed conversation in RAG", "document_id", resp.DocumentID, "chunks", resp.ChunkCount)
 					}
 				}()
 			}
@@ -741,126 +879,27 @@ Please analyze this hex selection in the context of the user's question.`,
 		}
 
 		// Execute tool calls
-		log.Printf("Executing %d tool call(s)", len(toolCalls))
+		logger.Info("executing tool calls", "count", len(toolCalls))
 
 		// Add assistant message with tool calls to history
 		chatMessages = append(chatMessages, services.ChatMessageReq{
-			Role:    "assistant",
-			Content: fullResponse,
+			Role:      "assistant",
+			Content:   fullResponse,
+			ToolCalls: toolCalls,
 		})
 
 		// Execute each tool call and add results to messages
-		for _, toolCall := range toolCalls {
-			toolName := toolCall.Function.Name
-			arguments := toolCall.Function.Arguments
-
-			log.Printf("Calling tool: %s with args: %v", toolName, arguments)
-
-			// Send status to client
-			ws.WriteJSON(&ChatWSResponse{
-				Type:  "chunk",
-				Chunk: fmt.Sprintf("\n\n🔧 Calling tool: %s...\n", toolName),
-			})
-
-			// Find which server hosts this tool
-			serverName, found := toolToServer[toolName]
-			if !found {
-				log.Printf("Tool %s not found in any server", toolName)
-				ws.WriteJSON(&ChatWSResponse{
-					Type:  "chunk",
-					Chunk: fmt.Sprintf("❌ Tool %s not found\n", toolName),
-				})
-				chatMessages = append(chatMessages, services.ChatMessageReq{
-					Role:    "tool",
-					Content: fmt.Sprintf("Error: tool %s not found", toolName),
-				})
-				continue
-			}
-
-			// Request user approval for tool execution
-			approvalChan := make(chan bool, 1)
-			ch.approvalChannels[*msg.SessionID] = approvalChan
-
-			// Send approval request to frontend
-			ws.WriteJSON(&ChatWSResponse{
-				Type: "tool_approval_request",
-				ToolApproval: &ToolApprovalRequest{
-					ToolName:  toolName,
-					Arguments: arguments,
-					Server:    serverName,
-				},
-			})
-
-			log.Printf("Waiting for user approval for tool: %s", toolName)
-
-			// Wait for approval with 60 second timeout
-			var approved bool
-			select {
-			case approved = <-approvalChan:
-				log.Printf("Tool %s %s by user", toolName, map[bool]string{true: "approved", false: "denied"}[approved])
-			case <-time.After(60 * time.Second):
-				log.Printf("Tool approval timeout for %s", toolName)
-				approved = false
-			}
-
-			// Clean up approval channel
-			delete(ch.approvalChannels, *msg.SessionID)
-
-			// If not approved, skip execution
-			if !approved {
-				ws.WriteJSON(&ChatWSResponse{
-					Type:  "chunk",
-					Chunk: fmt.Sprintf("⚠️ Tool %s execution was denied\n", toolName),
-				})
-				chatMessages = append(chatMessages, services.ChatMessageReq{
-					Role:    "tool",
-					Content: fmt.Sprintf("User denied execution of %s", toolName),
-				})
-				continue
-			}
-
-			// Call the MCP tool via Docker Manager
-			result, err := ch.mcpDockerHandler.proxyRequest("POST", "/servers/"+serverName+"/call", map[string]interface{}{
-				"tool":      toolName,
-				"arguments": arguments,
-			})
-
-			if err != nil {
-				log.Printf("Tool call error: %v", err)
-				ws.WriteJSON(&ChatWSResponse{
-					Type:  "chunk",
-					Chunk: fmt.Sprintf("❌ Tool error: %v\n", err),
-				})
-
-				// Add error result to messages
-				chatMessages = append(chatMessages, services.ChatMessageReq{
-					Role:    "tool",
-					Content: fmt.Sprintf("Error calling %s: %v", toolName, err),
-				})
-				continue
-			}
-
-			// Format tool result
-			resultBytes, _ := json.Marshal(result)
-			resultText := string(resultBytes)
-
-			log.Printf("Tool result: %s", resultText)
-
-			// Don't send result preview to client - let AI interpret it
-			// The AI will receive the tool result and formulate a user-friendly response
-
-			// Add tool result to conversation
-			chatMessages = append(chatMessages, services.ChatMessageReq{
-				Role:    "tool",
-				Content: resultText,
-			})
+		chatMessages = append(chatMessages, ch.executeToolCalls(ctx, ws, *msg.SessionID, toolCalls, toolToServer, toolSchemas)...)
+		if ctx.Err() != nil {
+			logger.Info("chat client disconnected during tool calls, stopping")
+			return
 		}
 
 		// Continue loop to get AI's response to the tool results
 	}
 
 	// If we hit max iterations, send warning
-	log.Printf("Max tool calling iterations reached")
+	logger.Warn("max tool calling iterations reached", "iterations", maxIterations)
 	ws.WriteJSON(&ChatWSResponse{
 		Type:  "chunk",
 		Chunk: "\n\n⚠️ Maximum tool calling iterations reached.\n",
@@ -870,6 +909,28 @@ Please analyze this hex selection in the context of the user's question.`,
 	})
 }
 
+// sessionTranscript renders the user and assistant messages of a session, the
+// text indexed in RAG for the session
+func (ch *ChatHandler) sessionTranscript(sessionID uint) string {
+	var messages []models.ChatMessage
+	ch.db.GormDB.Where("session_id = ? AND role IN ?", sessionID, []string{"user", "assistant"}).
+		Order("created_at asc").
+		Find(&messages)
+
+	var b strings.Builder
+	for i, m := range messages {
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		role := "User"
+		if m.Role == "assistant" {
+			role = "Assistant"
+		}
+		fmt.Fprintf(&b, "%s: %s", role, m.Content)
+	}
+	return b.String()
+}
+
 // GetChatSessions returns all chat sessions for a user (REST endpoint)
 func (ch *ChatHandler) GetChatSessions(c echo.Context) error {
 	userID := c.Param("userId")
@@ -928,70 +989,11 @@ func (ch *ChatHandler) sendMCPToolsList(ws *websocket.Conn, msg ChatWSMessage, m
 // getMCPToolsFromDocker retrieves all MCP tools from Docker Manager and converts to Ollama format
 func (ch *ChatHandler) getMCPToolsFromDocker() ([]services.Tool, map[string]string, error) {
 	// Get list of running MCP servers from Docker Manager
-	// Note: /servers endpoint returns an array, not an object
-	req, err := http.NewRequest("GET", ch.mcpDockerHandler.managerURL+"/servers", nil)
+	servers, err := ch.mcpDockerHandler.listServers()
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to fetch servers: %w", err)
-	}
-	defer resp.Body.Close()
-
-	var servers []map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&servers); err != nil {
-		return nil, nil, fmt.Errorf("failed to decode servers: %w", err)
-	}
-
-	// Convert MCP tools to Ollama format
-	var ollamaTools []services.Tool
-	toolToServer := make(map[string]string) // Maps tool name to server name
-
-	for _, server := range servers {
-		serverName, _ := server["name"].(string)
-		tools, ok := server["tools"].([]interface{})
-		if !ok || len(tools) == 0 {
-			continue
-		}
-
-		for _, toolData := range tools {
-			toolMap, ok := toolData.(map[string]interface{})
-			if !ok {
-				continue
-			}
-
-			name, _ := toolMap["name"].(string)
-			description, _ := toolMap["description"].(string)
-			inputSchema, _ := toolMap["inputSchema"].(map[string]interface{})
-
-			// Convert MCP InputSchema to Ollama Parameters format
-			parameters := make(map[string]interface{})
-			if inputSchema != nil {
-				parameters["type"] = inputSchema["type"]
-				if props, ok := inputSchema["properties"].(map[string]interface{}); ok {
-					parameters["properties"] = props
-				}
-				if required, ok := inputSchema["required"].([]interface{}); ok {
-					parameters["required"] = required
-				}
-			}
-
-			ollamaTool := services.Tool{
-				Type: "function",
-				Function: services.FunctionDef{
-					Name:        name,
-					Description: description,
-					Parameters:  parameters,
-				},
-			}
-
-			ollamaTools = append(ollamaTools, ollamaTool)
-			toolToServer[name] = serverName
-		}
+		return nil, nil, err
 	}
 
+	ollamaTools, toolToServer := mcpToolsFromServers(servers)
 	return ollamaTools, toolToServer, nil
 }
@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"binary-annotator-pro/logging"
+	"binary-annotator-pro/services"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// toolFailure classifies why a tool call failed, so the model can tell a
+// retryable transport problem from an error reported by the tool itself.
+type toolFailure string
+
+const (
+	toolFailureTransport toolFailure = "transport" // manager or server unreachable
+	toolFailureMCPError  toolFailure = "mcp_error" // the tool returned a JSON-RPC error
+	toolFailureNotFound  toolFailure = "not_found" // no such tool or server
+	// The arguments don't match the tool's input schema; the call was not sent
+	toolFailureInvalidArgs toolFailure = "invalid_arguments"
+)
+
+// classifyToolError maps an error from calling a tool through the manager to a toolFailure
+func classifyToolError(err error) toolFailure {
+	var mErr *managerError
+	if !errors.As(err, &mErr) {
+		return toolFailureTransport
+	}
+
+	msg := strings.ToLower(mErr.Message)
+	switch {
+	case strings.HasPrefix(msg, "mcp error:"):
+		// JSON-RPC "method not found" or the SDKs' "unknown tool" message
+		if strings.Contains(msg, "-32601") || strings.Contains(msg, "unknown tool") || strings.Contains(msg, "not found") {
+			return toolFailureNotFound
+		}
+		return toolFailureMCPError
+	case mErr.StatusCode == http.StatusNotFound, strings.Contains(msg, "not running"):
+		return toolFailureNotFound
+	default:
+		return toolFailureTransport
+	}
+}
+
+// toolFailureMessage is the tool result sent back to the model for a failed call
+func toolFailureMessage(toolName string, failure toolFailure, err error) string {
+	var hint string
+	switch failure {
+	case toolFailureTransport:
+		hint = "The tool server could not be reached or timed out; the call may succeed if retried."
+	case toolFailureMCPError:
+		hint = "The tool ran and reported an error; change the arguments instead of retrying the same call."
+	case toolFailureNotFound:
+		hint = "This tool is not available; do not call it again."
+	case toolFailureInvalidArgs:
+		hint = "Fix the arguments to match the tool's input schema and call it again."
+	}
+	return fmt.Sprintf("Error calling %s [%s]: %v. %s", toolName, failure, err, hint)
+}
+
+// mcpToolSeparator joins a server and a tool name when several servers
+// expose a tool of the same name
+const mcpToolSeparator = "::"
+
+// mcpToolsFromServers converts the tools of the manager's /servers listing to
+// the chat tool format and maps each tool name the model sees to its server.
+// A tool name exposed by more than one server is presented as server::tool
+// for each of them, so none shadows another.
+func mcpToolsFromServers(servers []map[string]interface{}) ([]services.Tool, map[string]string) {
+	// Count the servers exposing each tool name
+	exposedBy := make(map[string]int)
+	for _, server := range servers {
+		tools, _ := server["tools"].([]interface{})
+		names := make(map[string]bool)
+		for _, toolData := range tools {
+			if toolMap, ok := toolData.(map[string]interface{}); ok {
+				name, _ := toolMap["name"].(string)
+				names[name] = true
+			}
+		}
+		for name := range names {
+			exposedBy[name]++
+		}
+	}
+
+	var ollamaTools []services.Tool
+	toolToServer := make(map[string]string) // Maps tool name to server name
+
+	for _, server := range servers {
+		serverName, _ := server["name"].(string)
+		tools, ok := server["tools"].([]interface{})
+		if !ok || len(tools) == 0 {
+			continue
+		}
+
+		for _, toolData := range tools {
+			toolMap, ok := toolData.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			name, _ := toolMap["name"].(string)
+			description, _ := toolMap["description"].(string)
+			inputSchema, _ := toolMap["inputSchema"].(map[string]interface{})
+			if exposedBy[name] > 1 {
+				name = serverName + mcpToolSeparator + name
+				description = fmt.Sprintf("[%s] %s", serverName, description)
+			}
+
+			// Convert MCP InputSchema to Ollama Parameters format
+			parameters := make(map[string]interface{})
+			if inputSchema != nil {
+				parameters["type"] = inputSchema["type"]
+				if props, ok := inputSchema["properties"].(map[string]interface{}); ok {
+					parameters["properties"] = props
+				}
+				if required, ok := inputSchema["required"].([]interface{}); ok {
+					parameters["required"] = required
+				}
+			}
+
+			ollamaTools = append(ollamaTools, services.Tool{
+				Type: "function",
+				Function: services.FunctionDef{
+					Name:        name,
+					Description: description,
+					Parameters:  parameters,
+				},
+			})
+			toolToServer[name] = serverName
+		}
+	}
+
+	return ollamaTools, toolToServer
+}
+
+// mcpToolName returns the name serverName knows a tool by, dropping the
+// server:: prefix mcpToolsFromServers adds to conflicting names
+func mcpToolName(toolName, serverName string) string {
+	if name, ok := strings.CutPrefix(toolName, serverName+mcpToolSeparator); ok {
+		return name
+	}
+	return toolName
+}
+
+// callMCPTool runs a tool on an MCP server through the Docker Manager and
+// returns its text output, or the JSON-encoded result when the tool returned
+// something other than text content
+func (ch *ChatHandler) callMCPTool(ctx context.Context, serverName, toolName string, arguments map[string]interface{}) (string, error) {
+	result, err := ch.mcpDockerHandler.callTool(ctx, serverName, toolName, arguments)
+	if err != nil {
+		return "", err
+	}
+
+	if text, ok := result["result"].(string); ok {
+		return text, nil
+	}
+	resultBytes, _ := json.Marshal(result)
+	return string(resultBytes), nil
+}
+
+// chatWriter is the part of the websocket connection the tool loop writes to
+type chatWriter interface {
+	WriteJSON(v interface{}) error
+}
+
+// executeToolCalls runs the tool calls of one model response and returns the
+// tool result messages in call order. Identical calls (same name and
+// arguments) run, and ask for approval, once and share the first result.
+// Calls are skipped once ctx is done (the client disconnected). Arguments are
+// checked against schemas (tool name -> input schema) before anything runs.
+func (ch *ChatHandler) executeToolCalls(ctx context.Context, ws chatWriter, sessionID uint, toolCalls []services.ToolCall, toolToServer map[string]string, schemas map[string]map[string]interface{}) []services.ChatMessageReq {
+	results := make([]services.ChatMessageReq, 0, len(toolCalls))
+	seen := make(map[string]string, len(toolCalls)) // call key -> result
+
+	for _, toolCall := range toolCalls {
+		key := toolCallKey(toolCall)
+		content, duplicate := seen[key]
+		if duplicate {
+			logging.FromContext(ctx).Info("reusing result for duplicate tool call", "tool", toolCall.Function.Name)
+		} else {
+			content = ch.executeToolCall(ctx, ws, sessionID, toolCall, toolToServer, schemas[toolCall.Function.Name])
+			seen[key] = content
+		}
+		results = append(results, services.ChatMessageReq{Role: "tool", Content: content, ToolName: toolCall.Function.Name})
+	}
+	return results
+}
+
+// toolCallKey identifies a call by tool name and arguments. Arguments are
+// JSON-encoded, which sorts map keys, so key order doesn't matter.
+func toolCallKey(toolCall services.ToolCall) string {
+	args, _ := json.Marshal(toolCall.Function.Arguments)
+	return toolCall.Function.Name + "\x00" + string(args)
+}
+
+// executeToolCall asks the user to approve a tool call, runs it and returns
+// the tool result message content for the model. A call whose arguments don't
+// match schema is answered with the problem so the model can correct it.
+func (ch *ChatHandler) executeToolCall(ctx context.Context, ws chatWriter, sessionID uint, toolCall services.ToolCall, toolToServer map[string]string, schema map[string]interface{}) string {
+	toolName := toolCall.Function.Name
+	arguments := toolCall.Function.Arguments
+
+	if ctx.Err() != nil {
+		return fmt.Sprintf("Tool %s was not run: the client disconnected", toolName)
+	}
+
+	logger := logging.FromContext(ctx).With("tool", toolName)
+	logger.Info("tool call requested", "arguments", arguments)
+
+	// Send status to client
+	ws.WriteJSON(&ChatWSResponse{
+		Type:  "chunk",
+		Chunk: fmt.Sprintf("\n\n🔧 Calling tool: %s...\n", toolName),
+	})
+
+	// Find which server hosts this tool
+	serverName, found := toolToServer[toolName]
+	if !found {
+		logger.Warn("tool not found in any server")
+		ws.WriteJSON(&ChatWSResponse{
+			Type:  "chunk",
+			Chunk: fmt.Sprintf("❌ Tool %s not found\n", toolName),
+		})
+		return toolFailureMessage(toolName, toolFailureNotFound, fmt.Errorf("tool %s is not provided by any running server", toolName))
+	}
+
+	if err := validateToolArguments(schema, arguments); err != nil {
+		logger.Warn("tool called with invalid arguments", "error", err)
+		ws.WriteJSON(&ChatWSResponse{
+			Type:  "chunk",
+			Chunk: fmt.Sprintf("❌ Invalid arguments for %s: %v\n", toolName, err),
+		})
+		return toolFailureMessage(toolName, toolFailureInvalidArgs, err)
+	}
+
+	// Request user approval for tool execution
+	approvalChan := make(chan bool, 1)
+	ch.approvalChannels[sessionID] = approvalChan
+
+	// Send approval request to frontend
+	ws.WriteJSON(&ChatWSResponse{
+		Type: "tool_approval_request",
+		ToolApproval: &ToolApprovalRequest{
+			ToolName:  toolName,
+			Arguments: arguments,
+			Server:    serverName,
+		},
+	})
+
+	logger.Info("waiting for tool approval", "server", serverName)
+
+	// Wait for approval with 60 second timeout
+	var approved bool
+	select {
+	case approved = <-approvalChan:
+		logger.Info("tool approval answered", "approved", approved)
+	case <-time.After(60 * time.Second):
+		logger.Warn("tool approval timed out")
+		approved = false
+	case <-ctx.Done():
+		logger.Info("client disconnected while approving tool")
+		delete(ch.approvalChannels, sessionID)
+		return fmt.Sprintf("Tool %s was not run: the client disconnected", toolName)
+	}
+
+	// Clean up approval channel
+	delete(ch.approvalChannels, sessionID)
+
+	// If not approved, skip execution
+	if !approved {
+		ws.WriteJSON(&ChatWSResponse{
+			Type:  "chunk",
+			Chunk: fmt.Sprintf("⚠️ Tool %s execution was denied\n", toolName),
+		})
+		return fmt.Sprintf("User denied execution of %s", toolName)
+	}
+
+	// Call the MCP tool via Docker Manager
+	resultText, err := ch.callMCPTool(ctx, serverName, mcpToolName(toolName, serverName), arguments)
+	if err != nil {
+		failure := classifyToolError(err)
+		logger.Warn("tool call failed", "failure", failure, "error", err)
+		ws.WriteJSON(&ChatWSResponse{
+			Type:  "chunk",
+			Chunk: fmt.Sprintf("❌ Tool error (%s): %v\n", failure, err),
+		})
+		return toolFailureMessage(toolName, failure, err)
+	}
+
+	logger.Debug("tool result", "result", resultText)
+
+	// Don't send result preview to client - let AI interpret it
+	// The AI will receive the tool result and formulate a user-friendly response
+
+	return resultText
+}
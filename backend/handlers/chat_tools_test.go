@@ -0,0 +1,446 @@
+package handlers
+
+import (
+	"binary-annotator-pro/services"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+// TestToolCallFailureClasses checks each kind of tool failure is classified and described to the model
+func TestToolCallFailureClasses(t *testing.T) {
+	manager := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/servers/ok/call":
+			json.NewEncoder(w).Encode(map[string]interface{}{"result": map[string]string{"text": "done"}})
+		case "/servers/text/call":
+			json.NewEncoder(w).Encode(map[string]interface{}{"result": "line 1\nline 2"})
+		case "/servers/bad-args/call":
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "MCP error: map[code:-32602 message:invalid offset]"})
+		case "/servers/unknown-tool/call":
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "MCP error: map[code:-32601 message:Unknown tool: frobnicate]"})
+		case "/servers/stopped/call":
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "server stopped not running"})
+		case "/servers/slow/call":
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "timeout waiting for tool response"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer manager.Close()
+
+	ch := &ChatHandler{mcpDockerHandler: &MCPDockerHandler{managerURL: manager.URL}}
+
+	result, err := ch.callMCPTool(context.Background(), "ok", "list_binary_files", nil)
+	if err != nil || !strings.Contains(result, `"done"`) {
+		t.Fatalf("callMCPTool(ok) = %q, %v", result, err)
+	}
+	// Text extracted by the manager reaches the model unwrapped
+	if result, err := ch.callMCPTool(context.Background(), "text", "list_binary_files", nil); err != nil || result != "line 1\nline 2" {
+		t.Fatalf("callMCPTool(text) = %q, %v", result, err)
+	}
+
+	tests := []struct {
+		server   string
+		url      string
+		want     toolFailure
+		wantText string
+	}{
+		{server: "bad-args", want: toolFailureMCPError, wantText: "invalid offset"},
+		{server: "unknown-tool", want: toolFailureNotFound, wantText: "Unknown tool"},
+		{server: "stopped", want: toolFailureNotFound, wantText: "not running"},
+		{server: "slow", want: toolFailureTransport, wantText: "timeout"},
+		{server: "missing", want: toolFailureNotFound, wantText: "status 404"},
+		{server: "ok", url: "http://127.0.0.1:1", want: toolFailureTransport, wantText: "failed to send request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.server+string(tt.want), func(t *testing.T) {
+			handler := ch
+			if tt.url != "" {
+				handler = &ChatHandler{mcpDockerHandler: &MCPDockerHandler{managerURL: tt.url}}
+			}
+
+			_, err := handler.callMCPTool(context.Background(), tt.server, "frobnicate", nil)
+			if err == nil {
+				t.Fatal("callMCPTool() succeeded, want error")
+			}
+			if got := classifyToolError(err); got != tt.want {
+				t.Errorf("classifyToolError(%v) = %s, want %s", err, got, tt.want)
+			}
+
+			msg := toolFailureMessage("frobnicate", classifyToolError(err), err)
+			if !strings.Contains(msg, "["+string(tt.want)+"]") || !strings.Contains(msg, tt.wantText) {
+				t.Errorf("message %q should name class %s and include %q", msg, tt.want, tt.wantText)
+			}
+		})
+	}
+}
+
+// approvingWriter counts tool approval requests and approves each one
+type approvingWriter struct {
+	ch        *ChatHandler
+	sessionID uint
+	approvals int
+}
+
+func (w *approvingWriter) WriteJSON(v interface{}) error {
+	if resp, ok := v.(*ChatWSResponse); ok && resp.Type == "tool_approval_request" {
+		w.approvals++
+		w.ch.approvalChannels[w.sessionID] <- true
+	}
+	return nil
+}
+
+// TestExecuteToolCallsDeduplicates runs identical tool calls once and reuses the result
+func TestExecuteToolCallsDeduplicates(t *testing.T) {
+	var calls []string
+	manager := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Tool      string                 `json:"tool"`
+			Arguments map[string]interface{} `json:"arguments"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		calls = append(calls, req.Tool)
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": req.Arguments})
+	}))
+	defer manager.Close()
+
+	ch := &ChatHandler{
+		mcpDockerHandler: &MCPDockerHandler{managerURL: manager.URL},
+		approvalChannels: make(map[uint]chan bool),
+	}
+	writer := &approvingWriter{ch: ch, sessionID: 7}
+
+	call := func(name string, args map[string]interface{}) services.ToolCall {
+		var tc services.ToolCall
+		tc.Function.Name = name
+		tc.Function.Arguments = args
+		return tc
+	}
+	toolCalls := []services.ToolCall{
+		call("list_binary_files", nil),
+		call("read_bytes", map[string]interface{}{"offset": 0, "length": 16}),
+		call("list_binary_files", nil),
+		call("read_bytes", map[string]interface{}{"length": 16, "offset": 0}), // same args, different key order
+		call("read_bytes", map[string]interface{}{"offset": 16, "length": 16}),
+	}
+	toolToServer := map[string]string{"list_binary_files": "binary", "read_bytes": "binary"}
+
+	results := ch.executeToolCalls(context.Background(), writer, 7, toolCalls, toolToServer, nil)
+
+	if len(calls) != 3 || writer.approvals != 3 {
+		t.Fatalf("executed %v with %d approvals, want 3 executions and 3 approvals", calls, writer.approvals)
+	}
+	if len(results) != len(toolCalls) {
+		t.Fatalf("got %d results, want one per call (%d)", len(results), len(toolCalls))
+	}
+	if results[0].Content != results[2].Content || results[1].Content != results[3].Content {
+		t.Errorf("duplicate calls should reuse the first result: %+v", results)
+	}
+	if results[1].Content == results[4].Content {
+		t.Errorf("calls with different arguments should not be merged: %+v", results)
+	}
+}
+
+// disconnectingWriter drops the connection when asked to approve a tool call
+type disconnectingWriter struct {
+	cancel    context.CancelFunc
+	approvals int
+}
+
+func (w *disconnectingWriter) WriteJSON(v interface{}) error {
+	if resp, ok := v.(*ChatWSResponse); ok && resp.Type == "tool_approval_request" {
+		w.approvals++
+		w.cancel()
+	}
+	return nil
+}
+
+// TestToolApprovalReleasedOnDisconnect checks a pending approval returns as soon
+// as the client goes away instead of waiting for the approval timeout
+func TestToolApprovalReleasedOnDisconnect(t *testing.T) {
+	var calls int
+	manager := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": "ok"})
+	}))
+	defer manager.Close()
+
+	ch := &ChatHandler{
+		mcpDockerHandler: &MCPDockerHandler{managerURL: manager.URL},
+		approvalChannels: make(map[uint]chan bool),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	writer := &disconnectingWriter{cancel: cancel}
+
+	var first, second services.ToolCall
+	first.Function.Name = "list_binary_files"
+	second.Function.Name = "read_bytes"
+	toolToServer := map[string]string{"list_binary_files": "binary", "read_bytes": "binary"}
+
+	done := make(chan []services.ChatMessageReq)
+	go func() {
+		done <- ch.executeToolCalls(ctx, writer, 7, []services.ToolCall{first, second}, toolToServer, nil)
+	}()
+
+	select {
+	case results := <-done:
+		if calls != 0 || writer.approvals != 1 {
+			t.Errorf("got %d tool executions and %d approval requests, want 0 and 1", calls, writer.approvals)
+		}
+		for i, r := range results {
+			if !strings.Contains(r.Content, "disconnected") {
+				t.Errorf("result %d = %q, want a disconnect notice", i, r.Content)
+			}
+		}
+		if len(ch.approvalChannels) != 0 {
+			t.Errorf("approval channels left behind: %v", ch.approvalChannels)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("tool approval still pending after the client disconnected")
+	}
+}
+
+// TestChatHeartbeatDropsSilentClient checks a client that stops answering pings
+// is disconnected after chatPongWait, while a responsive client stays connected
+func TestChatHeartbeatDropsSilentClient(t *testing.T) {
+	oldWait, oldPeriod := chatPongWait, chatPingPeriod
+	chatPongWait, chatPingPeriod = 200*time.Millisecond, 50*time.Millisecond
+	defer func() { chatPongWait, chatPingPeriod = oldWait, oldPeriod }()
+
+	ch := &ChatHandler{approvalChannels: make(map[uint]chan bool), conns: make(map[*websocket.Conn]struct{})}
+	closed := make(chan struct{}, 2)
+	e := echo.New()
+	e.GET("/ws/chat", func(c echo.Context) error {
+		defer func() { closed <- struct{}{} }()
+		return ch.HandleChat(c)
+	})
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws/chat"
+
+	// A responsive client: reading lets gorilla answer pings with pongs
+	live, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer live.Close()
+	go func() {
+		for {
+			if _, _, err := live.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	// A dropped client: never reads, so never answers pings
+	silent, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("silent client still connected well after chatPongWait")
+	}
+
+	select {
+	case <-closed:
+		t.Error("responsive client was disconnected")
+	case <-time.After(3 * chatPongWait):
+	}
+
+	// Let the remaining handler finish before the timeouts are restored
+	live.Close()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("handler still running after the client closed")
+	}
+}
+
+// TestChatShutdownWaitsForReplies checks Shutdown waits for an in-flight reply
+// and then closes open chat connections with a going-away frame
+func TestChatShutdownWaitsForReplies(t *testing.T) {
+	ch := &ChatHandler{approvalChannels: make(map[uint]chan bool), conns: make(map[*websocket.Conn]struct{})}
+	e := echo.New()
+	e.GET("/ws/chat", ch.HandleChat)
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws/chat", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	for deadline := time.Now().Add(2 * time.Second); ; {
+		ch.mu.Lock()
+		n := len(ch.conns)
+		ch.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("connection never registered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if !ch.beginStream() {
+		t.Fatal("beginStream refused before shutdown")
+	}
+	shutdownDone := make(chan error, 1)
+	go func() { shutdownDone <- ch.Shutdown(context.Background()) }()
+
+	select {
+	case <-shutdownDone:
+		t.Fatal("Shutdown returned while a reply was still running")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if ch.beginStream() {
+		t.Error("beginStream accepted a reply during shutdown")
+	}
+
+	ch.streams.Done()
+	select {
+	case err := <-shutdownDone:
+		if err != nil {
+			t.Errorf("Shutdown() error = %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Shutdown did not return after the reply finished")
+	}
+
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := client.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("client read error = %v, want a going-away close", err)
+	}
+}
+
+// TestToolCallArgumentsValidated checks calls that don't match the tool's input
+// schema are answered with the problem instead of reaching the server
+func TestToolCallArgumentsValidated(t *testing.T) {
+	var calls int
+	manager := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": "ok"})
+	}))
+	defer manager.Close()
+
+	ch := &ChatHandler{
+		mcpDockerHandler: &MCPDockerHandler{managerURL: manager.URL},
+		approvalChannels: make(map[uint]chan bool),
+	}
+	writer := &approvingWriter{ch: ch, sessionID: 7}
+
+	var tool services.Tool
+	tool.Function.Name = "read_bytes"
+	tool.Function.Parameters = map[string]interface{}{
+		"type":     "object",
+		"required": []interface{}{"file", "offset"},
+		"properties": map[string]interface{}{
+			"file":   map[string]interface{}{"type": "string"},
+			"offset": map[string]interface{}{"type": "integer"},
+		},
+	}
+	schemas := mcpToolSchemas([]services.Tool{tool})
+	toolToServer := map[string]string{"read_bytes": "binary"}
+
+	call := func(args map[string]interface{}) services.ToolCall {
+		var tc services.ToolCall
+		tc.Function.Name = "read_bytes"
+		tc.Function.Arguments = args
+		return tc
+	}
+	results := ch.executeToolCalls(context.Background(), writer, 7, []services.ToolCall{
+		call(map[string]interface{}{"file": "ecg.bin"}),
+		call(map[string]interface{}{"file": "ecg.bin", "offset": "0x10"}),
+	}, toolToServer, schemas)
+
+	if calls != 0 || writer.approvals != 0 {
+		t.Fatalf("got %d tool executions and %d approval requests for invalid calls, want none", calls, writer.approvals)
+	}
+	for i, want := range []string{`missing required argument "offset"`, `argument "offset" must be integer, got string`} {
+		if !strings.Contains(results[i].Content, "[invalid_arguments]") || !strings.Contains(results[i].Content, want) {
+			t.Errorf("result %d = %q, want an invalid_arguments message with %q", i, results[i].Content, want)
+		}
+	}
+
+	results = ch.executeToolCalls(context.Background(), writer, 7, []services.ToolCall{
+		call(map[string]interface{}{"file": "ecg.bin", "offset": float64(16)}),
+	}, toolToServer, schemas)
+	if calls != 1 || results[0].Content != "ok" {
+		t.Errorf("valid call: %d executions, result %q", calls, results[0].Content)
+	}
+}
+
+// TestMCPToolsDuplicateNames namespaces a tool exposed by two servers and
+// routes each namespaced call to its own server under the original name
+func TestMCPToolsDuplicateNames(t *testing.T) {
+	readFile := map[string]interface{}{
+		"name":        "read_file",
+		"description": "Read a file",
+		"inputSchema": map[string]interface{}{"type": "object", "properties": map[string]interface{}{"path": map[string]interface{}{"type": "string"}}},
+	}
+	servers := []map[string]interface{}{
+		{"name": "binary", "tools": []interface{}{readFile, map[string]interface{}{"name": "list_binary_files"}}},
+		{"name": "filesystem", "tools": []interface{}{readFile}},
+	}
+	tools, toolToServer := mcpToolsFromServers(servers)
+
+	names := make([]string, len(tools))
+	for i, tool := range tools {
+		names[i] = tool.Function.Name
+	}
+	if want := []string{"binary::read_file", "list_binary_files", "filesystem::read_file"}; strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Fatalf("tool names = %v, want %v", names, want)
+	}
+	if toolToServer["binary::read_file"] != "binary" || toolToServer["filesystem::read_file"] != "filesystem" || toolToServer["list_binary_files"] != "binary" {
+		t.Fatalf("toolToServer = %v", toolToServer)
+	}
+
+	var calls []string
+	manager := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Tool string `json:"tool"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		calls = append(calls, r.URL.Path+" "+req.Tool)
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": r.URL.Path})
+	}))
+	defer manager.Close()
+
+	ch := &ChatHandler{
+		mcpDockerHandler: &MCPDockerHandler{managerURL: manager.URL},
+		approvalChannels: make(map[uint]chan bool),
+	}
+	var first, second services.ToolCall
+	first.Function.Name = "filesystem::read_file"
+	first.Function.Arguments = map[string]interface{}{"path": "/etc/hosts"}
+	second.Function.Name = "binary::read_file"
+	second.Function.Arguments = map[string]interface{}{"path": "ecg.bin"}
+	results := ch.executeToolCalls(context.Background(), &approvingWriter{ch: ch, sessionID: 3}, 3,
+		[]services.ToolCall{first, second}, toolToServer, mcpToolSchemas(tools))
+
+	want := []string{"/servers/filesystem/call read_file", "/servers/binary/call read_file"}
+	if strings.Join(calls, ",") != strings.Join(want, ",") {
+		t.Errorf("manager calls = %v, want %v", calls, want)
+	}
+	if len(results) != 2 || results[0].Content != "/servers/filesystem/call" || results[1].Content != "/servers/binary/call" {
+		t.Errorf("results = %+v", results)
+	}
+}
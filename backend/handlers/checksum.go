@@ -31,6 +31,12 @@ type ChecksumResponse struct {
 	XOR8         string `json:"xor8"`
 	NegativeSum8 string `json:"negative_sum8"`
 
+	// 16-bit complement trailers ("make the total wrap to zero")
+	OnesComplement16LE string `json:"ones_complement16_le"` // IP/TCP-style checksum
+	OnesComplement16BE string `json:"ones_complement16_be"`
+	TwosComplement16LE string `json:"twos_complement16_le"`
+	TwosComplement16BE string `json:"twos_complement16_be"`
+
 	// Standard checksums
 	Fletcher16  string `json:"fletcher16"`
 	Adler32     string `json:"adler32"`
@@ -41,7 +47,10 @@ type ChecksumResponse struct {
 	CRC16Modbus string `json:"crc16_modbus"`
 	CRC16XModem string `json:"crc16_xmodem"`
 	CRC16CCITT  string `json:"crc16_ccitt"` // Used in Schiller MKF files
+	CRC16ARC    string `json:"crc16_arc"`
+	CRC16Kermit string `json:"crc16_kermit"`
 	CRC32       string `json:"crc32"`
+	CRC32C      string `json:"crc32c"` // Castagnoli, common in storage formats
 
 	// Cryptographic hashes
 	MD5    string `json:"md5"`
@@ -57,44 +66,115 @@ type ChecksumResponse struct {
 func (h *Handler) CalculateChecksum(c echo.Context) error {
 	var req ChecksumRequest
 	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request")
 	}
 
 	// Validate request
 	if req.FileID == 0 {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "fileId is required"})
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "fileId is required")
 	}
 	if req.Length <= 0 {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "length must be greater than 0"})
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "length must be greater than 0")
 	}
 	if req.Offset < 0 {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "offset must be non-negative"})
+		return apiError(c, http.StatusBadRequest, ErrCodeOutOfRange, "offset must be non-negative")
 	}
 
 	// Get file from database
 	var file models.File
-	if err := h.db.GormDB.First(&file, req.FileID).Error; err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "File not found"})
+	if err := h.files.load(h.db.GormDB, &file, req.FileID); err != nil {
+		return apiError(c, http.StatusNotFound, ErrCodeFileNotFound, "File not found")
 	}
 
 	// Validate offset and length against file size
 	if req.Offset >= len(file.Data) {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "offset exceeds file size"})
+		return apiErrorDetails(c, http.StatusBadRequest, ErrCodeOutOfRange, "offset exceeds file size",
+			map[string]any{"offset": req.Offset, "file_size": len(file.Data)})
 	}
 
 	endOffset := req.Offset + req.Length
 	if endOffset > len(file.Data) {
 		endOffset = len(file.Data)
-		req.Length = endOffset - req.Offset
 	}
 
 	// Extract the byte range
 	data := file.Data[req.Offset:endOffset]
 
-	// Calculate all checksums
+	return c.JSON(http.StatusOK, computeChecksums(data, req.Offset))
+}
+
+// ChecksumRegion is a single {offset,length} window within a batch request
+type ChecksumRegion struct {
+	Offset int `json:"offset"`
+	Length int `json:"length"`
+}
+
+// ChecksumBatchRequest asks for checksums over several regions of the same file
+type ChecksumBatchRequest struct {
+	FileID  uint             `json:"file_id"`
+	Regions []ChecksumRegion `json:"regions"`
+}
+
+// ChecksumBatchResponse holds one ChecksumResponse per requested region, in request order
+type ChecksumBatchResponse struct {
+	FileID  uint               `json:"file_id"`
+	Results []ChecksumResponse `json:"results"`
+	Count   int                `json:"count"`
+}
+
+// CalculateChecksumBatch computes the full checksum set for many regions in one call.
+// Useful when hunting for the window a stored checksum was computed over.
+func (h *Handler) CalculateChecksumBatch(c echo.Context) error {
+	var req ChecksumBatchRequest
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request")
+	}
+
+	if req.FileID == 0 {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "file_id is required")
+	}
+	if len(req.Regions) == 0 {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "regions must not be empty")
+	}
+
+	var file models.File
+	if err := h.files.load(h.db.GormDB, &file, req.FileID); err != nil {
+		return apiError(c, http.StatusNotFound, ErrCodeFileNotFound, "File not found")
+	}
+
+	results := make([]ChecksumResponse, 0, len(req.Regions))
+	for i, region := range req.Regions {
+		if region.Length <= 0 {
+			return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("region %d: length must be greater than 0", i))
+		}
+		if region.Offset < 0 {
+			return apiError(c, http.StatusBadRequest, ErrCodeOutOfRange, fmt.Sprintf("region %d: offset must be non-negative", i))
+		}
+		if region.Offset >= len(file.Data) {
+			return apiError(c, http.StatusBadRequest, ErrCodeOutOfRange, fmt.Sprintf("region %d: offset exceeds file size", i))
+		}
+
+		endOffset := region.Offset + region.Length
+		if region.Length > len(file.Data)-region.Offset {
+			endOffset = len(file.Data)
+		}
+
+		results = append(results, computeChecksums(file.Data[region.Offset:endOffset], region.Offset))
+	}
+
+	return c.JSON(http.StatusOK, ChecksumBatchResponse{
+		FileID:  req.FileID,
+		Results: results,
+		Count:   len(results),
+	})
+}
+
+// computeChecksums calculates every supported checksum over data.
+// offset is only reported back in the response.
+func computeChecksums(data []byte, offset int) ChecksumResponse {
 	response := ChecksumResponse{
-		Offset: req.Offset,
-		Length: req.Length,
+		Offset: offset,
+		Length: len(data),
 	}
 
 	// ===== Simple Checksums (very common in proprietary formats) =====
@@ -146,6 +226,14 @@ func (h *Handler) CalculateChecksum(c echo.Context) error {
 	negSum8 := uint8(-int8(sum8))
 	response.NegativeSum8 = fmt.Sprintf("%02x", negSum8)
 
+	// Ones' complement 16: end-around-carry word sum, inverted (RFC 1071)
+	response.OnesComplement16LE = fmt.Sprintf("%04x", calculateOnesComplement16(data, false))
+	response.OnesComplement16BE = fmt.Sprintf("%04x", calculateOnesComplement16(data, true))
+
+	// Two's complement 16: value that makes the 16-bit word sum wrap to zero
+	response.TwosComplement16LE = fmt.Sprintf("%04x", -sum16LE)
+	response.TwosComplement16BE = fmt.Sprintf("%04x", -sum16BE)
+
 	// ===== Standard Checksums =====
 
 	// Fletcher-16: Double checksum algorithm
@@ -187,10 +275,22 @@ func (h *Handler) CalculateChecksum(c echo.Context) error {
 	crc16CCITT := calculateCRC16CCITT(data)
 	response.CRC16CCITT = fmt.Sprintf("%04x", crc16CCITT)
 
+	// CRC-16/ARC (reflected 0x8005, a.k.a. CRC-16/IBM, used by LHA and many vendors)
+	crc16ARC := calculateCRC16ARC(data)
+	response.CRC16ARC = fmt.Sprintf("%04x", crc16ARC)
+
+	// CRC-16/KERMIT (reflected 0x1021, init 0x0000)
+	crc16Kermit := calculateCRC16Kermit(data)
+	response.CRC16Kermit = fmt.Sprintf("%04x", crc16Kermit)
+
 	// CRC-32 (IEEE 802.3, used in ZIP, PNG, Ethernet)
 	crc32Hash := crc32.ChecksumIEEE(data)
 	response.CRC32 = fmt.Sprintf("%08x", crc32Hash)
 
+	// CRC-32C (Castagnoli, used in iSCSI, ext4, Btrfs)
+	crc32CHash := crc32.Checksum(data, castagnoliTable)
+	response.CRC32C = fmt.Sprintf("%08x", crc32CHash)
+
 	// ===== Cryptographic Hashes =====
 
 	// MD5
@@ -209,13 +309,40 @@ func (h *Handler) CalculateChecksum(c echo.Context) error {
 	sha512Hash := sha512.Sum512(data)
 	response.SHA512 = hex.EncodeToString(sha512Hash[:])
 
-	return c.JSON(http.StatusOK, response)
+	return response
+}
+
+// calculateOnesComplement16 computes the RFC 1071 Internet checksum over 16-bit words.
+// A trailing odd byte is padded with zero. Appending the result to the data makes
+// the ones' complement sum equal 0xFFFF.
+func calculateOnesComplement16(data []byte, bigEndian bool) uint16 {
+	var sum uint32
+	for i := 0; i < len(data); i += 2 {
+		var word uint16
+		switch {
+		case i+1 >= len(data) && bigEndian:
+			word = uint16(data[i]) << 8
+		case i+1 >= len(data):
+			word = uint16(data[i])
+		case bigEndian:
+			word = (uint16(data[i]) << 8) | uint16(data[i+1])
+		default:
+			word = uint16(data[i]) | (uint16(data[i+1]) << 8)
+		}
+		sum += uint32(word)
+		sum = (sum & 0xFFFF) + (sum >> 16)
+	}
+	return ^uint16(sum)
 }
 
 // CRC-8 with polynomial 0x07 (used in many embedded systems)
 func calculateCRC8(data []byte) uint8 {
+	return updateCRC8(0x00, data)
+}
+
+// updateCRC8 continues a CRC-8 computation from a previous value
+func updateCRC8(crc uint8, data []byte) uint8 {
 	const polynomial uint8 = 0x07
-	var crc uint8 = 0x00
 
 	for _, b := range data {
 		crc ^= b
@@ -232,8 +359,12 @@ func calculateCRC8(data []byte) uint8 {
 
 // CRC-16/MODBUS (polynomial 0x8005, initial value 0xFFFF, no final XOR)
 func calculateCRC16Modbus(data []byte) uint16 {
+	return updateCRC16Modbus(0xFFFF, data)
+}
+
+// updateCRC16Modbus continues a CRC-16/MODBUS computation from a previous value
+func updateCRC16Modbus(crc uint16, data []byte) uint16 {
 	const polynomial uint16 = 0x8005
-	crc := uint16(0xFFFF)
 
 	for _, b := range data {
 		crc ^= uint16(b)
@@ -250,8 +381,19 @@ func calculateCRC16Modbus(data []byte) uint16 {
 
 // CRC-16/XMODEM (polynomial 0x1021, initial value 0x0000, no final XOR)
 func calculateCRC16XModem(data []byte) uint16 {
+	return updateCRC16Poly1021(0x0000, data)
+}
+
+// CRC-16/CCITT (polynomial 0x1021, initial value 0xFFFF, no final XOR)
+// This is the algorithm used by Python's binascii.crc_hqx() and in Schiller MKF files
+func calculateCRC16CCITT(data []byte) uint16 {
+	return updateCRC16Poly1021(0xFFFF, data)
+}
+
+// updateCRC16Poly1021 continues a non-reflected CRC-16 with polynomial 0x1021.
+// XMODEM and CCITT only differ by their initial value.
+func updateCRC16Poly1021(crc uint16, data []byte) uint16 {
 	const polynomial uint16 = 0x1021
-	crc := uint16(0x0000)
 
 	for _, b := range data {
 		crc ^= uint16(b) << 8
@@ -266,21 +408,143 @@ func calculateCRC16XModem(data []byte) uint16 {
 	return crc
 }
 
-// CRC-16/CCITT (polynomial 0x1021, initial value 0xFFFF, no final XOR)
-// This is the algorithm used by Python's binascii.crc_hqx() and in Schiller MKF files
-func calculateCRC16CCITT(data []byte) uint16 {
-	const polynomial uint16 = 0x1021
-	crc := uint16(0xFFFF)
+// CRC-16/ARC (reflected polynomial 0x8005 -> 0xA001, initial value 0x0000, no final XOR)
+func calculateCRC16ARC(data []byte) uint16 {
+	return updateCRC16Reflected(0x0000, 0xA001, data)
+}
 
+// CRC-16/KERMIT (reflected polynomial 0x1021 -> 0x8408, initial value 0x0000, no final XOR)
+func calculateCRC16Kermit(data []byte) uint16 {
+	return updateCRC16Reflected(0x0000, 0x8408, data)
+}
+
+// updateCRC16Reflected continues an LSB-first CRC-16 using the bit-reversed polynomial
+func updateCRC16Reflected(crc, reflectedPoly uint16, data []byte) uint16 {
 	for _, b := range data {
-		crc ^= uint16(b) << 8
+		crc ^= uint16(b)
 		for range 8 {
-			if crc&0x8000 != 0 {
-				crc = (crc << 1) ^ polynomial
+			if crc&0x0001 != 0 {
+				crc = (crc >> 1) ^ reflectedPoly
 			} else {
-				crc = crc << 1
+				crc = crc >> 1
 			}
 		}
 	}
 	return crc
 }
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ===== Seeded CRC (chained-block verification) =====
+
+// crcAlgorithm describes a CRC that can be resumed from a previous result
+type crcAlgorithm struct {
+	width  int    // in bits
+	init   uint32 // seed used when the caller doesn't provide one
+	update func(crc uint32, data []byte) uint32
+}
+
+// crcAlgorithms maps the algorithm names accepted by /checksum/crc.
+// Names match the ChecksumResponse JSON fields.
+var crcAlgorithms = map[string]crcAlgorithm{
+	"crc8": {8, 0x00, func(crc uint32, data []byte) uint32 {
+		return uint32(updateCRC8(uint8(crc), data))
+	}},
+	"crc16_modbus": {16, 0xFFFF, func(crc uint32, data []byte) uint32 {
+		return uint32(updateCRC16Modbus(uint16(crc), data))
+	}},
+	"crc16_xmodem": {16, 0x0000, func(crc uint32, data []byte) uint32 {
+		return uint32(updateCRC16Poly1021(uint16(crc), data))
+	}},
+	"crc16_ccitt": {16, 0xFFFF, func(crc uint32, data []byte) uint32 {
+		return uint32(updateCRC16Poly1021(uint16(crc), data))
+	}},
+	"crc16_arc": {16, 0x0000, func(crc uint32, data []byte) uint32 {
+		return uint32(updateCRC16Reflected(uint16(crc), 0xA001, data))
+	}},
+	"crc16_kermit": {16, 0x0000, func(crc uint32, data []byte) uint32 {
+		return uint32(updateCRC16Reflected(uint16(crc), 0x8408, data))
+	}},
+	// crc32.Update takes and returns the finalized value, so the previous
+	// block's CRC-32 can be passed as the seed directly
+	"crc32": {32, 0x00000000, func(crc uint32, data []byte) uint32 {
+		return crc32.Update(crc, crc32.IEEETable, data)
+	}},
+	"crc32c": {32, 0x00000000, func(crc uint32, data []byte) uint32 {
+		return crc32.Update(crc, castagnoliTable, data)
+	}},
+}
+
+// SeededCRCRequest computes a single CRC over a range, optionally continuing from a seed
+type SeededCRCRequest struct {
+	FileID    uint    `json:"file_id"`
+	Offset    int     `json:"offset"`
+	Length    int     `json:"length"`
+	Algorithm string  `json:"algorithm"`
+	Seed      *uint32 `json:"seed,omitempty"` // previous block's CRC; algorithm init value if omitted
+}
+
+// SeededCRCResponse returns the CRC both as hex and as the raw running value
+// to feed into the next block's request
+type SeededCRCResponse struct {
+	Algorithm string `json:"algorithm"`
+	Seed      uint32 `json:"seed"`
+	CRC       string `json:"crc"`
+	Value     uint32 `json:"value"`
+	Offset    int    `json:"offset"`
+	Length    int    `json:"length"`
+}
+
+// CalculateSeededCRC computes one CRC over a byte range starting from a caller-provided seed.
+// Formats that chain CRCs across blocks can be verified by feeding each response's
+// value into the next request.
+func (h *Handler) CalculateSeededCRC(c echo.Context) error {
+	var req SeededCRCRequest
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request")
+	}
+
+	if req.FileID == 0 {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "file_id is required")
+	}
+	algo, ok := crcAlgorithms[req.Algorithm]
+	if !ok {
+		return apiError(c, http.StatusBadRequest, ErrCodeUnsupported, fmt.Sprintf("unsupported algorithm: %s", req.Algorithm))
+	}
+	if req.Length <= 0 {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "length must be greater than 0")
+	}
+	if req.Offset < 0 {
+		return apiError(c, http.StatusBadRequest, ErrCodeOutOfRange, "offset must be non-negative")
+	}
+
+	var file models.File
+	if err := h.files.load(h.db.GormDB, &file, req.FileID); err != nil {
+		return apiError(c, http.StatusNotFound, ErrCodeFileNotFound, "File not found")
+	}
+
+	if req.Offset >= len(file.Data) {
+		return apiErrorDetails(c, http.StatusBadRequest, ErrCodeOutOfRange, "offset exceeds file size",
+			map[string]any{"offset": req.Offset, "file_size": len(file.Data)})
+	}
+	endOffset := req.Offset + req.Length
+	if req.Length > len(file.Data)-req.Offset {
+		endOffset = len(file.Data)
+	}
+
+	seed := algo.init
+	if req.Seed != nil {
+		seed = *req.Seed
+	}
+
+	value := algo.update(seed, file.Data[req.Offset:endOffset])
+
+	return c.JSON(http.StatusOK, SeededCRCResponse{
+		Algorithm: req.Algorithm,
+		Seed:      seed,
+		CRC:       fmt.Sprintf("%0*x", algo.width/4, value),
+		Value:     value,
+		Offset:    req.Offset,
+		Length:    endOffset - req.Offset,
+	})
+}
@@ -1,6 +1,10 @@
 package handlers
 
 import (
+	"fmt"
+	"hash/crc32"
+	"math"
+	"net/http"
 	"testing"
 )
 
@@ -117,3 +121,242 @@ func BenchmarkCRC16CCITT(b *testing.B) {
 		calculateCRC16CCITT(data)
 	}
 }
+
+// TestCalculateChecksumBatch checks that each region gets its own checksum set
+func TestCalculateChecksumBatch(t *testing.T) {
+	h := newTestHandler(t)
+	data := []byte("123456789hello world\xff\xff\xff\xff")
+	file := createTestFile(t, h, "batch.bin", data)
+
+	regions := []ChecksumRegion{
+		{Offset: 0, Length: 9},
+		{Offset: 9, Length: 11},
+		{Offset: 20, Length: 4},
+	}
+
+	c, rec := newJSONContext(http.MethodPost, "/checksum/batch", ChecksumBatchRequest{
+		FileID:  file.ID,
+		Regions: regions,
+	})
+	if err := h.CalculateChecksumBatch(c); err != nil {
+		t.Fatalf("CalculateChecksumBatch() error = %v", err)
+	}
+
+	var resp ChecksumBatchResponse
+	decodeJSON(t, rec, http.StatusOK, &resp)
+
+	if resp.Count != len(regions) || len(resp.Results) != len(regions) {
+		t.Fatalf("got %d results, want %d", len(resp.Results), len(regions))
+	}
+
+	expected := []struct {
+		crc16CCITT string
+		crc32      string
+	}{
+		{"29b1", "cbf43926"},
+		{"efeb", "0d4a1185"},
+		{"1d0f", "ffffffff"},
+	}
+
+	for i, region := range regions {
+		got := resp.Results[i]
+		want := computeChecksums(data[region.Offset:region.Offset+region.Length], region.Offset)
+		if got != want {
+			t.Errorf("region %d: got %+v, want %+v", i, got, want)
+		}
+		if got.Offset != region.Offset || got.Length != region.Length {
+			t.Errorf("region %d: offset/length = %d/%d, want %d/%d", i, got.Offset, got.Length, region.Offset, region.Length)
+		}
+		if got.CRC16CCITT != expected[i].crc16CCITT {
+			t.Errorf("region %d: crc16_ccitt = %s, want %s", i, got.CRC16CCITT, expected[i].crc16CCITT)
+		}
+		if got.CRC32 != expected[i].crc32 {
+			t.Errorf("region %d: crc32 = %s, want %s", i, got.CRC32, expected[i].crc32)
+		}
+	}
+}
+
+// TestCalculateChecksumBatchHugeLength checks a length that overflows
+// offset+length is clamped to the end of the file instead of panicking
+func TestCalculateChecksumBatchHugeLength(t *testing.T) {
+	h := newTestHandler(t)
+	data := []byte("123456789")
+	file := createTestFile(t, h, "huge.bin", data)
+
+	c, rec := newJSONContext(http.MethodPost, "/checksum/batch", ChecksumBatchRequest{
+		FileID:  file.ID,
+		Regions: []ChecksumRegion{{Offset: 4, Length: math.MaxInt}},
+	})
+	if err := h.CalculateChecksumBatch(c); err != nil {
+		t.Fatalf("CalculateChecksumBatch() error = %v", err)
+	}
+	var resp ChecksumBatchResponse
+	decodeJSON(t, rec, http.StatusOK, &resp)
+	if want := computeChecksums(data[4:], 4); len(resp.Results) != 1 || resp.Results[0] != want {
+		t.Errorf("results = %+v, want %+v", resp.Results, want)
+	}
+}
+
+// TestSeededCRCChaining checks that a CRC computed in two seeded halves matches the one-shot value
+func TestSeededCRCChaining(t *testing.T) {
+	data := []byte("The quick brown fox jumps over the lazy dog")
+	mid := len(data) / 2
+
+	for name, algo := range crcAlgorithms {
+		t.Run(name, func(t *testing.T) {
+			oneShot := algo.update(algo.init, data)
+			first := algo.update(algo.init, data[:mid])
+			chained := algo.update(first, data[mid:])
+			if chained != oneShot {
+				t.Errorf("chained = 0x%X, one-shot = 0x%X", chained, oneShot)
+			}
+		})
+	}
+}
+
+// TestCalculateSeededCRC feeds the first block's value into the second request
+func TestCalculateSeededCRC(t *testing.T) {
+	h := newTestHandler(t)
+	data := []byte("123456789")
+	file := createTestFile(t, h, "seeded.bin", data)
+
+	tests := []struct {
+		algorithm string
+		expected  string
+	}{
+		{"crc16_ccitt", "29b1"},
+		{"crc16_xmodem", "31c3"},
+		{"crc32", "cbf43926"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			c, rec := newJSONContext(http.MethodPost, "/checksum/crc", SeededCRCRequest{
+				FileID: file.ID, Offset: 0, Length: 4, Algorithm: tt.algorithm,
+			})
+			if err := h.CalculateSeededCRC(c); err != nil {
+				t.Fatalf("CalculateSeededCRC() error = %v", err)
+			}
+			var first SeededCRCResponse
+			decodeJSON(t, rec, http.StatusOK, &first)
+
+			c, rec = newJSONContext(http.MethodPost, "/checksum/crc", SeededCRCRequest{
+				FileID: file.ID, Offset: 4, Length: 5, Algorithm: tt.algorithm, Seed: &first.Value,
+			})
+			if err := h.CalculateSeededCRC(c); err != nil {
+				t.Fatalf("CalculateSeededCRC() error = %v", err)
+			}
+			var second SeededCRCResponse
+			decodeJSON(t, rec, http.StatusOK, &second)
+
+			if second.CRC != tt.expected {
+				t.Errorf("chained crc = %s, want %s", second.CRC, tt.expected)
+			}
+		})
+	}
+
+	c, rec := newJSONContext(http.MethodPost, "/checksum/crc", SeededCRCRequest{
+		FileID: file.ID, Length: 4, Algorithm: "crc64",
+	})
+	h.CalculateSeededCRC(c)
+	decodeJSON(t, rec, http.StatusBadRequest, nil)
+
+	// A length overflowing offset+length runs to the end of the file
+	c, rec = newJSONContext(http.MethodPost, "/checksum/crc", SeededCRCRequest{
+		FileID: file.ID, Offset: 4, Length: math.MaxInt, Algorithm: "crc32",
+	})
+	if err := h.CalculateSeededCRC(c); err != nil {
+		t.Fatalf("CalculateSeededCRC() error = %v", err)
+	}
+	var tail SeededCRCResponse
+	decodeJSON(t, rec, http.StatusOK, &tail)
+	if want := fmt.Sprintf("%08x", crc32.ChecksumIEEE(data[4:])); tail.CRC != want {
+		t.Errorf("crc of the rest = %s, want %s", tail.CRC, want)
+	}
+}
+
+// TestReflectedCRCCheckValues validates the added algorithms against the standard "123456789" check values
+func TestReflectedCRCCheckValues(t *testing.T) {
+	data := []byte("123456789")
+
+	tests := []struct {
+		name     string
+		got      func() uint32
+		expected uint32
+	}{
+		{"CRC-16/ARC", func() uint32 { return uint32(calculateCRC16ARC(data)) }, 0xBB3D},
+		{"CRC-16/KERMIT", func() uint32 { return uint32(calculateCRC16Kermit(data)) }, 0x2189},
+		{"CRC-32C", func() uint32 { return crc32.Checksum(data, castagnoliTable) }, 0xE3069283},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := tt.got(); result != tt.expected {
+				t.Errorf("%s = 0x%X, want 0x%X", tt.name, result, tt.expected)
+			}
+		})
+	}
+
+	resp := computeChecksums(data, 0)
+	if resp.CRC16ARC != "bb3d" || resp.CRC16Kermit != "2189" || resp.CRC32C != "e3069283" {
+		t.Errorf("computeChecksums() arc/kermit/crc32c = %s/%s/%s", resp.CRC16ARC, resp.CRC16Kermit, resp.CRC32C)
+	}
+}
+
+// TestComplement16Trailers checks that appending each trailer makes the total wrap
+func TestComplement16Trailers(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"RFC 1071 example", []byte{0x00, 0x01, 0xf2, 0x03, 0xf4, 0xf5, 0xf6, 0xf7}},
+		{"ECG frame header", []byte{0x55, 0xAA, 0x10, 0x00, 0x34, 0x12, 0xFF, 0x7F}},
+		{"Carry-heavy", []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x01, 0x00}},
+	}
+
+	wordsLE := func(data []byte) []uint16 {
+		words := make([]uint16, 0, len(data)/2)
+		for i := 0; i+1 < len(data); i += 2 {
+			words = append(words, uint16(data[i])|uint16(data[i+1])<<8)
+		}
+		return words
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Ones' complement: data words + checksum must sum (end-around carry) to 0xFFFF
+			oc := calculateOnesComplement16(tt.data, false)
+			var sum uint32
+			for _, w := range append(wordsLE(tt.data), oc) {
+				sum += uint32(w)
+				sum = (sum & 0xFFFF) + (sum >> 16)
+			}
+			if sum != 0xFFFF {
+				t.Errorf("ones' complement total = 0x%04X, want 0xFFFF", sum)
+			}
+
+			// Two's complement: data words + checksum must wrap to 0x0000
+			resp := computeChecksums(tt.data, 0)
+			var twos uint16
+			if _, err := fmt.Sscanf(resp.TwosComplement16LE, "%04x", &twos); err != nil {
+				t.Fatalf("parse twos_complement16_le: %v", err)
+			}
+			var total uint16
+			for _, w := range append(wordsLE(tt.data), twos) {
+				total += w
+			}
+			if total != 0 {
+				t.Errorf("two's complement total = 0x%04X, want 0x0000", total)
+			}
+		})
+	}
+
+	// RFC 1071 worked example: big-endian sum 0xddf2, checksum 0x220d
+	rfc := []byte{0x00, 0x01, 0xf2, 0x03, 0xf4, 0xf5, 0xf6, 0xf7}
+	if got := calculateOnesComplement16(rfc, true); got != 0x220d {
+		t.Errorf("calculateOnesComplement16(BE) = 0x%04X, want 0x220D", got)
+	}
+	if resp := computeChecksums(rfc, 0); resp.OnesComplement16BE != "220d" {
+		t.Errorf("ones_complement16_be = %s, want 220d", resp.OnesComplement16BE)
+	}
+}
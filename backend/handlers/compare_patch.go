@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"binary-annotator-pro/models"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// patchMagic starts every patch, the last byte is the format version
+const patchMagic = "BAPATCH\x01"
+
+// patchMergeGap joins two changed runs separated by fewer equal bytes, which
+// is smaller than the 16 bytes of a second op header
+const patchMergeGap = 16
+
+// patchOp replaces len(Data) bytes at Offset
+type patchOp struct {
+	Offset int
+	Data   []byte
+}
+
+// GetComparePatch returns a patch turning file1 into file2, for applying
+// outside the app. Like the other comparisons it is positional: the format,
+// all integers little endian, is
+//
+//	magic              "BAPATCH\x01"
+//	old size, new size uint64
+//	old hash, new hash SHA-256 of file1 and file2, 32 bytes each
+//	op count           uint64
+//	ops                offset uint64, length uint64, length bytes of file2
+//
+// To apply it, check file1's size and hash, copy file1 into a buffer of the
+// new size (zero filled past file1), write each op's bytes at its offset and
+// check the result against the new hash.
+func (h *Handler) GetComparePatch(c echo.Context) error {
+	id1, err1 := strconv.ParseUint(c.QueryParam("file1_id"), 10, 64)
+	id2, err2 := strconv.ParseUint(c.QueryParam("file2_id"), 10, 64)
+	if err1 != nil || err2 != nil || id1 == 0 || id2 == 0 {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "file1_id and file2_id are required")
+	}
+
+	var file1, file2 models.File
+	if err := h.files.load(h.db.GormDB, &file1, id1); err != nil {
+		return apiError(c, http.StatusNotFound, ErrCodeFileNotFound, "file 1 not found")
+	}
+	if err := h.files.load(h.db.GormDB, &file2, id2); err != nil {
+		return apiError(c, http.StatusNotFound, ErrCodeFileNotFound, "file 2 not found")
+	}
+
+	patch := encodePatch(file1.Data, file2.Data, patchOps(file1.Data, file2.Data))
+	c.Response().Header().Set(echo.HeaderContentDisposition,
+		fmt.Sprintf("attachment; filename=\"%s.to.%s.bapatch\"", filepath.Base(file1.Name), filepath.Base(file2.Name)))
+	return c.Blob(http.StatusOK, echo.MIMEOctetStream, patch)
+}
+
+// patchOps lists the runs of to that differ from from, position by
+// position. Bytes of to past the end of from differ unless they are 0, which
+// the zero fill of a longer result already provides.
+func patchOps(from, to []byte) []patchOp {
+	var ops []patchOp
+	start, end := -1, -1 // current run, end exclusive
+	for i := range len(to) {
+		if byteAt(from, i) == to[i] {
+			continue
+		}
+		if start >= 0 && i-end < patchMergeGap {
+			end = i + 1
+			continue
+		}
+		if start >= 0 {
+			ops = append(ops, patchOp{Offset: start, Data: to[start:end]})
+		}
+		start, end = i, i+1
+	}
+	if start >= 0 {
+		ops = append(ops, patchOp{Offset: start, Data: to[start:end]})
+	}
+	return ops
+}
+
+// encodePatch writes ops in the format described on GetComparePatch
+func encodePatch(from, to []byte, ops []patchOp) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(patchMagic)
+	binary.Write(&buf, binary.LittleEndian, uint64(len(from)))
+	binary.Write(&buf, binary.LittleEndian, uint64(len(to)))
+	fromHash, toHash := sha256.Sum256(from), sha256.Sum256(to)
+	buf.Write(fromHash[:])
+	buf.Write(toHash[:])
+	binary.Write(&buf, binary.LittleEndian, uint64(len(ops)))
+	for _, op := range ops {
+		binary.Write(&buf, binary.LittleEndian, uint64(op.Offset))
+		binary.Write(&buf, binary.LittleEndian, uint64(len(op.Data)))
+		buf.Write(op.Data)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// applyPatch applies a /compare/patch patch to from, checking it was made
+// for from and produces what it promises
+func applyPatch(from, patch []byte) ([]byte, error) {
+	r := bytes.NewReader(patch)
+	magic := make([]byte, len(patchMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != patchMagic {
+		return nil, errors.New("not a patch")
+	}
+	var header struct {
+		FromSize, ToSize uint64
+		FromHash, ToHash [32]byte
+		Ops              uint64
+	}
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+	if header.FromSize != uint64(len(from)) || header.FromHash != sha256.Sum256(from) {
+		return nil, errors.New("patch is for another file")
+	}
+
+	to := make([]byte, header.ToSize)
+	copy(to, from)
+	for range header.Ops {
+		var op struct{ Offset, Length uint64 }
+		if err := binary.Read(r, binary.LittleEndian, &op); err != nil {
+			return nil, err
+		}
+		if op.Offset+op.Length > header.ToSize {
+			return nil, fmt.Errorf("op at %d+%d is past the end", op.Offset, op.Length)
+		}
+		if _, err := io.ReadFull(r, to[op.Offset:op.Offset+op.Length]); err != nil {
+			return nil, err
+		}
+	}
+	if r.Len() != 0 {
+		return nil, errors.New("trailing data")
+	}
+	if sha256.Sum256(to) != header.ToHash {
+		return nil, errors.New("result does not match the patch hash")
+	}
+	return to, nil
+}
+
+// TestComparePatch downloads patches between files of equal, growing and
+// shrinking sizes and applies them to reconstruct file2
+func TestComparePatch(t *testing.T) {
+	h := newTestHandler(t)
+	base := bytes.Repeat([]byte("ECG sample block "), 64)
+	edited := append([]byte(nil), base...)
+	edited[3] = 'X'
+	edited[5] = 'Y' // merged with the change at 3
+	copy(edited[500:], "patched")
+	edited[len(edited)-1] = 0xFF
+
+	for _, tt := range []struct {
+		name    string
+		to      []byte
+		wantOps int
+	}{
+		{"same", base, 0},
+		{"edited", edited, 3},
+		{"grown", append(append([]byte(nil), base...), 0, 0, 1, 2, 0), 1},
+		{"shrunk", base[:100], 0},
+		{"empty", nil, 0},
+	} {
+		from := createTestFile(t, h, "from-"+tt.name, base)
+		to := createTestFile(t, h, "to-"+tt.name, tt.to)
+
+		c, rec := newJSONContext(http.MethodGet, fmt.Sprintf("/compare/patch?file1_id=%d&file2_id=%d", from.ID, to.ID), nil)
+		if err := h.GetComparePatch(c); err != nil {
+			t.Fatal(err)
+		}
+		decodeJSON(t, rec, http.StatusOK, nil)
+		if cd := rec.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, "attachment;") {
+			t.Errorf("%s: Content-Disposition = %q", tt.name, cd)
+		}
+		patch := rec.Body.Bytes()
+		if ops := binary.LittleEndian.Uint64(patch[len(patchMagic)+80:]); ops != uint64(tt.wantOps) {
+			t.Errorf("%s: %d ops, want %d", tt.name, ops, tt.wantOps)
+		}
+
+		got, err := applyPatch(base, patch)
+		if err != nil {
+			t.Fatalf("%s: apply: %v", tt.name, err)
+		}
+		if !bytes.Equal(got, tt.to) {
+			t.Errorf("%s: patched file differs from file2", tt.name)
+		}
+		if _, err := applyPatch(edited, patch); err == nil {
+			t.Errorf("%s: patch applied to the wrong file", tt.name)
+		}
+	}
+
+	c, rec := newJSONContext(http.MethodGet, "/compare/patch?file1_id=1", nil)
+	if err := h.GetComparePatch(c); err != nil {
+		t.Fatal(err)
+	}
+	decodeJSON(t, rec, http.StatusBadRequest, nil)
+}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// SignalSource describes how to decode a region of a file into samples: a
+// read in Format, then optional Stages as for /decode/pipeline (delta, scale)
+type SignalSource struct {
+	FileID uint          `json:"file_id"`
+	Offset int           `json:"offset"`
+	Length int           `json:"length"`           // 0: to the end of the file
+	Format string        `json:"format,omitempty"` // int16le, float32be, ...; default uint8, the raw bytes
+	Stages []DecodeStage `json:"stages,omitempty"`
+}
+
+// SignalCompareRequest compares the waveforms decoded from two files
+type SignalCompareRequest struct {
+	A SignalSource `json:"a"`
+	B SignalSource `json:"b"`
+	// ResampleTo, when set (at least 2), linearly resamples both signals to
+	// that many samples, for recordings at different rates. Otherwise the
+	// first samples of the longer signal are compared with the shorter one.
+	ResampleTo int `json:"resample_to,omitempty"`
+}
+
+// SignalCompareResponse holds how similar two decoded signals are.
+// Correlation (-1 to 1) ignores gain and offset differences; RMSE is in the
+// units of the decoded samples.
+type SignalCompareResponse struct {
+	SamplesA    int     `json:"samples_a"`
+	SamplesB    int     `json:"samples_b"`
+	Compared    int     `json:"compared"`
+	Resampled   bool    `json:"resampled"`
+	Correlation float64 `json:"correlation"`
+	RMSE        float64 `json:"rmse"`
+}
+
+// CompareSignals decodes a region of each file into samples and compares the
+// waveforms, to confirm two files store the same signal with different
+// framing or encoding. /compare/correlation compares raw bytes instead.
+func (h *Handler) CompareSignals(c echo.Context) error {
+	var req SignalCompareRequest
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid request")
+	}
+	if req.ResampleTo < 0 || req.ResampleTo == 1 || req.ResampleTo > maxDecodeValues {
+		return apiError(c, http.StatusBadRequest, ErrCodeOutOfRange, fmt.Sprintf("resample_to must be between 2 and %d", maxDecodeValues))
+	}
+
+	a, status, apiErr := h.decodeSignal("a", req.A)
+	if apiErr != nil {
+		return c.JSON(status, apiErr)
+	}
+	b, status, apiErr := h.decodeSignal("b", req.B)
+	if apiErr != nil {
+		return c.JSON(status, apiErr)
+	}
+	if len(a) < 2 || len(b) < 2 {
+		return apiError(c, http.StatusBadRequest, ErrCodeOutOfRange, "each signal needs at least 2 samples")
+	}
+
+	resp := SignalCompareResponse{SamplesA: len(a), SamplesB: len(b)}
+	if req.ResampleTo > 0 {
+		a, b = resampleLinear(a, req.ResampleTo), resampleLinear(b, req.ResampleTo)
+		resp.Resampled = true
+	} else {
+		n := min(len(a), len(b))
+		a, b = a[:n], b[:n]
+	}
+	resp.Compared = len(a)
+	resp.Correlation = pearson(a, b)
+	resp.RMSE = rmse(a, b)
+	return c.JSON(http.StatusOK, resp)
+}
+
+// decodeSignal runs a SignalSource through the decode pipeline. name
+// prefixes error messages so the caller knows which signal failed.
+func (h *Handler) decodeSignal(name string, src SignalSource) ([]float64, int, *APIError) {
+	data, status, apiErr := h.loadDecodeRegion(src.FileID, src.Offset, src.Length)
+	if apiErr != nil {
+		apiErr.Message = name + ": " + apiErr.Message
+		return nil, status, apiErr
+	}
+	stages := append([]DecodeStage{{Op: "read", Format: signalFormat(src)}}, src.Stages...)
+	values, _, apiErr := runDecodePipeline(data, stages)
+	if apiErr != nil {
+		apiErr.Message = name + ": " + apiErr.Message
+		return nil, http.StatusBadRequest, apiErr
+	}
+	return values, http.StatusOK, nil
+}
+
+// signalFormat is the read format of src, uint8 when unset
+func signalFormat(src SignalSource) string {
+	if src.Format == "" {
+		return "uint8"
+	}
+	return src.Format
+}
+
+// resampleLinear returns n samples spread evenly over values, first and last
+// included, interpolating linearly between neighbours
+func resampleLinear(values []float64, n int) []float64 {
+	out := make([]float64, n)
+	scale := float64(len(values)-1) / float64(n-1)
+	for i := range out {
+		pos := float64(i) * scale
+		lo := int(pos)
+		if lo >= len(values)-1 {
+			out[i] = values[len(values)-1]
+			continue
+		}
+		frac := pos - float64(lo)
+		out[i] = values[lo] + (values[lo+1]-values[lo])*frac
+	}
+	return out
+}
+
+// pearson returns the Pearson correlation of two equal-length signals, 0
+// when either is constant
+func pearson(a, b []float64) float64 {
+	n := float64(len(a))
+	var sumA, sumB float64
+	for i := range a {
+		sumA += a[i]
+		sumB += b[i]
+	}
+	meanA, meanB := sumA/n, sumB/n
+
+	var num, sqA, sqB float64
+	for i := range a {
+		da, db := a[i]-meanA, b[i]-meanB
+		num += da * db
+		sqA += da * da
+		sqB += db * db
+	}
+	if sqA == 0 || sqB == 0 {
+		return 0
+	}
+	return num / math.Sqrt(sqA*sqB)
+}
+
+// rmse returns the root mean square difference of two equal-length signals
+func rmse(a, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		d := a[i] - b[i]
+		sum += d * d
+	}
+	return math.Sqrt(sum / float64(len(a)))
+}
+
+// Lag search limits: the cost is lags × samples
+const (
+	defaultMaxLag    = 1024
+	maxLagLimit      = 16384
+	maxLagSamples    = 1 << 16
+	minLagOverlapPct = 50
+)
+
+// LagRequest looks for the shift that best aligns two signals, trying every
+// lag between -MaxLag and MaxLag samples
+type LagRequest struct {
+	A      SignalSource `json:"a"`
+	B      SignalSource `json:"b"`
+	MaxLag int          `json:"max_lag,omitempty"` // default 1024
+}
+
+// LagResponse holds the best alignment. A positive Lag means b is late:
+// sample i of a matches sample i+Lag of b. OffsetA and OffsetB are the file
+// offsets where the aligned signals start, to diff the files from there.
+type LagResponse struct {
+	Lag         int     `json:"lag"` // in samples; bytes for raw bytes
+	Correlation float64 `json:"correlation"`
+	Overlap     int     `json:"overlap"` // samples compared at that lag
+	OffsetA     int     `json:"offset_a"`
+	OffsetB     int     `json:"offset_b"`
+}
+
+// FindLag cross-correlates two byte streams, or signals decoded from them,
+// and returns the lag with the highest correlation, so two recordings that
+// start at different offsets can be aligned. Lags are only tried while the
+// signals overlap by at least half of the shorter one, so a short overlap
+// can't correlate by chance.
+func (h *Handler) FindLag(c echo.Context) error {
+	var req LagRequest
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid request")
+	}
+	if req.MaxLag == 0 {
+		req.MaxLag = defaultMaxLag
+	}
+	if req.MaxLag < 0 || req.MaxLag > maxLagLimit {
+		return apiError(c, http.StatusBadRequest, ErrCodeOutOfRange, fmt.Sprintf("max_lag must be between 1 and %d", maxLagLimit))
+	}
+
+	a, status, apiErr := h.decodeSignal("a", req.A)
+	if apiErr != nil {
+		return c.JSON(status, apiErr)
+	}
+	b, status, apiErr := h.decodeSignal("b", req.B)
+	if apiErr != nil {
+		return c.JSON(status, apiErr)
+	}
+	if len(a) > maxLagSamples || len(b) > maxLagSamples {
+		return apiErrorDetails(c, http.StatusBadRequest, ErrCodeOutOfRange,
+			fmt.Sprintf("lag search takes at most %d samples per signal, narrow the length", maxLagSamples),
+			map[string]any{"samples_a": len(a), "samples_b": len(b)})
+	}
+	minOverlap := max(2, min(len(a), len(b))*minLagOverlapPct/100)
+	if min(len(a), len(b)) < minOverlap {
+		return apiError(c, http.StatusBadRequest, ErrCodeOutOfRange, "each signal needs at least 2 samples")
+	}
+
+	lag, corr, overlap := bestLag(a, b, req.MaxLag, minOverlap)
+	resp := LagResponse{Lag: lag, Correlation: corr, Overlap: overlap, OffsetA: req.A.Offset, OffsetB: req.B.Offset}
+	if lag > 0 {
+		resp.OffsetB += lag * sequenceDecoders[signalFormat(req.B)].size
+	} else {
+		resp.OffsetA -= lag * sequenceDecoders[signalFormat(req.A)].size
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// bestLag returns the lag in [-maxLag, maxLag] where a[i] and b[i+lag]
+// correlate best over an overlap of at least minOverlap samples. Ties go to
+// the smallest shift.
+func bestLag(a, b []float64, maxLag, minOverlap int) (lag int, corr float64, overlap int) {
+	corr = math.Inf(-1)
+	for l := 0; l <= maxLag; l++ {
+		for _, candidate := range []int{l, -l} {
+			if candidate == -l && l == 0 {
+				continue
+			}
+			startA, startB := max(0, -candidate), max(0, candidate)
+			n := min(len(a)-startA, len(b)-startB)
+			if n < minOverlap {
+				continue
+			}
+			if r := pearson(a[startA:startA+n], b[startB:startB+n]); r > corr {
+				lag, corr, overlap = candidate, r, n
+			}
+		}
+	}
+	if math.IsInf(corr, -1) {
+		corr = 0
+	}
+	return lag, corr, overlap
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"encoding/binary"
+	"math"
+	"net/http"
+	"testing"
+)
+
+// TestCompareSignalsEndianness decodes the same ramp stored as int16le in one
+// file and int16be, after a header, in the other: byte for byte the files
+// differ, as signals they are identical
+func TestCompareSignalsEndianness(t *testing.T) {
+	h := newTestHandler(t)
+
+	var le, be []byte
+	be = append(be, "HDR1"...)
+	for i := 0; i < 200; i++ {
+		v := uint16(int16(i*37 - 3000))
+		le = binary.LittleEndian.AppendUint16(le, v)
+		be = binary.BigEndian.AppendUint16(be, v)
+	}
+	fileA := createTestFile(t, h, "ramp-le.bin", le)
+	fileB := createTestFile(t, h, "ramp-be.bin", be)
+
+	compare := func(body map[string]interface{}) SignalCompareResponse {
+		t.Helper()
+		c, rec := newJSONContext(http.MethodPost, "/compare/signals", body)
+		if err := h.CompareSignals(c); err != nil {
+			t.Fatal(err)
+		}
+		var resp SignalCompareResponse
+		decodeJSON(t, rec, http.StatusOK, &resp)
+		return resp
+	}
+
+	resp := compare(map[string]interface{}{
+		"a": map[string]interface{}{"file_id": fileA.ID, "format": "int16le"},
+		"b": map[string]interface{}{"file_id": fileB.ID, "offset": 4, "format": "int16be"},
+	})
+	if resp.Compared != 200 || resp.Correlation < 0.999 || resp.RMSE != 0 {
+		t.Errorf("got %+v, want 200 samples compared, correlation 1 and rmse 0", resp)
+	}
+
+	// Half the samples of b, resampled to a common length, still follow a
+	// with only a different gain and offset
+	resp = compare(map[string]interface{}{
+		"a": map[string]interface{}{"file_id": fileA.ID, "format": "int16le"},
+		"b": map[string]interface{}{"file_id": fileB.ID, "offset": 4, "length": 200, "format": "int16be",
+			"stages": []map[string]interface{}{{"op": "scale", "gain": 0.01}}},
+		"resample_to": 50,
+	})
+	if !resp.Resampled || resp.SamplesB != 100 || resp.Compared != 50 || math.Abs(resp.Correlation-1) > 1e-9 {
+		t.Errorf("resampled: got %+v", resp)
+	}
+
+	// Decoded as the wrong byte order, the ramp becomes noise
+	resp = compare(map[string]interface{}{
+		"a": map[string]interface{}{"file_id": fileA.ID, "format": "int16le"},
+		"b": map[string]interface{}{"file_id": fileB.ID, "offset": 4, "format": "int16le"},
+	})
+	if resp.Correlation > 0.9 {
+		t.Errorf("wrong byte order: correlation %v, want low", resp.Correlation)
+	}
+
+	c, rec := newJSONContext(http.MethodPost, "/compare/signals", map[string]interface{}{
+		"a": map[string]interface{}{"file_id": fileA.ID, "format": "int16le"},
+		"b": map[string]interface{}{"file_id": fileB.ID, "format": "int24le"},
+	})
+	if err := h.CompareSignals(c); err != nil {
+		t.Fatal(err)
+	}
+	var apiErr APIError
+	decodeJSON(t, rec, http.StatusBadRequest, &apiErr)
+	if apiErr.Code != ErrCodeUnsupported || apiErr.Message[:3] != "b: " {
+		t.Errorf("unsupported format: got %+v", apiErr)
+	}
+}
+
+// TestFindLag finds the shift between a file and a copy with extra leading
+// bytes, in raw bytes and in decoded samples
+func TestFindLag(t *testing.T) {
+	h := newTestHandler(t)
+
+	// A pseudo-random walk, so only the true shift lines the streams up
+	data := make([]byte, 2000)
+	x := uint32(12345)
+	v := 128
+	for i := range data {
+		x = x*1103515245 + 12345
+		v += int(x>>16)%9 - 4
+		data[i] = byte(v)
+	}
+	const shift = 37
+	shifted := append(make([]byte, shift), data...)
+	original := createTestFile(t, h, "rec1.bin", data)
+	copied := createTestFile(t, h, "rec2.bin", shifted)
+
+	findLag := func(body map[string]interface{}) LagResponse {
+		t.Helper()
+		c, rec := newJSONContext(http.MethodPost, "/compare/lag", body)
+		if err := h.FindLag(c); err != nil {
+			t.Fatal(err)
+		}
+		var resp LagResponse
+		decodeJSON(t, rec, http.StatusOK, &resp)
+		return resp
+	}
+
+	resp := findLag(map[string]interface{}{
+		"a":       map[string]interface{}{"file_id": original.ID},
+		"b":       map[string]interface{}{"file_id": copied.ID},
+		"max_lag": 100,
+	})
+	if resp.Lag != shift || resp.Correlation < 0.999 || resp.OffsetA != 0 || resp.OffsetB != shift {
+		t.Errorf("got %+v, want lag %d with offsets 0 and %d", resp, shift, shift)
+	}
+
+	// Swapped, a is the late one
+	resp = findLag(map[string]interface{}{
+		"a":       map[string]interface{}{"file_id": copied.ID},
+		"b":       map[string]interface{}{"file_id": original.ID},
+		"max_lag": 100,
+	})
+	if resp.Lag != -shift || resp.OffsetA != shift || resp.OffsetB != 0 {
+		t.Errorf("swapped: got %+v, want lag %d", resp, -shift)
+	}
+
+	// As uint16le samples from an even offset, the shift is in samples
+	resp = findLag(map[string]interface{}{
+		"a":       map[string]interface{}{"file_id": original.ID, "format": "uint16le"},
+		"b":       map[string]interface{}{"file_id": copied.ID, "offset": 1, "format": "uint16le"},
+		"max_lag": 100,
+	})
+	if resp.Lag != (shift-1)/2 || resp.OffsetB != shift {
+		t.Errorf("uint16le: got %+v, want lag %d and offset_b %d", resp, (shift-1)/2, shift)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"math"
 	"net/http"
+	"sort"
 
 	"github.com/labstack/echo/v4"
 )
@@ -17,6 +18,10 @@ type BinaryDiffRequest struct {
 	File2ID    uint `json:"file2_id"`
 	ChunkSize  int  `json:"chunk_size"`  // Bytes per line (default 16)
 	MaxResults int  `json:"max_results"` // Max diff chunks to return (default 10000)
+	// IncludeDelta adds the AnalyzeDelta result, computed in the same pass
+	IncludeDelta    bool `json:"include_delta,omitempty"`
+	MinRegionSize   int  `json:"min_region_size,omitempty"`
+	MaxChangePoints int  `json:"max_change_points,omitempty"`
 }
 
 type DiffChunk struct {
@@ -31,6 +36,8 @@ type BinaryDiffResponse struct {
 	Chunks      []DiffChunk `json:"chunks"`
 	TotalChunks int         `json:"total_chunks"`
 	Truncated   bool        `json:"truncated"`
+	// Delta is set with include_delta
+	Delta *DeltaAnalysisResponse `json:"delta,omitempty"`
 }
 
 func (h *Handler) CompareBinaryFiles(c echo.Context) error {
@@ -52,106 +59,33 @@ func (h *Handler) CompareBinaryFiles(c echo.Context) error {
 
 	// Fetch files
 	var file1, file2 models.File
-	if err := h.db.GormDB.First(&file1, req.File1ID).Error; err != nil {
+	if err := h.files.load(h.db.GormDB, &file1, req.File1ID); err != nil {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "File 1 not found"})
 	}
-	if err := h.db.GormDB.First(&file2, req.File2ID).Error; err != nil {
+	if err := h.files.load(h.db.GormDB, &file2, req.File2ID); err != nil {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "File 2 not found"})
 	}
 
-	// Calculate diff
-	chunks := []DiffChunk{}
-	offset := 0
-	maxLen := len(file1.Data)
-	if len(file2.Data) > maxLen {
-		maxLen = len(file2.Data)
+	opts := diffOptions{
+		End:       max(len(file1.Data), len(file2.Data)),
+		LineSize:  req.ChunkSize,
+		MaxChunks: req.MaxResults,
 	}
-
-	totalChunks := 0
-	truncated := false
-
-	for offset < maxLen {
-		if len(chunks) >= req.MaxResults {
-			truncated = true
-			break
-		}
-
-		end1 := offset + req.ChunkSize
-		if end1 > len(file1.Data) {
-			end1 = len(file1.Data)
-		}
-		end2 := offset + req.ChunkSize
-		if end2 > len(file2.Data) {
-			end2 = len(file2.Data)
-		}
-
-		bytes1 := []uint8{}
-		bytes2 := []uint8{}
-		if offset < len(file1.Data) {
-			bytes1 = file1.Data[offset:end1]
-		}
-		if offset < len(file2.Data) {
-			bytes2 = file2.Data[offset:end2]
-		}
-
-		// Determine diff type
-		diffType := "equal"
-		diffMask := []bool{}
-
-		if len(bytes1) == 0 && len(bytes2) > 0 {
-			diffType = "added"
-		} else if len(bytes1) > 0 && len(bytes2) == 0 {
-			diffType = "removed"
-		} else if len(bytes1) > 0 && len(bytes2) > 0 {
-			// Check for modifications
-			hasModification := false
-			maxChunkLen := len(bytes1)
-			if len(bytes2) > maxChunkLen {
-				maxChunkLen = len(bytes2)
-			}
-
-			for i := 0; i < maxChunkLen; i++ {
-				b1 := uint8(0)
-				b2 := uint8(0)
-				if i < len(bytes1) {
-					b1 = bytes1[i]
-				}
-				if i < len(bytes2) {
-					b2 = bytes2[i]
-				}
-				differs := b1 != b2
-				diffMask = append(diffMask, differs)
-				if differs {
-					hasModification = true
-				}
-			}
-
-			if hasModification {
-				diffType = "modified"
-			}
-		}
-
-		// Only include chunks that have differences
-		if diffType != "equal" {
-			chunk := DiffChunk{
-				Offset:   offset,
-				Type:     diffType,
-				Bytes1:   bytes1,
-				Bytes2:   bytes2,
-				DiffMask: diffMask,
-			}
-			chunks = append(chunks, chunk)
-		}
-
-		totalChunks++
-		offset += req.ChunkSize
+	if req.IncludeDelta {
+		opts.Delta = true
+		opts.MinRegionSize, opts.MaxChangePoints = deltaDefaults(req.MinRegionSize, req.MaxChangePoints)
 	}
+	diff := diffBytes(file1.Data, file2.Data, opts)
 
-	return c.JSON(http.StatusOK, BinaryDiffResponse{
-		Chunks:      chunks,
-		TotalChunks: totalChunks,
-		Truncated:   truncated,
-	})
+	resp := BinaryDiffResponse{
+		Chunks:      diff.Chunks,
+		TotalChunks: diff.TotalChunks,
+		Truncated:   diff.Truncated,
+	}
+	if req.IncludeDelta {
+		resp.Delta = &diff.Delta
+	}
+	return c.JSON(http.StatusOK, resp)
 }
 
 // ========== Delta Analysis API ==========
@@ -202,118 +136,35 @@ func (h *Handler) AnalyzeDelta(c echo.Context) error {
 	if req.File1ID == 0 || req.File2ID == 0 {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Both file IDs required"})
 	}
-	if req.MinRegionSize <= 0 {
-		req.MinRegionSize = 4
-	}
-	if req.MaxChangePoints <= 0 {
-		req.MaxChangePoints = 1000
-	}
+	req.MinRegionSize, req.MaxChangePoints = deltaDefaults(req.MinRegionSize, req.MaxChangePoints)
 
 	// Fetch files
 	var file1, file2 models.File
-	if err := h.db.GormDB.First(&file1, req.File1ID).Error; err != nil {
+	if err := h.files.load(h.db.GormDB, &file1, req.File1ID); err != nil {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "File 1 not found"})
 	}
-	if err := h.db.GormDB.First(&file2, req.File2ID).Error; err != nil {
+	if err := h.files.load(h.db.GormDB, &file2, req.File2ID); err != nil {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "File 2 not found"})
 	}
 
-	// Calculate stats
-	maxLen := len(file1.Data)
-	if len(file2.Data) > maxLen {
-		maxLen = len(file2.Data)
-	}
-
-	changedBytes := 0
-	unchangedBytes := 0
-	longestUnchanged := 0
-	currentUnchanged := 0
-	changes := []ByteChange{}
-	regions := []ChangedRegion{}
-	inRegion := false
-	regionStart := 0
-
-	for i := 0; i < maxLen; i++ {
-		b1 := uint8(0)
-		b2 := uint8(0)
-		if i < len(file1.Data) {
-			b1 = file1.Data[i]
-		}
-		if i < len(file2.Data) {
-			b2 = file2.Data[i]
-		}
-
-		if b1 != b2 {
-			changedBytes++
-			currentUnchanged = 0
-
-			// Track individual changes
-			if len(changes) < req.MaxChangePoints {
-				changes = append(changes, ByteChange{
-					Offset: i,
-					Old:    b1,
-					New:    b2,
-				})
-			}
-
-			// Track regions
-			if !inRegion {
-				inRegion = true
-				regionStart = i
-			}
-		} else {
-			unchangedBytes++
-			currentUnchanged++
-			if currentUnchanged > longestUnchanged {
-				longestUnchanged = currentUnchanged
-			}
-
-			// End region if long enough unchanged sequence
-			if inRegion && currentUnchanged >= req.MinRegionSize {
-				regionEnd := i - req.MinRegionSize
-				if regionEnd > regionStart {
-					regions = append(regions, ChangedRegion{
-						Start:  regionStart,
-						End:    regionEnd,
-						Length: regionEnd - regionStart,
-					})
-				}
-				inRegion = false
-			}
-		}
-	}
-
-	// Close final region
-	if inRegion {
-		regions = append(regions, ChangedRegion{
-			Start:  regionStart,
-			End:    maxLen,
-			Length: maxLen - regionStart,
-		})
-	}
+	diff := diffBytes(file1.Data, file2.Data, diffOptions{
+		End:             max(len(file1.Data), len(file2.Data)),
+		Delta:           true,
+		MinRegionSize:   req.MinRegionSize,
+		MaxChangePoints: req.MaxChangePoints,
+	})
+	return c.JSON(http.StatusOK, diff.Delta)
+}
 
-	percentChanged := 0.0
-	if maxLen > 0 {
-		percentChanged = float64(changedBytes) / float64(maxLen) * 100
+// deltaDefaults applies the defaults of DeltaAnalysisRequest
+func deltaDefaults(minRegionSize, maxChangePoints int) (int, int) {
+	if minRegionSize <= 0 {
+		minRegionSize = 4
 	}
-
-	stats := DiffStats{
-		TotalBytes:       maxLen,
-		ChangedBytes:     changedBytes,
-		UnchangedBytes:   unchangedBytes,
-		PercentChanged:   percentChanged,
-		File1Size:        len(file1.Data),
-		File2Size:        len(file2.Data),
-		SizeDifference:   len(file2.Data) - len(file1.Data),
-		ChangedRegions:   len(regions),
-		LongestUnchanged: longestUnchanged,
+	if maxChangePoints <= 0 {
+		maxChangePoints = 1000
 	}
-
-	return c.JSON(http.StatusOK, DeltaAnalysisResponse{
-		Stats:   stats,
-		Changes: changes,
-		Regions: regions,
-	})
+	return minRegionSize, maxChangePoints
 }
 
 // ========== Pattern Correlation API ==========
@@ -356,10 +207,10 @@ func (h *Handler) CalculatePatternCorrelation(c echo.Context) error {
 
 	// Fetch files
 	var file1, file2 models.File
-	if err := h.db.GormDB.First(&file1, req.File1ID).Error; err != nil {
+	if err := h.files.load(h.db.GormDB, &file1, req.File1ID); err != nil {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "File 1 not found"})
 	}
-	if err := h.db.GormDB.First(&file2, req.File2ID).Error; err != nil {
+	if err := h.files.load(h.db.GormDB, &file2, req.File2ID); err != nil {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "File 2 not found"})
 	}
 
@@ -494,10 +345,10 @@ func (h *Handler) StreamingCompare(c echo.Context) error {
 
 	// Fetch files (only metadata, data loaded on-demand)
 	var file1, file2 models.File
-	if err := h.db.GormDB.First(&file1, req.File1ID).Error; err != nil {
+	if err := h.files.load(h.db.GormDB, &file1, req.File1ID); err != nil {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "File 1 not found"})
 	}
-	if err := h.db.GormDB.First(&file2, req.File2ID).Error; err != nil {
+	if err := h.files.load(h.db.GormDB, &file2, req.File2ID); err != nil {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "File 2 not found"})
 	}
 
@@ -512,79 +363,18 @@ func (h *Handler) StreamingCompare(c echo.Context) error {
 		endOffset = maxLen
 	}
 
-	// Extract chunks for comparison (using 16-byte line size)
-	lineSize := 16
-	chunks := []DiffChunk{}
-
-	for offset := req.Offset; offset < endOffset; offset += lineSize {
-		end1 := offset + lineSize
-		if end1 > len(file1.Data) {
-			end1 = len(file1.Data)
-		}
-		end2 := offset + lineSize
-		if end2 > len(file2.Data) {
-			end2 = len(file2.Data)
-		}
-
-		bytes1 := []uint8{}
-		bytes2 := []uint8{}
-		if offset < len(file1.Data) {
-			bytes1 = file1.Data[offset:end1]
-		}
-		if offset < len(file2.Data) {
-			bytes2 = file2.Data[offset:end2]
-		}
-
-		// Determine diff type
-		diffType := "equal"
-		diffMask := []bool{}
-
-		if len(bytes1) == 0 && len(bytes2) > 0 {
-			diffType = "added"
-		} else if len(bytes1) > 0 && len(bytes2) == 0 {
-			diffType = "removed"
-		} else if len(bytes1) > 0 && len(bytes2) > 0 {
-			hasModification := false
-			maxChunkLen := len(bytes1)
-			if len(bytes2) > maxChunkLen {
-				maxChunkLen = len(bytes2)
-			}
-
-			for i := 0; i < maxChunkLen; i++ {
-				b1 := uint8(0)
-				b2 := uint8(0)
-				if i < len(bytes1) {
-					b1 = bytes1[i]
-				}
-				if i < len(bytes2) {
-					b2 = bytes2[i]
-				}
-				differs := b1 != b2
-				diffMask = append(diffMask, differs)
-				if differs {
-					hasModification = true
-				}
-			}
-
-			if hasModification {
-				diffType = "modified"
-			}
-		}
-
-		chunk := DiffChunk{
-			Offset:   offset,
-			Type:     diffType,
-			Bytes1:   bytes1,
-			Bytes2:   bytes2,
-			DiffMask: diffMask,
-		}
-		chunks = append(chunks, chunk)
-	}
+	// Compare in 16-byte lines, equal ones included
+	diff := diffBytes(file1.Data, file2.Data, diffOptions{
+		Start:     req.Offset,
+		End:       endOffset,
+		LineSize:  16,
+		KeepEqual: true,
+	})
 
 	hasMore := endOffset < maxLen
 
 	return c.JSON(http.StatusOK, StreamingDiffResponse{
-		Chunks:     chunks,
+		Chunks:     diff.Chunks,
 		NextOffset: endOffset,
 		HasMore:    hasMore,
 		File1Size:  len(file1.Data),
@@ -675,7 +465,7 @@ func (h *Handler) CompareMultipleFiles(c echo.Context) error {
 	fileSizes := make([]int, len(req.FileIDs))
 
 	for i, fileID := range req.FileIDs {
-		if err := h.db.GormDB.First(&files[i], fileID).Error; err != nil {
+		if err := h.files.load(h.db.GormDB, &files[i], fileID); err != nil {
 			return c.JSON(http.StatusNotFound, map[string]string{
 				"error": fmt.Sprintf("File not found with ID: %d", fileID),
 			})
@@ -812,6 +602,129 @@ func (h *Handler) CompareMultipleFiles(c echo.Context) error {
 	})
 }
 
+// ========== N-Way Byte Agreement API ==========
+
+// maxNWayBytes caps the per-offset window of an N-way comparison
+const maxNWayBytes = 64 * 1024
+
+// NWayCompareRequest selects the files and the window [offset, offset+length) to compare
+type NWayCompareRequest struct {
+	FileIDs []uint `json:"file_ids"` // Minimum 2 files
+	Offset  int    `json:"offset"`
+	Length  int    `json:"length"` // Default: up to the shortest file, capped at 64 KiB
+}
+
+// NWayByte reports one offset: whether all files agree and the distinct values seen
+type NWayByte struct {
+	Offset int   `json:"offset"`
+	Agree  bool  `json:"agree"`
+	Values []int `json:"values"` // Sorted distinct byte values
+}
+
+// NWayRun is a stretch of offsets that all agree (structure) or all vary (data)
+type NWayRun struct {
+	Offset int  `json:"offset"`
+	Length int  `json:"length"`
+	Agree  bool `json:"agree"`
+}
+
+// NWayCompareResponse holds the per-offset agreement map of the window
+type NWayCompareResponse struct {
+	FileNames   []string   `json:"file_names"`
+	MinFileSize int        `json:"min_file_size"`
+	Offset      int        `json:"offset"`
+	Length      int        `json:"length"`
+	Bytes       []NWayByte `json:"bytes"`
+	Runs        []NWayRun  `json:"runs"`
+	AgreeCount  int        `json:"agree_count"`
+	VaryCount   int        `json:"vary_count"`
+	Truncated   bool       `json:"truncated"` // The window was cut at maxNWayBytes
+}
+
+// CompareNWay maps, offset by offset, which bytes are constant across all files
+// (fixed headers, structure) and which vary (per-sample payload)
+func (h *Handler) CompareNWay(c echo.Context) error {
+	var req NWayCompareRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	if len(req.FileIDs) < 2 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Minimum 2 files required"})
+	}
+	if req.Offset < 0 || req.Length < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "offset and length must not be negative"})
+	}
+
+	files := make([]models.File, len(req.FileIDs))
+	fileNames := make([]string, len(req.FileIDs))
+	minSize := -1
+	for i, fileID := range req.FileIDs {
+		if err := h.files.load(h.db.GormDB, &files[i], fileID); err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{
+				"error": fmt.Sprintf("File not found with ID: %d", fileID),
+			})
+		}
+		fileNames[i] = files[i].Name
+		if minSize < 0 || len(files[i].Data) < minSize {
+			minSize = len(files[i].Data)
+		}
+	}
+	if req.Offset > minSize {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": fmt.Sprintf("offset %d is past the end of the shortest file (%d bytes)", req.Offset, minSize),
+		})
+	}
+
+	end := minSize
+	if req.Length > 0 && req.Length < end-req.Offset {
+		end = req.Offset + req.Length
+	}
+	truncated := false
+	if end-req.Offset > maxNWayBytes {
+		end = req.Offset + maxNWayBytes
+		truncated = true
+	}
+
+	resp := NWayCompareResponse{
+		FileNames:   fileNames,
+		MinFileSize: minSize,
+		Offset:      req.Offset,
+		Length:      end - req.Offset,
+		Bytes:       make([]NWayByte, 0, end-req.Offset),
+		Runs:        []NWayRun{},
+		Truncated:   truncated,
+	}
+
+	for offset := req.Offset; offset < end; offset++ {
+		var seen [256]bool
+		var values []int
+		for _, f := range files {
+			b := f.Data[offset]
+			if !seen[b] {
+				seen[b] = true
+				values = append(values, int(b))
+			}
+		}
+		sort.Ints(values)
+		agree := len(values) == 1
+
+		resp.Bytes = append(resp.Bytes, NWayByte{Offset: offset, Agree: agree, Values: values})
+		if agree {
+			resp.AgreeCount++
+		} else {
+			resp.VaryCount++
+		}
+
+		if n := len(resp.Runs); n > 0 && resp.Runs[n-1].Agree == agree {
+			resp.Runs[n-1].Length++
+		} else {
+			resp.Runs = append(resp.Runs, NWayRun{Offset: offset, Length: 1, Agree: agree})
+		}
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
 // GenerateMultiFileDiffYamlRequest represents a request to generate YAML
 type GenerateMultiFileDiffYamlRequest struct {
 	FileIDs       []uint         `json:"file_ids"`
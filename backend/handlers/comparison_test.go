@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// TestCompareNWayConstantPrefix marks a prefix shared by all files as agreeing
+func TestCompareNWayConstantPrefix(t *testing.T) {
+	h := newTestHandler(t)
+	header := []byte{0x45, 0x43, 0x47, 0x01} // "ECG" v1
+	a := createTestFile(t, h, "a.bin", append(append([]byte{}, header...), 0x10, 0x20, 0x30))
+	b := createTestFile(t, h, "b.bin", append(append([]byte{}, header...), 0x11, 0x20, 0x31, 0xFF))
+	c3 := createTestFile(t, h, "c.bin", append(append([]byte{}, header...), 0x12, 0x20, 0x30))
+
+	c, rec := newJSONContext(http.MethodPost, "/compare/nway", NWayCompareRequest{FileIDs: []uint{a.ID, b.ID, c3.ID}})
+	if err := h.CompareNWay(c); err != nil {
+		t.Fatal(err)
+	}
+	var resp NWayCompareResponse
+	decodeJSON(t, rec, http.StatusOK, &resp)
+
+	if resp.Length != 7 || len(resp.Bytes) != 7 {
+		t.Fatalf("compared %d bytes, want 7 (the shortest file)", resp.Length)
+	}
+	for i := range header {
+		if !resp.Bytes[i].Agree || len(resp.Bytes[i].Values) != 1 || resp.Bytes[i].Values[0] != int(header[i]) {
+			t.Errorf("offset %d = %+v, want agree on 0x%02X", i, resp.Bytes[i], header[i])
+		}
+	}
+	if got := resp.Bytes[4]; got.Agree || len(got.Values) != 3 {
+		t.Errorf("offset 4 = %+v, want 3 distinct values", got)
+	}
+	if got := resp.Bytes[6]; got.Agree || len(got.Values) != 2 || got.Values[0] != 0x30 || got.Values[1] != 0x31 {
+		t.Errorf("offset 6 = %+v, want values [0x30 0x31]", got)
+	}
+
+	wantRuns := []NWayRun{
+		{Offset: 0, Length: 4, Agree: true},
+		{Offset: 4, Length: 1, Agree: false},
+		{Offset: 5, Length: 1, Agree: true},
+		{Offset: 6, Length: 1, Agree: false},
+	}
+	if len(resp.Runs) != len(wantRuns) {
+		t.Fatalf("runs = %+v, want %+v", resp.Runs, wantRuns)
+	}
+	for i := range wantRuns {
+		if resp.Runs[i] != wantRuns[i] {
+			t.Errorf("run %d = %+v, want %+v", i, resp.Runs[i], wantRuns[i])
+		}
+	}
+	if resp.AgreeCount != 5 || resp.VaryCount != 2 {
+		t.Errorf("agree/vary = %d/%d, want 5/2", resp.AgreeCount, resp.VaryCount)
+	}
+}
+
+// TestDiffEndpointsAgree checks the diff, delta and streaming comparisons,
+// which share diffBytes, report the same differences, and that include_delta
+// returns what AnalyzeDelta does
+func TestDiffEndpointsAgree(t *testing.T) {
+	h := newTestHandler(t)
+	d1 := []byte{0, 0, 0, 0, 0, 0, 0, 0}
+	d2 := []byte{0, 1, 0, 0, 0, 1, 1, 0, 7}
+	for i := range 100 { // and a longer tail, past several lines
+		d1 = append(d1, byte(i))
+		d2 = append(d2, byte(i)^byte(i%7/6))
+	}
+	a := createTestFile(t, h, "a.bin", d1)
+	b := createTestFile(t, h, "b.bin", d2)
+
+	c, rec := newJSONContext(http.MethodPost, "/compare/diff", BinaryDiffRequest{File1ID: a.ID, File2ID: b.ID})
+	if err := h.CompareBinaryFiles(c); err != nil {
+		t.Fatal(err)
+	}
+	var diff BinaryDiffResponse
+	decodeJSON(t, rec, http.StatusOK, &diff)
+
+	c, rec = newJSONContext(http.MethodPost, "/compare/delta", DeltaAnalysisRequest{File1ID: a.ID, File2ID: b.ID, MinRegionSize: 2})
+	if err := h.AnalyzeDelta(c); err != nil {
+		t.Fatal(err)
+	}
+	var delta DeltaAnalysisResponse
+	decodeJSON(t, rec, http.StatusOK, &delta)
+
+	c, rec = newJSONContext(http.MethodPost, "/compare/diff", BinaryDiffRequest{File1ID: a.ID, File2ID: b.ID, IncludeDelta: true, MinRegionSize: 2})
+	if err := h.CompareBinaryFiles(c); err != nil {
+		t.Fatal(err)
+	}
+	var both BinaryDiffResponse
+	decodeJSON(t, rec, http.StatusOK, &both)
+
+	if both.Delta == nil || !reflect.DeepEqual(*both.Delta, delta) {
+		t.Errorf("include_delta = %+v, want the AnalyzeDelta result %+v", both.Delta, delta)
+	}
+	both.Delta = nil
+	if !reflect.DeepEqual(both, diff) {
+		t.Errorf("chunks with include_delta differ from the plain diff")
+	}
+
+	// Every modified line of the diff holds the delta's byte changes
+	changed := 0
+	for _, chunk := range diff.Chunks {
+		for _, differs := range chunk.DiffMask {
+			if differs {
+				changed++
+			}
+		}
+		if chunk.Type == "added" || chunk.Type == "removed" {
+			changed += max(len(chunk.Bytes1), len(chunk.Bytes2))
+		}
+	}
+	if changed != delta.Stats.ChangedBytes || changed != len(delta.Changes) {
+		t.Errorf("diff marks %d changed bytes, delta reports %d (%d changes)", changed, delta.Stats.ChangedBytes, len(delta.Changes))
+	}
+	if delta.Stats.TotalBytes != len(d2) || delta.Stats.ChangedBytes+delta.Stats.UnchangedBytes != len(d2) {
+		t.Errorf("stats = %+v, want %d bytes compared", delta.Stats, len(d2))
+	}
+	if first := delta.Changes[:4]; !reflect.DeepEqual(first, []ByteChange{{1, 0, 1}, {5, 0, 1}, {6, 0, 1}, {8, 0, 7}}) {
+		t.Errorf("first changes = %+v", first)
+	}
+
+	// Streaming it page by page gives the same lines
+	var streamed []DiffChunk
+	for offset, more := 0, true; more; {
+		c, rec = newJSONContext(http.MethodPost, "/compare/stream", StreamingDiffRequest{File1ID: a.ID, File2ID: b.ID, ChunkSize: 48, Offset: offset})
+		if err := h.StreamingCompare(c); err != nil {
+			t.Fatal(err)
+		}
+		var page StreamingDiffResponse
+		decodeJSON(t, rec, http.StatusOK, &page)
+		for _, chunk := range page.Chunks {
+			if chunk.Type != "equal" {
+				streamed = append(streamed, chunk)
+			}
+		}
+		offset, more = page.NextOffset, page.HasMore
+	}
+	if !reflect.DeepEqual(streamed, diff.Chunks) {
+		t.Errorf("streamed %d differing lines, diff has %d", len(streamed), len(diff.Chunks))
+	}
+}
+
+// TestCompareNWayHugeLength checks a length that would overflow
+// offset+length compares to the end of the files instead of panicking
+func TestCompareNWayHugeLength(t *testing.T) {
+	h := newTestHandler(t)
+	a := createTestFile(t, h, "a.bin", make([]byte, 64))
+	b := createTestFile(t, h, "b.bin", make([]byte, 64))
+
+	c, rec := newJSONContext(http.MethodPost, "/compare/nway", NWayCompareRequest{FileIDs: []uint{a.ID, b.ID}, Offset: 1, Length: math.MaxInt})
+	if err := h.CompareNWay(c); err != nil {
+		t.Fatal(err)
+	}
+	var resp NWayCompareResponse
+	decodeJSON(t, rec, http.StatusOK, &resp)
+	if resp.Length != 63 {
+		t.Errorf("compared %d bytes, want 63", resp.Length)
+	}
+}
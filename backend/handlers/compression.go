@@ -1,7 +1,11 @@
 package handlers
 
 import (
+	"binary-annotator-pro/logging"
+	"binary-annotator-pro/metrics"
 	"binary-annotator-pro/models"
+	"context"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -9,18 +13,59 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/labstack/echo/v4"
 )
 
-// StartCompressionAnalysis triggers compression detection analysis on a file
+// compressionMethods lists every method name understood by compression_detector.py
+// (see get_algorithms). lz4/zstd/brotli/snappy are skipped by the script when
+// their Python modules aren't installed.
+var compressionMethods = map[string]bool{
+	"zlib": true, "gzip": true, "bz2": true, "lzma": true, "deflate": true,
+	"lz4": true, "zstd": true, "brotli": true, "snappy": true,
+	"rle": true, "delta": true, "delta_signed": true, "nibble_signed": true, "lzw": true,
+	"huffman": true, "huffman_standard": true, "huffman_canonical": true, "huffman_simple": true,
+	"lz77": true, "dpcm": true, "dpcm_average": true, "dpcm_linear": true, "rice": true, "vlq": true,
+	"wavelet_haar": true, "wavelet_haar_int16": true,
+	"ecg_leads": true, "ecg_leads_3lead": true, "ecg_leads_8lead": true,
+}
+
+// syncCompressionMaxBytes is the largest selection analysed inline with ?sync=true
+const syncCompressionMaxBytes = 64 * 1024
+
+// detectorInterpreter runs compression_detector.py
+const detectorInterpreter = "python3"
+
+// runDetector runs compression_detector.py and returns its combined output.
+// Replaced in tests.
+var runDetector = func(args []string) ([]byte, error) {
+	return exec.Command(detectorInterpreter, args...).CombinedOutput()
+}
+
+// StartCompressionRequest is the optional JSON body of StartCompressionAnalysis
+type StartCompressionRequest struct {
+	Methods []string `json:"methods"` // restrict the detector to these methods; all if empty
+}
+
+// StartCompressionAnalysis triggers compression detection analysis on a file.
+// With ?sync=true, selections up to syncCompressionMaxBytes are analysed inline
+// and the completed analysis is returned; larger ones start a background job.
 func (h *Handler) StartCompressionAnalysis(c echo.Context) error {
 	fileIDStr := c.Param("fileId")
 	fileID, err := strconv.ParseUint(fileIDStr, 10, 32)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "invalid file ID",
-		})
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid file ID")
+	}
+
+	var req StartCompressionRequest
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid request body")
+	}
+	for _, method := range req.Methods {
+		if !compressionMethods[method] {
+			return apiError(c, http.StatusBadRequest, ErrCodeUnsupported, fmt.Sprintf("unknown compression method: %s", method))
+		}
 	}
 
 	// Parse optional offset and length parameters for selective analysis
@@ -42,16 +87,24 @@ func (h *Handler) StartCompressionAnalysis(c echo.Context) error {
 	// Check if file exists
 	var file models.File
 	if err := h.db.GormDB.First(&file, fileID).Error; err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "file not found",
-		})
+		return apiError(c, http.StatusNotFound, ErrCodeFileNotFound, "file not found")
+	}
+
+	// Small selections can be analysed while the client waits
+	analysedSize := int64(len(file.Data))
+	if startOffset != nil {
+		analysedSize -= *startOffset
 	}
+	if length != nil && *length < analysedSize {
+		analysedSize = *length
+	}
+	sync := c.QueryParam("sync") == "true" && analysedSize <= syncCompressionMaxBytes
 
 	// Check if analysis already exists and is running
 	var existingAnalysis models.CompressionAnalysis
 	err = h.db.GormDB.Where("file_id = ? AND status IN ?", fileID, []string{"pending", "running"}).
 		First(&existingAnalysis).Error
-	if err == nil {
+	if err == nil && !sync {
 		// Analysis already running
 		return c.JSON(http.StatusOK, map[string]interface{}{
 			"message":     "analysis already running",
@@ -67,26 +120,57 @@ func (h *Handler) StartCompressionAnalysis(c echo.Context) error {
 		TotalTests:  0,
 		StartOffset: startOffset,
 		Length:      length,
+		Methods:     strings.Join(req.Methods, ","),
 	}
 
 	if err := h.db.GormDB.Create(&analysis).Error; err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "failed to create analysis record",
-		})
+		return apiError(c, http.StatusInternalServerError, ErrCodeInternal, "failed to create analysis record")
+	}
+
+	// The analysis outlives the request when it runs in the background, but
+	// keeps its request ID in the logs
+	ctx := logging.With(context.WithoutCancel(c.Request().Context()), "analysis_id", analysis.ID, "file_id", file.ID)
+
+	// Wait for a free detector slot, in line behind the analyses already queued
+	slot, ok := h.analyses.enqueue(analysis.ID)
+	if !ok {
+		h.db.GormDB.Unscoped().Delete(&analysis)
+		return apiErrorDetails(c, http.StatusTooManyRequests, ErrCodeBusy, "too many compression analyses queued, try again later",
+			map[string]any{"max_concurrent": h.analyses.maxRunning, "max_queued": h.analyses.maxQueued})
+	}
+	h.updateQueuePositions()
+
+	if sync {
+		h.runQueuedAnalysis(ctx, slot, file, startOffset, length, req.Methods)
+
+		if err := h.db.GormDB.Preload("Results").First(&analysis, analysis.ID).Error; err != nil {
+			return apiError(c, http.StatusInternalServerError, ErrCodeInternal, "failed to load analysis results")
+		}
+		return c.JSON(http.StatusOK, analysis)
 	}
 
 	// Trigger Python compression detector asynchronously
-	go h.runCompressionDetector(analysis.ID, file, startOffset, length)
+	go h.runQueuedAnalysis(ctx, slot, file, startOffset, length, req.Methods)
 
-	fmt.Printf("Created compression analysis %d for file %s\n", analysis.ID, file.Name)
+	logging.FromContext(ctx).Info("compression analysis created", "file_name", file.Name)
 
-	return c.JSON(http.StatusCreated, map[string]interface{}{
+	message := "Compression analysis started"
+	if c.QueryParam("sync") == "true" {
+		message = fmt.Sprintf("Selection is larger than %d bytes, analysis started in the background", syncCompressionMaxBytes)
+	}
+	resp := map[string]interface{}{
 		"analysis_id": analysis.ID,
 		"file_id":     fileID,
 		"file_name":   file.Name,
 		"status":      "pending",
-		"message":     "Compression analysis started",
-	})
+		"message":     message,
+	}
+	for i, id := range h.analyses.waiting() {
+		if id == analysis.ID {
+			resp["queue_position"] = i + 1
+		}
+	}
+	return c.JSON(http.StatusCreated, resp)
 }
 
 // GetCompressionAnalysis retrieves compression analysis results
@@ -94,17 +178,13 @@ func (h *Handler) GetCompressionAnalysis(c echo.Context) error {
 	analysisIDStr := c.Param("analysisId")
 	analysisID, err := strconv.ParseUint(analysisIDStr, 10, 32)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "invalid analysis ID",
-		})
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid analysis ID")
 	}
 
 	// Get analysis with results
 	var analysis models.CompressionAnalysis
 	if err := h.db.GormDB.Preload("Results").First(&analysis, analysisID).Error; err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "analysis not found",
-		})
+		return apiError(c, http.StatusNotFound, ErrCodeNotFound, "analysis not found")
 	}
 
 	return c.JSON(http.StatusOK, analysis)
@@ -115,9 +195,7 @@ func (h *Handler) GetFileCompressionAnalyses(c echo.Context) error {
 	fileIDStr := c.Param("fileId")
 	fileID, err := strconv.ParseUint(fileIDStr, 10, 32)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "invalid file ID",
-		})
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid file ID")
 	}
 
 	// Get all analyses for this file, ordered by creation date
@@ -126,9 +204,7 @@ func (h *Handler) GetFileCompressionAnalyses(c echo.Context) error {
 		Order("created_at DESC").
 		Preload("Results").
 		Find(&analyses).Error; err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "failed to fetch analyses",
-		})
+		return apiError(c, http.StatusInternalServerError, ErrCodeInternal, "failed to fetch analyses")
 	}
 
 	return c.JSON(http.StatusOK, analyses)
@@ -139,9 +215,7 @@ func (h *Handler) GetLatestCompressionAnalysis(c echo.Context) error {
 	fileIDStr := c.Param("fileId")
 	fileID, err := strconv.ParseUint(fileIDStr, 10, 32)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "invalid file ID",
-		})
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid file ID")
 	}
 
 	// Get latest analysis
@@ -150,9 +224,7 @@ func (h *Handler) GetLatestCompressionAnalysis(c echo.Context) error {
 		Order("created_at DESC").
 		Preload("Results").
 		First(&analysis).Error; err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "no analysis found for this file",
-		})
+		return apiError(c, http.StatusNotFound, ErrCodeNotFound, "no analysis found for this file")
 	}
 
 	return c.JSON(http.StatusOK, analysis)
@@ -163,68 +235,21 @@ func (h *Handler) DownloadDecompressedFile(c echo.Context) error {
 	resultIDStr := c.Param("resultId")
 	resultID, err := strconv.ParseUint(resultIDStr, 10, 32)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "invalid result ID",
-		})
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid result ID")
 	}
 
 	// Get result
 	var result models.CompressionResult
 	if err := h.db.GormDB.First(&result, resultID).Error; err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "result not found",
-		})
+		return apiError(c, http.StatusNotFound, ErrCodeNotFound, "result not found")
 	}
 
-	// Get analysis with file info
-	var analysis models.CompressionAnalysis
-	if err := h.db.GormDB.First(&analysis, result.AnalysisID).Error; err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "analysis not found",
-		})
-	}
-
-	// Get file info
-	var file models.File
-	if err := h.db.GormDB.First(&file, analysis.FileID).Error; err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "file not found",
-		})
-	}
-
-	var data []byte
-	var fileName string
-
-	// First try to get from database if DecompressedFileID exists
-	if result.DecompressedFileID != nil {
-		var decompressedFile models.DecompressedFile
-		if err := h.db.GormDB.First(&decompressedFile, *result.DecompressedFileID).Error; err == nil {
-			data = decompressedFile.Data
-			fileName = decompressedFile.FileName
-		}
-	}
-
-	// If not found in database, try to get from /tmp/decompressed/
-	if data == nil && file.Name != "" {
-		// Construct filename from original file and compression method
-		baseFileName := file.Name
-		if ext := filepath.Ext(baseFileName); ext != "" {
-			baseFileName = baseFileName[:len(baseFileName)-len(ext)]
-		}
-		tempFileName := fmt.Sprintf("/tmp/decompressed/%s.%s.decompressed", baseFileName, result.Method)
-
-		if fileData, err := os.ReadFile(tempFileName); err == nil {
-			data = fileData
-			fileName = fmt.Sprintf("%s.%s.decompressed", baseFileName, result.Method)
-		}
-	}
-
-	// If still no data found
-	if data == nil {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "decompressed file not found in database or /tmp/decompressed/",
-		})
+	decompressedFile, err := h.loadDecompressedFile(result)
+	if err != nil {
+		return apiError(c, http.StatusNotFound, ErrCodeNotFound, err.Error())
 	}
+	data := decompressedFile.Data
+	fileName := decompressedFile.FileName
 
 	// Set headers and return blob
 	c.Response().Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", fileName))
@@ -239,53 +264,23 @@ func (h *Handler) DeleteCompressionAnalysis(c echo.Context) error {
 	analysisIDStr := c.Param("analysisId")
 	analysisID, err := strconv.ParseUint(analysisIDStr, 10, 32)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "invalid analysis ID",
-		})
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid analysis ID")
 	}
 
 	// Get analysis info before deletion to get file ID
 	var analysis models.CompressionAnalysis
 	if err := h.db.GormDB.First(&analysis, analysisID).Error; err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "analysis not found",
-		})
-	}
-
-	// Get the associated file to extract filename
-	var file models.File
-	if err := h.db.GormDB.First(&file, analysis.FileID).Error; err == nil {
-		// Delete decompressed files from /tmp/decompressed/
-		if file.Name != "" {
-			// Extract filename without extension for pattern matching
-			fileName := file.Name
-			if ext := filepath.Ext(fileName); ext != "" {
-				fileName = fileName[:len(fileName)-len(ext)]
-			}
-
-			// Remove all decompressed files matching the pattern
-			pattern := fmt.Sprintf("/tmp/decompressed/%s.*.decompressed", fileName)
-			matches, _ := filepath.Glob(pattern)
-			for _, match := range matches {
-				if err := os.Remove(match); err != nil {
-					fmt.Printf("Warning: failed to remove decompressed file %s: %v\n", match, err)
-				}
-			}
-		}
+		return apiError(c, http.StatusNotFound, ErrCodeNotFound, "analysis not found")
 	}
 
 	// Delete all results first
 	if err := h.db.GormDB.Where("analysis_id = ?", analysisID).Delete(&models.CompressionResult{}).Error; err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "failed to delete results",
-		})
+		return apiError(c, http.StatusInternalServerError, ErrCodeInternal, "failed to delete results")
 	}
 
 	// Delete analysis
 	if err := h.db.GormDB.Delete(&models.CompressionAnalysis{}, analysisID).Error; err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "failed to delete analysis",
-		})
+		return apiError(c, http.StatusInternalServerError, ErrCodeInternal, "failed to delete analysis")
 	}
 
 	return c.JSON(http.StatusOK, map[string]string{
@@ -318,66 +313,69 @@ type PythonAnalysisReport struct {
 	BestRatio      float64                     `json:"best_ratio"`
 	BestConfidence float64                     `json:"best_confidence"`
 	Results        []PythonDecompressionResult `json:"results"`
+	Version        string                      `json:"detector_version"`
 }
 
 // runCompressionDetector executes Python compression detector asynchronously
-func (h *Handler) runCompressionDetector(analysisID uint, file models.File, startOffset *int64, length *int64) {
+func (h *Handler) runCompressionDetector(ctx context.Context, analysisID uint, file models.File, startOffset *int64, length *int64, methods []string) {
 	// Update status to running
 	h.db.GormDB.Model(&models.CompressionAnalysis{}).Where("id = ?", analysisID).
 		Updates(map[string]interface{}{
-			"status": "running",
+			"status":         "running",
+			"queue_position": 0,
 		})
+	h.publishAnalysisStatus(analysisID)
 
 	// Create temporary file for analysis
 	tmpFile := fmt.Sprintf("/tmp/binary_analysis_%d_%d.bin", file.ID, analysisID)
 	err := os.WriteFile(tmpFile, file.Data, 0644)
 	if err != nil {
-		h.updateAnalysisError(analysisID, fmt.Sprintf("Failed to create temp file: %v", err))
+		h.updateAnalysisError(ctx, analysisID, fmt.Sprintf("Failed to create temp file: %v", err))
 		return
 	}
 	defer os.Remove(tmpFile)
 
-	// Create temporary directory for decompressed files
-	tmpDir := "/tmp/decompressed"
-	err = os.MkdirAll(tmpDir, 0755)
+	// Each analysis gets its own output directory so files sharing a basename
+	// never overwrite each other's decompressed variants
+	outputDir, err := os.MkdirTemp("", fmt.Sprintf("decompressed_%d_", analysisID))
 	if err != nil {
-		h.updateAnalysisError(analysisID, fmt.Sprintf("Failed to create temp dir: %v", err))
+		h.updateAnalysisError(ctx, analysisID, fmt.Sprintf("Failed to create temp dir: %v", err))
 		return
 	}
+	defer os.RemoveAll(outputDir)
 
 	// Execute Python script with output directory
-	scriptPath := "/app/python_tools/compression_detector.py"
-	cmdArgs := []string{scriptPath, tmpFile, "--json", "--output-dir", tmpDir, "--original-filename", file.Name}
-
-	// Add offset parameters if provided
-	if startOffset != nil {
-		cmdArgs = append(cmdArgs, "--start-offset", fmt.Sprintf("%d", *startOffset))
-	}
-	if length != nil {
-		cmdArgs = append(cmdArgs, "--length", fmt.Sprintf("%d", *length))
-	}
+	cmdArgs := buildDetectorArgs(tmpFile, outputDir, file.Name, startOffset, length, methods)
 
-	cmd := exec.Command("python3", cmdArgs...)
+	// Keep the exact command so a surprising result can be reproduced
+	h.db.GormDB.Model(&models.CompressionAnalysis{}).Where("id = ?", analysisID).
+		Update("detector_command", detectorCommandLine(cmdArgs))
 
-	output, err := cmd.CombinedOutput()
+	output, err := runDetector(cmdArgs)
 	if err != nil {
-		h.updateAnalysisError(analysisID, fmt.Sprintf("Python script failed: %v\nOutput: %s", err, string(output)))
+		h.updateAnalysisError(ctx, analysisID, fmt.Sprintf("Python script failed: %v\nOutput: %s", err, string(output)))
 		return
 	}
 
 	// Parse JSON results
 	var report PythonAnalysisReport
 	if err := json.Unmarshal(output, &report); err != nil {
-		h.updateAnalysisError(analysisID, fmt.Sprintf("Failed to parse JSON: %v\nOutput: %s", err, string(output)))
+		h.updateAnalysisError(ctx, analysisID, fmt.Sprintf("Failed to parse JSON: %v\nOutput: %s", err, string(output)))
 		return
 	}
 
 	// Save results to database (including decompressed files)
-	if err := h.saveCompressionResults(analysisID, file.ID, &report, tmpDir, tmpFile); err != nil {
-		h.updateAnalysisError(analysisID, fmt.Sprintf("Failed to save results: %v", err))
+	if err := h.saveCompressionResults(ctx, analysisID, file, &report, outputDir); err != nil {
+		h.updateAnalysisError(ctx, analysisID, fmt.Sprintf("Failed to save results: %v", err))
 		return
 	}
 
+	h.completeAnalysis(ctx, analysisID, file, startOffset, length, &report)
+}
+
+// completeAnalysis marks an analysis completed with the totals of its report
+// and indexes it for the chat assistant
+func (h *Handler) completeAnalysis(ctx context.Context, analysisID uint, file models.File, startOffset *int64, length *int64, report *PythonAnalysisReport) {
 	// Update analysis status to completed
 	updates := map[string]interface{}{
 		"status":        "completed",
@@ -385,6 +383,9 @@ func (h *Handler) runCompressionDetector(analysisID uint, file models.File, star
 		"success_count": report.SuccessCount,
 		"failed_count":  report.FailedCount,
 	}
+	if report.Version != "" {
+		updates["detector_version"] = report.Version
+	}
 
 	if report.BestMethod != nil {
 		updates["best_method"] = *report.BestMethod
@@ -394,18 +395,60 @@ func (h *Handler) runCompressionDetector(analysisID uint, file models.File, star
 
 	h.db.GormDB.Model(&models.CompressionAnalysis{}).Where("id = ?", analysisID).
 		Updates(updates)
+	h.publishAnalysisStatus(analysisID)
 
-	fmt.Printf("Compression analysis %d completed successfully\n", analysisID)
+	metrics.CompressionAnalyses.WithLabelValues("completed").Inc()
+	logging.FromContext(ctx).Info("compression analysis completed", "success_count", report.SuccessCount, "total_tests", report.TotalTests)
+	indexCompressionAnalysis(analysisID, file, startOffset, length, report)
+}
+
+// buildDetectorArgs assembles the compression_detector.py command line
+func buildDetectorArgs(inputFile, outputDir, originalName string, startOffset *int64, length *int64, methods []string) []string {
+	scriptPath := "/app/python_tools/compression_detector.py"
+	cmdArgs := []string{scriptPath, inputFile, "--json", "--output-dir", outputDir, "--original-filename", originalName}
+
+	// Add offset parameters if provided
+	if startOffset != nil {
+		cmdArgs = append(cmdArgs, "--start-offset", fmt.Sprintf("%d", *startOffset))
+	}
+	if length != nil {
+		cmdArgs = append(cmdArgs, "--length", fmt.Sprintf("%d", *length))
+	}
+
+	// Restrict to the requested methods
+	if len(methods) > 0 {
+		cmdArgs = append(cmdArgs, "--methods", strings.Join(methods, ","))
+	}
+
+	return cmdArgs
+}
+
+// detectorCommandLine renders the detector invocation as a shell command,
+// quoting arguments that need it
+func detectorCommandLine(args []string) string {
+	parts := make([]string, 0, len(args)+1)
+	parts = append(parts, detectorInterpreter)
+	for _, arg := range args {
+		if arg == "" || strings.ContainsFunc(arg, func(r rune) bool {
+			return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./,=:+@%", r))
+		}) {
+			arg = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+		parts = append(parts, arg)
+	}
+	return strings.Join(parts, " ")
 }
 
 // updateAnalysisError updates analysis with error status
-func (h *Handler) updateAnalysisError(analysisID uint, errorMsg string) {
+func (h *Handler) updateAnalysisError(ctx context.Context, analysisID uint, errorMsg string) {
 	h.db.GormDB.Model(&models.CompressionAnalysis{}).Where("id = ?", analysisID).
 		Updates(map[string]interface{}{
 			"status": "failed",
 			"error":  errorMsg,
 		})
-	fmt.Printf("Compression analysis %d failed: %s\n", analysisID, errorMsg)
+	h.publishAnalysisStatus(analysisID)
+	metrics.CompressionAnalyses.WithLabelValues("failed").Inc()
+	logging.FromContext(ctx).Warn("compression analysis failed", "error", errorMsg)
 }
 
 // ListDecompressedFiles returns all decompressed files
@@ -414,9 +457,7 @@ func (h *Handler) ListDecompressedFiles(c echo.Context) error {
 
 	// Get all decompressed files with their associated data
 	if err := h.db.GormDB.Order("created_at DESC").Find(&decompFiles).Error; err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "failed to fetch decompressed files",
-		})
+		return apiError(c, http.StatusInternalServerError, ErrCodeInternal, "failed to fetch decompressed files")
 	}
 
 	// Format response with file info
@@ -451,16 +492,12 @@ func (h *Handler) GetDecompressedFileData(c echo.Context) error {
 	idStr := c.Param("id")
 	id, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "invalid file ID",
-		})
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid file ID")
 	}
 
 	var decompFile models.DecompressedFile
 	if err := h.db.GormDB.First(&decompFile, id).Error; err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "file not found",
-		})
+		return apiError(c, http.StatusNotFound, ErrCodeFileNotFound, "file not found")
 	}
 
 	// Return binary data
@@ -474,80 +511,33 @@ func (h *Handler) AddDecompressedToFiles(c echo.Context) error {
 	resultIDStr := c.Param("resultId")
 	resultID, err := strconv.ParseUint(resultIDStr, 10, 32)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "invalid result ID",
-		})
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid result ID")
 	}
 
 	// Get result
 	var result models.CompressionResult
 	if err := h.db.GormDB.First(&result, resultID).Error; err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "result not found",
-		})
-	}
-
-	// Get analysis with file info
-	var analysis models.CompressionAnalysis
-	if err := h.db.GormDB.First(&analysis, result.AnalysisID).Error; err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "analysis not found",
-		})
-	}
-
-	// Get file info
-	var file models.File
-	if err := h.db.GormDB.First(&file, analysis.FileID).Error; err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "file not found",
-		})
-	}
-
-	var data []byte
-	var fileName string
-
-	// First try to get from database if DecompressedFileID exists
-	if result.DecompressedFileID != nil {
-		var decompFile models.DecompressedFile
-		if err := h.db.GormDB.First(&decompFile, *result.DecompressedFileID).Error; err == nil {
-			data = decompFile.Data
-			fileName = decompFile.FileName
-		}
+		return apiError(c, http.StatusNotFound, ErrCodeNotFound, "result not found")
 	}
 
-	// If not found in database, try to get from /tmp/decompressed/
-	if data == nil && file.Name != "" {
-		// Construct filename from original file and compression method
-		baseFileName := file.Name
-		if ext := filepath.Ext(baseFileName); ext != "" {
-			baseFileName = baseFileName[:len(baseFileName)-len(ext)]
-		}
-		tempFileName := fmt.Sprintf("/tmp/decompressed/%s.%s.decompressed", baseFileName, result.Method)
-
-		if fileData, err := os.ReadFile(tempFileName); err == nil {
-			data = fileData
-			fileName = fmt.Sprintf("%s.%s.decompressed", baseFileName, result.Method)
-		}
-	}
-
-	// If still no data found
-	if data == nil {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "decompressed file not found in database or /tmp/decompressed/",
-		})
+	decompFile, err := h.loadDecompressedFile(result)
+	if err != nil {
+		return apiError(c, http.StatusNotFound, ErrCodeNotFound, err.Error())
 	}
+	data := decompFile.Data
+	fileName := decompFile.FileName
 
 	// Create new binary file
 	newFile := models.File{
-		Name: fileName,
-		Size: int64(len(data)),
-		Data: data,
+		Name:    fileName,
+		Size:    int64(len(data)),
+		Hash:    contentHash(data),
+		Entropy: fileEntropy(data),
+		Data:    data,
 	}
 
 	if err := h.db.GormDB.Create(&newFile).Error; err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "failed to add file",
-		})
+		return apiError(c, http.StatusInternalServerError, ErrCodeInternal, "failed to add file")
 	}
 
 	return c.JSON(http.StatusCreated, map[string]interface{}{
@@ -565,101 +555,53 @@ func (h *Handler) ReconstructFileWithDecompression(c echo.Context) error {
 	resultIDStr := c.Param("resultId")
 	resultID, err := strconv.ParseUint(resultIDStr, 10, 32)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "invalid result ID",
-		})
-	}
-
-	// Get result
-	var result models.CompressionResult
-	if err := h.db.GormDB.First(&result, resultID).Error; err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "result not found",
-		})
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid result ID")
 	}
 
-	// Get analysis with file info and selection details
-	var analysis models.CompressionAnalysis
-	if err := h.db.GormDB.First(&analysis, result.AnalysisID).Error; err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "analysis not found",
-		})
-	}
-
-	// Check if this was a selection-based analysis
-	if analysis.StartOffset == nil || analysis.Length == nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "this analysis was not performed on a selection, cannot reconstruct",
-		})
+	region, status, apiErr := h.loadSelectionReplacement(uint(resultID))
+	if apiErr != nil {
+		return c.JSON(status, apiErr)
 	}
-
-	startOffset := *analysis.StartOffset
-	selectionLength := *analysis.Length
+	result := region.result
+	startOffset, endOffset := region.start, region.end
+	selectionLength := endOffset - startOffset
 
 	// Get original file
 	var originalFile models.File
-	if err := h.db.GormDB.First(&originalFile, analysis.FileID).Error; err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "original file not found",
-		})
+	if err := h.db.GormDB.First(&originalFile, region.fileID).Error; err != nil {
+		return apiError(c, http.StatusNotFound, ErrCodeFileNotFound, "original file not found")
 	}
 
-	// Get decompressed data
-	var decompressedData []byte
-	if result.DecompressedFileID != nil {
-		var decompFile models.DecompressedFile
-		if err := h.db.GormDB.First(&decompFile, *result.DecompressedFileID).Error; err == nil {
-			decompressedData = decompFile.Data
-		}
-	}
-
-	// Fallback to /tmp/decompressed/ if not found in database
-	if decompressedData == nil {
-		baseFileName := originalFile.Name
-		if ext := filepath.Ext(baseFileName); ext != "" {
-			baseFileName = baseFileName[:len(baseFileName)-len(ext)]
-		}
-		tempFileName := fmt.Sprintf("/tmp/decompressed/%s.%s.decompressed", baseFileName, result.Method)
-		if fileData, err := os.ReadFile(tempFileName); err == nil {
-			decompressedData = fileData
-		}
-	}
-
-	if decompressedData == nil {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "decompressed data not found",
-		})
+	// The analysis may predate a change to the file, so its selection can be stale
+	if apiErr := region.checkBounds(int64(len(originalFile.Data))); apiErr != nil {
+		return c.JSON(http.StatusBadRequest, apiErr)
 	}
+	decompressedData := region.data
 
 	// Reconstruct file: prefix + decompressed + suffix
 	var reconstructed []byte
 
 	// 1. Add bytes before selection (0 to startOffset)
-	if startOffset > 0 {
-		reconstructed = append(reconstructed, originalFile.Data[:startOffset]...)
-	}
+	reconstructed = append(reconstructed, originalFile.Data[:startOffset]...)
 
 	// 2. Add decompressed data (replaces the compressed selection)
 	reconstructed = append(reconstructed, decompressedData...)
 
 	// 3. Add bytes after selection (startOffset+length to end)
-	endOffset := startOffset + selectionLength
-	if endOffset < int64(len(originalFile.Data)) {
-		reconstructed = append(reconstructed, originalFile.Data[endOffset:]...)
-	}
+	reconstructed = append(reconstructed, originalFile.Data[endOffset:]...)
 
 	// Create new file with reconstructed data
 	newFileName := fmt.Sprintf("%s.%s.reconstructed", originalFile.Name, result.Method)
 	newFile := models.File{
-		Name: newFileName,
-		Size: int64(len(reconstructed)),
-		Data: reconstructed,
+		Name:    newFileName,
+		Size:    int64(len(reconstructed)),
+		Hash:    contentHash(reconstructed),
+		Entropy: fileEntropy(reconstructed),
+		Data:    reconstructed,
 	}
 
 	if err := h.db.GormDB.Create(&newFile).Error; err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "failed to create reconstructed file",
-		})
+		return apiError(c, http.StatusInternalServerError, ErrCodeInternal, "failed to create reconstructed file")
 	}
 
 	return c.JSON(http.StatusCreated, map[string]interface{}{
@@ -681,8 +623,169 @@ func (h *Handler) ReconstructFileWithDecompression(c echo.Context) error {
 	})
 }
 
+// selectionReplacement is the decompressed data of a selection-based
+// analysis result and the compressed range [start, end) it replaces
+type selectionReplacement struct {
+	result     models.CompressionResult
+	fileID     uint
+	start, end int64
+	data       []byte
+}
+
+// checkBounds reports a selection that no longer fits the file
+func (r selectionReplacement) checkBounds(fileSize int64) *APIError {
+	if r.start < 0 || r.end < r.start || r.end > fileSize {
+		return &APIError{
+			Code:    ErrCodeOutOfRange,
+			Message: fmt.Sprintf("analysis selection 0x%X-0x%X is outside the current file (size 0x%X)", r.start, r.end, fileSize),
+			Details: map[string]any{"start": r.start, "end": r.end, "file_size": fileSize},
+		}
+	}
+	return nil
+}
+
+// loadSelectionReplacement loads a result of a selection-based analysis with
+// its decompressed data, returning an HTTP status with any error
+func (h *Handler) loadSelectionReplacement(resultID uint) (selectionReplacement, int, *APIError) {
+	var r selectionReplacement
+	if err := h.db.GormDB.First(&r.result, resultID).Error; err != nil {
+		return r, http.StatusNotFound, &APIError{Code: ErrCodeNotFound, Message: "result not found"}
+	}
+
+	// Get analysis with file info and selection details
+	var analysis models.CompressionAnalysis
+	if err := h.db.GormDB.First(&analysis, r.result.AnalysisID).Error; err != nil {
+		return r, http.StatusNotFound, &APIError{Code: ErrCodeNotFound, Message: "analysis not found"}
+	}
+
+	// Check if this was a selection-based analysis
+	if analysis.StartOffset == nil || analysis.Length == nil {
+		return r, http.StatusBadRequest, &APIError{Code: ErrCodeInvalidRequest, Message: "this analysis was not performed on a selection, cannot reconstruct"}
+	}
+	r.fileID = analysis.FileID
+	r.start = *analysis.StartOffset
+	r.end = r.start + *analysis.Length
+
+	decompFile, err := h.loadDecompressedFile(r.result)
+	if err != nil {
+		return r, http.StatusNotFound, &APIError{Code: ErrCodeNotFound, Message: err.Error()}
+	}
+	r.data = decompFile.Data
+	return r, http.StatusOK, nil
+}
+
+// ReconstructMultiRequest lists the results whose selections to replace, in file order
+type ReconstructMultiRequest struct {
+	Regions []struct {
+		ResultID uint `json:"result_id"`
+	} `json:"regions"`
+}
+
+// ReconstructFileWithMultipleDecompressions replaces several compressed
+// selections of one file with their decompressed data in a single new file
+func (h *Handler) ReconstructFileWithMultipleDecompressions(c echo.Context) error {
+	var req ReconstructMultiRequest
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid request")
+	}
+	if len(req.Regions) == 0 {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "at least one region is required")
+	}
+
+	regions := make([]selectionReplacement, len(req.Regions))
+	for i, reqRegion := range req.Regions {
+		region, status, apiErr := h.loadSelectionReplacement(reqRegion.ResultID)
+		if apiErr != nil {
+			return apiErrorDetails(c, status, apiErr.Code,
+				fmt.Sprintf("region %d (result %d): %s", i, reqRegion.ResultID, apiErr.Message),
+				map[string]any{"region": i, "result_id": reqRegion.ResultID})
+		}
+		if i > 0 {
+			prev := regions[i-1]
+			if region.fileID != prev.fileID {
+				return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("region %d (result %d) is from a different file than region 0", i, reqRegion.ResultID))
+			}
+			if region.start < prev.end {
+				return apiErrorDetails(c, http.StatusBadRequest, ErrCodeInvalidRequest,
+					fmt.Sprintf("region %d (0x%X-0x%X) overlaps or comes before region %d (0x%X-0x%X); regions must be ordered and not overlap",
+						i, region.start, region.end, i-1, prev.start, prev.end),
+					map[string]any{"region": i})
+			}
+		}
+		regions[i] = region
+	}
+
+	var originalFile models.File
+	if err := h.db.GormDB.First(&originalFile, regions[0].fileID).Error; err != nil {
+		return apiError(c, http.StatusNotFound, ErrCodeFileNotFound, "original file not found")
+	}
+	fileSize := int64(len(originalFile.Data))
+
+	// Splice: bytes before each selection, then its decompressed data
+	var reconstructed []byte
+	var regionInfo []map[string]interface{}
+	var prevEnd int64
+	for i, region := range regions {
+		if apiErr := region.checkBounds(fileSize); apiErr != nil {
+			apiErr.Message = fmt.Sprintf("region %d: %s", i, apiErr.Message)
+			apiErr.Details["region"] = i
+			return c.JSON(http.StatusBadRequest, apiErr)
+		}
+		reconstructed = append(reconstructed, originalFile.Data[prevEnd:region.start]...)
+		regionInfo = append(regionInfo, map[string]interface{}{
+			"result_id":           region.result.ID,
+			"method":              region.result.Method,
+			"compressed_replaced": fmt.Sprintf("0x%X-0x%X (0x%X bytes)", region.start, region.end, region.end-region.start),
+			"decompressed_size":   len(region.data),
+			"new_offset":          len(reconstructed),
+			"size_delta":          int64(len(region.data)) - (region.end - region.start),
+		})
+		reconstructed = append(reconstructed, region.data...)
+		prevEnd = region.end
+	}
+	reconstructed = append(reconstructed, originalFile.Data[prevEnd:]...)
+
+	newFileName := fmt.Sprintf("%s.%d-regions.reconstructed", originalFile.Name, len(regions))
+	var existing models.File
+	if err := h.db.GormDB.Select("id").Where("name = ?", newFileName).First(&existing).Error; err == nil {
+		return apiErrorDetails(c, http.StatusConflict, ErrCodeConflict, fmt.Sprintf("file %s already exists", newFileName),
+			map[string]any{"file_id": existing.ID})
+	}
+
+	newFile := models.File{
+		Name:    newFileName,
+		Vendor:  originalFile.Vendor,
+		Size:    int64(len(reconstructed)),
+		Hash:    contentHash(reconstructed),
+		Entropy: fileEntropy(reconstructed),
+		Data:    reconstructed,
+	}
+	if err := h.db.GormDB.Create(&newFile).Error; err != nil {
+		return apiError(c, http.StatusInternalServerError, ErrCodeInternal, "failed to create reconstructed file")
+	}
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"message": "file reconstructed successfully",
+		"file": map[string]interface{}{
+			"id":   newFile.ID,
+			"name": newFile.Name,
+			"size": newFile.Size,
+		},
+		"reconstruction_info": map[string]interface{}{
+			"original_size":      len(originalFile.Data),
+			"reconstructed_size": len(reconstructed),
+			"size_delta":         int64(len(reconstructed)) - fileSize,
+			"regions":            regionInfo,
+		},
+	})
+}
+
 // saveCompressionResults saves decompression results to database
-func (h *Handler) saveCompressionResults(analysisID uint, fileID uint, report *PythonAnalysisReport, tmpDir, tmpFile string) error {
+// The database is the only place decompressed data lives once this returns;
+// outputDir is a per-analysis scratch directory written by the Python detector.
+func (h *Handler) saveCompressionResults(ctx context.Context, analysisID uint, file models.File, report *PythonAnalysisReport, outputDir string) error {
+	baseFileName := decompressedBaseName(file.Name)
+
 	// Save each result
 	for _, pyResult := range report.Results {
 		result := models.CompressionResult{
@@ -703,41 +806,74 @@ func (h *Handler) saveCompressionResults(analysisID uint, fileID uint, report *P
 			result.Error = *pyResult.Error
 		}
 
-		// Save the result first to get an ID
-		if err := h.db.GormDB.Create(&result).Error; err != nil {
-			return fmt.Errorf("failed to save result for %s: %w", pyResult.Method, err)
+		// Persist every successful decompression, valid checksum or not
+		var data []byte
+		if pyResult.Success {
+			data, _ = os.ReadFile(filepath.Join(outputDir, fmt.Sprintf("%s.%s.decompressed", baseFileName, pyResult.Method)))
 		}
+		if err := h.saveCompressionResult(ctx, &result, file, data); err != nil {
+			return err
+		}
+	}
 
-		// Try to load and save decompressed file if it exists and was successful
-		if pyResult.Success && pyResult.ChecksumValid {
-			// Extract original filename without extension for decompressed filename
-			originalFileName := filepath.Base(report.FilePath)
-			if ext := filepath.Ext(originalFileName); ext != "" {
-				originalFileName = originalFileName[:len(originalFileName)-len(ext)]
-			}
-			decompressedPath := fmt.Sprintf("%s/%s.%s.decompressed", tmpDir, originalFileName, pyResult.Method)
-			if data, err := os.ReadFile(decompressedPath); err == nil {
-				// Save decompressed file to database
-				decompressedFile := models.DecompressedFile{
-					OriginalFileID: fileID,
-					ResultID:       result.ID,
-					Method:         pyResult.Method,
-					FileName:       fmt.Sprintf("%s.%s.decompressed", originalFileName, pyResult.Method),
-					Size:           int64(len(data)),
-					Data:           data,
-				}
-
-				if err := h.db.GormDB.Create(&decompressedFile).Error; err != nil {
-					fmt.Printf("Warning: failed to save decompressed file for %s: %v\n", pyResult.Method, err)
-				} else {
-					// Update result with decompressed file ID
-					decompressedFileID := decompressedFile.ID
-					result.DecompressedFileID = &decompressedFileID
-					h.db.GormDB.Save(&result)
-				}
-			}
+	return nil
+}
+
+// compressionPreviewBytes is how much of the decompressed data a result's
+// preview_hex shows
+const compressionPreviewBytes = 256
+
+// saveCompressionResult stores a result and, when data is set, the
+// decompressed data it produced, then tells the analysis' subscribers
+func (h *Handler) saveCompressionResult(ctx context.Context, result *models.CompressionResult, file models.File, data []byte) error {
+	if result.Success && data != nil {
+		result.PreviewHex = hex.EncodeToString(data[:min(len(data), compressionPreviewBytes)])
+	}
+
+	// Save the result first to get an ID
+	if err := h.db.GormDB.Create(result).Error; err != nil {
+		return fmt.Errorf("failed to save result for %s: %w", result.Method, err)
+	}
+
+	if data != nil {
+		// Save decompressed file to database
+		decompressedFile := models.DecompressedFile{
+			OriginalFileID: file.ID,
+			ResultID:       result.ID,
+			Method:         result.Method,
+			FileName:       fmt.Sprintf("%s.%s.decompressed", decompressedBaseName(file.Name), result.Method),
+			Size:           int64(len(data)),
+			Data:           data,
+		}
+
+		if err := h.db.GormDB.Create(&decompressedFile).Error; err != nil {
+			logging.FromContext(ctx).Warn("failed to save decompressed file", "method", result.Method, "error", err)
+		} else {
+			// Update result with decompressed file ID
+			decompressedFileID := decompressedFile.ID
+			result.DecompressedFileID = &decompressedFileID
+			h.db.GormDB.Save(result)
 		}
 	}
 
+	h.compressionEvents.publish(result.AnalysisID, compressionEvent{Name: "result", Data: *result})
 	return nil
 }
+
+// decompressedBaseName strips the extension the same way the Python detector does
+// when naming its output files
+func decompressedBaseName(fileName string) string {
+	return fileName[:len(fileName)-len(filepath.Ext(fileName))]
+}
+
+// loadDecompressedFile returns the stored decompressed data for a result
+func (h *Handler) loadDecompressedFile(result models.CompressionResult) (models.DecompressedFile, error) {
+	var decompFile models.DecompressedFile
+	if result.DecompressedFileID == nil {
+		return decompFile, fmt.Errorf("no decompressed data stored for result %d", result.ID)
+	}
+	if err := h.db.GormDB.First(&decompFile, *result.DecompressedFileID).Error; err != nil {
+		return decompFile, fmt.Errorf("decompressed file %d not found", *result.DecompressedFileID)
+	}
+	return decompFile, nil
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"binary-annotator-pro/models"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// defaultDecompressedTTL is how long decompressed data is kept, unless
+	// DECOMPRESSED_TTL (a Go duration such as "72h") says otherwise
+	defaultDecompressedTTL = 7 * 24 * time.Hour
+
+	// staleTempAge is the age after which detector scratch files in the temp
+	// directory are assumed to be left over from a crashed run
+	staleTempAge = 24 * time.Hour
+
+	// decompressedSweepInterval is how often the background sweeper runs
+	decompressedSweepInterval = time.Hour
+)
+
+// CleanupReport describes what a decompressed-data cleanup removed
+type CleanupReport struct {
+	DeletedRows        int    `json:"deleted_rows"` // orphaned and older than the TTL
+	ReclaimedBytes     int64  `json:"reclaimed_bytes"`
+	TempFilesRemoved   int    `json:"temp_files_removed"`
+	TempBytesReclaimed int64  `json:"temp_bytes_reclaimed"`
+	TTL                string `json:"ttl"`
+}
+
+// decompressedTTL reads DECOMPRESSED_TTL, falling back to defaultDecompressedTTL
+func decompressedTTL() time.Duration {
+	v := os.Getenv("DECOMPRESSED_TTL")
+	if v == "" {
+		return defaultDecompressedTTL
+	}
+	ttl, err := time.ParseDuration(v)
+	if err != nil || ttl <= 0 {
+		log.Printf("Ignoring invalid DECOMPRESSED_TTL %q", v)
+		return defaultDecompressedTTL
+	}
+	return ttl
+}
+
+// CleanupDecompressedFiles purges decompressed data orphaned for longer than
+// the TTL and stale detector temp files. ?ttl= overrides DECOMPRESSED_TTL for this run.
+func (h *Handler) CleanupDecompressedFiles(c echo.Context) error {
+	ttl := decompressedTTL()
+	if v := c.QueryParam("ttl"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "ttl must be a positive duration such as 72h"})
+		}
+		ttl = d
+	}
+
+	report, err := h.cleanupDecompressed(time.Now(), ttl, os.TempDir())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+// StartDecompressedSweeper runs the cleanup every decompressedSweepInterval
+// in the background until the returned stop function is called
+func (h *Handler) StartDecompressedSweeper() (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(decompressedSweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				report, err := h.cleanupDecompressed(time.Now(), decompressedTTL(), os.TempDir())
+				if err != nil {
+					log.Printf("Decompressed cleanup failed: %v", err)
+				} else if report.DeletedRows+report.TempFilesRemoved > 0 {
+					log.Printf("Decompressed cleanup: %+v", report)
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// cleanupDecompressed hard-deletes DecompressedFile rows older than ttl
+// whose result or analysis no longer exists, then removes stale temp files.
+// Data of analyses that still exist is kept however old it is.
+func (h *Handler) cleanupDecompressed(now time.Time, ttl time.Duration, tmpDir string) (CleanupReport, error) {
+	report := CleanupReport{TTL: ttl.String()}
+
+	var victims []struct {
+		ID   uint
+		Size int64
+	}
+	// Soft-deleted rows still hold their blobs, so they count as orphans too
+	if err := h.db.GormDB.Unscoped().Model(&models.DecompressedFile{}).Select("id, size").
+		Where("created_at < ?", now.Add(-ttl)).
+		Where(`deleted_at IS NOT NULL OR result_id NOT IN (
+			SELECT r.id FROM compression_results r
+			JOIN compression_analyses a ON a.id = r.analysis_id AND a.deleted_at IS NULL)`).
+		Find(&victims).Error; err != nil {
+		return report, fmt.Errorf("find orphaned decompressed files: %w", err)
+	}
+
+	var ids []uint
+	for _, v := range victims {
+		ids = append(ids, v.ID)
+		report.ReclaimedBytes += v.Size
+	}
+	report.DeletedRows = len(victims)
+
+	if len(ids) > 0 {
+		// Results keep their metadata but no longer point at the data
+		if err := h.db.GormDB.Model(&models.CompressionResult{}).
+			Where("decompressed_file_id IN ?", ids).
+			Update("decompressed_file_id", nil).Error; err != nil {
+			return report, fmt.Errorf("unlink results: %w", err)
+		}
+		if err := h.db.GormDB.Unscoped().Delete(&models.DecompressedFile{}, ids).Error; err != nil {
+			return report, fmt.Errorf("delete decompressed files: %w", err)
+		}
+	}
+
+	// Detector scratch files (see runCompressionDetector) left by crashed runs
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		return report, nil
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, "binary_analysis_") && !strings.HasPrefix(name, "decompressed_") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || now.Sub(info.ModTime()) < staleTempAge {
+			continue
+		}
+		path := filepath.Join(tmpDir, name)
+		size := dirSize(path)
+		if err := os.RemoveAll(path); err != nil {
+			log.Printf("Failed to remove stale temp file %s: %v", path, err)
+			continue
+		}
+		report.TempFilesRemoved++
+		report.TempBytesReclaimed += size
+	}
+	return report, nil
+}
+
+// dirSize returns the total size of the regular files under path
+func dirSize(path string) int64 {
+	var size int64
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"binary-annotator-pro/models"
+)
+
+// TestCleanupDecompressed purges decompressed data that is both old and
+// orphaned, while recent orphans and old data of live analyses survive
+func TestCleanupDecompressed(t *testing.T) {
+	h := newTestHandler(t)
+	file := createTestFile(t, h, "ecg.bin", []byte{0x78, 0x9c})
+	now := time.Now()
+	ttl := 7 * 24 * time.Hour
+
+	analysis := models.CompressionAnalysis{FileID: file.ID, Status: "completed"}
+	deletedAnalysis := models.CompressionAnalysis{FileID: file.ID, Status: "completed"}
+	h.db.GormDB.Create(&analysis)
+	h.db.GormDB.Create(&deletedAnalysis)
+
+	seed := func(analysisID uint, created time.Time, size int) (models.CompressionResult, models.DecompressedFile) {
+		result := models.CompressionResult{AnalysisID: analysisID, Method: "zlib", Success: true}
+		h.db.GormDB.Create(&result)
+		df := models.DecompressedFile{CreatedAt: created, OriginalFileID: file.ID, ResultID: result.ID, Data: make([]byte, size), Size: int64(size)}
+		h.db.GormDB.Create(&df)
+		h.db.GormDB.Model(&result).Update("decompressed_file_id", df.ID)
+		return result, df
+	}
+	_, recent := seed(analysis.ID, now.Add(-time.Hour), 10)
+	_, oldLive := seed(analysis.ID, now.Add(-30*24*time.Hour), 100)
+	_, recentOrphan := seed(deletedAnalysis.ID, now.Add(-time.Hour), 20)
+	oldResult, oldOrphan := seed(deletedAnalysis.ID, now.Add(-30*24*time.Hour), 1000)
+	h.db.GormDB.Delete(&deletedAnalysis)
+	noResult := models.DecompressedFile{CreatedAt: now.Add(-30 * 24 * time.Hour), OriginalFileID: file.ID, ResultID: 9999, Data: make([]byte, 5), Size: 5}
+	h.db.GormDB.Create(&noResult)
+
+	tmpDir := t.TempDir()
+	writeTemp := func(name string, age time.Duration) string {
+		path := filepath.Join(tmpDir, name)
+		os.WriteFile(path, make([]byte, 7), 0644)
+		os.Chtimes(path, now.Add(-age), now.Add(-age))
+		return path
+	}
+	stale := writeTemp("binary_analysis_1_1.bin", 48*time.Hour)
+	fresh := writeTemp("binary_analysis_1_2.bin", time.Minute)
+	unrelated := writeTemp("other.bin", 48*time.Hour)
+
+	report, err := h.cleanupDecompressed(now, ttl, tmpDir)
+	if err != nil {
+		t.Fatalf("cleanupDecompressed() error = %v", err)
+	}
+
+	if report.DeletedRows != 2 || report.ReclaimedBytes != 1005 {
+		t.Errorf("report = %+v, want 2 rows, 1005 bytes", report)
+	}
+	if report.TempFilesRemoved != 1 || report.TempBytesReclaimed != 7 {
+		t.Errorf("report = %+v, want 1 temp file (7 bytes) removed", report)
+	}
+
+	for _, kept := range []models.DecompressedFile{recent, oldLive, recentOrphan} {
+		if err := h.db.GormDB.First(&models.DecompressedFile{}, kept.ID).Error; err != nil {
+			t.Errorf("decompressed file %d should survive: %v", kept.ID, err)
+		}
+	}
+	for _, gone := range []models.DecompressedFile{oldOrphan, noResult} {
+		if h.db.GormDB.Unscoped().First(&models.DecompressedFile{}, gone.ID).Error == nil {
+			t.Errorf("decompressed file %d was not purged", gone.ID)
+		}
+	}
+
+	h.db.GormDB.First(&oldResult, oldResult.ID)
+	if oldResult.DecompressedFileID != nil {
+		t.Errorf("purged result still points at decompressed file %d", *oldResult.DecompressedFileID)
+	}
+
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("stale temp file was not removed")
+	}
+	for _, path := range []string{fresh, unrelated} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s should survive: %v", filepath.Base(path), err)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"binary-annotator-pro/models"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// nativeDetectorVersion is recorded as detector_version for analyses
+// answered without the Python detector
+const nativeDetectorVersion = "native"
+
+// nativeMaxDecompressed caps what the in-process check inflates; larger
+// streams are left to the detector
+const nativeMaxDecompressed = 256 << 20
+
+// nativeFormat is a container the standard library can decompress, recognised
+// by its magic bytes
+type nativeFormat struct {
+	method    string // as named by compression_detector.py
+	matches   func(head []byte) bool
+	newReader func(r io.Reader) (io.Reader, error)
+	check     string // how the stream validates itself
+}
+
+var nativeFormats = []nativeFormat{
+	{
+		method:  "gzip",
+		matches: func(b []byte) bool { return len(b) >= 3 && b[0] == 0x1f && b[1] == 0x8b && b[2] == 0x08 },
+		newReader: func(r io.Reader) (io.Reader, error) {
+			zr, err := gzip.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			// A selection may run past the end of the stream
+			zr.Multistream(false)
+			return zr, nil
+		},
+		check: "CRC-32",
+	},
+	{
+		method: "zlib",
+		// Deflate with a window of at most 32K, and the header checksum
+		matches: func(b []byte) bool {
+			return len(b) >= 2 && b[0]&0x0f == 8 && b[0]>>4 <= 7 && (uint16(b[0])<<8|uint16(b[1]))%31 == 0
+		},
+		newReader: func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) },
+		check:     "Adler-32",
+	},
+	{
+		method: "bz2",
+		matches: func(b []byte) bool {
+			return len(b) >= 4 && bytes.HasPrefix(b, []byte("BZh")) && b[3] >= '1' && b[3] <= '9'
+		},
+		newReader: func(r io.Reader) (io.Reader, error) { return bzip2.NewReader(r), nil },
+		check:     "CRC-32",
+	},
+}
+
+// nativeDecompress decompresses data when it starts with the magic of a
+// format in nativeFormats (restricted to methods when set). It returns the
+// method and the decompressed bytes, or ok=false when the detector must run.
+func nativeDecompress(data []byte, methods []string) (method string, out []byte, check string, ok bool) {
+	for _, format := range nativeFormats {
+		if len(methods) > 0 && !slices.Contains(methods, format.method) {
+			continue
+		}
+		if !format.matches(data) {
+			continue
+		}
+		r, err := format.newReader(bytes.NewReader(data))
+		if err != nil {
+			continue
+		}
+		out, err := io.ReadAll(io.LimitReader(r, nativeMaxDecompressed+1))
+		if err != nil || len(out) > nativeMaxDecompressed {
+			continue
+		}
+		return format.method, out, format.check, true
+	}
+	return "", nil, "", false
+}
+
+// runNativeAnalysis answers an analysis in-process when the selection is a
+// standard gzip, zlib or bzip2 stream, saving the result the way the detector
+// would. It returns false, leaving the analysis untouched, otherwise.
+func (h *Handler) runNativeAnalysis(ctx context.Context, analysisID uint, file models.File, startOffset *int64, length *int64, methods []string) bool {
+	start, end := int64(0), int64(len(file.Data))
+	if startOffset != nil {
+		start = *startOffset
+	}
+	if length != nil && start+*length < end {
+		end = start + *length
+	}
+	if start < 0 || start >= end {
+		return false
+	}
+	selection := file.Data[start:end]
+
+	method, data, check, ok := nativeDecompress(selection, methods)
+	if !ok {
+		return false
+	}
+
+	ratio := float64(len(data)) / float64(len(selection))
+	result := models.CompressionResult{
+		AnalysisID:          analysisID,
+		Method:              method,
+		Success:             true,
+		CompressionRatio:    ratio,
+		Confidence:          1,
+		DecompressedSize:    int64(len(data)),
+		OriginalSize:        int64(len(selection)),
+		EntropyOriginal:     *fileEntropy(selection),
+		EntropyDecompressed: *fileEntropy(data),
+		ChecksumValid:       true,
+		ValidationMsg:       fmt.Sprintf("%s stream, %s verified", method, check),
+	}
+	if err := h.saveCompressionResult(ctx, &result, file, data); err != nil {
+		h.updateAnalysisError(ctx, analysisID, fmt.Sprintf("Failed to save results: %v", err))
+		return true
+	}
+
+	report := PythonAnalysisReport{
+		FileSize:       int64(len(file.Data)),
+		TotalTests:     1,
+		SuccessCount:   1,
+		BestMethod:     &method,
+		BestRatio:      ratio,
+		BestConfidence: 1,
+		Version:        nativeDetectorVersion,
+		Results: []PythonDecompressionResult{{
+			Method: method, Success: true, DecompressedSize: result.DecompressedSize, OriginalSize: result.OriginalSize,
+			CompressionRatio: ratio, Confidence: 1, EntropyOriginal: result.EntropyOriginal,
+			EntropyDecompressed: result.EntropyDecompressed, ChecksumValid: true, ValidationMsg: result.ValidationMsg,
+		}},
+	}
+	h.completeAnalysis(ctx, analysisID, file, startOffset, length, &report)
+	return true
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"binary-annotator-pro/models"
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// Compression analysis limits. Each analysis runs a Python detector that
+// writes the file to a temp dir and keeps a CPU busy, so only a few run at a
+// time; the others wait in a FIFO queue, and requests beyond that are turned
+// away.
+const (
+	defaultMaxConcurrentAnalyses = 2
+	defaultMaxQueuedAnalyses     = 16
+)
+
+// analysisSlot is a place in the limiter; ready is closed when the analysis
+// may run
+type analysisSlot struct {
+	analysisID uint
+	ready      chan struct{}
+}
+
+// analysisLimiter is a semaphore with a bounded FIFO queue
+type analysisLimiter struct {
+	mu         sync.Mutex
+	maxRunning int
+	maxQueued  int
+	running    int
+	queue      []*analysisSlot
+}
+
+func newAnalysisLimiter(maxRunning, maxQueued int) *analysisLimiter {
+	return &analysisLimiter{maxRunning: maxRunning, maxQueued: maxQueued}
+}
+
+// newAnalysisLimiterFromEnv reads COMPRESSION_MAX_CONCURRENT and
+// COMPRESSION_MAX_QUEUED, falling back to the defaults
+func newAnalysisLimiterFromEnv() *analysisLimiter {
+	return newAnalysisLimiter(
+		envPositiveInt("COMPRESSION_MAX_CONCURRENT", defaultMaxConcurrentAnalyses),
+		envPositiveInt("COMPRESSION_MAX_QUEUED", defaultMaxQueuedAnalyses),
+	)
+}
+
+// envPositiveInt reads a positive integer from the environment
+func envPositiveInt(key string, fallback int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		log.Printf("Ignoring invalid %s %q", key, v)
+		return fallback
+	}
+	return n
+}
+
+// enqueue takes a slot for an analysis, ready at once when fewer than
+// maxRunning analyses run and none wait. It returns false when the queue is
+// full.
+func (l *analysisLimiter) enqueue(analysisID uint) (*analysisSlot, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	slot := &analysisSlot{analysisID: analysisID, ready: make(chan struct{})}
+	if l.running < l.maxRunning && len(l.queue) == 0 {
+		l.running++
+		close(slot.ready)
+		return slot, true
+	}
+	if len(l.queue) >= l.maxQueued {
+		return nil, false
+	}
+	l.queue = append(l.queue, slot)
+	return slot, true
+}
+
+// release frees a running slot, handing it to the first queued analysis
+func (l *analysisLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.queue) == 0 {
+		l.running--
+		return
+	}
+	next := l.queue[0]
+	l.queue = l.queue[1:]
+	close(next.ready)
+}
+
+// waiting returns the queued analysis IDs, first in line first
+func (l *analysisLimiter) waiting() []uint {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ids := make([]uint, len(l.queue))
+	for i, slot := range l.queue {
+		ids[i] = slot.analysisID
+	}
+	return ids
+}
+
+// updateQueuePositions stores each queued analysis' place in line (1 = next
+// to run) and tells its subscribers. Analyses that started meanwhile are no
+// longer pending and keep their position cleared.
+func (h *Handler) updateQueuePositions() {
+	for i, id := range h.analyses.waiting() {
+		h.db.GormDB.Model(&models.CompressionAnalysis{}).Where("id = ? AND status = ?", id, "pending").
+			Update("queue_position", i+1)
+		h.publishAnalysisStatus(id)
+	}
+}
+
+// runQueuedAnalysis waits for the analysis' slot, runs the analysis and
+// passes the slot on. Standard gzip/zlib/bzip2 streams are decompressed
+// in-process, anything else goes to the detector.
+func (h *Handler) runQueuedAnalysis(ctx context.Context, slot *analysisSlot, file models.File, startOffset *int64, length *int64, methods []string) {
+	<-slot.ready
+	defer func() {
+		h.analyses.release()
+		h.updateQueuePositions()
+	}()
+	if h.runNativeAnalysis(ctx, slot.analysisID, file, startOffset, length, methods) {
+		return
+	}
+	h.runCompressionDetector(ctx, slot.analysisID, file, startOffset, length, methods)
+}
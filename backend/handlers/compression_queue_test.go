@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"binary-annotator-pro/models"
+)
+
+// TestCompressionAnalysisConcurrencyCap starts more analyses than the cap and
+// checks the others queue in order, the one past the queue is refused and no
+// more than the cap ever run at once
+func TestCompressionAnalysisConcurrencyCap(t *testing.T) {
+	var mu sync.Mutex
+	running, peak := 0, 0
+	release := make(chan struct{})
+	old := runDetector
+	runDetector = func(args []string) ([]byte, error) {
+		mu.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		mu.Unlock()
+		<-release
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return json.Marshal(PythonAnalysisReport{})
+	}
+	defer func() { runDetector = old }()
+
+	h := newTestHandler(t)
+	h.analyses = newAnalysisLimiter(2, 3)
+
+	type job struct {
+		AnalysisID    uint `json:"analysis_id"`
+		QueuePosition int  `json:"queue_position"`
+	}
+	var jobs []job
+	for i := 0; i < 6; i++ {
+		file := createTestFile(t, h, fmt.Sprintf("cap%d.bin", i), []byte("data"))
+		c, rec := newJSONContext(http.MethodPost, "/analysis/compression/1", nil)
+		c.SetParamNames("fileId")
+		c.SetParamValues(fmt.Sprint(file.ID))
+		if err := h.StartCompressionAnalysis(c); err != nil {
+			t.Fatalf("StartCompressionAnalysis() error = %v", err)
+		}
+		if i == 5 {
+			var apiErr APIError
+			decodeJSON(t, rec, http.StatusTooManyRequests, &apiErr)
+			if apiErr.Code != ErrCodeBusy {
+				t.Errorf("code = %q, want %q", apiErr.Code, ErrCodeBusy)
+			}
+			continue
+		}
+		var j job
+		decodeJSON(t, rec, http.StatusCreated, &j)
+		jobs = append(jobs, j)
+	}
+
+	for i, j := range jobs {
+		want := 0
+		if i >= 2 {
+			want = i - 1
+		}
+		if j.QueuePosition != want {
+			t.Errorf("job %d queue_position = %d, want %d", i, j.QueuePosition, want)
+		}
+	}
+	var queued models.CompressionAnalysis
+	h.db.GormDB.First(&queued, jobs[4].AnalysisID)
+	if queued.Status != "pending" || queued.QueuePosition != 3 {
+		t.Errorf("last queued analysis = %s at %d, want pending at 3", queued.Status, queued.QueuePosition)
+	}
+
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for _, j := range jobs {
+		for {
+			var a models.CompressionAnalysis
+			h.db.GormDB.First(&a, j.AnalysisID)
+			if a.Status == "completed" || a.Status == "failed" {
+				if a.QueuePosition != 0 {
+					t.Errorf("analysis %d finished with queue_position %d", a.ID, a.QueuePosition)
+				}
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("analysis %d still %s", a.ID, a.Status)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if peak != 2 {
+		t.Errorf("peak concurrent detectors = %d, want 2", peak)
+	}
+}
+
+// TestNativeAnalysisQueued checks a gzip selection decompressed in-process
+// still waits for a slot: with the only slot taken, the request returns at
+// once as queued and the analysis completes once the slot frees
+func TestNativeAnalysisQueued(t *testing.T) {
+	release := make(chan struct{})
+	old := runDetector
+	runDetector = func(args []string) ([]byte, error) {
+		<-release
+		return json.Marshal(PythonAnalysisReport{})
+	}
+	defer func() { runDetector = old }()
+
+	h := newTestHandler(t)
+	h.analyses = newAnalysisLimiter(1, 4)
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(bytes.Repeat([]byte("sample "), 100))
+	zw.Close()
+
+	start := func(name string, data []byte) (id uint, position int) {
+		t.Helper()
+		file := createTestFile(t, h, name, data)
+		c, rec := newJSONContext(http.MethodPost, "/analysis/compression/1", nil)
+		c.SetParamNames("fileId")
+		c.SetParamValues(fmt.Sprint(file.ID))
+		if err := h.StartCompressionAnalysis(c); err != nil {
+			t.Fatalf("StartCompressionAnalysis() error = %v", err)
+		}
+		var resp struct {
+			AnalysisID    uint `json:"analysis_id"`
+			QueuePosition int  `json:"queue_position"`
+		}
+		decodeJSON(t, rec, http.StatusCreated, &resp)
+		return resp.AnalysisID, resp.QueuePosition
+	}
+
+	start("busy.bin", []byte("no magic here"))
+	id, position := start("stream.gz", gz.Bytes())
+	if position != 1 {
+		t.Errorf("gzip analysis queue_position = %d, want 1", position)
+	}
+	var a models.CompressionAnalysis
+	h.db.GormDB.First(&a, id)
+	if a.Status != "pending" {
+		t.Errorf("gzip analysis ran without a slot: status %s", a.Status)
+	}
+
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for a.Status != "completed" {
+		if time.Now().After(deadline) {
+			t.Fatalf("gzip analysis still %s", a.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+		h.db.GormDB.First(&a, id)
+	}
+	if a.DetectorVersion != nativeDetectorVersion || a.BestMethod != "gzip" {
+		t.Errorf("analysis = %s by %s, want gzip by %s", a.BestMethod, a.DetectorVersion, nativeDetectorVersion)
+	}
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"binary-annotator-pro/models"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// compressionStreamPoll is how often a progress stream re-checks the analysis
+// in the database (in case an event was dropped) and sends a keep-alive
+var compressionStreamPoll = 5 * time.Second
+
+// compressionEvent is one progress event: "status" carries the analysis
+// (without results), "result" one persisted CompressionResult
+type compressionEvent struct {
+	Name string
+	Data interface{}
+}
+
+// compressionEventHub fans analysis progress out to stream subscribers
+type compressionEventHub struct {
+	mu   sync.Mutex
+	subs map[uint]map[chan compressionEvent]struct{}
+}
+
+func newCompressionEventHub() *compressionEventHub {
+	return &compressionEventHub{subs: make(map[uint]map[chan compressionEvent]struct{})}
+}
+
+// subscribe returns the events of an analysis until unsubscribe is called
+func (hub *compressionEventHub) subscribe(analysisID uint) (<-chan compressionEvent, func()) {
+	ch := make(chan compressionEvent, 64)
+	hub.mu.Lock()
+	if hub.subs[analysisID] == nil {
+		hub.subs[analysisID] = make(map[chan compressionEvent]struct{})
+	}
+	hub.subs[analysisID][ch] = struct{}{}
+	hub.mu.Unlock()
+
+	return ch, func() {
+		hub.mu.Lock()
+		defer hub.mu.Unlock()
+		delete(hub.subs[analysisID], ch)
+		if len(hub.subs[analysisID]) == 0 {
+			delete(hub.subs, analysisID)
+		}
+	}
+}
+
+// publish sends an event to the analysis' subscribers without blocking; a
+// subscriber that falls behind misses it and catches up from the database
+func (hub *compressionEventHub) publish(analysisID uint, ev compressionEvent) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	for ch := range hub.subs[analysisID] {
+		select {
+		case ch <- ev:
+		default:
+			log.Printf("Compression analysis %d: dropped %s event for a slow stream", analysisID, ev.Name)
+		}
+	}
+}
+
+// publishAnalysisStatus sends the analysis' current state as a status event
+func (h *Handler) publishAnalysisStatus(analysisID uint) {
+	var analysis models.CompressionAnalysis
+	if err := h.db.GormDB.First(&analysis, analysisID).Error; err != nil {
+		return
+	}
+	h.compressionEvents.publish(analysisID, compressionEvent{Name: "status", Data: analysis})
+}
+
+// analysisFinished reports whether a status is terminal
+func analysisFinished(status string) bool {
+	return status == "completed" || status == "failed"
+}
+
+// StreamCompressionAnalysis streams an analysis' progress as server-sent
+// events: results already saved, then status changes and results as they
+// happen. The stream ends with the completed or failed status event.
+func (h *Handler) StreamCompressionAnalysis(c echo.Context) error {
+	analysisID, err := strconv.ParseUint(c.Param("analysisId"), 10, 32)
+	if err != nil {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid analysis ID")
+	}
+
+	// Subscribe before reading the current state so nothing happens unseen
+	events, unsubscribe := h.compressionEvents.subscribe(uint(analysisID))
+	defer unsubscribe()
+
+	var analysis models.CompressionAnalysis
+	if err := h.db.GormDB.Preload("Results").First(&analysis, analysisID).Error; err != nil {
+		return apiError(c, http.StatusNotFound, ErrCodeNotFound, "analysis not found")
+	}
+
+	w := c.Response()
+	w.Header().Set(echo.HeaderContentType, "text/event-stream")
+	w.Header().Set(echo.HeaderCacheControl, "no-cache")
+	w.Header().Set(echo.HeaderConnection, "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	sent := make(map[uint]bool) // result IDs, as a result may be both loaded and published
+	send := func(ev compressionEvent) error {
+		if r, ok := ev.Data.(models.CompressionResult); ok {
+			if sent[r.ID] {
+				return nil
+			}
+			sent[r.ID] = true
+		}
+		data, err := json.Marshal(ev.Data)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Name, data); err != nil {
+			return err
+		}
+		w.Flush()
+		return nil
+	}
+
+	for _, r := range analysis.Results {
+		if err := send(compressionEvent{Name: "result", Data: r}); err != nil {
+			return nil
+		}
+	}
+	analysis.Results = nil
+	if err := send(compressionEvent{Name: "status", Data: analysis}); err != nil || analysisFinished(analysis.Status) {
+		return nil
+	}
+
+	ticker := time.NewTicker(compressionStreamPoll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case ev := <-events:
+			if err := send(ev); err != nil {
+				return nil
+			}
+			if a, ok := ev.Data.(models.CompressionAnalysis); ok && analysisFinished(a.Status) {
+				return nil
+			}
+		case <-ticker.C:
+			var current models.CompressionAnalysis
+			if err := h.db.GormDB.First(&current, analysisID).Error; err != nil {
+				return nil
+			}
+			if analysisFinished(current.Status) {
+				// The final events were missed: replay results, then finish
+				var results []models.CompressionResult
+				h.db.GormDB.Where("analysis_id = ?", analysisID).Order("id").Find(&results)
+				for _, r := range results {
+					send(compressionEvent{Name: "result", Data: r})
+				}
+				send(compressionEvent{Name: "status", Data: current})
+				return nil
+			}
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+			w.Flush()
+		}
+	}
+}
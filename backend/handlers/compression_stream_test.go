@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"binary-annotator-pro/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TestStreamCompressionAnalysis subscribes to an analysis, runs a fake
+// detector reporting two results and checks the events arrive in order
+func TestStreamCompressionAnalysis(t *testing.T) {
+	release := make(chan struct{})
+	old := runDetector
+	runDetector = func(args []string) ([]byte, error) {
+		<-release
+		best := "zlib"
+		return json.Marshal(PythonAnalysisReport{
+			TotalTests: 2, SuccessCount: 1, FailedCount: 1, BestMethod: &best,
+			Results: []PythonDecompressionResult{{Method: "zlib", Success: true}, {Method: "lzma"}},
+		})
+	}
+	defer func() { runDetector = old }()
+
+	h := newTestHandler(t)
+	file := createTestFile(t, h, "stream.bin", []byte("compressed?"))
+	analysis := models.CompressionAnalysis{FileID: file.ID, Status: "pending"}
+	if err := h.db.GormDB.Create(&analysis).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	e.GET("/analysis/compression/:analysisId/stream", h.StreamCompressionAnalysis)
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	resp, err := http.Get(fmt.Sprintf("%s/analysis/compression/%d/stream", srv.URL, analysis.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	type event struct{ name, data string }
+	events := make(chan event)
+	go func() {
+		defer close(events)
+		var ev event
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				ev.name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				ev.data = strings.TrimPrefix(line, "data: ")
+			case line == "" && ev.name != "":
+				events <- ev
+				ev = event{}
+			}
+		}
+	}()
+
+	// describe reduces an event to "status:<status>" or "result:<method>"
+	describe := func(ev event) string {
+		var v struct {
+			Status string `json:"status"`
+			Method string `json:"method"`
+		}
+		json.Unmarshal([]byte(ev.data), &v)
+		if ev.name == "result" {
+			return "result:" + v.Method
+		}
+		return ev.name + ":" + v.Status
+	}
+
+	var got []string
+	next := func() bool {
+		select {
+		case ev, ok := <-events:
+			if ok {
+				got = append(got, describe(ev))
+			}
+			return ok
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for events, got %v", got)
+			return false
+		}
+	}
+
+	next() // the current state, sent on connect
+	go h.runCompressionDetector(context.Background(), analysis.ID, file, nil, nil, nil)
+	close(release)
+	for next() {
+	}
+
+	want := []string{"status:pending", "status:running", "result:zlib", "result:lzma", "status:completed"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+}
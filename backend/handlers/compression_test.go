@@ -0,0 +1,538 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"binary-annotator-pro/models"
+	"binary-annotator-pro/services"
+)
+
+// saveFakeDetectorRun simulates a detector run that wrote one decompressed variant
+// into its own output directory, then persists it
+func saveFakeDetectorRun(t *testing.T, h *Handler, file models.File, method string, payload []byte, checksumValid bool) models.CompressionResult {
+	t.Helper()
+
+	analysis := models.CompressionAnalysis{FileID: file.ID, Status: "running"}
+	if err := h.db.GormDB.Create(&analysis).Error; err != nil {
+		t.Fatalf("create analysis: %v", err)
+	}
+
+	outputDir := t.TempDir()
+	outName := fmt.Sprintf("%s.%s.decompressed", decompressedBaseName(file.Name), method)
+	if err := os.WriteFile(filepath.Join(outputDir, outName), payload, 0644); err != nil {
+		t.Fatalf("write detector output: %v", err)
+	}
+
+	report := &PythonAnalysisReport{
+		TotalTests:   1,
+		SuccessCount: 1,
+		Results: []PythonDecompressionResult{
+			{Method: method, Success: true, ChecksumValid: checksumValid, DecompressedSize: int64(len(payload))},
+		},
+	}
+	if err := h.saveCompressionResults(context.Background(), analysis.ID, file, report, outputDir); err != nil {
+		t.Fatalf("saveCompressionResults: %v", err)
+	}
+
+	// The scratch directory goes away, as /tmp does on container restart
+	os.RemoveAll(outputDir)
+
+	var result models.CompressionResult
+	if err := h.db.GormDB.Where("analysis_id = ?", analysis.ID).First(&result).Error; err != nil {
+		t.Fatalf("load result: %v", err)
+	}
+	return result
+}
+
+// TestDecompressedFilesSameBasename ensures two files sharing a basename keep separate decompressed data
+func TestDecompressedFilesSameBasename(t *testing.T) {
+	h := newTestHandler(t)
+
+	fileA := createTestFile(t, h, "ecg.bin", []byte{0x78, 0x9c, 0x01})
+	fileB := createTestFile(t, h, "ecg.dat", []byte{0x78, 0x9c, 0x02})
+
+	payloadA := []byte("decompressed from ecg.bin")
+	payloadB := []byte("decompressed from ecg.dat")
+
+	resultA := saveFakeDetectorRun(t, h, fileA, "zlib", payloadA, true)
+	resultB := saveFakeDetectorRun(t, h, fileB, "zlib", payloadB, false)
+
+	tests := []struct {
+		name   string
+		result models.CompressionResult
+		want   []byte
+	}{
+		{"ecg.bin", resultA, payloadA},
+		{"ecg.dat (checksum not validated)", resultB, payloadB},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.result.DecompressedFileID == nil {
+				t.Fatal("successful decompression was not persisted")
+			}
+
+			c, rec := newJSONContext(http.MethodGet, "/", nil)
+			c.SetParamNames("resultId")
+			c.SetParamValues(fmt.Sprint(tt.result.ID))
+			if err := h.DownloadDecompressedFile(c); err != nil {
+				t.Fatalf("DownloadDecompressedFile() error = %v", err)
+			}
+			decodeJSON(t, rec, http.StatusOK, nil)
+			if !bytes.Equal(rec.Body.Bytes(), tt.want) {
+				t.Errorf("body = %q, want %q", rec.Body.Bytes(), tt.want)
+			}
+		})
+	}
+}
+
+// TestDownloadDecompressedFileNotStored returns 404 when the DB has no data for a result
+func TestDownloadDecompressedFileNotStored(t *testing.T) {
+	h := newTestHandler(t)
+	file := createTestFile(t, h, "plain.bin", []byte{0x00})
+
+	analysis := models.CompressionAnalysis{FileID: file.ID, Status: "completed"}
+	h.db.GormDB.Create(&analysis)
+	result := models.CompressionResult{AnalysisID: analysis.ID, Method: "gzip"}
+	h.db.GormDB.Create(&result)
+
+	c, rec := newJSONContext(http.MethodGet, "/", nil)
+	c.SetParamNames("resultId")
+	c.SetParamValues(fmt.Sprint(result.ID))
+	if err := h.DownloadDecompressedFile(c); err != nil {
+		t.Fatalf("DownloadDecompressedFile() error = %v", err)
+	}
+	decodeJSON(t, rec, http.StatusNotFound, nil)
+}
+
+// TestReconstructStaleSelection rejects selections that no longer fit the file instead of panicking
+func TestReconstructStaleSelection(t *testing.T) {
+	h := newTestHandler(t)
+	file := createTestFile(t, h, "stale.bin", []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08})
+	result := saveFakeDetectorRun(t, h, file, "zlib", []byte("inflated"), true)
+
+	tests := []struct {
+		name       string
+		start      int64
+		length     int64
+		wantStatus int
+	}{
+		{"start past end", 64, 4, http.StatusBadRequest},
+		{"length past end", 4, 32, http.StatusBadRequest},
+		{"negative start", -1, 4, http.StatusBadRequest},
+		{"valid selection", 2, 4, http.StatusCreated},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h.db.GormDB.Model(&models.CompressionAnalysis{}).Where("id = ?", result.AnalysisID).
+				Updates(map[string]interface{}{"start_offset": tt.start, "length": tt.length})
+			// Reconstructed names must be unique per run
+			h.db.GormDB.Model(&models.File{}).Where("id = ?", file.ID).Update("name", fmt.Sprintf("stale%d.bin", i))
+
+			c, rec := newJSONContext(http.MethodPost, "/", nil)
+			c.SetParamNames("resultId")
+			c.SetParamValues(fmt.Sprint(result.ID))
+			if err := h.ReconstructFileWithDecompression(c); err != nil {
+				t.Fatalf("ReconstructFileWithDecompression() error = %v", err)
+			}
+			decodeJSON(t, rec, tt.wantStatus, nil)
+		})
+	}
+}
+
+// TestReconstructMultipleRegions splices two decompressed selections into one file
+func TestReconstructMultipleRegions(t *testing.T) {
+	h := newTestHandler(t)
+	file := createTestFile(t, h, "multi.bin", []byte("head[zz1]mid[zz2]tail"))
+
+	selectRange := func(result models.CompressionResult, start, length int64) {
+		h.db.GormDB.Model(&models.CompressionAnalysis{}).Where("id = ?", result.AnalysisID).
+			Updates(map[string]interface{}{"start_offset": start, "length": length})
+	}
+	first := saveFakeDetectorRun(t, h, file, "zlib", []byte("FIRST BLOCK"), true)
+	selectRange(first, 4, 5) // [zz1]
+	second := saveFakeDetectorRun(t, h, file, "gzip", []byte("2"), true)
+	selectRange(second, 12, 5) // [zz2]
+
+	reconstruct := func(ids ...uint) *httptest.ResponseRecorder {
+		var regions []map[string]uint
+		for _, id := range ids {
+			regions = append(regions, map[string]uint{"result_id": id})
+		}
+		c, rec := newJSONContext(http.MethodPost, "/reconstruct/multi", map[string]interface{}{"regions": regions})
+		if err := h.ReconstructFileWithMultipleDecompressions(c); err != nil {
+			t.Fatalf("ReconstructFileWithMultipleDecompressions() error = %v", err)
+		}
+		return rec
+	}
+
+	// Out of order selections are rejected
+	decodeJSON(t, reconstruct(second.ID, first.ID), http.StatusBadRequest, nil)
+
+	var resp struct {
+		File struct {
+			ID   uint  `json:"id"`
+			Size int64 `json:"size"`
+		} `json:"file"`
+		ReconstructionInfo struct {
+			Regions []struct {
+				ResultID  uint `json:"result_id"`
+				NewOffset int  `json:"new_offset"`
+			} `json:"regions"`
+		} `json:"reconstruction_info"`
+	}
+	decodeJSON(t, reconstruct(first.ID, second.ID), http.StatusCreated, &resp)
+
+	var got models.File
+	if err := h.db.GormDB.First(&got, resp.File.ID).Error; err != nil {
+		t.Fatalf("load reconstructed file: %v", err)
+	}
+	want := "headFIRST BLOCKmid2tail"
+	if string(got.Data) != want || resp.File.Size != int64(len(want)) {
+		t.Errorf("reconstructed = %q (size %d), want %q", got.Data, resp.File.Size, want)
+	}
+	if regions := resp.ReconstructionInfo.Regions; len(regions) != 2 || regions[0].NewOffset != 4 || regions[1].NewOffset != 18 {
+		t.Errorf("region info = %+v, want new offsets 4 and 18", regions)
+	}
+
+	// Overlapping selections are rejected
+	selectRange(second, 6, 5)
+	h.db.GormDB.Delete(&got)
+	decodeJSON(t, reconstruct(first.ID, second.ID), http.StatusBadRequest, nil)
+}
+
+// TestBuildDetectorArgsMethods checks the methods filter is passed to the script
+func TestBuildDetectorArgsMethods(t *testing.T) {
+	start, length := int64(16), int64(256)
+
+	tests := []struct {
+		name     string
+		methods  []string
+		wantFlag bool
+		wantArg  string
+	}{
+		{"no filter", nil, false, ""},
+		{"single method", []string{"rle"}, true, "rle"},
+		{"several methods", []string{"rle", "delta", "zlib"}, true, "rle,delta,zlib"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := buildDetectorArgs("/tmp/in.bin", "/tmp/out", "in.bin", &start, &length, tt.methods)
+
+			idx := -1
+			for i, a := range args {
+				if a == "--methods" {
+					idx = i
+				}
+			}
+			if (idx >= 0) != tt.wantFlag {
+				t.Fatalf("--methods present = %v, want %v (args %v)", idx >= 0, tt.wantFlag, args)
+			}
+			if tt.wantFlag && (idx+1 >= len(args) || args[idx+1] != tt.wantArg) {
+				t.Errorf("--methods value = %v, want %q", args[idx+1:], tt.wantArg)
+			}
+		})
+	}
+}
+
+// TestStartCompressionAnalysisUnknownMethod rejects method names the detector doesn't know
+func TestStartCompressionAnalysisUnknownMethod(t *testing.T) {
+	h := newTestHandler(t)
+	file := createTestFile(t, h, "methods.bin", []byte{0x00, 0x01})
+
+	c, rec := newJSONContext(http.MethodPost, "/", StartCompressionRequest{Methods: []string{"rle", "pkzip9000"}})
+	c.SetParamNames("fileId")
+	c.SetParamValues(fmt.Sprint(file.ID))
+	if err := h.StartCompressionAnalysis(c); err != nil {
+		t.Fatalf("StartCompressionAnalysis() error = %v", err)
+	}
+	decodeJSON(t, rec, http.StatusBadRequest, nil)
+
+	var count int64
+	h.db.GormDB.Model(&models.CompressionAnalysis{}).Count(&count)
+	if count != 0 {
+		t.Errorf("analysis records = %d, want 0", count)
+	}
+}
+
+// TestCompressionAnalysisRecordsCommand stores the detector command line and
+// reported version and returns them with the analysis
+func TestCompressionAnalysisRecordsCommand(t *testing.T) {
+	var gotArgs []string
+	old := runDetector
+	runDetector = func(args []string) ([]byte, error) {
+		gotArgs = args
+		return json.Marshal(PythonAnalysisReport{Version: "9.8.7"})
+	}
+	defer func() { runDetector = old }()
+
+	h := newTestHandler(t)
+	file := createTestFile(t, h, "my firmware.bin", []byte("0123456789abcdef"))
+	c, rec := newJSONContext(http.MethodPost, "/analysis/compression/1?sync=true&start_offset=4&length=8",
+		StartCompressionRequest{Methods: []string{"zlib", "rle"}})
+	c.SetParamNames("fileId")
+	c.SetParamValues(fmt.Sprint(file.ID))
+	if err := h.StartCompressionAnalysis(c); err != nil {
+		t.Fatalf("StartCompressionAnalysis() error = %v", err)
+	}
+	var started models.CompressionAnalysis
+	decodeJSON(t, rec, http.StatusOK, &started)
+
+	c, rec = newJSONContext(http.MethodGet, "/", nil)
+	c.SetParamNames("analysisId")
+	c.SetParamValues(fmt.Sprint(started.ID))
+	if err := h.GetCompressionAnalysis(c); err != nil {
+		t.Fatalf("GetCompressionAnalysis() error = %v", err)
+	}
+	var analysis models.CompressionAnalysis
+	decodeJSON(t, rec, http.StatusOK, &analysis)
+
+	if want := detectorCommandLine(gotArgs); analysis.DetectorCommand != want {
+		t.Errorf("detector_command = %q, want %q", analysis.DetectorCommand, want)
+	}
+	for _, part := range []string{"python3 /app/python_tools/compression_detector.py ", "--original-filename 'my firmware.bin'",
+		"--start-offset 4 --length 8 --methods zlib,rle"} {
+		if !strings.Contains(analysis.DetectorCommand, part) {
+			t.Errorf("detector_command %q does not contain %q", analysis.DetectorCommand, part)
+		}
+	}
+	if analysis.DetectorVersion != "9.8.7" {
+		t.Errorf("detector_version = %q, want 9.8.7", analysis.DetectorVersion)
+	}
+}
+
+// fakeDetector stands in for compression_detector.py: it "inflates" every input
+// with zlib and writes the output where the script would
+func fakeDetector(t *testing.T) {
+	t.Helper()
+	old := runDetector
+	t.Cleanup(func() { runDetector = old })
+
+	runDetector = func(args []string) ([]byte, error) {
+		var outputDir, name string
+		for i := 0; i+1 < len(args); i++ {
+			switch args[i] {
+			case "--output-dir":
+				outputDir = args[i+1]
+			case "--original-filename":
+				name = args[i+1]
+			}
+		}
+		payload := []byte("inflated")
+		outName := fmt.Sprintf("%s.zlib.decompressed", decompressedBaseName(name))
+		if err := os.WriteFile(filepath.Join(outputDir, outName), payload, 0644); err != nil {
+			return nil, err
+		}
+		best := "zlib"
+		return json.Marshal(PythonAnalysisReport{
+			TotalTests: 1, SuccessCount: 1, BestMethod: &best, BestRatio: 2,
+			Results: []PythonDecompressionResult{{Method: "zlib", Success: true, DecompressedSize: int64(len(payload))}},
+		})
+	}
+}
+
+// TestStartCompressionAnalysisSync returns results inline for small selections only
+func TestStartCompressionAnalysisSync(t *testing.T) {
+	fakeDetector(t)
+	h := newTestHandler(t)
+	file := createTestFile(t, h, "sync.bin", make([]byte, syncCompressionMaxBytes+1024))
+
+	start := func(query string) *httptest.ResponseRecorder {
+		c, rec := newJSONContext(http.MethodPost, "/analysis/compression/1?"+query, nil)
+		c.SetParamNames("fileId")
+		c.SetParamValues(fmt.Sprint(file.ID))
+		if err := h.StartCompressionAnalysis(c); err != nil {
+			t.Fatalf("StartCompressionAnalysis() error = %v", err)
+		}
+		return rec
+	}
+
+	// A small selection comes back completed, with its results
+	var analysis models.CompressionAnalysis
+	decodeJSON(t, start("sync=true&start_offset=16&length=256"), http.StatusOK, &analysis)
+	if analysis.Status != "completed" || len(analysis.Results) != 1 || analysis.Results[0].Method != "zlib" {
+		t.Fatalf("sync analysis = %+v, want completed with the zlib result", analysis)
+	}
+	if analysis.Results[0].DecompressedFileID == nil {
+		t.Error("sync analysis did not store the decompressed data")
+	}
+
+	// The whole file is over the limit: it becomes a background job
+	var job struct {
+		AnalysisID uint   `json:"analysis_id"`
+		Status     string `json:"status"`
+	}
+	decodeJSON(t, start("sync=true"), http.StatusCreated, &job)
+	if job.AnalysisID == 0 || job.AnalysisID == analysis.ID || job.Status != "pending" {
+		t.Errorf("large sync request = %+v, want a new pending job", job)
+	}
+
+	// Let the background job finish before the database is closed
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		var bg models.CompressionAnalysis
+		h.db.GormDB.First(&bg, job.AnalysisID)
+		if bg.Status == "completed" || bg.Status == "failed" {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("background analysis did not finish")
+}
+
+// TestCompressionAnalysisIndexedInRAG checks a completed analysis posts a
+// summary document to the RAG service
+func TestCompressionAnalysisIndexedInRAG(t *testing.T) {
+	fakeDetector(t)
+	indexed := make(chan services.RAGIndexRequest, 1)
+	rag := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req services.RAGIndexRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		indexed <- req
+		json.NewEncoder(w).Encode(services.RAGIndexResponseActual{ID: 1})
+	}))
+	defer rag.Close()
+	old := analysisRAG
+	analysisRAG = services.NewRAGService(rag.URL)
+	defer func() { analysisRAG = old }()
+
+	h := newTestHandler(t)
+	file := createTestFile(t, h, "firmware.bin", []byte("0123456789abcdef0123456789abcdef"))
+	c, rec := newJSONContext(http.MethodPost, "/analysis/compression/1?sync=true&start_offset=16&length=8", nil)
+	c.SetParamNames("fileId")
+	c.SetParamValues(fmt.Sprint(file.ID))
+	if err := h.StartCompressionAnalysis(c); err != nil {
+		t.Fatalf("StartCompressionAnalysis() error = %v", err)
+	}
+	var analysis models.CompressionAnalysis
+	decodeJSON(t, rec, http.StatusOK, &analysis)
+
+	select {
+	case doc := <-indexed:
+		if doc.Type != "analysis" || doc.Source != "file:firmware.bin" {
+			t.Errorf("indexed type=%q source=%q, want analysis from file:firmware.bin", doc.Type, doc.Source)
+		}
+		for _, want := range []string{"firmware.bin", "0x10-0x18", "Best method: zlib", "CRC32"} {
+			if !strings.Contains(doc.Content, want) {
+				t.Errorf("summary %q does not mention %q", doc.Content, want)
+			}
+		}
+		if doc.Metadata["kind"] != "compression" || doc.Metadata["analysis_id"] != fmt.Sprint(analysis.ID) || doc.Metadata["best_method"] != "zlib" {
+			t.Errorf("metadata = %v", doc.Metadata)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("completed analysis was not indexed")
+	}
+}
+
+// TestCompressionAnalysisNativeGzip decompresses a gzip stream in-process,
+// without running the detector, unless the request excludes gzip
+func TestCompressionAnalysisNativeGzip(t *testing.T) {
+	detectorRuns := 0
+	old := runDetector
+	runDetector = func(args []string) ([]byte, error) {
+		detectorRuns++
+		return json.Marshal(PythonAnalysisReport{})
+	}
+	defer func() { runDetector = old }()
+
+	payload := bytes.Repeat([]byte("lead I, lead II, lead III\n"), 200)
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(payload)
+	zw.Close()
+	data := append(append([]byte("HEADER01"), gz.Bytes()...), "trailer"...)
+
+	h := newTestHandler(t)
+	file := createTestFile(t, h, "record.bin", data)
+
+	c, rec := newJSONContext(http.MethodPost, "/analysis/compression/1?sync=true&start_offset=8", nil)
+	c.SetParamNames("fileId")
+	c.SetParamValues(fmt.Sprint(file.ID))
+	if err := h.StartCompressionAnalysis(c); err != nil {
+		t.Fatalf("StartCompressionAnalysis() error = %v", err)
+	}
+	var analysis models.CompressionAnalysis
+	decodeJSON(t, rec, http.StatusOK, &analysis)
+
+	if detectorRuns != 0 {
+		t.Errorf("detector ran %d times, want 0", detectorRuns)
+	}
+	if analysis.Status != "completed" || analysis.BestMethod != "gzip" || analysis.DetectorVersion != nativeDetectorVersion {
+		t.Fatalf("analysis = %s best=%s version=%s, want completed gzip %s",
+			analysis.Status, analysis.BestMethod, analysis.DetectorVersion, nativeDetectorVersion)
+	}
+	if len(analysis.Results) != 1 || analysis.Results[0].Method != "gzip" || !analysis.Results[0].ChecksumValid {
+		t.Fatalf("results = %+v, want one valid gzip result", analysis.Results)
+	}
+	decomp, err := h.loadDecompressedFile(analysis.Results[0])
+	if err != nil {
+		t.Fatalf("loadDecompressedFile() error = %v", err)
+	}
+	if !bytes.Equal(decomp.Data, payload) {
+		t.Errorf("decompressed %d bytes, want the %d byte payload", len(decomp.Data), len(payload))
+	}
+
+	// Restricted to other methods, the detector decides
+	c, rec = newJSONContext(http.MethodPost, "/analysis/compression/1?sync=true&start_offset=8",
+		StartCompressionRequest{Methods: []string{"rle"}})
+	c.SetParamNames("fileId")
+	c.SetParamValues(fmt.Sprint(file.ID))
+	if err := h.StartCompressionAnalysis(c); err != nil {
+		t.Fatalf("StartCompressionAnalysis() error = %v", err)
+	}
+	decodeJSON(t, rec, http.StatusOK, nil)
+	if detectorRuns != 1 {
+		t.Errorf("detector ran %d times, want 1", detectorRuns)
+	}
+}
+
+// TestCompressionResultPreview checks successful results carry the first
+// 256 decompressed bytes in hex and failed ones carry none
+func TestCompressionResultPreview(t *testing.T) {
+	h := newTestHandler(t)
+	file := createTestFile(t, h, "record.bin", []byte{0x01, 0x02})
+
+	data := make([]byte, 300)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	ok := models.CompressionResult{AnalysisID: 1, Method: "rle", Success: true}
+	if err := h.saveCompressionResult(context.Background(), &ok, file, data); err != nil {
+		t.Fatal(err)
+	}
+	failed := models.CompressionResult{AnalysisID: 1, Method: "lzw", Error: "bad code"}
+	if err := h.saveCompressionResult(context.Background(), &failed, file, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var stored []models.CompressionResult
+	h.db.GormDB.Where("analysis_id = ?", 1).Order("id").Find(&stored)
+	if len(stored) != 2 {
+		t.Fatalf("got %d results, want 2", len(stored))
+	}
+	decomp, err := h.loadDecompressedFile(stored[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := hex.EncodeToString(decomp.Data[:256]); stored[0].PreviewHex != want {
+		t.Errorf("preview_hex = %q, want %q", stored[0].PreviewHex, want)
+	}
+	if stored[1].PreviewHex != "" {
+		t.Errorf("failed result has preview_hex %q", stored[1].PreviewHex)
+	}
+}
@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"binary-annotator-pro/models"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxDecodeValues caps the number of values a decode pipeline produces
+const maxDecodeValues = 1 << 20
+
+// DecodeStage is one step of a decode pipeline. The first stage reads the
+// region as numbers; the following ones transform them.
+type DecodeStage struct {
+	Op string `json:"op"` // "read", "delta" or "scale"
+	// read: a value type, as for /search/sequence (int16le, uint8, float32be, ...)
+	Format string `json:"format,omitempty"`
+	// delta: how many times to integrate (running sum) differences, default 1
+	Order int `json:"order,omitempty"`
+	// scale: value = (value - baseline) * gain; gain defaults to 1
+	Gain     *float64 `json:"gain,omitempty"`
+	Baseline float64  `json:"baseline,omitempty"`
+}
+
+// DecodePipelineRequest decodes length bytes at offset through stages
+type DecodePipelineRequest struct {
+	FileID uint          `json:"file_id"`
+	Offset int           `json:"offset"`
+	Length int           `json:"length"` // 0: to the end of the file
+	Stages []DecodeStage `json:"stages"`
+	// MaxPoints, when set (at least 2), reduces the values to about that many
+	// by min/max decimation for plotting
+	MaxPoints int `json:"max_points,omitempty"`
+}
+
+// DecodePipelineResponse holds the values produced by the last stage
+type DecodePipelineResponse struct {
+	Values []float64 `json:"values"`
+	Count  int       `json:"count"`
+	// Leftover is the number of trailing bytes too short for a whole value
+	Leftover int `json:"leftover,omitempty"`
+	// Set when max_points reduced the values: the number of values decoded,
+	// and the index among them of each value returned (its x position)
+	SourceCount int   `json:"source_count,omitempty"`
+	Indices     []int `json:"indices,omitempty"`
+}
+
+// loadDecodeRegion returns length bytes of a file at offset (to the end of
+// the file when length is 0), or the HTTP status and error to answer with
+func (h *Handler) loadDecodeRegion(fileID uint, offset, length int) ([]byte, int, *APIError) {
+	if offset < 0 || length < 0 {
+		return nil, http.StatusBadRequest, &APIError{Code: ErrCodeOutOfRange, Message: "offset and length must be non-negative"}
+	}
+	var file models.File
+	if err := h.db.GormDB.First(&file, fileID).Error; err != nil {
+		return nil, http.StatusNotFound, &APIError{Code: ErrCodeFileNotFound, Message: "file not found"}
+	}
+	if offset >= len(file.Data) {
+		return nil, http.StatusBadRequest, &APIError{Code: ErrCodeOutOfRange, Message: "offset exceeds file size",
+			Details: map[string]any{"offset": offset, "file_size": len(file.Data)}}
+	}
+	end := len(file.Data)
+	if length > 0 && length < end-offset {
+		end = offset + length
+	}
+	return file.Data[offset:end], http.StatusOK, nil
+}
+
+// DecodePipeline reads a region as numbers and runs them through transform
+// stages, e.g. int16le samples stored as differences, integrated, then
+// converted to millivolts: read -> delta -> scale
+func (h *Handler) DecodePipeline(c echo.Context) error {
+	var req DecodePipelineRequest
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid request")
+	}
+	if len(req.Stages) == 0 || req.Stages[0].Op != "read" {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "the first stage must be a read")
+	}
+
+	data, status, apiErr := h.loadDecodeRegion(req.FileID, req.Offset, req.Length)
+	if apiErr != nil {
+		return c.JSON(status, apiErr)
+	}
+
+	if req.MaxPoints < 0 || req.MaxPoints == 1 {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "max_points must be at least 2")
+	}
+
+	values, leftover, apiErr := runDecodePipeline(data, req.Stages)
+	if apiErr != nil {
+		return c.JSON(http.StatusBadRequest, apiErr)
+	}
+	resp := DecodePipelineResponse{Values: values, Count: len(values), Leftover: leftover}
+	if req.MaxPoints > 0 && len(values) > req.MaxPoints {
+		resp.SourceCount = len(values)
+		resp.Values, resp.Indices = minMaxDecimate(values, req.MaxPoints)
+		resp.Count = len(resp.Values)
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// minMaxDecimate reduces values to at most maxPoints by splitting them into
+// maxPoints/2 buckets and keeping the minimum and maximum of each, in the
+// order they occur. Unlike averaging or picking every nth value, this keeps
+// every peak (an R wave, a pacing spike) in the plotted envelope. It returns
+// the values kept and their indices.
+func minMaxDecimate(values []float64, maxPoints int) ([]float64, []int) {
+	buckets := maxPoints / 2
+	out := make([]float64, 0, buckets*2)
+	indices := make([]int, 0, buckets*2)
+	for b := 0; b < buckets; b++ {
+		start, end := b*len(values)/buckets, (b+1)*len(values)/buckets
+		if start == end {
+			continue
+		}
+		lo, hi := start, start
+		for i := start + 1; i < end; i++ {
+			if values[i] < values[lo] {
+				lo = i
+			}
+			if values[i] > values[hi] {
+				hi = i
+			}
+		}
+		first, second := min(lo, hi), max(lo, hi)
+		out = append(out, values[first])
+		indices = append(indices, first)
+		if second != first {
+			out = append(out, values[second])
+			indices = append(indices, second)
+		}
+	}
+	return out, indices
+}
+
+// runDecodePipeline runs stages over data. stages[0] must be the read.
+func runDecodePipeline(data []byte, stages []DecodeStage) ([]float64, int, *APIError) {
+	dec, ok := sequenceDecoders[stages[0].Format]
+	if !ok {
+		return nil, 0, &APIError{Code: ErrCodeUnsupported, Message: fmt.Sprintf("stage 0: unsupported format %q", stages[0].Format)}
+	}
+	count := len(data) / dec.size
+	if count > maxDecodeValues {
+		return nil, 0, &APIError{Code: ErrCodeOutOfRange, Message: fmt.Sprintf("the region holds %d values, more than the %d allowed", count, maxDecodeValues)}
+	}
+	values := make([]float64, count)
+	for i := range values {
+		values[i] = dec.decode(data[i*dec.size : (i+1)*dec.size])
+	}
+
+	for n := 1; n < len(stages); n++ {
+		stage := stages[n]
+		switch stage.Op {
+		case "delta":
+			order := stage.Order
+			if order == 0 {
+				order = 1
+			}
+			if order < 0 || order > 4 {
+				return nil, 0, &APIError{Code: ErrCodeInvalidRequest, Message: fmt.Sprintf("stage %d: order must be between 1 and 4", n)}
+			}
+			for ; order > 0; order-- {
+				for i := 1; i < len(values); i++ {
+					values[i] += values[i-1]
+				}
+			}
+		case "scale":
+			gain := 1.0
+			if stage.Gain != nil {
+				gain = *stage.Gain
+			}
+			for i, v := range values {
+				values[i] = (v - stage.Baseline) * gain
+			}
+		case "read":
+			return nil, 0, &APIError{Code: ErrCodeInvalidRequest, Message: fmt.Sprintf("stage %d: only the first stage may read", n)}
+		default:
+			return nil, 0, &APIError{Code: ErrCodeUnsupported, Message: fmt.Sprintf("stage %d: unknown op %q", n, stage.Op)}
+		}
+	}
+
+	// JSON has no NaN or infinity
+	for i, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, 0, &APIError{Code: ErrCodeInvalidRequest, Message: fmt.Sprintf("value %d is not a finite number", i),
+				Details: map[string]any{"index": i}}
+		}
+	}
+	return values, len(data) % dec.size, nil
+}
+
+// maxBCDBytes caps a BCD read; 10 bytes hold the 20 digits of a uint64
+const maxBCDBytes = 32
+
+// BCDDecodeRequest reads length bytes at offset as packed BCD
+type BCDDecodeRequest struct {
+	FileID      uint   `json:"file_id"`
+	Offset      int    `json:"offset"`
+	Length      int    `json:"length"`       // 1-32 bytes
+	NibbleOrder string `json:"nibble_order"` // "high" (default: high nibble is the first digit) or "low"
+}
+
+// BCDDecodeResponse holds the digits read. Value is set when they fit a uint64.
+type BCDDecodeResponse struct {
+	Offset int     `json:"offset"`
+	Length int     `json:"length"`
+	Digits string  `json:"digits"`
+	Value  *uint64 `json:"value,omitempty"`
+}
+
+// DecodeBCD reads a region as packed BCD (serial numbers, dates, ...). A
+// trailing 0xF nibble is taken as filler and dropped.
+func (h *Handler) DecodeBCD(c echo.Context) error {
+	var req BCDDecodeRequest
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid request")
+	}
+	if req.Length < 1 || req.Length > maxBCDBytes {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("length must be 1-%d", maxBCDBytes))
+	}
+	if req.NibbleOrder == "" {
+		req.NibbleOrder = "high"
+	}
+	if req.NibbleOrder != "high" && req.NibbleOrder != "low" {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "nibble_order must be high or low")
+	}
+
+	data, status, apiErr := h.loadDecodeRegion(req.FileID, req.Offset, req.Length)
+	if apiErr != nil {
+		return c.JSON(status, apiErr)
+	}
+	if len(data) < req.Length {
+		return apiErrorDetails(c, http.StatusBadRequest, ErrCodeOutOfRange, "region extends past the end of the file",
+			map[string]any{"offset": req.Offset, "length": req.Length})
+	}
+
+	digits, bad := decodeBCD(data, req.NibbleOrder == "high")
+	if bad >= 0 {
+		return apiErrorDetails(c, http.StatusBadRequest, ErrCodeInvalidRequest, "not BCD: nibble above 9",
+			map[string]any{"offset": req.Offset + bad})
+	}
+
+	resp := BCDDecodeResponse{Offset: req.Offset, Length: req.Length, Digits: digits}
+	if v, err := strconv.ParseUint(digits, 10, 64); err == nil {
+		resp.Value = &v
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// decodeBCD returns the digits of packed BCD data, or the index of the first
+// byte holding a nibble above 9 (other than a final 0xF filler)
+func decodeBCD(data []byte, highFirst bool) (string, int) {
+	digits := make([]byte, 0, len(data)*2)
+	for i, b := range data {
+		first, second := b>>4, b&0x0F
+		if !highFirst {
+			first, second = second, first
+		}
+		if first > 9 {
+			return "", i
+		}
+		digits = append(digits, '0'+first)
+		if second == 0x0F && i == len(data)-1 {
+			break
+		}
+		if second > 9 {
+			return "", i
+		}
+		digits = append(digits, '0'+second)
+	}
+	return string(digits), -1
+}
+
+// maxVarintBytes is the longest LEB128 encoding of a uint64
+const maxVarintBytes = binary.MaxVarintLen64
+
+// VarintDecodeRequest reads an unsigned LEB128 value at offset
+type VarintDecodeRequest struct {
+	FileID uint `json:"file_id"`
+	Offset int  `json:"offset"`
+}
+
+// VarintDecodeResponse holds the value and the number of bytes it used
+type VarintDecodeResponse struct {
+	Offset int    `json:"offset"`
+	Value  uint64 `json:"value"`
+	Bytes  int    `json:"bytes"`
+}
+
+// DecodeVarint reads an unsigned LEB128 (protobuf-style) varint: 7 bits per
+// byte, least significant group first, the high bit set on all but the last
+func (h *Handler) DecodeVarint(c echo.Context) error {
+	var req VarintDecodeRequest
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid request")
+	}
+
+	data, status, apiErr := h.loadDecodeRegion(req.FileID, req.Offset, maxVarintBytes)
+	if apiErr != nil {
+		return c.JSON(status, apiErr)
+	}
+
+	value, n := binary.Uvarint(data)
+	switch {
+	case n == 0 && len(data) < maxVarintBytes:
+		return apiErrorDetails(c, http.StatusBadRequest, ErrCodeOutOfRange, "varint runs past the end of the file",
+			map[string]any{"offset": req.Offset})
+	case n <= 0:
+		return apiErrorDetails(c, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("varint longer than %d bytes or above the uint64 range", maxVarintBytes),
+			map[string]any{"offset": req.Offset})
+	}
+	return c.JSON(http.StatusOK, VarintDecodeResponse{Offset: req.Offset, Value: value, Bytes: n})
+}
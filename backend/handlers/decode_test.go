@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"encoding/binary"
+	"math"
+	"net/http"
+	"testing"
+)
+
+func TestDecodePipelineReadDeltaScale(t *testing.T) {
+	h := newTestHandler(t)
+
+	// int16le differences after a 4-byte header
+	diffs := []int16{100, -3, 7, 0, -20, 5}
+	data := []byte{0xDE, 0xAD, 0xBE, 0xEF}
+	for _, d := range diffs {
+		data = binary.LittleEndian.AppendUint16(data, uint16(d))
+	}
+	file := createTestFile(t, h, "ecg-delta.bin", data)
+
+	c, rec := newJSONContext(http.MethodPost, "/decode/pipeline", map[string]interface{}{
+		"file_id": file.ID,
+		"offset":  4,
+		"stages": []map[string]interface{}{
+			{"op": "read", "format": "int16le"},
+			{"op": "delta"},
+			{"op": "scale", "gain": 0.005, "baseline": 90},
+		},
+	})
+	if err := h.DecodePipeline(c); err != nil {
+		t.Fatal(err)
+	}
+	var resp DecodePipelineResponse
+	decodeJSON(t, rec, http.StatusOK, &resp)
+
+	var sum float64
+	want := make([]float64, len(diffs))
+	for i, d := range diffs {
+		sum += float64(d)
+		want[i] = (sum - 90) * 0.005
+	}
+	if resp.Count != len(want) {
+		t.Fatalf("count = %d, want %d", resp.Count, len(want))
+	}
+	for i := range want {
+		if math.Abs(resp.Values[i]-want[i]) > 1e-9 {
+			t.Errorf("values[%d] = %v, want %v", i, resp.Values[i], want[i])
+		}
+	}
+}
+
+func TestDecodePipelineRejectsBadStages(t *testing.T) {
+	h := newTestHandler(t)
+	file := createTestFile(t, h, "p.bin", []byte{1, 2, 3, 4})
+
+	tests := []struct {
+		name   string
+		stages []map[string]interface{}
+		code   string
+	}{
+		{"no read first", []map[string]interface{}{{"op": "delta"}}, ErrCodeInvalidRequest},
+		{"unknown format", []map[string]interface{}{{"op": "read", "format": "int24le"}}, ErrCodeUnsupported},
+		{"unknown op", []map[string]interface{}{{"op": "read", "format": "uint8"}, {"op": "fft"}}, ErrCodeUnsupported},
+		{"second read", []map[string]interface{}{{"op": "read", "format": "uint8"}, {"op": "read", "format": "uint8"}}, ErrCodeInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, rec := newJSONContext(http.MethodPost, "/decode/pipeline", map[string]interface{}{"file_id": file.ID, "stages": tt.stages})
+			if err := h.DecodePipeline(c); err != nil {
+				t.Fatal(err)
+			}
+			var apiErr APIError
+			decodeJSON(t, rec, http.StatusBadRequest, &apiErr)
+			if apiErr.Code != tt.code {
+				t.Errorf("code = %q, want %q (%s)", apiErr.Code, tt.code, apiErr.Message)
+			}
+		})
+	}
+}
+
+func TestDecodeBCDDate(t *testing.T) {
+	h := newTestHandler(t)
+	// Recording date 2023-11-15 as packed BCD, then the same date nibble-swapped
+	file := createTestFile(t, h, "header.bin", []byte{0xAA, 0x20, 0x23, 0x11, 0x15, 0x02, 0x32, 0x11, 0x51})
+
+	tests := []struct {
+		offset int
+		order  string
+	}{
+		{1, ""},
+		{5, "low"},
+	}
+	for _, tt := range tests {
+		c, rec := newJSONContext(http.MethodPost, "/decode/bcd", map[string]interface{}{
+			"file_id": file.ID, "offset": tt.offset, "length": 4, "nibble_order": tt.order,
+		})
+		if err := h.DecodeBCD(c); err != nil {
+			t.Fatal(err)
+		}
+		var resp BCDDecodeResponse
+		decodeJSON(t, rec, http.StatusOK, &resp)
+		if resp.Digits != "20231115" || resp.Value == nil || *resp.Value != 20231115 {
+			t.Errorf("offset %d: digits=%q value=%v, want 20231115", tt.offset, resp.Digits, resp.Value)
+		}
+	}
+
+	// 0xAA is not BCD
+	c, rec := newJSONContext(http.MethodPost, "/decode/bcd", map[string]interface{}{"file_id": file.ID, "offset": 0, "length": 2})
+	if err := h.DecodeBCD(c); err != nil {
+		t.Fatal(err)
+	}
+	var apiErr APIError
+	decodeJSON(t, rec, http.StatusBadRequest, &apiErr)
+	if apiErr.Details["offset"] != float64(0) {
+		t.Errorf("details = %v, want the offset of the bad byte", apiErr.Details)
+	}
+}
+
+func TestDecodeVarint(t *testing.T) {
+	h := newTestHandler(t)
+	data := []byte{
+		0x96, 0x01, // 150
+		0xAC, 0x02, // 300
+		0xE5, 0x8E, 0x26, // 624485
+		0x7F,                                                             // 127
+		0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x01, // runaway
+		0x80, // truncated at the end of the file
+	}
+	file := createTestFile(t, h, "varints.bin", data)
+
+	tests := []struct {
+		offset int
+		value  uint64
+		bytes  int
+	}{
+		{0, 150, 2},
+		{2, 300, 2},
+		{4, 624485, 3},
+		{7, 127, 1},
+	}
+	for _, tt := range tests {
+		c, rec := newJSONContext(http.MethodPost, "/decode/varint", map[string]interface{}{"file_id": file.ID, "offset": tt.offset})
+		if err := h.DecodeVarint(c); err != nil {
+			t.Fatal(err)
+		}
+		var resp VarintDecodeResponse
+		decodeJSON(t, rec, http.StatusOK, &resp)
+		if resp.Value != tt.value || resp.Bytes != tt.bytes {
+			t.Errorf("offset %d: got %d in %d bytes, want %d in %d", tt.offset, resp.Value, resp.Bytes, tt.value, tt.bytes)
+		}
+	}
+
+	for _, tt := range []struct {
+		offset int
+		code   string
+	}{{8, ErrCodeInvalidRequest}, {len(data) - 1, ErrCodeOutOfRange}} {
+		c, rec := newJSONContext(http.MethodPost, "/decode/varint", map[string]interface{}{"file_id": file.ID, "offset": tt.offset})
+		if err := h.DecodeVarint(c); err != nil {
+			t.Fatal(err)
+		}
+		var apiErr APIError
+		decodeJSON(t, rec, http.StatusBadRequest, &apiErr)
+		if apiErr.Code != tt.code {
+			t.Errorf("offset %d: code = %q, want %q (%s)", tt.offset, apiErr.Code, tt.code, apiErr.Message)
+		}
+	}
+}
+
+// TestDecodePipelineMaxPoints reduces 10 s of a 1000 Hz int16 signal to about
+// 500 points and keeps the single-sample spike and the trough
+func TestDecodePipelineMaxPoints(t *testing.T) {
+	h := newTestHandler(t)
+	var data []byte
+	for i := 0; i < 10000; i++ {
+		v := int16(200 * math.Sin(2*math.Pi*float64(i)/1000))
+		switch i {
+		case 6543:
+			v = 4000
+		case 7777:
+			v = -3000
+		}
+		data = binary.LittleEndian.AppendUint16(data, uint16(v))
+	}
+	file := createTestFile(t, h, "lead-ii.bin", data)
+
+	c, rec := newJSONContext(http.MethodPost, "/decode/pipeline", map[string]interface{}{
+		"file_id":    file.ID,
+		"stages":     []map[string]interface{}{{"op": "read", "format": "int16le"}},
+		"max_points": 500,
+	})
+	if err := h.DecodePipeline(c); err != nil {
+		t.Fatal(err)
+	}
+	var resp DecodePipelineResponse
+	decodeJSON(t, rec, http.StatusOK, &resp)
+
+	if resp.SourceCount != 10000 || resp.Count > 500 || resp.Count < 400 || len(resp.Indices) != resp.Count {
+		t.Fatalf("source_count = %d, count = %d, %d indices; want 10000 reduced to ~500", resp.SourceCount, resp.Count, len(resp.Indices))
+	}
+	found := map[int]float64{}
+	for i, idx := range resp.Indices {
+		if i > 0 && idx <= resp.Indices[i-1] {
+			t.Fatalf("indices not increasing at %d: %d after %d", i, idx, resp.Indices[i-1])
+		}
+		found[idx] = resp.Values[i]
+	}
+	if found[6543] != 4000 || found[7777] != -3000 {
+		t.Errorf("spike = %v, trough = %v, want 4000 and -3000 kept", found[6543], found[7777])
+	}
+
+	// max_points above the count returns every value
+	c, rec = newJSONContext(http.MethodPost, "/decode/pipeline", map[string]interface{}{
+		"file_id":    file.ID,
+		"stages":     []map[string]interface{}{{"op": "read", "format": "int16le"}},
+		"max_points": 20000,
+	})
+	if err := h.DecodePipeline(c); err != nil {
+		t.Fatal(err)
+	}
+	resp = DecodePipelineResponse{}
+	decodeJSON(t, rec, http.StatusOK, &resp)
+	if resp.Count != 10000 || resp.Indices != nil {
+		t.Errorf("count = %d with %d indices, want all 10000 values", resp.Count, len(resp.Indices))
+	}
+}
+
+// TestLoadDecodeRegionHugeLength checks a length that would overflow
+// offset+length reads to the end of the file instead of panicking
+func TestLoadDecodeRegionHugeLength(t *testing.T) {
+	h := newTestHandler(t)
+	file := createTestFile(t, h, "region.bin", []byte{1, 2, 3, 4})
+
+	data, status, apiErr := h.loadDecodeRegion(file.ID, 1, math.MaxInt)
+	if apiErr != nil {
+		t.Fatalf("status %d: %v", status, apiErr.Message)
+	}
+	if len(data) != 3 || data[0] != 2 {
+		t.Errorf("region = %v, want [2 3 4]", data)
+	}
+}
@@ -0,0 +1,190 @@
+package handlers
+
+// deltaLineSize is how far diffBytes advances per step when no chunks are
+// collected
+const deltaLineSize = 4096
+
+// diffOptions selects what diffBytes collects. Lines start every LineSize
+// bytes from Start up to End; a line covers LineSize bytes, cut only at the
+// ends of the files.
+type diffOptions struct {
+	Start, End int
+
+	// LineSize > 0 collects a DiffChunk per line
+	LineSize int
+	// KeepEqual also collects lines without differences
+	KeepEqual bool
+	// MaxChunks stops collecting chunks once that many were found, 0 for
+	// no limit
+	MaxChunks int
+
+	// Delta collects the stats, byte changes and changed regions of
+	// [Start, End)
+	Delta           bool
+	MinRegionSize   int
+	MaxChangePoints int
+}
+
+// diffResult is what a diffBytes pass found
+type diffResult struct {
+	Chunks      []DiffChunk
+	TotalChunks int // lines compared before MaxChunks was reached
+	Truncated   bool
+	Delta       DeltaAnalysisResponse
+}
+
+// diffBytes compares two files position by position in one pass, bytes past
+// the end of the shorter file counting as 0. The diff, delta and streaming
+// comparisons are all views of its result.
+func diffBytes(data1, data2 []byte, opts diffOptions) diffResult {
+	res := diffResult{Chunks: []DiffChunk{}}
+	delta := deltaTracker{minRegionSize: opts.MinRegionSize, maxChanges: opts.MaxChangePoints, start: opts.Start}
+
+	chunking := opts.LineSize > 0
+	step := opts.LineSize
+	if !chunking {
+		step = deltaLineSize
+	}
+	for offset := opts.Start; offset < opts.End; offset += step {
+		if chunking && opts.MaxChunks > 0 && len(res.Chunks) >= opts.MaxChunks {
+			res.Truncated = true
+			chunking = false
+		}
+		if !chunking && !opts.Delta {
+			break
+		}
+
+		if chunking {
+			chunk := diffLine(data1, data2, offset, opts.LineSize)
+			if opts.KeepEqual || chunk.Type != "equal" {
+				res.Chunks = append(res.Chunks, chunk)
+			}
+			res.TotalChunks++
+		}
+		if opts.Delta {
+			for i := offset; i < min(offset+step, opts.End); i++ {
+				delta.add(i, byteAt(data1, i), byteAt(data2, i))
+			}
+		}
+	}
+
+	if opts.Delta {
+		res.Delta = delta.result(opts.End, len(data1), len(data2))
+	}
+	return res
+}
+
+// diffLine compares the size bytes of both files at offset. Lines present
+// in only one file are "added" or "removed" and have no mask.
+func diffLine(data1, data2 []byte, offset, size int) DiffChunk {
+	bytes1 := []uint8{}
+	bytes2 := []uint8{}
+	if offset < len(data1) {
+		bytes1 = data1[offset:min(offset+size, len(data1))]
+	}
+	if offset < len(data2) {
+		bytes2 = data2[offset:min(offset+size, len(data2))]
+	}
+
+	chunk := DiffChunk{Offset: offset, Type: "equal", Bytes1: bytes1, Bytes2: bytes2, DiffMask: []bool{}}
+	switch {
+	case len(bytes1) == 0 && len(bytes2) > 0:
+		chunk.Type = "added"
+	case len(bytes1) > 0 && len(bytes2) == 0:
+		chunk.Type = "removed"
+	case len(bytes1) > 0 && len(bytes2) > 0:
+		for i := range max(len(bytes1), len(bytes2)) {
+			differs := byteAt(bytes1, i) != byteAt(bytes2, i)
+			chunk.DiffMask = append(chunk.DiffMask, differs)
+			if differs {
+				chunk.Type = "modified"
+			}
+		}
+	}
+	return chunk
+}
+
+// byteAt is data[i], or 0 past the end of data
+func byteAt(data []byte, i int) uint8 {
+	if i < len(data) {
+		return data[i]
+	}
+	return 0
+}
+
+// deltaTracker accumulates the delta analysis one position at a time. A
+// changed region ends after minRegionSize unchanged bytes.
+type deltaTracker struct {
+	minRegionSize int
+	maxChanges    int
+	start         int
+
+	changed, unchanged        int
+	currentUnchanged, longest int
+	changes                   []ByteChange
+	regions                   []ChangedRegion
+	inRegion                  bool
+	regionStart               int
+}
+
+func (d *deltaTracker) add(i int, b1, b2 uint8) {
+	if b1 != b2 {
+		d.changed++
+		d.currentUnchanged = 0
+		if len(d.changes) < d.maxChanges {
+			d.changes = append(d.changes, ByteChange{Offset: i, Old: b1, New: b2})
+		}
+		if !d.inRegion {
+			d.inRegion = true
+			d.regionStart = i
+		}
+		return
+	}
+
+	d.unchanged++
+	d.currentUnchanged++
+	d.longest = max(d.longest, d.currentUnchanged)
+	if d.inRegion && d.currentUnchanged >= d.minRegionSize {
+		regionEnd := i - d.minRegionSize
+		if regionEnd > d.regionStart {
+			d.regions = append(d.regions, ChangedRegion{Start: d.regionStart, End: regionEnd, Length: regionEnd - d.regionStart})
+		}
+		d.inRegion = false
+	}
+}
+
+// result closes a region still open at end and returns the analysis
+func (d *deltaTracker) result(end, size1, size2 int) DeltaAnalysisResponse {
+	changes := d.changes
+	if changes == nil {
+		changes = []ByteChange{}
+	}
+	regions := d.regions
+	if regions == nil {
+		regions = []ChangedRegion{}
+	}
+	if d.inRegion {
+		regions = append(regions, ChangedRegion{Start: d.regionStart, End: end, Length: end - d.regionStart})
+	}
+
+	total := max(end-d.start, 0)
+	percentChanged := 0.0
+	if total > 0 {
+		percentChanged = float64(d.changed) / float64(total) * 100
+	}
+	return DeltaAnalysisResponse{
+		Stats: DiffStats{
+			TotalBytes:       total,
+			ChangedBytes:     d.changed,
+			UnchangedBytes:   d.unchanged,
+			PercentChanged:   percentChanged,
+			File1Size:        size1,
+			File2Size:        size2,
+			SizeDifference:   size2 - size1,
+			ChangedRegions:   len(regions),
+			LongestUnchanged: d.longest,
+		},
+		Changes: changes,
+		Regions: regions,
+	}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ecgConversionScript calibrates ECG CSV data with pandas
+const ecgConversionScript = "python_tools/Conversion.py"
+
+// ecgPythonPaths are the interpreters tried for ecgConversionScript, the
+// local venv first, then the Docker image's. A variable so tests can point
+// it elsewhere.
+var ecgPythonPaths = []string{"python_tools/venv/bin/python3", "/app/venv/bin/python3"}
+
+// ecgConversionPython returns the interpreter to run ecgConversionScript
+// with, or false when no venv or the script is missing
+func ecgConversionPython() (string, bool) {
+	if _, err := os.Stat(ecgConversionScript); err != nil {
+		return "", false
+	}
+	for _, path := range ecgPythonPaths {
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// convertADCToVoltage scales raw ADC counts to the units of adcRange:
+// value / (2^adcBits - 1) * adcRange. It keeps the CSV layout: a header row
+// (any row that isn't all numbers) is copied, and time/timestamp columns are
+// left as they are. Unlike Conversion.py it doesn't remove the baseline.
+func convertADCToVoltage(csvData string, adcBits int, adcRange float64) ([][]string, error) {
+	if adcBits < 1 || adcBits > 32 {
+		return nil, fmt.Errorf("adcBits must be between 1 and 32")
+	}
+	records, err := csv.NewReader(strings.NewReader(csvData)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV format: %v", err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("CSV data is empty")
+	}
+
+	scale := adcRange / (math.Pow(2, float64(adcBits)) - 1)
+	keep := map[int]bool{} // columns copied unscaled
+	start := 0
+	if !numericRow(records[0]) {
+		for i, name := range records[0] {
+			if strings.Contains(strings.ToLower(name), "time") {
+				keep[i] = true
+			}
+		}
+		start = 1
+	}
+
+	out := make([][]string, len(records))
+	out[0] = records[0]
+	for i := start; i < len(records); i++ {
+		row := make([]string, len(records[i]))
+		for j, field := range records[i] {
+			if keep[j] {
+				row[j] = field
+				continue
+			}
+			v, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value on line %d: %q", i+1, field)
+			}
+			row[j] = strconv.FormatFloat(v*scale, 'g', -1, 64)
+		}
+		out[i] = row
+	}
+	return out, nil
+}
+
+// numericRow reports whether every field of a CSV row is a number
+func numericRow(row []string) bool {
+	for _, field := range row {
+		if _, err := strconv.ParseFloat(strings.TrimSpace(field), 64); err != nil {
+			return false
+		}
+	}
+	return len(row) > 0
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"testing"
+)
+
+// TestConvertECGDataGoFallback scales multi-lead ADC counts in Go when no
+// Python venv is available
+func TestConvertECGDataGoFallback(t *testing.T) {
+	old := ecgPythonPaths
+	ecgPythonPaths = []string{"/nonexistent/venv/bin/python3"}
+	defer func() { ecgPythonPaths = old }()
+
+	h := newTestHandler(t)
+	c, rec := newJSONContext(http.MethodPost, "/convert/ecg", map[string]interface{}{
+		"csvData":  "Lead_I,Lead_II\n0,4095\n2048,1024\n-100,1\n",
+		"adcBits":  12,
+		"adcRange": 10,
+	})
+	if err := h.ConvertECGData(c); err != nil {
+		t.Fatalf("ConvertECGData() error = %v", err)
+	}
+	if got := rec.Header().Get("X-ECG-Converter"); got != "go" {
+		t.Errorf("X-ECG-Converter = %q, want go", got)
+	}
+	var resp struct {
+		Type      string      `json:"type"`
+		LeadNames []string    `json:"leadNames"`
+		Leads     [][]float64 `json:"leads"`
+		Count     int         `json:"count"`
+	}
+	decodeJSON(t, rec, http.StatusOK, &resp)
+
+	if resp.Type != "multi-lead" || resp.Count != 3 || len(resp.Leads) != 2 {
+		t.Fatalf("response = %+v, want 2 leads of 3 samples", resp)
+	}
+	want := [][]float64{
+		{0, 2048.0 / 4095 * 10, -100.0 / 4095 * 10},
+		{10, 1024.0 / 4095 * 10, 1.0 / 4095 * 10},
+	}
+	for lead := range want {
+		for i, w := range want[lead] {
+			if math.Abs(resp.Leads[lead][i]-w) > 1e-9 {
+				t.Errorf("%s[%d] = %v, want %v", resp.LeadNames[lead], i, resp.Leads[lead][i], w)
+			}
+		}
+	}
+}
+
+// TestConvertADCToVoltageLayouts keeps timestamps unscaled and scales a
+// headerless column
+func TestConvertADCToVoltageLayouts(t *testing.T) {
+	records, err := convertADCToVoltage("timestamp,value\n0.5,255\n1.0,0\n", 8, 5)
+	if err != nil {
+		t.Fatalf("convertADCToVoltage() error = %v", err)
+	}
+	if records[0][1] != "value" || records[1][0] != "0.5" || records[1][1] != "5" || records[2][1] != "0" {
+		t.Errorf("timestamp layout = %v", records)
+	}
+
+	records, err = convertADCToVoltage("255\n51\n", 8, 5)
+	if err != nil {
+		t.Fatalf("convertADCToVoltage() error = %v", err)
+	}
+	if records[0][0] != "5" || records[1][0] != "1" {
+		t.Errorf("headerless layout = %v, want 5 and 1", records)
+	}
+
+	if _, err := convertADCToVoltage("Lead_I\nabc\n", 12, 10); err == nil {
+		t.Error("non-numeric sample accepted")
+	}
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import "github.com/labstack/echo/v4"
+
+// Error codes returned in APIError.Code. Clients branch on these rather than
+// on the message text.
+const (
+	ErrCodeInvalidRequest = "invalid_request" // malformed body or missing/invalid parameter
+	ErrCodeFileNotFound   = "file_not_found"
+	ErrCodeNotFound       = "not_found"    // some other resource (analysis, result, ...)
+	ErrCodeOutOfRange     = "out_of_range" // offset/length outside the file or allowed bounds
+	ErrCodeUnsupported    = "unsupported"  // unknown search type, algorithm, method, ...
+	ErrCodeConflict       = "conflict"
+	ErrCodeBusy           = "busy"      // a limit on concurrent work was reached; retry later
+	ErrCodeTooLarge       = "too_large" // request body or file over the size limit, see middleware.BodyLimit
+	ErrCodeCanceled       = "canceled"  // the client went away before the work finished
+	ErrCodeInternal       = "internal_error"
+)
+
+// errCodes lists every error code, for the Error schema of /openapi.json
+var errCodes = []string{
+	ErrCodeInvalidRequest, ErrCodeFileNotFound, ErrCodeNotFound, ErrCodeOutOfRange, ErrCodeUnsupported,
+	ErrCodeConflict, ErrCodeBusy, ErrCodeTooLarge, ErrCodeCanceled, ErrCodeInternal,
+}
+
+// APIError is the JSON error body. The message stays under "error" so clients
+// that only read that field keep working.
+type APIError struct {
+	Code    string         `json:"code"`
+	Message string         `json:"error"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+func (e *APIError) Error() string { return e.Message }
+
+// apiError writes an APIError with the given HTTP status
+func apiError(c echo.Context, status int, code, message string) error {
+	return c.JSON(status, &APIError{Code: code, Message: message})
+}
+
+// apiErrorDetails writes an APIError with extra machine-readable context
+func apiErrorDetails(c echo.Context, status int, code, message string, details map[string]any) error {
+	return c.JSON(status, &APIError{Code: code, Message: message, Details: details})
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+)
+
+// TestAPIErrorCodes checks that known failures carry a stable code alongside the message
+func TestAPIErrorCodes(t *testing.T) {
+	h := newTestHandler(t)
+	file := createTestFile(t, h, "errors.bin", []byte{1, 2, 3, 4})
+
+	c, rec := newJSONContext(http.MethodPost, "/checksum", ChecksumRequest{FileID: file.ID, Offset: 10, Length: 2})
+	if err := h.CalculateChecksum(c); err != nil {
+		t.Fatalf("CalculateChecksum() error = %v", err)
+	}
+	var apiErr APIError
+	decodeJSON(t, rec, http.StatusBadRequest, &apiErr)
+	if apiErr.Code != ErrCodeOutOfRange || apiErr.Message == "" {
+		t.Errorf("got %+v, want code %q with a message", apiErr, ErrCodeOutOfRange)
+	}
+	if apiErr.Details["file_size"] != float64(4) {
+		t.Errorf("details = %v, want file_size 4", apiErr.Details)
+	}
+
+	c, rec = newJSONContext(http.MethodPost, "/checksum", ChecksumRequest{FileID: file.ID + 100, Length: 2})
+	if err := h.CalculateChecksum(c); err != nil {
+		t.Fatalf("CalculateChecksum() error = %v", err)
+	}
+	apiErr = APIError{}
+	decodeJSON(t, rec, http.StatusNotFound, &apiErr)
+	if apiErr.Code != ErrCodeFileNotFound {
+		t.Errorf("code = %q, want %q", apiErr.Code, ErrCodeFileNotFound)
+	}
+
+	sh := NewSearchHandler(h.db)
+	c, rec = newJSONContext(http.MethodPost, "/search", SearchRequest{FileName: file.Name, Type: "nonsense", Value: "1"})
+	if err := sh.Search(c); err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	apiErr = APIError{}
+	decodeJSON(t, rec, http.StatusBadRequest, &apiErr)
+	if apiErr.Code != ErrCodeUnsupported {
+		t.Errorf("code = %q, want %q", apiErr.Code, ErrCodeUnsupported)
+	}
+}
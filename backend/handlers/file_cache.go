@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"binary-annotator-pro/middleware"
+	"binary-annotator-pro/models"
+	"container/list"
+	"log"
+	"os"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// defaultFileCacheSize bounds the contents kept by fileCache unless
+// FILE_CACHE_SIZE says otherwise
+const defaultFileCacheSize = 256 << 20
+
+// fileCache keeps the contents of recently loaded files by file ID, least
+// recently used first out once the total size is over max, so repeated
+// searches, checksums and comparisons on a file don't reload the blob.
+// Cached slices are shared: callers must not modify them.
+type fileCache struct {
+	mu    sync.Mutex
+	max   int64
+	size  int64
+	order *list.List // of *fileCacheEntry, most recently used at the front
+	items map[uint]*list.Element
+}
+
+type fileCacheEntry struct {
+	id   uint
+	data []byte
+}
+
+func newFileCache(max int64) *fileCache {
+	return &fileCache{max: max, order: list.New(), items: map[uint]*list.Element{}}
+}
+
+// newFileCacheFromEnv sizes the cache from FILE_CACHE_SIZE (bytes or
+// KB/MB/GB); 0 turns it off
+func newFileCacheFromEnv() *fileCache {
+	size := int64(defaultFileCacheSize)
+	if v := os.Getenv("FILE_CACHE_SIZE"); v != "" {
+		n, err := middleware.ParseSize(v)
+		if err != nil || n < 0 {
+			log.Printf("Ignoring invalid FILE_CACHE_SIZE %q", v)
+		} else {
+			size = n
+		}
+	}
+	return newFileCache(size)
+}
+
+func (fc *fileCache) get(id uint) ([]byte, bool) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	el, ok := fc.items[id]
+	if !ok {
+		return nil, false
+	}
+	fc.order.MoveToFront(el)
+	return el.Value.(*fileCacheEntry).data, true
+}
+
+// put caches data for id; contents larger than the whole cache are not kept
+func (fc *fileCache) put(id uint, data []byte) {
+	if int64(len(data)) > fc.max {
+		return
+	}
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if el, ok := fc.items[id]; ok {
+		fc.size -= int64(len(el.Value.(*fileCacheEntry).data))
+		fc.order.Remove(el)
+	}
+	fc.items[id] = fc.order.PushFront(&fileCacheEntry{id: id, data: data})
+	fc.size += int64(len(data))
+	for fc.size > fc.max {
+		oldest := fc.order.Back()
+		entry := oldest.Value.(*fileCacheEntry)
+		fc.order.Remove(oldest)
+		delete(fc.items, entry.id)
+		fc.size -= int64(len(entry.data))
+	}
+}
+
+// remove drops files from the cache, called when they are renamed, deleted
+// or created
+func (fc *fileCache) remove(ids ...uint) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	for _, id := range ids {
+		if el, ok := fc.items[id]; ok {
+			fc.size -= int64(len(el.Value.(*fileCacheEntry).data))
+			fc.order.Remove(el)
+			delete(fc.items, id)
+		}
+	}
+}
+
+// load is db.First(file, conds...) with the contents taken from the cache
+// when present. The row is read without its data first, so a hit costs one
+// small query. A nil cache always reads the whole row.
+func (fc *fileCache) load(db *gorm.DB, file *models.File, conds ...any) error {
+	if fc == nil || fc.max == 0 {
+		return db.First(file, conds...).Error
+	}
+	if err := db.Omit("data").First(file, conds...).Error; err != nil {
+		return err
+	}
+	if data, ok := fc.get(file.ID); ok {
+		file.Data = data
+		return nil
+	}
+	var row models.File
+	if err := db.Session(&gorm.Session{NewDB: true}).Select("id", "data").First(&row, file.ID).Error; err != nil {
+		return err
+	}
+	file.Data = row.Data
+	fc.put(file.ID, file.Data)
+	return nil
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// TestFileCacheChecksum checks a second checksum of a file reuses the cached
+// contents instead of reading them again, and that deleting the file evicts it
+func TestFileCacheChecksum(t *testing.T) {
+	h := newTestHandler(t)
+	file := createTestFile(t, h, "cached.bin", []byte("cache me if you can"))
+
+	// Count the queries reading file contents
+	blobReads := 0
+	h.db.GormDB.Callback().Query().After("gorm:query").Register("test:count_blob_reads", func(tx *gorm.DB) {
+		if tx.Statement.Table == "files" && strings.Contains(tx.Statement.SQL.String(), "`data`") {
+			blobReads++
+		}
+	})
+
+	checksum := func() ChecksumResponse {
+		t.Helper()
+		c, rec := newJSONContext(http.MethodPost, "/checksum", ChecksumRequest{FileID: file.ID, Offset: 0, Length: 5})
+		if err := h.CalculateChecksum(c); err != nil {
+			t.Fatal(err)
+		}
+		var resp ChecksumResponse
+		decodeJSON(t, rec, http.StatusOK, &resp)
+		return resp
+	}
+
+	first := checksum()
+	if blobReads != 1 {
+		t.Fatalf("first checksum read the contents %d times, want 1", blobReads)
+	}
+	second := checksum()
+	if blobReads != 1 {
+		t.Errorf("second checksum read the contents again (%d reads), want a cache hit", blobReads)
+	}
+	if first != second {
+		t.Errorf("cached checksum = %+v, want %+v", second, first)
+	}
+
+	c, rec := newJSONContext(http.MethodDelete, "/delete/binary/cached.bin", nil)
+	c.SetParamNames("name")
+	c.SetParamValues("cached.bin")
+	if err := h.DeleteBinaryFile(c); err != nil {
+		t.Fatal(err)
+	}
+	decodeJSON(t, rec, http.StatusOK, nil)
+	if _, ok := h.files.get(file.ID); ok {
+		t.Error("deleted file is still cached")
+	}
+}
+
+// TestFileCacheEviction checks the least recently used contents go first
+// once the cache is over its size
+func TestFileCacheEviction(t *testing.T) {
+	fc := newFileCache(10)
+	fc.put(1, []byte("aaaa"))
+	fc.put(2, []byte("bbbb"))
+	fc.get(1) // 2 is now the least recently used
+	fc.put(3, []byte("cccc"))
+
+	if _, ok := fc.get(2); ok {
+		t.Error("least recently used file 2 was kept")
+	}
+	for _, id := range []uint{1, 3} {
+		if _, ok := fc.get(id); !ok {
+			t.Errorf("file %d was evicted", id)
+		}
+	}
+	if fc.size != 8 {
+		t.Errorf("size = %d, want 8", fc.size)
+	}
+
+	fc.put(4, make([]byte, 11)) // larger than the whole cache
+	if _, ok := fc.get(4); ok || fc.size != 8 {
+		t.Errorf("oversized contents were cached, size = %d", fc.size)
+	}
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"binary-annotator-pro/models"
+	"encoding/binary"
+	"math"
+	"net/http"
+	"sort"
+
+	"github.com/labstack/echo/v4"
+)
+
+// FrameDetectRequest describes the assumed frame header: a length field of
+// width bytes at the start of a header of header_size bytes. The length
+// counts the bytes after the header.
+type FrameDetectRequest struct {
+	FileID     uint   `json:"file_id"`
+	Width      int    `json:"width"`       // length field size: 1, 2 (default) or 4
+	Endian     string `json:"endian"`      // "little" (default) or "big"
+	HeaderSize int    `json:"header_size"` // default: width
+	MinFrames  int    `json:"min_frames"`  // shortest chain reported (default 3)
+	AllowEmpty bool   `json:"allow_empty"` // accept zero lengths, which otherwise end a chain
+	Limit      int    `json:"limit"`       // candidates returned (default 5)
+}
+
+// FrameCandidate is a chain of frames, each header's length pointing at the
+// next header
+type FrameCandidate struct {
+	Offset       int     `json:"offset"` // first header
+	End          int     `json:"end"`    // end of the last frame
+	Frames       int     `json:"frames"`
+	Stride       int     `json:"stride"` // most common frame size (header + length)
+	AvgFrameSize float64 `json:"avg_frame_size"`
+	Coverage     float64 `json:"coverage"`    // fraction of the file covered by the chain
+	ReachesEOF   bool    `json:"reaches_eof"` // the last frame ends exactly at the end of the file
+}
+
+// FrameDetectResponse lists the candidate framings, best first
+type FrameDetectResponse struct {
+	Best       *FrameCandidate  `json:"best"`
+	Candidates []FrameCandidate `json:"candidates"`
+}
+
+// DetectFraming looks for length-prefixed frames by treating every offset as
+// a potential header and chaining offset + header_size + length to the next
+func (h *Handler) DetectFraming(c echo.Context) error {
+	var req FrameDetectRequest
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid request")
+	}
+	if req.Width == 0 {
+		req.Width = 2
+	}
+	if req.Width != 1 && req.Width != 2 && req.Width != 4 {
+		return apiError(c, http.StatusBadRequest, ErrCodeUnsupported, "width must be 1, 2 or 4")
+	}
+	if req.Endian == "" {
+		req.Endian = "little"
+	}
+	if req.Endian != "little" && req.Endian != "big" {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "endian must be little or big")
+	}
+	if req.HeaderSize == 0 {
+		req.HeaderSize = req.Width
+	}
+	if req.HeaderSize < req.Width {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "header_size must be at least width")
+	}
+	if req.MinFrames == 0 {
+		req.MinFrames = 3
+	}
+	if req.MinFrames < 2 {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "min_frames must be at least 2")
+	}
+	if req.Limit <= 0 {
+		req.Limit = 5
+	}
+
+	var file models.File
+	if err := h.db.GormDB.First(&file, req.FileID).Error; err != nil {
+		return apiError(c, http.StatusNotFound, ErrCodeFileNotFound, "file not found")
+	}
+	if req.HeaderSize > len(file.Data) {
+		return apiErrorDetails(c, http.StatusBadRequest, ErrCodeOutOfRange, "header_size is larger than the file",
+			map[string]any{"header_size": req.HeaderSize, "file_size": len(file.Data)})
+	}
+	if len(file.Data) > math.MaxInt32 {
+		return apiError(c, http.StatusRequestEntityTooLarge, ErrCodeTooLarge, "file too large for frame detection")
+	}
+
+	candidates := detectFraming(file.Data, req)
+	resp := FrameDetectResponse{Candidates: candidates}
+	if len(candidates) > 0 {
+		resp.Best = &candidates[0]
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// detectFraming scores the frame chain starting at every offset and returns
+// the best distinct ones. A chain's score is the share of the file it
+// covers, so the true framing beats chance chains through random bytes.
+func detectFraming(data []byte, req FrameDetectRequest) []FrameCandidate {
+	n := len(data)
+	readLength := func(off int) int {
+		b := data[off : off+req.Width]
+		switch {
+		case req.Width == 1:
+			return int(b[0])
+		case req.Width == 2 && req.Endian == "big":
+			return int(binary.BigEndian.Uint16(b))
+		case req.Width == 2:
+			return int(binary.LittleEndian.Uint16(b))
+		case req.Endian == "big":
+			return int(binary.BigEndian.Uint32(b))
+		default:
+			return int(binary.LittleEndian.Uint32(b))
+		}
+	}
+
+	// nextHeader is the header following a frame at i, or -1 when no
+	// complete frame starts there
+	nextHeader := func(i int) int {
+		if req.HeaderSize > n-i {
+			return -1
+		}
+		length := readLength(i)
+		if (length == 0 && !req.AllowEmpty) || length > n-i-req.HeaderSize {
+			return -1
+		}
+		return i + req.HeaderSize + length
+	}
+
+	// Chains only move forward, so frames[i] and end[i] (length and end of
+	// the chain from i) fill in from the end of the file. int32 keeps them
+	// at 8 bytes per byte of the file.
+	frames := make([]int32, n+1)
+	end := make([]int32, n+1)
+	end[n] = int32(n)
+	for i := n - 1; i >= 0; i-- {
+		end[i] = int32(i)
+		if j := nextHeader(i); j >= 0 {
+			frames[i] = 1 + frames[j]
+			end[i] = end[j]
+		}
+	}
+
+	starts := make([]int, 0)
+	for i := 0; i < n; i++ {
+		if int(frames[i]) >= req.MinFrames {
+			starts = append(starts, i)
+		}
+	}
+	sort.SliceStable(starts, func(a, b int) bool {
+		ca, cb := int(end[starts[a]])-starts[a], int(end[starts[b]])-starts[b]
+		if ca != cb {
+			return ca > cb
+		}
+		return frames[starts[a]] > frames[starts[b]]
+	})
+
+	// Chains that join a better one share its frames: report each chain once
+	onChain := make(map[int]bool)
+	candidates := []FrameCandidate{}
+	for _, start := range starts {
+		if len(candidates) == req.Limit {
+			break
+		}
+		if onChain[start] {
+			continue
+		}
+
+		sizes := make(map[int]int)
+		for i, j := start, nextHeader(start); j >= 0; i, j = j, nextHeader(j) {
+			onChain[i] = true
+			sizes[j-i]++
+		}
+		stride, best := 0, 0
+		for size, count := range sizes {
+			if count > best || (count == best && size < stride) {
+				stride, best = size, count
+			}
+		}
+
+		chainEnd, chainFrames := int(end[start]), int(frames[start])
+		candidates = append(candidates, FrameCandidate{
+			Offset:       start,
+			End:          chainEnd,
+			Frames:       chainFrames,
+			Stride:       stride,
+			AvgFrameSize: float64(chainEnd-start) / float64(chainFrames),
+			Coverage:     float64(chainEnd-start) / float64(n),
+			ReachesEOF:   chainEnd == n,
+		})
+	}
+	return candidates
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"net/http"
+	"testing"
+)
+
+func TestDetectFramingRecoversLengthPrefixedStream(t *testing.T) {
+	h := newTestHandler(t)
+
+	// 4-byte headers (uint16 length, uint16 type) before random payloads
+	rng := rand.New(rand.NewSource(1))
+	var stream []byte
+	for i := 0; i < 40; i++ {
+		payload := make([]byte, 20+rng.Intn(200))
+		rng.Read(payload)
+		header := make([]byte, 4)
+		binary.LittleEndian.PutUint16(header, uint16(len(payload)))
+		binary.LittleEndian.PutUint16(header[2:], uint16(i))
+		stream = append(append(stream, header...), payload...)
+	}
+	file := createTestFile(t, h, "framed.bin", stream)
+
+	c, rec := newJSONContext(http.MethodPost, "/frame/detect",
+		map[string]interface{}{"file_id": file.ID, "width": 2, "header_size": 4})
+	if err := h.DetectFraming(c); err != nil {
+		t.Fatal(err)
+	}
+	var resp FrameDetectResponse
+	decodeJSON(t, rec, http.StatusOK, &resp)
+
+	if resp.Best == nil {
+		t.Fatal("no framing found")
+	}
+	if resp.Best.Offset != 0 || resp.Best.Frames != 40 || !resp.Best.ReachesEOF {
+		t.Errorf("best = %+v, want 40 frames from offset 0 to the end of the file", *resp.Best)
+	}
+}
+
+func TestDetectFramingFixedStrideBigEndian(t *testing.T) {
+	h := newTestHandler(t)
+
+	// A 3-byte preamble of zeros, then 16 records of 2-byte big-endian length 10
+	stream := make([]byte, 3)
+	for i := 0; i < 16; i++ {
+		record := make([]byte, 12)
+		binary.BigEndian.PutUint16(record, 10)
+		for j := 2; j < len(record); j++ {
+			record[j] = byte(0x80 + i)
+		}
+		stream = append(stream, record...)
+	}
+	file := createTestFile(t, h, "records.bin", stream)
+
+	c, rec := newJSONContext(http.MethodPost, "/frame/detect",
+		map[string]interface{}{"file_id": file.ID, "endian": "big"})
+	if err := h.DetectFraming(c); err != nil {
+		t.Fatal(err)
+	}
+	var resp FrameDetectResponse
+	decodeJSON(t, rec, http.StatusOK, &resp)
+
+	if resp.Best == nil || resp.Best.Offset != 3 || resp.Best.Stride != 12 || resp.Best.Frames != 16 {
+		t.Fatalf("best = %+v, want 16 frames of 12 bytes from offset 3", resp.Best)
+	}
+}
+
+func TestDetectFramingRejectsBadWidth(t *testing.T) {
+	h := newTestHandler(t)
+	file := createTestFile(t, h, "w.bin", []byte{1, 2, 3})
+
+	c, rec := newJSONContext(http.MethodPost, "/frame/detect", map[string]interface{}{"file_id": file.ID, "width": 3})
+	if err := h.DetectFraming(c); err != nil {
+		t.Fatal(err)
+	}
+	var apiErr APIError
+	decodeJSON(t, rec, http.StatusBadRequest, &apiErr)
+	if apiErr.Code != ErrCodeUnsupported {
+		t.Errorf("code = %q", apiErr.Code)
+	}
+}
+
+func TestDetectFramingRejectsHugeHeader(t *testing.T) {
+	h := newTestHandler(t)
+	file := createTestFile(t, h, "hdr.bin", make([]byte, 64))
+
+	c, rec := newJSONContext(http.MethodPost, "/frame/detect", map[string]interface{}{"file_id": file.ID, "header_size": math.MaxInt64})
+	if err := h.DetectFraming(c); err != nil {
+		t.Fatal(err)
+	}
+	var apiErr APIError
+	decodeJSON(t, rec, http.StatusBadRequest, &apiErr)
+	if apiErr.Code != ErrCodeOutOfRange {
+		t.Errorf("code = %q", apiErr.Code)
+	}
+}
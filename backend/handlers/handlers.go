@@ -2,10 +2,15 @@ package handlers
 
 import (
 	"binary-annotator-pro/config"
+	"binary-annotator-pro/middleware"
 	"binary-annotator-pro/models"
+	"crypto/sha256"
 	"encoding/csv"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"os"
 	"os/exec"
@@ -14,20 +19,37 @@ import (
 	"strings"
 
 	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
 )
 
 // Handler holds DB reference
 type Handler struct {
 	db *config.DB
+
+	// compressionEvents feeds the compression analysis progress streams
+	compressionEvents *compressionEventHub
+
+	// analyses caps the compression detectors running at once
+	analyses *analysisLimiter
+
+	// uploadLocks serialises the requests of each chunked upload
+	uploadLocks uploadLocks
+
+	// files caches the contents of recently used files
+	files *fileCache
 }
 
 func NewHandler(db *config.DB) *Handler {
-	return &Handler{db: db}
+	return &Handler{db: db, compressionEvents: newCompressionEventHub(), analyses: newAnalysisLimiterFromEnv(), files: newFileCacheFromEnv()}
 }
 
-// UploadBinary: multipart form with file field "file" and optional "name" and "vendor"
+// UploadBinary: multipart form with file field "file" and optional "name",
+// "vendor" and "on_duplicate" ("reject" or "allow", see duplicateUploadPolicy)
 func (h *Handler) UploadBinary(c echo.Context) error {
 	f, err := c.FormFile("file")
+	if tooLarge := (*http.MaxBytesError)(nil); errors.As(err, &tooLarge) {
+		return middleware.TooLargeError(c, "request body", tooLarge.Limit)
+	}
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "missing file field 'file'"})
 	}
@@ -47,13 +69,32 @@ func (h *Handler) UploadBinary(c echo.Context) error {
 	if name == "" {
 		name = f.Filename
 	}
-	vendor := c.FormValue("vendor")
+	return h.storeUploadedFile(c, name, c.FormValue("vendor"), c.FormValue("on_duplicate"), buf)
+}
+
+// storeUploadedFile creates the File for an upload, whole or chunked,
+// applying the duplicate content policy, and writes the response
+func (h *Handler) storeUploadedFile(c echo.Context, name, vendor, onDuplicate string, buf []byte) error {
+	hash := contentHash(buf)
+
+	// Identical content already stored under another name?
+	h.backfillFileHashes()
+	var existing models.File
+	duplicate := h.db.GormDB.Select("id, name").Where("hash = ?", hash).First(&existing).Error == nil
+	if duplicate && duplicateUploadPolicy(onDuplicate) == "reject" {
+		return c.JSON(http.StatusConflict, map[string]any{
+			"error":         "file with identical content already exists",
+			"existing_file": map[string]any{"id": existing.ID, "name": existing.Name},
+		})
+	}
 
 	file := models.File{
-		Name:   name,
-		Vendor: vendor,
-		Size:   int64(len(buf)),
-		Data:   buf,
+		Name:    name,
+		Vendor:  vendor,
+		Size:    int64(len(buf)),
+		Hash:    hash,
+		Entropy: fileEntropy(buf),
+		Data:    buf,
 	}
 
 	if err := h.db.GormDB.Create(&file).Error; err != nil {
@@ -62,8 +103,94 @@ func (h *Handler) UploadBinary(c echo.Context) error {
 		}
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "db create file"})
 	}
+	h.files.remove(file.ID)
+
+	resp := map[string]any{"id": file.ID, "name": file.Name, "size": file.Size, "hash": file.Hash, "entropy": file.Entropy}
+	if duplicate {
+		resp["warning"] = "file with identical content already exists"
+		resp["duplicate_of"] = map[string]any{"id": existing.ID, "name": existing.Name}
+	}
+	return c.JSON(http.StatusCreated, resp)
+}
+
+// duplicateUploadPolicy controls uploads whose content matches an existing file:
+// "allow" (default) stores it and adds a warning, "reject" returns 409. The
+// request's choice wins over DUPLICATE_UPLOAD_POLICY.
+func duplicateUploadPolicy(requested string) string {
+	for _, policy := range []string{requested, os.Getenv("DUPLICATE_UPLOAD_POLICY")} {
+		if policy == "reject" || policy == "allow" {
+			return policy
+		}
+	}
+	return "allow"
+}
+
+// backfillFileHashes hashes the files stored before uploads recorded a hash,
+// so duplicates of them are detected too. Once done it is a single indexed
+// query finding nothing.
+func (h *Handler) backfillFileHashes() {
+	var ids []uint
+	h.db.GormDB.Model(&models.File{}).Where("hash = '' OR hash IS NULL").Pluck("id", &ids)
+	for _, id := range ids {
+		var full models.File
+		if err := h.db.GormDB.Select("id, data").First(&full, id).Error; err != nil {
+			continue
+		}
+		h.db.GormDB.Model(&models.File{}).Where("id = ?", id).Update("hash", contentHash(full.Data))
+	}
+}
+
+// contentHash returns the hex SHA-256 stored in File.Hash
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// fileEntropy returns the Shannon entropy stored in File.Entropy, in bits per
+// byte: 0 for constant data, 8 for uniformly random data
+func fileEntropy(data []byte) *float64 {
+	var counts [256]int
+	for _, b := range data {
+		counts[b]++
+	}
+	entropy := 0.0
+	for _, n := range counts {
+		if n > 0 {
+			p := float64(n) / float64(len(data))
+			entropy -= p * math.Log2(p)
+		}
+	}
+	return &entropy
+}
+
+// GetFileHash returns the SHA-256 of a file, backfilling it for files stored before hashing existed
+func (h *Handler) GetFileHash(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid id"})
+	}
+
+	var f models.File
+	if err := h.db.GormDB.Select("id, name, size, hash").First(&f, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "file not found"})
+	}
+
+	if f.Hash == "" {
+		var full models.File
+		if err := h.db.GormDB.First(&full, id).Error; err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "file not found"})
+		}
+		f.Hash = contentHash(full.Data)
+		h.db.GormDB.Model(&models.File{}).Where("id = ?", id).Update("hash", f.Hash)
+	}
 
-	return c.JSON(http.StatusCreated, map[string]any{"id": file.ID, "name": file.Name, "size": file.Size})
+	return c.JSON(http.StatusOK, map[string]any{
+		"id":        f.ID,
+		"name":      f.Name,
+		"size":      f.Size,
+		"algorithm": "sha256",
+		"hash":      f.Hash,
+	})
 }
 
 // UploadYaml: accept either multipart file "file" (yaml file) or form value "yaml" and optional file_name and name
@@ -92,6 +219,7 @@ func (h *Handler) UploadYaml(c echo.Context) error {
 				Yaml     string `json:"yaml"`
 				Name     string `json:"name"`
 				FileName string `json:"file_name"`
+				FileID   *uint  `json:"file_id"`
 			}
 			var r Req
 			if err := c.Bind(&r); err != nil {
@@ -104,6 +232,9 @@ func (h *Handler) UploadYaml(c echo.Context) error {
 			if r.FileName != "" {
 				c.Set("_fileName", r.FileName)
 			}
+			if r.FileID != nil {
+				c.Set("_fileID", *r.FileID)
+			}
 		} else {
 			yamlContent = []byte(v)
 		}
@@ -113,6 +244,13 @@ func (h *Handler) UploadYaml(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "no yaml provided"})
 	}
 
+	// Optional schema validation (?validate=true)
+	if shouldValidateYaml(c) {
+		if result := validateYamlConfig(string(yamlContent)); !result.Valid {
+			return c.JSON(http.StatusUnprocessableEntity, map[string]any{"error": "invalid yaml config", "errors": result.Errors})
+		}
+	}
+
 	name := c.FormValue("name")
 	if name == "" {
 		if v := c.Get("_name"); v != nil {
@@ -123,20 +261,25 @@ func (h *Handler) UploadYaml(c echo.Context) error {
 		name = fmt.Sprintf("config-%d", timeNowUnix())
 	}
 
-	// try to associate with file by name if provided
-	var fileID *uint = nil
-	if fileName := c.FormValue("file_name"); fileName != "" {
-		var f models.File
-		if err := h.db.GormDB.Where("name = ?", fileName).First(&f).Error; err == nil {
-			fileID = &f.ID
-		}
-	} else if v := c.Get("_fileName"); v != nil {
-		if fileName, ok := v.(string); ok && fileName != "" {
-			var f models.File
-			if err := h.db.GormDB.Where("name = ?", fileName).First(&f).Error; err == nil {
-				fileID = &f.ID
-			}
+	// associate with a file by ID, or by name if provided
+	var requestedID *uint
+	if v := c.FormValue("file_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid file_id"})
 		}
+		fid := uint(id)
+		requestedID = &fid
+	} else if v, ok := c.Get("_fileID").(uint); ok {
+		requestedID = &v
+	}
+	fileName := c.FormValue("file_name")
+	if v, ok := c.Get("_fileName").(string); ok && fileName == "" {
+		fileName = v
+	}
+	fileID, err := h.yamlConfigFile(requestedID, fileName)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
 	}
 
 	yc := models.YamlConfig{
@@ -152,6 +295,44 @@ func (h *Handler) UploadYaml(c echo.Context) error {
 	return c.JSON(http.StatusCreated, map[string]any{"id": yc.ID, "name": yc.Name, "file_id": yc.FileID})
 }
 
+// yamlConfigFile resolves the file a config is linked to. An explicit ID must
+// exist; a name that matches no file leaves the config unlinked, as before.
+// Links are by ID, so renaming the file keeps them.
+func (h *Handler) yamlConfigFile(fileID *uint, fileName string) (*uint, error) {
+	var f models.File
+	if fileID != nil {
+		if err := h.db.GormDB.Select("id").First(&f, *fileID).Error; err != nil {
+			return nil, fmt.Errorf("file %d not found", *fileID)
+		}
+		return &f.ID, nil
+	}
+	if fileName == "" {
+		return nil, nil
+	}
+	if err := h.db.GormDB.Select("id").Where("name = ?", fileName).First(&f).Error; err != nil {
+		return nil, nil
+	}
+	return &f.ID, nil
+}
+
+// ListFileConfigs lists the YAML configs linked to a file, newest first
+func (h *Handler) ListFileConfigs(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid id"})
+	}
+	var f models.File
+	if err := h.db.GormDB.Select("id").First(&f, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "file not found"})
+	}
+
+	configs := []models.YamlConfig{}
+	if err := h.db.GormDB.Where("file_id = ?", f.ID).Order("created_at desc").Find(&configs).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "db list yaml"})
+	}
+	return c.JSON(http.StatusOK, configs)
+}
+
 // ListYaml
 func (h *Handler) ListYaml(c echo.Context) error {
 	var configs []models.YamlConfig
@@ -162,12 +343,70 @@ func (h *Handler) ListYaml(c echo.Context) error {
 }
 
 // ListBinaries
+// Optional query params: limit, offset (pagination), vendor (exact match), q (name substring)
 func (h *Handler) ListBinaries(c echo.Context) error {
+	limit, err := parseNonNegativeQueryInt(c, "limit")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	offset, err := parseNonNegativeQueryInt(c, "offset")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	query := h.db.GormDB.Model(&models.File{})
+	if vendor := c.QueryParam("vendor"); vendor != "" {
+		query = query.Where("vendor = ?", vendor)
+	}
+	if q := c.QueryParam("q"); q != "" {
+		query = query.Where("name LIKE ?", "%"+q+"%")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "db count files"})
+	}
+
+	query = query.Order("created_at desc").Offset(offset)
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
 	var files []models.File
-	if err := h.db.GormDB.Order("created_at desc").Select("id, name, vendor, size, created_at, updated_at").Find(&files).Error; err != nil {
+	if err := query.Select("id, name, vendor, size, hash, entropy, created_at, updated_at").Find(&files).Error; err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "db list files"})
 	}
-	return c.JSON(http.StatusOK, files)
+
+	// Files stored before entropy was recorded get it now, once
+	for i := range files {
+		if files[i].Entropy != nil {
+			continue
+		}
+		var full models.File
+		if err := h.db.GormDB.Select("id, data").First(&full, files[i].ID).Error; err == nil {
+			files[i].Entropy = fileEntropy(full.Data)
+			h.db.GormDB.Model(&models.File{}).Where("id = ?", files[i].ID).Update("entropy", *files[i].Entropy)
+		}
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"files":  files,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// parseNonNegativeQueryInt reads an optional integer query param, 0 when absent
+func parseNonNegativeQueryInt(c echo.Context, name string) (int, error) {
+	raw := c.QueryParam(name)
+	if raw == "" {
+		return 0, nil
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid %s", name)
+	}
+	return v, nil
 }
 
 // GetBinaryByName: returns the binary file as attachment (supports HTTP Range requests for chunked loading)
@@ -266,6 +505,10 @@ func (h *Handler) DeleteYamlConfig(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "missing config name"})
 	}
 
+	// Drop the version history along with the config
+	h.db.GormDB.Where("config_id IN (?)", h.db.GormDB.Model(&models.YamlConfig{}).Select("id").Where("name = ?", name)).
+		Delete(&models.YamlConfigVersion{})
+
 	res := h.db.GormDB.Where("name = ?", name).Delete(&models.YamlConfig{})
 	if res.Error != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": res.Error.Error()})
@@ -290,6 +533,7 @@ func (h *Handler) UpdateYamlConfig(c echo.Context) error {
 		Yaml     string `json:"yaml"`
 		NewName  string `json:"new_name"`
 		FileName string `json:"file_name"`
+		FileID   *uint  `json:"file_id"`
 	}
 	var req UpdateReq
 	if err := c.Bind(&req); err != nil {
@@ -300,12 +544,22 @@ func (h *Handler) UpdateYamlConfig(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "yaml content required"})
 	}
 
+	// Optional schema validation (?validate=true)
+	if shouldValidateYaml(c) {
+		if result := validateYamlConfig(req.Yaml); !result.Valid {
+			return c.JSON(http.StatusUnprocessableEntity, map[string]any{"error": "invalid yaml config", "errors": result.Errors})
+		}
+	}
+
 	// Find existing config
 	var yc models.YamlConfig
 	if err := h.db.GormDB.Where("name = ?", name).First(&yc).Error; err != nil {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "config not found"})
 	}
 
+	// Keep the current YAML as a version before replacing it
+	previous := yc
+
 	// Update fields
 	yc.Yaml = req.Yaml
 	if req.NewName != "" && req.NewName != name {
@@ -313,14 +567,25 @@ func (h *Handler) UpdateYamlConfig(c echo.Context) error {
 	}
 
 	// Handle file association
-	if req.FileName != "" {
-		var f models.File
-		if err := h.db.GormDB.Where("name = ?", req.FileName).First(&f).Error; err == nil {
-			yc.FileID = &f.ID
+	if req.FileID != nil || req.FileName != "" {
+		fileID, err := h.yamlConfigFile(req.FileID, req.FileName)
+		if err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		if fileID != nil {
+			yc.FileID = fileID
 		}
 	}
 
-	if err := h.db.GormDB.Save(&yc).Error; err != nil {
+	err := h.db.GormDB.Transaction(func(tx *gorm.DB) error {
+		if previous.Yaml != yc.Yaml {
+			if _, err := snapshotYamlConfig(tx, previous); err != nil {
+				return err
+			}
+		}
+		return tx.Save(&yc).Error
+	})
+	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to update config"})
 	}
 
@@ -511,7 +776,8 @@ func parseSimpleCSV(records [][]string, c echo.Context) error {
 	return c.JSON(http.StatusOK, response)
 }
 
-// ConvertECGData: convert raw ECG data using Python script
+// ConvertECGData: convert raw ECG data using Python script, or with the plain
+// ADC scaling of convertADCToVoltage when the Python venv is missing
 func (h *Handler) ConvertECGData(c echo.Context) error {
 	// Parse request body
 	type ConvertReq struct {
@@ -536,6 +802,17 @@ func (h *Handler) ConvertECGData(c echo.Context) error {
 		req.ADCRange = 10.0
 	}
 
+	// Without the Python environment, the plain ADC scaling runs in Go
+	venvPython, ok := ecgConversionPython()
+	if !ok {
+		records, err := convertADCToVoltage(req.CSVData, req.ADCBits, req.ADCRange)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		c.Response().Header().Set("X-ECG-Converter", "go")
+		return respondConvertedECG(records, c)
+	}
+
 	// Create temporary files
 	inputFile := "/tmp/input_ecg.csv"
 	outputFile := "/tmp/output_ecg.csv"
@@ -548,18 +825,7 @@ func (h *Handler) ConvertECGData(c echo.Context) error {
 	defer os.Remove(outputFile)
 
 	// Run Python conversion script using venv
-	scriptPath := "python_tools/Conversion.py"
-
-	// Try to detect the correct Python path (Docker vs local)
-	venvPython := "/app/venv/bin/python3"
-	localVenvPython := "python_tools/venv/bin/python3"
-
-	// Check if local venv exists, use it if available
-	if _, err := os.Stat(localVenvPython); err == nil {
-		venvPython = localVenvPython
-	}
-
-	cmd := exec.Command(venvPython, scriptPath, inputFile, outputFile, "--adc_bits", strconv.Itoa(req.ADCBits), "--adc_range", fmt.Sprintf("%.1f", req.ADCRange))
+	cmd := exec.Command(venvPython, ecgConversionScript, inputFile, outputFile, "--adc_bits", strconv.Itoa(req.ADCBits), "--adc_range", fmt.Sprintf("%.1f", req.ADCRange))
 	cmd.Dir = "." // Run from backend directory
 
 	output, err := cmd.CombinedOutput()
@@ -567,11 +833,11 @@ func (h *Handler) ConvertECGData(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
 			"error":      "failed to run conversion script: " + err.Error(),
 			"output":     string(output),
-			"script":     scriptPath,
+			"script":     ecgConversionScript,
 			"python":     venvPython,
 			"inputFile":  inputFile,
 			"outputFile": outputFile,
-			"args":       []string{scriptPath, inputFile, outputFile, "--adc_bits", strconv.Itoa(req.ADCBits), "--adc_range", fmt.Sprintf("%.1f", req.ADCRange)},
+			"args":       []string{ecgConversionScript, inputFile, outputFile, "--adc_bits", strconv.Itoa(req.ADCBits), "--adc_range", fmt.Sprintf("%.1f", req.ADCRange)},
 		})
 	}
 
@@ -587,7 +853,12 @@ func (h *Handler) ConvertECGData(c echo.Context) error {
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to parse converted CSV: " + err.Error()})
 	}
+	return respondConvertedECG(records, c)
+}
 
+// respondConvertedECG answers with converted CSV records in the shape
+// ParseCSV uses for the same layout
+func respondConvertedECG(records [][]string, c echo.Context) error {
 	// Check if it's multi-lead format
 	if len(records) > 0 && len(records[0]) > 0 && strings.Contains(records[0][0], "Lead_") {
 		return parseMultiLeadCSV(records, c)
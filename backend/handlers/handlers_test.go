@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"binary-annotator-pro/config"
+	"binary-annotator-pro/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// newTestHandler returns a Handler backed by a fresh on-disk SQLite database
+func newTestHandler(t *testing.T) *Handler {
+	t.Helper()
+
+	db, err := config.InitDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { db.SQLDB.Close() })
+
+	return NewHandler(db)
+}
+
+// createTestFile stores a binary file and returns it
+func createTestFile(t *testing.T, h *Handler, name string, data []byte) models.File {
+	t.Helper()
+
+	file := models.File{Name: name, Size: int64(len(data)), Data: data}
+	if err := h.db.GormDB.Create(&file).Error; err != nil {
+		t.Fatalf("create file: %v", err)
+	}
+	return file
+}
+
+// newJSONContext builds an echo context for a JSON request
+func newJSONContext(method, target string, body interface{}) (echo.Context, *httptest.ResponseRecorder) {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, target, &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	return echo.New().NewContext(req, rec), rec
+}
+
+// newMultipartContext builds an echo context for a multipart upload with a "file" field
+func newMultipartContext(target, fileName string, data []byte, fields map[string]string) (echo.Context, *httptest.ResponseRecorder) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	part, _ := w.CreateFormFile("file", fileName)
+	part.Write(data)
+	for k, v := range fields {
+		w.WriteField(k, v)
+	}
+	w.Close()
+
+	req := httptest.NewRequest(http.MethodPost, target, &buf)
+	req.Header.Set(echo.HeaderContentType, w.FormDataContentType())
+	rec := httptest.NewRecorder()
+	return echo.New().NewContext(req, rec), rec
+}
+
+// decodeJSON unmarshals a recorded response body, failing on unexpected status
+func decodeJSON(t *testing.T, rec *httptest.ResponseRecorder, wantStatus int, v interface{}) {
+	t.Helper()
+
+	if rec.Code != wantStatus {
+		t.Fatalf("status = %d, want %d (body: %s)", rec.Code, wantStatus, rec.Body.String())
+	}
+	if v == nil {
+		return
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+}
+
+// TestListBinariesPagination checks limit/offset slicing and the total count
+func TestListBinariesPagination(t *testing.T) {
+	h := newTestHandler(t)
+
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		f := createTestFile(t, h, fmt.Sprintf("file%d.bin", i), []byte{byte(i)})
+		h.db.GormDB.Model(&f).Update("created_at", base.Add(time.Duration(i)*time.Hour))
+	}
+
+	tests := []struct {
+		name      string
+		query     string
+		wantNames []string
+	}{
+		{"no params", "", []string{"file4.bin", "file3.bin", "file2.bin", "file1.bin", "file0.bin"}},
+		{"limit only", "?limit=2", []string{"file4.bin", "file3.bin"}},
+		{"limit and offset", "?limit=2&offset=2", []string{"file2.bin", "file1.bin"}},
+		{"offset past end", "?offset=10", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := listBinaries(t, h, tt.query, http.StatusOK)
+			if resp.Total != 5 {
+				t.Errorf("total = %d, want 5", resp.Total)
+			}
+			assertFileNames(t, resp.Files, tt.wantNames)
+		})
+	}
+
+	listBinaries(t, h, "?limit=-1", http.StatusBadRequest)
+}
+
+// TestListBinariesFilters checks vendor and name substring filters, alone and combined
+func TestListBinariesFilters(t *testing.T) {
+	h := newTestHandler(t)
+
+	files := []struct{ name, vendor string }{
+		{"schiller_rest.mkf", "schiller"},
+		{"schiller_stress.mkf", "schiller"},
+		{"ge_rest.xml", "ge"},
+		{"philips_rest.xml", "philips"},
+	}
+	for _, f := range files {
+		file := createTestFile(t, h, f.name, []byte{0x00})
+		h.db.GormDB.Model(&file).Update("vendor", f.vendor)
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantVendor string
+		wantTotal  int64
+		wantFiles  int
+	}{
+		{"vendor", "?vendor=schiller", "schiller", 2, 2},
+		{"name substring", "?q=rest", "", 3, 3},
+		{"vendor and name", "?vendor=schiller&q=stress", "schiller", 1, 1},
+		{"vendor and name no match", "?vendor=ge&q=stress", "ge", 0, 0},
+		{"filter with limit", "?q=rest&limit=1", "", 3, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := listBinaries(t, h, tt.query, http.StatusOK)
+			if resp.Total != tt.wantTotal {
+				t.Errorf("total = %d, want %d", resp.Total, tt.wantTotal)
+			}
+			if len(resp.Files) != tt.wantFiles {
+				t.Errorf("got %d files, want %d", len(resp.Files), tt.wantFiles)
+			}
+			for _, f := range resp.Files {
+				if tt.wantVendor != "" && f.Vendor != tt.wantVendor {
+					t.Errorf("file %s has vendor %s, want %s", f.Name, f.Vendor, tt.wantVendor)
+				}
+			}
+		})
+	}
+}
+
+type listBinariesResponse struct {
+	Files []models.File `json:"files"`
+	Total int64         `json:"total"`
+}
+
+func listBinaries(t *testing.T, h *Handler, query string, wantStatus int) listBinariesResponse {
+	t.Helper()
+
+	c, rec := newJSONContext(http.MethodGet, "/get/list/binary"+query, nil)
+	if err := h.ListBinaries(c); err != nil {
+		t.Fatalf("ListBinaries() error = %v", err)
+	}
+	var resp listBinariesResponse
+	if wantStatus != http.StatusOK {
+		decodeJSON(t, rec, wantStatus, nil)
+		return resp
+	}
+	decodeJSON(t, rec, wantStatus, &resp)
+	return resp
+}
+
+func assertFileNames(t *testing.T, files []models.File, want []string) {
+	t.Helper()
+
+	if len(files) != len(want) {
+		t.Fatalf("got %d files, want %d", len(files), len(want))
+	}
+	for i, f := range files {
+		if f.Name != want[i] {
+			t.Errorf("files[%d] = %s, want %s", i, f.Name, want[i])
+		}
+	}
+}
+
+// TestUploadBinaryDuplicateContent detects identical bytes uploaded under a second name
+func TestUploadBinaryDuplicateContent(t *testing.T) {
+	data := []byte{0x55, 0xAA, 0x01, 0x02, 0x03, 0x04}
+
+	type uploadResponse struct {
+		ID           uint               `json:"id"`
+		Hash         string             `json:"hash"`
+		Warning      string             `json:"warning"`
+		DuplicateOf  *struct{ ID uint } `json:"duplicate_of"`
+		ExistingFile *struct{ ID uint } `json:"existing_file"`
+	}
+
+	upload := func(t *testing.T, h *Handler, name string, fields map[string]string, wantStatus int) uploadResponse {
+		t.Helper()
+		c, rec := newMultipartContext("/upload/binary", name, data, fields)
+		if err := h.UploadBinary(c); err != nil {
+			t.Fatalf("UploadBinary() error = %v", err)
+		}
+		var resp uploadResponse
+		decodeJSON(t, rec, wantStatus, &resp)
+		return resp
+	}
+
+	t.Run("allow with warning by default", func(t *testing.T) {
+		h := newTestHandler(t)
+		first := upload(t, h, "capture.bin", nil, http.StatusCreated)
+		if first.Hash != contentHash(data) {
+			t.Errorf("hash = %s, want %s", first.Hash, contentHash(data))
+		}
+
+		dup := upload(t, h, "capture_copy.bin", nil, http.StatusCreated)
+		if dup.Warning == "" || dup.DuplicateOf == nil || dup.DuplicateOf.ID != first.ID {
+			t.Errorf("duplicate not reported: %+v", dup)
+		}
+	})
+
+	t.Run("reject on request", func(t *testing.T) {
+		h := newTestHandler(t)
+		first := upload(t, h, "capture.bin", nil, http.StatusCreated)
+
+		dup := upload(t, h, "capture_copy.bin", map[string]string{"on_duplicate": "reject"}, http.StatusConflict)
+		if dup.ExistingFile == nil || dup.ExistingFile.ID != first.ID {
+			t.Errorf("existing_file = %+v, want id %d", dup.ExistingFile, first.ID)
+		}
+	})
+
+	t.Run("reject by env, allowed by the request", func(t *testing.T) {
+		t.Setenv("DUPLICATE_UPLOAD_POLICY", "reject")
+		h := newTestHandler(t)
+		upload(t, h, "capture.bin", nil, http.StatusCreated)
+		upload(t, h, "capture_copy.bin", nil, http.StatusConflict)
+		upload(t, h, "capture_copy.bin", map[string]string{"on_duplicate": "allow"}, http.StatusCreated)
+	})
+
+	t.Run("file stored without a hash", func(t *testing.T) {
+		h := newTestHandler(t)
+		legacy := createTestFile(t, h, "legacy.bin", data)
+
+		dup := upload(t, h, "capture.bin", map[string]string{"on_duplicate": "reject"}, http.StatusConflict)
+		if dup.ExistingFile == nil || dup.ExistingFile.ID != legacy.ID {
+			t.Errorf("existing_file = %+v, want the legacy file %d", dup.ExistingFile, legacy.ID)
+		}
+	})
+}
+
+// TestGetFileHash backfills the hash for files stored without one
+func TestGetFileHash(t *testing.T) {
+	h := newTestHandler(t)
+	data := []byte("legacy file without hash")
+	file := createTestFile(t, h, "legacy.bin", data)
+
+	c, rec := newJSONContext(http.MethodGet, "/", nil)
+	c.SetParamNames("id")
+	c.SetParamValues(fmt.Sprint(file.ID))
+	if err := h.GetFileHash(c); err != nil {
+		t.Fatalf("GetFileHash() error = %v", err)
+	}
+
+	var resp struct {
+		Hash      string `json:"hash"`
+		Algorithm string `json:"algorithm"`
+	}
+	decodeJSON(t, rec, http.StatusOK, &resp)
+	if resp.Hash != contentHash(data) || resp.Algorithm != "sha256" {
+		t.Errorf("got %+v, want sha256 %s", resp, contentHash(data))
+	}
+
+	var stored models.File
+	h.db.GormDB.Select("hash").First(&stored, file.ID)
+	if stored.Hash != resp.Hash {
+		t.Errorf("stored hash = %q, want backfilled %q", stored.Hash, resp.Hash)
+	}
+}
+
+// TestFileEntropy stores the entropy of uploads, lists it, and backfills it
+// for files stored without one
+func TestFileEntropy(t *testing.T) {
+	h := newTestHandler(t)
+
+	random := make([]byte, 64*1024)
+	state := uint32(1)
+	for i := range random {
+		state = state*1664525 + 1013904223
+		random[i] = byte(state >> 24)
+	}
+	for name, data := range map[string][]byte{"zeros.bin": make([]byte, 4096), "random.bin": random} {
+		c, rec := newMultipartContext("/upload/binary", name, data, nil)
+		if err := h.UploadBinary(c); err != nil {
+			t.Fatalf("UploadBinary() error = %v", err)
+		}
+		decodeJSON(t, rec, http.StatusCreated, nil)
+	}
+	createTestFile(t, h, "legacy.txt", []byte("abababab"))
+
+	c, rec := newJSONContext(http.MethodGet, "/get/list/binary", nil)
+	if err := h.ListBinaries(c); err != nil {
+		t.Fatalf("ListBinaries() error = %v", err)
+	}
+	var resp struct {
+		Files []models.File `json:"files"`
+	}
+	decodeJSON(t, rec, http.StatusOK, &resp)
+
+	entropy := map[string]float64{}
+	for _, f := range resp.Files {
+		if f.Entropy == nil {
+			t.Fatalf("%s has no entropy", f.Name)
+		}
+		entropy[f.Name] = *f.Entropy
+	}
+	if entropy["zeros.bin"] != 0 {
+		t.Errorf("zeros.bin entropy = %v, want 0", entropy["zeros.bin"])
+	}
+	if entropy["random.bin"] < 7.9 || entropy["random.bin"] > 8 {
+		t.Errorf("random.bin entropy = %v, want close to 8", entropy["random.bin"])
+	}
+	if entropy["legacy.txt"] != 1 {
+		t.Errorf("legacy.txt entropy = %v, want 1 (two equally likely bytes)", entropy["legacy.txt"])
+	}
+
+	var stored models.File
+	h.db.GormDB.Select("entropy").Where("name = ?", "legacy.txt").First(&stored)
+	if stored.Entropy == nil || *stored.Entropy != 1 {
+		t.Errorf("legacy.txt stored entropy = %v, want backfilled 1", stored.Entropy)
+	}
+}
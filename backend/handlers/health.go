@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"binary-annotator-pro/config"
+	"binary-annotator-pro/services"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// healthCheckTimeout bounds each subsystem probe of GET /health/deep. A
+// variable so tests can shorten it.
+var healthCheckTimeout = 3 * time.Second
+
+// healthProbeClient is used for the Ollama and MCP manager probes
+var healthProbeClient = &http.Client{Timeout: healthCheckTimeout}
+
+// SubsystemHealth is the state of one dependency
+type SubsystemHealth struct {
+	Status    string `json:"status"` // "ok" or "unavailable"
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// DeepHealthResponse is returned by GET /health/deep. Healthy is false when
+// any subsystem is unavailable.
+type DeepHealthResponse struct {
+	Healthy    bool                       `json:"healthy"`
+	Subsystems map[string]SubsystemHealth `json:"subsystems"`
+}
+
+// healthCheck probes one subsystem; a nil error means it is reachable
+type healthCheck struct {
+	name     string
+	critical bool // the API can't serve requests without it
+	probe    func(ctx context.Context) error
+}
+
+// HealthHandler reports whether the backend's dependencies are reachable
+type HealthHandler struct {
+	checks []healthCheck
+}
+
+// NewHealthHandler checks the database, the RAG service (RAG_API_URL),
+// Ollama (OLLAMA_URL) and the MCP Docker Manager (MCP_MANAGER_URL)
+func NewHealthHandler(db *config.DB) *HealthHandler {
+	rag := services.NewRAGService("")
+	ollamaURL := os.Getenv("OLLAMA_URL")
+	if ollamaURL == "" {
+		ollamaURL = "http://localhost:11434"
+	}
+	managerURL := NewMCPDockerHandler().managerURL
+
+	return &HealthHandler{checks: []healthCheck{
+		{name: "database", critical: true, probe: db.SQLDB.PingContext},
+		{name: "rag", probe: func(ctx context.Context) error { return rag.HealthCheck() }},
+		{name: "ollama", probe: func(ctx context.Context) error { return probeURL(ctx, strings.TrimSuffix(ollamaURL, "/")+"/api/tags") }},
+		{name: "mcp_manager", probe: func(ctx context.Context) error { return probeURL(ctx, managerURL+"/health") }},
+	}}
+}
+
+// probeURL GETs url and expects a 2xx answer
+func probeURL(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := healthProbeClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// DeepHealth probes every subsystem in parallel. A subsystem that is down is
+// reported without failing the request: the answer is 200 unless a critical
+// one (the database) is unavailable, then 503.
+func (h *HealthHandler) DeepHealth(c echo.Context) error {
+	resp := DeepHealthResponse{Healthy: true, Subsystems: make(map[string]SubsystemHealth, len(h.checks))}
+	status := http.StatusOK
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range h.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := runHealthCheck(c.Request().Context(), check)
+			mu.Lock()
+			defer mu.Unlock()
+			resp.Subsystems[check.name] = result
+			if result.Status != "ok" {
+				resp.Healthy = false
+				if check.critical {
+					status = http.StatusServiceUnavailable
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return c.JSON(status, resp)
+}
+
+// runHealthCheck runs a probe, giving up after healthCheckTimeout even when
+// the probe itself ignores its context
+func runHealthCheck(ctx context.Context, check healthCheck) SubsystemHealth {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- check.probe(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("no answer within %s", healthCheckTimeout)
+	}
+	result := SubsystemHealth{Status: "ok", LatencyMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Status = "unavailable"
+		result.Error = err.Error()
+	}
+	return result
+}
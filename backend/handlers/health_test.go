@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestDeepHealthDegraded reports a failing RAG service while the other
+// subsystems answer, without failing the whole check
+func TestDeepHealthDegraded(t *testing.T) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer ok.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	t.Setenv("RAG_API_URL", down.URL)
+	t.Setenv("OLLAMA_URL", ok.URL)
+	t.Setenv("MCP_MANAGER_URL", ok.URL)
+
+	hh := NewHealthHandler(newTestHandler(t).db)
+	c, rec := newJSONContext(http.MethodGet, "/health/deep", nil)
+	if err := hh.DeepHealth(c); err != nil {
+		t.Fatalf("DeepHealth() error = %v", err)
+	}
+	var resp DeepHealthResponse
+	decodeJSON(t, rec, http.StatusOK, &resp)
+
+	if resp.Healthy {
+		t.Error("healthy = true, want false with the RAG service down")
+	}
+	want := map[string]string{"database": "ok", "rag": "unavailable", "ollama": "ok", "mcp_manager": "ok"}
+	for name, status := range want {
+		if got := resp.Subsystems[name]; got.Status != status {
+			t.Errorf("%s = %+v, want %s", name, got, status)
+		}
+	}
+	if resp.Subsystems["rag"].Error == "" {
+		t.Error("rag error is empty")
+	}
+}
+
+// TestDeepHealthCriticalAndTimeout answers 503 when the database is down and
+// gives up on probes that hang
+func TestDeepHealthCriticalAndTimeout(t *testing.T) {
+	old := healthCheckTimeout
+	healthCheckTimeout = 50 * time.Millisecond
+	defer func() { healthCheckTimeout = old }()
+
+	hang := make(chan struct{})
+	defer close(hang)
+	hh := &HealthHandler{checks: []healthCheck{
+		{name: "database", critical: true, probe: func(ctx context.Context) error { return errors.New("disk I/O error") }},
+		{name: "slow", probe: func(ctx context.Context) error { <-hang; return nil }},
+	}}
+	c, rec := newJSONContext(http.MethodGet, "/health/deep", nil)
+	if err := hh.DeepHealth(c); err != nil {
+		t.Fatalf("DeepHealth() error = %v", err)
+	}
+	var resp DeepHealthResponse
+	decodeJSON(t, rec, http.StatusServiceUnavailable, &resp)
+	if resp.Healthy || resp.Subsystems["database"].Error != "disk I/O error" || resp.Subsystems["slow"].Status != "unavailable" {
+		t.Errorf("response = %+v, want database and slow unavailable", resp)
+	}
+}
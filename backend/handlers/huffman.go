@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"sort"
 	"strconv"
@@ -10,15 +12,53 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
+// HuffmanLengthEntry is a symbol and the length of its code
+type HuffmanLengthEntry = struct {
+	Symbol     int `json:"symbol"`
+	CodeLength int `json:"code_length"`
+}
+
+// validateHuffmanLengths checks the code lengths describe a prefix code: each
+// length is in 1..maxHuffmanCodeLength, symbols are unique, and the Kraft sum
+// of 2^-length is exactly 1. A sum above 1 (over-subscribed) can't be decoded
+// uniquely; a sum below 1 (incomplete) leaves unused codes and is only
+// accepted with allowIncomplete.
+func validateHuffmanLengths(entries []HuffmanLengthEntry, allowIncomplete bool) error {
+	seen := make(map[int]bool, len(entries))
+	for _, e := range entries {
+		if e.CodeLength < 1 || e.CodeLength > maxHuffmanCodeLength {
+			return fmt.Errorf("code length %d for symbol %d must be between 1 and %d", e.CodeLength, e.Symbol, maxHuffmanCodeLength)
+		}
+		if seen[e.Symbol] {
+			return fmt.Errorf("duplicate symbol %d", e.Symbol)
+		}
+		seen[e.Symbol] = true
+	}
+
+	// Kraft sum scaled by 2^maxHuffmanCodeLength so it stays an integer
+	var sum, full uint64 = 0, 1 << maxHuffmanCodeLength
+	for _, e := range entries {
+		sum += 1 << (maxHuffmanCodeLength - e.CodeLength)
+	}
+
+	kraft := float64(sum) / float64(full)
+	switch {
+	case sum > full:
+		return fmt.Errorf("code lengths are over-subscribed (Kraft sum %.6g > 1)", kraft)
+	case sum < full && !allowIncomplete:
+		return fmt.Errorf("code lengths are incomplete (Kraft sum %.6g < 1); set allow_incomplete to accept", kraft)
+	}
+	return nil
+}
+
 // CreateHuffmanTable creates a new Huffman table with entries and generates codes
 func (h *Handler) CreateHuffmanTable(c echo.Context) error {
 	var req struct {
-		Name        string `json:"name"`
-		Description string `json:"description"`
-		Entries     []struct {
-			Symbol     int `json:"symbol"`
-			CodeLength int `json:"code_length"`
-		} `json:"entries"`
+		Name        string               `json:"name"`
+		Description string               `json:"description"`
+		Entries     []HuffmanLengthEntry `json:"entries"`
+
+		AllowIncomplete bool `json:"allow_incomplete"` // accept a Kraft sum below 1
 	}
 
 	if err := c.Bind(&req); err != nil {
@@ -33,23 +73,32 @@ func (h *Handler) CreateHuffmanTable(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "At least one entry is required"})
 	}
 
+	if err := validateHuffmanLengths(req.Entries, req.AllowIncomplete); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	return h.createHuffmanTable(c, req.Name, req.Description, req.Entries)
+}
+
+// createHuffmanTable stores a table with generated canonical codes and responds with it
+func (h *Handler) createHuffmanTable(c echo.Context, name, description string, entries []HuffmanLengthEntry) error {
 	// Check if table with this name already exists
 	var existing models.HuffmanTable
-	if err := h.db.GormDB.Where("name = ?", req.Name).First(&existing).Error; err == nil {
+	if err := h.db.GormDB.Where("name = ?", name).First(&existing).Error; err == nil {
 		return c.JSON(http.StatusConflict, map[string]string{"error": "Table with this name already exists"})
 	}
 
 	// Generate Huffman codes using canonical Huffman algorithm
-	codes := generateCanonicalHuffmanCodes(req.Entries)
+	codes := generateCanonicalHuffmanCodes(entries)
 
 	// Create table and entries
 	table := models.HuffmanTable{
-		Name:        req.Name,
-		Description: req.Description,
-		Entries:     make([]models.HuffmanTableEntry, len(req.Entries)),
+		Name:        name,
+		Description: description,
+		Entries:     make([]models.HuffmanTableEntry, len(entries)),
 	}
 
-	for i, entry := range req.Entries {
+	for i, entry := range entries {
 		table.Entries[i] = models.HuffmanTableEntry{
 			Symbol:     entry.Symbol,
 			CodeLength: entry.CodeLength,
@@ -71,10 +120,7 @@ func (h *Handler) CreateHuffmanTable(c echo.Context) error {
 }
 
 // generateCanonicalHuffmanCodes generates canonical Huffman codes from symbol-length pairs
-func generateCanonicalHuffmanCodes(entries []struct {
-	Symbol     int `json:"symbol"`
-	CodeLength int `json:"code_length"`
-}) []string {
+func generateCanonicalHuffmanCodes(entries []HuffmanLengthEntry) []string {
 	// Sort by code length, then by symbol value
 	type sortEntry struct {
 		Symbol int
@@ -167,18 +213,21 @@ func (h *Handler) UpdateHuffmanTable(c echo.Context) error {
 	}
 
 	var req struct {
-		Name        string `json:"name"`
-		Description string `json:"description"`
-		Entries     []struct {
-			Symbol     int `json:"symbol"`
-			CodeLength int `json:"code_length"`
-		} `json:"entries"`
+		Name        string               `json:"name"`
+		Description string               `json:"description"`
+		Entries     []HuffmanLengthEntry `json:"entries"`
+
+		AllowIncomplete bool `json:"allow_incomplete"` // accept a Kraft sum below 1
 	}
 
 	if err := c.Bind(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
 	}
 
+	if err := validateHuffmanLengths(req.Entries, req.AllowIncomplete); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
 	// Check if table exists
 	var table models.HuffmanTable
 	if err := h.db.GormDB.First(&table, uint(id)).Error; err != nil {
@@ -258,35 +307,62 @@ func (h *Handler) DeleteHuffmanTable(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]string{"message": "Table deleted successfully"})
 }
 
+// HuffmanDecodeRequest selects the data to decode with a Huffman table
+type HuffmanDecodeRequest struct {
+	TableID   uint  `json:"table_id"`
+	FileID    uint  `json:"file_id"`
+	Offset    int64 `json:"offset"`
+	Length    int64 `json:"length"`
+	BitOffset int   `json:"bit_offset"` // Start bit within the first byte (0-7)
+}
+
 // DecodeHuffmanSelection decodes a binary selection using a Huffman table
 func (h *Handler) DecodeHuffmanSelection(c echo.Context) error {
-	var req struct {
-		TableID   uint   `json:"table_id"`
-		FileID    uint   `json:"file_id"`
-		Offset    int64  `json:"offset"`
-		Length    int64  `json:"length"`
-		BitOffset int    `json:"bit_offset"` // Start bit within the first byte (0-7)
-	}
-
+	var req HuffmanDecodeRequest
 	if err := c.Bind(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
 	}
 
-	// Load Huffman table with entries
+	table, _, result, status, err := h.decodeHuffmanRequest(req)
+	if err != nil {
+		return c.JSON(status, map[string]string{"error": err.Error()})
+	}
+
+	resp := map[string]interface{}{
+		"table_name":    table.Name,
+		"decoded":       result.Symbols,
+		"count":         len(result.Symbols),
+		"leftover_bits": result.LeftoverBits,
+	}
+	if result.InvalidCodeBit >= 0 {
+		resp["invalid_code_bit"] = result.InvalidCodeBit
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// decodeHuffmanRequest loads the table and file of req and decodes the
+// selection. On failure it returns the status and error to respond with.
+func (h *Handler) decodeHuffmanRequest(req HuffmanDecodeRequest) (models.HuffmanTable, models.File, huffmanDecodeResult, int, error) {
 	var table models.HuffmanTable
+	var file models.File
+
+	if req.BitOffset < 0 || req.BitOffset > 7 {
+		return table, file, huffmanDecodeResult{}, http.StatusBadRequest, errors.New("bit_offset must be between 0 and 7")
+	}
+
+	// Load Huffman table with entries
 	if err := h.db.GormDB.Preload("Entries").First(&table, req.TableID).Error; err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "Table not found"})
+		return table, file, huffmanDecodeResult{}, http.StatusNotFound, errors.New("Table not found")
 	}
 
 	// Load file data
-	var file models.File
 	if err := h.db.GormDB.First(&file, req.FileID).Error; err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "File not found"})
+		return table, file, huffmanDecodeResult{}, http.StatusNotFound, errors.New("File not found")
 	}
 
 	// Extract selection
-	if req.Offset < 0 || req.Offset >= int64(len(file.Data)) {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid offset"})
+	if req.Offset < 0 || req.Offset >= int64(len(file.Data)) || req.Length < 0 {
+		return table, file, huffmanDecodeResult{}, http.StatusBadRequest, errors.New("Invalid offset")
 	}
 
 	endOffset := req.Offset + req.Length
@@ -296,49 +372,112 @@ func (h *Handler) DecodeHuffmanSelection(c echo.Context) error {
 
 	selection := file.Data[req.Offset:endOffset]
 
-	// Build code-to-symbol lookup map
-	codeMap := make(map[string]int)
-	for _, entry := range table.Entries {
-		codeMap[entry.Code] = entry.Symbol
+	decoder, err := newHuffmanDecoder(table.Entries)
+	if err != nil {
+		return table, file, huffmanDecodeResult{}, http.StatusBadRequest, err
 	}
 
 	// Decode the selection
-	decoded := decodeHuffmanData(selection, codeMap, req.BitOffset)
+	return table, file, decoder.decode(selection, req.BitOffset), 0, nil
+}
 
-	return c.JSON(http.StatusOK, map[string]interface{}{
-		"table_name": table.Name,
-		"decoded":    decoded,
-		"count":      len(decoded),
-	})
+// maxHuffmanCodeLength bounds code lengths so a code always fits in an int
+const maxHuffmanCodeLength = 32
+
+var (
+	errHuffmanTruncated   = errors.New("input ends inside a code")
+	errHuffmanInvalidCode = errors.New("bits match no code")
+)
+
+// huffmanDecoder decodes canonical Huffman codes from the number of codes of
+// each length. Codes are assigned in (length, symbol) order, as in
+// generateCanonicalHuffmanCodes, so the first code of each length is implied.
+type huffmanDecoder struct {
+	counts  []int // counts[l] = number of codes of length l
+	symbols []int // symbols sorted by (code length, symbol), i.e. by code
 }
 
-// decodeHuffmanData decodes binary data using a Huffman code map
-func decodeHuffmanData(data []byte, codeMap map[string]int, bitOffset int) []int {
-	var result []int
-	currentCode := ""
-	bitPos := bitOffset
+// huffmanDecodeResult is the output of huffmanDecoder.decode
+type huffmanDecodeResult struct {
+	Symbols        []int
+	LeftoverBits   int   // bits after the last decoded symbol
+	InvalidCodeBit int64 // bit position of an undecodable code, -1 if none
+}
 
-	for byteIdx := 0; byteIdx < len(data); byteIdx++ {
-		b := data[byteIdx]
+// newHuffmanDecoder builds the decode table from a table's entries
+func newHuffmanDecoder(entries []models.HuffmanTableEntry) (*huffmanDecoder, error) {
+	sorted := make([]models.HuffmanTableEntry, 0, len(entries))
+	maxLen := 0
+	for _, e := range entries {
+		if e.CodeLength <= 0 {
+			continue // no code assigned
+		}
+		if e.CodeLength > maxHuffmanCodeLength {
+			return nil, fmt.Errorf("code length %d for symbol %d exceeds %d bits", e.CodeLength, e.Symbol, maxHuffmanCodeLength)
+		}
+		if e.CodeLength > maxLen {
+			maxLen = e.CodeLength
+		}
+		sorted = append(sorted, e)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].CodeLength != sorted[j].CodeLength {
+			return sorted[i].CodeLength < sorted[j].CodeLength
+		}
+		return sorted[i].Symbol < sorted[j].Symbol
+	})
 
-		for bitInByte := bitPos; bitInByte < 8; bitInByte++ {
-			// Extract bit
-			bit := (b >> (7 - bitInByte)) & 1
-			if bit == 1 {
-				currentCode += "1"
-			} else {
-				currentCode += "0"
-			}
+	d := &huffmanDecoder{counts: make([]int, maxLen+1), symbols: make([]int, len(sorted))}
+	for i, e := range sorted {
+		d.counts[e.CodeLength]++
+		d.symbols[i] = e.Symbol
+	}
+	return d, nil
+}
 
-			// Check if current code matches any symbol
-			if symbol, found := codeMap[currentCode]; found {
-				result = append(result, symbol)
-				currentCode = ""
-			}
+// next decodes the symbol starting at bit position pos (MSB-first) and
+// returns it with the number of bits consumed. end is the bit position the
+// input stops at.
+func (d *huffmanDecoder) next(data []byte, pos, end int64) (symbol, consumed int, err error) {
+	code, first, index := 0, 0, 0
+	for length := 1; length < len(d.counts); length++ {
+		if pos+int64(length) > end {
+			return 0, 0, errHuffmanTruncated
 		}
+		code |= int(readBit(data, pos+int64(length)-1, false))
+		count := d.counts[length]
+		if code-first < count {
+			return d.symbols[index+code-first], length, nil
+		}
+		index += count
+		first = (first + count) << 1
+		code <<= 1
+	}
+	return 0, 0, errHuffmanInvalidCode
+}
 
-		bitPos = 0 // After first byte, always start at bit 0
+// decode decodes data starting bitOffset bits into the first byte. It stops
+// at the first bit sequence that matches no code.
+func (d *huffmanDecoder) decode(data []byte, bitOffset int) huffmanDecodeResult {
+	result := huffmanDecodeResult{Symbols: []int{}, InvalidCodeBit: -1}
+	end := int64(len(data)) * 8
+	pos := int64(bitOffset)
+
+	for pos < end {
+		symbol, consumed, err := d.next(data, pos, end)
+		if err == errHuffmanInvalidCode {
+			result.InvalidCodeBit = pos
+			break
+		}
+		if err != nil {
+			break
+		}
+		result.Symbols = append(result.Symbols, symbol)
+		pos += int64(consumed)
 	}
 
+	if pos < end {
+		result.LeftoverBits = int(end - pos)
+	}
 	return result
 }
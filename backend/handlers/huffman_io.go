@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"binary-annotator-pro/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// huffmanExportFormat identifies exported table documents
+const huffmanExportFormat = "binary-annotator-pro/huffman-table"
+
+// HuffmanTableExport is the portable form of a Huffman table. Codes are not
+// stored: they are regenerated canonically from the lengths on import.
+type HuffmanTableExport struct {
+	Format      string               `json:"format"`
+	Version     int                  `json:"version"`
+	Name        string               `json:"name"`
+	Description string               `json:"description,omitempty"`
+	Entries     []HuffmanLengthEntry `json:"entries,omitempty"`
+}
+
+// HuffmanTableImport accepts an exported table, or a DEFLATE-style
+// run-length-encoded code-length list in place of entries.
+type HuffmanTableImport struct {
+	HuffmanTableExport
+
+	// CodeLengthsRLE lists code lengths indexed by symbol (0 = unused), using
+	// DEFLATE's repeat codes each followed by its repeat count:
+	// 16 n repeats the previous length n (3-6) times, 17 n and 18 n write n
+	// zeros (3-10 and 11-138).
+	CodeLengthsRLE  []int `json:"code_lengths_rle,omitempty"`
+	AllowIncomplete bool  `json:"allow_incomplete"`
+}
+
+// ExportHuffmanTable returns a table as portable JSON (symbols + code lengths)
+func (h *Handler) ExportHuffmanTable(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid table ID"})
+	}
+
+	var table models.HuffmanTable
+	if err := h.db.GormDB.Preload("Entries").First(&table, uint(id)).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Table not found"})
+	}
+
+	export := HuffmanTableExport{
+		Format:      huffmanExportFormat,
+		Version:     1,
+		Name:        table.Name,
+		Description: table.Description,
+		Entries:     make([]HuffmanLengthEntry, len(table.Entries)),
+	}
+	for i, e := range table.Entries {
+		export.Entries[i] = HuffmanLengthEntry{Symbol: e.Symbol, CodeLength: e.CodeLength}
+	}
+	sort.Slice(export.Entries, func(i, j int) bool { return export.Entries[i].Symbol < export.Entries[j].Symbol })
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=\"%s.huffman.json\"", table.Name))
+	return c.JSON(http.StatusOK, export)
+}
+
+// ImportHuffmanTable recreates a table from an export or an RLE code-length list
+func (h *Handler) ImportHuffmanTable(c echo.Context) error {
+	var req HuffmanTableImport
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	if req.Format != "" && req.Format != huffmanExportFormat {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Unsupported format %q", req.Format)})
+	}
+	if req.Version > 1 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Unsupported version %d", req.Version)})
+	}
+	if req.Name == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Name is required"})
+	}
+
+	entries := req.Entries
+	if len(req.CodeLengthsRLE) > 0 {
+		if len(entries) > 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Provide either entries or code_lengths_rle, not both"})
+		}
+		lengths, err := decodeCodeLengthsRLE(req.CodeLengthsRLE)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		for symbol, l := range lengths {
+			if l > 0 {
+				entries = append(entries, HuffmanLengthEntry{Symbol: symbol, CodeLength: l})
+			}
+		}
+	}
+
+	if len(entries) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "At least one entry is required"})
+	}
+	if err := validateHuffmanLengths(entries, req.AllowIncomplete); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	return h.createHuffmanTable(c, req.Name, req.Description, entries)
+}
+
+// decodeCodeLengthsRLE expands a DEFLATE-style code-length list into one
+// length per symbol
+func decodeCodeLengthsRLE(rle []int) ([]int, error) {
+	var lengths []int
+	for i := 0; i < len(rle); i++ {
+		code := rle[i]
+		if code >= 0 && code <= 15 {
+			lengths = append(lengths, code)
+			continue
+		}
+
+		if i+1 >= len(rle) {
+			return nil, fmt.Errorf("code_lengths_rle[%d]: repeat code %d is missing its count", i, code)
+		}
+		count := rle[i+1]
+		value := 0
+		var lo, hi int
+		switch code {
+		case 16:
+			if len(lengths) == 0 {
+				return nil, fmt.Errorf("code_lengths_rle[%d]: repeat code 16 has no previous length", i)
+			}
+			value, lo, hi = lengths[len(lengths)-1], 3, 6
+		case 17:
+			lo, hi = 3, 10
+		case 18:
+			lo, hi = 11, 138
+		default:
+			return nil, fmt.Errorf("code_lengths_rle[%d]: invalid code %d", i, code)
+		}
+		if count < lo || count > hi {
+			return nil, fmt.Errorf("code_lengths_rle[%d]: repeat count %d for code %d must be %d-%d", i+1, count, code, lo, hi)
+		}
+		for n := 0; n < count; n++ {
+			lengths = append(lengths, value)
+		}
+		i++
+	}
+	return lengths, nil
+}
+
+// HuffmanDecodeToFileRequest selects the data to decode and how to pack symbols
+type HuffmanDecodeToFileRequest struct {
+	HuffmanDecodeRequest
+	SymbolWidth int    `json:"symbol_width"` // bytes per symbol: 1 (default), 2 or 4
+	Endian      string `json:"endian"`       // "little" (default) or "big", for widths > 1
+}
+
+// DecodeHuffmanToFile decodes a selection and stores the symbols as a new File
+// named <orig>.huffman-decoded
+func (h *Handler) DecodeHuffmanToFile(c echo.Context) error {
+	tableID, err := strconv.ParseUint(c.Param("tableId"), 10, 32)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid table ID"})
+	}
+
+	var req HuffmanDecodeToFileRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	req.TableID = uint(tableID)
+	if req.SymbolWidth == 0 {
+		req.SymbolWidth = 1
+	}
+	if req.Endian == "" {
+		req.Endian = "little"
+	}
+	if req.Endian != "little" && req.Endian != "big" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "endian must be little or big"})
+	}
+
+	table, file, result, status, err := h.decodeHuffmanRequest(req.HuffmanDecodeRequest)
+	if err != nil {
+		return c.JSON(status, map[string]string{"error": err.Error()})
+	}
+
+	data, err := packSymbols(result.Symbols, req.SymbolWidth, req.Endian == "big")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	newFileName := file.Name + ".huffman-decoded"
+	var existing models.File
+	if err := h.db.GormDB.Select("id").Where("name = ?", newFileName).First(&existing).Error; err == nil {
+		return c.JSON(http.StatusConflict, map[string]interface{}{
+			"error":   fmt.Sprintf("file %s already exists", newFileName),
+			"file_id": existing.ID,
+		})
+	}
+
+	newFile := models.File{
+		Name:    newFileName,
+		Vendor:  file.Vendor,
+		Size:    int64(len(data)),
+		Hash:    contentHash(data),
+		Entropy: fileEntropy(data),
+		Data:    data,
+	}
+	if err := h.db.GormDB.Create(&newFile).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create decoded file"})
+	}
+
+	decodeInfo := map[string]interface{}{
+		"table_name":    table.Name,
+		"count":         len(result.Symbols),
+		"symbol_width":  req.SymbolWidth,
+		"endian":        req.Endian,
+		"leftover_bits": result.LeftoverBits,
+	}
+	if result.InvalidCodeBit >= 0 {
+		decodeInfo["invalid_code_bit"] = result.InvalidCodeBit
+	}
+
+	resp := map[string]interface{}{
+		"message": "selection decoded to file",
+		"file": map[string]interface{}{
+			"id":   newFile.ID,
+			"name": newFile.Name,
+			"size": newFile.Size,
+		},
+		"decode_info": decodeInfo,
+	}
+	return c.JSON(http.StatusCreated, resp)
+}
+
+// packSymbols writes each symbol in width bytes. Symbols must fit the width
+// either unsigned or as two's complement (e.g. -128..255 for one byte).
+func packSymbols(symbols []int, width int, bigEndian bool) ([]byte, error) {
+	if width != 1 && width != 2 && width != 4 {
+		return nil, fmt.Errorf("symbol_width must be 1, 2 or 4")
+	}
+
+	bits := uint(width * 8)
+	minValue, maxValue := -(int64(1) << (bits - 1)), int64(1)<<bits-1
+	out := make([]byte, 0, len(symbols)*width)
+	for i, s := range symbols {
+		if int64(s) < minValue || int64(s) > maxValue {
+			return nil, fmt.Errorf("symbol %d at index %d does not fit in %d byte(s); use a larger symbol_width", s, i, width)
+		}
+		v := uint32(s)
+		for b := 0; b < width; b++ {
+			shift := uint(b * 8)
+			if bigEndian {
+				shift = uint((width - 1 - b) * 8)
+			}
+			out = append(out, byte(v>>shift))
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"binary-annotator-pro/models"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// decodeHuffmanReference is the original string-matching decoder, kept to
+// check the table decoder against. It returns the symbols and leftover bits.
+func decodeHuffmanReference(data []byte, codeMap map[string]int, bitOffset int) ([]int, int) {
+	result := []int{}
+	currentCode := ""
+	bitPos := bitOffset
+
+	for byteIdx := 0; byteIdx < len(data); byteIdx++ {
+		b := data[byteIdx]
+		for bitInByte := bitPos; bitInByte < 8; bitInByte++ {
+			if (b>>(7-bitInByte))&1 == 1 {
+				currentCode += "1"
+			} else {
+				currentCode += "0"
+			}
+			if symbol, found := codeMap[currentCode]; found {
+				result = append(result, symbol)
+				currentCode = ""
+			}
+		}
+		bitPos = 0
+	}
+
+	return result, len(currentCode)
+}
+
+// testHuffmanEntries builds a complete canonical table (codes from generateCanonicalHuffmanCodes)
+func testHuffmanEntries() []models.HuffmanTableEntry {
+	lengths := []struct {
+		Symbol     int `json:"symbol"`
+		CodeLength int `json:"code_length"`
+	}{
+		{0, 2}, {1, 2}, {-1, 2}, {2, 3}, {-2, 4}, {3, 5}, {-3, 6}, {4, 7}, {-4, 7},
+	}
+	codes := generateCanonicalHuffmanCodes(lengths)
+	entries := make([]models.HuffmanTableEntry, len(lengths))
+	for i, l := range lengths {
+		entries[i] = models.HuffmanTableEntry{Symbol: l.Symbol, CodeLength: l.CodeLength, Code: codes[i]}
+	}
+	return entries
+}
+
+func testHuffmanData(n int) []byte {
+	rng := rand.New(rand.NewSource(1))
+	data := make([]byte, n)
+	rng.Read(data)
+	return data
+}
+
+// TestHuffmanDecoderMatchesReference compares the table decoder with the original implementation
+func TestHuffmanDecoderMatchesReference(t *testing.T) {
+	entries := testHuffmanEntries()
+	codeMap := map[string]int{}
+	for _, e := range entries {
+		codeMap[e.Code] = e.Symbol
+	}
+	decoder, err := newHuffmanDecoder(entries)
+	if err != nil {
+		t.Fatalf("newHuffmanDecoder() error = %v", err)
+	}
+
+	for _, size := range []int{0, 1, 3, 64, 4096} {
+		data := testHuffmanData(size)
+		for bitOffset := 0; bitOffset < 8; bitOffset++ {
+			wantSymbols, wantLeftover := decodeHuffmanReference(data, codeMap, bitOffset)
+			got := decoder.decode(data, bitOffset)
+			if !reflect.DeepEqual(got.Symbols, wantSymbols) {
+				t.Fatalf("size %d offset %d: symbols differ from reference (%d vs %d)", size, bitOffset, len(got.Symbols), len(wantSymbols))
+			}
+			if got.LeftoverBits != wantLeftover {
+				t.Errorf("size %d offset %d: leftover = %d, want %d", size, bitOffset, got.LeftoverBits, wantLeftover)
+			}
+			if got.InvalidCodeBit != -1 {
+				t.Errorf("size %d offset %d: invalid code at bit %d in a complete code", size, bitOffset, got.InvalidCodeBit)
+			}
+		}
+	}
+}
+
+// TestHuffmanDecoderInvalidCode stops at bits that match no code of an incomplete table
+func TestHuffmanDecoderInvalidCode(t *testing.T) {
+	// Codes: A=0, B=10; "11" is unused
+	decoder, err := newHuffmanDecoder([]models.HuffmanTableEntry{
+		{Symbol: 'A', CodeLength: 1},
+		{Symbol: 'B', CodeLength: 2},
+	})
+	if err != nil {
+		t.Fatalf("newHuffmanDecoder() error = %v", err)
+	}
+
+	// 0 10 0 11 ...
+	got := decoder.decode([]byte{0b01001100}, 0)
+	if !reflect.DeepEqual(got.Symbols, []int{'A', 'B', 'A'}) {
+		t.Errorf("symbols = %v, want A B A", got.Symbols)
+	}
+	if got.InvalidCodeBit != 4 || got.LeftoverBits != 4 {
+		t.Errorf("invalid at %d leftover %d, want 4 and 4", got.InvalidCodeBit, got.LeftoverBits)
+	}
+}
+
+// BenchmarkHuffmanDecode compares the table decoder with the original string matcher
+func BenchmarkHuffmanDecode(b *testing.B) {
+	entries := testHuffmanEntries()
+	codeMap := map[string]int{}
+	for _, e := range entries {
+		codeMap[e.Code] = e.Symbol
+	}
+	decoder, _ := newHuffmanDecoder(entries)
+	data := testHuffmanData(64 * 1024)
+
+	b.Run("table", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			decoder.decode(data, 0)
+		}
+	})
+	b.Run("reference", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			decodeHuffmanReference(data, codeMap, 0)
+		}
+	})
+}
+
+// huffmanTableRequest builds a create/update body from symbol:length pairs
+func huffmanTableRequest(name string, allowIncomplete bool, lengths ...int) map[string]interface{} {
+	entries := make([]HuffmanLengthEntry, len(lengths))
+	for i, l := range lengths {
+		entries[i] = HuffmanLengthEntry{Symbol: i, CodeLength: l}
+	}
+	return map[string]interface{}{"name": name, "entries": entries, "allow_incomplete": allowIncomplete}
+}
+
+// TestCreateHuffmanTableKraft accepts only complete code lengths unless incomplete tables are allowed
+func TestCreateHuffmanTableKraft(t *testing.T) {
+	h := newTestHandler(t)
+
+	tests := []struct {
+		name       string
+		body       map[string]interface{}
+		wantStatus int
+	}{
+		{"complete", huffmanTableRequest("complete", false, 1, 2, 3, 3), http.StatusCreated},
+		{"incomplete", huffmanTableRequest("incomplete", false, 1, 2, 3), http.StatusBadRequest},
+		{"incomplete allowed", huffmanTableRequest("incomplete_ok", true, 1, 2, 3), http.StatusCreated},
+		{"over-subscribed", huffmanTableRequest("over", false, 1, 1, 2), http.StatusBadRequest},
+		{"over-subscribed allowed", huffmanTableRequest("over_ok", true, 1, 1, 2), http.StatusBadRequest},
+		{"zero length", huffmanTableRequest("zero", false, 1, 0, 1), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, rec := newJSONContext(http.MethodPost, "/huffman/tables", tt.body)
+			h.CreateHuffmanTable(c)
+			decodeJSON(t, rec, tt.wantStatus, nil)
+		})
+	}
+
+	// Updates are validated the same way
+	var table models.HuffmanTable
+	h.db.GormDB.Where("name = ?", "complete").First(&table)
+	c, rec := newJSONContext(http.MethodPut, "/huffman/tables/1", huffmanTableRequest("complete", false, 1, 1, 1))
+	c.SetParamNames("id")
+	c.SetParamValues(fmt.Sprint(table.ID))
+	h.UpdateHuffmanTable(c)
+	decodeJSON(t, rec, http.StatusBadRequest, nil)
+}
+
+// TestHuffmanExportImportRoundTrip exports a table, imports it under a new name and compares codes
+func TestHuffmanExportImportRoundTrip(t *testing.T) {
+	h := newTestHandler(t)
+
+	c, rec := newJSONContext(http.MethodPost, "/huffman/tables", huffmanTableRequest("fukuda", false, 2, 2, 2, 3, 4, 5, 6, 7, 7))
+	h.CreateHuffmanTable(c)
+	var original models.HuffmanTable
+	decodeJSON(t, rec, http.StatusCreated, &original)
+
+	c, rec = newJSONContext(http.MethodGet, "/huffman/1/export", nil)
+	c.SetParamNames("id")
+	c.SetParamValues(fmt.Sprint(original.ID))
+	h.ExportHuffmanTable(c)
+	var export HuffmanTableExport
+	decodeJSON(t, rec, http.StatusOK, &export)
+	if export.Format != huffmanExportFormat || len(export.Entries) != 9 {
+		t.Fatalf("export = %+v", export)
+	}
+
+	export.Name = "fukuda_copy"
+	c, rec = newJSONContext(http.MethodPost, "/huffman/import", export)
+	h.ImportHuffmanTable(c)
+	var imported models.HuffmanTable
+	decodeJSON(t, rec, http.StatusCreated, &imported)
+
+	if imported.Name != "fukuda_copy" || !reflect.DeepEqual(codesBySymbol(imported), codesBySymbol(original)) {
+		t.Errorf("imported codes %v, want %v", codesBySymbol(imported), codesBySymbol(original))
+	}
+
+	// Importing again under the same name conflicts
+	c, rec = newJSONContext(http.MethodPost, "/huffman/import", export)
+	h.ImportHuffmanTable(c)
+	decodeJSON(t, rec, http.StatusConflict, nil)
+}
+
+// TestImportHuffmanTableRLE builds a table from a DEFLATE-style run-length-encoded length list
+func TestImportHuffmanTableRLE(t *testing.T) {
+	h := newTestHandler(t)
+
+	// 2, then 2 repeated 3 times, 11 zeros, then 2: symbols 0-3 and 15 have length 2
+	rle := []int{2, 16, 3, 18, 11, 2}
+	lengths, err := decodeCodeLengthsRLE(rle)
+	if err != nil {
+		t.Fatalf("decodeCodeLengthsRLE() error = %v", err)
+	}
+	if len(lengths) != 16 || lengths[3] != 2 || lengths[4] != 0 || lengths[15] != 2 {
+		t.Fatalf("lengths = %v", lengths)
+	}
+
+	body := map[string]interface{}{"name": "rle", "code_lengths_rle": []int{2, 2, 17, 3, 2, 2}}
+	c, rec := newJSONContext(http.MethodPost, "/huffman/import", body)
+	h.ImportHuffmanTable(c)
+	var table models.HuffmanTable
+	decodeJSON(t, rec, http.StatusCreated, &table)
+	got := codesBySymbol(table)
+	want := map[int]string{0: "00", 1: "01", 5: "10", 6: "11"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("codes = %v, want %v", got, want)
+	}
+
+	for _, bad := range [][]int{{16, 3}, {2, 16, 7}, {18, 5}, {19}, {2, 17}} {
+		if _, err := decodeCodeLengthsRLE(bad); err == nil {
+			t.Errorf("decodeCodeLengthsRLE(%v) succeeded, want error", bad)
+		}
+	}
+}
+
+func codesBySymbol(table models.HuffmanTable) map[int]string {
+	m := map[int]string{}
+	for _, e := range table.Entries {
+		m[e.Symbol] = e.Code
+	}
+	return m
+}
+
+// TestDecodeHuffmanToFile stores the decoded symbols of a selection as a new file
+func TestDecodeHuffmanToFile(t *testing.T) {
+	h := newTestHandler(t)
+
+	// Canonical codes: 7=0, 3=10, 200=11
+	c, rec := newJSONContext(http.MethodPost, "/huffman/tables", map[string]interface{}{
+		"name": "small",
+		"entries": []HuffmanLengthEntry{
+			{Symbol: 7, CodeLength: 1}, {Symbol: 200, CodeLength: 2}, {Symbol: 3, CodeLength: 2},
+		},
+	})
+	h.CreateHuffmanTable(c)
+	var table models.HuffmanTable
+	decodeJSON(t, rec, http.StatusCreated, &table)
+
+	// Selection is the middle byte: 0 10 11 0 0 0
+	source := createTestFile(t, h, "rec.bin", []byte{0xFF, 0b01011000, 0b11100000})
+
+	decodeToFile := func(body map[string]interface{}, wantStatus int) {
+		c, rec := newJSONContext(http.MethodPost, "/huffman/1/decode-to-file", body)
+		c.SetParamNames("tableId")
+		c.SetParamValues(fmt.Sprint(table.ID))
+		h.DecodeHuffmanToFile(c)
+		decodeJSON(t, rec, wantStatus, nil)
+	}
+
+	decodeToFile(map[string]interface{}{"file_id": source.ID, "offset": 1, "length": 1}, http.StatusCreated)
+
+	var decoded models.File
+	if err := h.db.GormDB.Where("name = ?", "rec.bin.huffman-decoded").First(&decoded).Error; err != nil {
+		t.Fatalf("decoded file not created: %v", err)
+	}
+	if want := []byte{7, 3, 200, 7, 7, 7}; !reflect.DeepEqual(decoded.Data, want) {
+		t.Errorf("decoded data = %v, want %v", decoded.Data, want)
+	}
+
+	// Same output name again conflicts
+	decodeToFile(map[string]interface{}{"file_id": source.ID, "offset": 1, "length": 1}, http.StatusConflict)
+
+	packed, err := packSymbols([]int{200, -2}, 2, true)
+	if err != nil || !reflect.DeepEqual(packed, []byte{0x00, 0xC8, 0xFF, 0xFE}) {
+		t.Errorf("packSymbols(16-bit BE) = % X, %v", packed, err)
+	}
+	if _, err := packSymbols([]int{256}, 1, false); err == nil {
+		t.Error("packSymbols(256, width 1) succeeded, want error")
+	}
+}
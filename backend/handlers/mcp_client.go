@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// MCP Docker Manager call policy. A call is tried up to mcpMaxAttempts times,
+// waiting mcpRetryDelay, then twice that, between attempts. After
+// mcpBreakerThreshold failed calls in a row the breaker opens and calls fail
+// fast for mcpBreakerCooldown, so a dead manager doesn't stall every chat.
+// Variables so tests can shorten them.
+var (
+	mcpManagerTimeout   = 2 * time.Minute // tool calls can be slow
+	mcpMaxAttempts      = 3
+	mcpRetryDelay       = 200 * time.Millisecond
+	mcpBreakerThreshold = 5
+	mcpBreakerCooldown  = 30 * time.Second
+)
+
+// errMCPUnavailable is returned without contacting the manager while the
+// breaker is open
+var errMCPUnavailable = errors.New("MCP unavailable: the MCP Docker Manager failed repeatedly")
+
+var mcpManagerClient = &http.Client{Timeout: mcpManagerTimeout}
+
+// circuitBreaker counts consecutive failures. Its zero value is closed.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+// allow reports whether a call may go out, or how long the breaker stays open.
+// Once the cooldown is over calls go through again; a failure reopens it.
+func (b *circuitBreaker) allow(now time.Time) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if now.Before(b.openUntil) {
+		return false, b.openUntil.Sub(now)
+	}
+	return true, 0
+}
+
+// record counts the outcome of a call
+func (b *circuitBreaker) record(now time.Time, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= mcpBreakerThreshold {
+		b.openUntil = now.Add(mcpBreakerCooldown)
+	}
+}
+
+// managerUnavailable reports whether a response means the manager itself is
+// down or overloaded, rather than the request being wrong
+func managerUnavailable(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+// send makes a request to the manager through the breaker, retrying failures
+// that are safe to retry: any failure of a GET, and for other methods only
+// refused connections and unavailable responses, where the call never ran.
+// The caller closes the response body.
+func (h *MCPDockerHandler) send(method, path string, body []byte) (*http.Response, error) {
+	if ok, wait := h.breaker.allow(time.Now()); !ok {
+		return nil, fmt.Errorf("%w, retrying in %s", errMCPUnavailable, wait.Round(time.Second))
+	}
+
+	var resp *http.Response
+	var err error
+	delay := mcpRetryDelay
+	for attempt := 1; ; attempt++ {
+		resp, err = h.sendOnce(method, path, body)
+		retryable := (err != nil && (method == http.MethodGet || errors.Is(err, syscall.ECONNREFUSED))) ||
+			(err == nil && managerUnavailable(resp.StatusCode))
+		if !retryable || attempt == mcpMaxAttempts {
+			break
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+
+	h.breaker.record(time.Now(), err != nil || managerUnavailable(resp.StatusCode))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	return resp, nil
+}
+
+func (h *MCPDockerHandler) sendOnce(method, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, h.managerURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return mcpManagerClient.Do(req)
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// shortRetries makes manager retries immediate for the test
+func shortRetries(t *testing.T) {
+	old := mcpRetryDelay
+	mcpRetryDelay = time.Millisecond
+	t.Cleanup(func() { mcpRetryDelay = old })
+}
+
+func TestManagerCallRetriesTransientFailures(t *testing.T) {
+	shortRetries(t)
+	var requests atomic.Int32
+	manager := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	}))
+	defer manager.Close()
+
+	h := &MCPDockerHandler{managerURL: manager.URL}
+	result, err := h.proxyRequest(http.MethodGet, "/health", nil)
+	if err != nil || result["status"] != "ok" {
+		t.Fatalf("proxyRequest() = %v, %v; want the third attempt's answer", result, err)
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("manager saw %d requests, want 3", n)
+	}
+}
+
+func TestManagerBreakerOpensAfterSustainedFailure(t *testing.T) {
+	shortRetries(t)
+	var requests atomic.Int32
+	manager := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer manager.Close()
+
+	h := &MCPDockerHandler{managerURL: manager.URL}
+	for i := 0; i < mcpBreakerThreshold; i++ {
+		if _, err := h.proxyRequest(http.MethodPost, "/servers/s/call", map[string]string{"tool": "t"}); err == nil || errors.Is(err, errMCPUnavailable) {
+			t.Fatalf("call %d: err = %v, want the manager's error", i, err)
+		}
+	}
+	if n := requests.Load(); n != int32(mcpBreakerThreshold*mcpMaxAttempts) {
+		t.Errorf("manager saw %d requests, want %d", n, mcpBreakerThreshold*mcpMaxAttempts)
+	}
+
+	// Open: fails fast without reaching the manager
+	before := requests.Load()
+	_, err := h.proxyRequest(http.MethodGet, "/servers", nil)
+	if !errors.Is(err, errMCPUnavailable) {
+		t.Fatalf("err = %v, want errMCPUnavailable", err)
+	}
+	if requests.Load() != before {
+		t.Error("open breaker still called the manager")
+	}
+	if got := classifyToolError(err); got != toolFailureTransport {
+		t.Errorf("classifyToolError() = %s, want transport", got)
+	}
+
+	// After the cooldown a call goes through again
+	h.breaker.openUntil = time.Now()
+	if _, err := h.proxyRequest(http.MethodGet, "/servers", nil); errors.Is(err, errMCPUnavailable) {
+		t.Errorf("breaker still open after cooldown: %v", err)
+	}
+}
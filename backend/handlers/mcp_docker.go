@@ -1,12 +1,17 @@
 package handlers
 
 import (
-	"bytes"
+	"binary-annotator-pro/logging"
+	"binary-annotator-pro/metrics"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/labstack/echo/v4"
 )
@@ -14,6 +19,37 @@ import (
 // MCPDockerHandler handles MCP Docker Manager operations
 type MCPDockerHandler struct {
 	managerURL string
+	breaker    circuitBreaker
+
+	// servers are the server names the manager has reported, the only
+	// ones used as metric labels
+	servers knownServers
+}
+
+// knownServers is a set of MCP server names, safe for concurrent use
+type knownServers struct {
+	mu    sync.Mutex
+	names map[string]bool
+}
+
+func (k *knownServers) add(name string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.names == nil {
+		k.names = map[string]bool{}
+	}
+	k.names[name] = true
+}
+
+// label is name when the manager reported it, "unknown" otherwise, so
+// clients calling made-up servers can't create new label values
+func (k *knownServers) label(name string) string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.names[name] {
+		return name
+	}
+	return "unknown"
 }
 
 // NewMCPDockerHandler creates a new MCP Docker Manager handler
@@ -29,71 +65,227 @@ func NewMCPDockerHandler() *MCPDockerHandler {
 
 // proxyRequest forwards a request to the MCP Docker Manager
 func (h *MCPDockerHandler) proxyRequest(method, path string, body interface{}) (map[string]interface{}, error) {
-	url := h.managerURL + path
-
-	var reqBody io.Reader
+	var reqBody []byte
 	if body != nil {
 		jsonData, err := json.Marshal(body)
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal request: %w", err)
 		}
-		reqBody = bytes.NewBuffer(jsonData)
-	}
-
-	req, err := http.NewRequest(method, url, reqBody)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		reqBody = jsonData
 	}
 
-	if body != nil {
-		req.Header.Set("Content-Type", "application/json")
-	}
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := h.send(method, path, reqBody)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
+	decodeErr := json.NewDecoder(resp.Body).Decode(&result)
 
 	if resp.StatusCode >= 400 {
-		if errMsg, ok := result["error"].(string); ok {
-			return nil, fmt.Errorf("manager error: %s", errMsg)
-		}
-		return nil, fmt.Errorf("manager returned status %d", resp.StatusCode)
+		errMsg, _ := result["error"].(string)
+		return nil, &managerError{StatusCode: resp.StatusCode, Message: errMsg}
+	}
+	if decodeErr != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", decodeErr)
 	}
 
 	return result, nil
 }
 
+// callTool runs a tool on a server through the manager, logging the call and
+// how long it took with the logger of ctx
+func (h *MCPDockerHandler) callTool(ctx context.Context, server, tool string, arguments map[string]interface{}) (map[string]interface{}, error) {
+	start := time.Now()
+	result, err := h.proxyRequest("POST", "/servers/"+server+"/call", map[string]interface{}{
+		"tool":      tool,
+		"arguments": arguments,
+	})
+	if err == nil {
+		h.servers.add(server)
+	}
+	metrics.MCPToolCallDuration.WithLabelValues(h.servers.label(server), metrics.Status(err)).Observe(metrics.Since(start))
+	logger := logging.FromContext(ctx).With("server", server, "tool", tool, "duration", time.Since(start))
+	if err != nil {
+		logger.Warn("MCP tool call failed", "error", err)
+	} else {
+		logger.Info("MCP tool call")
+	}
+	return result, err
+}
+
+// managerError is an error response from the MCP Docker Manager
+type managerError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *managerError) Error() string {
+	if e.Message != "" {
+		return "manager error: " + e.Message
+	}
+	return fmt.Sprintf("manager returned status %d", e.StatusCode)
+}
+
 // ListMCPServers lists all running MCP servers
 func (h *MCPDockerHandler) ListMCPServers(c echo.Context) error {
-	url := h.managerURL + "/servers"
-
-	req, err := http.NewRequest("GET", url, nil)
+	servers, err := h.listServers()
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	return c.JSON(http.StatusOK, servers)
+}
+
+// listServers returns the manager's /servers listing, one map per running
+// server with its name, image and tools
+func (h *MCPDockerHandler) listServers() ([]map[string]interface{}, error) {
+	resp, err := h.send(http.MethodGet, "/servers", nil)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return nil, fmt.Errorf("failed to fetch servers: %w", err)
 	}
 	defer resp.Body.Close()
 
-	// Decode as array since /servers returns an array
-	var servers []interface{}
+	// Note: /servers returns an array, not an object
+	var servers []map[string]interface{}
 	if err := json.NewDecoder(resp.Body).Decode(&servers); err != nil {
+		return nil, fmt.Errorf("failed to decode servers: %w", err)
+	}
+	for _, server := range servers {
+		if name, ok := server["name"].(string); ok {
+			h.servers.add(name)
+		}
+	}
+	return servers, nil
+}
+
+// MCPToolInfo is a tool of a running MCP server as listed by GET /mcp/tools.
+// Name is the server's own name for the tool, without the server:: prefix
+// the chat adds when two servers expose the same name.
+type MCPToolInfo struct {
+	Server      string                 `json:"server"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"input_schema,omitempty"`
+}
+
+// ListMCPTools returns the tools of every running MCP server, so a client can
+// show what the chat can do before a conversation starts
+func (h *MCPDockerHandler) ListMCPTools(c echo.Context) error {
+	servers, err := h.listServers()
+	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
+	return c.JSON(http.StatusOK, mcpToolCatalog(servers))
+}
 
-	return c.JSON(http.StatusOK, servers)
+// mcpToolCatalog flattens the tools of a /servers listing, in server order
+func mcpToolCatalog(servers []map[string]interface{}) []MCPToolInfo {
+	catalog := []MCPToolInfo{}
+	for _, server := range servers {
+		serverName, _ := server["name"].(string)
+		tools, _ := server["tools"].([]interface{})
+		for _, toolData := range tools {
+			toolMap, ok := toolData.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			tool := MCPToolInfo{Server: serverName}
+			tool.Name, _ = toolMap["name"].(string)
+			tool.Description, _ = toolMap["description"].(string)
+			tool.InputSchema, _ = toolMap["inputSchema"].(map[string]interface{})
+			catalog = append(catalog, tool)
+		}
+	}
+	return catalog
+}
+
+// errToolNotFound and errToolAmbiguous are returned by findMCPTool
+var (
+	errToolNotFound  = errors.New("tool not found on any running server")
+	errToolAmbiguous = errors.New("tool exposed by several servers, use server::tool")
+)
+
+// findMCPTool looks a tool up by name in the tools of the running servers.
+// A name exposed by several servers must be given as server::tool, the form
+// the chat uses for them; on errToolAmbiguous the matches are returned too.
+func (h *MCPDockerHandler) findMCPTool(name string) (MCPToolInfo, []MCPToolInfo, error) {
+	servers, err := h.listServers()
+	if err != nil {
+		return MCPToolInfo{}, nil, err
+	}
+	serverName, toolName, qualified := strings.Cut(name, mcpToolSeparator)
+	if !qualified {
+		toolName = name
+	}
+
+	var matches []MCPToolInfo
+	for _, tool := range mcpToolCatalog(servers) {
+		if tool.Name == toolName && (!qualified || tool.Server == serverName) {
+			matches = append(matches, tool)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return MCPToolInfo{}, nil, errToolNotFound
+	case 1:
+		return matches[0], nil, nil
+	default:
+		return MCPToolInfo{}, matches, errToolAmbiguous
+	}
+}
+
+// mcpToolLookupError answers a failed findMCPTool
+func mcpToolLookupError(c echo.Context, name string, matches []MCPToolInfo, err error) error {
+	switch {
+	case errors.Is(err, errToolNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": fmt.Sprintf("%s: %v", name, err)})
+	case errors.Is(err, errToolAmbiguous):
+		servers := make([]string, len(matches))
+		for i, tool := range matches {
+			servers[i] = tool.Server
+		}
+		return c.JSON(http.StatusConflict, map[string]interface{}{"error": fmt.Sprintf("%s: %v", name, err), "servers": servers})
+	default:
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+}
+
+// GetMCPToolSchema returns a tool with its input schema. The tool is named
+// alone, or as server::tool when several servers expose it.
+func (h *MCPDockerHandler) GetMCPToolSchema(c echo.Context) error {
+	name := c.Param("name")
+	tool, matches, err := h.findMCPTool(name)
+	if err != nil {
+		return mcpToolLookupError(c, name, matches, err)
+	}
+	return c.JSON(http.StatusOK, tool)
+}
+
+// CallMCPToolByName calls a tool on whichever running server hosts it and
+// returns the raw result. Unlike tool calls made by the chat, it doesn't ask
+// for approval: it is meant for the UI and for developing tools.
+func (h *MCPDockerHandler) CallMCPToolByName(c echo.Context) error {
+	name := c.Param("name")
+
+	var req struct {
+		Arguments map[string]interface{} `json:"arguments"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	tool, matches, err := h.findMCPTool(name)
+	if err != nil {
+		return mcpToolLookupError(c, name, matches, err)
+	}
+	result, err := h.callTool(c.Request().Context(), tool.Server, tool.Name, req.Arguments)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	result["server"] = tool.Server
+	return c.JSON(http.StatusOK, result)
 }
 
 // StartMCPServer starts an MCP server
@@ -125,6 +317,17 @@ func (h *MCPDockerHandler) StopMCPServer(c echo.Context) error {
 	return c.JSON(http.StatusOK, result)
 }
 
+// RefreshMCPTools asks the manager to re-list a server's tools
+func (h *MCPDockerHandler) RefreshMCPTools(c echo.Context) error {
+	serverName := c.Param("name")
+
+	result, err := h.proxyRequest("POST", "/servers/"+serverName+"/refresh-tools", nil)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
 // CallMCPTool calls a tool on an MCP server
 func (h *MCPDockerHandler) CallMCPTool(c echo.Context) error {
 	serverName := c.Param("name")
@@ -137,7 +340,7 @@ func (h *MCPDockerHandler) CallMCPTool(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
 	}
 
-	result, err := h.proxyRequest("POST", "/servers/"+serverName+"/call", req)
+	result, err := h.callTool(c.Request().Context(), serverName, req.Tool, req.Arguments)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
@@ -158,19 +361,7 @@ func (h *MCPDockerHandler) GetMCPManagerHealth(c echo.Context) error {
 
 // GetMCPDockerStats returns aggregated statistics about MCP servers
 func (h *MCPDockerHandler) GetMCPDockerStats(c echo.Context) error {
-	url := h.managerURL + "/servers"
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error":       err.Error(),
-			"serverCount": 0,
-			"totalTools":  0,
-		})
-	}
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := h.send(http.MethodGet, "/servers", nil)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
 			"error":       err.Error(),
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"binary-annotator-pro/metrics"
+)
+
+// TestListMCPTools lists the tools of two servers, a name both expose
+// included, under their own names with their server and schema
+func TestListMCPTools(t *testing.T) {
+	schema := map[string]interface{}{"type": "object", "properties": map[string]interface{}{"path": map[string]interface{}{"type": "string"}}}
+	manager := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/servers" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode([]map[string]interface{}{
+			{"name": "binary", "tools": []interface{}{
+				map[string]interface{}{"name": "read_file", "description": "Read a binary file", "inputSchema": schema},
+				map[string]interface{}{"name": "list_binary_files", "description": "List files"},
+			}},
+			{"name": "filesystem", "tools": []interface{}{
+				map[string]interface{}{"name": "read_file", "description": "Read a file", "inputSchema": schema},
+			}},
+		})
+	}))
+	defer manager.Close()
+
+	h := &MCPDockerHandler{managerURL: manager.URL}
+	c, rec := newJSONContext(http.MethodGet, "/mcp/tools", nil)
+	if err := h.ListMCPTools(c); err != nil {
+		t.Fatal(err)
+	}
+	var got []MCPToolInfo
+	decodeJSON(t, rec, http.StatusOK, &got)
+
+	want := []MCPToolInfo{
+		{Server: "binary", Name: "read_file", Description: "Read a binary file", InputSchema: schema},
+		{Server: "binary", Name: "list_binary_files", Description: "List files"},
+		{Server: "filesystem", Name: "read_file", Description: "Read a file", InputSchema: schema},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+// TestCallMCPToolByName routes a call made by tool name alone to the server
+// hosting the tool, and asks for server::tool when two servers expose it
+func TestCallMCPToolByName(t *testing.T) {
+	var calls []string
+	manager := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/servers":
+			json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"name": "binary", "tools": []interface{}{
+					map[string]interface{}{"name": "list_binary_files"},
+					map[string]interface{}{"name": "read_file"},
+				}},
+				{"name": "filesystem", "tools": []interface{}{
+					map[string]interface{}{"name": "read_file"},
+				}},
+			})
+		default:
+			var req struct {
+				Tool      string                 `json:"tool"`
+				Arguments map[string]interface{} `json:"arguments"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			calls = append(calls, r.URL.Path+" "+req.Tool)
+			json.NewEncoder(w).Encode(map[string]interface{}{"result": req.Arguments["path"]})
+		}
+	}))
+	defer manager.Close()
+	h := &MCPDockerHandler{managerURL: manager.URL}
+
+	call := func(name string, wantStatus int) map[string]interface{} {
+		t.Helper()
+		c, rec := newJSONContext(http.MethodPost, "/mcp/tools/"+name+"/call", map[string]interface{}{
+			"arguments": map[string]interface{}{"path": "/data/a.bin"},
+		})
+		c.SetParamNames("name")
+		c.SetParamValues(name)
+		if err := h.CallMCPToolByName(c); err != nil {
+			t.Fatal(err)
+		}
+		var resp map[string]interface{}
+		decodeJSON(t, rec, wantStatus, &resp)
+		return resp
+	}
+
+	if resp := call("list_binary_files", http.StatusOK); resp["server"] != "binary" || resp["result"] != "/data/a.bin" {
+		t.Errorf("list_binary_files: got %v", resp)
+	}
+	if resp := call("filesystem::read_file", http.StatusOK); resp["server"] != "filesystem" {
+		t.Errorf("filesystem::read_file: got %v", resp)
+	}
+	if want := []string{"/servers/binary/call list_binary_files", "/servers/filesystem/call read_file"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("manager calls = %v, want %v", calls, want)
+	}
+
+	if resp := call("read_file", http.StatusConflict); !reflect.DeepEqual(resp["servers"], []interface{}{"binary", "filesystem"}) {
+		t.Errorf("ambiguous read_file: got %v", resp)
+	}
+	call("frobnicate", http.StatusNotFound)
+	if len(calls) != 2 {
+		t.Errorf("failed lookups reached the manager: %v", calls)
+	}
+
+	// The schema lookup resolves names the same way
+	c, rec := newJSONContext(http.MethodGet, "/mcp/tools/binary::read_file/schema", nil)
+	c.SetParamNames("name")
+	c.SetParamValues("binary::read_file")
+	if err := h.GetMCPToolSchema(c); err != nil {
+		t.Fatal(err)
+	}
+	var tool MCPToolInfo
+	decodeJSON(t, rec, http.StatusOK, &tool)
+	if tool.Server != "binary" || tool.Name != "read_file" {
+		t.Errorf("schema of binary::read_file = %+v", tool)
+	}
+}
+
+// TestMCPToolCallMetricLabels checks tool call latencies are labelled with
+// servers the manager reported, and calls to made-up servers share "unknown"
+func TestMCPToolCallMetricLabels(t *testing.T) {
+	manager := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/servers":
+			json.NewEncoder(w).Encode([]map[string]interface{}{{"name": "listed"}})
+		case "/servers/working/call":
+			json.NewEncoder(w).Encode(map[string]interface{}{"result": "ok"})
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "server not running"})
+		}
+	}))
+	defer manager.Close()
+
+	h := &MCPDockerHandler{managerURL: manager.URL}
+	if _, err := h.listServers(); err != nil {
+		t.Fatal(err)
+	}
+	for _, server := range []string{"working", "listed", "made-up-1", "made-up-2"} {
+		h.callTool(context.Background(), server, "tool", nil)
+	}
+
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := map[string]bool{}
+	for _, family := range families {
+		if family.GetName() != "binary_annotator_mcp_tool_call_duration_seconds" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "server" {
+					labels[l.GetValue()] = true
+				}
+			}
+		}
+	}
+	for _, want := range []string{"working", "listed", "unknown"} {
+		if !labels[want] {
+			t.Errorf("no series for server %q in %v", want, labels)
+		}
+	}
+	for _, unwanted := range []string{"made-up-1", "made-up-2"} {
+		if labels[unwanted] {
+			t.Errorf("made-up server %q got its own series", unwanted)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"binary-annotator-pro/models"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// NoteRequest is the body for creating or updating a note. Nil fields are left
+// unchanged on update; both are required on create.
+type NoteRequest struct {
+	Offset *int64  `json:"offset"`
+	Note   *string `json:"note"`
+}
+
+// validateNote checks the note points at a byte inside the file and has text
+func validateNote(note models.Note, fileSize int64) error {
+	if note.Offset < 0 || note.Offset >= fileSize {
+		return fmt.Errorf("offset 0x%X is outside the file (size %d)", note.Offset, fileSize)
+	}
+	if strings.TrimSpace(note.Note) == "" {
+		return fmt.Errorf("note text is required")
+	}
+	return nil
+}
+
+// CreateNote attaches a note to a byte offset of a file
+func (h *Handler) CreateNote(c echo.Context) error {
+	file, status, err := h.findAnnotatedFile(c)
+	if err != nil {
+		return c.JSON(status, map[string]string{"error": err.Error()})
+	}
+
+	var req NoteRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if req.Offset == nil || req.Note == nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "offset and note are required"})
+	}
+
+	note := models.Note{FileID: file.ID, Offset: *req.Offset, Note: *req.Note}
+	if err := validateNote(note, file.Size); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := h.db.GormDB.Create(&note).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to create note"})
+	}
+	return c.JSON(http.StatusCreated, note)
+}
+
+// ListNotes returns a file's notes ordered by offset
+func (h *Handler) ListNotes(c echo.Context) error {
+	file, status, err := h.findAnnotatedFile(c)
+	if err != nil {
+		return c.JSON(status, map[string]string{"error": err.Error()})
+	}
+
+	notes := []models.Note{}
+	if err := h.db.GormDB.Where("file_id = ?", file.ID).Order("offset, id").Find(&notes).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, notes)
+}
+
+// UpdateNote changes the offset and/or text of a file's note
+func (h *Handler) UpdateNote(c echo.Context) error {
+	file, status, err := h.findAnnotatedFile(c)
+	if err != nil {
+		return c.JSON(status, map[string]string{"error": err.Error()})
+	}
+
+	var note models.Note
+	if err := h.db.GormDB.Where("id = ? AND file_id = ?", c.Param("noteId"), file.ID).First(&note).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "note not found"})
+	}
+
+	var req NoteRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if req.Offset != nil {
+		note.Offset = *req.Offset
+	}
+	if req.Note != nil {
+		note.Note = *req.Note
+	}
+	if err := validateNote(note, file.Size); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := h.db.GormDB.Save(&note).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to update note"})
+	}
+	return c.JSON(http.StatusOK, note)
+}
+
+// DeleteNote removes a note from a file
+func (h *Handler) DeleteNote(c echo.Context) error {
+	file, status, err := h.findAnnotatedFile(c)
+	if err != nil {
+		return c.JSON(status, map[string]string{"error": err.Error()})
+	}
+
+	res := h.db.GormDB.Where("id = ? AND file_id = ?", c.Param("noteId"), file.ID).Delete(&models.Note{})
+	if res.Error != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": res.Error.Error()})
+	}
+	if res.RowsAffected == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "note not found"})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "note deleted"})
+}
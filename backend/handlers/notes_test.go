@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"binary-annotator-pro/models"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// noteContext builds a context for the /files/:id/notes routes
+func noteContext(method string, fileID, noteID uint, body interface{}) (echo.Context, *httptest.ResponseRecorder) {
+	c, rec := newJSONContext(method, fmt.Sprintf("/files/%d/notes", fileID), body)
+	c.SetParamNames("id", "noteId")
+	c.SetParamValues(fmt.Sprint(fileID), fmt.Sprint(noteID))
+	return c, rec
+}
+
+// TestNoteCRUD creates notes out of order, lists them by offset, updates and deletes one
+func TestNoteCRUD(t *testing.T) {
+	h := newTestHandler(t)
+	file := createTestFile(t, h, "ecg.bin", make([]byte, 64))
+
+	var ids []uint
+	for _, n := range []struct {
+		offset int64
+		text   string
+	}{{40, "lead II starts here"}, {4, "looks like the sample-rate field"}, {12, "patient id"}} {
+		c, rec := noteContext(http.MethodPost, file.ID, 0, map[string]interface{}{"offset": n.offset, "note": n.text})
+		h.CreateNote(c)
+		var note models.Note
+		decodeJSON(t, rec, http.StatusCreated, &note)
+		ids = append(ids, note.ID)
+	}
+
+	c, rec := noteContext(http.MethodGet, file.ID, 0, nil)
+	h.ListNotes(c)
+	var notes []models.Note
+	decodeJSON(t, rec, http.StatusOK, &notes)
+	var offsets []int64
+	for _, n := range notes {
+		offsets = append(offsets, n.Offset)
+	}
+	if fmt.Sprint(offsets) != "[4 12 40]" {
+		t.Fatalf("offsets = %v, want [4 12 40]", offsets)
+	}
+
+	c, rec = noteContext(http.MethodPut, file.ID, ids[0], map[string]interface{}{"offset": 0})
+	h.UpdateNote(c)
+	var updated models.Note
+	decodeJSON(t, rec, http.StatusOK, &updated)
+	if updated.Offset != 0 || updated.Note != "lead II starts here" {
+		t.Fatalf("updated = %+v, want offset 0 with text kept", updated)
+	}
+
+	c, rec = noteContext(http.MethodPut, file.ID, ids[0], map[string]interface{}{"offset": 64})
+	h.UpdateNote(c)
+	decodeJSON(t, rec, http.StatusBadRequest, nil)
+
+	c, rec = noteContext(http.MethodDelete, file.ID, ids[1], nil)
+	h.DeleteNote(c)
+	decodeJSON(t, rec, http.StatusOK, nil)
+
+	c, rec = noteContext(http.MethodGet, file.ID, 0, nil)
+	h.ListNotes(c)
+	decodeJSON(t, rec, http.StatusOK, &notes)
+	if len(notes) != 2 || notes[0].ID != ids[0] || notes[1].ID != ids[2] {
+		t.Fatalf("notes after delete = %+v", notes)
+	}
+}
+
+// TestCreateNoteValidation rejects offsets outside the file and empty text
+func TestCreateNoteValidation(t *testing.T) {
+	h := newTestHandler(t)
+	file := createTestFile(t, h, "ecg.bin", make([]byte, 8))
+
+	for _, body := range []map[string]interface{}{
+		{"offset": 8, "note": "past the end"},
+		{"offset": -1, "note": "negative"},
+		{"offset": 0, "note": "  "},
+		{"note": "no offset"},
+	} {
+		c, rec := noteContext(http.MethodPost, file.ID, 0, body)
+		h.CreateNote(c)
+		decodeJSON(t, rec, http.StatusBadRequest, nil)
+	}
+}
@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"binary-annotator-pro/models"
+	"binary-annotator-pro/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+// apiOperation describes the body shapes of a route. Request and Response are
+// example values whose Go types are turned into JSON schemas, so the spec
+// follows the handler types as they change.
+type apiOperation struct {
+	Summary  string
+	Request  interface{}
+	Response interface{}
+	Status   int // success status, default 200
+}
+
+// openAPIOperations documents the core handlers, keyed by "METHOD path".
+// Routes not listed here still appear in the spec with their path params.
+var openAPIOperations = map[string]apiOperation{
+	"POST /search":            {Summary: "Search a file for a value", Request: SearchRequest{}, Response: SearchResponse{}},
+	"POST /search/sequence":   {Summary: "Find runs of increasing values at a fixed stride", Request: SequenceSearchRequest{}, Response: SequenceSearchResponse{}},
+	"POST /search/timestamps": {Summary: "Find fields that decode to a time within a window", Request: TimestampScanRequest{}, Response: TimestampScanResponse{}},
+
+	"POST /checksum":       {Summary: "Checksums of a file region", Request: ChecksumRequest{}, Response: ChecksumResponse{}},
+	"POST /checksum/batch": {Summary: "Checksums of several regions of a file", Request: ChecksumBatchRequest{}, Response: ChecksumBatchResponse{}},
+	"POST /checksum/crc":   {Summary: "CRC with custom parameters", Request: SeededCRCRequest{}, Response: SeededCRCResponse{}},
+
+	"POST /compare/diff":        {Summary: "Byte diff of two files", Request: BinaryDiffRequest{}, Response: BinaryDiffResponse{}},
+	"POST /compare/delta":       {Summary: "Delta analysis of two files", Request: DeltaAnalysisRequest{}, Response: DeltaAnalysisResponse{}},
+	"GET /compare/patch":        {Summary: "Download a binary patch turning file1_id into file2_id, with sizes and SHA-256 hashes to check it applies"},
+	"POST /compare/correlation": {Summary: "Pattern correlation between files", Request: PatternCorrelationRequest{}, Response: PatternCorrelationResponse{}},
+	"POST /compare/signals":     {Summary: "Correlation and RMSE of signals decoded from two files", Request: SignalCompareRequest{}, Response: SignalCompareResponse{}},
+	"POST /compare/lag":         {Summary: "Shift that best aligns two byte streams or decoded signals", Request: LagRequest{}, Response: LagResponse{}},
+	"POST /compare/streaming":   {Summary: "Chunked diff of two large files", Request: StreamingDiffRequest{}, Response: StreamingDiffResponse{}},
+	"POST /compare/nway":        {Summary: "Per-offset byte agreement across files", Request: NWayCompareRequest{}, Response: NWayCompareResponse{}},
+	"POST /compare/multi":       {Summary: "Compare several files", Request: MultiFileCompareRequest{}, Response: MultiFileCompareResponse{}},
+
+	"POST /upload/init":          {Summary: "Start a chunked upload", Request: UploadInitRequest{}, Response: models.PartialUpload{}, Status: http.StatusCreated},
+	"GET /upload/{id}":           {Summary: "Bytes received by a chunked upload, the offset to resume from", Response: models.PartialUpload{}},
+	"PUT /upload/{id}":           {Summary: "Append the raw body to a chunked upload at ?offset=", Response: models.PartialUpload{}},
+	"POST /upload/{id}/finalize": {Summary: "Create the file from a chunked upload", Request: UploadFinalizeRequest{}, Status: http.StatusCreated},
+	"DELETE /upload/{id}":        {Summary: "Discard a chunked upload", Status: http.StatusNoContent},
+
+	"POST /files/bulk-delete":       {Summary: "Delete several files", Request: BulkFilesRequest{}, Response: BulkFilesResponse{}},
+	"POST /files/bulk-vendor":       {Summary: "Set the vendor of several files", Request: BulkFilesRequest{}, Response: BulkFilesResponse{}},
+	"GET /analysis/trigrams/{name}": {Summary: "Byte trigram statistics", Response: TrigramResponse{}},
+
+	"POST /yaml/validate":                 {Summary: "Validate a YAML config", Response: YamlValidationResult{}},
+	"POST /yaml/{name}/apply":             {Summary: "Apply a YAML config to a file as tags", Response: YamlApplyResponse{}},
+	"POST /yaml/diff":                     {Summary: "Compare two YAML configs rule by rule", Request: YamlDiffRequest{}, Response: YamlDiffResponse{}},
+	"GET /yaml/{name}/versions":           {Summary: "Earlier versions of a YAML config, newest first", Response: []models.YamlConfigVersion{}},
+	"POST /yaml/{name}/restore/{version}": {Summary: "Restore an earlier version of a YAML config", Response: models.YamlConfig{}},
+
+	"POST /files/{id}/tags":          {Summary: "Create a tag", Request: TagRequest{}, Response: models.Tag{}, Status: http.StatusCreated},
+	"GET /files/{id}/configs":        {Summary: "List the YAML configs linked to a file", Response: []models.YamlConfig{}},
+	"GET /files/{id}/tags":           {Summary: "List the tags of a file", Response: []models.Tag{}},
+	"PUT /files/{id}/tags/{tagId}":   {Summary: "Update a tag", Request: TagRequest{}, Response: models.Tag{}},
+	"POST /files/{id}/notes":         {Summary: "Create a note", Request: NoteRequest{}, Response: models.Note{}, Status: http.StatusCreated},
+	"GET /files/{id}/notes":          {Summary: "List the notes of a file", Response: []models.Note{}},
+	"PUT /files/{id}/notes/{noteId}": {Summary: "Update a note", Request: NoteRequest{}, Response: models.Note{}},
+	"POST /files/{id}/extract":       {Summary: "Extract a block of a file", Request: ExtractBlockRequest{}, Response: models.ExtractedBlock{}, Status: http.StatusCreated},
+	"POST /files/{id}/slice":         {Summary: "Copy a region of a file into a new file", Request: SliceFileRequest{}, Status: http.StatusCreated},
+	"POST /files/{id}/carve":         {Summary: "Find embedded PNG, JPEG, ZIP, PDF and gzip files, optionally copying them into new files", Request: CarveRequest{}, Response: CarveResponse{}},
+	"GET /files/{id}/blocks":         {Summary: "List the extracted blocks of a file", Response: []models.ExtractedBlock{}},
+	"POST /files/{id}/bits":          {Summary: "Read a bit field", Request: BitFieldRequest{}, Response: BitFieldResponse{}},
+	"GET /files/{id}/transitions":    {Summary: "Byte transition matrix and entropy rate of a region", Response: TransitionsResponse{}},
+	"GET /files/{id}/analyze":        {Summary: "Overview of a file: entropy, header, patterns, periodicity, high entropy regions", Response: FileSummaryResponse{}},
+	"POST /frame/detect":             {Summary: "Find length-prefixed frame chains", Request: FrameDetectRequest{}, Response: FrameDetectResponse{}},
+	"POST /decode/pipeline":          {Summary: "Decode a region through read/delta/scale stages", Request: DecodePipelineRequest{}, Response: DecodePipelineResponse{}},
+	"POST /decode/bcd":               {Summary: "Read a region as packed BCD", Request: BCDDecodeRequest{}, Response: BCDDecodeResponse{}},
+	"POST /decode/varint":            {Summary: "Read an unsigned LEB128 varint", Request: VarintDecodeRequest{}, Response: VarintDecodeResponse{}},
+
+	"GET /huffman/tables":                    {Summary: "List Huffman tables", Response: []models.HuffmanTable{}},
+	"GET /huffman/tables/{id}":               {Summary: "Get a Huffman table", Response: models.HuffmanTable{}},
+	"POST /huffman/decode":                   {Summary: "Decode a selection with a Huffman table", Request: HuffmanDecodeRequest{}},
+	"GET /huffman/{id}/export":               {Summary: "Export a Huffman table", Response: HuffmanTableExport{}},
+	"POST /huffman/import":                   {Summary: "Import a Huffman table", Request: HuffmanTableImport{}, Response: models.HuffmanTable{}, Status: http.StatusCreated},
+	"POST /huffman/{tableId}/decode-to-file": {Summary: "Decode a selection into a new file", Request: HuffmanDecodeToFileRequest{}, Status: http.StatusCreated},
+
+	"POST /reconstruct/multi": {Summary: "Replace several compressed selections with their decompressed data", Request: ReconstructMultiRequest{}, Status: http.StatusCreated},
+
+	"GET /rag/config": {Summary: "RAG chunking defaults", Response: services.RAGConfig{}},
+	"PUT /rag/config": {Summary: "Change the RAG chunking defaults", Request: services.RAGConfigUpdate{}, Response: services.RAGConfig{}},
+
+	"POST /auth/login":    {Summary: "Log in", Request: LoginRequest{}, Response: AuthResponse{}},
+	"POST /auth/register": {Summary: "Create an account", Request: RegisterRequest{}, Response: AuthResponse{}},
+
+	"PUT /settings/{userId}": {Summary: "Create or update a user's AI provider settings; empty fields keep their value", Request: models.AISettings{}},
+
+	"GET /mcp/tools":               {Summary: "Tools of the running MCP servers with their input schemas", Response: []MCPToolInfo{}},
+	"GET /mcp/tools/{name}/schema": {Summary: "A tool of a running MCP server with its input schema; name it server::tool when several servers expose it", Response: MCPToolInfo{}},
+	"POST /mcp/tools/{name}/call":  {Summary: "Call a tool on the server hosting it, without chat approval"},
+
+	"GET /health/deep": {Summary: "Reachability of the database, RAG service, Ollama and MCP manager", Response: DeepHealthResponse{}},
+}
+
+// OpenAPISpec serves an OpenAPI 3 description of the routes registered on e.
+// The spec is built on the first request, once all routes exist.
+func OpenAPISpec(e *echo.Echo) echo.HandlerFunc {
+	var once sync.Once
+	var spec map[string]interface{}
+	return func(c echo.Context) error {
+		once.Do(func() { spec = buildOpenAPISpec(e.Routes()) })
+		return c.JSON(http.StatusOK, spec)
+	}
+}
+
+// buildOpenAPISpec turns echo routes into an OpenAPI 3 document
+func buildOpenAPISpec(routes []*echo.Route) map[string]interface{} {
+	schemas := map[string]interface{}{}
+	paths := map[string]map[string]interface{}{}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	for _, r := range routes {
+		if r.Method == echo.RouteNotFound || strings.Contains(r.Path, "*") {
+			continue
+		}
+		path, params := openAPIPath(r.Path)
+		op := map[string]interface{}{"operationId": openAPIOperationID(r.Name)}
+
+		if len(params) > 0 {
+			var parameters []map[string]interface{}
+			for _, p := range params {
+				parameters = append(parameters, map[string]interface{}{
+					"name": p, "in": "path", "required": true,
+					"schema": map[string]string{"type": "string"},
+				})
+			}
+			op["parameters"] = parameters
+		}
+
+		doc, known := openAPIOperations[r.Method+" "+path]
+		if known {
+			op["summary"] = doc.Summary
+		}
+		if doc.Request != nil {
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": jsonSchema(reflect.TypeOf(doc.Request), schemas)},
+				},
+			}
+		}
+
+		status := http.StatusOK
+		if doc.Status != 0 {
+			status = doc.Status
+		}
+		success := map[string]interface{}{"description": http.StatusText(status)}
+		if doc.Response != nil {
+			success["content"] = map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": jsonSchema(reflect.TypeOf(doc.Response), schemas)},
+			}
+		}
+		op["responses"] = map[string]interface{}{
+			strconv.Itoa(status): success,
+			"default": map[string]interface{}{
+				"description": "Error",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": map[string]string{"$ref": "#/components/schemas/Error"}},
+				},
+			},
+		}
+
+		if paths[path] == nil {
+			paths[path] = map[string]interface{}{}
+		}
+		paths[path][strings.ToLower(r.Method)] = op
+	}
+
+	schemas["Error"] = map[string]interface{}{
+		"type":     "object",
+		"required": []string{"code", "error"},
+		"properties": map[string]interface{}{
+			"code":    map[string]interface{}{"type": "string", "enum": errCodes},
+			"error":   map[string]string{"type": "string"},
+			"details": map[string]interface{}{"type": "object", "additionalProperties": true},
+		},
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Binary Annotator Pro API",
+			"version": "1.0.0",
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": schemas},
+	}
+}
+
+// openAPIPath converts an echo path (/files/:id) to OpenAPI form (/files/{id})
+// and returns its parameter names
+func openAPIPath(path string) (string, []string) {
+	var params []string
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") {
+			params = append(params, s[1:])
+			segments[i] = "{" + s[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// openAPIOperationID derives an operation ID from the handler's function name
+// (e.g. "binary-annotator-pro/handlers.(*Handler).CreateTag-fm" -> "CreateTag")
+func openAPIOperationID(name string) string {
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.TrimSuffix(name, "-fm")
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// jsonSchema returns the JSON schema of t as encoding/json would encode it.
+// Named structs are added to schemas and referenced with $ref.
+func jsonSchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		return map[string]interface{}{"type": "string", "format": "byte"}
+	case t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType):
+		// Custom encoding (e.g. gorm.DeletedAt): shape unknown
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": jsonSchema(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": jsonSchema(t.Elem(), schemas)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return structSchema(t, schemas)
+		}
+		ref := map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+		if _, ok := schemas[t.Name()]; !ok {
+			schemas[t.Name()] = map[string]interface{}{} // placeholder for recursive types
+			schemas[t.Name()] = structSchema(t, schemas)
+		}
+		return ref
+	default:
+		// interface{} and anything else: any value
+		return map[string]interface{}{}
+	}
+}
+
+// structSchema builds an object schema from a struct's exported, JSON-visible
+// fields. Embedded structs are flattened like encoding/json does.
+func structSchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var addFields func(t reflect.Type)
+	addFields = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name := strings.Split(tag, ",")[0]
+			if f.Anonymous && name == "" {
+				ft := f.Type
+				if ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				if ft.Kind() == reflect.Struct {
+					addFields(ft)
+					continue
+				}
+			}
+			if !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			properties[name] = jsonSchema(f.Type, schemas)
+		}
+	}
+	addFields(t)
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
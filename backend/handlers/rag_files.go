@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -13,6 +14,7 @@ import (
 	"strings"
 
 	"binary-annotator-pro/config"
+	"binary-annotator-pro/middleware"
 	"binary-annotator-pro/models"
 	"binary-annotator-pro/services"
 
@@ -20,6 +22,9 @@ import (
 	"github.com/ledongthuc/pdf"
 )
 
+// RAGMaxFileSize caps documents uploaded for indexing
+const RAGMaxFileSize = 10 << 20
+
 // RAGFilesHandler handles RAG document management
 type RAGFilesHandler struct {
 	db         *config.DB
@@ -41,9 +46,9 @@ func (h *RAGFilesHandler) UploadDocument(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "user_id is required"})
 	}
 
-	// Parse chunk configuration parameters
-	chunkTokens := 256  // Default
-	overlapTokens := 50 // Default
+	// Parse chunk configuration parameters; 0 uses the RAG service defaults (GET /rag/config)
+	chunkTokens := 0
+	overlapTokens := 0
 	if ct := c.QueryParam("chunk_tokens"); ct != "" {
 		if parsed, err := strconv.Atoi(ct); err == nil && parsed > 0 {
 			chunkTokens = parsed
@@ -57,13 +62,19 @@ func (h *RAGFilesHandler) UploadDocument(c echo.Context) error {
 
 	// Get uploaded file
 	file, err := c.FormFile("file")
+	if tooLarge := (*http.MaxBytesError)(nil); errors.As(err, &tooLarge) {
+		if tooLarge.Limit < RAGMaxFileSize {
+			return middleware.TooLargeError(c, "request body", tooLarge.Limit)
+		}
+		return middleware.TooLargeError(c, "file", RAGMaxFileSize)
+	}
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "file is required"})
 	}
 
-	// Validate file size (max 10MB)
-	if file.Size > 10*1024*1024 {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "file too large (max 10MB)"})
+	// Validate file size
+	if file.Size > RAGMaxFileSize {
+		return middleware.TooLargeError(c, "file", RAGMaxFileSize)
 	}
 
 	// Validate file type
@@ -145,21 +156,80 @@ func (h *RAGFilesHandler) UploadDocument(c echo.Context) error {
 	return c.JSON(http.StatusOK, doc)
 }
 
-// ListDocuments returns all documents for a user
+// ragDocumentSorts maps the sort values of ListDocuments to ORDER BY clauses;
+// newest first by default. A document's title is its file name.
+var ragDocumentSorts = map[string]string{
+	"":                "created_at desc, id desc",
+	"created_at_desc": "created_at desc, id desc",
+	"created_at_asc":  "created_at asc, id asc",
+	"title":           "file_name asc, id asc",
+}
+
+// ListDocuments returns all documents for a user, newest first. Optional
+// created_after and created_before (RFC 3339, or a date for its midnight
+// UTC; both inclusive) narrow them by upload time, and sort orders them by
+// created_at_desc, created_at_asc or title.
 func (h *RAGFilesHandler) ListDocuments(c echo.Context) error {
 	userID := c.QueryParam("user_id")
 	if userID == "" {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "user_id is required"})
 	}
 
+	order, ok := ragDocumentSorts[c.QueryParam("sort")]
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "sort must be created_at_desc, created_at_asc or title"})
+	}
+	query := h.db.GormDB.Where("user_id = ?", userID)
+	for param, cond := range map[string]string{"created_after": "created_at >= ?", "created_before": "created_at <= ?"} {
+		raw := c.QueryParam(param)
+		if raw == "" {
+			continue
+		}
+		t, err := parseTimestamp(raw)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("%s: %v", param, err)})
+		}
+		query = query.Where(cond, t)
+	}
+
 	var documents []models.RAGDocument
-	if err := h.db.GormDB.Where("user_id = ?", userID).Order("created_at desc").Find(&documents).Error; err != nil {
+	if err := query.Order(order).Find(&documents).Error; err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to fetch documents"})
 	}
 
 	return c.JSON(http.StatusOK, documents)
 }
 
+// RAGDocumentResponse is a user's document with its indexed chunks, in order
+type RAGDocumentResponse struct {
+	Document models.RAGDocument  `json:"document"`
+	Chunks   []services.RAGChunk `json:"chunks"`
+}
+
+// GetDocument returns a document and the text of its chunks in document order
+func (h *RAGFilesHandler) GetDocument(c echo.Context) error {
+	id := c.Param("id")
+	userID := c.QueryParam("user_id")
+	if userID == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "user_id is required"})
+	}
+
+	var doc models.RAGDocument
+	if err := h.db.GormDB.Where("id = ? AND user_id = ?", id, userID).First(&doc).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "document not found"})
+	}
+	if doc.Status != "indexed" || doc.RAGDocID == 0 {
+		return c.JSON(http.StatusOK, RAGDocumentResponse{Document: doc, Chunks: []services.RAGChunk{}})
+	}
+
+	ragDoc, err := h.ragService.GetDocument(doc.RAGDocID)
+	if err != nil {
+		log.Printf("RAG document fetch failed: %v", err)
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, RAGDocumentResponse{Document: doc, Chunks: ragDoc.Chunks})
+}
+
 // DeleteDocument deletes a document from RAG and database
 func (h *RAGFilesHandler) DeleteDocument(c echo.Context) error {
 	id := c.Param("id")
@@ -205,10 +275,15 @@ func (h *RAGFilesHandler) GetDocumentStats(c echo.Context) error {
 		TotalSize      int64 `json:"total_size"`
 	}
 
-	h.db.GormDB.Model(&models.RAGDocument{}).
+	// One aggregate query, however many documents there are. SUM of no rows
+	// is NULL, hence the COALESCE.
+	err := h.db.GormDB.Model(&models.RAGDocument{}).
 		Where("user_id = ? AND status = ?", userID, "indexed").
-		Select("COUNT(*) as total_documents, SUM(chunk_count) as total_chunks, SUM(file_size) as total_size").
-		Scan(&stats)
+		Select("COUNT(*) as total_documents, COALESCE(SUM(chunk_count), 0) as total_chunks, COALESCE(SUM(file_size), 0) as total_size").
+		Scan(&stats).Error
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to compute stats"})
+	}
 
 	return c.JSON(http.StatusOK, stats)
 }
@@ -221,6 +296,10 @@ func (h *RAGFilesHandler) SearchRAG(c echo.Context) error {
 		Type       []string `json:"type,omitempty"`
 		MaxResults int      `json:"max_results,omitempty"`
 		MinScore   float64  `json:"min_score,omitempty"`
+		// Also return the chunks before and after each match
+		IncludeNeighbors bool `json:"include_neighbors,omitempty"`
+		// At most this many chunks of any one document
+		MaxPerDocument int `json:"max_per_document,omitempty"`
 	}
 
 	if err := c.Bind(&req); err != nil {
@@ -230,17 +309,18 @@ func (h *RAGFilesHandler) SearchRAG(c echo.Context) error {
 	if req.Query == "" {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "query is required"})
 	}
-
-	// Set defaults
-	if req.MaxResults == 0 {
-		req.MaxResults = 5
-	}
-	if req.MinScore == 0 {
-		req.MinScore = 0.3
+	if req.MaxPerDocument < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "max_per_document must be positive"})
 	}
 
-	// Call RAG service
-	searchResp, err := h.ragService.Search(req.Query, req.Type, req.MaxResults, req.MinScore)
+	// Call RAG service (omitted max_results/min_score use the service defaults)
+	searchResp, err := h.ragService.SearchWithOptions(req.Query, services.RAGSearchOptions{
+		Types:            req.Type,
+		MaxResults:       req.MaxResults,
+		MinScore:         req.MinScore,
+		IncludeNeighbors: req.IncludeNeighbors,
+		MaxPerDocument:   req.MaxPerDocument,
+	})
 	if err != nil {
 		log.Printf("RAG search failed: %v", err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "search failed"})
@@ -249,6 +329,37 @@ func (h *RAGFilesHandler) SearchRAG(c echo.Context) error {
 	return c.JSON(http.StatusOK, searchResp)
 }
 
+// GetRAGConfig returns the chunking defaults used when an upload omits them
+func (h *RAGFilesHandler) GetRAGConfig(c echo.Context) error {
+	cfg, err := h.ragService.GetConfig()
+	if err != nil {
+		log.Printf("RAG config fetch failed: %v", err)
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, cfg)
+}
+
+// UpdateRAGConfig changes the chunking defaults of the RAG service
+func (h *RAGFilesHandler) UpdateRAGConfig(c echo.Context) error {
+	var req services.RAGConfigUpdate
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	if req.ChunkTokens != nil && *req.ChunkTokens <= 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "chunk_tokens must be positive"})
+	}
+	if req.OverlapTokens != nil && *req.OverlapTokens < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "overlap_tokens must not be negative"})
+	}
+
+	cfg, err := h.ragService.UpdateConfig(req)
+	if err != nil {
+		log.Printf("RAG config update failed: %v", err)
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, cfg)
+}
+
 // Helper functions
 
 func isValidFileType(ext string) bool {
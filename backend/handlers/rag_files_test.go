@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"binary-annotator-pro/models"
+	"binary-annotator-pro/services"
+
+	"gorm.io/gorm"
+)
+
+// TestRAGFilesHandlerUsesRAGAPIURL checks document management talks to the
+// RAG service named by RAG_API_URL, like the chat does
+func TestRAGFilesHandlerUsesRAGAPIURL(t *testing.T) {
+	rag := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/config" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(services.RAGConfig{ChunkTokens: 321, OverlapTokens: 12})
+	}))
+	defer rag.Close()
+	t.Setenv("RAG_API_URL", rag.URL)
+
+	rh := NewRAGFilesHandler(newTestHandler(t).db)
+	c, rec := newJSONContext(http.MethodGet, "/rag/config", nil)
+	if err := rh.GetRAGConfig(c); err != nil {
+		t.Fatal(err)
+	}
+	var cfg services.RAGConfig
+	decodeJSON(t, rec, http.StatusOK, &cfg)
+	if cfg.ChunkTokens != 321 {
+		t.Errorf("chunk_tokens = %d, want the fake service's 321", cfg.ChunkTokens)
+	}
+}
+
+func TestRAGURLDefault(t *testing.T) {
+	t.Setenv("RAG_API_URL", "")
+	if got := services.RAGURL(); got != services.DefaultRAGURL {
+		t.Errorf("RAGURL() = %q, want %q", got, services.DefaultRAGURL)
+	}
+	t.Setenv("RAG_API_URL", "http://rag-service:3003")
+	if got := services.RAGURL(); got != "http://rag-service:3003" {
+		t.Errorf("RAGURL() = %q, want the env value", got)
+	}
+}
+
+// TestRAGGetDocumentChunkOrder checks the request and response contract of
+// document chunks: the RAG document is fetched by its service ID and the
+// chunks returned are put in document order, past chunk 9 and for chunks
+// without chunk_index (stored before the service recorded it)
+func TestRAGGetDocumentChunkOrder(t *testing.T) {
+	var requests []string
+	rag := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		// Chunks in chunk_id string order, chunk 3 without chunk_index
+		w.Write([]byte(`{"document_id": 7, "chunk_count": 12, "chunks": [
+			{"chunk_id": 0, "chunk_index": 0, "content": "part 0"},
+			{"chunk_id": 1, "chunk_index": 1, "content": "part 1"},
+			{"chunk_id": 10, "chunk_index": 10, "content": "part 10"},
+			{"chunk_id": 11, "chunk_index": 11, "content": "part 11"},
+			{"chunk_id": 2, "chunk_index": 2, "content": "part 2"},
+			{"chunk_id": 3, "content": "part 3"},
+			{"chunk_id": 4, "chunk_index": 4, "content": "part 4"},
+			{"chunk_id": 5, "chunk_index": 5, "content": "part 5"},
+			{"chunk_id": 6, "chunk_index": 6, "content": "part 6"},
+			{"chunk_id": 7, "chunk_index": 7, "content": "part 7"},
+			{"chunk_id": 8, "chunk_index": 8, "content": "part 8"},
+			{"chunk_id": 9, "chunk_index": 9, "content": "part 9"}
+		]}`))
+	}))
+	defer rag.Close()
+	t.Setenv("RAG_API_URL", rag.URL)
+
+	h := newTestHandler(t)
+	doc := models.RAGDocument{UserID: "u1", FileName: "manual.pdf", RAGDocID: 7, ChunkCount: 12, Status: "indexed"}
+	if err := h.db.GormDB.Create(&doc).Error; err != nil {
+		t.Fatal(err)
+	}
+	rh := NewRAGFilesHandler(h.db)
+
+	c, rec := newJSONContext(http.MethodGet, "/rag/documents/1?user_id=u1", nil)
+	c.SetParamNames("id")
+	c.SetParamValues(fmt.Sprint(doc.ID))
+	if err := rh.GetDocument(c); err != nil {
+		t.Fatal(err)
+	}
+	var resp RAGDocumentResponse
+	decodeJSON(t, rec, http.StatusOK, &resp)
+
+	if resp.Document.FileName != "manual.pdf" || len(resp.Chunks) != 12 {
+		t.Fatalf("got %s with %d chunks, want manual.pdf with 12", resp.Document.FileName, len(resp.Chunks))
+	}
+	for i, chunk := range resp.Chunks {
+		if chunk.Position() != i || chunk.Content != fmt.Sprintf("part %d", i) {
+			t.Errorf("chunk %d = %+v", i, chunk)
+		}
+	}
+
+	// Another user's document isn't found
+	c, rec = newJSONContext(http.MethodGet, "/rag/documents/1?user_id=u2", nil)
+	c.SetParamNames("id")
+	c.SetParamValues(fmt.Sprint(doc.ID))
+	if err := rh.GetDocument(c); err != nil {
+		t.Fatal(err)
+	}
+	decodeJSON(t, rec, http.StatusNotFound, nil)
+
+	if want := []string{"GET /document/7"}; !reflect.DeepEqual(requests, want) {
+		t.Errorf("RAG requests = %v, want %v", requests, want)
+	}
+}
+
+// TestRAGListDocumentsFilterAndSort lists documents uploaded on different days
+// by upload date range and in each sort order
+func TestRAGListDocumentsFilterAndSort(t *testing.T) {
+	h := newTestHandler(t)
+	rh := NewRAGFilesHandler(h.db)
+
+	day := func(d int) time.Time { return time.Date(2026, 3, d, 12, 0, 0, 0, time.UTC) }
+	for _, doc := range []models.RAGDocument{
+		{UserID: "u1", FileName: "b-protocol.pdf", CreatedAt: day(1)},
+		{UserID: "u1", FileName: "c-manual.pdf", CreatedAt: day(5)},
+		{UserID: "u1", FileName: "a-notes.txt", CreatedAt: day(10)},
+		{UserID: "u2", FileName: "other.txt", CreatedAt: day(5)},
+	} {
+		if err := h.db.GormDB.Create(&doc).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list := func(query string, wantStatus int) []string {
+		t.Helper()
+		c, rec := newJSONContext(http.MethodGet, "/rag/documents?user_id=u1"+query, nil)
+		if err := rh.ListDocuments(c); err != nil {
+			t.Fatal(err)
+		}
+		if wantStatus != http.StatusOK {
+			decodeJSON(t, rec, wantStatus, nil)
+			return nil
+		}
+		var docs []models.RAGDocument
+		decodeJSON(t, rec, wantStatus, &docs)
+		names := make([]string, len(docs))
+		for i, doc := range docs {
+			names[i] = doc.FileName
+		}
+		return names
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"a-notes.txt", "c-manual.pdf", "b-protocol.pdf"}},
+		{"&sort=created_at_asc", []string{"b-protocol.pdf", "c-manual.pdf", "a-notes.txt"}},
+		{"&sort=title", []string{"a-notes.txt", "b-protocol.pdf", "c-manual.pdf"}},
+		{"&created_after=2026-03-02", []string{"a-notes.txt", "c-manual.pdf"}},
+		{"&created_before=2026-03-05T12:00:00Z", []string{"c-manual.pdf", "b-protocol.pdf"}},
+		{"&created_after=2026-03-02&created_before=2026-03-09&sort=title", []string{"c-manual.pdf"}},
+	}
+	for _, tt := range tests {
+		if got := list(tt.query, http.StatusOK); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	list("&sort=size", http.StatusBadRequest)
+	list("&created_after=last-week", http.StatusBadRequest)
+}
+
+// TestRAGDocumentStatsAggregate checks the stats equal the sums over the
+// user's indexed documents, come from a single query, and are zero rather
+// than an error when the user has none
+func TestRAGDocumentStatsAggregate(t *testing.T) {
+	h := newTestHandler(t)
+	rh := NewRAGFilesHandler(h.db)
+
+	docs := []models.RAGDocument{
+		{UserID: "u1", FileName: "a.pdf", FileSize: 1200, ChunkCount: 4, Status: "indexed"},
+		{UserID: "u1", FileName: "b.pdf", FileSize: 5300, ChunkCount: 11, Status: "indexed"},
+		{UserID: "u1", FileName: "c.txt", FileSize: 80, ChunkCount: 1, Status: "indexed"},
+		{UserID: "u1", FileName: "broken.pdf", FileSize: 999, Status: "error"},
+		{UserID: "u2", FileName: "d.txt", FileSize: 700, ChunkCount: 2, Status: "indexed"},
+	}
+	var wantChunks int
+	var wantSize int64
+	for _, doc := range docs {
+		if err := h.db.GormDB.Create(&doc).Error; err != nil {
+			t.Fatal(err)
+		}
+		if doc.UserID == "u1" && doc.Status == "indexed" {
+			wantChunks += doc.ChunkCount
+			wantSize += doc.FileSize
+		}
+	}
+
+	queries := 0
+	h.db.GormDB.Callback().Query().After("gorm:query").Register("test:count_queries", func(*gorm.DB) { queries++ })
+	h.db.GormDB.Callback().Row().After("gorm:row").Register("test:count_rows", func(*gorm.DB) { queries++ })
+
+	stats := func(userID string) map[string]int64 {
+		t.Helper()
+		c, rec := newJSONContext(http.MethodGet, "/rag/stats?user_id="+userID, nil)
+		if err := rh.GetDocumentStats(c); err != nil {
+			t.Fatal(err)
+		}
+		var got map[string]int64
+		decodeJSON(t, rec, http.StatusOK, &got)
+		return got
+	}
+
+	got := stats("u1")
+	if got["total_documents"] != 3 || got["total_chunks"] != int64(wantChunks) || got["total_size"] != wantSize {
+		t.Errorf("stats = %v, want 3 documents, %d chunks, %d bytes", got, wantChunks, wantSize)
+	}
+	if queries != 1 {
+		t.Errorf("stats took %d queries, want 1", queries)
+	}
+
+	if got := stats("nobody"); got["total_documents"] != 0 || got["total_chunks"] != 0 || got["total_size"] != 0 {
+		t.Errorf("stats of a user without documents = %v", got)
+	}
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"binary-annotator-pro/models"
+	"binary-annotator-pro/services"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// analysisRAG receives summaries of finished analyses, building the corpus of
+// prior discoveries the chat searches. It is nil, and indexing skipped, when
+// RAG_API_URL is unset: unlike uploads, nobody asked for these documents. A
+// variable so tests can point it at a fake RAG service.
+var analysisRAG = newAnalysisRAG()
+
+func newAnalysisRAG() *services.RAGService {
+	if os.Getenv("RAG_API_URL") == "" {
+		return nil
+	}
+	return services.NewRAGService("")
+}
+
+// notableSearchMaxMatches is the most matches a search may have to be worth
+// remembering; dense hits (every zero byte, ...) say nothing about the format
+const notableSearchMaxMatches = 10
+
+// indexAnalysis posts a summary to the RAG service in the background,
+// replacing the one indexed under externalID if set
+func indexAnalysis(externalID, title, summary, source string, metadata map[string]string) {
+	if analysisRAG == nil {
+		return
+	}
+	go func() {
+		if _, err := analysisRAG.IndexAnalysis(externalID, title, summary, source, metadata); err != nil {
+			log.Printf("Warning: failed to index analysis %q in RAG: %v", title, err)
+		}
+	}()
+}
+
+// indexCompressionAnalysis summarises a completed compression analysis: the
+// analysed range and its CRC32, the best method and every successful method
+func indexCompressionAnalysis(analysisID uint, file models.File, startOffset, length *int64, report *PythonAnalysisReport) {
+	start, end := int64(0), int64(len(file.Data))
+	if startOffset != nil && *startOffset >= 0 && *startOffset <= end {
+		start = *startOffset
+	}
+	if length != nil && *length >= 0 && start+*length < end {
+		end = start + *length
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Compression analysis of %s (file %d), bytes 0x%X-0x%X (%d bytes, CRC32 %08x).\n",
+		file.Name, file.ID, start, end, end-start, crc32.ChecksumIEEE(file.Data[start:end]))
+	if report.BestMethod != nil {
+		fmt.Fprintf(&b, "Best method: %s (ratio %.2f, confidence %.2f).\n", *report.BestMethod, report.BestRatio, report.BestConfidence)
+	} else {
+		b.WriteString("No method decompressed the data.\n")
+	}
+
+	successes := make([]PythonDecompressionResult, 0, len(report.Results))
+	for _, r := range report.Results {
+		if r.Success {
+			successes = append(successes, r)
+		}
+	}
+	sort.Slice(successes, func(i, j int) bool { return successes[i].Confidence > successes[j].Confidence })
+	for _, r := range successes {
+		fmt.Fprintf(&b, "- %s: %d -> %d bytes, ratio %.2f, confidence %.2f, checksum valid %t\n",
+			r.Method, r.OriginalSize, r.DecompressedSize, r.CompressionRatio, r.Confidence, r.ChecksumValid)
+	}
+	fmt.Fprintf(&b, "%d of %d methods succeeded.\n", report.SuccessCount, report.TotalTests)
+
+	metadata := map[string]string{
+		"kind":         "compression",
+		"file_id":      fmt.Sprint(file.ID),
+		"file_name":    file.Name,
+		"analysis_id":  fmt.Sprint(analysisID),
+		"start_offset": fmt.Sprint(start),
+		"length":       fmt.Sprint(end - start),
+	}
+	if report.BestMethod != nil {
+		metadata["best_method"] = *report.BestMethod
+	}
+	indexAnalysis("", fmt.Sprintf("Compression analysis of %s", file.Name), b.String(), fmt.Sprintf("file:%s", file.Name), metadata)
+}
+
+// indexSearch summarises a search with few enough matches to be notable
+func indexSearch(fileName string, data []byte, req SearchRequest, results []SearchResult) {
+	if len(results) == 0 || len(results) > notableSearchMaxMatches {
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Search for %s %q in %s found %d match(es):\n", req.Type, req.Value, fileName, len(results))
+	for _, r := range results {
+		fmt.Fprintf(&b, "- offset 0x%X, %d bytes\n", r.Offset, r.Length)
+	}
+	fmt.Fprintf(&b, "File CRC32 %08x, %d bytes.\n", crc32.ChecksumIEEE(data), len(data))
+
+	indexAnalysis(searchExternalID(req), fmt.Sprintf("Search %s %q in %s", req.Type, req.Value, fileName), b.String(), fmt.Sprintf("file:%s", fileName), map[string]string{
+		"kind":        "search",
+		"file_name":   fileName,
+		"search_type": req.Type,
+		"value":       req.Value,
+		"matches":     fmt.Sprint(len(results)),
+	})
+}
+
+// searchExternalID identifies a search by its file and parameters, so
+// repeating it replaces its summary in the RAG index
+func searchExternalID(req SearchRequest) string {
+	// Neither changes the matches summarised
+	req.ContextBytes = 0
+	req.Coalesce = false
+	key, _ := json.Marshal(req)
+	return fmt.Sprintf("search:%x", sha256.Sum256(key))
+}
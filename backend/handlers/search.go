@@ -2,47 +2,91 @@ package handlers
 
 import (
 	"binary-annotator-pro/config"
+	"binary-annotator-pro/metrics"
+	"binary-annotator-pro/models"
+	"context"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"math"
 	"net/http"
 	"regexp"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf16"
 
 	"github.com/labstack/echo/v4"
 )
 
 type SearchHandler struct {
-	db *config.DB
+	db    *config.DB
+	files *fileCache
 }
 
 func NewSearchHandler(db *config.DB) *SearchHandler {
 	return &SearchHandler{db: db}
 }
 
+// SearchHandler returns a SearchHandler sharing h's file cache
+func (h *Handler) SearchHandler() *SearchHandler {
+	return &SearchHandler{db: h.db, files: h.files}
+}
+
 // SearchRequest represents a search request
 type SearchRequest struct {
 	FileName string `json:"file_name"`
 	Value    string `json:"value"`
-	Type     string `json:"type"` // hex, string-ascii, string-utf8, int8, uint8, int16le, etc.
+	Type     string `json:"type"`            // hex, string-ascii, string-utf8, string-utf16le, int8, uint8, int16le, bcd, varint, etc.
 	Start    *int   `json:"start,omitempty"` // Optional start offset
 	End      *int   `json:"end,omitempty"`   // Optional end offset
 	Regex    bool   `json:"regex,omitempty"` // Enable regex matching
+	// ContextBytes adds this many bytes of context on each side of every match
+	ContextBytes int `json:"context_bytes,omitempty"`
+	// Coalesce returns adjacent or overlapping matches merged into ranges
+	// instead of individual matches, for highlighting dense hits
+	Coalesce bool `json:"coalesce,omitempty"`
+	// ExactBits makes float searches match the exact IEEE-754 encoding of
+	// the value instead of values within 0.0001 of it; "NaN", "Inf" and
+	// "-Inf" are accepted
+	ExactBits bool `json:"exact_bits,omitempty"`
+	// CaseInsensitive makes string searches ignore ASCII case
+	CaseInsensitive bool `json:"case_insensitive,omitempty"`
 }
 
+// maxSearchContextBytes caps context_bytes so results stay a reasonable size
+const maxSearchContextBytes = 4096
+
 // SearchResult represents a search result
 type SearchResult struct {
-	Offset int    `json:"offset"`
-	Length int    `json:"length"`
-	Value  string `json:"value,omitempty"`
+	Offset  int            `json:"offset"`
+	Length  int            `json:"length"`
+	Value   string         `json:"value,omitempty"`
+	Context *SearchContext `json:"context,omitempty"`
+}
+
+// SearchContext holds the bytes around a match, clamped to the file bounds
+type SearchContext struct {
+	Offset      int    `json:"offset"`       // file offset of the first context byte
+	Hex         string `json:"hex"`          // context bytes, match included
+	MatchOffset int    `json:"match_offset"` // position of the match within the context bytes
+}
+
+// SearchRange is a run of matched bytes, end exclusive
+type SearchRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
 }
 
-// SearchResponse represents the search response
+// SearchResponse represents the search response. With coalesce, Ranges
+// replaces Matches and Count is still the number of matches.
 type SearchResponse struct {
 	Matches []SearchResult `json:"matches"`
+	Ranges  []SearchRange  `json:"ranges,omitempty"`
 	Count   int            `json:"count"`
 }
 
@@ -50,106 +94,311 @@ type SearchResponse struct {
 func (sh *SearchHandler) Search(c echo.Context) error {
 	var req SearchRequest
 	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid request")
+	}
+	if req.ContextBytes < 0 || req.ContextBytes > maxSearchContextBytes {
+		return apiError(c, http.StatusBadRequest, ErrCodeOutOfRange, fmt.Sprintf("context_bytes must be 0-%d", maxSearchContextBytes))
 	}
 
 	// Read binary file
-	data, err := sh.db.ReadBinaryFile(req.FileName)
+	var file models.File
+	err := sh.files.load(sh.db.GormDB.Where("name = ?", req.FileName), &file)
+	data := file.Data
 	if err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "file not found"})
+		return apiError(c, http.StatusNotFound, ErrCodeFileNotFound, "file not found")
 	}
 
 	// Apply offset range if specified
+	startOffset, endOffset := searchRange(len(data), req.Start, req.End)
+
+	// Stop scanning when the client goes away, large files take a while
+	ctx := c.Request().Context()
+	var results []SearchResult
+	start := time.Now()
+	if req.ExactBits {
+		results, err = searchFloatBits(ctx, data, req.Type, req.Value)
+		if err == nil {
+			setSearchValues(data, results, req.Type, false)
+		}
+	} else {
+		results, err = searchByType(ctx, data, data[startOffset:endOffset], req.Type, req.Value, req.Regex, req.CaseInsensitive)
+	}
+	observeSearch(req.Type, start, err)
+	if ctx.Err() != nil {
+		return apiError(c, statusClientClosedRequest, ErrCodeCanceled, "search canceled")
+	}
+	if err != nil {
+		code := ErrCodeInvalidRequest
+		if errors.Is(err, errUnsupportedSearchType) {
+			code = ErrCodeUnsupported
+		}
+		return apiError(c, http.StatusBadRequest, code, err.Error())
+	}
+
+	// Adjust offsets to account for start position. Numeric and exact-bits
+	// searches scan the whole file, their offsets are already absolute.
+	if startOffset > 0 && !req.ExactBits && rangeRelativeSearch(req.Type) {
+		for i := range results {
+			results[i].Offset += startOffset
+		}
+	}
+
+	indexSearch(req.FileName, data, req, results)
+
+	if req.Coalesce {
+		return c.JSON(http.StatusOK, SearchResponse{
+			Matches: []SearchResult{},
+			Ranges:  coalesceResults(results),
+			Count:   len(results),
+		})
+	}
+	if req.ContextBytes > 0 {
+		addSearchContext(data, results, req.ContextBytes)
+	}
+
+	return c.JSON(http.StatusOK, SearchResponse{
+		Matches: results,
+		Count:   len(results),
+	})
+}
+
+var errUnsupportedSearchType = errors.New("unsupported search type")
+
+// statusClientClosedRequest is nginx's non-standard status for a request the
+// client abandoned; nobody reads the response, but it shows up in logs
+const statusClientClosedRequest = 499
+
+// cancelCheckInterval is how many positions the scan loops advance between
+// checks of the context, a power of two
+const cancelCheckInterval = 1 << 16
+
+// canceled reports whether a scan at position i should stop. It only looks
+// at the context every cancelCheckInterval positions to keep the loops tight.
+func canceled(ctx context.Context, i int) bool {
+	return i&(cancelCheckInterval-1) == 0 && ctx.Err() != nil
+}
+
+// observeSearch records a search in the metrics. Unknown types are counted
+// together so clients can't create new label values.
+func observeSearch(searchType string, start time.Time, err error) {
+	if errors.Is(err, errUnsupportedSearchType) {
+		searchType = "unsupported"
+	}
+	metrics.SearchDuration.WithLabelValues(searchType).Observe(metrics.Since(start))
+	metrics.Searches.WithLabelValues(searchType, metrics.Status(err)).Inc()
+}
+
+// coalesceResults merges matches that touch or overlap into ranges
+func coalesceResults(results []SearchResult) []SearchRange {
+	sorted := make([]SearchResult, len(results))
+	copy(sorted, results)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Offset < sorted[j].Offset })
+
+	ranges := []SearchRange{}
+	for _, r := range sorted {
+		end := r.Offset + r.Length
+		if n := len(ranges); n > 0 && r.Offset <= ranges[n-1].End {
+			if end > ranges[n-1].End {
+				ranges[n-1].End = end
+			}
+			continue
+		}
+		ranges = append(ranges, SearchRange{Start: r.Offset, End: end})
+	}
+	return ranges
+}
+
+// addSearchContext fills in the Context of each result with up to n bytes on
+// either side of the match
+func addSearchContext(data []byte, results []SearchResult, n int) {
+	for i := range results {
+		r := &results[i]
+		start := r.Offset - n
+		if start < 0 {
+			start = 0
+		}
+		end := r.Offset + r.Length + n
+		if end > len(data) {
+			end = len(data)
+		}
+		start = min(start, end)
+		r.Context = &SearchContext{
+			Offset:      start,
+			Hex:         hex.EncodeToString(data[start:end]),
+			MatchOffset: r.Offset - start,
+		}
+	}
+}
+
+// searchRange clamps the optional start/end offsets of a search to the data length
+func searchRange(dataLen int, start, end *int) (int, int) {
 	startOffset := 0
-	endOffset := len(data)
-	if req.Start != nil {
-		startOffset = *req.Start
+	endOffset := dataLen
+	if start != nil {
+		startOffset = *start
 		if startOffset < 0 {
 			startOffset = 0
 		}
-		if startOffset >= len(data) {
-			startOffset = len(data) - 1
+		if startOffset >= dataLen {
+			startOffset = dataLen - 1
 		}
 	}
-	if req.End != nil {
-		endOffset = *req.End
-		if endOffset > len(data) {
-			endOffset = len(data)
+	if end != nil {
+		endOffset = *end
+		if endOffset > dataLen {
+			endOffset = dataLen
 		}
 		if endOffset <= startOffset {
 			endOffset = startOffset + 1
 		}
 	}
+	return startOffset, endOffset
+}
 
-	// Extract the search range
-	searchData := data[startOffset:endOffset]
+// rangeRelativeSearch reports whether searchByType scans searchData for the
+// type, so match offsets are relative to the start of the range
+func rangeRelativeSearch(searchType string) bool {
+	switch searchType {
+	case "hex", "bcd", "varint":
+		return true
+	}
+	return strings.HasPrefix(searchType, "string-")
+}
 
-	// Perform search based on type
-	var results []SearchResult
+// searchByType runs the search for searchType. Hex, string, BCD and varint
+// searches scan searchData (the requested range); numeric searches scan the
+// full data. Matches carry the value found where it isn't simply the one
+// searched for, see setSearchValues. foldCase only applies to string searches.
+func searchByType(ctx context.Context, data, searchData []byte, searchType, value string, useRegex, foldCase bool) ([]SearchResult, error) {
+	results, err := findByType(ctx, data, searchData, searchType, value, useRegex, foldCase)
+	if err != nil {
+		return nil, err
+	}
+	scanned := data
+	if rangeRelativeSearch(searchType) {
+		scanned = searchData
+	}
+	setSearchValues(scanned, results, searchType, useRegex)
+	return results, nil
+}
+
+// setSearchValues fills in the Value of matches found in data: the decoded
+// number for numeric searches (which may differ from the one searched for
+// within the float tolerance), the number and UTC time for timestamps, and
+// the matched bytes for hex regex searches
+func setSearchValues(data []byte, results []SearchResult, searchType string, useRegex bool) {
+	for i := range results {
+		r := &results[i]
+		match := data[r.Offset : r.Offset+r.Length]
+		switch {
+		case searchType == "hex" && useRegex:
+			r.Value = fmt.Sprintf("% X", match)
+		case strings.HasPrefix(searchType, "timestamp-"):
+			r.Value = timestampValue(timestampFormats[searchType], match)
+		case searchType == "varint":
+			v, _ := binary.Uvarint(match)
+			r.Value = strconv.FormatUint(v, 10)
+		case strings.HasPrefix(searchType, "float32"):
+			r.Value = strconv.FormatFloat(sequenceDecoders[searchType].decode(match), 'g', -1, 32)
+		case strings.HasPrefix(searchType, "float64"):
+			r.Value = strconv.FormatFloat(sequenceDecoders[searchType].decode(match), 'g', -1, 64)
+		default:
+			if v, ok := integerValue(searchType, match); ok {
+				r.Value = v
+			}
+		}
+	}
+}
+
+// integerValue formats the integer of an int* or uint* match straight from
+// its bytes: 64-bit values above 2^53 don't survive a float64
+func integerValue(searchType string, match []byte) (string, bool) {
+	signed := strings.HasPrefix(searchType, "int")
+	if !signed && !strings.HasPrefix(searchType, "uint") {
+		return "", false
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if strings.HasSuffix(searchType, "be") {
+		order = binary.BigEndian
+	}
+	var v uint64
+	switch len(match) {
+	case 1:
+		v = uint64(match[0])
+	case 2:
+		v = uint64(order.Uint16(match))
+	case 4:
+		v = uint64(order.Uint32(match))
+	case 8:
+		v = order.Uint64(match)
+	default:
+		return "", false
+	}
+	if !signed {
+		return strconv.FormatUint(v, 10), true
+	}
+	// Sign-extend from the match width
+	shift := 64 - 8*len(match)
+	return strconv.FormatInt(int64(v<<shift)>>shift, 10), true
+}
 
-	switch req.Type {
+// findByType dispatches to the search function for searchType
+func findByType(ctx context.Context, data, searchData []byte, searchType, value string, useRegex, foldCase bool) ([]SearchResult, error) {
+	switch searchType {
 	case "hex":
-		results, err = searchHex(searchData, req.Value, req.Regex)
+		return searchHex(ctx, searchData, value, useRegex)
 	case "string-ascii":
-		results, err = searchStringASCII(searchData, req.Value, req.Regex)
+		return searchStringASCII(ctx, searchData, value, useRegex, foldCase)
 	case "string-utf8":
-		results, err = searchStringUTF8(searchData, req.Value, req.Regex)
+		return searchStringUTF8(ctx, searchData, value, useRegex, foldCase)
+	case "string-utf16le":
+		return searchStringUTF16(ctx, searchData, value, binary.LittleEndian, useRegex, foldCase)
+	case "string-utf16be":
+		return searchStringUTF16(ctx, searchData, value, binary.BigEndian, useRegex, foldCase)
 	case "int8":
-		results, err = searchInt8(data, req.Value)
+		return searchInt8(ctx, data, value)
 	case "uint8":
-		results, err = searchUint8(data, req.Value)
+		return searchUint8(ctx, data, value)
 	case "int16le":
-		results, err = searchInt16LE(data, req.Value)
+		return searchInt16LE(ctx, data, value)
 	case "int16be":
-		results, err = searchInt16BE(data, req.Value)
+		return searchInt16BE(ctx, data, value)
 	case "uint16le":
-		results, err = searchUint16LE(data, req.Value)
+		return searchUint16LE(ctx, data, value)
 	case "uint16be":
-		results, err = searchUint16BE(data, req.Value)
+		return searchUint16BE(ctx, data, value)
 	case "int32le":
-		results, err = searchInt32LE(data, req.Value)
+		return searchInt32LE(ctx, data, value)
 	case "int32be":
-		results, err = searchInt32BE(data, req.Value)
+		return searchInt32BE(ctx, data, value)
 	case "uint32le":
-		results, err = searchUint32LE(data, req.Value)
+		return searchUint32LE(ctx, data, value)
 	case "uint32be":
-		results, err = searchUint32BE(data, req.Value)
+		return searchUint32BE(ctx, data, value)
 	case "float32le":
-		results, err = searchFloat32LE(data, req.Value)
+		return searchFloat32LE(ctx, data, value)
 	case "float32be":
-		results, err = searchFloat32BE(data, req.Value)
+		return searchFloat32BE(ctx, data, value)
 	case "float64le":
-		results, err = searchFloat64LE(data, req.Value)
+		return searchFloat64LE(ctx, data, value)
 	case "float64be":
-		results, err = searchFloat64BE(data, req.Value)
-	case "timestamp-unix32":
-		results, err = searchTimestampUnix32(data, req.Value)
-	case "timestamp-unix64":
-		results, err = searchTimestampUnix64(data, req.Value)
+		return searchFloat64BE(ctx, data, value)
+	case "timestamp-unix32", "timestamp-unix32be", "timestamp-unix64", "timestamp-unix64be",
+		"timestamp-unixms64", "timestamp-unixms64be", "timestamp-filetime64le", "timestamp-filetime64be",
+		"timestamp-dos":
+		return searchTimestamp(ctx, data, searchType, value)
+	case "bcd":
+		return searchBCD(ctx, searchData, value)
+	case "varint":
+		return searchVarint(ctx, searchData, value)
 	default:
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "unsupported search type"})
-	}
-
-	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
-	}
-
-	// Adjust offsets to account for start position
-	if startOffset > 0 {
-		for i := range results {
-			results[i].Offset += startOffset
-		}
+		return nil, errUnsupportedSearchType
 	}
-
-	return c.JSON(http.StatusOK, SearchResponse{
-		Matches: results,
-		Count:   len(results),
-	})
 }
 
 // Search functions
 
-func searchHex(data []byte, hexPattern string, useRegex bool) ([]SearchResult, error) {
+func searchHex(ctx context.Context, data []byte, hexPattern string, useRegex bool) ([]SearchResult, error) {
 	// Remove spaces and convert to uppercase
 	cleanHex := strings.ReplaceAll(hexPattern, " ", "")
 	cleanHex = strings.ToUpper(cleanHex)
@@ -165,16 +414,18 @@ func searchHex(data []byte, hexPattern string, useRegex bool) ([]SearchResult, e
 			return nil, fmt.Errorf("invalid hex regex pattern: %v", err)
 		}
 
-		// Search through data
+		// Search through data. Every offset is tried, so overlapping matches
+		// are all reported, as with exact patterns.
 		for i := 0; i < len(data); i++ {
+			if canceled(ctx, i) {
+				return nil, ctx.Err()
+			}
 			matchLen := matchHexRegex(data[i:], hexRegex)
 			if matchLen > 0 {
 				results = append(results, SearchResult{
 					Offset: i,
 					Length: matchLen,
 				})
-				// Skip ahead to avoid overlapping matches
-				i += matchLen - 1
 			}
 		}
 	} else {
@@ -184,22 +435,7 @@ func searchHex(data []byte, hexPattern string, useRegex bool) ([]SearchResult, e
 			return nil, fmt.Errorf("invalid hex pattern: %v", err)
 		}
 
-		patternLen := len(pattern)
-		for i := 0; i <= len(data)-patternLen; i++ {
-			match := true
-			for j := 0; j < patternLen; j++ {
-				if data[i+j] != pattern[j] {
-					match = false
-					break
-				}
-			}
-			if match {
-				results = append(results, SearchResult{
-					Offset: i,
-					Length: patternLen,
-				})
-			}
-		}
+		return searchExact(ctx, data, pattern, false)
 	}
 
 	return results, nil
@@ -207,6 +443,8 @@ func searchHex(data []byte, hexPattern string, useRegex bool) ([]SearchResult, e
 
 // compileHexRegex converts a hex pattern with wildcards to a regex-like matcher
 // Supports: . (any nibble), * (any byte)
+// The result has one element per byte: a trailing single nibble matches the
+// high nibble of one more byte, so a 3-nibble pattern matches 2 bytes.
 func compileHexRegex(pattern string) ([]interface{}, error) {
 	var compiled []interface{}
 
@@ -259,7 +497,8 @@ func compileHexRegex(pattern string) ([]interface{}, error) {
 }
 
 // matchHexRegex attempts to match the compiled hex regex at the start of data
-// Returns the length of the match, or 0 if no match
+// Returns the length of the match in bytes (the number of compiled elements),
+// or 0 if no match
 func matchHexRegex(data []byte, pattern []interface{}) int {
 	if len(data) < len(pattern) {
 		return 0
@@ -302,18 +541,28 @@ func matchHexRegex(data []byte, pattern []interface{}) int {
 	return len(pattern)
 }
 
-func searchStringASCII(data []byte, value string, useRegex bool) ([]SearchResult, error) {
+// searchStringASCII finds value in data. With foldCase, ASCII letters match
+// regardless of case: the regex gets the (?i) flag, exact matching lowercases
+// the pattern and each candidate window.
+func searchStringASCII(ctx context.Context, data []byte, value string, useRegex, foldCase bool) ([]SearchResult, error) {
 	var results []SearchResult
 
 	if useRegex {
+		if foldCase {
+			value = "(?i)" + value
+		}
 		// Use Go regex for string matching
 		re, err := regexp.Compile(value)
 		if err != nil {
 			return nil, fmt.Errorf("invalid regex pattern: %v", err)
 		}
 
-		// Find all matches
+		// Find all matches. regexp can't be interrupted, so a canceled
+		// search only stops once the whole scan is done.
 		matches := re.FindAllIndex(data, -1)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		for _, match := range matches {
 			results = append(results, SearchResult{
 				Offset: match[0],
@@ -323,34 +572,185 @@ func searchStringASCII(data []byte, value string, useRegex bool) ([]SearchResult
 	} else {
 		// Exact string matching
 		pattern := []byte(value)
-		patternLen := len(pattern)
+		if foldCase {
+			pattern = asciiLower(pattern)
+		}
+		return searchExact(ctx, data, pattern, foldCase)
+	}
 
-		for i := 0; i <= len(data)-patternLen; i++ {
-			match := true
-			for j := 0; j < patternLen; j++ {
-				if data[i+j] != pattern[j] {
-					match = false
-					break
+	return results, nil
+}
+
+// searchChunkSize is the share of the data each worker of searchExact scans
+// at a time; smaller inputs are scanned on the calling goroutine. A variable
+// so tests can force chunking on small buffers.
+var searchChunkSize = 4 << 20
+
+// searchExact finds every occurrence of pattern in data, splitting data into
+// chunks scanned in parallel. Each chunk is extended by len(pattern)-1 bytes
+// so a match straddling a boundary is found by the chunk it starts in.
+// Results are in offset order, as with findExact.
+func searchExact(ctx context.Context, data, pattern []byte, foldCase bool) ([]SearchResult, error) {
+	chunks := (len(data) + searchChunkSize - 1) / searchChunkSize
+	workers := min(runtime.GOMAXPROCS(0), chunks)
+	if workers < 2 || len(pattern) == 0 {
+		return findExact(ctx, data, pattern, foldCase)
+	}
+
+	found := make([][]SearchResult, chunks)
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range next {
+				start := n * searchChunkSize
+				end := min(start+searchChunkSize+len(pattern)-1, len(data))
+				// findExact only fails once ctx is done, checked below
+				rs, _ := findExact(ctx, data[start:end], pattern, foldCase)
+				for i := range rs {
+					rs[i].Offset += start
 				}
+				found[n] = rs
 			}
-			if match {
-				results = append(results, SearchResult{
-					Offset: i,
-					Length: patternLen,
-				})
+		}()
+	}
+	for n := range chunks {
+		next <- n
+	}
+	close(next)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Chunks only report matches starting inside them, so an offset is
+	// never found twice; the check guards the merge against that anyway.
+	var results []SearchResult
+	for _, rs := range found {
+		for _, r := range rs {
+			if len(results) > 0 && results[len(results)-1].Offset >= r.Offset {
+				continue
 			}
+			results = append(results, r)
 		}
 	}
+	return results, nil
+}
+
+// findExact scans data for pattern byte by byte. With foldCase, pattern must
+// already be lower case and data is compared ignoring ASCII case.
+func findExact(ctx context.Context, data, pattern []byte, foldCase bool) ([]SearchResult, error) {
+	var results []SearchResult
+	patternLen := len(pattern)
 
+	for i := 0; i <= len(data)-patternLen; i++ {
+		if canceled(ctx, i) {
+			return nil, ctx.Err()
+		}
+		match := true
+		for j := 0; j < patternLen; j++ {
+			b := data[i+j]
+			if foldCase {
+				b = asciiLowerByte(b)
+			}
+			if b != pattern[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			results = append(results, SearchResult{
+				Offset: i,
+				Length: patternLen,
+			})
+		}
+	}
 	return results, nil
 }
 
-func searchStringUTF8(data []byte, value string, useRegex bool) ([]SearchResult, error) {
+func searchStringUTF8(ctx context.Context, data []byte, value string, useRegex, foldCase bool) ([]SearchResult, error) {
 	// UTF-8 is the same as ASCII for basic characters
-	return searchStringASCII(data, value, useRegex)
+	return searchStringASCII(ctx, data, value, useRegex, foldCase)
+}
+
+// searchStringUTF16 finds value encoded as UTF-16 in the given byte order.
+// A match directly preceded by the byte order mark is extended to include
+// it, so "\uFEFFPatient" and "Patient" are both found. With foldCase, code
+// units in the ASCII range match regardless of case.
+func searchStringUTF16(ctx context.Context, data []byte, value string, order binary.ByteOrder, useRegex, foldCase bool) ([]SearchResult, error) {
+	if useRegex {
+		return nil, errors.New("regex is not supported for UTF-16 strings")
+	}
+	if value == "" {
+		return nil, errors.New("empty search string")
+	}
+
+	units := utf16.Encode([]rune(value))
+	if foldCase {
+		for i, u := range units {
+			units[i] = asciiLowerUnit(u)
+		}
+	}
+	bom := make([]byte, 2)
+	order.PutUint16(bom, 0xFEFF)
+
+	var results []SearchResult
+	patternLen := len(units) * 2
+	for i := 0; i <= len(data)-patternLen; i++ {
+		if canceled(ctx, i) {
+			return nil, ctx.Err()
+		}
+		match := true
+		for j, u := range units {
+			got := order.Uint16(data[i+2*j:])
+			if foldCase {
+				got = asciiLowerUnit(got)
+			}
+			if got != u {
+				match = false
+				break
+			}
+		}
+		if !match {
+			continue
+		}
+		r := SearchResult{Offset: i, Length: patternLen}
+		if i >= 2 && data[i-2] == bom[0] && data[i-1] == bom[1] {
+			r.Offset -= 2
+			r.Length += 2
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+func asciiLowerUnit(u uint16) uint16 {
+	if 'A' <= u && u <= 'Z' {
+		return u + 'a' - 'A'
+	}
+	return u
+}
+
+// asciiLower returns a copy of b with A-Z lowercased; other bytes, UTF-8
+// sequences included, are left alone
+func asciiLower(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i, v := range b {
+		out[i] = asciiLowerByte(v)
+	}
+	return out
 }
 
-func searchInt8(data []byte, value string) ([]SearchResult, error) {
+func asciiLowerByte(b byte) byte {
+	if 'A' <= b && b <= 'Z' {
+		return b + 'a' - 'A'
+	}
+	return b
+}
+
+func searchInt8(ctx context.Context, data []byte, value string) ([]SearchResult, error) {
 	target, err := strconv.ParseInt(value, 10, 8)
 	if err != nil {
 		return nil, fmt.Errorf("invalid int8 value: %v", err)
@@ -358,6 +758,9 @@ func searchInt8(data []byte, value string) ([]SearchResult, error) {
 
 	var results []SearchResult
 	for i := 0; i < len(data); i++ {
+		if canceled(ctx, i) {
+			return nil, ctx.Err()
+		}
 		if int8(data[i]) == int8(target) {
 			results = append(results, SearchResult{
 				Offset: i,
@@ -369,7 +772,7 @@ func searchInt8(data []byte, value string) ([]SearchResult, error) {
 	return results, nil
 }
 
-func searchUint8(data []byte, value string) ([]SearchResult, error) {
+func searchUint8(ctx context.Context, data []byte, value string) ([]SearchResult, error) {
 	target, err := strconv.ParseUint(value, 10, 8)
 	if err != nil {
 		return nil, fmt.Errorf("invalid uint8 value: %v", err)
@@ -377,6 +780,9 @@ func searchUint8(data []byte, value string) ([]SearchResult, error) {
 
 	var results []SearchResult
 	for i := 0; i < len(data); i++ {
+		if canceled(ctx, i) {
+			return nil, ctx.Err()
+		}
 		if data[i] == uint8(target) {
 			results = append(results, SearchResult{
 				Offset: i,
@@ -388,7 +794,7 @@ func searchUint8(data []byte, value string) ([]SearchResult, error) {
 	return results, nil
 }
 
-func searchInt16LE(data []byte, value string) ([]SearchResult, error) {
+func searchInt16LE(ctx context.Context, data []byte, value string) ([]SearchResult, error) {
 	target, err := strconv.ParseInt(value, 10, 16)
 	if err != nil {
 		return nil, fmt.Errorf("invalid int16 value: %v", err)
@@ -396,6 +802,9 @@ func searchInt16LE(data []byte, value string) ([]SearchResult, error) {
 
 	var results []SearchResult
 	for i := 0; i <= len(data)-2; i++ {
+		if canceled(ctx, i) {
+			return nil, ctx.Err()
+		}
 		val := int16(binary.LittleEndian.Uint16(data[i:]))
 		if val == int16(target) {
 			results = append(results, SearchResult{
@@ -408,7 +817,7 @@ func searchInt16LE(data []byte, value string) ([]SearchResult, error) {
 	return results, nil
 }
 
-func searchInt16BE(data []byte, value string) ([]SearchResult, error) {
+func searchInt16BE(ctx context.Context, data []byte, value string) ([]SearchResult, error) {
 	target, err := strconv.ParseInt(value, 10, 16)
 	if err != nil {
 		return nil, fmt.Errorf("invalid int16 value: %v", err)
@@ -416,6 +825,9 @@ func searchInt16BE(data []byte, value string) ([]SearchResult, error) {
 
 	var results []SearchResult
 	for i := 0; i <= len(data)-2; i++ {
+		if canceled(ctx, i) {
+			return nil, ctx.Err()
+		}
 		val := int16(binary.BigEndian.Uint16(data[i:]))
 		if val == int16(target) {
 			results = append(results, SearchResult{
@@ -428,7 +840,7 @@ func searchInt16BE(data []byte, value string) ([]SearchResult, error) {
 	return results, nil
 }
 
-func searchUint16LE(data []byte, value string) ([]SearchResult, error) {
+func searchUint16LE(ctx context.Context, data []byte, value string) ([]SearchResult, error) {
 	target, err := strconv.ParseUint(value, 10, 16)
 	if err != nil {
 		return nil, fmt.Errorf("invalid uint16 value: %v", err)
@@ -436,6 +848,9 @@ func searchUint16LE(data []byte, value string) ([]SearchResult, error) {
 
 	var results []SearchResult
 	for i := 0; i <= len(data)-2; i++ {
+		if canceled(ctx, i) {
+			return nil, ctx.Err()
+		}
 		val := binary.LittleEndian.Uint16(data[i:])
 		if val == uint16(target) {
 			results = append(results, SearchResult{
@@ -448,7 +863,7 @@ func searchUint16LE(data []byte, value string) ([]SearchResult, error) {
 	return results, nil
 }
 
-func searchUint16BE(data []byte, value string) ([]SearchResult, error) {
+func searchUint16BE(ctx context.Context, data []byte, value string) ([]SearchResult, error) {
 	target, err := strconv.ParseUint(value, 10, 16)
 	if err != nil {
 		return nil, fmt.Errorf("invalid uint16 value: %v", err)
@@ -456,6 +871,9 @@ func searchUint16BE(data []byte, value string) ([]SearchResult, error) {
 
 	var results []SearchResult
 	for i := 0; i <= len(data)-2; i++ {
+		if canceled(ctx, i) {
+			return nil, ctx.Err()
+		}
 		val := binary.BigEndian.Uint16(data[i:])
 		if val == uint16(target) {
 			results = append(results, SearchResult{
@@ -468,7 +886,7 @@ func searchUint16BE(data []byte, value string) ([]SearchResult, error) {
 	return results, nil
 }
 
-func searchInt32LE(data []byte, value string) ([]SearchResult, error) {
+func searchInt32LE(ctx context.Context, data []byte, value string) ([]SearchResult, error) {
 	target, err := strconv.ParseInt(value, 10, 32)
 	if err != nil {
 		return nil, fmt.Errorf("invalid int32 value: %v", err)
@@ -476,6 +894,9 @@ func searchInt32LE(data []byte, value string) ([]SearchResult, error) {
 
 	var results []SearchResult
 	for i := 0; i <= len(data)-4; i++ {
+		if canceled(ctx, i) {
+			return nil, ctx.Err()
+		}
 		val := int32(binary.LittleEndian.Uint32(data[i:]))
 		if val == int32(target) {
 			results = append(results, SearchResult{
@@ -488,7 +909,7 @@ func searchInt32LE(data []byte, value string) ([]SearchResult, error) {
 	return results, nil
 }
 
-func searchInt32BE(data []byte, value string) ([]SearchResult, error) {
+func searchInt32BE(ctx context.Context, data []byte, value string) ([]SearchResult, error) {
 	target, err := strconv.ParseInt(value, 10, 32)
 	if err != nil {
 		return nil, fmt.Errorf("invalid int32 value: %v", err)
@@ -496,6 +917,9 @@ func searchInt32BE(data []byte, value string) ([]SearchResult, error) {
 
 	var results []SearchResult
 	for i := 0; i <= len(data)-4; i++ {
+		if canceled(ctx, i) {
+			return nil, ctx.Err()
+		}
 		val := int32(binary.BigEndian.Uint32(data[i:]))
 		if val == int32(target) {
 			results = append(results, SearchResult{
@@ -508,7 +932,7 @@ func searchInt32BE(data []byte, value string) ([]SearchResult, error) {
 	return results, nil
 }
 
-func searchUint32LE(data []byte, value string) ([]SearchResult, error) {
+func searchUint32LE(ctx context.Context, data []byte, value string) ([]SearchResult, error) {
 	target, err := strconv.ParseUint(value, 10, 32)
 	if err != nil {
 		return nil, fmt.Errorf("invalid uint32 value: %v", err)
@@ -516,6 +940,9 @@ func searchUint32LE(data []byte, value string) ([]SearchResult, error) {
 
 	var results []SearchResult
 	for i := 0; i <= len(data)-4; i++ {
+		if canceled(ctx, i) {
+			return nil, ctx.Err()
+		}
 		val := binary.LittleEndian.Uint32(data[i:])
 		if val == uint32(target) {
 			results = append(results, SearchResult{
@@ -528,7 +955,7 @@ func searchUint32LE(data []byte, value string) ([]SearchResult, error) {
 	return results, nil
 }
 
-func searchUint32BE(data []byte, value string) ([]SearchResult, error) {
+func searchUint32BE(ctx context.Context, data []byte, value string) ([]SearchResult, error) {
 	target, err := strconv.ParseUint(value, 10, 32)
 	if err != nil {
 		return nil, fmt.Errorf("invalid uint32 value: %v", err)
@@ -536,6 +963,9 @@ func searchUint32BE(data []byte, value string) ([]SearchResult, error) {
 
 	var results []SearchResult
 	for i := 0; i <= len(data)-4; i++ {
+		if canceled(ctx, i) {
+			return nil, ctx.Err()
+		}
 		val := binary.BigEndian.Uint32(data[i:])
 		if val == uint32(target) {
 			results = append(results, SearchResult{
@@ -548,7 +978,7 @@ func searchUint32BE(data []byte, value string) ([]SearchResult, error) {
 	return results, nil
 }
 
-func searchFloat32LE(data []byte, value string) ([]SearchResult, error) {
+func searchFloat32LE(ctx context.Context, data []byte, value string) ([]SearchResult, error) {
 	target, err := strconv.ParseFloat(value, 32)
 	if err != nil {
 		return nil, fmt.Errorf("invalid float32 value: %v", err)
@@ -558,6 +988,9 @@ func searchFloat32LE(data []byte, value string) ([]SearchResult, error) {
 	tolerance := float32(0.0001) // Small tolerance for float comparison
 
 	for i := 0; i <= len(data)-4; i++ {
+		if canceled(ctx, i) {
+			return nil, ctx.Err()
+		}
 		bits := binary.LittleEndian.Uint32(data[i:])
 		val := math.Float32frombits(bits)
 		if math.Abs(float64(val-float32(target))) < float64(tolerance) {
@@ -571,7 +1004,7 @@ func searchFloat32LE(data []byte, value string) ([]SearchResult, error) {
 	return results, nil
 }
 
-func searchFloat32BE(data []byte, value string) ([]SearchResult, error) {
+func searchFloat32BE(ctx context.Context, data []byte, value string) ([]SearchResult, error) {
 	target, err := strconv.ParseFloat(value, 32)
 	if err != nil {
 		return nil, fmt.Errorf("invalid float32 value: %v", err)
@@ -581,6 +1014,9 @@ func searchFloat32BE(data []byte, value string) ([]SearchResult, error) {
 	tolerance := float32(0.0001)
 
 	for i := 0; i <= len(data)-4; i++ {
+		if canceled(ctx, i) {
+			return nil, ctx.Err()
+		}
 		bits := binary.BigEndian.Uint32(data[i:])
 		val := math.Float32frombits(bits)
 		if math.Abs(float64(val-float32(target))) < float64(tolerance) {
@@ -594,7 +1030,7 @@ func searchFloat32BE(data []byte, value string) ([]SearchResult, error) {
 	return results, nil
 }
 
-func searchFloat64LE(data []byte, value string) ([]SearchResult, error) {
+func searchFloat64LE(ctx context.Context, data []byte, value string) ([]SearchResult, error) {
 	target, err := strconv.ParseFloat(value, 64)
 	if err != nil {
 		return nil, fmt.Errorf("invalid float64 value: %v", err)
@@ -604,6 +1040,9 @@ func searchFloat64LE(data []byte, value string) ([]SearchResult, error) {
 	tolerance := 0.0001
 
 	for i := 0; i <= len(data)-8; i++ {
+		if canceled(ctx, i) {
+			return nil, ctx.Err()
+		}
 		bits := binary.LittleEndian.Uint64(data[i:])
 		val := math.Float64frombits(bits)
 		if math.Abs(val-target) < tolerance {
@@ -617,7 +1056,7 @@ func searchFloat64LE(data []byte, value string) ([]SearchResult, error) {
 	return results, nil
 }
 
-func searchFloat64BE(data []byte, value string) ([]SearchResult, error) {
+func searchFloat64BE(ctx context.Context, data []byte, value string) ([]SearchResult, error) {
 	target, err := strconv.ParseFloat(value, 64)
 	if err != nil {
 		return nil, fmt.Errorf("invalid float64 value: %v", err)
@@ -627,6 +1066,9 @@ func searchFloat64BE(data []byte, value string) ([]SearchResult, error) {
 	tolerance := 0.0001
 
 	for i := 0; i <= len(data)-8; i++ {
+		if canceled(ctx, i) {
+			return nil, ctx.Err()
+		}
 		bits := binary.BigEndian.Uint64(data[i:])
 		val := math.Float64frombits(bits)
 		if math.Abs(val-target) < tolerance {
@@ -640,54 +1082,138 @@ func searchFloat64BE(data []byte, value string) ([]SearchResult, error) {
 	return results, nil
 }
 
-func searchTimestampUnix32(data []byte, value string) ([]SearchResult, error) {
-	// Parse the timestamp string (supports various formats)
-	t, err := time.Parse(time.RFC3339, value)
-	if err != nil {
-		// Try parsing as date only
-		t, err = time.Parse("2006-01-02", value)
+// Canonical quiet NaNs, as C and most devices write them. Go's math.NaN()
+// has a different payload, so a "NaN" search must not use its bits.
+const (
+	quietNaN32 = 0x7FC00000
+	quietNaN64 = 0x7FF8000000000000
+)
+
+// searchFloatBits finds the exact encoding of a float value, with no tolerance
+func searchFloatBits(ctx context.Context, data []byte, searchType, value string) ([]SearchResult, error) {
+	var pattern []byte
+	switch searchType {
+	case "float32le", "float32be":
+		target, err := strconv.ParseFloat(value, 32)
 		if err != nil {
-			return nil, fmt.Errorf("invalid timestamp format: %v", err)
+			return nil, fmt.Errorf("invalid float32 value: %v", err)
+		}
+		bits := math.Float32bits(float32(target))
+		if math.IsNaN(target) {
+			bits = quietNaN32
+		}
+		if searchType == "float32le" {
+			pattern = binary.LittleEndian.AppendUint32(nil, bits)
+		} else {
+			pattern = binary.BigEndian.AppendUint32(nil, bits)
+		}
+	case "float64le", "float64be":
+		target, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float64 value: %v", err)
+		}
+		bits := math.Float64bits(target)
+		if math.IsNaN(target) {
+			bits = quietNaN64
 		}
+		if searchType == "float64le" {
+			pattern = binary.LittleEndian.AppendUint64(nil, bits)
+		} else {
+			pattern = binary.BigEndian.AppendUint64(nil, bits)
+		}
+	default:
+		return nil, fmt.Errorf("exact_bits only applies to float searches, not %s", searchType)
 	}
 
-	target := uint32(t.Unix())
 	var results []SearchResult
-
-	for i := 0; i <= len(data)-4; i++ {
-		val := binary.LittleEndian.Uint32(data[i:])
-		if val == target {
-			results = append(results, SearchResult{
-				Offset: i,
-				Length: 4,
-			})
+	for i := 0; i+len(pattern) <= len(data); i++ {
+		if canceled(ctx, i) {
+			return nil, ctx.Err()
+		}
+		if string(data[i:i+len(pattern)]) == string(pattern) {
+			results = append(results, SearchResult{Offset: i, Length: len(pattern)})
 		}
 	}
-
 	return results, nil
 }
 
-func searchTimestampUnix64(data []byte, value string) ([]SearchResult, error) {
-	t, err := time.Parse(time.RFC3339, value)
-	if err != nil {
-		t, err = time.Parse("2006-01-02", value)
-		if err != nil {
-			return nil, fmt.Errorf("invalid timestamp format: %v", err)
+// searchBCD finds a decimal number stored as packed BCD, two digits per byte,
+// in either nibble order. An odd digit count leaves the last byte's other
+// nibble unchecked, so "20231" matches 20 23 1? (or 02 32 ?1 swapped).
+func searchBCD(ctx context.Context, data []byte, value string) ([]SearchResult, error) {
+	digits := strings.ReplaceAll(value, " ", "")
+	if digits == "" {
+		return nil, fmt.Errorf("invalid bcd value: empty")
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return nil, fmt.Errorf("invalid bcd value: %q is not a decimal digit", r)
 		}
 	}
 
-	target := uint64(t.Unix())
+	n := (len(digits) + 1) / 2
 	var results []SearchResult
+	for _, highFirst := range []bool{true, false} {
+		pattern, mask := make([]byte, n), make([]byte, n)
+		for i := 0; i < len(digits); i++ {
+			d := digits[i] - '0'
+			shift := 0
+			if (i%2 == 0) == highFirst {
+				shift = 4
+			}
+			pattern[i/2] |= d << shift
+			mask[i/2] |= 0x0F << shift
+		}
 
-	for i := 0; i <= len(data)-8; i++ {
-		val := binary.LittleEndian.Uint64(data[i:])
-		if val == target {
-			results = append(results, SearchResult{
-				Offset: i,
-				Length: 8,
-			})
+		for i := 0; i+n <= len(data); i++ {
+			if canceled(ctx, i) {
+				return nil, ctx.Err()
+			}
+			match := true
+			for j := 0; j < n; j++ {
+				if data[i+j]&mask[j] != pattern[j] {
+					match = false
+					break
+				}
+			}
+			if match {
+				results = append(results, SearchResult{Offset: i, Length: n})
+			}
 		}
 	}
 
+	// A match in both orders (e.g. "11" in 0x11) is reported once
+	sort.Slice(results, func(i, j int) bool { return results[i].Offset < results[j].Offset })
+	unique := results[:0]
+	for _, r := range results {
+		if len(unique) == 0 || r.Offset != unique[len(unique)-1].Offset {
+			unique = append(unique, r)
+		}
+	}
+	return unique, nil
+}
+
+// searchVarint finds the unsigned LEB128 (protobuf varint) encoding of value.
+// Bytes preceded by a byte with the continuation bit set are the tail of a
+// longer varint and are skipped.
+func searchVarint(ctx context.Context, data []byte, value string) ([]SearchResult, error) {
+	target, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid varint value: %v", err)
+	}
+	pattern := binary.AppendUvarint(nil, target)
+
+	var results []SearchResult
+	for i := 0; i+len(pattern) <= len(data); i++ {
+		if canceled(ctx, i) {
+			return nil, ctx.Err()
+		}
+		if i > 0 && data[i-1]&0x80 != 0 {
+			continue
+		}
+		if string(data[i:i+len(pattern)]) == string(pattern) {
+			results = append(results, SearchResult{Offset: i, Length: len(pattern)})
+		}
+	}
 	return results, nil
 }
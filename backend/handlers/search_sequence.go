@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"binary-annotator-pro/models"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+
+	"github.com/labstack/echo/v4"
+)
+
+// SequenceSearchRequest asks for runs of increasing values at a fixed stride,
+// the layout of sample counters and timestamp arrays
+type SequenceSearchRequest struct {
+	FileID   uint   `json:"file_id"`
+	Type     string `json:"type"`      // uint8, int16le, uint32be, float64le, ...
+	Stride   int    `json:"stride"`    // bytes between values (default: the type size)
+	MinCount int    `json:"min_count"` // shortest run reported (default 4)
+	// ConstantDelta only accepts runs whose deltas stay within Tolerance
+	// (a fraction, default 0.1) of the run's first delta
+	ConstantDelta bool    `json:"constant_delta,omitempty"`
+	Tolerance     float64 `json:"tolerance,omitempty"`
+}
+
+// SequenceRun is a run of strictly increasing values
+type SequenceRun struct {
+	Offset     int     `json:"offset"`
+	Count      int     `json:"count"`
+	AvgDelta   float64 `json:"avg_delta"`
+	FirstValue float64 `json:"first_value"`
+	LastValue  float64 `json:"last_value"`
+}
+
+// SequenceSearchResponse lists the runs found, ordered by offset
+type SequenceSearchResponse struct {
+	Runs      []SequenceRun `json:"runs"`
+	Count     int           `json:"count"`
+	Truncated bool          `json:"truncated,omitempty"`
+}
+
+// maxSequenceRuns caps the number of runs returned
+const maxSequenceRuns = 1000
+
+// sequenceDecoder reads one numeric value of a given type
+type sequenceDecoder struct {
+	size   int
+	decode func(b []byte) float64
+}
+
+var sequenceDecoders = map[string]sequenceDecoder{
+	"uint8":     {1, func(b []byte) float64 { return float64(b[0]) }},
+	"int8":      {1, func(b []byte) float64 { return float64(int8(b[0])) }},
+	"uint16le":  {2, func(b []byte) float64 { return float64(binary.LittleEndian.Uint16(b)) }},
+	"uint16be":  {2, func(b []byte) float64 { return float64(binary.BigEndian.Uint16(b)) }},
+	"int16le":   {2, func(b []byte) float64 { return float64(int16(binary.LittleEndian.Uint16(b))) }},
+	"int16be":   {2, func(b []byte) float64 { return float64(int16(binary.BigEndian.Uint16(b))) }},
+	"uint32le":  {4, func(b []byte) float64 { return float64(binary.LittleEndian.Uint32(b)) }},
+	"uint32be":  {4, func(b []byte) float64 { return float64(binary.BigEndian.Uint32(b)) }},
+	"int32le":   {4, func(b []byte) float64 { return float64(int32(binary.LittleEndian.Uint32(b))) }},
+	"int32be":   {4, func(b []byte) float64 { return float64(int32(binary.BigEndian.Uint32(b))) }},
+	"uint64le":  {8, func(b []byte) float64 { return float64(binary.LittleEndian.Uint64(b)) }},
+	"uint64be":  {8, func(b []byte) float64 { return float64(binary.BigEndian.Uint64(b)) }},
+	"int64le":   {8, func(b []byte) float64 { return float64(int64(binary.LittleEndian.Uint64(b))) }},
+	"int64be":   {8, func(b []byte) float64 { return float64(int64(binary.BigEndian.Uint64(b))) }},
+	"float32le": {4, func(b []byte) float64 { return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))) }},
+	"float32be": {4, func(b []byte) float64 { return float64(math.Float32frombits(binary.BigEndian.Uint32(b))) }},
+	"float64le": {8, func(b []byte) float64 { return math.Float64frombits(binary.LittleEndian.Uint64(b)) }},
+	"float64be": {8, func(b []byte) float64 { return math.Float64frombits(binary.BigEndian.Uint64(b)) }},
+}
+
+// SearchSequence finds runs where the values at offset, offset+stride, ...
+// are strictly increasing
+func (sh *SearchHandler) SearchSequence(c echo.Context) error {
+	var req SequenceSearchRequest
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid request")
+	}
+
+	dec, ok := sequenceDecoders[req.Type]
+	if !ok {
+		return apiError(c, http.StatusBadRequest, ErrCodeUnsupported, fmt.Sprintf("unsupported sequence type %q", req.Type))
+	}
+	if req.Stride == 0 {
+		req.Stride = dec.size
+	}
+	if req.Stride < dec.size {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("stride must be at least %d for %s", dec.size, req.Type))
+	}
+	if req.MinCount == 0 {
+		req.MinCount = 4
+	}
+	if req.MinCount < 2 {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "min_count must be at least 2")
+	}
+	if req.Tolerance == 0 {
+		req.Tolerance = 0.1
+	}
+	if req.Tolerance < 0 {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "tolerance must be positive")
+	}
+
+	var file models.File
+	if err := sh.files.load(sh.db.GormDB, &file, req.FileID); err != nil {
+		return apiError(c, http.StatusNotFound, ErrCodeFileNotFound, "file not found")
+	}
+
+	runs := findSequenceRuns(file.Data, dec, req)
+	resp := SequenceSearchResponse{Runs: runs, Count: len(runs)}
+	if len(runs) > maxSequenceRuns {
+		resp.Runs = runs[:maxSequenceRuns]
+		resp.Truncated = true
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// findSequenceRuns scans every alignment (0..stride-1) for increasing runs
+func findSequenceRuns(data []byte, dec sequenceDecoder, req SequenceSearchRequest) []SequenceRun {
+	runs := []SequenceRun{}
+	// A run needs two values a stride apart; a longer stride would only spin
+	// through empty phases
+	if req.Stride >= len(data) {
+		return runs
+	}
+	for phase := 0; phase < req.Stride; phase++ {
+		var run SequenceRun
+		var firstDelta float64
+		flush := func() {
+			if run.Count >= req.MinCount {
+				run.AvgDelta = (run.LastValue - run.FirstValue) / float64(run.Count-1)
+				runs = append(runs, run)
+			}
+		}
+
+		for off := phase; off+dec.size <= len(data); off += req.Stride {
+			v := dec.decode(data[off : off+dec.size])
+			if math.IsNaN(v) {
+				flush()
+				run = SequenceRun{}
+				continue
+			}
+			if run.Count == 0 {
+				run = SequenceRun{Offset: off, Count: 1, FirstValue: v, LastValue: v}
+				continue
+			}
+
+			delta := v - run.LastValue
+			switch {
+			case !(delta > 0) || math.IsInf(delta, 0):
+				// Not increasing: a new run may start here
+				flush()
+				run = SequenceRun{Offset: off, Count: 1, FirstValue: v, LastValue: v}
+			case run.Count == 1:
+				firstDelta = delta
+				run.Count, run.LastValue = 2, v
+			case req.ConstantDelta && math.Abs(delta-firstDelta) > req.Tolerance*firstDelta:
+				// Still increasing but the step changed: restart from the previous value
+				flush()
+				prev := run.LastValue
+				run = SequenceRun{Offset: off - req.Stride, Count: 2, FirstValue: prev, LastValue: v}
+				firstDelta = delta
+			default:
+				run.Count++
+				run.LastValue = v
+			}
+		}
+		flush()
+	}
+
+	sort.Slice(runs, func(i, j int) bool { return runs[i].Offset < runs[j].Offset })
+	return runs
+}
@@ -0,0 +1,748 @@
+package handlers
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"slices"
+	"testing"
+	"time"
+
+	"binary-annotator-pro/services"
+)
+
+// TestSearchContextClamped checks context bytes are clamped at the start and end of the file
+func TestSearchContextClamped(t *testing.T) {
+	h := newTestHandler(t)
+	sh := NewSearchHandler(h.db)
+
+	// "AB" at offsets 1 and 8 of a 10-byte file
+	createTestFile(t, h, "ctx.bin", []byte{0x00, 0xAB, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0xAB, 0x07})
+
+	c, rec := newJSONContext(http.MethodPost, "/search", map[string]interface{}{
+		"file_name":     "ctx.bin",
+		"value":         "AB",
+		"type":          "hex",
+		"context_bytes": 3,
+	})
+	if err := sh.Search(c); err != nil {
+		t.Fatal(err)
+	}
+	var resp SearchResponse
+	decodeJSON(t, rec, http.StatusOK, &resp)
+
+	if resp.Count != 2 {
+		t.Fatalf("got %d matches, want 2", resp.Count)
+	}
+	want := []SearchContext{
+		{Offset: 0, Hex: "00ab010203", MatchOffset: 1}, // clamped at the start
+		{Offset: 5, Hex: "040506ab07", MatchOffset: 3}, // clamped at the end
+	}
+	for i, m := range resp.Matches {
+		if m.Context == nil {
+			t.Fatalf("match %d has no context", i)
+		}
+		if *m.Context != want[i] {
+			t.Errorf("match %d context = %+v, want %+v", i, *m.Context, want[i])
+		}
+	}
+
+	// Without context_bytes results stay offset/length only
+	c, rec = newJSONContext(http.MethodPost, "/search", map[string]interface{}{
+		"file_name": "ctx.bin",
+		"value":     "AB",
+		"type":      "hex",
+	})
+	if err := sh.Search(c); err != nil {
+		t.Fatal(err)
+	}
+	var plain SearchResponse
+	decodeJSON(t, rec, http.StatusOK, &plain)
+	if plain.Matches[0].Context != nil {
+		t.Errorf("context without context_bytes = %+v, want none", plain.Matches[0].Context)
+	}
+}
+
+// TestSearchSequenceFindsCounter checks an embedded incrementing uint32le array is detected
+func TestSearchSequenceFindsCounter(t *testing.T) {
+	h := newTestHandler(t)
+	sh := NewSearchHandler(h.db)
+
+	// 20 counter values stepping by 10, at an odd offset between zero padding
+	const start, count = 37, 20
+	data := make([]byte, start+count*4+64)
+	for i := 0; i < count; i++ {
+		binary.LittleEndian.PutUint32(data[start+i*4:], uint32(1000+10*i))
+	}
+	file := createTestFile(t, h, "counter.bin", data)
+
+	c, rec := newJSONContext(http.MethodPost, "/search/sequence", map[string]interface{}{
+		"file_id":        file.ID,
+		"type":           "uint32le",
+		"constant_delta": true,
+	})
+	if err := sh.SearchSequence(c); err != nil {
+		t.Fatal(err)
+	}
+	var resp SequenceSearchResponse
+	decodeJSON(t, rec, http.StatusOK, &resp)
+
+	want := SequenceRun{Offset: start, Count: count, AvgDelta: 10, FirstValue: 1000, LastValue: 1190}
+	for _, run := range resp.Runs {
+		if run.Offset == start {
+			if run != want {
+				t.Errorf("run at %d = %+v, want %+v", start, run, want)
+			}
+			return
+		}
+	}
+	t.Errorf("no run at offset %d in %+v", start, resp.Runs)
+}
+
+// TestSearchSequenceHugeStride checks a stride longer than the file returns
+// no runs at once instead of looping through every phase
+func TestSearchSequenceHugeStride(t *testing.T) {
+	h := newTestHandler(t)
+	sh := NewSearchHandler(h.db)
+	file := createTestFile(t, h, "short.bin", []byte{1, 0, 0, 0, 2, 0, 0, 0})
+
+	c, rec := newJSONContext(http.MethodPost, "/search/sequence", map[string]interface{}{
+		"file_id": file.ID,
+		"type":    "uint32le",
+		"stride":  math.MaxInt,
+	})
+	if err := sh.SearchSequence(c); err != nil {
+		t.Fatal(err)
+	}
+	var resp SequenceSearchResponse
+	decodeJSON(t, rec, http.StatusOK, &resp)
+	if resp.Count != 0 {
+		t.Errorf("runs = %+v, want none", resp.Runs)
+	}
+}
+
+// TestSearchCoalesce checks a run of consecutive matches collapses into one range
+func TestSearchCoalesce(t *testing.T) {
+	h := newTestHandler(t)
+	sh := NewSearchHandler(h.db)
+
+	// 100 zero bytes at 4..103, another at 110
+	data := make([]byte, 120)
+	for i := range data {
+		data[i] = 0xFF
+	}
+	for i := 4; i < 104; i++ {
+		data[i] = 0
+	}
+	data[110] = 0
+	createTestFile(t, h, "dense.bin", data)
+
+	c, rec := newJSONContext(http.MethodPost, "/search", map[string]interface{}{
+		"file_name": "dense.bin",
+		"value":     "0",
+		"type":      "uint8",
+		"coalesce":  true,
+	})
+	if err := sh.Search(c); err != nil {
+		t.Fatal(err)
+	}
+	var resp SearchResponse
+	decodeJSON(t, rec, http.StatusOK, &resp)
+
+	want := []SearchRange{{Start: 4, End: 104}, {Start: 110, End: 111}}
+	if resp.Count != 101 || len(resp.Matches) != 0 || !reflect.DeepEqual(resp.Ranges, want) {
+		t.Errorf("got count=%d matches=%d ranges=%v, want 101, 0 and %v", resp.Count, len(resp.Matches), resp.Ranges, want)
+	}
+
+	// Overlapping multi-byte matches merge too
+	if got := coalesceResults([]SearchResult{{Offset: 10, Length: 4}, {Offset: 0, Length: 2}, {Offset: 12, Length: 4}, {Offset: 2, Length: 1}}); !reflect.DeepEqual(got, []SearchRange{{0, 3}, {10, 16}}) {
+		t.Errorf("coalesceResults() = %v", got)
+	}
+}
+
+// TestSearchBCD checks an odd digit count leaves the last nibble free and
+// both nibble orders are found
+func TestSearchBCD(t *testing.T) {
+	h := newTestHandler(t)
+	sh := NewSearchHandler(h.db)
+
+	createTestFile(t, h, "serial.bin", []byte{
+		0x00, 0x20, 0x23, 0x15, // 2023 15: matches "20231"
+		0xFF, 0x20, 0x23, 0x21, // 2023 21: no match
+		0x02, 0x32, 0xF1, // swapped nibbles: 20 23 1F
+	})
+
+	c, rec := newJSONContext(http.MethodPost, "/search", map[string]interface{}{
+		"file_name": "serial.bin",
+		"value":     "20231",
+		"type":      "bcd",
+	})
+	if err := sh.Search(c); err != nil {
+		t.Fatal(err)
+	}
+	var resp SearchResponse
+	decodeJSON(t, rec, http.StatusOK, &resp)
+
+	want := []SearchResult{{Offset: 1, Length: 3}, {Offset: 8, Length: 3}}
+	if !reflect.DeepEqual(resp.Matches, want) {
+		t.Errorf("matches = %+v, want %+v", resp.Matches, want)
+	}
+
+	c, rec = newJSONContext(http.MethodPost, "/search", map[string]interface{}{
+		"file_name": "serial.bin",
+		"value":     "20x3",
+		"type":      "bcd",
+	})
+	if err := sh.Search(c); err != nil {
+		t.Fatal(err)
+	}
+	var apiErr APIError
+	decodeJSON(t, rec, http.StatusBadRequest, &apiErr)
+}
+
+// TestSearchVarint checks a value is found by its LEB128 encoding, but not as
+// the tail of a longer varint
+func TestSearchVarint(t *testing.T) {
+	h := newTestHandler(t)
+	sh := NewSearchHandler(h.db)
+
+	createTestFile(t, h, "proto.bin", []byte{
+		0x08, 0xAC, 0x02, // field 1 = 300
+		0x10, 0x81, 0xAC, 0x02, // field 2 = 38145: ends with AC 02 but is not 300
+		0x18, 0xAC, 0x02, // field 3 = 300
+	})
+
+	c, rec := newJSONContext(http.MethodPost, "/search", map[string]interface{}{
+		"file_name": "proto.bin",
+		"value":     "300",
+		"type":      "varint",
+	})
+	if err := sh.Search(c); err != nil {
+		t.Fatal(err)
+	}
+	var resp SearchResponse
+	decodeJSON(t, rec, http.StatusOK, &resp)
+
+	want := []SearchResult{{Offset: 1, Length: 2, Value: "300"}, {Offset: 8, Length: 2, Value: "300"}}
+	if !reflect.DeepEqual(resp.Matches, want) {
+		t.Errorf("matches = %+v, want %+v", resp.Matches, want)
+	}
+}
+
+// TestSearchFloatExactBits checks exact_bits matches only the precise
+// encoding, where the default tolerance also matches nearby values
+func TestSearchFloatExactBits(t *testing.T) {
+	h := newTestHandler(t)
+	sh := NewSearchHandler(h.db)
+
+	var data []byte
+	data = binary.LittleEndian.AppendUint32(data, math.Float32bits(2.5))     // offset 0: the gain
+	data = binary.LittleEndian.AppendUint32(data, math.Float32bits(2.50005)) // offset 4: within tolerance
+	data = append(data, 0x00, 0x00, 0xC0, 0x7F)                              // offset 8: canonical quiet NaN
+	data = append(data, 0x7F, 0xF8, 0, 0, 0, 0, 0, 0)                        // offset 12: float64be canonical quiet NaN
+	createTestFile(t, h, "gain.bin", data)
+
+	searchType := "float32le"
+	search := func(value string, exact bool) []SearchResult {
+		t.Helper()
+		c, rec := newJSONContext(http.MethodPost, "/search", map[string]interface{}{
+			"file_name":  "gain.bin",
+			"value":      value,
+			"type":       searchType,
+			"exact_bits": exact,
+		})
+		if err := sh.Search(c); err != nil {
+			t.Fatal(err)
+		}
+		var resp SearchResponse
+		decodeJSON(t, rec, http.StatusOK, &resp)
+		return resp.Matches
+	}
+
+	if got := search("2.5", false); len(got) != 2 {
+		t.Fatalf("tolerant search matched %+v, want offsets 0 and 4", got)
+	}
+	if got := search("2.5", true); !reflect.DeepEqual(got, []SearchResult{{Offset: 0, Length: 4, Value: "2.5"}}) {
+		t.Errorf("exact search matched %+v, want only offset 0", got)
+	}
+	if got := search("NaN", true); !reflect.DeepEqual(got, []SearchResult{{Offset: 8, Length: 4, Value: "NaN"}}) {
+		t.Errorf("NaN search matched %+v, want offset 8", got)
+	}
+	searchType = "float64be"
+	if got := search("NaN", true); !reflect.DeepEqual(got, []SearchResult{{Offset: 12, Length: 8, Value: "NaN"}}) {
+		t.Errorf("float64 NaN search matched %+v, want offset 12", got)
+	}
+}
+
+// TestSearchResultValues checks each kind of search reports the value it
+// found at the match
+func TestSearchResultValues(t *testing.T) {
+	var data []byte
+	data = binary.LittleEndian.AppendUint16(data, 0xFFFE)                    // 0: int16le -2
+	data = binary.LittleEndian.AppendUint32(data, math.Float32bits(2.50005)) // 2: float32le near 2.5
+	data = binary.LittleEndian.AppendUint32(data, 1700000000)                // 6: unix32
+	data = append(data, 0xA7, 0x3C)                                          // 10
+
+	tests := []struct {
+		searchType, value string
+		regex             bool
+		want              SearchResult
+	}{
+		{"int16le", "-2", false, SearchResult{Offset: 0, Length: 2, Value: "-2"}},
+		{"float32le", "2.5", false, SearchResult{Offset: 2, Length: 4, Value: "2.50005"}},
+		{"timestamp-unix32", "2023-11-14T22:13:20Z", false, SearchResult{Offset: 6, Length: 4, Value: "1700000000 (2023-11-14T22:13:20Z)"}},
+		{"hex", "A. 3C", true, SearchResult{Offset: 10, Length: 2, Value: "A7 3C"}},
+		{"hex", "A7 3C", false, SearchResult{Offset: 10, Length: 2}},
+	}
+	for _, tt := range tests {
+		got, err := searchByType(context.Background(), data, data, tt.searchType, tt.value, tt.regex, false)
+		if err != nil {
+			t.Fatalf("%s %q: %v", tt.searchType, tt.value, err)
+		}
+		if len(got) != 1 || got[0] != tt.want {
+			t.Errorf("%s %q matched %+v, want %+v", tt.searchType, tt.value, got, tt.want)
+		}
+	}
+}
+
+// TestSetSearchValuesIntegers checks integer matches are reported exactly,
+// 64-bit values above 2^53 included
+func TestSetSearchValuesIntegers(t *testing.T) {
+	tests := []struct {
+		searchType string
+		match      []byte
+		want       string
+	}{
+		{"int8", []byte{0x80}, "-128"},
+		{"uint16be", []byte{0xFF, 0xFE}, "65534"},
+		{"int32le", binary.LittleEndian.AppendUint32(nil, 0xFFFFFFFF), "-1"},
+		{"int64le", binary.LittleEndian.AppendUint64(nil, 1<<53+1), "9007199254740993"},
+		{"int64be", binary.BigEndian.AppendUint64(nil, 1<<63), "-9223372036854775808"},
+		{"uint64le", binary.LittleEndian.AppendUint64(nil, math.MaxUint64), "18446744073709551615"},
+	}
+	for _, tt := range tests {
+		results := []SearchResult{{Offset: 0, Length: len(tt.match)}}
+		setSearchValues(tt.match, results, tt.searchType, false)
+		if results[0].Value != tt.want {
+			t.Errorf("%s %X = %q, want %s", tt.searchType, tt.match, results[0].Value, tt.want)
+		}
+	}
+}
+
+// TestSearchTimestampVariants embeds the same instant as big-endian seconds
+// and as little-endian milliseconds and finds each with its type
+func TestSearchTimestampVariants(t *testing.T) {
+	const when = 1700000000 // 2023-11-14T22:13:20Z
+	var data []byte
+	data = append(data, 0x00, 0x00)
+	data = binary.BigEndian.AppendUint32(data, when)             // 2
+	data = binary.LittleEndian.AppendUint64(data, when*1000+250) // 6
+	data = binary.BigEndian.AppendUint64(data, when*1000)        // 14
+
+	tests := []struct {
+		searchType, value string
+		want              []int
+	}{
+		{"timestamp-unix32be", "2023-11-14T22:13:20Z", []int{2}},
+		{"timestamp-unix32be", "2023-11-14 22:13:20", []int{2}},
+		{"timestamp-unix32be", "2023-11-14T23:13:20+01:00", []int{2}},
+		{"timestamp-unix32", "2023-11-14T22:13:20Z", nil},
+		{"timestamp-unixms64", "2023-11-14 22:13:20", []int{6}},
+		{"timestamp-unixms64", "2023-11-14T22:13:20.250Z", []int{6}},
+		{"timestamp-unixms64", "2023-11-14T22:13:20.251Z", nil},
+		{"timestamp-unixms64be", "2023-11-14T22:13:20Z", []int{14}},
+	}
+	for _, tt := range tests {
+		results, err := searchByType(context.Background(), data, data, tt.searchType, tt.value, false, false)
+		if err != nil {
+			t.Fatalf("%s %q: %v", tt.searchType, tt.value, err)
+		}
+		var got []int
+		for _, r := range results {
+			got = append(got, r.Offset)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %q found %v, want %v", tt.searchType, tt.value, got, tt.want)
+		}
+	}
+
+	if _, err := searchByType(context.Background(), data, data, "timestamp-unix32be", "14/11/2023", false, false); err == nil {
+		t.Error("unparseable timestamp accepted")
+	}
+}
+
+// TestSearchFiletimeAndDOS finds 2023-11-14 22:13:20 UTC stored as a FILETIME
+// and as a packed DOS date and time
+func TestSearchFiletimeAndDOS(t *testing.T) {
+	var data []byte
+	data = append(data, 0xEE)
+	data = binary.LittleEndian.AppendUint64(data, 133444736000000000+1234567) // 1: FILETIME, 0.1234567 s later
+	data = binary.BigEndian.AppendUint64(data, 133444736000000000)            // 9
+	data = append(data, 0xAA, 0xB1, 0x6E, 0x57)                               // 17: DOS time 0xB1AA, date 0x576E
+
+	tests := []struct {
+		searchType, value string
+		want              []SearchResult
+	}{
+		{"timestamp-filetime64le", "2023-11-14T22:13:20Z", []SearchResult{{Offset: 1, Length: 8, Value: "133444736001234567 (2023-11-14T22:13:20.123Z)"}}},
+		{"timestamp-filetime64be", "2023-11-14 23:13:20+01:00", []SearchResult{{Offset: 9, Length: 8, Value: "133444736000000000 (2023-11-14T22:13:20.000Z)"}}},
+		{"timestamp-dos", "2023-11-14 22:13:20", []SearchResult{{Offset: 17, Length: 4, Value: "1466872234 (2023-11-14T22:13:20Z)"}}},
+		{"timestamp-dos", "2023-11-14 22:13:21", []SearchResult{{Offset: 17, Length: 4, Value: "1466872234 (2023-11-14T22:13:20Z)"}}},
+		{"timestamp-dos", "2023-11-14 22:13:22", nil},
+	}
+	for _, tt := range tests {
+		got, err := searchByType(context.Background(), data, data, tt.searchType, tt.value, false, false)
+		if err != nil {
+			t.Fatalf("%s %q: %v", tt.searchType, tt.value, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %q matched %+v, want %+v", tt.searchType, tt.value, got, tt.want)
+		}
+	}
+
+	if _, err := searchByType(context.Background(), data, data, "timestamp-dos", "1975-01-01", false, false); err == nil {
+		t.Error("DOS search before 1980 accepted")
+	}
+}
+
+// TestSearchTimestampsWindow scans aligned 32-bit fields and keeps only the
+// ones decoding to a time in the default 2000-2030 window
+func TestSearchTimestampsWindow(t *testing.T) {
+	h := newTestHandler(t)
+	sh := NewSearchHandler(h.db)
+
+	var data []byte
+	for _, v := range []uint32{
+		100,        // 0: 1970
+		1700000000, // 4: 2023-11-14
+		4000000000, // 8: 2096
+		946684800,  // 12: 2000-01-01, the first second of the window
+		1234,       // 16
+		1893456000, // 20: 2030-01-01
+	} {
+		data = binary.BigEndian.AppendUint32(data, v)
+	}
+	file := createTestFile(t, h, "records.bin", data)
+
+	c, rec := newJSONContext(http.MethodPost, "/search/timestamps", TimestampScanRequest{FileID: file.ID, Endian: "big", Align: 4})
+	if err := sh.SearchTimestamps(c); err != nil {
+		t.Fatal(err)
+	}
+	var resp TimestampScanResponse
+	decodeJSON(t, rec, http.StatusOK, &resp)
+
+	want := []TimestampMatch{
+		{Offset: 4, Raw: 1700000000, Time: "2023-11-14T22:13:20Z"},
+		{Offset: 12, Raw: 946684800, Time: "2000-01-01T00:00:00Z"},
+		{Offset: 20, Raw: 1893456000, Time: "2030-01-01T00:00:00Z"},
+	}
+	if !reflect.DeepEqual(resp.Matches, want) || resp.Count != 3 {
+		t.Errorf("matches = %+v, want %+v", resp.Matches, want)
+	}
+
+	// A narrower window
+	c, rec = newJSONContext(http.MethodPost, "/search/timestamps", TimestampScanRequest{
+		FileID: file.ID, Endian: "big", Align: 4, From: "2020-01-01", To: "2025-01-01"})
+	if err := sh.SearchTimestamps(c); err != nil {
+		t.Fatal(err)
+	}
+	resp = TimestampScanResponse{}
+	decodeJSON(t, rec, http.StatusOK, &resp)
+	if len(resp.Matches) != 1 || resp.Matches[0].Offset != 4 {
+		t.Errorf("2020-2025 matches = %+v, want offset 4 only", resp.Matches)
+	}
+
+	c, rec = newJSONContext(http.MethodPost, "/search/timestamps", TimestampScanRequest{FileID: file.ID, Unit: "milliseconds", Width: 4})
+	if err := sh.SearchTimestamps(c); err != nil {
+		t.Fatal(err)
+	}
+	decodeJSON(t, rec, http.StatusBadRequest, nil)
+}
+
+// TestSearchCaseInsensitive checks string searches only ignore case when
+// case_insensitive is set, for exact and regex matching
+func TestSearchCaseInsensitive(t *testing.T) {
+	h := newTestHandler(t)
+	sh := NewSearchHandler(h.db)
+	createTestFile(t, h, "patient.bin", []byte("\x00\x01NAME=AHMED\x00"))
+
+	tests := []struct {
+		value           string
+		regex           bool
+		caseInsensitive bool
+		want            int
+	}{
+		{"ahmed", false, false, 0},
+		{"ahmed", false, true, 1},
+		{"ahm[a-z]d", true, false, 0},
+		{"ahm[a-z]d", true, true, 1},
+	}
+	for _, tt := range tests {
+		c, rec := newJSONContext(http.MethodPost, "/search", map[string]interface{}{
+			"file_name":        "patient.bin",
+			"value":            tt.value,
+			"type":             "string-ascii",
+			"regex":            tt.regex,
+			"case_insensitive": tt.caseInsensitive,
+		})
+		if err := sh.Search(c); err != nil {
+			t.Fatal(err)
+		}
+		var resp SearchResponse
+		decodeJSON(t, rec, http.StatusOK, &resp)
+		if resp.Count != tt.want {
+			t.Errorf("%q regex=%v case_insensitive=%v: got %d matches, want %d", tt.value, tt.regex, tt.caseInsensitive, resp.Count, tt.want)
+			continue
+		}
+		if tt.want == 1 && (resp.Matches[0].Offset != 7 || resp.Matches[0].Length != 5) {
+			t.Errorf("%q: got match %+v, want offset 7 length 5", tt.value, resp.Matches[0])
+		}
+	}
+}
+
+// TestSearchUTF16 checks UTF-16LE strings are found, with or without a BOM,
+// and that the UTF-8 search doesn't match them
+func TestSearchUTF16(t *testing.T) {
+	h := newTestHandler(t)
+	sh := NewSearchHandler(h.db)
+
+	patient := []byte{'P', 0, 'a', 0, 't', 0, 'i', 0, 'e', 0, 'n', 0, 't', 0}
+	data := []byte{0x01, 0x02}
+	data = append(data, patient...)       // 2: no BOM
+	data = append(data, 0x00, 0xFF, 0xFE) // BOM at 17
+	data = append(data, patient...)       // 19
+	createTestFile(t, h, "utf16.bin", data)
+
+	search := func(searchType string) SearchResponse {
+		t.Helper()
+		c, rec := newJSONContext(http.MethodPost, "/search", map[string]interface{}{
+			"file_name": "utf16.bin",
+			"value":     "Patient",
+			"type":      searchType,
+		})
+		if err := sh.Search(c); err != nil {
+			t.Fatal(err)
+		}
+		var resp SearchResponse
+		decodeJSON(t, rec, http.StatusOK, &resp)
+		return resp
+	}
+
+	want := []SearchResult{{Offset: 2, Length: 14}, {Offset: 17, Length: 16}}
+	if got := search("string-utf16le").Matches; !reflect.DeepEqual(got, want) {
+		t.Errorf("string-utf16le: got %+v, want %+v", got, want)
+	}
+	if got := search("string-utf16be").Count; got != 0 {
+		t.Errorf("string-utf16be: got %d matches, want 0", got)
+	}
+	if got := search("string-utf8").Count; got != 0 {
+		t.Errorf("string-utf8: got %d matches, want 0", got)
+	}
+}
+
+// TestSearchHexRegexOddLength checks a trailing single nibble counts as one
+// more byte and that overlapping wildcard matches are all reported
+func TestSearchHexRegexOddLength(t *testing.T) {
+	data := []byte{0xA1, 0xA2, 0xA3, 0x00, 0xAB, 0x1F, 0xAB, 0x10}
+
+	tests := []struct {
+		pattern string
+		want    []SearchResult
+	}{
+		// 3 nibbles: AB then a byte whose high nibble is 1
+		{"AB1", []SearchResult{{Offset: 4, Length: 2}, {Offset: 6, Length: 2}}},
+		// A? followed by A?: matches at 0 and 1 overlap
+		{"A.A", []SearchResult{{Offset: 0, Length: 2}, {Offset: 1, Length: 2}}},
+		{"A. A. A", []SearchResult{{Offset: 0, Length: 3}}},
+		{"00*", []SearchResult{{Offset: 3, Length: 2}}},
+	}
+	for _, tt := range tests {
+		got, err := searchHex(context.Background(), data, tt.pattern, true)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.pattern, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %+v, want %+v", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+// TestSearchNumericWithStart checks numeric matches, found in the whole
+// file, keep their offsets when a start is given, and get context without
+// panicking
+func TestSearchNumericWithStart(t *testing.T) {
+	h := newTestHandler(t)
+	data := make([]byte, 20)
+	data[18] = 0x7F
+	createTestFile(t, h, "numstart.bin", data)
+
+	c, rec := newJSONContext(http.MethodPost, "/search", map[string]interface{}{
+		"file_name":     "numstart.bin",
+		"value":         "127",
+		"type":          "uint8",
+		"start":         10,
+		"context_bytes": 2,
+	})
+	if err := NewSearchHandler(h.db).Search(c); err != nil {
+		t.Fatal(err)
+	}
+	var resp SearchResponse
+	decodeJSON(t, rec, http.StatusOK, &resp)
+	if resp.Count != 1 || resp.Matches[0].Offset != 18 {
+		t.Fatalf("matches = %+v, want one at 18", resp.Matches)
+	}
+	want := SearchContext{Offset: 16, Hex: "00007f00", MatchOffset: 2}
+	if got := resp.Matches[0].Context; got == nil || *got != want {
+		t.Errorf("context = %+v, want %+v", got, want)
+	}
+}
+
+// TestSearchCanceled checks a search with a canceled context stops early
+// with the context error instead of scanning the whole file
+func TestSearchCanceled(t *testing.T) {
+	data := make([]byte, 32<<20)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, tt := range []struct{ searchType, value string }{
+		{"hex", "DEADBEEF"},
+		{"string-ascii", "needle"},
+		{"int32le", "12345"},
+		{"timestamp-unix32", "2023-11-14T22:13:20Z"},
+	} {
+		start := time.Now()
+		results, err := searchByType(ctx, data, data, tt.searchType, tt.value, false, false)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: err = %v, want context.Canceled", tt.searchType, err)
+		}
+		if results != nil {
+			t.Errorf("%s: got %d results from a canceled search", tt.searchType, len(results))
+		}
+		if d := time.Since(start); d > 100*time.Millisecond {
+			t.Errorf("%s: took %v to notice the cancellation", tt.searchType, d)
+		}
+	}
+
+	// The handler answers with the canceled code
+	h := newTestHandler(t)
+	createTestFile(t, h, "cancel.bin", data[:1<<20])
+	c, rec := newJSONContext(http.MethodPost, "/search", map[string]interface{}{
+		"file_name": "cancel.bin", "type": "hex", "value": "DEADBEEF",
+	})
+	c.SetRequest(c.Request().WithContext(ctx))
+	if err := NewSearchHandler(h.db).Search(c); err != nil {
+		t.Fatal(err)
+	}
+	var apiErr APIError
+	decodeJSON(t, rec, statusClientClosedRequest, &apiErr)
+	if apiErr.Code != ErrCodeCanceled {
+		t.Errorf("code = %q, want %q", apiErr.Code, ErrCodeCanceled)
+	}
+}
+
+// TestSearchExactParallel checks chunked parallel search finds exactly what
+// a serial scan finds, including matches straddling chunk boundaries
+func TestSearchExactParallel(t *testing.T) {
+	oldChunk := searchChunkSize
+	searchChunkSize = 64
+	defer func() { searchChunkSize = oldChunk }()
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	data := make([]byte, 4096)
+	for i := range data {
+		data[i] = byte(rng.IntN(4)) // small alphabet for plenty of matches
+	}
+	// Plant patterns across the boundaries at 64, 128 and 192, and a run
+	// of overlapping matches across 256
+	copy(data[61:], []byte{0xDE, 0xAD, 0xBE, 0xEF})
+	copy(data[126:], "Needle")
+	copy(data[190:], "nEEDLE")
+	copy(data[250:], "AAAAAAAAAAAA")
+
+	for _, tt := range []struct {
+		name     string
+		pattern  []byte
+		foldCase bool
+		boundary int // an offset that must be among the matches
+	}{
+		{"hex", []byte{0xDE, 0xAD, 0xBE, 0xEF}, false, 61},
+		{"string", []byte("Needle"), false, 126},
+		{"fold case", []byte("needle"), true, 190},
+		{"overlapping", []byte("AAA"), false, 254},
+		{"single byte", []byte{0x01}, false, -1},
+	} {
+		want, err := findExact(context.Background(), data, tt.pattern, tt.foldCase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := searchExact(context.Background(), data, tt.pattern, tt.foldCase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: parallel found %d matches, serial %d", tt.name, len(got), len(want))
+		}
+		if tt.boundary >= 0 && !slices.ContainsFunc(got, func(r SearchResult) bool { return r.Offset == tt.boundary }) {
+			t.Errorf("%s: missed the match at %d across a chunk boundary", tt.name, tt.boundary)
+		}
+	}
+
+	// And through the search types using it
+	want, _ := searchByType(context.Background(), data, data, "string-ascii", "needle", false, true)
+	searchChunkSize = len(data)
+	serial, _ := searchByType(context.Background(), data, data, "string-ascii", "needle", false, true)
+	if len(want) != 2 || !reflect.DeepEqual(want, serial) {
+		t.Errorf("string-ascii: parallel %v, serial %v", want, serial)
+	}
+}
+
+// TestSearchIndexedInRAGOnce checks repeating a notable search upserts the
+// same RAG document instead of indexing a new one each time
+func TestSearchIndexedInRAGOnce(t *testing.T) {
+	indexed := make(chan services.RAGIndexRequest, 3)
+	rag := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req services.RAGIndexRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		indexed <- req
+		w.Write([]byte(`{"document_id": 1, "chunk_count": 1}`))
+	}))
+	defer rag.Close()
+	old := analysisRAG
+	analysisRAG = services.NewRAGService(rag.URL)
+	defer func() { analysisRAG = old }()
+
+	h := newTestHandler(t)
+	sh := NewSearchHandler(h.db)
+	createTestFile(t, h, "sig.bin", []byte{0x00, 0xAB, 0xCD, 0x01, 0xAB, 0xCD, 0x02})
+
+	var ids []string
+	for _, body := range []map[string]interface{}{
+		{"file_name": "sig.bin", "value": "ABCD", "type": "hex"},
+		{"file_name": "sig.bin", "value": "ABCD", "type": "hex", "context_bytes": 2},
+		{"file_name": "sig.bin", "value": "CD", "type": "hex"},
+	} {
+		c, rec := newJSONContext(http.MethodPost, "/search", body)
+		if err := sh.Search(c); err != nil {
+			t.Fatal(err)
+		}
+		decodeJSON(t, rec, http.StatusOK, nil)
+		select {
+		case doc := <-indexed:
+			ids = append(ids, doc.ExternalID)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("search %v was not indexed", body)
+		}
+	}
+
+	if ids[0] == "" || ids[0] != ids[1] || ids[2] == ids[0] {
+		t.Errorf("external IDs = %q, want the repeated search to reuse its ID and the other search a new one", ids)
+	}
+}
@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"binary-annotator-pro/models"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Units a timestamp can be stored in
+const (
+	unitSeconds  = iota // Unix seconds
+	unitMillis          // Unix milliseconds
+	unitFiletime        // Windows FILETIME: 100 ns ticks since 1601-01-01
+	unitDOS             // packed DOS date (high word) and time (low word), 2 s resolution
+)
+
+// filetimeUnixEpoch is 1970-01-01 as a FILETIME
+const filetimeUnixEpoch = 116444736000000000
+
+// timestampFormat is how a timestamp search type stores a point in time
+type timestampFormat struct {
+	size  int
+	order binary.ByteOrder
+	unit  int
+}
+
+var timestampFormats = map[string]timestampFormat{
+	"timestamp-unix32":       {4, binary.LittleEndian, unitSeconds},
+	"timestamp-unix32be":     {4, binary.BigEndian, unitSeconds},
+	"timestamp-unix64":       {8, binary.LittleEndian, unitSeconds},
+	"timestamp-unix64be":     {8, binary.BigEndian, unitSeconds},
+	"timestamp-unixms64":     {8, binary.LittleEndian, unitMillis},
+	"timestamp-unixms64be":   {8, binary.BigEndian, unitMillis},
+	"timestamp-filetime64le": {8, binary.LittleEndian, unitFiletime},
+	"timestamp-filetime64be": {8, binary.BigEndian, unitFiletime},
+	"timestamp-dos":          {4, binary.LittleEndian, unitDOS},
+}
+
+// read decodes the stored value
+func (f timestampFormat) read(b []byte) int64 {
+	if f.size == 4 {
+		return int64(f.order.Uint32(b))
+	}
+	return int64(f.order.Uint64(b))
+}
+
+// targetRange returns the stored values that represent t. Sub-second units
+// match anywhere within the second when t has no fraction, since devices
+// rarely store a round second; DOS time rounds down to even seconds.
+func (f timestampFormat) targetRange(t time.Time) (int64, int64, error) {
+	switch f.unit {
+	case unitMillis:
+		low := t.UnixMilli()
+		if t.Nanosecond() == 0 {
+			return low, low + 999, nil
+		}
+		return low, low, nil
+	case unitFiletime:
+		if t.Year() < 1601 || t.Year() > 30000 {
+			return 0, 0, fmt.Errorf("timestamp %s is outside the FILETIME range", t.Format(time.RFC3339))
+		}
+		low := t.Unix()*10_000_000 + int64(t.Nanosecond()/100) + filetimeUnixEpoch
+		if t.Nanosecond() == 0 {
+			return low, low + 9_999_999, nil
+		}
+		return low, low, nil
+	case unitDOS:
+		if t.Year() < 1980 || t.Year() > 2107 {
+			return 0, 0, fmt.Errorf("timestamp %s is outside the DOS date range (1980-2107)", t.Format(time.RFC3339))
+		}
+		date := (t.Year()-1980)<<9 | int(t.Month())<<5 | t.Day()
+		clock := t.Hour()<<11 | t.Minute()<<5 | t.Second()/2
+		v := int64(date<<16 | clock)
+		return v, v, nil
+	}
+	v := t.Unix()
+	if f.size == 4 && (v < 0 || v > math.MaxUint32) {
+		return 0, 0, fmt.Errorf("timestamp %s does not fit in 32 bits", t.Format(time.RFC3339))
+	}
+	return v, v, nil
+}
+
+// toTime converts a stored value back to a UTC time
+func (f timestampFormat) toTime(v int64) time.Time {
+	switch f.unit {
+	case unitMillis:
+		return time.UnixMilli(v).UTC()
+	case unitFiletime:
+		ticks := v - filetimeUnixEpoch
+		return time.Unix(ticks/10_000_000, ticks%10_000_000*100).UTC()
+	case unitDOS:
+		date, clock := int(v>>16), int(v&0xFFFF)
+		return time.Date(1980+(date>>9), time.Month(date>>5&0x0F), date&0x1F,
+			clock>>11, clock>>5&0x3F, (clock&0x1F)*2, 0, time.UTC)
+	}
+	return time.Unix(v, 0).UTC()
+}
+
+// timestampLayouts are the accepted forms of a timestamp search value. Values
+// without a zone are UTC.
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+// parseTimestamp reads a timestamp search value
+func parseTimestamp(value string) (time.Time, error) {
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, strings.TrimSpace(value)); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp format: %q (expected RFC 3339, \"2006-01-02 15:04:05\" or \"2006-01-02\")", value)
+}
+
+// searchTimestamp finds a point in time stored in the search type's format
+func searchTimestamp(ctx context.Context, data []byte, searchType, value string) ([]SearchResult, error) {
+	format := timestampFormats[searchType]
+	t, err := parseTimestamp(value)
+	if err != nil {
+		return nil, err
+	}
+	low, high, err := format.targetRange(t)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []SearchResult
+	for i := 0; i+format.size <= len(data); i++ {
+		if canceled(ctx, i) {
+			return nil, ctx.Err()
+		}
+		if v := format.read(data[i:]); v >= low && v <= high {
+			results = append(results, SearchResult{
+				Offset: i,
+				Length: format.size,
+			})
+		}
+	}
+
+	return results, nil
+}
+
+// timestampValue formats a stored timestamp as "value (RFC 3339 UTC time)"
+func timestampValue(format timestampFormat, b []byte) string {
+	v := format.read(b)
+	layout := time.RFC3339
+	if format.unit == unitMillis || format.unit == unitFiletime {
+		layout = "2006-01-02T15:04:05.000Z07:00"
+	}
+	return fmt.Sprintf("%d (%s)", v, format.toTime(v).Format(layout))
+}
+
+// Default window of a timestamp scan
+const (
+	defaultTimestampScanFrom = "2000-01-01"
+	defaultTimestampScanTo   = "2030-12-31T23:59:59Z"
+)
+
+// maxTimestampMatches caps the matches a timestamp scan returns
+const maxTimestampMatches = 10000
+
+// TimestampScanRequest looks for every field that decodes to a time between
+// From and To
+type TimestampScanRequest struct {
+	FileID uint   `json:"file_id"`
+	Width  int    `json:"width"`  // field size: 4 (default) or 8
+	Endian string `json:"endian"` // "little" (default) or "big"
+	// Unit: "seconds" (Unix, default), "milliseconds" (Unix, width 8),
+	// "filetime" (width 8) or "dos" (packed date and time, width 4)
+	Unit  string `json:"unit"`
+	From  string `json:"from"`  // default 2000-01-01
+	To    string `json:"to"`    // default 2030-12-31T23:59:59Z
+	Align int    `json:"align"` // only check offsets that are multiples of this (default 1)
+}
+
+// TimestampMatch is a field decoding to a time in the window
+type TimestampMatch struct {
+	Offset int    `json:"offset"`
+	Raw    int64  `json:"raw"`
+	Time   string `json:"time"` // RFC 3339, UTC
+}
+
+// TimestampScanResponse lists the matches, ordered by offset
+type TimestampScanResponse struct {
+	Matches   []TimestampMatch `json:"matches"`
+	Count     int              `json:"count"`
+	Truncated bool             `json:"truncated,omitempty"`
+}
+
+// timestampUnits maps TimestampScanRequest.Unit to a unit and the widths it
+// can be stored in
+var timestampUnits = map[string]struct {
+	unit   int
+	widths []int
+}{
+	"seconds":      {unitSeconds, []int{4, 8}},
+	"milliseconds": {unitMillis, []int{8}},
+	"filetime":     {unitFiletime, []int{8}},
+	"dos":          {unitDOS, []int{4}},
+}
+
+// SearchTimestamps finds the fields of a file that decode to a plausible
+// time, for locating record timestamps without knowing their values
+func (sh *SearchHandler) SearchTimestamps(c echo.Context) error {
+	var req TimestampScanRequest
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid request")
+	}
+	if req.Width == 0 {
+		req.Width = 4
+	}
+	if req.Unit == "" {
+		req.Unit = "seconds"
+	}
+	unit, ok := timestampUnits[req.Unit]
+	if !ok {
+		return apiError(c, http.StatusBadRequest, ErrCodeUnsupported, "unit must be seconds, milliseconds, filetime or dos")
+	}
+	if !slices.Contains(unit.widths, req.Width) {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("width must be %v for %s", unit.widths, req.Unit))
+	}
+	format := timestampFormat{size: req.Width, order: binary.LittleEndian, unit: unit.unit}
+	switch req.Endian {
+	case "", "little":
+	case "big":
+		format.order = binary.BigEndian
+	default:
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "endian must be little or big")
+	}
+	if req.Align == 0 {
+		req.Align = 1
+	}
+	if req.Align < 0 {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "align must be positive")
+	}
+
+	if req.From == "" {
+		req.From = defaultTimestampScanFrom
+	}
+	if req.To == "" {
+		req.To = defaultTimestampScanTo
+	}
+	from, err := parseTimestamp(req.From)
+	if err != nil {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "from: "+err.Error())
+	}
+	to, err := parseTimestamp(req.To)
+	if err != nil {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "to: "+err.Error())
+	}
+	if to.Before(from) {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "to is before from")
+	}
+
+	var file models.File
+	if err := sh.files.load(sh.db.GormDB, &file, req.FileID); err != nil {
+		return apiError(c, http.StatusNotFound, ErrCodeFileNotFound, "file not found")
+	}
+
+	matches, truncated := scanTimestamps(file.Data, format, from, to, req.Align)
+	return c.JSON(http.StatusOK, TimestampScanResponse{Matches: matches, Count: len(matches), Truncated: truncated})
+}
+
+// scanTimestamps decodes a field at every aligned offset and keeps those
+// falling between from and to
+func scanTimestamps(data []byte, format timestampFormat, from, to time.Time, align int) ([]TimestampMatch, bool) {
+	layout := time.RFC3339
+	if format.unit == unitMillis || format.unit == unitFiletime {
+		layout = "2006-01-02T15:04:05.000Z07:00"
+	}
+
+	matches := []TimestampMatch{}
+	for i := 0; i+format.size <= len(data); i += align {
+		v := format.read(data[i:])
+		if !format.valid(v) {
+			continue
+		}
+		t := format.toTime(v)
+		if t.Before(from) || t.After(to) {
+			continue
+		}
+		if len(matches) == maxTimestampMatches {
+			return matches, true
+		}
+		matches = append(matches, TimestampMatch{Offset: i, Raw: v, Time: t.Format(layout)})
+	}
+	return matches, false
+}
+
+// valid reports whether a stored value is a well-formed timestamp. Only DOS
+// values can be malformed (month 13, minute 61, ...).
+func (f timestampFormat) valid(v int64) bool {
+	if f.unit != unitDOS {
+		return true
+	}
+	date, clock := int(v>>16), int(v&0xFFFF)
+	month, day := date>>5&0x0F, date&0x1F
+	return month >= 1 && month <= 12 && day >= 1 &&
+		clock>>11 < 24 && clock>>5&0x3F < 60 && clock&0x1F < 30
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"binary-annotator-pro/models"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// tagTypes are the values accepted for Tag.Type
+var tagTypes = map[string]bool{"manual": true, "yaml": true, "detected": true}
+
+// TagRequest is the body for creating or updating a tag. Nil fields are left
+// unchanged on update; offset, size and color are required on create.
+type TagRequest struct {
+	Name    *string `json:"name"`
+	Offset  *int64  `json:"offset"`
+	Size    *int64  `json:"size"`
+	Color   *string `json:"color"`
+	Type    *string `json:"type"`
+	Comment *string `json:"comment"`
+}
+
+// apply copies the set fields of the request onto tag
+func (r TagRequest) apply(tag *models.Tag) {
+	if r.Name != nil {
+		tag.Name = *r.Name
+	}
+	if r.Offset != nil {
+		tag.Offset = *r.Offset
+	}
+	if r.Size != nil {
+		tag.Size = *r.Size
+	}
+	if r.Color != nil {
+		tag.Color = *r.Color
+	}
+	if r.Type != nil {
+		tag.Type = *r.Type
+	}
+	if r.Comment != nil {
+		tag.Comment = *r.Comment
+	}
+}
+
+// validateTag checks a tag's range against the file size and its color/type
+func validateTag(tag models.Tag, fileSize int64) error {
+	if tag.Offset < 0 {
+		return fmt.Errorf("offset must be non-negative")
+	}
+	if tag.Size <= 0 {
+		return fmt.Errorf("size must be positive")
+	}
+	if tag.Offset+tag.Size > fileSize {
+		return fmt.Errorf("tag 0x%X+%d is outside the file (size %d)", tag.Offset, tag.Size, fileSize)
+	}
+	if !hexColorRe.MatchString(tag.Color) {
+		return fmt.Errorf("invalid hex color %q (expected #RGB or #RRGGBB)", tag.Color)
+	}
+	if !tagTypes[tag.Type] {
+		return fmt.Errorf("invalid tag type %q (expected manual, yaml or detected)", tag.Type)
+	}
+	return nil
+}
+
+// findAnnotatedFile loads the metadata (no BLOB) of the file named by the :id param
+func (h *Handler) findAnnotatedFile(c echo.Context) (models.File, int, error) {
+	var file models.File
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return file, http.StatusBadRequest, fmt.Errorf("invalid file id")
+	}
+	if err := h.db.GormDB.Select("id, name, size").First(&file, id).Error; err != nil {
+		return file, http.StatusNotFound, fmt.Errorf("file not found")
+	}
+	return file, 0, nil
+}
+
+// CreateTag adds a tag to a file
+func (h *Handler) CreateTag(c echo.Context) error {
+	file, status, err := h.findAnnotatedFile(c)
+	if err != nil {
+		return c.JSON(status, map[string]string{"error": err.Error()})
+	}
+
+	var req TagRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if req.Offset == nil || req.Size == nil || req.Color == nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "offset, size and color are required"})
+	}
+
+	tag := models.Tag{FileID: file.ID, Type: "manual"}
+	req.apply(&tag)
+	if err := validateTag(tag, file.Size); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := h.db.GormDB.Create(&tag).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to create tag"})
+	}
+	return c.JSON(http.StatusCreated, tag)
+}
+
+// ListTags returns a file's tags ordered by offset, optionally filtered by ?type=
+func (h *Handler) ListTags(c echo.Context) error {
+	file, status, err := h.findAnnotatedFile(c)
+	if err != nil {
+		return c.JSON(status, map[string]string{"error": err.Error()})
+	}
+
+	query := h.db.GormDB.Where("file_id = ?", file.ID)
+	if t := c.QueryParam("type"); t != "" {
+		if !tagTypes[t] {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid tag type"})
+		}
+		query = query.Where("type = ?", t)
+	}
+
+	tags := []models.Tag{}
+	if err := query.Order("offset, id").Find(&tags).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, tags)
+}
+
+// UpdateTag changes the fields present in the body of a file's tag
+func (h *Handler) UpdateTag(c echo.Context) error {
+	file, status, err := h.findAnnotatedFile(c)
+	if err != nil {
+		return c.JSON(status, map[string]string{"error": err.Error()})
+	}
+
+	var tag models.Tag
+	if err := h.db.GormDB.Where("id = ? AND file_id = ?", c.Param("tagId"), file.ID).First(&tag).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "tag not found"})
+	}
+
+	var req TagRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	req.apply(&tag)
+	if err := validateTag(tag, file.Size); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := h.db.GormDB.Save(&tag).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to update tag"})
+	}
+	return c.JSON(http.StatusOK, tag)
+}
+
+// DeleteTag removes a tag from a file
+func (h *Handler) DeleteTag(c echo.Context) error {
+	file, status, err := h.findAnnotatedFile(c)
+	if err != nil {
+		return c.JSON(status, map[string]string{"error": err.Error()})
+	}
+
+	res := h.db.GormDB.Where("id = ? AND file_id = ?", c.Param("tagId"), file.ID).Delete(&models.Tag{})
+	if res.Error != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": res.Error.Error()})
+	}
+	if res.RowsAffected == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "tag not found"})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "tag deleted"})
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"binary-annotator-pro/models"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// tagContext builds a context for the /files/:id/tags routes
+func tagContext(method string, fileID uint, tagID uint, query string, body interface{}) (echo.Context, *httptest.ResponseRecorder) {
+	target := fmt.Sprintf("/files/%d/tags%s", fileID, query)
+	c, rec := newJSONContext(method, target, body)
+	if tagID != 0 {
+		c.SetParamNames("id", "tagId")
+		c.SetParamValues(fmt.Sprint(fileID), fmt.Sprint(tagID))
+	} else {
+		c.SetParamNames("id")
+		c.SetParamValues(fmt.Sprint(fileID))
+	}
+	return c, rec
+}
+
+// TestTagCRUD walks a tag through create, list, update and delete
+func TestTagCRUD(t *testing.T) {
+	h := newTestHandler(t)
+	file := createTestFile(t, h, "ecg.bin", make([]byte, 100))
+
+	c, rec := tagContext(http.MethodPost, file.ID, 0, "", map[string]interface{}{
+		"name": "header", "offset": 0, "size": 16, "color": "#FF6B6B",
+	})
+	h.CreateTag(c)
+	var created models.Tag
+	decodeJSON(t, rec, http.StatusCreated, &created)
+	if created.ID == 0 || created.Type != "manual" || created.FileID != file.ID {
+		t.Fatalf("created = %+v, want manual tag on file %d", created, file.ID)
+	}
+
+	c, rec = tagContext(http.MethodPost, file.ID, 0, "", map[string]interface{}{
+		"name": "sync", "offset": 50, "size": 2, "color": "#4ECDC4", "type": "detected",
+	})
+	h.CreateTag(c)
+	decodeJSON(t, rec, http.StatusCreated, nil)
+
+	c, rec = tagContext(http.MethodGet, file.ID, 0, "", nil)
+	h.ListTags(c)
+	var tags []models.Tag
+	decodeJSON(t, rec, http.StatusOK, &tags)
+	if len(tags) != 2 || tags[0].Name != "header" || tags[1].Name != "sync" {
+		t.Fatalf("list = %+v, want header then sync", tags)
+	}
+
+	c, rec = tagContext(http.MethodGet, file.ID, 0, "?type=detected", nil)
+	h.ListTags(c)
+	decodeJSON(t, rec, http.StatusOK, &tags)
+	if len(tags) != 1 || tags[0].Name != "sync" {
+		t.Fatalf("list ?type=detected = %+v, want only sync", tags)
+	}
+
+	c, rec = tagContext(http.MethodPut, file.ID, created.ID, "", map[string]interface{}{
+		"size": 32, "comment": "patient block",
+	})
+	h.UpdateTag(c)
+	var updated models.Tag
+	decodeJSON(t, rec, http.StatusOK, &updated)
+	if updated.Size != 32 || updated.Comment != "patient block" || updated.Name != "header" || updated.Color != "#FF6B6B" {
+		t.Fatalf("updated = %+v, want size 32 and other fields kept", updated)
+	}
+
+	c, rec = tagContext(http.MethodDelete, file.ID, created.ID, "", nil)
+	h.DeleteTag(c)
+	decodeJSON(t, rec, http.StatusOK, nil)
+
+	c, rec = tagContext(http.MethodDelete, file.ID, created.ID, "", nil)
+	h.DeleteTag(c)
+	decodeJSON(t, rec, http.StatusNotFound, nil)
+
+	var count int64
+	h.db.GormDB.Model(&models.Tag{}).Where("file_id = ?", file.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("tags left = %d, want 1", count)
+	}
+}
+
+// TestTagValidation rejects out-of-bounds ranges, bad colors and bad types
+func TestTagValidation(t *testing.T) {
+	h := newTestHandler(t)
+	file := createTestFile(t, h, "ecg.bin", make([]byte, 100))
+
+	tests := []struct {
+		name string
+		body map[string]interface{}
+	}{
+		{"past end of file", map[string]interface{}{"offset": 96, "size": 8, "color": "#fff"}},
+		{"offset beyond file", map[string]interface{}{"offset": 200, "size": 1, "color": "#fff"}},
+		{"negative offset", map[string]interface{}{"offset": -1, "size": 1, "color": "#fff"}},
+		{"zero size", map[string]interface{}{"offset": 0, "size": 0, "color": "#fff"}},
+		{"bad color", map[string]interface{}{"offset": 0, "size": 1, "color": "red"}},
+		{"bad type", map[string]interface{}{"offset": 0, "size": 1, "color": "#fff", "type": "auto"}},
+		{"missing color", map[string]interface{}{"offset": 0, "size": 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, rec := tagContext(http.MethodPost, file.ID, 0, "", tt.body)
+			h.CreateTag(c)
+			decodeJSON(t, rec, http.StatusBadRequest, nil)
+		})
+	}
+
+	// Updates are checked against the file too
+	c, rec := tagContext(http.MethodPost, file.ID, 0, "", map[string]interface{}{"offset": 90, "size": 10, "color": "#fff"})
+	h.CreateTag(c)
+	var tag models.Tag
+	decodeJSON(t, rec, http.StatusCreated, &tag)
+
+	c, rec = tagContext(http.MethodPut, file.ID, tag.ID, "", map[string]interface{}{"size": 11})
+	h.UpdateTag(c)
+	decodeJSON(t, rec, http.StatusBadRequest, nil)
+
+	c, rec = tagContext(http.MethodPost, 9999, 0, "", map[string]interface{}{"offset": 0, "size": 1, "color": "#fff"})
+	h.CreateTag(c)
+	decodeJSON(t, rec, http.StatusNotFound, nil)
+}
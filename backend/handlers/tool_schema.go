@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"binary-annotator-pro/services"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// mcpToolSchemas maps tool names to the input schemas fetched with the tools
+func mcpToolSchemas(tools []services.Tool) map[string]map[string]interface{} {
+	schemas := make(map[string]map[string]interface{}, len(tools))
+	for _, tool := range tools {
+		schemas[tool.Function.Name] = tool.Function.Parameters
+	}
+	return schemas
+}
+
+// validateToolArguments checks arguments against the parts of a JSON schema
+// the model gets wrong most: required properties, property types and, when
+// additionalProperties is false, unknown properties. A nil schema accepts
+// anything. Every problem is reported so the model can fix them in one go.
+func validateToolArguments(schema map[string]interface{}, args map[string]interface{}) error {
+	if schema == nil {
+		return nil
+	}
+	properties, _ := schema["properties"].(map[string]interface{})
+
+	var problems []string
+	for _, name := range schemaStrings(schema["required"]) {
+		if _, ok := args[name]; !ok {
+			problems = append(problems, fmt.Sprintf("missing required argument %q", name))
+		}
+	}
+
+	names := make([]string, 0, len(args))
+	for name := range args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		prop, known := properties[name].(map[string]interface{})
+		if !known {
+			if extra, ok := schema["additionalProperties"].(bool); ok && !extra {
+				problems = append(problems, fmt.Sprintf("unknown argument %q", name))
+			}
+			continue
+		}
+		types := schemaStrings(prop["type"])
+		if len(types) > 0 && !matchesSchemaType(args[name], types) {
+			problems = append(problems, fmt.Sprintf("argument %q must be %s, got %s", name, strings.Join(types, " or "), jsonTypeName(args[name])))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid arguments: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// schemaStrings reads a schema keyword that is a string or a list of strings
+// ("type": "string", "required": ["a", "b"], ...)
+func schemaStrings(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// matchesSchemaType reports whether a decoded JSON value has one of the types
+func matchesSchemaType(v interface{}, types []string) bool {
+	for _, t := range types {
+		switch t {
+		case "string":
+			if _, ok := v.(string); ok {
+				return true
+			}
+		case "number":
+			if _, ok := jsonNumber(v); ok {
+				return true
+			}
+		case "integer":
+			if n, ok := jsonNumber(v); ok && n == math.Trunc(n) {
+				return true
+			}
+		case "boolean":
+			if _, ok := v.(bool); ok {
+				return true
+			}
+		case "object":
+			if _, ok := v.(map[string]interface{}); ok {
+				return true
+			}
+		case "array":
+			if _, ok := v.([]interface{}); ok {
+				return true
+			}
+		case "null":
+			if v == nil {
+				return true
+			}
+		default:
+			return true // a type we don't check
+		}
+	}
+	return false
+}
+
+// jsonNumber returns v as a float64 if it is a number
+func jsonNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// jsonTypeName names the JSON type of a decoded value for error messages
+func jsonTypeName(v interface{}) string {
+	if _, ok := jsonNumber(v); ok {
+		return "number"
+	}
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TransitionsResponse holds the byte-to-byte transition matrix of a region:
+// Counts[a][b] is the number of times byte b follows byte a. With
+// normalize=true, Probabilities[a][b] is P(b follows | a) instead, each row
+// with any transitions summing to 1.
+type TransitionsResponse struct {
+	FileID        uint        `json:"file_id"`
+	Offset        int         `json:"offset"`
+	Length        int         `json:"length"`
+	Total         int         `json:"total"` // transitions counted: length - 1
+	Counts        [][]int     `json:"counts,omitempty"`
+	Probabilities [][]float64 `json:"probabilities,omitempty"`
+	// EntropyRate is the entropy of the next byte given the current one, in
+	// bits: near 0 for repetitive data, ~4.5 for text, near 8 for compressed
+	// or encrypted data
+	EntropyRate float64 `json:"entropy_rate"`
+}
+
+// GetTransitions returns the 256x256 byte transition (first-order Markov)
+// matrix of offset..offset+length, a fingerprint of the kind of data there
+func (h *Handler) GetTransitions(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid file id")
+	}
+	offset, length := 0, 0
+	if o := c.QueryParam("offset"); o != "" {
+		if offset, err = strconv.Atoi(o); err != nil {
+			return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid offset")
+		}
+	}
+	if l := c.QueryParam("length"); l != "" {
+		if length, err = strconv.Atoi(l); err != nil {
+			return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid length")
+		}
+	}
+	normalize := c.QueryParam("normalize") == "true"
+
+	data, status, apiErr := h.loadDecodeRegion(uint(id), offset, length)
+	if apiErr != nil {
+		return c.JSON(status, apiErr)
+	}
+
+	counts, total := byteTransitions(data)
+	resp := TransitionsResponse{
+		FileID:      uint(id),
+		Offset:      offset,
+		Length:      len(data),
+		Total:       total,
+		EntropyRate: transitionEntropyRate(counts, total),
+	}
+	if normalize {
+		resp.Probabilities = transitionProbabilities(counts)
+	} else {
+		resp.Counts = make([][]int, 256)
+		for a := range counts {
+			resp.Counts[a] = counts[a][:]
+		}
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// byteTransitions counts the pairs of consecutive bytes of data
+func byteTransitions(data []byte) (*[256][256]int, int) {
+	var counts [256][256]int
+	for i := 1; i < len(data); i++ {
+		counts[data[i-1]][data[i]]++
+	}
+	total := len(data) - 1
+	if total < 0 {
+		total = 0
+	}
+	return &counts, total
+}
+
+// transitionProbabilities divides each row by its sum
+func transitionProbabilities(counts *[256][256]int) [][]float64 {
+	probs := make([][]float64, 256)
+	for a := range counts {
+		probs[a] = make([]float64, 256)
+		rowTotal := 0
+		for _, n := range counts[a] {
+			rowTotal += n
+		}
+		if rowTotal == 0 {
+			continue
+		}
+		for b, n := range counts[a] {
+			probs[a][b] = float64(n) / float64(rowTotal)
+		}
+	}
+	return probs
+}
+
+// transitionEntropyRate returns H(next | current) = -sum p(a,b) log2 p(b|a)
+func transitionEntropyRate(counts *[256][256]int, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	h := 0.0
+	for a := range counts {
+		rowTotal := 0
+		for _, n := range counts[a] {
+			rowTotal += n
+		}
+		for _, n := range counts[a] {
+			if n == 0 {
+				continue
+			}
+			h -= float64(n) / float64(total) * math.Log2(float64(n)/float64(rowTotal))
+		}
+	}
+	return h
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// TestGetTransitionsText counts the transitions of a run of ASCII letters
+// inside binary data: all of them fall in the printable range
+func TestGetTransitionsText(t *testing.T) {
+	h := newTestHandler(t)
+	text := []byte("TheQuickBrownFoxJumpsOverTheLazyDogAndKeepsOnRunningAcrossTheField")
+	data := append(append([]byte{0x00, 0xff, 0x10, 0x80}, text...), 0x00, 0x01)
+	file := createTestFile(t, h, "text.bin", data)
+
+	target := fmt.Sprintf("/files/%d/transitions?offset=4&length=%d", file.ID, len(text))
+	c, rec := newJSONContext(http.MethodGet, target, nil)
+	c.SetParamNames("id")
+	c.SetParamValues(fmt.Sprint(file.ID))
+	if err := h.GetTransitions(c); err != nil {
+		t.Fatalf("GetTransitions() error = %v", err)
+	}
+	var resp TransitionsResponse
+	decodeJSON(t, rec, http.StatusOK, &resp)
+
+	if resp.Total != len(text)-1 {
+		t.Fatalf("total = %d, want %d", resp.Total, len(text)-1)
+	}
+	printable := 0
+	for a, row := range resp.Counts {
+		for b, n := range row {
+			if n == 0 {
+				continue
+			}
+			if a < 0x20 || a > 0x7e || b < 0x20 || b > 0x7e {
+				t.Errorf("transition %#02x -> %#02x outside the printable range", a, b)
+			}
+			printable += n
+		}
+	}
+	if printable != resp.Total {
+		t.Errorf("printable transitions = %d, want %d", printable, resp.Total)
+	}
+	if resp.EntropyRate <= 0 || resp.EntropyRate >= 8 {
+		t.Errorf("entropy rate = %v, want between 0 and 8", resp.EntropyRate)
+	}
+
+	c, rec = newJSONContext(http.MethodGet, target+"&normalize=true", nil)
+	c.SetParamNames("id")
+	c.SetParamValues(fmt.Sprint(file.ID))
+	if err := h.GetTransitions(c); err != nil {
+		t.Fatalf("GetTransitions() error = %v", err)
+	}
+	resp = TransitionsResponse{}
+	decodeJSON(t, rec, http.StatusOK, &resp)
+	sum := 0.0
+	for _, p := range resp.Probabilities['T'] {
+		sum += p
+	}
+	if resp.Counts != nil || sum < 0.999 || sum > 1.001 {
+		t.Errorf("normalized row 'T' sums to %v (counts %v), want 1 and no counts", sum, resp.Counts != nil)
+	}
+}
@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"binary-annotator-pro/middleware"
+	"binary-annotator-pro/models"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// UploadInitRequest starts a chunked upload. Size is optional; when set,
+// chunks past it are rejected and finalize requires all of it.
+type UploadInitRequest struct {
+	Name   string `json:"name"`
+	Vendor string `json:"vendor,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+}
+
+// UploadFinalizeRequest optionally renames the upload, e.g. after a 409 on
+// the name given at init, and picks the duplicate content policy
+type UploadFinalizeRequest struct {
+	Name        string `json:"name,omitempty"`
+	OnDuplicate string `json:"on_duplicate,omitempty"` // "reject" or "allow"
+}
+
+const (
+	// defaultUploadTTL is how long an unfinished upload is kept after its
+	// last chunk, unless UPLOAD_TTL (a Go duration such as "24h") says otherwise
+	defaultUploadTTL = 24 * time.Hour
+
+	// uploadSweepInterval is how often abandoned uploads are looked for
+	uploadSweepInterval = time.Hour
+)
+
+// uploadDir is where chunked uploads are kept until finalized, UPLOAD_DIR or
+// a directory under the system temp dir
+func uploadDir() string {
+	if dir := os.Getenv("UPLOAD_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), "binary-annotator-uploads")
+}
+
+// InitUpload starts a chunked upload, for captures too large to send in one
+// request over an unreliable connection. Chunks are then sent with
+// PUT /upload/:id?offset= and assembled by POST /upload/:id/finalize.
+func (h *Handler) InitUpload(c echo.Context) error {
+	var req UploadInitRequest
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid request")
+	}
+	if req.Name == "" {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "name is required")
+	}
+	if req.Size < 0 {
+		return apiError(c, http.StatusBadRequest, ErrCodeOutOfRange, "size must not be negative")
+	}
+	// Fail now rather than after the whole file was sent
+	var count int64
+	h.db.GormDB.Model(&models.File{}).Where("name = ?", req.Name).Count(&count)
+	if count > 0 {
+		return apiError(c, http.StatusConflict, ErrCodeConflict, "file with that name already exists")
+	}
+
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return apiError(c, http.StatusInternalServerError, ErrCodeInternal, "failed to create upload id")
+	}
+	upload := models.PartialUpload{ID: hex.EncodeToString(token), Name: req.Name, Vendor: req.Vendor, Size: req.Size}
+
+	dir := uploadDir()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return apiError(c, http.StatusInternalServerError, ErrCodeInternal, "failed to create upload directory")
+	}
+	upload.Path = filepath.Join(dir, upload.ID+".part")
+	if err := os.WriteFile(upload.Path, nil, 0o644); err != nil {
+		return apiError(c, http.StatusInternalServerError, ErrCodeInternal, "failed to create upload file")
+	}
+	if err := h.db.GormDB.Create(&upload).Error; err != nil {
+		os.Remove(upload.Path)
+		return apiError(c, http.StatusInternalServerError, ErrCodeInternal, "failed to save upload")
+	}
+	return c.JSON(http.StatusCreated, upload)
+}
+
+// GetUpload reports how much of an upload was received, so a client that
+// lost its connection knows the offset to resume from
+func (h *Handler) GetUpload(c echo.Context) error {
+	upload, err := h.findUpload(c.Param("id"))
+	if err != nil {
+		return apiError(c, http.StatusNotFound, ErrCodeNotFound, "upload not found")
+	}
+	return c.JSON(http.StatusOK, upload)
+}
+
+// PutUploadChunk appends the raw request body to an upload. offset must equal
+// the bytes received so far; otherwise nothing is written and the 409 carries
+// the offset to resume from. A chunk cut short by a dropped connection is
+// discarded, so the client resends it whole.
+func (h *Handler) PutUploadChunk(c echo.Context) error {
+	offset, err := strconv.ParseInt(c.QueryParam("offset"), 10, 64)
+	if err != nil || offset < 0 {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "offset must be a non-negative integer")
+	}
+
+	defer h.uploadLocks.lock(c.Param("id"))()
+
+	upload, err := h.findUpload(c.Param("id"))
+	if err != nil {
+		return apiError(c, http.StatusNotFound, ErrCodeNotFound, "upload not found")
+	}
+	if offset != upload.Received {
+		return apiErrorDetails(c, http.StatusConflict, ErrCodeConflict,
+			fmt.Sprintf("offset %d does not match the %d bytes received", offset, upload.Received),
+			map[string]any{"received": upload.Received})
+	}
+
+	f, err := os.OpenFile(upload.Path, os.O_WRONLY, 0o644)
+	if err != nil {
+		return apiError(c, http.StatusInternalServerError, ErrCodeInternal, "failed to open upload file")
+	}
+	defer f.Close()
+	// Drop anything past Received left by an earlier failed chunk
+	if err := f.Truncate(upload.Received); err != nil {
+		return apiError(c, http.StatusInternalServerError, ErrCodeInternal, "failed to write upload file")
+	}
+	if _, err := f.Seek(upload.Received, io.SeekStart); err != nil {
+		return apiError(c, http.StatusInternalServerError, ErrCodeInternal, "failed to write upload file")
+	}
+
+	body := io.Reader(c.Request().Body)
+	if upload.Size > 0 {
+		body = io.LimitReader(body, upload.Size-upload.Received+1)
+	}
+	n, err := io.Copy(f, body)
+	if tooLarge := (*http.MaxBytesError)(nil); errors.As(err, &tooLarge) {
+		f.Truncate(upload.Received)
+		return middleware.TooLargeError(c, "chunk", tooLarge.Limit)
+	}
+	if err != nil {
+		return apiErrorDetails(c, http.StatusBadRequest, ErrCodeInvalidRequest, "chunk was not fully received, resend it",
+			map[string]any{"received": upload.Received})
+	}
+	if upload.Size > 0 && upload.Received+n > upload.Size {
+		f.Truncate(upload.Received)
+		return apiErrorDetails(c, http.StatusBadRequest, ErrCodeOutOfRange,
+			fmt.Sprintf("chunk goes past the declared size of %d bytes", upload.Size),
+			map[string]any{"received": upload.Received})
+	}
+
+	upload.Received += n
+	if err := h.db.GormDB.Model(&upload).Update("received", upload.Received).Error; err != nil {
+		f.Truncate(upload.Received - n)
+		return apiError(c, http.StatusInternalServerError, ErrCodeInternal, "failed to save upload")
+	}
+	return c.JSON(http.StatusOK, upload)
+}
+
+// FinalizeUpload creates the File from the received bytes, with the same
+// duplicate checks as /upload/binary. The upload is kept when that fails, so
+// it can be finalized again, for example under another name.
+func (h *Handler) FinalizeUpload(c echo.Context) error {
+	var req UploadFinalizeRequest
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid request")
+	}
+
+	defer h.uploadLocks.lock(c.Param("id"))()
+
+	upload, err := h.findUpload(c.Param("id"))
+	if err != nil {
+		return apiError(c, http.StatusNotFound, ErrCodeNotFound, "upload not found")
+	}
+	if upload.Size > 0 && upload.Received != upload.Size {
+		return apiErrorDetails(c, http.StatusConflict, ErrCodeConflict,
+			fmt.Sprintf("upload is incomplete: %d of %d bytes received", upload.Received, upload.Size),
+			map[string]any{"received": upload.Received, "size": upload.Size})
+	}
+	if req.Name != "" {
+		upload.Name = req.Name
+	}
+
+	data, err := os.ReadFile(upload.Path)
+	if err != nil {
+		return apiError(c, http.StatusInternalServerError, ErrCodeInternal, "failed to read upload file")
+	}
+	data = data[:min(int64(len(data)), upload.Received)]
+
+	if err := h.storeUploadedFile(c, upload.Name, upload.Vendor, req.OnDuplicate, data); err != nil {
+		return err
+	}
+	if c.Response().Status == http.StatusCreated {
+		h.removeUpload(upload)
+	}
+	return nil
+}
+
+// AbortUpload discards a chunked upload
+func (h *Handler) AbortUpload(c echo.Context) error {
+	defer h.uploadLocks.lock(c.Param("id"))()
+
+	upload, err := h.findUpload(c.Param("id"))
+	if err != nil {
+		return apiError(c, http.StatusNotFound, ErrCodeNotFound, "upload not found")
+	}
+	h.removeUpload(upload)
+	return c.NoContent(http.StatusNoContent)
+}
+
+// uploadLocks holds a mutex per upload ID, so a slow chunk only holds up
+// its own upload. A mutex is dropped once nobody holds or waits for it.
+type uploadLocks struct {
+	mu    sync.Mutex
+	locks map[string]*uploadLock
+}
+
+type uploadLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock locks the upload id and returns the function unlocking it
+func (l *uploadLocks) lock(id string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = map[string]*uploadLock{}
+	}
+	ul := l.locks[id]
+	if ul == nil {
+		ul = &uploadLock{}
+		l.locks[id] = ul
+	}
+	ul.refs++
+	l.mu.Unlock()
+
+	ul.Lock()
+	return func() {
+		ul.Unlock()
+		l.mu.Lock()
+		if ul.refs--; ul.refs == 0 {
+			delete(l.locks, id)
+		}
+		l.mu.Unlock()
+	}
+}
+
+func (h *Handler) findUpload(id string) (models.PartialUpload, error) {
+	var upload models.PartialUpload
+	err := h.db.GormDB.Where("id = ?", id).First(&upload).Error
+	return upload, err
+}
+
+// removeUpload deletes an upload and its bytes on disk
+func (h *Handler) removeUpload(upload models.PartialUpload) {
+	h.db.GormDB.Delete(&upload)
+	os.Remove(upload.Path)
+}
+
+// uploadTTL reads UPLOAD_TTL, falling back to defaultUploadTTL
+func uploadTTL() time.Duration {
+	v := os.Getenv("UPLOAD_TTL")
+	if v == "" {
+		return defaultUploadTTL
+	}
+	ttl, err := time.ParseDuration(v)
+	if err != nil || ttl <= 0 {
+		log.Printf("Ignoring invalid UPLOAD_TTL %q", v)
+		return defaultUploadTTL
+	}
+	return ttl
+}
+
+// StartUploadSweeper discards abandoned chunked uploads every
+// uploadSweepInterval in the background until the returned stop function is
+// called
+func (h *Handler) StartUploadSweeper() (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(uploadSweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				n, err := h.expireUploads(time.Now(), uploadTTL())
+				if err != nil {
+					log.Printf("Upload cleanup failed: %v", err)
+				} else if n > 0 {
+					log.Printf("Upload cleanup: discarded %d abandoned uploads", n)
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// expireUploads removes the uploads that received nothing for longer than
+// ttl, with their .part files, and returns how many it removed
+func (h *Handler) expireUploads(now time.Time, ttl time.Duration) (int, error) {
+	cutoff := now.Add(-ttl)
+	var stale []models.PartialUpload
+	if err := h.db.GormDB.Where("updated_at < ?", cutoff).Find(&stale).Error; err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, upload := range stale {
+		unlock := h.uploadLocks.lock(upload.ID)
+		// A chunk may have arrived since the query
+		if current, err := h.findUpload(upload.ID); err == nil && current.UpdatedAt.Before(cutoff) {
+			h.removeUpload(current)
+			removed++
+		}
+		unlock()
+	}
+	return removed, nil
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"binary-annotator-pro/models"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TestChunkedUpload sends a file in three chunks with the connection dropping
+// halfway through the second one, resumes from the offset the server reports
+// and checks the finalized File holds exactly the original bytes
+func TestChunkedUpload(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("UPLOAD_DIR", dir)
+	h := newTestHandler(t)
+
+	data := make([]byte, 3000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	chunks := [][]byte{data[:1000], data[1000:2000], data[2000:]}
+
+	c, rec := newJSONContext(http.MethodPost, "/upload/init", UploadInitRequest{Name: "capture.bin", Size: int64(len(data))})
+	if err := h.InitUpload(c); err != nil {
+		t.Fatalf("InitUpload() error = %v", err)
+	}
+	var upload models.PartialUpload
+	decodeJSON(t, rec, http.StatusCreated, &upload)
+	if upload.ID == "" {
+		t.Fatal("no upload id")
+	}
+
+	put := func(offset int, body io.Reader, wantStatus int) models.PartialUpload {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPut, "/upload/"+upload.ID+"?offset="+strconv.Itoa(offset), body)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(upload.ID)
+		if err := h.PutUploadChunk(c); err != nil {
+			t.Fatalf("PutUploadChunk() error = %v", err)
+		}
+		var got models.PartialUpload
+		if wantStatus != http.StatusOK {
+			decodeJSON(t, rec, wantStatus, nil)
+			got, _ = h.findUpload(upload.ID)
+			return got
+		}
+		decodeJSON(t, rec, wantStatus, &got)
+		return got
+	}
+
+	put(0, bytes.NewReader(chunks[0]), http.StatusOK)
+
+	// The connection drops after half of the second chunk
+	dropped := io.MultiReader(bytes.NewReader(chunks[1][:500]), &failingReader{})
+	if got := put(1000, dropped, http.StatusBadRequest); got.Received != 1000 {
+		t.Fatalf("received after dropped chunk = %d, want 1000", got.Received)
+	}
+
+	// The client asks where to resume
+	c, rec = newJSONContext(http.MethodGet, "/upload/"+upload.ID, nil)
+	c.SetParamNames("id")
+	c.SetParamValues(upload.ID)
+	if err := h.GetUpload(c); err != nil {
+		t.Fatalf("GetUpload() error = %v", err)
+	}
+	var status models.PartialUpload
+	decodeJSON(t, rec, http.StatusOK, &status)
+	if status.Received != 1000 {
+		t.Fatalf("resume offset = %d, want 1000", status.Received)
+	}
+
+	// A chunk at the wrong offset is refused
+	put(2000, bytes.NewReader(chunks[2]), http.StatusConflict)
+
+	put(1000, bytes.NewReader(chunks[1]), http.StatusOK)
+	if got := put(2000, bytes.NewReader(chunks[2]), http.StatusOK); got.Received != int64(len(data)) {
+		t.Fatalf("received = %d, want %d", got.Received, len(data))
+	}
+
+	c, rec = newJSONContext(http.MethodPost, "/upload/"+upload.ID+"/finalize", nil)
+	c.SetParamNames("id")
+	c.SetParamValues(upload.ID)
+	if err := h.FinalizeUpload(c); err != nil {
+		t.Fatalf("FinalizeUpload() error = %v", err)
+	}
+	var created struct {
+		ID   uint   `json:"id"`
+		Hash string `json:"hash"`
+	}
+	decodeJSON(t, rec, http.StatusCreated, &created)
+
+	var file models.File
+	if err := h.db.GormDB.First(&file, created.ID).Error; err != nil {
+		t.Fatalf("load file: %v", err)
+	}
+	if file.Name != "capture.bin" || !bytes.Equal(file.Data, data) {
+		t.Fatalf("file %q holds %d bytes, want capture.bin with the original %d bytes", file.Name, len(file.Data), len(data))
+	}
+	if created.Hash != contentHash(data) {
+		t.Errorf("hash = %s, want %s", created.Hash, contentHash(data))
+	}
+
+	// The partial upload is gone once finalized
+	if _, err := h.findUpload(upload.ID); err == nil {
+		t.Error("upload still tracked after finalize")
+	}
+	if left, _ := os.ReadDir(dir); len(left) != 0 {
+		t.Errorf("%d upload files left on disk after finalize", len(left))
+	}
+}
+
+// TestChunkedUploadSlowClient checks a chunk still being received only holds
+// up its own upload: another upload can take chunks, be finalized and be
+// aborted meanwhile
+func TestChunkedUploadSlowClient(t *testing.T) {
+	t.Setenv("UPLOAD_DIR", t.TempDir())
+	h := newTestHandler(t)
+
+	initUpload := func(name string) string {
+		t.Helper()
+		c, rec := newJSONContext(http.MethodPost, "/upload/init", UploadInitRequest{Name: name})
+		if err := h.InitUpload(c); err != nil {
+			t.Fatalf("InitUpload() error = %v", err)
+		}
+		var upload models.PartialUpload
+		decodeJSON(t, rec, http.StatusCreated, &upload)
+		return upload.ID
+	}
+	call := func(handler echo.HandlerFunc, method, id string, body io.Reader) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/upload/"+id+"?offset=0", body)
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(id)
+		handler(c)
+		return rec
+	}
+
+	// The slow client sends part of its chunk, then stalls
+	slow := initUpload("slow.bin")
+	body, w := io.Pipe()
+	slowDone := make(chan int)
+	go func() { slowDone <- call(h.PutUploadChunk, http.MethodPut, slow, body).Code }()
+	w.Write([]byte("first half"))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fast := initUpload("fast.bin")
+		if rec := call(h.PutUploadChunk, http.MethodPut, fast, bytes.NewReader([]byte("all of it"))); rec.Code != http.StatusOK {
+			t.Errorf("chunk of another upload: status = %d (%s)", rec.Code, rec.Body)
+		}
+		if rec := call(h.FinalizeUpload, http.MethodPost, fast, nil); rec.Code != http.StatusCreated {
+			t.Errorf("finalize of another upload: status = %d (%s)", rec.Code, rec.Body)
+		}
+		if rec := call(h.AbortUpload, http.MethodDelete, initUpload("other.bin"), nil); rec.Code != http.StatusNoContent {
+			t.Errorf("abort of another upload: status = %d (%s)", rec.Code, rec.Body)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("other uploads blocked behind the slow chunk")
+	}
+
+	w.Write([]byte(", second half"))
+	w.Close()
+	if code := <-slowDone; code != http.StatusOK {
+		t.Errorf("slow chunk: status = %d", code)
+	}
+	if upload, _ := h.findUpload(slow); upload.Received != int64(len("first half, second half")) {
+		t.Errorf("slow upload received %d bytes", upload.Received)
+	}
+}
+
+// failingReader simulates a connection that drops mid-request
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, errors.New("connection reset") }
+
+// TestExpireAbandonedUploads discards uploads that received nothing for
+// longer than the TTL, with their .part files, and keeps active ones
+func TestExpireAbandonedUploads(t *testing.T) {
+	t.Setenv("UPLOAD_DIR", t.TempDir())
+	h := newTestHandler(t)
+
+	start := func(name string) models.PartialUpload {
+		t.Helper()
+		c, rec := newJSONContext(http.MethodPost, "/upload/init", UploadInitRequest{Name: name})
+		if err := h.InitUpload(c); err != nil {
+			t.Fatalf("InitUpload() error = %v", err)
+		}
+		var created models.PartialUpload
+		decodeJSON(t, rec, http.StatusCreated, &created)
+		upload, err := h.findUpload(created.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return upload
+	}
+	abandoned := start("abandoned.bin")
+	active := start("active.bin")
+
+	now := time.Now()
+	h.db.GormDB.Model(&abandoned).UpdateColumn("updated_at", now.Add(-25*time.Hour))
+	h.db.GormDB.Model(&active).UpdateColumn("updated_at", now.Add(-time.Hour))
+
+	n, err := h.expireUploads(now, 24*time.Hour)
+	if err != nil || n != 1 {
+		t.Fatalf("expireUploads() = %d, %v, want 1 upload", n, err)
+	}
+	if _, err := h.findUpload(abandoned.ID); err == nil {
+		t.Error("abandoned upload still exists")
+	}
+	if _, err := os.Stat(abandoned.Path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("abandoned .part file: stat error = %v, want it removed", err)
+	}
+	if _, err := h.findUpload(active.ID); err != nil {
+		t.Errorf("active upload removed: %v", err)
+	}
+	if _, err := os.Stat(active.Path); err != nil {
+		t.Errorf("active .part file: %v", err)
+	}
+}
@@ -37,6 +37,8 @@ type AIWSRequest struct {
 	UserID       string                 `json:"user_id"`
 	Prompt       string                 `json:"prompt"`
 	FileAnalysis *services.FileAnalysis `json:"file_analysis,omitempty"`
+	Temperature  *float64               `json:"temperature,omitempty"`
+	MaxTokens    int                    `json:"max_tokens,omitempty"`
 }
 
 // HandleAI handles WebSocket connections for AI requests
@@ -82,6 +84,13 @@ func (wsh *WebSocketHandler) HandleAI(c echo.Context) error {
 			})
 			continue
 		}
+		if err := decryptAIKeys(&settings); err != nil {
+			ws.WriteJSON(&services.AIResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			continue
+		}
 
 		// Create AI service with user's settings
 		aiService := &services.AIService{
@@ -118,8 +127,10 @@ func (wsh *WebSocketHandler) HandleAI(c echo.Context) error {
 			response, err = aiService.GenerateYAMLTags(provider, req.FileAnalysis)
 		} else {
 			response, err = aiService.Generate(services.AIRequest{
-				Provider: provider,
-				Prompt:   req.Prompt,
+				Provider:    provider,
+				Prompt:      req.Prompt,
+				Temperature: req.Temperature,
+				MaxTokens:   req.MaxTokens,
 			})
 		}
 
@@ -0,0 +1,472 @@
+package handlers
+
+import (
+	"binary-annotator-pro/models"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// YamlValidationError describes one problem found in a YAML config
+type YamlValidationError struct {
+	Path    string `json:"path"`           // e.g. "tags.file_header.offset"
+	Line    int    `json:"line,omitempty"` // 1-based line hint, 0 if unknown
+	Message string `json:"message"`
+}
+
+// YamlValidationResult is returned by POST /yaml/validate
+type YamlValidationResult struct {
+	Valid  bool                  `json:"valid"`
+	Errors []YamlValidationError `json:"errors"`
+}
+
+// supportedSearchTypes mirrors the types handled by SearchHandler.Search
+var supportedSearchTypes = map[string]bool{
+	"hex": true, "string-ascii": true, "string-utf8": true,
+	"string-utf16le": true, "string-utf16be": true,
+	"int8": true, "uint8": true,
+	"int16le": true, "int16be": true, "uint16le": true, "uint16be": true,
+	"int32le": true, "int32be": true, "uint32le": true, "uint32be": true,
+	"float32le": true, "float32be": true, "float64le": true, "float64be": true,
+	"timestamp-unix32": true, "timestamp-unix64": true,
+	"timestamp-unix32be": true, "timestamp-unix64be": true,
+	"timestamp-unixms64": true, "timestamp-unixms64be": true,
+	"timestamp-filetime64le": true, "timestamp-filetime64be": true, "timestamp-dos": true,
+	"bcd": true, "varint": true,
+}
+
+var (
+	hexColorRe    = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+	yamlErrLineRe = regexp.MustCompile(`line (\d+)`)
+)
+
+// ValidateYaml checks a YAML config against the search/tags/diff schema used by the viewer.
+// Body: JSON {"yaml": "..."} or the raw YAML text.
+func (h *Handler) ValidateYaml(c echo.Context) error {
+	text, err := readYamlBody(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, validateYamlConfig(text))
+}
+
+// readYamlBody accepts either a JSON body with a "yaml" field or raw YAML text
+func readYamlBody(c echo.Context) (string, error) {
+	if strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), echo.MIMEApplicationJSON) {
+		var req struct {
+			Yaml string `json:"yaml"`
+		}
+		if err := c.Bind(&req); err != nil {
+			return "", fmt.Errorf("invalid request body")
+		}
+		if req.Yaml == "" {
+			return "", fmt.Errorf("yaml content required")
+		}
+		return req.Yaml, nil
+	}
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil || len(body) == 0 {
+		return "", fmt.Errorf("yaml content required")
+	}
+	return string(body), nil
+}
+
+// shouldValidateYaml reports whether the caller asked for ?validate=true
+func shouldValidateYaml(c echo.Context) bool {
+	v, _ := strconv.ParseBool(c.QueryParam("validate"))
+	return v
+}
+
+// validateYamlConfig parses text and validates its structure
+func validateYamlConfig(text string) YamlValidationResult {
+	v := &yamlValidator{}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(text), &doc); err != nil {
+		line := 0
+		if m := yamlErrLineRe.FindStringSubmatch(err.Error()); m != nil {
+			line, _ = strconv.Atoi(m[1])
+		}
+		v.add("", line, strings.TrimPrefix(err.Error(), "yaml: "))
+		return v.result()
+	}
+
+	if len(doc.Content) == 0 {
+		v.add("", 0, "empty document")
+		return v.result()
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		v.add("", root.Line, "top level must be a mapping with search/tags/diff sections")
+		return v.result()
+	}
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, section := root.Content[i], root.Content[i+1]
+		switch key.Value {
+		case "search":
+			v.eachEntry(key.Value, section, v.checkSearchRule)
+		case "tags":
+			v.eachEntry(key.Value, section, v.checkTagRule)
+		case "diff":
+			v.eachEntry(key.Value, section, v.checkDiffRule)
+		default:
+			v.add(key.Value, key.Line, "unknown section (expected search, tags or diff)")
+		}
+	}
+
+	return v.result()
+}
+
+type yamlValidator struct {
+	errors []YamlValidationError
+}
+
+func (v *yamlValidator) add(path string, line int, msg string) {
+	v.errors = append(v.errors, YamlValidationError{Path: path, Line: line, Message: msg})
+}
+
+func (v *yamlValidator) result() YamlValidationResult {
+	if v.errors == nil {
+		v.errors = []YamlValidationError{}
+	}
+	return YamlValidationResult{Valid: len(v.errors) == 0, Errors: v.errors}
+}
+
+// eachEntry walks a name -> rule mapping, checking names are unique
+func (v *yamlValidator) eachEntry(section string, node *yaml.Node, check func(path string, rule map[string]*yaml.Node, node *yaml.Node)) {
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return // empty section
+	}
+	if node.Kind != yaml.MappingNode {
+		v.add(section, node.Line, "must be a mapping of name to rule")
+		return
+	}
+
+	seen := map[string]int{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		name, rule := node.Content[i], node.Content[i+1]
+		path := section + "." + name.Value
+
+		if first, dup := seen[name.Value]; dup {
+			v.add(path, name.Line, fmt.Sprintf("duplicate name (first defined on line %d)", first))
+			continue
+		}
+		seen[name.Value] = name.Line
+
+		if rule.Kind != yaml.MappingNode {
+			v.add(path, rule.Line, "must be a mapping")
+			continue
+		}
+		fields := map[string]*yaml.Node{}
+		for j := 0; j+1 < len(rule.Content); j += 2 {
+			fields[rule.Content[j].Value] = rule.Content[j+1]
+		}
+		check(path, fields, rule)
+	}
+}
+
+func (v *yamlValidator) checkSearchRule(path string, f map[string]*yaml.Node, node *yaml.Node) {
+	if value, ok := f["value"]; !ok {
+		v.add(path+".value", node.Line, "required")
+	} else if value.Kind != yaml.ScalarNode || value.Value == "" {
+		v.add(path+".value", value.Line, "must be a non-empty scalar")
+	}
+
+	v.checkColor(path, f, node)
+
+	if t, ok := f["type"]; ok && !supportedSearchTypes[t.Value] {
+		v.add(path+".type", t.Line, fmt.Sprintf("unsupported search type %q", t.Value))
+	}
+	for _, key := range []string{"start", "end"} {
+		if n, ok := f[key]; ok {
+			v.checkOffset(path+"."+key, n)
+		}
+	}
+	if r, ok := f["regex"]; ok && r.Tag != "!!bool" {
+		v.add(path+".regex", r.Line, "must be true or false")
+	}
+}
+
+func (v *yamlValidator) checkTagRule(path string, f map[string]*yaml.Node, node *yaml.Node) {
+	if n, ok := f["offset"]; !ok {
+		v.add(path+".offset", node.Line, "required")
+	} else {
+		v.checkOffset(path+".offset", n)
+	}
+
+	if n, ok := f["size"]; !ok {
+		v.add(path+".size", node.Line, "required")
+	} else if _, err := parseYamlInt(n, false); err != nil {
+		v.add(path+".size", n.Line, err.Error())
+	}
+
+	v.checkColor(path, f, node)
+}
+
+func (v *yamlValidator) checkDiffRule(path string, f map[string]*yaml.Node, node *yaml.Node) {
+	lists := map[string]int{}
+	for _, key := range []string{"offsets", "sizes", "files"} {
+		n, ok := f[key]
+		if !ok {
+			v.add(path+"."+key, node.Line, "required")
+			continue
+		}
+		if n.Kind != yaml.SequenceNode {
+			v.add(path+"."+key, n.Line, "must be a list")
+			continue
+		}
+		lists[key] = len(n.Content)
+		for i, item := range n.Content {
+			itemPath := fmt.Sprintf("%s.%s[%d]", path, key, i)
+			switch key {
+			case "offsets":
+				v.checkOffset(itemPath, item)
+			case "sizes":
+				if _, err := parseYamlInt(item, false); err != nil {
+					v.add(itemPath, item.Line, err.Error())
+				}
+			}
+		}
+	}
+
+	if o, ok := lists["offsets"]; ok {
+		if s, ok := lists["sizes"]; ok && o != s {
+			v.add(path, node.Line, fmt.Sprintf("offsets (%d) and sizes (%d) must have the same length", o, s))
+		}
+	}
+
+	v.checkColor(path, f, node)
+}
+
+func (v *yamlValidator) checkColor(path string, f map[string]*yaml.Node, node *yaml.Node) {
+	color, ok := f["color"]
+	if !ok {
+		v.add(path+".color", node.Line, "required")
+		return
+	}
+	if !hexColorRe.MatchString(color.Value) {
+		v.add(path+".color", color.Line, fmt.Sprintf("invalid hex color %q (expected #RGB or #RRGGBB)", color.Value))
+	}
+}
+
+// checkOffset accepts a non-negative integer or a hex string (as the frontend does)
+func (v *yamlValidator) checkOffset(path string, n *yaml.Node) {
+	if _, err := parseYamlInt(n, true); err != nil {
+		v.add(path, n.Line, err.Error())
+	}
+}
+
+// parseYamlInt reads a non-negative integer scalar. When allowHexString is set,
+// quoted strings are parsed as hex with an optional 0x prefix, matching the
+// frontend's parseInt(value, 16).
+func parseYamlInt(n *yaml.Node, allowHexString bool) (int64, error) {
+	if n.Kind != yaml.ScalarNode {
+		return 0, fmt.Errorf("must be a non-negative integer")
+	}
+
+	var value int64
+	switch {
+	case n.Tag == "!!int":
+		parsed, err := strconv.ParseInt(n.Value, 0, 64)
+		if err != nil {
+			return 0, fmt.Errorf("must be a non-negative integer")
+		}
+		value = parsed
+	case n.Tag == "!!str" && allowHexString:
+		parsed, err := strconv.ParseInt(strings.TrimPrefix(strings.ToLower(n.Value), "0x"), 16, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid hex offset %q", n.Value)
+		}
+		value = parsed
+	default:
+		return 0, fmt.Errorf("must be a non-negative integer")
+	}
+
+	if value < 0 {
+		return 0, fmt.Errorf("must be non-negative")
+	}
+	return value, nil
+}
+
+// maxTagsPerSearchRule caps how many detected tags a single search rule can
+// create, so a one-byte pattern doesn't flood the tag table.
+const maxTagsPerSearchRule = 1000
+
+// YamlApplyResponse is returned by POST /yaml/:name/apply
+type YamlApplyResponse struct {
+	Config       string       `json:"config"`
+	FileID       uint         `json:"file_id"`
+	YamlTags     int          `json:"yaml_tags"`
+	DetectedTags int          `json:"detected_tags"`
+	Tags         []models.Tag `json:"tags"`
+	Warnings     []string     `json:"warnings,omitempty"`
+}
+
+// yamlApplyConfig is the typed view of a config used when materializing tags.
+// Offsets stay as nodes so they go through parseYamlInt like validation does.
+type yamlApplyConfig struct {
+	Search map[string]struct {
+		Value string    `yaml:"value"`
+		Color string    `yaml:"color"`
+		Type  string    `yaml:"type"`
+		Start yaml.Node `yaml:"start"`
+		End   yaml.Node `yaml:"end"`
+		Regex bool      `yaml:"regex"`
+	} `yaml:"search"`
+	Tags map[string]struct {
+		Offset yaml.Node `yaml:"offset"`
+		Size   yaml.Node `yaml:"size"`
+		Color  string    `yaml:"color"`
+	} `yaml:"tags"`
+}
+
+// ApplyYamlConfig materializes a config's tags and search matches into Tag rows
+// for a file. Tags entries become type "yaml", search matches type "detected".
+// Tags of both types from a previous apply are replaced.
+// Query: file_name (required)
+func (h *Handler) ApplyYamlConfig(c echo.Context) error {
+	name := c.Param("name")
+	fileName := c.QueryParam("file_name")
+	if name == "" || fileName == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "config name and file_name are required"})
+	}
+
+	var yc models.YamlConfig
+	if err := h.db.GormDB.Where("name = ?", name).First(&yc).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "yaml config not found"})
+	}
+
+	var file models.File
+	if err := h.db.GormDB.Where("name = ?", fileName).First(&file).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "file not found"})
+	}
+
+	if result := validateYamlConfig(yc.Yaml); !result.Valid {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":  "invalid yaml config",
+			"errors": result.Errors,
+		})
+	}
+
+	var cfg yamlApplyConfig
+	if err := yaml.Unmarshal([]byte(yc.Yaml), &cfg); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": "invalid yaml config: " + err.Error()})
+	}
+
+	resp := YamlApplyResponse{Config: yc.Name, FileID: file.ID}
+	fileSize := int64(len(file.Data))
+	var tags []models.Tag
+
+	for _, tagName := range sortedKeys(cfg.Tags) {
+		rule := cfg.Tags[tagName]
+		offset, _ := parseYamlInt(&rule.Offset, true)
+		size, _ := parseYamlInt(&rule.Size, false)
+		if offset+size > fileSize {
+			resp.Warnings = append(resp.Warnings, fmt.Sprintf("tag %s (0x%X+%d) is outside the file, skipped", tagName, offset, size))
+			continue
+		}
+		tags = append(tags, models.Tag{
+			FileID: file.ID,
+			Name:   tagName,
+			Offset: offset,
+			Size:   size,
+			Color:  rule.Color,
+			Type:   "yaml",
+		})
+		resp.YamlTags++
+	}
+
+	for _, ruleName := range sortedKeys(cfg.Search) {
+		rule := cfg.Search[ruleName]
+		searchType := rule.Type
+		if searchType == "" {
+			searchType = "string-ascii" // frontend default
+		}
+
+		var start, end *int
+		if rule.Start.Kind != 0 {
+			v, _ := parseYamlInt(&rule.Start, true)
+			s := int(v)
+			start = &s
+		}
+		if rule.End.Kind != 0 {
+			v, _ := parseYamlInt(&rule.End, true)
+			e := int(v)
+			end = &e
+		}
+		startOffset, endOffset := 0, 0
+		if len(file.Data) > 0 {
+			startOffset, endOffset = searchRange(len(file.Data), start, end)
+		}
+
+		matches, err := searchByType(c.Request().Context(), file.Data, file.Data[startOffset:endOffset], searchType, rule.Value, rule.Regex, false)
+		if c.Request().Context().Err() != nil {
+			return apiError(c, statusClientClosedRequest, ErrCodeCanceled, "apply canceled")
+		}
+		if err != nil {
+			resp.Warnings = append(resp.Warnings, fmt.Sprintf("search %s: %v", ruleName, err))
+			continue
+		}
+		if len(matches) > maxTagsPerSearchRule {
+			resp.Warnings = append(resp.Warnings, fmt.Sprintf("search %s: %d matches, only the first %d were tagged", ruleName, len(matches), maxTagsPerSearchRule))
+			matches = matches[:maxTagsPerSearchRule]
+		}
+
+		// Match Search: only hex/string/BCD/varint offsets are relative to the range
+		rangeRelative := rangeRelativeSearch(searchType)
+		for _, m := range matches {
+			offset := int64(m.Offset)
+			if rangeRelative {
+				offset += int64(startOffset)
+			}
+			tags = append(tags, models.Tag{
+				FileID: file.ID,
+				Name:   ruleName,
+				Offset: offset,
+				Size:   int64(m.Length),
+				Color:  rule.Color,
+				Type:   "detected",
+			})
+			resp.DetectedTags++
+		}
+	}
+
+	err := h.db.GormDB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("file_id = ? AND type IN ?", file.ID, []string{"yaml", "detected"}).Delete(&models.Tag{}).Error; err != nil {
+			return err
+		}
+		if len(tags) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(&tags, 500).Error
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to save tags: " + err.Error()})
+	}
+
+	if tags == nil {
+		tags = []models.Tag{}
+	}
+	resp.Tags = tags
+	return c.JSON(http.StatusOK, resp)
+}
+
+// sortedKeys returns map keys in a stable order so tag IDs are deterministic
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"binary-annotator-pro/models"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"github.com/labstack/echo/v4"
+	"gopkg.in/yaml.v3"
+)
+
+// YamlDiffRequest names the two configs to compare. Each side is a stored
+// config name or, when the *_yaml field is set, inline YAML text.
+type YamlDiffRequest struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	FromYaml string `json:"from_yaml,omitempty"`
+	ToYaml   string `json:"to_yaml,omitempty"`
+}
+
+// YamlFieldChange is one field of a rule whose value differs. Offsets and
+// sizes are compared as numbers, so 0x10 and "10" (hex) are the same.
+type YamlFieldChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from"` // nil when the field was added
+	To    any    `json:"to"`   // nil when the field was removed
+}
+
+// YamlRuleChange lists the changed fields of a rule present in both configs
+type YamlRuleChange struct {
+	Name   string            `json:"name"`
+	Fields []YamlFieldChange `json:"fields"`
+}
+
+// YamlSectionDiff compares one section (tags, search or diff) by rule name
+type YamlSectionDiff struct {
+	Added   []string         `json:"added"`
+	Removed []string         `json:"removed"`
+	Changed []YamlRuleChange `json:"changed"`
+}
+
+func (d YamlSectionDiff) empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// YamlDiffResponse is returned by POST /yaml/diff
+type YamlDiffResponse struct {
+	From      string          `json:"from"`
+	To        string          `json:"to"`
+	Identical bool            `json:"identical"`
+	Tags      YamlSectionDiff `json:"tags"`
+	Search    YamlSectionDiff `json:"search"`
+	Diff      YamlSectionDiff `json:"diff"`
+}
+
+// yamlRules is a config read as section -> rule name -> field -> value
+type yamlRules map[string]map[string]map[string]yaml.Node
+
+// DiffYamlConfigs reports the rules added, removed and changed between two
+// configs, section by section
+func (h *Handler) DiffYamlConfigs(c echo.Context) error {
+	var req YamlDiffRequest
+	if err := c.Bind(&req); err != nil {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid request")
+	}
+
+	from, fromLabel, status, apiErr := h.loadYamlRules("from", req.From, req.FromYaml)
+	if apiErr != nil {
+		return c.JSON(status, apiErr)
+	}
+	to, toLabel, status, apiErr := h.loadYamlRules("to", req.To, req.ToYaml)
+	if apiErr != nil {
+		return c.JSON(status, apiErr)
+	}
+
+	resp := YamlDiffResponse{
+		From:   fromLabel,
+		To:     toLabel,
+		Tags:   diffYamlSection(from["tags"], to["tags"]),
+		Search: diffYamlSection(from["search"], to["search"]),
+		Diff:   diffYamlSection(from["diff"], to["diff"]),
+	}
+	resp.Identical = resp.Tags.empty() && resp.Search.empty() && resp.Diff.empty()
+	return c.JSON(http.StatusOK, resp)
+}
+
+// loadYamlRules reads one side of a diff from inline text or a stored config
+// and validates it. It returns the rules and a label for the side.
+func (h *Handler) loadYamlRules(side, name, text string) (yamlRules, string, int, *APIError) {
+	label := name
+	if text == "" {
+		if name == "" {
+			return nil, "", http.StatusBadRequest, &APIError{Code: ErrCodeInvalidRequest, Message: fmt.Sprintf("%s or %s_yaml is required", side, side)}
+		}
+		var yc models.YamlConfig
+		if err := h.db.GormDB.Where("name = ?", name).First(&yc).Error; err != nil {
+			return nil, "", http.StatusNotFound, &APIError{Code: ErrCodeNotFound, Message: fmt.Sprintf("yaml config %q not found", name)}
+		}
+		text = yc.Yaml
+	} else if label == "" {
+		label = side + "_yaml"
+	}
+
+	if result := validateYamlConfig(text); !result.Valid {
+		return nil, "", http.StatusUnprocessableEntity, &APIError{Code: ErrCodeInvalidRequest, Message: fmt.Sprintf("invalid yaml config (%s)", side),
+			Details: map[string]any{"side": side, "errors": result.Errors}}
+	}
+	var rules yamlRules
+	if err := yaml.Unmarshal([]byte(text), &rules); err != nil {
+		return nil, "", http.StatusUnprocessableEntity, &APIError{Code: ErrCodeInvalidRequest, Message: fmt.Sprintf("invalid yaml config (%s): %v", side, err)}
+	}
+	return rules, label, http.StatusOK, nil
+}
+
+// diffYamlSection compares two sections rule by rule, in name order
+func diffYamlSection(from, to map[string]map[string]yaml.Node) YamlSectionDiff {
+	diff := YamlSectionDiff{Added: []string{}, Removed: []string{}, Changed: []YamlRuleChange{}}
+	for _, name := range sortedKeys(from) {
+		if _, ok := to[name]; !ok {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+	for _, name := range sortedKeys(to) {
+		before, ok := from[name]
+		if !ok {
+			diff.Added = append(diff.Added, name)
+			continue
+		}
+		if fields := diffYamlRule(before, to[name]); len(fields) > 0 {
+			diff.Changed = append(diff.Changed, YamlRuleChange{Name: name, Fields: fields})
+		}
+	}
+	return diff
+}
+
+// diffYamlRule returns the fields whose values differ, in name order
+func diffYamlRule(from, to map[string]yaml.Node) []YamlFieldChange {
+	names := sortedKeys(from)
+	for _, name := range sortedKeys(to) {
+		if _, ok := from[name]; !ok {
+			names = append(names, name)
+		}
+	}
+
+	var changes []YamlFieldChange
+	for _, name := range names {
+		var before, after any
+		if n, ok := from[name]; ok {
+			before = yamlFieldValue(name, &n)
+		}
+		if n, ok := to[name]; ok {
+			after = yamlFieldValue(name, &n)
+		}
+		if !reflect.DeepEqual(before, after) {
+			changes = append(changes, YamlFieldChange{Field: name, From: before, To: after})
+		}
+	}
+	return changes
+}
+
+// yamlFieldValue normalizes a rule field for comparison: offsets and sizes
+// become numbers the way ApplyYamlConfig reads them, anything else its
+// decoded value
+func yamlFieldValue(field string, n *yaml.Node) any {
+	switch field {
+	case "offset", "start", "end":
+		if v, err := parseYamlInt(n, true); err == nil {
+			return v
+		}
+	case "size":
+		if v, err := parseYamlInt(n, false); err == nil {
+			return v
+		}
+	case "offsets", "sizes":
+		if n.Kind == yaml.SequenceNode {
+			values := make([]any, len(n.Content))
+			for i, item := range n.Content {
+				values[i] = yamlFieldValue(field[:len(field)-1], item)
+			}
+			return values
+		}
+	}
+	var v any
+	if err := n.Decode(&v); err != nil {
+		return n.Value
+	}
+	return v
+}
@@ -0,0 +1,418 @@
+package handlers
+
+import (
+	"binary-annotator-pro/models"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+const validYamlConfig = `search:
+  sync_marker:
+    value: "FF FF"
+    type: hex
+    color: "#4ECDC4"
+  schiller:
+    value: "SCH"
+    color: "#F38181"
+    start: "0x100"
+    end: 4096
+
+tags:
+  file_header:
+    offset: 0x0000
+    size: 256
+    color: "#95E1D3"
+  lead_i_data:
+    offset: "1000"
+    size: 10000
+    color: "#FFD93D"
+
+diff:
+  header_compare:
+    offsets: [0x10, "0x20"]
+    sizes: [4, 8]
+    files: ["a.bin", "b.bin"]
+    color: "#abc"
+`
+
+// TestValidateYamlConfig covers a valid config and several malformed ones
+func TestValidateYamlConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		yaml      string
+		wantPaths []string
+		wantLines []int
+	}{
+		{
+			name: "valid config",
+			yaml: validYamlConfig,
+		},
+		{
+			name:      "syntax error",
+			yaml:      "tags:\n  header:\n    offset: 0\n    size: 4: 5\n",
+			wantPaths: []string{""},
+			wantLines: []int{4},
+		},
+		{
+			name:      "bad color",
+			yaml:      "tags:\n  header:\n    offset: 0\n    size: 4\n    color: red\n",
+			wantPaths: []string{"tags.header.color"},
+			wantLines: []int{5},
+		},
+		{
+			name:      "negative offset and size",
+			yaml:      "tags:\n  header:\n    offset: -4\n    size: -1\n    color: \"#fff\"\n",
+			wantPaths: []string{"tags.header.offset", "tags.header.size"},
+			wantLines: []int{3, 4},
+		},
+		{
+			name:      "duplicate tag name",
+			yaml:      "tags:\n  header:\n    offset: 0\n    size: 4\n    color: \"#fff\"\n  header:\n    offset: 4\n    size: 4\n    color: \"#000\"\n",
+			wantPaths: []string{"tags.header"},
+			wantLines: []int{6},
+		},
+		{
+			name:      "missing required fields",
+			yaml:      "search:\n  magic:\n    type: hex\n",
+			wantPaths: []string{"search.magic.value", "search.magic.color"},
+		},
+		{
+			name:      "unsupported search type",
+			yaml:      "search:\n  magic:\n    value: \"1\"\n    type: int128\n    color: \"#123456\"\n",
+			wantPaths: []string{"search.magic.type"},
+			wantLines: []int{4},
+		},
+		{
+			name:      "non-integer size",
+			yaml:      "tags:\n  header:\n    offset: 0\n    size: big\n    color: \"#fff\"\n",
+			wantPaths: []string{"tags.header.size"},
+		},
+		{
+			name:      "diff length mismatch",
+			yaml:      "diff:\n  d:\n    offsets: [1, 2]\n    sizes: [4]\n    files: [a]\n    color: \"#fff\"\n",
+			wantPaths: []string{"diff.d"},
+		},
+		{
+			name:      "unknown section",
+			yaml:      "labels:\n  a: 1\n",
+			wantPaths: []string{"labels"},
+		},
+		{
+			name:      "not a mapping",
+			yaml:      "- just\n- a list\n",
+			wantPaths: []string{""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := validateYamlConfig(tt.yaml)
+
+			if result.Valid != (len(tt.wantPaths) == 0) {
+				t.Fatalf("valid = %v, errors = %+v", result.Valid, result.Errors)
+			}
+			if len(result.Errors) != len(tt.wantPaths) {
+				t.Fatalf("got %d errors %+v, want %d", len(result.Errors), result.Errors, len(tt.wantPaths))
+			}
+			for i, want := range tt.wantPaths {
+				if result.Errors[i].Path != want {
+					t.Errorf("errors[%d].path = %q, want %q", i, result.Errors[i].Path, want)
+				}
+				if i < len(tt.wantLines) && result.Errors[i].Line != tt.wantLines[i] {
+					t.Errorf("errors[%d].line = %d, want %d", i, result.Errors[i].Line, tt.wantLines[i])
+				}
+			}
+		})
+	}
+}
+
+// TestValidateYamlEndpoint accepts both raw YAML and JSON bodies
+func TestValidateYamlEndpoint(t *testing.T) {
+	h := newTestHandler(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/yaml/validate", strings.NewReader("tags:\n  x:\n    offset: 0\n    size: 1\n    color: nope\n"))
+	req.Header.Set(echo.HeaderContentType, "application/x-yaml")
+	rec := httptest.NewRecorder()
+	if err := h.ValidateYaml(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatalf("ValidateYaml() error = %v", err)
+	}
+	var result YamlValidationResult
+	decodeJSON(t, rec, http.StatusOK, &result)
+	if result.Valid || len(result.Errors) != 1 {
+		t.Errorf("raw body result = %+v, want one error", result)
+	}
+
+	c, rec := newJSONContext(http.MethodPost, "/yaml/validate", map[string]string{"yaml": validYamlConfig})
+	if err := h.ValidateYaml(c); err != nil {
+		t.Fatalf("ValidateYaml() error = %v", err)
+	}
+	decodeJSON(t, rec, http.StatusOK, &result)
+	if !result.Valid {
+		t.Errorf("json body result = %+v, want valid", result)
+	}
+}
+
+// TestUploadYamlValidation rejects invalid configs only when ?validate=true
+func TestUploadYamlValidation(t *testing.T) {
+	h := newTestHandler(t)
+	bad := map[string]string{"yaml": "tags:\n  x:\n    offset: -1\n    size: 1\n    color: \"#fff\"\n", "name": "bad"}
+
+	c, rec := newJSONContext(http.MethodPost, "/upload/yaml?validate=true", bad)
+	h.UploadYaml(c)
+	decodeJSON(t, rec, http.StatusUnprocessableEntity, nil)
+
+	c, rec = newJSONContext(http.MethodPost, "/upload/yaml", bad)
+	h.UploadYaml(c)
+	decodeJSON(t, rec, http.StatusCreated, nil)
+
+	c, rec = newJSONContext(http.MethodPut, "/update/yaml/bad?validate=true", map[string]string{"yaml": "tags: [1, 2]"})
+	c.SetParamNames("name")
+	c.SetParamValues("bad")
+	h.UpdateYamlConfig(c)
+	decodeJSON(t, rec, http.StatusUnprocessableEntity, nil)
+}
+
+// TestApplyYamlConfig materializes tags and search matches, replacing earlier yaml tags
+func TestApplyYamlConfig(t *testing.T) {
+	h := newTestHandler(t)
+
+	data := make([]byte, 64)
+	copy(data[8:], "SCH")
+	copy(data[40:], "SCH")
+	data[20], data[21] = 0xFF, 0xFE
+	file := createTestFile(t, h, "holter.bin", data)
+
+	config := `search:
+  schiller:
+    value: "SCH"
+    color: "#F38181"
+    start: "0x10"
+  marker:
+    value: "FF FE"
+    type: hex
+    color: "#4ECDC4"
+tags:
+  header:
+    offset: 0
+    size: 8
+    color: "#95E1D3"
+  trailer:
+    offset: "3C"
+    size: 16
+    color: "#FFD93D"
+`
+	if err := h.db.GormDB.Create(&models.YamlConfig{Name: "schiller", Yaml: config}).Error; err != nil {
+		t.Fatalf("create config: %v", err)
+	}
+	stale := []models.Tag{
+		{FileID: file.ID, Name: "old", Offset: 1, Size: 1, Color: "#000", Type: "yaml"},
+		{FileID: file.ID, Name: "mine", Offset: 2, Size: 2, Color: "#000", Type: "manual"},
+	}
+	if err := h.db.GormDB.Create(&stale).Error; err != nil {
+		t.Fatalf("create tags: %v", err)
+	}
+
+	apply := func() YamlApplyResponse {
+		c, rec := newJSONContext(http.MethodPost, "/yaml/schiller/apply?file_name=holter.bin", nil)
+		c.SetParamNames("name")
+		c.SetParamValues("schiller")
+		if err := h.ApplyYamlConfig(c); err != nil {
+			t.Fatalf("ApplyYamlConfig() error = %v", err)
+		}
+		var resp YamlApplyResponse
+		decodeJSON(t, rec, http.StatusOK, &resp)
+		return resp
+	}
+
+	resp := apply()
+	if resp.YamlTags != 1 || resp.DetectedTags != 2 || len(resp.Warnings) != 1 {
+		t.Fatalf("response = %+v, want 1 yaml tag, 2 detected and a warning for trailer", resp)
+	}
+	apply() // re-applying must not duplicate tags
+
+	var tags []models.Tag
+	h.db.GormDB.Where("file_id = ?", file.ID).Order("type, offset").Find(&tags)
+
+	type tagKey struct {
+		Name, Type   string
+		Offset, Size int64
+	}
+	want := []tagKey{
+		{"marker", "detected", 20, 2},
+		{"schiller", "detected", 40, 3},
+		{"mine", "manual", 2, 2},
+		{"header", "yaml", 0, 8},
+	}
+	if len(tags) != len(want) {
+		t.Fatalf("got %d tags %+v, want %d", len(tags), tags, len(want))
+	}
+	for i, w := range want {
+		got := tagKey{tags[i].Name, tags[i].Type, tags[i].Offset, tags[i].Size}
+		if got != w {
+			t.Errorf("tags[%d] = %+v, want %+v", i, got, w)
+		}
+	}
+}
+
+// TestDiffYamlConfigs compares a stored config with an edited copy that moves
+// one tag and adds a search rule
+func TestDiffYamlConfigs(t *testing.T) {
+	h := newTestHandler(t)
+	if err := h.db.GormDB.Create(&models.YamlConfig{Name: "v1", Yaml: validYamlConfig}).Error; err != nil {
+		t.Fatal(err)
+	}
+	edited := strings.Replace(validYamlConfig, `offset: "1000"`, `offset: 0x2000`, 1)
+	edited = strings.Replace(edited, "search:\n", "search:\n  footer:\n    value: \"END\"\n    color: \"#FF0000\"\n", 1)
+
+	c, rec := newJSONContext(http.MethodPost, "/yaml/diff", YamlDiffRequest{From: "v1", ToYaml: edited})
+	if err := h.DiffYamlConfigs(c); err != nil {
+		t.Fatalf("DiffYamlConfigs() error = %v", err)
+	}
+	var diff YamlDiffResponse
+	decodeJSON(t, rec, http.StatusOK, &diff)
+
+	if diff.Identical || diff.From != "v1" || diff.To != "to_yaml" {
+		t.Errorf("diff = %+v", diff)
+	}
+	if len(diff.Search.Added) != 1 || diff.Search.Added[0] != "footer" || len(diff.Search.Removed) != 0 || len(diff.Search.Changed) != 0 {
+		t.Errorf("search diff = %+v, want footer added", diff.Search)
+	}
+	if len(diff.Tags.Added) != 0 || len(diff.Tags.Removed) != 0 || len(diff.Tags.Changed) != 1 {
+		t.Fatalf("tags diff = %+v, want one changed tag", diff.Tags)
+	}
+	change := diff.Tags.Changed[0]
+	if change.Name != "lead_i_data" || len(change.Fields) != 1 || change.Fields[0].Field != "offset" ||
+		change.Fields[0].From != float64(0x1000) || change.Fields[0].To != float64(0x2000) {
+		t.Errorf("tag change = %+v, want lead_i_data offset 0x1000 -> 0x2000", change)
+	}
+	if !diff.Diff.empty() {
+		t.Errorf("diff section = %+v, want no changes", diff.Diff)
+	}
+
+	// The same config twice, with an offset written differently, is identical
+	same := strings.Replace(validYamlConfig, "offset: 0x0000", "offset: 0", 1)
+	c, rec = newJSONContext(http.MethodPost, "/yaml/diff", YamlDiffRequest{From: "v1", ToYaml: same})
+	if err := h.DiffYamlConfigs(c); err != nil {
+		t.Fatalf("DiffYamlConfigs() error = %v", err)
+	}
+	diff = YamlDiffResponse{}
+	decodeJSON(t, rec, http.StatusOK, &diff)
+	if !diff.Identical {
+		t.Errorf("diff = %+v, want identical", diff)
+	}
+
+	c, rec = newJSONContext(http.MethodPost, "/yaml/diff", YamlDiffRequest{From: "v1", To: "missing"})
+	if err := h.DiffYamlConfigs(c); err != nil {
+		t.Fatalf("DiffYamlConfigs() error = %v", err)
+	}
+	decodeJSON(t, rec, http.StatusNotFound, nil)
+}
+
+// TestYamlConfigVersions updates a config twice, then restores the original
+func TestYamlConfigVersions(t *testing.T) {
+	h := newTestHandler(t)
+	original := "tags:\n  a:\n    offset: 0\n    size: 1\n    color: \"#fff\"\n"
+	if err := h.db.GormDB.Create(&models.YamlConfig{Name: "cfg", Yaml: original}).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range []string{strings.Replace(original, "size: 1", "size: 2", 1), strings.Replace(original, "size: 1", "size: 3", 1)} {
+		c, rec := newJSONContext(http.MethodPut, "/update/yaml/cfg", map[string]string{"yaml": text})
+		c.SetParamNames("name")
+		c.SetParamValues("cfg")
+		if err := h.UpdateYamlConfig(c); err != nil {
+			t.Fatalf("UpdateYamlConfig() error = %v", err)
+		}
+		decodeJSON(t, rec, http.StatusOK, nil)
+	}
+
+	c, rec := newJSONContext(http.MethodGet, "/yaml/cfg/versions", nil)
+	c.SetParamNames("name")
+	c.SetParamValues("cfg")
+	if err := h.ListYamlVersions(c); err != nil {
+		t.Fatalf("ListYamlVersions() error = %v", err)
+	}
+	var versions []models.YamlConfigVersion
+	decodeJSON(t, rec, http.StatusOK, &versions)
+	if len(versions) != 2 || versions[0].Version != 2 || versions[1].Version != 1 || versions[1].Yaml != original {
+		t.Fatalf("versions = %+v, want 2 then 1 holding the original", versions)
+	}
+
+	c, rec = newJSONContext(http.MethodPost, "/yaml/cfg/restore/1", nil)
+	c.SetParamNames("name", "version")
+	c.SetParamValues("cfg", "1")
+	if err := h.RestoreYamlVersion(c); err != nil {
+		t.Fatalf("RestoreYamlVersion() error = %v", err)
+	}
+	var restored models.YamlConfig
+	decodeJSON(t, rec, http.StatusOK, &restored)
+
+	var stored models.YamlConfig
+	h.db.GormDB.Where("name = ?", "cfg").First(&stored)
+	if restored.Yaml != original || stored.Yaml != original {
+		t.Errorf("restored yaml = %q, stored %q, want the original", restored.Yaml, stored.Yaml)
+	}
+	var count int64
+	h.db.GormDB.Model(&models.YamlConfigVersion{}).Where("config_id = ?", stored.ID).Count(&count)
+	if count != 3 {
+		t.Errorf("versions after restore = %d, want 3 (the replaced yaml is kept)", count)
+	}
+
+	c, rec = newJSONContext(http.MethodPost, "/yaml/cfg/restore/9", nil)
+	c.SetParamNames("name", "version")
+	c.SetParamValues("cfg", "9")
+	if err := h.RestoreYamlVersion(c); err != nil {
+		t.Fatalf("RestoreYamlVersion() error = %v", err)
+	}
+	decodeJSON(t, rec, http.StatusNotFound, nil)
+}
+
+// TestYamlConfigFileLinkSurvivesRename links a config by file_id, renames the
+// file and lists the file's configs
+func TestYamlConfigFileLinkSurvivesRename(t *testing.T) {
+	h := newTestHandler(t)
+	file := createTestFile(t, h, "before.bin", []byte{1, 2, 3})
+
+	body := map[string]any{"yaml": "tags: {}\n", "name": "linked", "file_id": file.ID}
+	c, rec := newJSONContext(http.MethodPost, "/upload/yaml", body)
+	if err := h.UploadYaml(c); err != nil {
+		t.Fatalf("UploadYaml() error = %v", err)
+	}
+	decodeJSON(t, rec, http.StatusCreated, nil)
+
+	c, rec = newJSONContext(http.MethodPut, "/rename/binary/before.bin", map[string]string{"new_name": "after.bin"})
+	c.SetParamNames("name")
+	c.SetParamValues("before.bin")
+	if err := h.RenameBinaryFile(c); err != nil {
+		t.Fatalf("RenameBinaryFile() error = %v", err)
+	}
+	decodeJSON(t, rec, http.StatusOK, nil)
+
+	c, rec = newJSONContext(http.MethodGet, "/files/1/configs", nil)
+	c.SetParamNames("id")
+	c.SetParamValues(fmt.Sprint(file.ID))
+	if err := h.ListFileConfigs(c); err != nil {
+		t.Fatalf("ListFileConfigs() error = %v", err)
+	}
+	var configs []models.YamlConfig
+	decodeJSON(t, rec, http.StatusOK, &configs)
+	if len(configs) != 1 || configs[0].Name != "linked" || configs[0].FileID == nil || *configs[0].FileID != file.ID {
+		t.Fatalf("configs = %+v, want linked to file %d", configs, file.ID)
+	}
+	var renamed models.File
+	if err := h.db.GormDB.First(&renamed, *configs[0].FileID).Error; err != nil || renamed.Name != "after.bin" {
+		t.Errorf("linked file = %q (%v), want after.bin", renamed.Name, err)
+	}
+
+	// An unknown file_id is an error rather than a silent unlinked config
+	body = map[string]any{"yaml": "tags: {}\n", "name": "orphan", "file_id": file.ID + 100}
+	c, rec = newJSONContext(http.MethodPost, "/upload/yaml", body)
+	if err := h.UploadYaml(c); err != nil {
+		t.Fatalf("UploadYaml() error = %v", err)
+	}
+	decodeJSON(t, rec, http.StatusNotFound, nil)
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"binary-annotator-pro/models"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// snapshotYamlConfig stores the config's current YAML as its next version
+func snapshotYamlConfig(tx *gorm.DB, yc models.YamlConfig) (models.YamlConfigVersion, error) {
+	var last int
+	if err := tx.Model(&models.YamlConfigVersion{}).Where("config_id = ?", yc.ID).
+		Select("COALESCE(MAX(version), 0)").Scan(&last).Error; err != nil {
+		return models.YamlConfigVersion{}, err
+	}
+	version := models.YamlConfigVersion{ConfigID: yc.ID, Version: last + 1, Name: yc.Name, Yaml: yc.Yaml}
+	return version, tx.Create(&version).Error
+}
+
+// ListYamlVersions returns the saved versions of a config, newest first
+func (h *Handler) ListYamlVersions(c echo.Context) error {
+	var yc models.YamlConfig
+	if err := h.db.GormDB.Where("name = ?", c.Param("name")).First(&yc).Error; err != nil {
+		return apiError(c, http.StatusNotFound, ErrCodeNotFound, "config not found")
+	}
+
+	versions := []models.YamlConfigVersion{}
+	if err := h.db.GormDB.Where("config_id = ?", yc.ID).Order("version DESC").Find(&versions).Error; err != nil {
+		return apiError(c, http.StatusInternalServerError, ErrCodeInternal, "failed to list versions")
+	}
+	return c.JSON(http.StatusOK, versions)
+}
+
+// RestoreYamlVersion puts a saved version's YAML back into the config. The
+// YAML it replaces becomes a new version, so a restore can be undone too.
+func (h *Handler) RestoreYamlVersion(c echo.Context) error {
+	number, err := strconv.Atoi(c.Param("version"))
+	if err != nil || number < 1 {
+		return apiError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid version")
+	}
+
+	var yc models.YamlConfig
+	if err := h.db.GormDB.Where("name = ?", c.Param("name")).First(&yc).Error; err != nil {
+		return apiError(c, http.StatusNotFound, ErrCodeNotFound, "config not found")
+	}
+	var version models.YamlConfigVersion
+	if err := h.db.GormDB.Where("config_id = ? AND version = ?", yc.ID, number).First(&version).Error; err != nil {
+		return apiError(c, http.StatusNotFound, ErrCodeNotFound, "version not found")
+	}
+
+	err = h.db.GormDB.Transaction(func(tx *gorm.DB) error {
+		if yc.Yaml != version.Yaml {
+			if _, err := snapshotYamlConfig(tx, yc); err != nil {
+				return err
+			}
+		}
+		yc.Yaml = version.Yaml
+		return tx.Save(&yc).Error
+	})
+	if err != nil {
+		return apiError(c, http.StatusInternalServerError, ErrCodeInternal, "failed to restore version")
+	}
+	return c.JSON(http.StatusOK, yc)
+}
@@ -3,14 +3,23 @@ package main
 import (
 	"binary-annotator-pro/config"
 	"binary-annotator-pro/router"
+	"context"
+	"errors"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
 
+// shutdownTimeout bounds how long in-flight requests and chat replies may run
+// after SIGINT/SIGTERM before the server exits anyway
+const shutdownTimeout = 30 * time.Second
+
 func main() {
 	// Init DB
 	dbpath := ""
@@ -36,10 +45,46 @@ func main() {
 	})
 
 	// Routes
-	router.RegisterRoutes(e, db)
+	shutdownRoutes := router.RegisterRoutes(e, db)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 
 	log.Println("Server starting on :3000")
-	if err := e.Start(":3000"); err != nil {
-		log.Fatalf("server stopped: %v", err)
+	if err := serve(e, ":3000", stop, shutdownTimeout, shutdownRoutes); err != nil {
+		log.Printf("server stopped: %v", err)
+	}
+	log.Println("Server stopped")
+}
+
+// serve runs e on addr until a signal arrives on stop, then shuts down
+// gracefully: new connections are refused, in-flight requests get up to
+// timeout to finish, and the cleanup functions run with what is left of it
+func serve(e *echo.Echo, addr string, stop <-chan os.Signal, timeout time.Duration, cleanup ...func(context.Context) error) error {
+	errc := make(chan error, 1)
+	go func() { errc <- e.Start(addr) }()
+
+	select {
+	case err := <-errc:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	case sig := <-stop:
+		log.Printf("Received %v, shutting down", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var errs []error
+	if err := e.Shutdown(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	for _, fn := range cleanup {
+		if err := fn(ctx); err != nil {
+			errs = append(errs, err)
+		}
 	}
+	return errors.Join(errs...)
 }
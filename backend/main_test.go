@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TestServeGracefulShutdown checks a signal lets an in-flight request finish,
+// runs the cleanup functions and leaves the listener closed
+func TestServeGracefulShutdown(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := "http://" + ln.Addr().String()
+
+	e := echo.New()
+	e.HideBanner, e.HidePort = true, true
+	e.Listener = ln
+	started := make(chan struct{})
+	e.GET("/slow", func(c echo.Context) error {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		return c.String(http.StatusOK, "done")
+	})
+
+	stop := make(chan os.Signal, 1)
+	cleaned := false
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(e, "", stop, 5*time.Second, func(context.Context) error {
+			cleaned = true
+			return nil
+		})
+	}()
+
+	type result struct {
+		body string
+		err  error
+	}
+	slow := make(chan result, 1)
+	go func() {
+		resp, err := http.Get(addr + "/slow")
+		if err != nil {
+			slow <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		slow <- result{string(body), err}
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("request never reached the handler")
+	}
+	stop <- syscall.SIGTERM
+
+	if r := <-slow; r.err != nil || r.body != "done" {
+		t.Errorf("in-flight request = %q, %v; want it to complete", r.body, r.err)
+	}
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("serve() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not return after the signal")
+	}
+	if !cleaned {
+		t.Error("cleanup was not run")
+	}
+	if _, err := http.Get(addr + "/slow"); err == nil {
+		t.Error("server still accepting connections after shutdown")
+	}
+}
@@ -0,0 +1,91 @@
+// Package metrics holds the Prometheus metrics of the backend, served on
+// /metrics: searches, compression analyses, MCP tool calls and RAG searches.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "binary_annotator"
+
+// Registry holds the metrics below plus the Go runtime and process ones
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	// Searches counts /search requests by search type and status (ok, error)
+	Searches = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "searches_total",
+		Help:      "Searches run, by search type and status.",
+	}, []string{"type", "status"})
+
+	// SearchDuration is how long the scan of a search took, by search type
+	SearchDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "search_duration_seconds",
+		Help:      "Time spent scanning a file for a search, by search type.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 4, 10), // 0.5ms to ~2min
+	}, []string{"type"})
+
+	// CompressionAnalyses counts finished compression analyses by status
+	// (completed, failed)
+	CompressionAnalyses = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "compression_analyses_total",
+		Help:      "Compression analyses finished, by status.",
+	}, []string{"status"})
+
+	// MCPToolCallDuration is the latency of MCP tool calls through the
+	// Docker Manager, by server and status
+	MCPToolCallDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "mcp_tool_call_duration_seconds",
+		Help:      "Latency of MCP tool calls, by server and status.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 3, 9), // 10ms to ~1min
+	}, []string{"server", "status"})
+
+	// RAGSearchDuration is the latency of searches of the RAG service, by
+	// status
+	RAGSearchDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rag_search_duration_seconds",
+		Help:      "Latency of RAG service searches, by status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"status"})
+)
+
+func init() {
+	Registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+}
+
+// Status is the status label of an operation that returned err; context
+// errors count as "canceled"
+func Status(err error) string {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return "canceled"
+	}
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// Since returns the seconds elapsed since start, for Observe
+func Since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() echo.HandlerFunc {
+	return echo.WrapHandler(promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+}
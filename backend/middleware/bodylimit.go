@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// DefaultMaxBodySize applies when MAX_BODY_SIZE is unset. Larger captures go
+// through the chunked /upload/:id endpoints.
+const DefaultMaxBodySize = 512 << 20
+
+// MaxBodySizeFromEnv reads MAX_BODY_SIZE, in bytes or with a KB, MB or GB
+// suffix, falling back to DefaultMaxBodySize
+func MaxBodySizeFromEnv() int64 {
+	v := os.Getenv("MAX_BODY_SIZE")
+	if v == "" {
+		return DefaultMaxBodySize
+	}
+	n, err := ParseSize(v)
+	if err != nil || n <= 0 {
+		log.Printf("Ignoring invalid MAX_BODY_SIZE %q", v)
+		return DefaultMaxBodySize
+	}
+	return n
+}
+
+var sizeUnits = []struct {
+	suffix string
+	scale  int64
+}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+
+// ParseSize parses a size such as 1048576, 10MB or 2GB (binary units)
+func ParseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	for _, unit := range sizeUnits {
+		if num, ok := strings.CutSuffix(s, unit.suffix); ok {
+			n, err := strconv.ParseInt(strings.TrimSpace(num), 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid size %q", s)
+			}
+			return n * unit.scale, nil
+		}
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// FormatSize writes n in the largest unit that divides it, the inverse of
+// ParseSize
+func FormatSize(n int64) string {
+	for _, unit := range sizeUnits[:3] {
+		if n >= unit.scale && n%unit.scale == 0 {
+			return fmt.Sprintf("%d%s", n/unit.scale, unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
+
+// BodyLimit rejects requests whose body is larger than limit with a 413 that
+// states the limit. A declared Content-Length is checked up front; other
+// bodies are cut off at the limit, and the handler reading them gets an
+// *http.MaxBytesError to report with TooLargeError.
+func BodyLimit(limit int64) echo.MiddlewareFunc {
+	return bodyLimit(limit, "request body", limit)
+}
+
+// multipartOverhead allows for the boundaries and part headers around the
+// file of a multipart upload
+const multipartOverhead = 64 << 10
+
+// FileBodyLimit is BodyLimit for a multipart upload of one file of at most
+// fileLimit bytes: the body may exceed it by the multipart framing, and the
+// 413 states the file limit, as the handler's own check on the file does
+func FileBodyLimit(fileLimit int64) echo.MiddlewareFunc {
+	return bodyLimit(fileLimit+multipartOverhead, "file", fileLimit)
+}
+
+func bodyLimit(limit int64, what string, shown int64) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if req.ContentLength > limit {
+				return TooLargeError(c, what, shown)
+			}
+			req.Body = http.MaxBytesReader(c.Response(), req.Body, limit)
+			return next(c)
+		}
+	}
+}
+
+// TooLargeError writes the 413 response for what exceeded limit, in the
+// handlers' APIError shape
+func TooLargeError(c echo.Context, what string, limit int64) error {
+	return c.JSON(http.StatusRequestEntityTooLarge, map[string]any{
+		"code":    "too_large",
+		"error":   fmt.Sprintf("%s too large (max %s)", what, FormatSize(limit)),
+		"details": map[string]any{"limit_bytes": limit},
+	})
+}
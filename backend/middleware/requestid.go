@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"binary-annotator-pro/logging"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxRequestIDLength bounds the X-Request-ID accepted from clients
+const maxRequestIDLength = 128
+
+// RequestID tags each request with an ID, the client's X-Request-ID when it
+// sends a usable one, and echoes it in the response. Handlers log through
+// logging.FromContext(c.Request().Context()) so every line carries it.
+func RequestID(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		id := req.Header.Get(echo.HeaderXRequestID)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Response().Header().Set(echo.HeaderXRequestID, id)
+		c.SetRequest(req.WithContext(logging.WithRequestID(req.Context(), id)))
+		return next(c)
+	}
+}
+
+// validRequestID accepts printable ASCII IDs, so a client can't inject line
+// breaks or control characters into the logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7E {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
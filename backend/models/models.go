@@ -16,7 +16,24 @@ type File struct {
 	Name   string `gorm:"uniqueIndex;not null" json:"name"`
 	Vendor string `json:"vendor"`
 	Size   int64  `json:"size"`
-	Data   []byte `gorm:"type:blob" json:"-"`
+	Hash   string `gorm:"index" json:"hash"` // hex SHA-256 of Data
+	// Shannon entropy of Data in bits per byte (0-8); nil until computed
+	Entropy *float64 `gorm:"index" json:"entropy"`
+	Data    []byte   `gorm:"type:blob" json:"-"`
+}
+
+// PartialUpload tracks a chunked upload until it is finalized into a File.
+// The bytes received so far are kept on disk at Path.
+type PartialUpload struct {
+	ID        string    `gorm:"primaryKey" json:"id"` // random token
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Name     string `json:"name"`
+	Vendor   string `json:"vendor"`
+	Size     int64  `json:"size"`     // expected total; 0 when not declared
+	Received int64  `json:"received"` // offset of the next chunk
+	Path     string `json:"-"`
 }
 
 // YamlConfig stores YAML configs, optionally linked to a file
@@ -30,6 +47,18 @@ type YamlConfig struct {
 	Yaml   string `gorm:"type:text" json:"yaml"`
 }
 
+// YamlConfigVersion is a snapshot of a YamlConfig's YAML taken before an
+// update replaced it. Versions are numbered from 1 per config.
+type YamlConfigVersion struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	ConfigID uint   `gorm:"index;not null" json:"config_id"`
+	Version  int    `json:"version"`
+	Name     string `json:"name"` // config name when the snapshot was taken
+	Yaml     string `gorm:"type:text" json:"yaml"`
+}
+
 // Tag as per previous schema
 type Tag struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
@@ -78,7 +107,8 @@ type ExtractedBlock struct {
 	Data      []byte `gorm:"type:blob" json:"-"`
 }
 
-// AISettings stores AI provider configuration per user
+// AISettings stores AI provider configuration per user. The API keys are
+// encrypted at rest when AI_SETTINGS_KEY is set (see services.EncryptSecret).
 type AISettings struct {
 	ID        uint           `gorm:"primaryKey" json:"id"`
 	CreatedAt time.Time      `json:"created_at"`
@@ -94,16 +124,16 @@ type AISettings struct {
 	OllamaURL   string `json:"ollama_url"`
 	OllamaModel string `json:"ollama_model"`
 
-	// OpenAI settings (encrypted in production)
+	// OpenAI settings
 	OpenAIKey   string `json:"openai_key,omitempty"`
 	OpenAIModel string `json:"openai_model"`
 
-	// Claude settings (encrypted in production)
+	// Claude settings
 	ClaudeKey   string `json:"claude_key,omitempty"`
 	ClaudeModel string `json:"claude_model"`
 	Thinking    bool   `gorm:"default:false" json:"thinking"`
 
-	// Gemini settings (encrypted in production)
+	// Gemini settings
 	GeminiKey   string `json:"gemini_key,omitempty"`
 	GeminiModel string `json:"gemini_model"`
 }
@@ -149,10 +179,20 @@ type CompressionAnalysis struct {
 	SuccessCount int    `json:"success_count"`
 	FailedCount  int    `json:"failed_count"`
 
+	// Place in the detector queue while pending (1 = next to run), 0 otherwise
+	QueuePosition int `json:"queue_position,omitempty"`
+
 	// Selection info (for partial decompression)
 	StartOffset *int64 `json:"start_offset,omitempty"` // Offset where selection starts
 	Length      *int64 `json:"length,omitempty"`       // Length of compressed selection
 
+	// Comma-separated methods the detector was restricted to (empty = all)
+	Methods string `json:"methods,omitempty"`
+
+	// The detector command line and the version the detector reported
+	DetectorCommand string `json:"detector_command,omitempty"`
+	DetectorVersion string `json:"detector_version,omitempty"`
+
 	// Best candidate
 	BestMethod     string  `json:"best_method,omitempty"`
 	BestRatio      float64 `json:"best_ratio,omitempty"`
@@ -189,6 +229,9 @@ type CompressionResult struct {
 
 	// File reference
 	DecompressedFileID *uint `json:"decompressed_file_id,omitempty"`
+	// PreviewHex is the hex of the first 256 decompressed bytes, set for
+	// successful results
+	PreviewHex string `json:"preview_hex,omitempty"`
 }
 
 // DecompressedFile stores decompressed variant of a file
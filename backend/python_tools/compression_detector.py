@@ -44,6 +44,10 @@ try:
 except ImportError:
     HAS_SNAPPY = False
 
+# Reported in every JSON report so results can be traced to the detector
+# that produced them. Bump when methods or scoring change.
+DETECTOR_VERSION = "1.1.0"
+
 
 # -----------------------------------------------------------
 # Data Models
@@ -83,6 +87,7 @@ class AnalysisReport:
     best_ratio: float
     best_confidence: float
     results: List[DecompressionResult]
+    detector_version: str = DETECTOR_VERSION
 
     def to_json(self) -> dict:
         """Convert to JSON"""
@@ -1275,9 +1280,9 @@ def test_decompression(data: bytes, method_name: str,
         )
 
 
-def analyze_file(file_path: str, output_dir: Optional[str] = None, original_filename: Optional[str] = None, start_offset: Optional[int] = None, length: Optional[int] = None) -> AnalysisReport:
+def analyze_file(file_path: str, output_dir: Optional[str] = None, original_filename: Optional[str] = None, start_offset: Optional[int] = None, length: Optional[int] = None, methods: Optional[List[str]] = None) -> AnalysisReport:
     """
-    Analyze a file with all compression algorithms
+    Analyze a file with all compression algorithms (or only those listed in methods)
     """
     # Read input file
     with open(file_path, "rb") as f:
@@ -1294,6 +1299,8 @@ def analyze_file(file_path: str, output_dir: Optional[str] = None, original_file
 
     file_size = len(data)
     algorithms = get_algorithms()
+    if methods:
+        algorithms = [(name, func) for name, func in algorithms if name in methods]
     results = []
 
     # Test each algorithm
@@ -1363,6 +1370,7 @@ def main():
         print("  --original-filename NAME  Use this filename for output files", file=sys.stderr)
         print("  --start-offset OFFSET    Start analysis at this offset (bytes)", file=sys.stderr)
         print("  --length LENGTH         Analyze only this many bytes", file=sys.stderr)
+        print("  --methods a,b,c         Only try these methods", file=sys.stderr)
         sys.exit(1)
 
     file_path = sys.argv[1]
@@ -1405,9 +1413,16 @@ def main():
                 print("Error: Invalid length value", file=sys.stderr)
                 sys.exit(1)
 
+    # Parse methods filter
+    methods = None
+    if "--methods" in sys.argv:
+        idx = sys.argv.index("--methods")
+        if idx + 1 < len(sys.argv):
+            methods = [m.strip() for m in sys.argv[idx + 1].split(",") if m.strip()]
+
     # Analyze file
     try:
-        report = analyze_file(file_path, output_dir, original_filename, start_offset, length)
+        report = analyze_file(file_path, output_dir, original_filename, start_offset, length, methods)
 
         if json_output:
             # Output JSON for backend integration
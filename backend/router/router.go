@@ -3,13 +3,27 @@ package router
 import (
 	"binary-annotator-pro/config"
 	"binary-annotator-pro/handlers"
+	"binary-annotator-pro/metrics"
 	"binary-annotator-pro/middleware"
+	"context"
+	"log"
 
 	"github.com/labstack/echo/v4"
 )
 
-func RegisterRoutes(e *echo.Echo, db *config.DB) {
+// RegisterRoutes mounts all API routes. The returned shutdown function lets
+// in-flight chat replies finish, closes chat connections and stops background
+// work; call it after the HTTP server has stopped accepting connections.
+func RegisterRoutes(e *echo.Echo, db *config.DB) (shutdown func(context.Context) error) {
 	h := handlers.NewHandler(db)
+	stopSweeper := h.StartDecompressedSweeper()
+	stopUploadSweeper := h.StartUploadSweeper()
+
+	// Every request is logged under an ID returned in X-Request-ID
+	e.Use(middleware.RequestID)
+
+	// Oversized bodies get a 413 stating the limit (MAX_BODY_SIZE)
+	e.Use(middleware.BodyLimit(middleware.MaxBodySizeFromEnv()))
 
 	// Auth routes (public)
 	auth := e.Group("/auth")
@@ -21,6 +35,13 @@ func RegisterRoutes(e *echo.Echo, db *config.DB) {
 	e.POST("/upload/binary", h.UploadBinary)
 	e.POST("/upload/yaml", h.UploadYaml)
 
+	// Chunked uploads, resumable after a dropped connection
+	e.POST("/upload/init", h.InitUpload)
+	e.GET("/upload/:id", h.GetUpload)
+	e.PUT("/upload/:id", h.PutUploadChunk)
+	e.POST("/upload/:id/finalize", h.FinalizeUpload)
+	e.DELETE("/upload/:id", h.AbortUpload)
+
 	// Gets / lists
 	e.GET("/get/list/yaml", h.ListYaml)
 	e.GET("/get/list/binary", h.ListBinaries)
@@ -36,12 +57,15 @@ func RegisterRoutes(e *echo.Echo, db *config.DB) {
 	// Compression detection
 	e.POST("/analysis/compression/:fileId", h.StartCompressionAnalysis)
 	e.GET("/analysis/compression/:analysisId", h.GetCompressionAnalysis)
+	e.GET("/analysis/compression/:analysisId/stream", h.StreamCompressionAnalysis)
 	e.GET("/analysis/compression/file/:fileId", h.GetFileCompressionAnalyses)
 	e.GET("/analysis/compression/file/:fileId/latest", h.GetLatestCompressionAnalysis)
 	e.GET("/analysis/compression/download/:resultId", h.DownloadDecompressedFile)
 	e.POST("/analysis/compression/result/:resultId/add-to-files", h.AddDecompressedToFiles)
 	e.POST("/analysis/compression/result/:resultId/reconstruct", h.ReconstructFileWithDecompression)
+	e.POST("/reconstruct/multi", h.ReconstructFileWithMultipleDecompressions)
 	e.DELETE("/analysis/compression/:analysisId", h.DeleteCompressionAnalysis)
+	e.POST("/compression/cleanup", h.CleanupDecompressedFiles)
 
 	// Decompressed files management
 	e.GET("/decompressed/list", h.ListDecompressedFiles)
@@ -53,18 +77,75 @@ func RegisterRoutes(e *echo.Echo, db *config.DB) {
 
 	// Update
 	e.PUT("/update/yaml/:name", h.UpdateYamlConfig)
+
 	e.PUT("/rename/binary/:name", h.RenameBinaryFile)
 
+	// YAML config tools
+	e.POST("/yaml/validate", h.ValidateYaml)
+	e.POST("/yaml/diff", h.DiffYamlConfigs)
+	e.POST("/yaml/:name/apply", h.ApplyYamlConfig)
+	e.GET("/yaml/:name/versions", h.ListYamlVersions)
+	e.POST("/yaml/:name/restore/:version", h.RestoreYamlVersion)
+
+	// Bulk file operations
+	e.POST("/files/bulk-delete", h.BulkDeleteFiles)
+	e.POST("/files/bulk-vendor", h.BulkSetVendor)
+
 	// Additional helpers
 	e.GET("/get/binary-by-id/:id", h.GetBinaryByID)
+	e.GET("/files/:id/hash", h.GetFileHash)
+	e.GET("/files/:id/configs", h.ListFileConfigs)
+
+	// Tags (hex viewer annotations)
+	e.POST("/files/:id/tags", h.CreateTag)
+	e.GET("/files/:id/tags", h.ListTags)
+	e.PUT("/files/:id/tags/:tagId", h.UpdateTag)
+	e.DELETE("/files/:id/tags/:tagId", h.DeleteTag)
+
+	// Notes
+	e.POST("/files/:id/notes", h.CreateNote)
+	e.GET("/files/:id/notes", h.ListNotes)
+	e.PUT("/files/:id/notes/:noteId", h.UpdateNote)
+	e.DELETE("/files/:id/notes/:noteId", h.DeleteNote)
+
+	// Extracted blocks
+	e.POST("/files/:id/extract", h.ExtractBlock)
+	e.POST("/files/:id/slice", h.SliceFile)
+	e.POST("/files/:id/carve", h.CarveFile)
+	e.GET("/files/:id/blocks", h.ListBlocks)
+	e.GET("/blocks/:id/download", h.DownloadBlock)
+
+	// Bitfield extraction
+	e.POST("/files/:id/bits", h.ExtractBitField)
+
+	// Byte transition matrix
+	e.GET("/files/:id/transitions", h.GetTransitions)
+
+	// File overview
+	e.GET("/files/:id/analyze", h.AnalyzeFile)
+
+	// Frame detection
+	e.POST("/frame/detect", h.DetectFraming)
+
+	// Decoding
+	e.POST("/decode/pipeline", h.DecodePipeline)
+	e.POST("/decode/bcd", h.DecodeBCD)
+	e.POST("/decode/varint", h.DecodeVarint)
 
 	// AI Settings
 	aiSettingsHandler := handlers.NewAISettingsHandler(db)
+	if n, err := handlers.EncryptStoredAIKeys(db); err != nil {
+		log.Printf("Encrypting stored API keys failed: %v", err)
+	} else if n > 0 {
+		log.Printf("Encrypted the API keys of %d AI settings", n)
+	}
 	e.GET("/ai/settings/:userId", aiSettingsHandler.GetAISettings)
 	e.POST("/ai/settings/:userId", aiSettingsHandler.SaveAISettings)
 	e.PUT("/ai/settings/:userId", aiSettingsHandler.SaveAISettings)
 	e.DELETE("/ai/settings/:userId", aiSettingsHandler.DeleteAISettings)
 	e.POST("/ai/test/:userId", aiSettingsHandler.TestAIConnection)
+	e.GET("/settings/:userId", aiSettingsHandler.GetAISettings)
+	e.PUT("/settings/:userId", aiSettingsHandler.SaveAISettings)
 
 	// AI WebSocket
 	wsHandler := handlers.NewWebSocketHandler(db)
@@ -76,41 +157,66 @@ func RegisterRoutes(e *echo.Echo, db *config.DB) {
 	e.GET("/chat/sessions/:userId", chatHandler.GetChatSessions)
 	e.DELETE("/chat/session/:sessionId", chatHandler.DeleteChatSession)
 
+	// API description
+	e.GET("/openapi.json", handlers.OpenAPISpec(e))
+
+	// Prometheus metrics
+	e.GET("/metrics", metrics.Handler())
+
 	// Binary Search
-	searchHandler := handlers.NewSearchHandler(db)
+	searchHandler := h.SearchHandler()
 	e.POST("/search", searchHandler.Search)
+	e.POST("/search/sequence", searchHandler.SearchSequence)
+	e.POST("/search/timestamps", searchHandler.SearchTimestamps)
 
 	// Checksum calculation
 	e.POST("/checksum", h.CalculateChecksum)
+	e.POST("/checksum/batch", h.CalculateChecksumBatch)
+	e.POST("/checksum/crc", h.CalculateSeededCRC)
 
 	// Binary Comparison
 	e.POST("/compare/diff", h.CompareBinaryFiles)
 	e.POST("/compare/delta", h.AnalyzeDelta)
 	e.POST("/compare/correlation", h.CalculatePatternCorrelation)
+	e.POST("/compare/signals", h.CompareSignals)
+	e.POST("/compare/lag", h.FindLag)
 	e.POST("/compare/streaming", h.StreamingCompare)
 	e.GET("/compare/export", h.ExportComparison)
+	e.GET("/compare/patch", h.GetComparePatch)
 
 	// Multi-file comparison
 	e.POST("/compare/multi", h.CompareMultipleFiles)
 	e.POST("/compare/multi/generate-yaml", h.GenerateMultiFileDiffYaml)
+	e.POST("/compare/nway", h.CompareNWay)
+
+	// Subsystem health
+	healthHandler := handlers.NewHealthHandler(db)
+	e.GET("/health/deep", healthHandler.DeepHealth)
 
 	// MCP Docker Manager
 	mcpDockerHandler := handlers.NewMCPDockerHandler()
 	e.GET("/mcp/docker/health", mcpDockerHandler.GetMCPManagerHealth)
 	e.GET("/mcp/docker/stats", mcpDockerHandler.GetMCPDockerStats)
 	e.GET("/mcp/docker/servers", mcpDockerHandler.ListMCPServers)
+	e.GET("/mcp/tools", mcpDockerHandler.ListMCPTools)
+	e.GET("/mcp/tools/:name/schema", mcpDockerHandler.GetMCPToolSchema)
+	e.POST("/mcp/tools/:name/call", mcpDockerHandler.CallMCPToolByName)
 	e.POST("/mcp/docker/servers/:name/start", mcpDockerHandler.StartMCPServer)
 	e.POST("/mcp/docker/servers/:name/stop", mcpDockerHandler.StopMCPServer)
 	e.POST("/mcp/docker/servers/:name/toggle", mcpDockerHandler.ToggleMCPDockerServer)
+	e.POST("/mcp/docker/servers/:name/refresh-tools", mcpDockerHandler.RefreshMCPTools)
 	e.POST("/mcp/docker/servers/:name/call", mcpDockerHandler.CallMCPTool)
 
 	// RAG Document Management
 	ragFilesHandler := handlers.NewRAGFilesHandler(db)
-	e.POST("/rag/upload", ragFilesHandler.UploadDocument)
+	e.POST("/rag/upload", ragFilesHandler.UploadDocument, middleware.FileBodyLimit(handlers.RAGMaxFileSize))
 	e.GET("/rag/documents", ragFilesHandler.ListDocuments)
+	e.GET("/rag/documents/:id", ragFilesHandler.GetDocument)
 	e.DELETE("/rag/documents/:id", ragFilesHandler.DeleteDocument)
 	e.GET("/rag/stats", ragFilesHandler.GetDocumentStats)
 	e.POST("/rag/search", ragFilesHandler.SearchRAG)
+	e.GET("/rag/config", ragFilesHandler.GetRAGConfig)
+	e.PUT("/rag/config", ragFilesHandler.UpdateRAGConfig)
 
 	// CSV Processing
 	e.POST("/parse/csv", h.ParseCSV)
@@ -126,5 +232,13 @@ func RegisterRoutes(e *echo.Echo, db *config.DB) {
 	e.PUT("/huffman/tables/:id", h.UpdateHuffmanTable)
 	e.DELETE("/huffman/tables/:id", h.DeleteHuffmanTable)
 	e.POST("/huffman/decode", h.DecodeHuffmanSelection)
-
+	e.GET("/huffman/:id/export", h.ExportHuffmanTable)
+	e.POST("/huffman/import", h.ImportHuffmanTable)
+	e.POST("/huffman/:tableId/decode-to-file", h.DecodeHuffmanToFile)
+
+	return func(ctx context.Context) error {
+		defer stopSweeper()
+		defer stopUploadSweeper()
+		return chatHandler.Shutdown(ctx)
+	}
 }
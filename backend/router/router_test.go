@@ -0,0 +1,286 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"binary-annotator-pro/config"
+	"binary-annotator-pro/handlers"
+	"binary-annotator-pro/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TestOpenAPISpec checks /openapi.json is valid JSON describing the registered routes
+func TestOpenAPISpec(t *testing.T) {
+	db, err := config.InitDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { db.SQLDB.Close() })
+
+	e := echo.New()
+	RegisterRoutes(e, db)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+
+	var spec struct {
+		OpenAPI    string                                `json:"openapi"`
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas struct {
+				Error struct {
+					Properties struct {
+						Code    struct{ Enum []string } `json:"code"`
+						Details struct{ Type string }   `json:"details"`
+					} `json:"properties"`
+				}
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("spec is not valid JSON: %v", err)
+	}
+	if spec.OpenAPI == "" {
+		t.Error("spec has no openapi version")
+	}
+
+	for path, method := range map[string]string{
+		"/search":                        "post",
+		"/checksum":                      "post",
+		"/files/{id}/tags/{tagId}":       "put",
+		"/huffman/tables/{id}":           "get",
+		"/analysis/compression/{fileId}": "post",
+	} {
+		if _, ok := spec.Paths[path][method]; !ok {
+			t.Errorf("spec is missing %s %s", method, path)
+		}
+	}
+
+	errSchema := spec.Components.Schemas.Error.Properties
+	if !slices.Contains(errSchema.Code.Enum, handlers.ErrCodeTooLarge) || errSchema.Details.Type != "object" {
+		t.Errorf("Error schema = %+v, want code with an enum of the error codes and details", errSchema)
+	}
+
+	var search struct {
+		RequestBody struct {
+			Content map[string]struct {
+				Schema map[string]string `json:"schema"`
+			} `json:"content"`
+		} `json:"requestBody"`
+	}
+	json.Unmarshal(spec.Paths["/search"]["post"], &search)
+	if ref := search.RequestBody.Content["application/json"].Schema["$ref"]; ref != "#/components/schemas/SearchRequest" {
+		t.Errorf("/search request schema = %q, want SearchRequest ref", ref)
+	}
+
+	var tag struct {
+		Parameters []struct{ Name string } `json:"parameters"`
+	}
+	json.Unmarshal(spec.Paths["/files/{id}/tags/{tagId}"]["put"], &tag)
+	if len(tag.Parameters) != 2 || tag.Parameters[0].Name != "id" || tag.Parameters[1].Name != "tagId" {
+		t.Errorf("tag update parameters = %+v, want id and tagId", tag.Parameters)
+	}
+}
+
+// TestBodyLimit posts bodies over MAX_BODY_SIZE and the RAG document limit
+// and checks for a 413 stating the limit
+func TestBodyLimit(t *testing.T) {
+	t.Setenv("MAX_BODY_SIZE", "1KB")
+	db, err := config.InitDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { db.SQLDB.Close() })
+	e := echo.New()
+	RegisterRoutes(e, db)
+
+	multipartBody := func(size int) (*bytes.Buffer, string) {
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		part, _ := w.CreateFormFile("file", "capture.txt")
+		part.Write(bytes.Repeat([]byte{'a'}, size))
+		w.Close()
+		return &buf, w.FormDataContentType()
+	}
+
+	for _, tc := range []struct {
+		name, target, wantError string
+		size                    int
+		unknownLength           bool
+		wantLimit               int64
+	}{
+		{"declared length", "/upload/binary", "request body too large (max 1KB)", 4096, false, 1024},
+		// Checked while the handler reads the body
+		{"unknown length", "/upload/binary", "request body too large (max 1KB)", 4096, true, 1024},
+		{"within limit", "/upload/binary", "", 100, false, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			body, contentType := multipartBody(tc.size)
+			req := httptest.NewRequest(http.MethodPost, tc.target, body)
+			req.Header.Set(echo.HeaderContentType, contentType)
+			if tc.unknownLength {
+				req.ContentLength = -1
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if tc.wantError == "" {
+				if rec.Code != http.StatusCreated {
+					t.Fatalf("status = %d, want 201 (body: %s)", rec.Code, rec.Body.String())
+				}
+				return
+			}
+			assertTooLarge(t, rec, tc.wantError, tc.wantLimit)
+		})
+	}
+
+	t.Run("rag document", func(t *testing.T) {
+		t.Setenv("MAX_BODY_SIZE", "64MB")
+		e := echo.New()
+		RegisterRoutes(e, db)
+
+		body, contentType := multipartBody(handlers.RAGMaxFileSize + 1)
+		req := httptest.NewRequest(http.MethodPost, "/rag/upload?user_id=u1", body)
+		req.Header.Set(echo.HeaderContentType, contentType)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assertTooLarge(t, rec, "file too large (max 10MB)", handlers.RAGMaxFileSize)
+	})
+}
+
+func assertTooLarge(t *testing.T, rec *httptest.ResponseRecorder, wantError string, wantLimit int64) {
+	t.Helper()
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want 413 (body: %s)", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Code    string `json:"code"`
+		Error   string `json:"error"`
+		Details struct {
+			LimitBytes int64 `json:"limit_bytes"`
+		} `json:"details"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Code != handlers.ErrCodeTooLarge || resp.Error != wantError || resp.Details.LimitBytes != wantLimit {
+		t.Errorf("response = %+v, want code %s, error %q, limit %d", resp, handlers.ErrCodeTooLarge, wantError, wantLimit)
+	}
+}
+
+// TestRequestIDLogging calls an MCP tool and checks the handler's log line
+// carries the request ID, the client's own or a generated one, that is
+// returned in X-Request-ID
+func TestRequestIDLogging(t *testing.T) {
+	manager := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"result": "ok"})
+	}))
+	defer manager.Close()
+	t.Setenv("MCP_MANAGER_URL", manager.URL)
+
+	var logs bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	db, err := config.InitDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { db.SQLDB.Close() })
+	e := echo.New()
+	RegisterRoutes(e, db)
+
+	for _, sent := range []string{"report-42", ""} {
+		logs.Reset()
+		req := httptest.NewRequest(http.MethodPost, "/mcp/docker/servers/binary/call", strings.NewReader(`{"tool":"list_binary_files"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if sent != "" {
+			req.Header.Set(echo.HeaderXRequestID, sent)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200 (body: %s)", rec.Code, rec.Body.String())
+		}
+
+		id := rec.Header().Get(echo.HeaderXRequestID)
+		if id == "" || (sent != "" && id != sent) {
+			t.Fatalf("X-Request-ID = %q, want %q or a generated ID", id, sent)
+		}
+		var entry struct {
+			Msg       string `json:"msg"`
+			RequestID string `json:"request_id"`
+			Tool      string `json:"tool"`
+		}
+		if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+			t.Fatalf("log line %q: %v", logs.String(), err)
+		}
+		if entry.RequestID != id || entry.Tool != "list_binary_files" {
+			t.Errorf("log entry = %+v, want request_id %s and tool list_binary_files", entry, id)
+		}
+	}
+}
+
+// TestMetricsCountSearches scrapes /metrics before and after one search and
+// checks the search counter of its type went up by one
+func TestMetricsCountSearches(t *testing.T) {
+	db, err := config.InitDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { db.SQLDB.Close() })
+	if err := db.GormDB.Create(&models.File{Name: "capture.bin", Data: []byte{0x00, 0xAA, 0x55, 0xAA, 0x55}}).Error; err != nil {
+		t.Fatalf("create file: %v", err)
+	}
+	e := echo.New()
+	RegisterRoutes(e, db)
+
+	const series = `binary_annotator_searches_total{status="ok",type="hex"}`
+	scrape := func() float64 {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("/metrics status = %d, want 200", rec.Code)
+		}
+		for _, line := range strings.Split(rec.Body.String(), "\n") {
+			if value, ok := strings.CutPrefix(line, series+" "); ok {
+				v, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					t.Fatalf("parse %q: %v", line, err)
+				}
+				return v
+			}
+		}
+		return 0 // not exported until the first search of that type
+	}
+
+	before := scrape()
+	req := httptest.NewRequest(http.MethodPost, "/search", strings.NewReader(`{"file_name":"capture.bin","type":"hex","value":"AA55"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("search status = %d, want 200 (body: %s)", rec.Code, rec.Body.String())
+	}
+
+	if after := scrape(); after != before+1 {
+		t.Errorf("%s = %v after one search, want %v", series, after, before+1)
+	}
+}
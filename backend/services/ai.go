@@ -1,6 +1,7 @@
 package services
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"fmt"
@@ -26,8 +27,18 @@ type AIRequest struct {
 	Prompt       string        `json:"prompt"`
 	Stream       bool          `json:"stream,omitempty"`
 	FileAnalysis *FileAnalysis `json:"file_analysis,omitempty"`
+
+	// Optional generation controls; nil/zero means the provider default below.
+	// Temperature is a pointer so an explicit 0.0 (deterministic) can be requested.
+	Temperature *float64 `json:"temperature,omitempty"`
+	MaxTokens   int      `json:"max_tokens,omitempty"`
 }
 
+const (
+	defaultOpenAITemperature = 0.3
+	defaultClaudeMaxTokens   = 4096
+)
+
 // FileAnalysis contains binary file analysis data
 type FileAnalysis struct {
 	FileName           string              `json:"file_name"`
@@ -91,29 +102,23 @@ func getEnv(key, defaultValue string) string {
 func (s *AIService) Generate(req AIRequest) (*AIResponse, error) {
 	switch req.Provider {
 	case ProviderOllama:
-		return s.generateOllama(req.Prompt)
+		return s.generateOllama(req)
 	case ProviderOpenAI:
-		return s.generateOpenAI(req.Prompt)
+		return s.generateOpenAI(req)
 	case ProviderClaude:
-		return s.generateClaude(req.Prompt)
+		return s.generateClaude(req)
 	default:
 		return &AIResponse{Success: false, Error: "unknown provider"}, fmt.Errorf("unknown provider: %s", req.Provider)
 	}
 }
 
 // generateOllama calls Ollama API
-func (s *AIService) generateOllama(prompt string) (*AIResponse, error) {
+func (s *AIService) generateOllama(req AIRequest) (*AIResponse, error) {
 	if s.OllamaURL == "" {
 		return &AIResponse{Success: false, Error: "Ollama URL not configured"}, nil
 	}
 
-	reqBody := map[string]interface{}{
-		"model":  s.OllamaModel,
-		"prompt": prompt,
-		"stream": false,
-	}
-
-	jsonData, err := json.Marshal(reqBody)
+	jsonData, err := json.Marshal(s.ollamaRequestBody(req))
 	if err != nil {
 		return &AIResponse{Success: false, Error: "marshal request"}, err
 	}
@@ -139,39 +144,21 @@ func (s *AIService) generateOllama(prompt string) (*AIResponse, error) {
 }
 
 // generateOpenAI calls OpenAI API
-func (s *AIService) generateOpenAI(prompt string) (*AIResponse, error) {
+func (s *AIService) generateOpenAI(aiReq AIRequest) (*AIResponse, error) {
 	if s.OpenAIKey == "" {
 		return &AIResponse{Success: false, Error: "OpenAI API key not configured"}, nil
 	}
 
-	reqBody := map[string]interface{}{
-		"model": s.OpenAIModel,
-		"messages": []map[string]string{
-			{
-				"role":    "system",
-				"content": "You are an expert in binary file analysis and reverse engineering. Provide concise, technical responses.",
-			},
-			{
-				"role":    "user",
-				"content": prompt,
-			},
-		},
-		"temperature": 0.3,
-	}
-
-	jsonData, err := json.Marshal(reqBody)
+	jsonData, err := json.Marshal(s.openAIRequestBody(aiReq, false))
 	if err != nil {
 		return &AIResponse{Success: false, Error: "marshal request"}, err
 	}
 
-	req, err := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(jsonData))
+	req, err := s.newOpenAIRequest(jsonData)
 	if err != nil {
 		return &AIResponse{Success: false, Error: "create request"}, err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+s.OpenAIKey)
-
 	client := &http.Client{Timeout: 60 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
@@ -203,37 +190,21 @@ func (s *AIService) generateOpenAI(prompt string) (*AIResponse, error) {
 }
 
 // generateClaude calls Claude API
-func (s *AIService) generateClaude(prompt string) (*AIResponse, error) {
+func (s *AIService) generateClaude(aiReq AIRequest) (*AIResponse, error) {
 	if s.ClaudeKey == "" {
 		return &AIResponse{Success: false, Error: "Claude API key not configured"}, nil
 	}
 
-	reqBody := map[string]interface{}{
-		"model":      s.ClaudeModel,
-		"max_tokens": 4096,
-		"messages": []map[string]string{
-			{
-				"role":    "user",
-				"content": prompt,
-			},
-		},
-		"system": "You are an expert in binary file analysis and reverse engineering. Provide concise, technical responses.",
-	}
-
-	jsonData, err := json.Marshal(reqBody)
+	jsonData, err := json.Marshal(s.claudeRequestBody(aiReq, false))
 	if err != nil {
 		return &AIResponse{Success: false, Error: "marshal request"}, err
 	}
 
-	req, err := http.NewRequest("POST", "https://api.anthropic.com/v1/messages", bytes.NewBuffer(jsonData))
+	req, err := s.newClaudeRequest(jsonData)
 	if err != nil {
 		return &AIResponse{Success: false, Error: "create request"}, err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", s.ClaudeKey)
-	req.Header.Set("anthropic-version", "2023-06-01")
-
 	client := &http.Client{Timeout: 60 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
@@ -262,6 +233,273 @@ func (s *AIService) generateClaude(prompt string) (*AIResponse, error) {
 	return &AIResponse{Success: true, Data: result.Content[0].Text}, nil
 }
 
+const analysisSystemPrompt = "You are an expert in binary file analysis and reverse engineering. Provide concise, technical responses."
+
+// ollamaRequestBody builds the /api/generate payload
+func (s *AIService) ollamaRequestBody(req AIRequest) map[string]interface{} {
+	body := map[string]interface{}{
+		"model":  s.OllamaModel,
+		"prompt": req.Prompt,
+		"stream": false,
+	}
+
+	options := map[string]interface{}{}
+	if req.Temperature != nil {
+		options["temperature"] = *req.Temperature
+	}
+	if req.MaxTokens > 0 {
+		options["num_predict"] = req.MaxTokens
+	}
+	if len(options) > 0 {
+		body["options"] = options
+	}
+	return body
+}
+
+// openAIRequestBody builds the chat completions payload
+func (s *AIService) openAIRequestBody(req AIRequest, stream bool) map[string]interface{} {
+	temperature := defaultOpenAITemperature
+	if req.Temperature != nil {
+		temperature = *req.Temperature
+	}
+
+	body := map[string]interface{}{
+		"model": s.OpenAIModel,
+		"messages": []map[string]string{
+			{
+				"role":    "system",
+				"content": analysisSystemPrompt,
+			},
+			{
+				"role":    "user",
+				"content": req.Prompt,
+			},
+		},
+		"temperature": temperature,
+	}
+	if req.MaxTokens > 0 {
+		body["max_tokens"] = req.MaxTokens
+	}
+	if stream {
+		body["stream"] = true
+	}
+	return body
+}
+
+// claudeRequestBody builds the messages API payload
+func (s *AIService) claudeRequestBody(req AIRequest, stream bool) map[string]interface{} {
+	maxTokens := defaultClaudeMaxTokens
+	if req.MaxTokens > 0 {
+		maxTokens = req.MaxTokens
+	}
+
+	body := map[string]interface{}{
+		"model":      s.ClaudeModel,
+		"max_tokens": maxTokens,
+		"messages": []map[string]string{
+			{
+				"role":    "user",
+				"content": req.Prompt,
+			},
+		},
+		"system": analysisSystemPrompt,
+	}
+	if req.Temperature != nil {
+		body["temperature"] = *req.Temperature
+	}
+	if stream {
+		body["stream"] = true
+	}
+	return body
+}
+
+func (s *AIService) newOpenAIRequest(jsonData []byte) (*http.Request, error) {
+	req, err := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+s.OpenAIKey)
+	return req, nil
+}
+
+func (s *AIService) newClaudeRequest(jsonData []byte) (*http.Request, error) {
+	req, err := http.NewRequest("POST", "https://api.anthropic.com/v1/messages", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", s.ClaudeKey)
+	req.Header.Set("anthropic-version", "2023-06-01")
+	return req, nil
+}
+
+// StreamGenerate streams a generation token by token, calling callback for each text delta.
+// Ollama has no streaming path here and delivers its full answer as a single chunk.
+func (s *AIService) StreamGenerate(req AIRequest, callback StreamCallback) error {
+	switch req.Provider {
+	case ProviderOpenAI:
+		return s.streamOpenAI(req, callback)
+	case ProviderClaude:
+		return s.streamClaude(req, callback)
+	case ProviderOllama:
+		resp, err := s.generateOllama(req)
+		if err != nil {
+			return err
+		}
+		if !resp.Success {
+			return fmt.Errorf("%s", resp.Error)
+		}
+		return callback(resp.Data)
+	default:
+		return fmt.Errorf("unknown provider: %s", req.Provider)
+	}
+}
+
+// streamOpenAI calls OpenAI with stream: true
+func (s *AIService) streamOpenAI(aiReq AIRequest, callback StreamCallback) error {
+	if s.OpenAIKey == "" {
+		return fmt.Errorf("OpenAI API key not configured")
+	}
+
+	jsonData, err := json.Marshal(s.openAIRequestBody(aiReq, true))
+	if err != nil {
+		return fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := s.newOpenAIRequest(jsonData)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+
+	body, err := doStreamRequest(req, "OpenAI")
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	return parseOpenAIStream(body, callback)
+}
+
+// streamClaude calls Claude with stream: true
+func (s *AIService) streamClaude(aiReq AIRequest, callback StreamCallback) error {
+	if s.ClaudeKey == "" {
+		return fmt.Errorf("Claude API key not configured")
+	}
+
+	jsonData, err := json.Marshal(s.claudeRequestBody(aiReq, true))
+	if err != nil {
+		return fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := s.newClaudeRequest(jsonData)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+
+	body, err := doStreamRequest(req, "Claude")
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	return parseClaudeStream(body, callback)
+}
+
+// doStreamRequest sends a streaming request and returns the body on HTTP 200
+func doStreamRequest(req *http.Request, provider string) (io.ReadCloser, error) {
+	client := &http.Client{Timeout: 5 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s request failed: %w", provider, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("%s error: %s - %s", provider, resp.Status, string(body))
+	}
+
+	return resp.Body, nil
+}
+
+// sseData yields the payload of each "data:" line in an SSE stream
+func sseData(body io.Reader, handle func(data string) (stop bool, err error)) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		stop, err := handle(strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+		if err != nil || stop {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read stream: %w", err)
+	}
+	return nil
+}
+
+// parseOpenAIStream handles chat.completion.chunk events until "data: [DONE]"
+func parseOpenAIStream(body io.Reader, callback StreamCallback) error {
+	return sseData(body, func(data string) (bool, error) {
+		if data == "[DONE]" {
+			return true, nil
+		}
+
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return false, fmt.Errorf("decode OpenAI chunk: %w", err)
+		}
+
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			return false, callback(chunk.Choices[0].Delta.Content)
+		}
+		return false, nil
+	})
+}
+
+// parseClaudeStream handles content_block_delta events until message_stop
+func parseClaudeStream(body io.Reader, callback StreamCallback) error {
+	return sseData(body, func(data string) (bool, error) {
+		var event struct {
+			Type  string `json:"type"`
+			Delta struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"delta"`
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return false, fmt.Errorf("decode Claude event: %w", err)
+		}
+
+		switch event.Type {
+		case "content_block_delta":
+			if event.Delta.Type == "text_delta" && event.Delta.Text != "" {
+				return false, callback(event.Delta.Text)
+			}
+		case "message_stop":
+			return true, nil
+		case "error":
+			return true, fmt.Errorf("Claude stream error: %s - %s", event.Error.Type, event.Error.Message)
+		}
+		return false, nil
+	})
+}
+
 // GenerateYAMLTags generates YAML tags from file analysis
 func (s *AIService) GenerateYAMLTags(provider AIProvider, analysis *FileAnalysis) (*AIResponse, error) {
 	if analysis == nil {
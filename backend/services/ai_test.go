@@ -0,0 +1,155 @@
+package services
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+// TestParseOpenAIStream checks chat.completion.chunk deltas are delivered in order
+func TestParseOpenAIStream(t *testing.T) {
+	stream := strings.Join([]string{
+		`data: {"id":"c1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"role":"assistant","content":""}}]}`,
+		``,
+		`data: {"id":"c1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"55 AA"}}]}`,
+		``,
+		`data: {"id":"c1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":" is a"}}]}`,
+		``,
+		`data: {"id":"c1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":" sync word"}}]}`,
+		``,
+		`data: {"id":"c1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+		``,
+		`data: [DONE]`,
+		``,
+	}, "\n")
+
+	assertStreamChunks(t, parseOpenAIStream, stream, []string{"55 AA", " is a", " sync word"})
+}
+
+// TestParseClaudeStream checks content_block_delta text is delivered in order
+func TestParseClaudeStream(t *testing.T) {
+	stream := strings.Join([]string{
+		`event: message_start`,
+		`data: {"type":"message_start","message":{"id":"msg_1","role":"assistant","content":[]}}`,
+		``,
+		`event: content_block_start`,
+		`data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		``,
+		`event: ping`,
+		`data: {"type":"ping"}`,
+		``,
+		`event: content_block_delta`,
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Header"}}`,
+		``,
+		`event: content_block_delta`,
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" ends at"}}`,
+		``,
+		`event: content_block_delta`,
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" 0x200"}}`,
+		``,
+		`event: content_block_stop`,
+		`data: {"type":"content_block_stop","index":0}`,
+		``,
+		`event: message_stop`,
+		`data: {"type":"message_stop"}`,
+		``,
+	}, "\n")
+
+	assertStreamChunks(t, parseClaudeStream, stream, []string{"Header", " ends at", " 0x200"})
+}
+
+// TestParseClaudeStreamError surfaces an error event
+func TestParseClaudeStreamError(t *testing.T) {
+	stream := "event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}\n\n"
+
+	err := parseClaudeStream(strings.NewReader(stream), func(string) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "overloaded_error") {
+		t.Errorf("err = %v, want overloaded_error", err)
+	}
+}
+
+func assertStreamChunks(t *testing.T, parse func(body io.Reader, callback StreamCallback) error, stream string, want []string) {
+	t.Helper()
+
+	var got []string
+	if err := parse(strings.NewReader(stream), func(chunk string) error {
+		got = append(got, chunk)
+		return nil
+	}); err != nil {
+		t.Fatalf("parse error = %v", err)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d chunks %q, want %d", len(got), got, len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("chunk %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+// TestRequestBodyGenerationOverrides checks Temperature/MaxTokens reach each provider payload
+func TestRequestBodyGenerationOverrides(t *testing.T) {
+	s := &AIService{OllamaModel: "llama3", OpenAIModel: "gpt-4o", ClaudeModel: "claude-test"}
+	zero := 0.0
+
+	tests := []struct {
+		name string
+		body map[string]interface{}
+		want string
+	}{
+		{
+			name: "openai defaults",
+			body: s.openAIRequestBody(AIRequest{Prompt: "p"}, false),
+			want: `"temperature":0.3`,
+		},
+		{
+			name: "openai deterministic",
+			body: s.openAIRequestBody(AIRequest{Prompt: "p", Temperature: &zero, MaxTokens: 512}, false),
+			want: `"max_tokens":512,"messages":`,
+		},
+		{
+			name: "claude defaults",
+			body: s.claudeRequestBody(AIRequest{Prompt: "p"}, false),
+			want: `"max_tokens":4096`,
+		},
+		{
+			name: "claude overrides",
+			body: s.claudeRequestBody(AIRequest{Prompt: "p", Temperature: &zero, MaxTokens: 1000}, true),
+			want: `"max_tokens":1000`,
+		},
+		{
+			name: "ollama overrides",
+			body: s.ollamaRequestBody(AIRequest{Prompt: "p", Temperature: &zero, MaxTokens: 256}),
+			want: `"options":{"num_predict":256,"temperature":0}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.body)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			if !strings.Contains(string(data), tt.want) {
+				t.Errorf("body %s does not contain %s", data, tt.want)
+			}
+		})
+	}
+
+	// An explicit 0.0 must not fall back to the OpenAI default
+	data, _ := json.Marshal(s.openAIRequestBody(AIRequest{Temperature: &zero}, false))
+	if !strings.Contains(string(data), `"temperature":0}`) && !strings.Contains(string(data), `"temperature":0,`) {
+		t.Errorf("openai body %s should carry temperature 0", data)
+	}
+	data, _ = json.Marshal(s.claudeRequestBody(AIRequest{Temperature: &zero}, false))
+	if !strings.Contains(string(data), `"temperature":0`) {
+		t.Errorf("claude body %s should carry temperature 0", data)
+	}
+	data, _ = json.Marshal(s.ollamaRequestBody(AIRequest{}))
+	if strings.Contains(string(data), "options") {
+		t.Errorf("ollama body %s should omit options by default", data)
+	}
+}
@@ -15,6 +15,10 @@ import (
 type ChatMessageReq struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
+	// ToolCalls are the calls made by an assistant message
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// ToolName is the tool whose result a "tool" message holds
+	ToolName string `json:"tool_name,omitempty"`
 }
 
 // ChatRequest represents a chat request
@@ -60,6 +64,9 @@ type ToolCall struct {
 		Name      string                 `json:"name"`
 		Arguments map[string]interface{} `json:"arguments"`
 	} `json:"function"`
+	// ThoughtSignature is Gemini's signature of the reasoning behind the
+	// call, which has to be sent back with it
+	ThoughtSignature string `json:"-"`
 }
 
 // StreamResponse contains the streaming response with potential tool calls
@@ -10,6 +10,9 @@ import (
 	"net/http"
 )
 
+// geminiBaseURL is the Gemini API root, a variable so tests can stand in for it
+var geminiBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+
 // GeminiService handles chat operations with Google Gemini API
 type GeminiService struct {
 	APIKey string
@@ -28,14 +31,43 @@ type GeminiMessage struct {
 	Parts []GeminiContentPart `json:"parts"`
 }
 
-// GeminiContentPart represents content in a message
+// GeminiContentPart represents content in a message: text, a function call
+// or a function result. A part must carry one of them, Gemini rejects {}.
 type GeminiContentPart struct {
-	Text string `json:"text"`
+	Text             string                  `json:"text,omitempty"`
+	FunctionCall     *GeminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *GeminiFunctionResponse `json:"functionResponse,omitempty"`
+	ThoughtSignature string                  `json:"thoughtSignature,omitempty"`
+}
+
+// GeminiFunctionCall is a tool invocation requested by the model
+type GeminiFunctionCall struct {
+	Name string                 `json:"name"`
+	Args map[string]interface{} `json:"args"`
+}
+
+// GeminiFunctionResponse returns the result of a function call to the model
+type GeminiFunctionResponse struct {
+	Name     string                 `json:"name"`
+	Response map[string]interface{} `json:"response"`
+}
+
+// GeminiTool groups function declarations offered to the model
+type GeminiTool struct {
+	FunctionDeclarations []GeminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+// GeminiFunctionDeclaration describes one callable function
+type GeminiFunctionDeclaration struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
 }
 
 // GeminiRequest represents a request to Gemini API
 type GeminiRequest struct {
 	Contents []GeminiMessage `json:"contents"`
+	Tools    []GeminiTool    `json:"tools,omitempty"`
 }
 
 // GeminiResponse represents the Gemini API response
@@ -55,14 +87,69 @@ type GeminiResponse struct {
 type GeminiStreamResponse struct {
 	Candidates []struct {
 		Content struct {
-			Parts []struct {
-				Text string `json:"text"`
-			} `json:"parts"`
+			Parts []GeminiContentPart `json:"parts"`
 		} `json:"content"`
 	} `json:"candidates"`
 }
 
-// ConvertToGeminiMessages converts ChatMessageReq to Gemini format
+// ConvertToGeminiTools converts Ollama-style tools into Gemini function declarations
+func ConvertToGeminiTools(tools []Tool) []GeminiTool {
+	if len(tools) == 0 {
+		return nil
+	}
+
+	declarations := make([]GeminiFunctionDeclaration, 0, len(tools))
+	for _, tool := range tools {
+		declarations = append(declarations, GeminiFunctionDeclaration{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			Parameters:  sanitizeGeminiSchema(tool.Function.Parameters),
+		})
+	}
+
+	return []GeminiTool{{FunctionDeclarations: declarations}}
+}
+
+// sanitizeGeminiSchema drops JSON Schema keywords Gemini's OpenAPI subset rejects.
+// Objects without properties are also rejected, so such schemas are omitted entirely.
+func sanitizeGeminiSchema(schema map[string]interface{}) map[string]interface{} {
+	if schema == nil {
+		return nil
+	}
+	if props, ok := schema["properties"].(map[string]interface{}); schema["type"] == "object" && (!ok || len(props) == 0) {
+		return nil
+	}
+
+	var clean func(v interface{}) interface{}
+	clean = func(v interface{}) interface{} {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			out := make(map[string]interface{}, len(t))
+			for k, val := range t {
+				if k == "$schema" || k == "additionalProperties" {
+					continue
+				}
+				out[k] = clean(val)
+			}
+			return out
+		case []interface{}:
+			out := make([]interface{}, len(t))
+			for i, val := range t {
+				out[i] = clean(val)
+			}
+			return out
+		default:
+			return v
+		}
+	}
+
+	return clean(schema).(map[string]interface{})
+}
+
+// ConvertToGeminiMessages converts ChatMessageReq to Gemini format. Tool
+// calls of assistant messages become functionCall parts, and the results
+// that follow them one user turn of functionResponse parts. Messages without
+// content are dropped, as Gemini rejects empty parts.
 func ConvertToGeminiMessages(messages []ChatMessageReq) []GeminiMessage {
 	var geminiMessages []GeminiMessage
 
@@ -74,21 +161,51 @@ func ConvertToGeminiMessages(messages []ChatMessageReq) []GeminiMessage {
 		}
 
 		role := msg.Role
-		// Convert "assistant" to "model" for Gemini
-		if role == "assistant" {
+		var parts []GeminiContentPart
+		switch {
+		case role == "assistant":
+			// Convert "assistant" to "model" for Gemini
 			role = "model"
-		}
-		// Convert "tool" to "user" for Gemini (tool results come back as user messages)
-		if role == "tool" {
+			if msg.Content != "" {
+				parts = append(parts, GeminiContentPart{Text: msg.Content})
+			}
+			for _, call := range msg.ToolCalls {
+				args := call.Function.Arguments
+				if args == nil {
+					args = map[string]interface{}{}
+				}
+				parts = append(parts, GeminiContentPart{
+					FunctionCall:     &GeminiFunctionCall{Name: call.Function.Name, Args: args},
+					ThoughtSignature: call.ThoughtSignature,
+				})
+			}
+		case role == "tool" && msg.ToolName != "":
+			// Tool results go back as functionResponse parts of a user turn
 			role = "user"
+			parts = append(parts, GeminiContentPart{FunctionResponse: &GeminiFunctionResponse{
+				Name:     msg.ToolName,
+				Response: map[string]interface{}{"content": msg.Content},
+			}})
+			// Results of the calls of one turn share a message
+			if last := len(geminiMessages) - 1; last >= 0 && geminiMessages[last].Role == "user" &&
+				geminiMessages[last].Parts[0].FunctionResponse != nil {
+				geminiMessages[last].Parts = append(geminiMessages[last].Parts, parts...)
+				continue
+			}
+		default:
+			// Tool results without a tool name come back as user text
+			if role == "tool" {
+				role = "user"
+			}
+			if msg.Content != "" {
+				parts = append(parts, GeminiContentPart{Text: msg.Content})
+			}
+		}
+		if len(parts) == 0 {
+			continue
 		}
 
-		geminiMessages = append(geminiMessages, GeminiMessage{
-			Role: role,
-			Parts: []GeminiContentPart{
-				{Text: msg.Content},
-			},
-		})
+		geminiMessages = append(geminiMessages, GeminiMessage{Role: role, Parts: parts})
 	}
 
 	// Prepend system message to first user message if exists
@@ -101,9 +218,9 @@ func ConvertToGeminiMessages(messages []ChatMessageReq) []GeminiMessage {
 	}
 
 	if systemPrompt != "" && len(geminiMessages) > 0 {
-		// Find first user message
+		// Find first user text message
 		for i, msg := range geminiMessages {
-			if msg.Role == "user" {
+			if msg.Role == "user" && msg.Parts[0].Text != "" {
 				geminiMessages[i].Parts[0].Text = systemPrompt + "\n\n" + msg.Parts[0].Text
 				break
 			}
@@ -113,13 +230,15 @@ func ConvertToGeminiMessages(messages []ChatMessageReq) []GeminiMessage {
 	return geminiMessages
 }
 
-// StreamChatWithTools sends a chat request to Gemini and streams the response
-func (g *GeminiService) StreamChatWithTools(model string, messages []ChatMessageReq, callback StreamCallbackWithTools) error {
+// StreamChatWithTools sends a chat request to Gemini and streams the response.
+// Tools are sent as function declarations; functionCall parts come back as ToolCalls.
+func (g *GeminiService) StreamChatWithTools(model string, messages []ChatMessageReq, tools []Tool, callback StreamCallbackWithTools) error {
 	// Convert messages to Gemini format
 	geminiMessages := ConvertToGeminiMessages(messages)
 
 	req := GeminiRequest{
 		Contents: geminiMessages,
+		Tools:    ConvertToGeminiTools(tools),
 	}
 
 	jsonData, err := json.Marshal(req)
@@ -128,8 +247,8 @@ func (g *GeminiService) StreamChatWithTools(model string, messages []ChatMessage
 	}
 
 	// Gemini streaming endpoint
-	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:streamGenerateContent?alt=sse&key=%s",
-		model, g.APIKey)
+	url := fmt.Sprintf("%s/models/%s:streamGenerateContent?alt=sse&key=%s",
+		geminiBaseURL, model, g.APIKey)
 
 	httpReq, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
@@ -152,41 +271,66 @@ func (g *GeminiService) StreamChatWithTools(model string, messages []ChatMessage
 
 	log.Printf("Gemini responded with status %d, starting to read stream...", resp.StatusCode)
 
-	// Read SSE stream
-	scanner := bufio.NewScanner(resp.Body)
+	if err := parseGeminiStream(resp.Body, callback); err != nil {
+		return err
+	}
+
+	// Send done signal
+	callback(StreamResponse{Done: true})
+
+	return nil
+}
+
+// parseGeminiStream reads an SSE body ("data: {...}" lines), forwarding text
+// chunks and functionCall parts to the callback
+func parseGeminiStream(body io.Reader, callback StreamCallbackWithTools) error {
+	scanner := bufio.NewScanner(body)
+	// Function call args can make a single event larger than the default 64KB
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
 	lineNum := 0
 	for scanner.Scan() {
 		line := scanner.Text()
 		lineNum++
 
 		// SSE format: "data: {...}"
-		if len(line) > 6 && line[:6] == "data: " {
-			jsonData := line[6:]
-
-			var streamResp GeminiStreamResponse
-			if err := json.Unmarshal([]byte(jsonData), &streamResp); err != nil {
-				log.Printf("Failed to parse Gemini stream line %d: %v", lineNum, err)
-				continue
-			}
+		if len(line) <= 6 || line[:6] != "data: " {
+			continue
+		}
 
-			// Extract text from response
-			if len(streamResp.Candidates) > 0 && len(streamResp.Candidates[0].Content.Parts) > 0 {
-				text := streamResp.Candidates[0].Content.Parts[0].Text
+		var streamResp GeminiStreamResponse
+		if err := json.Unmarshal([]byte(line[6:]), &streamResp); err != nil {
+			log.Printf("Failed to parse Gemini stream line %d: %v", lineNum, err)
+			continue
+		}
+		if len(streamResp.Candidates) == 0 {
+			continue
+		}
 
-				if text != "" {
-					log.Printf("Received content chunk: %d chars", len(text))
+		for _, part := range streamResp.Candidates[0].Content.Parts {
+			response := StreamResponse{ToolCalls: []ToolCall{}}
 
-					// Send to callback
-					response := StreamResponse{
-						Content:   text,
-						ToolCalls: []ToolCall{}, // Gemini doesn't support tool calls in the same way
-						Done:      false,
-					}
+			if part.Text != "" {
+				log.Printf("Received content chunk: %d chars", len(part.Text))
+				response.Content = part.Text
+			}
 
-					if err := callback(response); err != nil {
-						return err
-					}
+			if part.FunctionCall != nil {
+				log.Printf("Received function call: %s", part.FunctionCall.Name)
+				var toolCall ToolCall
+				toolCall.Function.Name = part.FunctionCall.Name
+				toolCall.Function.Arguments = part.FunctionCall.Args
+				if toolCall.Function.Arguments == nil {
+					toolCall.Function.Arguments = map[string]interface{}{}
 				}
+				toolCall.ThoughtSignature = part.ThoughtSignature
+				response.ToolCalls = append(response.ToolCalls, toolCall)
+			}
+
+			if response.Content == "" && len(response.ToolCalls) == 0 {
+				continue
+			}
+			if err := callback(response); err != nil {
+				return err
 			}
 		}
 	}
@@ -196,10 +340,6 @@ func (g *GeminiService) StreamChatWithTools(model string, messages []ChatMessage
 	if err := scanner.Err(); err != nil {
 		return fmt.Errorf("read stream: %w", err)
 	}
-
-	// Send done signal
-	callback(StreamResponse{Done: true})
-
 	return nil
 }
 
@@ -218,8 +358,8 @@ func (g *GeminiService) Chat(model string, messages []ChatMessageReq) (string, e
 	}
 
 	// Gemini generate endpoint
-	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent?key=%s",
-		model, g.APIKey)
+	url := fmt.Sprintf("%s/models/%s:generateContent?key=%s",
+		geminiBaseURL, model, g.APIKey)
 
 	httpReq, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
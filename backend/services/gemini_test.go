@@ -0,0 +1,177 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestParseGeminiStreamFunctionCall checks functionCall parts surface as ToolCalls
+func TestParseGeminiStreamFunctionCall(t *testing.T) {
+	stream := strings.Join([]string{
+		`data: {"candidates":[{"content":{"parts":[{"text":"Let me look at that file."}],"role":"model"}}]}`,
+		``,
+		`data: {"candidates":[{"content":{"parts":[{"functionCall":{"name":"read_bytes","args":{"offset":512,"length":16}}}],"role":"model"}}]}`,
+		``,
+		`data: {"candidates":[{"content":{"parts":[{"text":""}],"role":"model"},"finishReason":"STOP"}]}`,
+		``,
+	}, "\n")
+
+	var chunks []StreamResponse
+	err := parseGeminiStream(strings.NewReader(stream), func(resp StreamResponse) error {
+		chunks = append(chunks, resp)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("parseGeminiStream() error = %v", err)
+	}
+
+	if len(chunks) != 2 {
+		t.Fatalf("got %d chunks, want 2", len(chunks))
+	}
+	if chunks[0].Content != "Let me look at that file." {
+		t.Errorf("text chunk = %q", chunks[0].Content)
+	}
+
+	if len(chunks[1].ToolCalls) != 1 {
+		t.Fatalf("got %d tool calls, want 1", len(chunks[1].ToolCalls))
+	}
+	call := chunks[1].ToolCalls[0]
+	if call.Function.Name != "read_bytes" {
+		t.Errorf("tool name = %q, want read_bytes", call.Function.Name)
+	}
+	if call.Function.Arguments["offset"] != float64(512) || call.Function.Arguments["length"] != float64(16) {
+		t.Errorf("tool args = %v", call.Function.Arguments)
+	}
+}
+
+// TestConvertToGeminiTools checks the declaration shape sent to Gemini
+func TestConvertToGeminiTools(t *testing.T) {
+	tools := []Tool{
+		{Type: "function", Function: FunctionDef{
+			Name:        "read_bytes",
+			Description: "Read bytes from the open file",
+			Parameters: map[string]interface{}{
+				"$schema":              "http://json-schema.org/draft-07/schema#",
+				"type":                 "object",
+				"additionalProperties": false,
+				"properties": map[string]interface{}{
+					"offset": map[string]interface{}{"type": "integer"},
+				},
+			},
+		}},
+		{Type: "function", Function: FunctionDef{
+			Name:       "list_files",
+			Parameters: map[string]interface{}{"type": "object", "properties": map[string]interface{}{}},
+		}},
+	}
+
+	body, err := json.Marshal(GeminiRequest{Tools: ConvertToGeminiTools(tools)})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	want := `{"contents":null,"tools":[{"functionDeclarations":[` +
+		`{"name":"read_bytes","description":"Read bytes from the open file","parameters":{"properties":{"offset":{"type":"integer"}},"type":"object"}},` +
+		`{"name":"list_files"}]}]}`
+	if string(body) != want {
+		t.Errorf("request body:\n got %s\nwant %s", body, want)
+	}
+
+	if ConvertToGeminiTools(nil) != nil {
+		t.Error("no tools should omit the tools field")
+	}
+}
+
+// TestGeminiToolRoundTrip runs two tool-calling turns against a stand-in
+// Gemini that, like the real one, rejects empty parts and expects each
+// functionCall to be answered by a functionResponse
+func TestGeminiToolRoundTrip(t *testing.T) {
+	replies := []string{
+		`{"candidates":[{"content":{"parts":[{"functionCall":{"name":"list_files","args":{}},"thoughtSignature":"sig1"}],"role":"model"}}]}`,
+		`{"candidates":[{"content":{"parts":[{"text":"Reading it."},{"functionCall":{"name":"read_bytes","args":{"offset":0}}}],"role":"model"}}]}`,
+		`{"candidates":[{"content":{"parts":[{"text":"It starts with ECG."}],"role":"model"}}]}`,
+	}
+	var requests []GeminiRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req GeminiRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var pendingCalls []string
+		for i, msg := range req.Contents {
+			for _, part := range msg.Parts {
+				if part.Text == "" && part.FunctionCall == nil && part.FunctionResponse == nil {
+					http.Error(w, fmt.Sprintf("contents[%d]: empty part", i), http.StatusBadRequest)
+					return
+				}
+				switch {
+				case part.FunctionCall != nil:
+					pendingCalls = append(pendingCalls, part.FunctionCall.Name)
+				case part.FunctionResponse != nil:
+					if len(pendingCalls) == 0 || pendingCalls[0] != part.FunctionResponse.Name {
+						http.Error(w, fmt.Sprintf("contents[%d]: unexpected response for %s", i, part.FunctionResponse.Name), http.StatusBadRequest)
+						return
+					}
+					pendingCalls = pendingCalls[1:]
+				}
+			}
+		}
+		requests = append(requests, req)
+		fmt.Fprintf(w, "data: %s\n\n", replies[len(requests)-1])
+	}))
+	defer srv.Close()
+	old := geminiBaseURL
+	geminiBaseURL = srv.URL
+	defer func() { geminiBaseURL = old }()
+
+	g := NewGeminiService("key")
+	messages := []ChatMessageReq{
+		{Role: "system", Content: "You are a binary analyst."},
+		{Role: "user", Content: "What is in the first file?"},
+	}
+	var answer string
+	for turn := 0; turn < len(replies); turn++ {
+		var text string
+		var calls []ToolCall
+		err := g.StreamChatWithTools("gemini-test", messages, nil, func(resp StreamResponse) error {
+			text += resp.Content
+			calls = append(calls, resp.ToolCalls...)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("turn %d: %v", turn, err)
+		}
+		if len(calls) == 0 {
+			answer = text
+			break
+		}
+		// As the chat handler does: the assistant turn with its calls, then
+		// one result per call
+		messages = append(messages, ChatMessageReq{Role: "assistant", Content: text, ToolCalls: calls})
+		for _, call := range calls {
+			messages = append(messages, ChatMessageReq{Role: "tool", Content: "result of " + call.Function.Name, ToolName: call.Function.Name})
+		}
+	}
+
+	if answer != "It starts with ECG." || len(requests) != 3 {
+		t.Fatalf("answer = %q after %d requests", answer, len(requests))
+	}
+	last := requests[2].Contents
+	if len(last) != 5 {
+		t.Fatalf("last request has %d contents, want user, model, user, model, user: %+v", len(last), last)
+	}
+	if first := last[1].Parts[0]; first.FunctionCall == nil || first.ThoughtSignature != "sig1" {
+		t.Errorf("first call = %+v, want list_files with its thought signature", first)
+	}
+	if resp := last[2].Parts[0].FunctionResponse; last[2].Role != "user" || resp == nil || resp.Response["content"] != "result of list_files" {
+		t.Errorf("first result = %+v", last[2])
+	}
+	if !strings.HasPrefix(last[0].Parts[0].Text, "You are a binary analyst.") {
+		t.Errorf("system prompt not prepended: %q", last[0].Parts[0].Text)
+	}
+}
@@ -1,15 +1,27 @@
 package services
 
 import (
+	"binary-annotator-pro/metrics"
 	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"sort"
 	"time"
 )
 
+// Search defaults, applied when a caller passes 0. DefaultRAGMinScore is the
+// cosine similarity below which chunks are considered unrelated to the query.
+const (
+	DefaultRAGMaxResults = 5
+	DefaultRAGMinScore   = 0.3
+)
+
+// DefaultRAGURL is the RAG service address when RAG_API_URL is unset
+const DefaultRAGURL = "http://localhost:3003"
+
 // RAGService handles communication with the RAG service
 type RAGService struct {
 	baseURL string
@@ -22,6 +34,11 @@ type RAGSearchRequest struct {
 	Type       []string `json:"type,omitempty"`
 	MaxResults int      `json:"max_results,omitempty"`
 	MinScore   float64  `json:"min_score,omitempty"`
+	// IncludeNeighbors asks for the chunks around each match, see
+	// RAGSearchResult.Neighbors
+	IncludeNeighbors bool `json:"include_neighbors,omitempty"`
+	// MaxPerDocument caps the chunks of any one document in the results
+	MaxPerDocument int `json:"max_per_document,omitempty"`
 }
 
 // RAGSearchResult represents a single search result
@@ -34,6 +51,53 @@ type RAGSearchResult struct {
 	Source     string  `json:"source"`
 	Score      float64 `json:"score"`
 	Metadata   string  `json:"metadata,omitempty"`
+	// Neighbors holds the chunks just before and after this one in its
+	// document, ordered by ChunkID, when the search asked for them
+	Neighbors []RAGChunk `json:"neighbors,omitempty"`
+}
+
+// RAGChunk is a chunk of an indexed document. ChunkIndex is its position in
+// the document; services predating it only send ChunkID, which holds the
+// same number.
+type RAGChunk struct {
+	ChunkID    uint   `json:"chunk_id"`
+	ChunkIndex *int   `json:"chunk_index,omitempty"`
+	Content    string `json:"content"`
+}
+
+// Position returns the chunk's position in its document
+func (c RAGChunk) Position() int {
+	if c.ChunkIndex != nil {
+		return *c.ChunkIndex
+	}
+	return int(c.ChunkID)
+}
+
+// sortChunks puts chunks in document order
+func sortChunks(chunks []RAGChunk) {
+	sort.SliceStable(chunks, func(i, j int) bool { return chunks[i].Position() < chunks[j].Position() })
+}
+
+// RAGDocumentChunks is an indexed document with its chunks in order
+type RAGDocumentChunks struct {
+	DocumentID uint       `json:"document_id"`
+	Title      string     `json:"title"`
+	Type       string     `json:"type"`
+	Source     string     `json:"source"`
+	ChunkCount int        `json:"chunk_count"`
+	Chunks     []RAGChunk `json:"chunks"`
+}
+
+// RAGSearchOptions narrows a search. Zero MaxResults and MinScore use
+// DefaultRAGMaxResults / DefaultRAGMinScore.
+type RAGSearchOptions struct {
+	Types            []string
+	MaxResults       int
+	MinScore         float64
+	IncludeNeighbors bool
+	// MaxPerDocument, when set, keeps at most that many chunks of any one
+	// document, the best scoring ones, so results cover more documents
+	MaxPerDocument int
 }
 
 // RAGSearchResponse represents the response from RAG search
@@ -43,10 +107,19 @@ type RAGSearchResponse struct {
 	Count   int               `json:"count"`
 }
 
-// NewRAGService creates a new RAG service client
+// RAGURL returns RAG_API_URL, or DefaultRAGURL when it is unset
+func RAGURL() string {
+	if url := os.Getenv("RAG_API_URL"); url != "" {
+		return url
+	}
+	return DefaultRAGURL
+}
+
+// NewRAGService creates a new RAG service client. An empty baseURL uses
+// RAGURL(), so every handler talks to the same service.
 func NewRAGService(baseURL string) *RAGService {
 	if baseURL == "" {
-		baseURL = os.Getenv("RAG_API_URL")
+		baseURL = RAGURL()
 	}
 	return &RAGService{
 		baseURL: baseURL,
@@ -56,20 +129,36 @@ func NewRAGService(baseURL string) *RAGService {
 	}
 }
 
-// Search performs a semantic search in the RAG service
+// Search performs a semantic search in the RAG service. A maxResults or
+// minScore of 0 uses DefaultRAGMaxResults / DefaultRAGMinScore.
 func (rs *RAGService) Search(query string, docTypes []string, maxResults int, minScore float64) (*RAGSearchResponse, error) {
-	if maxResults == 0 {
-		maxResults = 5
+	return rs.SearchWithOptions(query, RAGSearchOptions{Types: docTypes, MaxResults: maxResults, MinScore: minScore})
+}
+
+// SearchWithOptions performs a semantic search with the options Search
+// doesn't take, such as the neighbouring chunks of each match
+func (rs *RAGService) SearchWithOptions(query string, opts RAGSearchOptions) (*RAGSearchResponse, error) {
+	start := time.Now()
+	resp, err := rs.search(query, opts)
+	metrics.RAGSearchDuration.WithLabelValues(metrics.Status(err)).Observe(metrics.Since(start))
+	return resp, err
+}
+
+func (rs *RAGService) search(query string, opts RAGSearchOptions) (*RAGSearchResponse, error) {
+	if opts.MaxResults <= 0 {
+		opts.MaxResults = DefaultRAGMaxResults
 	}
-	if minScore == 0 {
-		minScore = 0.3 // Default minimum relevance score
+	if opts.MinScore <= 0 {
+		opts.MinScore = DefaultRAGMinScore
 	}
 
 	reqBody := RAGSearchRequest{
-		Query:      query,
-		Type:       docTypes,
-		MaxResults: maxResults,
-		MinScore:   minScore,
+		Query:            query,
+		Type:             opts.Types,
+		MaxResults:       opts.MaxResults,
+		MinScore:         opts.MinScore,
+		IncludeNeighbors: opts.IncludeNeighbors,
+		MaxPerDocument:   opts.MaxPerDocument,
 	}
 
 	jsonData, err := json.Marshal(reqBody)
@@ -93,10 +182,45 @@ func (rs *RAGService) Search(query string, docTypes []string, maxResults int, mi
 	if err := json.NewDecoder(resp.Body).Decode(&searchResp); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
+	for _, result := range searchResp.Results {
+		sortChunks(result.Neighbors)
+	}
+	if opts.MaxPerDocument > 0 {
+		// Services predating max_per_document ignore it
+		searchResp.Results = capPerDocument(searchResp.Results, opts.MaxPerDocument)
+		searchResp.Count = len(searchResp.Results)
+	}
 
 	return &searchResp, nil
 }
 
+// capPerDocument keeps the maxPerDocument best scoring results of each
+// document, in their original order
+func capPerDocument(results []RAGSearchResult, maxPerDocument int) []RAGSearchResult {
+	byScore := make([]int, len(results))
+	for i := range byScore {
+		byScore[i] = i
+	}
+	sort.SliceStable(byScore, func(i, j int) bool { return results[byScore[i]].Score > results[byScore[j]].Score })
+
+	keep := make([]bool, len(results))
+	perDocument := make(map[uint]int)
+	for _, i := range byScore {
+		if perDocument[results[i].DocumentID] < maxPerDocument {
+			perDocument[results[i].DocumentID]++
+			keep[i] = true
+		}
+	}
+
+	capped := make([]RAGSearchResult, 0, len(results))
+	for i, result := range results {
+		if keep[i] {
+			capped = append(capped, result)
+		}
+	}
+	return capped
+}
+
 // HealthCheck checks if the RAG service is available
 func (rs *RAGService) HealthCheck() error {
 	url := fmt.Sprintf("%s/health", rs.baseURL)
@@ -122,6 +246,9 @@ type RAGIndexRequest struct {
 	Metadata      map[string]string `json:"metadata,omitempty"`
 	ChunkTokens   int               `json:"chunk_tokens,omitempty"`
 	OverlapTokens int               `json:"overlap_tokens,omitempty"`
+	// ExternalID is the caller's key for the document; indexing again with
+	// the same key replaces its chunks instead of adding a document
+	ExternalID string `json:"external_id,omitempty"`
 }
 
 // RAGIndexResponse represents the response from indexing a document
@@ -130,15 +257,20 @@ type RAGIndexResponse struct {
 	ChunkCount int  `json:"chunk_count"`
 }
 
-// RAGIndexResponseActual represents the actual response from RAG service
+// RAGIndexResponseActual is the body returned by the RAG service.
+// DocumentID and ChunkCount are authoritative; services predating them only
+// send ID and one preview per chunk in Chunks.
 type RAGIndexResponseActual struct {
-	ID     uint                     `json:"id"`
-	Chunks []map[string]interface{} `json:"chunks"`
+	DocumentID uint                     `json:"document_id"`
+	ChunkCount *int                     `json:"chunk_count"`
+	ID         uint                     `json:"id"`
+	Chunks     []map[string]interface{} `json:"chunks"`
 }
 
-// IndexDocument indexes a document in the RAG service
+// IndexDocument indexes a document in the RAG service. A chunkTokens or
+// overlapTokens of 0 uses the defaults configured in the RAG service.
 func (rs *RAGService) IndexDocument(docType, title, content, source string, metadata map[string]string, chunkTokens, overlapTokens int) (*RAGIndexResponse, error) {
-	reqBody := RAGIndexRequest{
+	return rs.index(RAGIndexRequest{
 		Type:          docType,
 		Title:         title,
 		Content:       content,
@@ -146,8 +278,23 @@ func (rs *RAGService) IndexDocument(docType, title, content, source string, meta
 		Metadata:      metadata,
 		ChunkTokens:   chunkTokens,
 		OverlapTokens: overlapTokens,
-	}
+	})
+}
+
+// UpsertDocument indexes a document under externalID, replacing the chunks
+// of the document previously indexed with that ID, if any
+func (rs *RAGService) UpsertDocument(externalID, docType, title, content, source string, metadata map[string]string) (*RAGIndexResponse, error) {
+	return rs.index(RAGIndexRequest{
+		Type:       docType,
+		Title:      title,
+		Content:    content,
+		Source:     source,
+		Metadata:   metadata,
+		ExternalID: externalID,
+	})
+}
 
+func (rs *RAGService) index(reqBody RAGIndexRequest) (*RAGIndexResponse, error) {
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
@@ -170,15 +317,107 @@ func (rs *RAGService) IndexDocument(docType, title, content, source string, meta
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	// Convert to expected format
 	indexResp := &RAGIndexResponse{
-		DocumentID: actualResp.ID,
+		DocumentID: actualResp.DocumentID,
 		ChunkCount: len(actualResp.Chunks),
 	}
+	if actualResp.DocumentID == 0 {
+		indexResp.DocumentID = actualResp.ID
+	}
+	if actualResp.ChunkCount != nil {
+		indexResp.ChunkCount = *actualResp.ChunkCount
+	}
 
 	return indexResp, nil
 }
 
+// IndexAnalysis indexes the text summary of an analysis finding (compression
+// detection, search hits, ...) as an "analysis" document, so later chats can
+// retrieve prior discoveries. A non-empty externalID replaces the summary
+// indexed under it, so repeating an analysis doesn't add duplicates.
+func (rs *RAGService) IndexAnalysis(externalID, title, summary, source string, metadata map[string]string) (*RAGIndexResponse, error) {
+	if externalID != "" {
+		return rs.UpsertDocument(externalID, "analysis", title, summary, source, metadata)
+	}
+	return rs.IndexDocument("analysis", title, summary, source, metadata, 0, 0)
+}
+
+// RAGConfig holds the chunking defaults of the RAG service
+type RAGConfig struct {
+	ChunkTokens   int `json:"chunk_tokens"`
+	OverlapTokens int `json:"overlap_tokens"`
+}
+
+// GetConfig returns the RAG service's chunking defaults
+func (rs *RAGService) GetConfig() (*RAGConfig, error) {
+	url := fmt.Sprintf("%s/config", rs.baseURL)
+	resp, err := rs.client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call RAG API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	return decodeRAGConfig(resp)
+}
+
+// RAGConfigUpdate changes some of the chunking defaults; nil fields are kept
+type RAGConfigUpdate struct {
+	ChunkTokens   *int `json:"chunk_tokens,omitempty"`
+	OverlapTokens *int `json:"overlap_tokens,omitempty"`
+}
+
+// UpdateConfig changes the RAG service's chunking defaults
+func (rs *RAGService) UpdateConfig(update RAGConfigUpdate) (*RAGConfig, error) {
+	jsonData, err := json.Marshal(update)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/config", rs.baseURL)
+	resp, err := rs.client.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to call RAG API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	return decodeRAGConfig(resp)
+}
+
+func decodeRAGConfig(resp *http.Response) (*RAGConfig, error) {
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("RAG API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var cfg RAGConfig
+	if err := json.NewDecoder(resp.Body).Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &cfg, nil
+}
+
+// GetDocument returns a document of the RAG service with its chunks in
+// document order
+func (rs *RAGService) GetDocument(documentID uint) (*RAGDocumentChunks, error) {
+	resp, err := rs.client.Get(fmt.Sprintf("%s/document/%d", rs.baseURL, documentID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to call RAG API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("RAG API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var doc RAGDocumentChunks
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	sortChunks(doc.Chunks)
+	return &doc, nil
+}
+
 // DeleteDocument deletes a document from the RAG service
 func (rs *RAGService) DeleteDocument(documentID uint) error {
 	url := fmt.Sprintf("%s/document/%d", rs.baseURL, documentID)
@@ -0,0 +1,264 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// TestRAGSearchDefaults checks omitted max_results and min_score are sent as the documented defaults
+func TestRAGSearchDefaults(t *testing.T) {
+	var got RAGSearchRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		json.NewEncoder(w).Encode(RAGSearchResponse{Query: got.Query})
+	}))
+	defer srv.Close()
+
+	rs := NewRAGService(srv.URL)
+	if _, err := rs.Search("checksum", nil, 0, 0); err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if got.MinScore != DefaultRAGMinScore || got.MaxResults != DefaultRAGMaxResults {
+		t.Errorf("sent min_score=%v max_results=%d, want %v and %d", got.MinScore, got.MaxResults, DefaultRAGMinScore, DefaultRAGMaxResults)
+	}
+
+	if _, err := rs.Search("checksum", nil, 10, 0.5); err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if got.MinScore != 0.5 || got.MaxResults != 10 {
+		t.Errorf("sent min_score=%v max_results=%d, want explicit values 0.5 and 10", got.MinScore, got.MaxResults)
+	}
+}
+
+// TestRAGIndexUsesServiceDefaults checks the request and response contract
+// of the chunking defaults: config updates send only the fields set and
+// return what the service answers, and unset chunk sizes are left out of
+// index requests for the service to fill in
+func TestRAGIndexUsesServiceDefaults(t *testing.T) {
+	var requests []string
+	var bodies []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies = append(bodies, body)
+		switch r.URL.Path {
+		case "/config":
+			w.Write([]byte(`{"chunk_tokens": 200, "overlap_tokens": 16}`))
+		case "/index/document":
+			w.Write([]byte(`{"document_id": 1, "chunk_count": 1, "id": 1, "chunks": []}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	rs := NewRAGService(srv.URL)
+	chunk := 128
+	cfg, err := rs.UpdateConfig(RAGConfigUpdate{ChunkTokens: &chunk})
+	if err != nil || *cfg != (RAGConfig{ChunkTokens: 200, OverlapTokens: 16}) {
+		t.Fatalf("UpdateConfig() = %+v, %v, want the service's answer", cfg, err)
+	}
+	if _, ok := bodies[0]["overlap_tokens"]; ok || bodies[0]["chunk_tokens"] != float64(128) {
+		t.Errorf("config update body = %v, want only chunk_tokens", bodies[0])
+	}
+
+	if _, err := rs.IndexDocument("document", "notes", "text", "user:1", nil, 0, 0); err != nil {
+		t.Fatalf("IndexDocument() error = %v", err)
+	}
+	for _, key := range []string{"chunk_tokens", "overlap_tokens"} {
+		if v, ok := bodies[1][key]; ok {
+			t.Errorf("index request sent %s=%v, want it omitted", key, v)
+		}
+	}
+
+	if _, err := rs.IndexDocument("document", "notes", "text", "user:1", nil, 512, 64); err != nil {
+		t.Fatalf("IndexDocument() error = %v", err)
+	}
+	if bodies[2]["chunk_tokens"] != float64(512) || bodies[2]["overlap_tokens"] != float64(64) {
+		t.Errorf("index request = %v, want explicit chunk sizes", bodies[2])
+	}
+
+	want := []string{"POST /config", "POST /index/document", "POST /index/document"}
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("requests = %v, want %v", requests, want)
+	}
+}
+
+// TestRAGIndexChunkCount checks the document ID and chunk count are read from
+// the service's explicit fields, and from id/chunks for older services
+func TestRAGIndexChunkCount(t *testing.T) {
+	legacy := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req RAGIndexRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		// Split like the service: chunk_tokens * 4 characters per chunk
+		n := (len(req.Content) + req.ChunkTokens*4 - 1) / (req.ChunkTokens * 4)
+		previews := make([]map[string]interface{}, n)
+		for i := range previews {
+			previews[i] = map[string]interface{}{"chunk_id": i}
+		}
+		if legacy {
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": 9, "chunks": previews})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"document_id": 7, "chunk_count": n, "id": 7, "chunks": []interface{}{}})
+	}))
+	defer srv.Close()
+
+	rs := NewRAGService(srv.URL)
+	content := string(make([]byte, 100)) // 100 bytes at 8 characters per chunk: 13 chunks
+	resp, err := rs.IndexDocument("document", "notes", content, "user:1", nil, 2, 0)
+	if err != nil {
+		t.Fatalf("IndexDocument() error = %v", err)
+	}
+	if resp.DocumentID != 7 || resp.ChunkCount != 13 {
+		t.Errorf("IndexDocument() = %+v, want document 7 with 13 chunks", *resp)
+	}
+
+	legacy = true
+	resp, err = rs.IndexDocument("document", "notes", content, "user:1", nil, 2, 0)
+	if err != nil {
+		t.Fatalf("IndexDocument() error = %v", err)
+	}
+	if resp.DocumentID != 9 || resp.ChunkCount != 13 {
+		t.Errorf("IndexDocument() from an older service = %+v, want document 9 with 13 chunks", *resp)
+	}
+}
+
+// TestRAGUpsertDocument checks the request and response contract of
+// upserts: the document goes to /index/document with its external ID, and
+// the service's document ID and chunk count are returned. Replacing the
+// document indexed under that ID is the RAG service's job.
+func TestRAGUpsertDocument(t *testing.T) {
+	var bodies []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/index/document" {
+			t.Errorf("request %s %s, want POST /index/document", r.Method, r.URL.Path)
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies = append(bodies, body)
+		w.Write([]byte(`{"document_id": 12, "chunk_count": 3, "id": 12, "chunks": []}`))
+	}))
+	defer srv.Close()
+
+	rs := NewRAGService(srv.URL)
+	resp, err := rs.UpsertDocument("session_3", "chat", "Chat - Session 3", "User: hi\n\nAssistant: hello", "session_3", map[string]string{"session_id": "3"})
+	if err != nil {
+		t.Fatalf("UpsertDocument() error = %v", err)
+	}
+	if resp.DocumentID != 12 || resp.ChunkCount != 3 {
+		t.Errorf("UpsertDocument() = %+v, want the service's document 12 with 3 chunks", *resp)
+	}
+
+	want := map[string]interface{}{
+		"external_id": "session_3",
+		"type":        "chat",
+		"title":       "Chat - Session 3",
+		"content":     "User: hi\n\nAssistant: hello",
+		"source":      "session_3",
+		"metadata":    map[string]interface{}{"session_id": "3"},
+	}
+	if !reflect.DeepEqual(bodies[0], want) {
+		t.Errorf("upsert request = %v, want %v", bodies[0], want)
+	}
+
+	// Plain indexing sends no external ID, so it always adds a document
+	if _, err := rs.IndexDocument("document", "notes", "text", "user:1", nil, 0, 0); err != nil {
+		t.Fatalf("IndexDocument() error = %v", err)
+	}
+	if v, ok := bodies[1]["external_id"]; ok {
+		t.Errorf("index request sent external_id=%v, want it omitted", v)
+	}
+}
+
+// TestRAGSearchNeighbors checks the request and response contract of
+// neighbouring chunks: include_neighbors is sent only when asked for, and the
+// neighbours the service returns are decoded and put in document order.
+// Looking them up is the RAG service's job.
+func TestRAGSearchNeighbors(t *testing.T) {
+	var got map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = nil
+		json.NewDecoder(r.Body).Decode(&got)
+		// Neighbours out of order, as a vector store may return them
+		w.Write([]byte(`{"query": "lead blocks", "count": 1, "results": [{
+			"document_id": 4, "chunk_id": 2, "title": "Device manual", "content": "3. Lead data blocks", "score": 0.8,
+			"neighbors": [
+				{"chunk_id": 3, "chunk_index": 3, "content": "4. Checksums"},
+				{"chunk_id": 1, "chunk_index": 1, "content": "2. Header layout"}
+			]}]}`))
+	}))
+	defer srv.Close()
+
+	rs := NewRAGService(srv.URL)
+	if _, err := rs.Search("lead blocks", nil, 0, 0); err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if v, ok := got["include_neighbors"]; ok {
+		t.Errorf("plain search sent include_neighbors=%v", v)
+	}
+
+	resp, err := rs.SearchWithOptions("lead blocks", RAGSearchOptions{IncludeNeighbors: true})
+	if err != nil {
+		t.Fatalf("SearchWithOptions() error = %v", err)
+	}
+	if got["include_neighbors"] != true || got["max_results"] != float64(DefaultRAGMaxResults) {
+		t.Errorf("sent %v, want include_neighbors and the default max_results", got)
+	}
+	neighbors := resp.Results[0].Neighbors
+	if len(neighbors) != 2 || neighbors[0].ChunkID != 1 || neighbors[1].ChunkID != 3 || neighbors[0].Content != "2. Header layout" {
+		t.Errorf("neighbors = %+v, want chunks 1 and 3 in order", neighbors)
+	}
+}
+
+// TestRAGSearchMaxPerDocument checks max_per_document is sent and enforced:
+// of a manual whose many similar chunks all match, only the best ones are
+// kept, leaving the other documents in the results
+func TestRAGSearchMaxPerDocument(t *testing.T) {
+	var got RAGSearchRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = RAGSearchRequest{}
+		json.NewDecoder(r.Body).Decode(&got)
+		// A service ignoring the cap: document 1 has eight near-identical chunks
+		var results []RAGSearchResult
+		for i := 0; i < 8; i++ {
+			results = append(results, RAGSearchResult{DocumentID: 1, ChunkID: uint(i), Score: 0.9 - float64(i%4)*0.01})
+		}
+		results = append(results, RAGSearchResult{DocumentID: 2, Score: 0.7}, RAGSearchResult{DocumentID: 3, Score: 0.6})
+		json.NewEncoder(w).Encode(RAGSearchResponse{Query: got.Query, Results: results, Count: len(results)})
+	}))
+	defer srv.Close()
+
+	rs := NewRAGService(srv.URL)
+	resp, err := rs.SearchWithOptions("sampling rate", RAGSearchOptions{MaxResults: 10, MaxPerDocument: 2})
+	if err != nil {
+		t.Fatalf("SearchWithOptions() error = %v", err)
+	}
+	if got.MaxPerDocument != 2 {
+		t.Errorf("sent max_per_document=%d, want 2", got.MaxPerDocument)
+	}
+
+	perDocument := map[uint]int{}
+	for _, r := range resp.Results {
+		perDocument[r.DocumentID]++
+		if r.DocumentID == 1 && r.Score != 0.9 {
+			t.Errorf("kept chunk %d of document 1 with score %v, want only the 0.9 ones", r.ChunkID, r.Score)
+		}
+	}
+	if perDocument[1] != 2 || perDocument[2] != 1 || perDocument[3] != 1 || resp.Count != 4 {
+		t.Errorf("results per document = %v (count %d), want 2, 1 and 1", perDocument, resp.Count)
+	}
+
+	// Without the option every chunk is returned
+	resp, err = rs.Search("sampling rate", nil, 10, 0)
+	if err != nil || len(resp.Results) != 10 || got.MaxPerDocument != 0 {
+		t.Errorf("uncapped search: %d results, max_per_document=%d, err %v", len(resp.Results), got.MaxPerDocument, err)
+	}
+}
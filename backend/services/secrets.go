@@ -0,0 +1,167 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SecretsKeyEnv names the environment variable holding the master key that
+// protects provider API keys at rest: 32 bytes in base64, or any passphrase
+// (hashed with SHA-256)
+const SecretsKeyEnv = "AI_SETTINGS_KEY"
+
+// secretPrefix marks an encrypted value. The rest is the wrapped data key and
+// the ciphertext, both base64, separated by a colon. Both are sealed with the
+// scope of the value as additional data.
+const secretPrefix = "enc:v2:"
+
+// legacySecretPrefix marks values encrypted before scopes were bound; they
+// are still decrypted, and re-encrypted with their scope by EncryptSecret.
+const legacySecretPrefix = "enc:v1:"
+
+// ErrNoSecretsKey is returned when decrypting without AI_SETTINGS_KEY set
+var ErrNoSecretsKey = errors.New(SecretsKeyEnv + " is not set")
+
+// secretsKey returns the master key, or nil when AI_SETTINGS_KEY is unset
+func secretsKey() []byte {
+	v := os.Getenv(SecretsKeyEnv)
+	if v == "" {
+		return nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(v); err == nil && len(key) == 32 {
+		return key
+	}
+	sum := sha256.Sum256([]byte(v))
+	return sum[:]
+}
+
+// SecretsEnabled reports whether AI_SETTINGS_KEY is set, so secrets are
+// encrypted when stored
+func SecretsEnabled() bool {
+	return secretsKey() != nil
+}
+
+// IsEncryptedSecret reports whether a stored value was made by EncryptSecret
+func IsEncryptedSecret(stored string) bool {
+	return strings.HasPrefix(stored, secretPrefix) || strings.HasPrefix(stored, legacySecretPrefix)
+}
+
+// EncryptSecret encrypts plaintext with a fresh data key, itself encrypted
+// (wrapped) with the master key: envelope encryption, so the master key only
+// ever encrypts random keys. scope names where the value is stored (row and
+// field) and is authenticated with it, so a ciphertext copied elsewhere fails
+// to decrypt. Empty and already encrypted values are returned as they are,
+// except legacy ones which are re-encrypted with scope, and so is everything
+// when AI_SETTINGS_KEY is unset.
+func EncryptSecret(plaintext, scope string) (string, error) {
+	master := secretsKey()
+	if master == nil || plaintext == "" || strings.HasPrefix(plaintext, secretPrefix) {
+		return plaintext, nil
+	}
+	if strings.HasPrefix(plaintext, legacySecretPrefix) {
+		legacy, err := openSecret(master, strings.TrimPrefix(plaintext, legacySecretPrefix), nil)
+		if err != nil {
+			return "", err
+		}
+		plaintext = legacy
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", fmt.Errorf("generate data key: %w", err)
+	}
+	wrapped, err := sealGCM(master, dataKey, []byte(scope))
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := sealGCM(dataKey, []byte(plaintext), []byte(scope))
+	if err != nil {
+		return "", err
+	}
+	return secretPrefix + base64.StdEncoding.EncodeToString(wrapped) + ":" + base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// DecryptSecret returns the plaintext of a value stored by EncryptSecret with
+// the same scope. Values stored before encryption was enabled are returned
+// unchanged.
+func DecryptSecret(stored, scope string) (string, error) {
+	if !IsEncryptedSecret(stored) {
+		return stored, nil
+	}
+	master := secretsKey()
+	if master == nil {
+		return "", ErrNoSecretsKey
+	}
+	if rest, ok := strings.CutPrefix(stored, legacySecretPrefix); ok {
+		return openSecret(master, rest, nil)
+	}
+	return openSecret(master, strings.TrimPrefix(stored, secretPrefix), []byte(scope))
+}
+
+// openSecret decrypts the wrapped data key and ciphertext of an encrypted
+// value, without its prefix
+func openSecret(master []byte, sealed string, additional []byte) (string, error) {
+	wrappedB64, ciphertextB64, ok := strings.Cut(sealed, ":")
+	if !ok {
+		return "", errors.New("malformed encrypted secret")
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(wrappedB64)
+	if err != nil {
+		return "", fmt.Errorf("malformed encrypted secret: %w", err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(ciphertextB64)
+	if err != nil {
+		return "", fmt.Errorf("malformed encrypted secret: %w", err)
+	}
+
+	dataKey, err := openGCM(master, wrapped, additional)
+	if err != nil {
+		return "", fmt.Errorf("unwrap data key (wrong %s or scope?): %w", SecretsKeyEnv, err)
+	}
+	plaintext, err := openGCM(dataKey, ciphertext, additional)
+	if err != nil {
+		return "", fmt.Errorf("decrypt secret: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// sealGCM encrypts with AES-256-GCM, prefixing the random nonce and
+// authenticating additional
+func sealGCM(key, plaintext, additional []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+// openGCM reverses sealGCM
+func openGCM(key, sealed, additional []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additional)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
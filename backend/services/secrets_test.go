@@ -0,0 +1,80 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestEncryptSecretRoundTrip encrypts with a fresh data key each time and
+// decrypts only with the same master key
+func TestEncryptSecretRoundTrip(t *testing.T) {
+	t.Setenv(SecretsKeyEnv, "correct horse battery staple")
+
+	first, err := EncryptSecret("sk-test-123", "ai_settings/u1/openai_key")
+	if err != nil {
+		t.Fatalf("EncryptSecret() error = %v", err)
+	}
+	second, _ := EncryptSecret("sk-test-123", "ai_settings/u1/openai_key")
+	if !IsEncryptedSecret(first) || strings.Contains(first, "sk-test-123") || first == second {
+		t.Fatalf("EncryptSecret() = %q, %q: want distinct ciphertexts without the plaintext", first, second)
+	}
+	if again, _ := EncryptSecret(first, "ai_settings/u1/openai_key"); again != first {
+		t.Errorf("encrypting an encrypted value changed it")
+	}
+	if got, err := DecryptSecret(first, "ai_settings/u1/openai_key"); err != nil || got != "sk-test-123" {
+		t.Errorf("DecryptSecret() = %q, %v, want sk-test-123", got, err)
+	}
+	if got, err := DecryptSecret("sk-legacy-plain", "ai_settings/u1/openai_key"); err != nil || got != "sk-legacy-plain" {
+		t.Errorf("DecryptSecret(plaintext) = %q, %v, want it unchanged", got, err)
+	}
+
+	t.Setenv(SecretsKeyEnv, "another passphrase")
+	if _, err := DecryptSecret(first, "ai_settings/u1/openai_key"); err == nil {
+		t.Error("DecryptSecret() with the wrong master key succeeded")
+	}
+
+	t.Setenv(SecretsKeyEnv, "")
+	if _, err := DecryptSecret(first, "ai_settings/u1/openai_key"); !errors.Is(err, ErrNoSecretsKey) {
+		t.Errorf("DecryptSecret() without a key error = %v, want ErrNoSecretsKey", err)
+	}
+	if got, _ := EncryptSecret("sk-test-123", "ai_settings/u1/openai_key"); got != "sk-test-123" {
+		t.Errorf("EncryptSecret() without a key = %q, want the plaintext", got)
+	}
+}
+
+// TestEncryptSecretScope binds a ciphertext to its scope, so it cannot be
+// moved to another row or field, and upgrades values sealed without one
+func TestEncryptSecretScope(t *testing.T) {
+	t.Setenv(SecretsKeyEnv, "correct horse battery staple")
+
+	stored, err := EncryptSecret("sk-test-123", "ai_settings/alice/openai_key")
+	if err != nil {
+		t.Fatalf("EncryptSecret() error = %v", err)
+	}
+	for _, scope := range []string{"ai_settings/mallory/openai_key", "ai_settings/alice/claude_key", ""} {
+		if got, err := DecryptSecret(stored, scope); err == nil {
+			t.Errorf("DecryptSecret(scope %q) = %q, want an error", scope, got)
+		}
+	}
+
+	// A value encrypted before scopes were bound
+	dataKey := make([]byte, 32)
+	wrapped, _ := sealGCM(secretsKey(), dataKey, nil)
+	ciphertext, _ := sealGCM(dataKey, []byte("sk-legacy"), nil)
+	legacy := legacySecretPrefix + base64.StdEncoding.EncodeToString(wrapped) + ":" + base64.StdEncoding.EncodeToString(ciphertext)
+	if !IsEncryptedSecret(legacy) {
+		t.Fatal("IsEncryptedSecret(legacy) = false")
+	}
+	if got, err := DecryptSecret(legacy, "ai_settings/alice/openai_key"); err != nil || got != "sk-legacy" {
+		t.Errorf("DecryptSecret(legacy) = %q, %v, want sk-legacy", got, err)
+	}
+	upgraded, err := EncryptSecret(legacy, "ai_settings/alice/openai_key")
+	if err != nil || !strings.HasPrefix(upgraded, secretPrefix) {
+		t.Fatalf("EncryptSecret(legacy) = %q, %v, want a scoped ciphertext", upgraded, err)
+	}
+	if got, err := DecryptSecret(upgraded, "ai_settings/alice/openai_key"); err != nil || got != "sk-legacy" {
+		t.Errorf("DecryptSecret(upgraded) = %q, %v, want sk-legacy", got, err)
+	}
+}
@@ -41,6 +41,7 @@ interface CompressionResult {
   validation_msg: string;
   error: string;
   decompressed_file_id?: number;
+  preview_hex?: string; // first 256 decompressed bytes
 }
 
 interface CompressionAnalysis {
@@ -609,6 +610,17 @@ export function CompressionDetection({
                                   Decompressed:{" "}
                                   {formatBytes(result.decompressed_size)}
                                 </div>
+                                {result.preview_hex && (
+                                  <div
+                                    className="font-mono text-muted-foreground truncate max-w-[12rem]"
+                                    title={result.preview_hex.match(/../g)?.join(" ")}
+                                  >
+                                    {result.preview_hex
+                                      .slice(0, 32)
+                                      .match(/../g)
+                                      ?.join(" ")}
+                                  </div>
+                                )}
                               </div>
                             ) : (
                               <span className="text-muted-foreground">-</span>
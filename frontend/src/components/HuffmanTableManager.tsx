@@ -10,6 +10,7 @@ import { Button } from "@/components/ui/button";
 import { Input } from "@/components/ui/input";
 import { Label } from "@/components/ui/label";
 import { Textarea } from "@/components/ui/textarea";
+import { Checkbox } from "@/components/ui/checkbox";
 import {
   Table,
   TableBody,
@@ -34,6 +35,11 @@ interface HuffmanEntry {
   code_length: number;
 }
 
+// kraftSum is the Kraft sum of the code lengths: above 1 they can't form a
+// prefix code, below 1 some bit patterns decode to nothing
+const kraftSum = (entries: HuffmanEntry[]) =>
+  entries.reduce((sum, e) => sum + Math.pow(2, -e.code_length), 0);
+
 interface HuffmanTableManagerProps {
   open: boolean;
   onClose: () => void;
@@ -51,6 +57,7 @@ export function HuffmanTableManager({
   const [tableName, setTableName] = useState("");
   const [tableDescription, setTableDescription] = useState("");
   const [entries, setEntries] = useState<HuffmanEntry[]>([{ symbol: 0, code_length: 1 }]);
+  const [allowIncomplete, setAllowIncomplete] = useState(false);
   const [loading, setLoading] = useState(false);
   const { toast } = useToast();
 
@@ -99,12 +106,13 @@ export function HuffmanTableManager({
       setEditingTableId(id);
       setTableName(table.name);
       setTableDescription(table.description || "");
-      setEntries(
+      const tableEntries =
         table.entries?.map((e) => ({
           symbol: e.symbol,
           code_length: e.code_length,
-        })) || []
-      );
+        })) || [];
+      setEntries(tableEntries);
+      setAllowIncomplete(kraftSum(tableEntries) < 1);
       setShowCreateForm(true);
     } catch (error) {
       toast({
@@ -142,6 +150,7 @@ export function HuffmanTableManager({
           name: tableName,
           description: tableDescription,
           entries,
+          allow_incomplete: allowIncomplete,
         });
 
         toast({
@@ -158,6 +167,7 @@ export function HuffmanTableManager({
           name: tableName,
           description: tableDescription,
           entries,
+          allow_incomplete: allowIncomplete,
         });
 
         toast({
@@ -174,6 +184,7 @@ export function HuffmanTableManager({
       setEditingTableId(null);
       setTableName("");
       setTableDescription("");
+      setAllowIncomplete(false);
       setEntries([{ symbol: 0, code_length: 1 }]);
       await loadTables();
     } catch (error) {
@@ -333,6 +344,7 @@ export function HuffmanTableManager({
                     setEditingTableId(null);
                     setTableName("");
                     setTableDescription("");
+                    setAllowIncomplete(false);
                     setEntries([{ symbol: 0, code_length: 1 }]);
                   }}
                 >
@@ -417,6 +429,18 @@ export function HuffmanTableManager({
                       ))}
                     </div>
                   </div>
+
+                  <div className="flex items-center gap-2 mt-2">
+                    <Checkbox
+                      id="allow-incomplete"
+                      checked={allowIncomplete}
+                      onCheckedChange={(checked) => setAllowIncomplete(checked === true)}
+                    />
+                    <Label htmlFor="allow-incomplete" className="text-sm font-normal">
+                      Allow incomplete code (Kraft sum {kraftSum(entries).toFixed(4)}, must
+                      be 1 unless allowed)
+                    </Label>
+                  </div>
                 </div>
               </div>
 
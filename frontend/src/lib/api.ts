@@ -42,7 +42,8 @@ export async function fetchBinaryList() {
     throw new Error("Failed to fetch binary list");
   }
 
-  return await res.json();
+  const data = await res.json();
+  return data.files;
 }
 
 export async function fetchBinaryFile(name: string) {
@@ -1004,18 +1004,24 @@ tags:
                     <code className="text-sm font-mono">/get/list/binary</code>
                   </div>
                   <p className="text-sm text-muted-foreground mb-2">
-                    List all binary files with metadata
+                    List binary files with metadata. Optional query params:
+                    limit, offset, vendor, q (name substring)
                   </p>
                   <div className="bg-background rounded p-3 text-xs">
                     <p className="font-semibold mb-1">Response:</p>
-                    <pre className="overflow-x-auto">{`[
-  {
-    "id": 1,
-    "name": "file.bin",
-    "size": 1024,
-    "created_at": "2025-01-20T10:00:00Z"
-  }
-]`}</pre>
+                    <pre className="overflow-x-auto">{`{
+  "files": [
+    {
+      "id": 1,
+      "name": "file.bin",
+      "size": 1024,
+      "created_at": "2025-01-20T10:00:00Z"
+    }
+  ],
+  "total": 1,
+  "limit": 0,
+  "offset": 0
+}`}</pre>
                   </div>
                 </div>
 
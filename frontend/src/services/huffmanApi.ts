@@ -27,6 +27,7 @@ export interface CreateHuffmanTableRequest {
     symbol: number;
     code_length: number;
   }[];
+  allow_incomplete?: boolean; // accept code lengths whose Kraft sum is below 1
 }
 
 export interface DecodeHuffmanRequest {
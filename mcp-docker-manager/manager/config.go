@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// ServerConfig is how a server is launched. Configs are persisted so servers
+// flagged Autostart come back when the manager restarts.
+type ServerConfig struct {
+	Name      string            `json:"name"`
+	Image     string            `json:"image"`
+	Env       map[string]string `json:"env,omitempty"`
+	Volumes   []string          `json:"volumes,omitempty"` // docker -v specs, e.g. "mcp-data:/data"
+	Autostart bool              `json:"autostart"`
+}
+
+// dockerArgs returns the docker run flags for the config's env and volumes
+func (c ServerConfig) dockerArgs() []string {
+	var args []string
+	keys := make([]string, 0, len(c.Env))
+	for k := range c.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "-e", k+"="+c.Env[k])
+	}
+	for _, v := range c.Volumes {
+		args = append(args, "-v", v)
+	}
+	return args
+}
+
+// maskedEnvValue replaces env values in API responses
+const maskedEnvValue = "****"
+
+// maskEnv returns env with every value replaced by maskedEnvValue
+func maskEnv(env map[string]string) map[string]string {
+	if env == nil {
+		return nil
+	}
+	masked := make(map[string]string, len(env))
+	for k := range env {
+		masked[k] = maskedEnvValue
+	}
+	return masked
+}
+
+// unmaskEnv returns env with values still masked taken from saved, so a
+// config read back from the API and sent again keeps its secrets
+func unmaskEnv(env, saved map[string]string) map[string]string {
+	for k, v := range env {
+		if old, ok := saved[k]; ok && v == maskedEnvValue {
+			env[k] = old
+		}
+	}
+	return env
+}
+
+// configStore keeps server configs in a JSON file. A store with an empty path
+// keeps them in memory only.
+type configStore struct {
+	path    string
+	mu      sync.Mutex
+	configs map[string]ServerConfig
+}
+
+// loadConfigStore reads the configs at path; a missing file is an empty store
+func loadConfigStore(path string) (*configStore, error) {
+	s := &configStore{path: path, configs: make(map[string]ServerConfig)}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read server config: %w", err)
+	}
+
+	var configs []ServerConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse server config %s: %w", path, err)
+	}
+	for _, c := range configs {
+		s.configs[c.Name] = c
+	}
+	return s, nil
+}
+
+// List returns the configs ordered by name
+func (s *configStore) List() []ServerConfig {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list()
+}
+
+func (s *configStore) list() []ServerConfig {
+	configs := make([]ServerConfig, 0, len(s.configs))
+	for _, c := range s.configs {
+		configs = append(configs, c)
+	}
+	sort.Slice(configs, func(i, j int) bool { return configs[i].Name < configs[j].Name })
+	return configs
+}
+
+// Get returns the config for name
+func (s *configStore) Get(name string) (ServerConfig, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.configs[name]
+	return c, ok
+}
+
+// Put records a config and writes the file
+func (s *configStore) Put(c ServerConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.configs[c.Name] = c
+	return s.save()
+}
+
+// save writes the file atomically, so a crash never leaves it half-written
+func (s *configStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s.list(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write server config: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write server config: %w", err)
+	}
+	return nil
+}
+
+// Autostart launches every persisted server flagged autostart. Failures are
+// logged; the others still start.
+func (m *MCPManager) Autostart(ctx context.Context) []string {
+	var started []string
+	for _, cfg := range m.configs.List() {
+		if !cfg.Autostart {
+			continue
+		}
+		if err := m.StartServer(ctx, cfg); err != nil {
+			log.Printf("Warning: autostart of %s failed: %v", cfg.Name, err)
+			continue
+		}
+		started = append(started, cfg.Name)
+	}
+	return started
+}
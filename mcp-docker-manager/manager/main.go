@@ -4,12 +4,19 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -32,27 +39,166 @@ type MCPServer struct {
 	stdin        io.WriteCloser
 	stdout       io.ReadCloser
 	stderr       io.ReadCloser
-	Tools        []Tool
+	Tools        []Tool       // guarded by toolsMu
+	toolsMu      sync.RWMutex // separate from mu, which is held for whole calls
 	mu           sync.Mutex
 	responseChan chan string   // Channel for JSON-RPC responses
 	stopChan     chan struct{} // Channel to stop the reader goroutine
 }
 
+// managedLabel marks the containers started by this manager
+const managedLabel = "managed-by=mcp-docker-manager"
+
+// dockerCommand is the docker CLI to run; tests point it at a fake
+var dockerCommand = "docker"
+
 // MCPManager manages multiple MCP server containers
 type MCPManager struct {
 	servers map[string]*MCPServer
 	mu      sync.RWMutex
+
+	// allowedImages restricts the images StartServer may run; empty allows any
+	allowedImages []string
+
+	// allowedMounts are the host paths bind mounts may come from; named
+	// volumes are always allowed
+	allowedMounts []string
+
+	// configs persists how servers were started, for autostart
+	configs *configStore
 }
 
-// NewMCPManager creates a new MCP manager
+// errImageNotAllowed is returned by StartServer for images off the allowlist
+var errImageNotAllowed = errors.New("image not allowed")
+
+// errVolumeNotAllowed is returned by StartServer for bind mounts of host
+// paths off the mount allowlist
+var errVolumeNotAllowed = errors.New("volume not allowed")
+
+// errInvalidEnv is returned by StartServer for env names docker can't pass
+var errInvalidEnv = errors.New("invalid env variable")
+
+var (
+	volumeNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+	envNamePattern    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// NewMCPManager creates a new MCP manager. MCP_IMAGE_ALLOWLIST is a
+// comma-separated list of images ("mcp/filesystem", which allows any tag, or
+// "mcp/filesystem:1.2") and registry prefixes ending in "/" ("ghcr.io/acme/").
+// Volumes are limited to named volumes unless MCP_VOLUME_ALLOWLIST lists the
+// host directories bind mounts may come from ("/srv/mcp,/data/samples").
+// Server configs are persisted to MCP_CONFIG_FILE (default
+// data/mcp-servers.json; "none" disables persistence).
 func NewMCPManager() (*MCPManager, error) {
-	return &MCPManager{
+	configPath := os.Getenv("MCP_CONFIG_FILE")
+	switch configPath {
+	case "":
+		configPath = filepath.Join("data", "mcp-servers.json")
+	case "none":
+		configPath = ""
+	}
+	configs, err := loadConfigStore(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &MCPManager{
 		servers: make(map[string]*MCPServer),
-	}, nil
+		configs: configs,
+	}
+	for _, entry := range strings.Split(os.Getenv("MCP_IMAGE_ALLOWLIST"), ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			m.allowedImages = append(m.allowedImages, entry)
+		}
+	}
+	if len(m.allowedImages) == 0 {
+		log.Printf("Warning: MCP_IMAGE_ALLOWLIST is not set, any image can be started through the API")
+	}
+	for _, entry := range strings.Split(os.Getenv("MCP_VOLUME_ALLOWLIST"), ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			m.allowedMounts = append(m.allowedMounts, filepath.Clean(entry))
+		}
+	}
+	return m, nil
+}
+
+// volumeAllowed reports whether a docker -v spec is a named volume, an
+// anonymous one, or a bind mount of a path under the mount allowlist
+func (m *MCPManager) volumeAllowed(spec string) bool {
+	source, _, hasTarget := strings.Cut(spec, ":")
+	if !hasTarget {
+		// "/data" alone is an anonymous volume at that container path
+		return strings.HasPrefix(spec, "/")
+	}
+	if volumeNamePattern.MatchString(source) {
+		return true
+	}
+	if !filepath.IsAbs(source) {
+		return false
+	}
+	source = filepath.Clean(source)
+	for _, dir := range m.allowedMounts {
+		if source == dir || strings.HasPrefix(source, strings.TrimSuffix(dir, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkConfig returns why cfg may not be started, or nil
+func (m *MCPManager) checkConfig(cfg ServerConfig) error {
+	if !m.imageAllowed(cfg.Image) {
+		return fmt.Errorf("%w: %s", errImageNotAllowed, cfg.Image)
+	}
+	for _, v := range cfg.Volumes {
+		if !m.volumeAllowed(v) {
+			return fmt.Errorf("%w: %s", errVolumeNotAllowed, v)
+		}
+	}
+	for k := range cfg.Env {
+		if !envNamePattern.MatchString(k) {
+			return fmt.Errorf("%w: %q", errInvalidEnv, k)
+		}
+	}
+	return nil
+}
+
+// configErrorStatus is the HTTP status for a checkConfig error
+func configErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errImageNotAllowed), errors.Is(err, errVolumeNotAllowed):
+		return http.StatusForbidden
+	case errors.Is(err, errInvalidEnv):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// imageAllowed reports whether image matches the allowlist
+func (m *MCPManager) imageAllowed(image string) bool {
+	if len(m.allowedImages) == 0 {
+		return true
+	}
+	for _, entry := range m.allowedImages {
+		switch {
+		case image == entry:
+			return true
+		case strings.HasSuffix(entry, "/") && strings.HasPrefix(image, entry):
+			return true
+		case strings.HasPrefix(image, entry+":") || strings.HasPrefix(image, entry+"@"):
+			// An untagged entry allows any tag or digest of that image
+			return true
+		}
+	}
+	return false
 }
 
-// StartServer starts an MCP server container using docker run -i
-func (m *MCPManager) StartServer(ctx context.Context, name, image string) error {
+// StartServer starts an MCP server container using docker run -i and records
+// its config
+func (m *MCPManager) StartServer(ctx context.Context, cfg ServerConfig) error {
+	name, image := cfg.Name, cfg.Image
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -61,15 +207,21 @@ func (m *MCPManager) StartServer(ctx context.Context, name, image string) error
 		return fmt.Errorf("server %s already running", name)
 	}
 
+	if err := m.checkConfig(cfg); err != nil {
+		return err
+	}
+
 	log.Printf("Starting MCP server: %s (image: %s)", name, image)
 
 	// Use docker run -i (NOT -it) to keep stdin open without TTY
 	// TTY (-t) causes immediate exit when no terminal is attached
-	cmd := exec.Command("docker", "run", "--rm", "-i",
-		"--name", fmt.Sprintf("mcp-%s", name),
+	args := []string{"run", "--rm", "-i",
+		"--name", containerName(name),
 		"--label", fmt.Sprintf("mcp-server=%s", name),
-		"--label", "managed-by=mcp-docker-manager",
-		image)
+		"--label", managedLabel,
+	}
+	args = append(args, cfg.dockerArgs()...)
+	cmd := exec.Command(dockerCommand, append(args, image)...)
 
 	// Get stdin pipe
 	stdin, err := cmd.StdinPipe()
@@ -133,7 +285,11 @@ func (m *MCPManager) StartServer(ctx context.Context, name, image string) error
 	}
 
 	m.servers[name] = server
-	log.Printf("MCP server %s started successfully with %d tools", name, len(server.Tools))
+	log.Printf("MCP server %s started successfully with %d tools", name, len(server.tools()))
+
+	if err := m.configs.Put(cfg); err != nil {
+		log.Printf("Warning: failed to persist config of %s: %v", name, err)
+	}
 
 	return nil
 }
@@ -152,12 +308,100 @@ func (m *MCPManager) StopServer(ctx context.Context, name string) error {
 
 	server.Stop()
 
+	// --rm normally removes the container once docker run exits, but not if
+	// the run process was killed before the container went away
+	if err := removeContainer(ctx, containerName(name)); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
 	delete(m.servers, name)
 	log.Printf("MCP server %s stopped", name)
 
 	return nil
 }
 
+// ReconcileContainers removes labeled containers that no running server owns,
+// left behind when a previous manager process was killed. Their stdio is gone
+// with that process, so they cannot be adopted.
+func (m *MCPManager) ReconcileContainers(ctx context.Context) ([]string, error) {
+	out, err := exec.CommandContext(ctx, dockerCommand, "ps", "-a",
+		"--filter", "label="+managedLabel,
+		"--format", "{{.Names}}").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list managed containers: %w", err)
+	}
+
+	m.mu.RLock()
+	owned := make(map[string]bool, len(m.servers))
+	for name := range m.servers {
+		owned[containerName(name)] = true
+	}
+	m.mu.RUnlock()
+
+	var removed []string
+	var errs []error
+	for _, container := range strings.Fields(string(out)) {
+		if owned[container] {
+			continue
+		}
+		if err := removeContainer(ctx, container); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		removed = append(removed, container)
+	}
+	return removed, errors.Join(errs...)
+}
+
+// containerName is the docker container name used for a server
+func containerName(name string) string {
+	return fmt.Sprintf("mcp-%s", name)
+}
+
+// removeContainer force-removes a container; one that is already gone is fine
+func removeContainer(ctx context.Context, container string) error {
+	out, err := exec.CommandContext(ctx, dockerCommand, "rm", "-f", container).CombinedOutput()
+	if err != nil && !strings.Contains(string(out), "No such container") {
+		return fmt.Errorf("failed to remove container %s: %v: %s", container, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// StopAll stops every running server in parallel. It returns early with an
+// error if ctx expires first; the stops carry on in the background.
+func (m *MCPManager) StopAll(ctx context.Context) error {
+	m.mu.Lock()
+	servers := m.servers
+	m.servers = make(map[string]*MCPServer)
+	m.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for name, server := range servers {
+		wg.Add(1)
+		go func(name string, server *MCPServer) {
+			defer wg.Done()
+			log.Printf("Stopping MCP server: %s", name)
+			server.Stop()
+			if err := removeContainer(ctx, containerName(name)); err != nil {
+				log.Printf("Warning: %v", err)
+			}
+		}(name, server)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		log.Printf("Stopped %d MCP server(s)", len(servers))
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("MCP servers still stopping: %w", ctx.Err())
+	}
+}
+
 // Stop stops the MCP server process
 func (s *MCPServer) Stop() {
 	// Stop the reader goroutines
@@ -199,6 +443,24 @@ func (m *MCPManager) CallTool(name, toolName string, arguments map[string]interf
 	return server.CallTool(toolName, arguments)
 }
 
+// RefreshTools re-issues tools/list to a running server and returns its
+// updated tool list
+func (m *MCPManager) RefreshTools(name string) ([]Tool, error) {
+	m.mu.RLock()
+	server, exists := m.servers[name]
+	m.mu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("server %s not running", name)
+	}
+
+	if err := server.ListTools(); err != nil {
+		return nil, fmt.Errorf("failed to list tools for %s: %w", name, err)
+	}
+
+	return server.tools(), nil
+}
+
 // ListServers returns all running servers
 func (m *MCPManager) ListServers() []map[string]interface{} {
 	m.mu.RLock()
@@ -211,7 +473,7 @@ func (m *MCPManager) ListServers() []map[string]interface{} {
 			"container_id": server.Image,
 			"image":        server.Image,
 			"started":      server.Started,
-			"tools":        server.Tools,
+			"tools":        server.tools(),
 		})
 	}
 
@@ -343,6 +605,14 @@ func (s *MCPServer) Initialize() error {
 	return nil
 }
 
+// tools returns the tool list from the last tools/list. ListTools replaces
+// the slice rather than changing it, so callers may keep it.
+func (s *MCPServer) tools() []Tool {
+	s.toolsMu.RLock()
+	defer s.toolsMu.RUnlock()
+	return s.Tools
+}
+
 // ListTools retrieves the list of available tools from the MCP server
 func (s *MCPServer) ListTools() error {
 	s.mu.Lock()
@@ -387,7 +657,7 @@ func (s *MCPServer) ListTools() error {
 	// Extract tools list from result.tools array
 	if result, ok := resp["result"].(map[string]interface{}); ok {
 		if tools, ok := result["tools"].([]interface{}); ok {
-			s.Tools = make([]Tool, 0, len(tools))
+			list := make([]Tool, 0, len(tools))
 			for _, toolData := range tools {
 				if t, ok := toolData.(map[string]interface{}); ok {
 					tool := Tool{
@@ -395,14 +665,17 @@ func (s *MCPServer) ListTools() error {
 						Description: getString(t, "description"),
 						InputSchema: getMap(t, "inputSchema"),
 					}
-					s.Tools = append(s.Tools, tool)
+					list = append(list, tool)
 				}
 			}
-			toolNames := make([]string, len(s.Tools))
-			for i, t := range s.Tools {
+			s.toolsMu.Lock()
+			s.Tools = list
+			s.toolsMu.Unlock()
+			toolNames := make([]string, len(list))
+			for i, t := range list {
 				toolNames[i] = t.Name
 			}
-			log.Printf("[%s] Found %d tools: %v", s.Name, len(s.Tools), toolNames)
+			log.Printf("[%s] Found %d tools: %v", s.Name, len(list), toolNames)
 		}
 	}
 
@@ -455,6 +728,37 @@ func (s *MCPServer) CallTool(toolName string, arguments map[string]interface{})
 	return resp["result"], nil
 }
 
+// toolResultText extracts the text of a standard MCP tool result,
+// {"content": [{"type": "text", "text": "..."}, ...]}, joining text items with
+// newlines. Non-text items (images, resources) are noted by type. ok is false
+// when result does not have that shape.
+func toolResultText(result interface{}) (text string, isError bool, ok bool) {
+	m, isMap := result.(map[string]interface{})
+	if !isMap {
+		return "", false, false
+	}
+	content, isList := m["content"].([]interface{})
+	if !isList {
+		return "", false, false
+	}
+
+	parts := make([]string, 0, len(content))
+	for _, item := range content {
+		c, isMap := item.(map[string]interface{})
+		if !isMap {
+			return "", false, false
+		}
+		switch typ := getString(c, "type"); typ {
+		case "text":
+			parts = append(parts, getString(c, "text"))
+		default:
+			parts = append(parts, fmt.Sprintf("[%s content]", typ))
+		}
+	}
+	isError, _ = m["isError"].(bool)
+	return strings.Join(parts, "\n"), isError, true
+}
+
 // Helper functions to safely extract values from maps
 func getString(m map[string]interface{}, key string) string {
 	if val, ok := m[key].(string); ok {
@@ -477,12 +781,77 @@ func main() {
 		log.Fatalf("Failed to create MCP manager: %v", err)
 	}
 
+	// Clean up containers orphaned by a previous run that was killed
+	reconcileCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	removed, err := manager.ReconcileContainers(reconcileCtx)
+	cancel()
+	if err != nil {
+		log.Printf("Warning: container reconciliation: %v", err)
+	}
+	if len(removed) > 0 {
+		log.Printf("Removed %d orphaned MCP container(s): %v", len(removed), removed)
+	}
+
+	if started := manager.Autostart(context.Background()); len(started) > 0 {
+		log.Printf("Autostarted MCP server(s): %v", started)
+	}
+
 	// Setup Echo
 	e := echo.New()
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
 	e.Use(middleware.CORS())
 
+	registerRoutes(e, manager)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	log.Println("MCP Docker Manager starting on :8080")
+	if err := serve(e, ":8080", stop, shutdownTimeout, manager.StopAll); err != nil {
+		log.Fatalf("Server failed: %v", err)
+	}
+	log.Println("MCP Docker Manager stopped")
+}
+
+// shutdownTimeout bounds the graceful shutdown, including stopping containers
+// (each gets 5s to exit before it is killed)
+const shutdownTimeout = 30 * time.Second
+
+// serve runs e on addr until a signal arrives on stop, then refuses new
+// connections, lets in-flight requests finish and runs the cleanup functions,
+// all within timeout
+func serve(e *echo.Echo, addr string, stop <-chan os.Signal, timeout time.Duration, cleanup ...func(context.Context) error) error {
+	errc := make(chan error, 1)
+	go func() { errc <- e.Start(addr) }()
+
+	select {
+	case err := <-errc:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	case sig := <-stop:
+		log.Printf("Received %v, shutting down", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var errs []error
+	if err := e.Shutdown(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	for _, fn := range cleanup {
+		if err := fn(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// registerRoutes mounts the manager's HTTP API
+func registerRoutes(e *echo.Echo, manager *MCPManager) {
 	// Health check
 	e.GET("/health", func(c echo.Context) error {
 		return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
@@ -493,18 +862,39 @@ func main() {
 		return c.JSON(http.StatusOK, manager.ListServers())
 	})
 
-	// Start server
+	// Start server. Fields left out of the request come from the saved config.
 	e.POST("/servers/:name/start", func(c echo.Context) error {
 		name := c.Param("name")
 		var req struct {
-			Image string `json:"image"`
+			Image     string            `json:"image"`
+			Env       map[string]string `json:"env"`
+			Volumes   []string          `json:"volumes"`
+			Autostart *bool             `json:"autostart"`
 		}
 		if err := c.Bind(&req); err != nil {
 			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
 		}
 
-		if err := manager.StartServer(c.Request().Context(), name, req.Image); err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		cfg, _ := manager.configs.Get(name)
+		cfg.Name = name
+		if req.Image != "" {
+			cfg.Image = req.Image
+		}
+		if req.Env != nil {
+			cfg.Env = unmaskEnv(req.Env, cfg.Env)
+		}
+		if req.Volumes != nil {
+			cfg.Volumes = req.Volumes
+		}
+		if req.Autostart != nil {
+			cfg.Autostart = *req.Autostart
+		}
+		if cfg.Image == "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "image is required"})
+		}
+
+		if err := manager.StartServer(c.Request().Context(), cfg); err != nil {
+			return c.JSON(configErrorStatus(err), map[string]string{"error": err.Error()})
 		}
 
 		return c.JSON(http.StatusOK, map[string]string{"message": "server started", "name": name})
@@ -520,12 +910,59 @@ func main() {
 		return c.JSON(http.StatusOK, map[string]string{"message": "server stopped", "name": name})
 	})
 
+	// Refresh the cached tool list, for servers whose tools changed
+	e.POST("/servers/:name/refresh-tools", func(c echo.Context) error {
+		name := c.Param("name")
+		tools, err := manager.RefreshTools(name)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if strings.Contains(err.Error(), "not running") {
+				status = http.StatusNotFound
+			}
+			return c.JSON(status, map[string]string{"error": err.Error()})
+		}
+
+		return c.JSON(http.StatusOK, map[string]interface{}{"name": name, "tools": tools})
+	})
+
+	// Persisted server configs, env values masked since they often hold
+	// credentials
+	e.GET("/config/servers", func(c echo.Context) error {
+		configs := manager.configs.List()
+		for i := range configs {
+			configs[i].Env = maskEnv(configs[i].Env)
+		}
+		return c.JSON(http.StatusOK, configs)
+	})
+	e.PUT("/config/servers/:name", func(c echo.Context) error {
+		var cfg ServerConfig
+		if err := c.Bind(&cfg); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+		}
+		cfg.Name = c.Param("name")
+		if cfg.Image == "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "image is required"})
+		}
+		if saved, ok := manager.configs.Get(cfg.Name); ok {
+			cfg.Env = unmaskEnv(cfg.Env, saved.Env)
+		}
+		if err := manager.checkConfig(cfg); err != nil {
+			return c.JSON(configErrorStatus(err), map[string]string{"error": err.Error()})
+		}
+		if err := manager.configs.Put(cfg); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		cfg.Env = maskEnv(cfg.Env)
+		return c.JSON(http.StatusOK, cfg)
+	})
+
 	// Call tool
 	e.POST("/servers/:name/call", func(c echo.Context) error {
 		name := c.Param("name")
 		var req struct {
 			Tool      string                 `json:"tool"`
 			Arguments map[string]interface{} `json:"arguments"`
+			Raw       bool                   `json:"raw"` // return the MCP result object as-is
 		}
 		if err := c.Bind(&req); err != nil {
 			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
@@ -536,11 +973,17 @@ func main() {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 		}
 
+		// By default the text content is extracted, so callers get the tool
+		// output rather than the MCP envelope
+		if !req.Raw {
+			if text, isError, ok := toolResultText(result); ok {
+				if isError {
+					return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("MCP error: %s", text)})
+				}
+				return c.JSON(http.StatusOK, map[string]interface{}{"result": text})
+			}
+		}
+
 		return c.JSON(http.StatusOK, map[string]interface{}{"result": result})
 	})
-
-	log.Println("MCP Docker Manager starting on :8080")
-	if err := e.Start(":8080"); err != nil {
-		log.Fatalf("Server failed: %v", err)
-	}
 }
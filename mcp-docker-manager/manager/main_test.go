@@ -0,0 +1,502 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestMain(m *testing.M) {
+	// Tests opt in to persistence with their own MCP_CONFIG_FILE
+	os.Setenv("MCP_CONFIG_FILE", "none")
+	os.Exit(m.Run())
+}
+
+// startFakeServer registers a running server backed by `cat`, which exits
+// once its stdin is closed, like an MCP server container does
+func startFakeServer(t *testing.T, m *MCPManager, name string) *exec.Cmd {
+	t.Helper()
+	cmd := exec.Command("cat")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Skipf("cannot start cat: %v", err)
+	}
+	m.servers[name] = &MCPServer{
+		Name:     name,
+		cmd:      cmd,
+		stdin:    stdin,
+		stopChan: make(chan struct{}),
+	}
+	return cmd
+}
+
+// TestServeStopsServersOnSignal checks a shutdown signal stops every MCP
+// server process and closes the HTTP listener
+func TestServeStopsServersOnSignal(t *testing.T) {
+	logPath := fakeDocker(t)
+	manager, _ := NewMCPManager()
+	cmds := []*exec.Cmd{startFakeServer(t, manager, "a"), startFakeServer(t, manager, "b")}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	e.HideBanner, e.HidePort = true, true
+	e.Listener = ln
+	e.GET("/health", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	stop := make(chan os.Signal, 1)
+	served := make(chan error, 1)
+	go func() { served <- serve(e, "", stop, 10*time.Second, manager.StopAll) }()
+
+	url := "http://" + ln.Addr().String() + "/health"
+	if resp, err := http.Get(url); err != nil {
+		t.Fatalf("server not up: %v", err)
+	} else {
+		resp.Body.Close()
+	}
+
+	stop <- syscall.SIGTERM
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("serve() error = %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("serve did not return after the signal")
+	}
+
+	if n := len(manager.ListServers()); n != 0 {
+		t.Errorf("%d servers still registered after shutdown", n)
+	}
+	for i, cmd := range cmds {
+		if cmd.ProcessState == nil || !cmd.ProcessState.Exited() {
+			t.Errorf("server %d process still running after shutdown", i)
+		}
+	}
+	if _, err := http.Get(url); err == nil {
+		t.Error("server still accepting connections after shutdown")
+	}
+	if calls := dockerCalls(t, logPath); len(calls) != 2 || !strings.HasPrefix(calls[0], "rm -f mcp-") {
+		t.Errorf("docker calls = %q, want a container removal per server", calls)
+	}
+}
+
+// fakeDocker points dockerCommand at a script that logs its arguments, lists
+// the given containers for `docker ps` and answers the MCP handshake for
+// `docker run`; it returns the log path
+func fakeDocker(t *testing.T, containers ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "calls.log")
+	script := fmt.Sprintf(`#!/bin/sh
+echo "$@" >> %[1]q
+if [ "$1" = "ps" ]; then
+	printf '%[2]s'
+fi
+if [ "$1" = "rm" ] && [ "$3" = "mcp-gone" ]; then
+	echo "Error response from daemon: No such container: mcp-gone" >&2
+	exit 1
+fi
+if [ "$1" = "run" ]; then
+	while read -r line; do
+		case "$line" in
+		*'"initialize"'*) echo '{"jsonrpc":"2.0","id":1,"result":{}}' ;;
+		*'"tools/list"'*)
+			# Later listings add a tool, like a server whose tool set changed
+			if [ -e %[1]q.listed ]; then
+				echo '{"jsonrpc":"2.0","id":2,"result":{"tools":[{"name":"echo"},{"name":"reverse"}]}}'
+			else
+				touch %[1]q.listed
+				echo '{"jsonrpc":"2.0","id":2,"result":{"tools":[{"name":"echo"}]}}'
+			fi ;;
+		esac
+	done
+fi
+`, logPath, strings.Join(containers, `\n`))
+	path := filepath.Join(dir, "docker")
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	old := dockerCommand
+	dockerCommand = path
+	t.Cleanup(func() { dockerCommand = old })
+	return logPath
+}
+
+// dockerCalls returns the logged fake docker invocations
+func dockerCalls(t *testing.T, logPath string) []string {
+	t.Helper()
+	data, err := os.ReadFile(logPath)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+// TestReconcileRemovesOrphanedContainers checks leftover labeled containers
+// are removed on boot, except those of servers the manager is running
+func TestReconcileRemovesOrphanedContainers(t *testing.T) {
+	logPath := fakeDocker(t, "mcp-old", "mcp-live", "mcp-stale")
+	manager, _ := NewMCPManager()
+	startFakeServer(t, manager, "live")
+	defer manager.StopAll(context.Background())
+
+	removed, err := manager.ReconcileContainers(context.Background())
+	if err != nil {
+		t.Fatalf("ReconcileContainers() error = %v", err)
+	}
+	if want := []string{"mcp-old", "mcp-stale"}; !reflect.DeepEqual(removed, want) {
+		t.Errorf("removed = %v, want %v", removed, want)
+	}
+
+	want := []string{
+		"ps -a --filter label=managed-by=mcp-docker-manager --format {{.Names}}",
+		"rm -f mcp-old",
+		"rm -f mcp-stale",
+	}
+	if got := dockerCalls(t, logPath); !reflect.DeepEqual(got, want) {
+		t.Errorf("docker calls = %q, want %q", got, want)
+	}
+}
+
+// TestStopServerRemovesContainer checks StopServer force-removes the
+// container as a backstop, tolerating one --rm already removed
+func TestStopServerRemovesContainer(t *testing.T) {
+	logPath := fakeDocker(t)
+	manager, _ := NewMCPManager()
+	startFakeServer(t, manager, "tool")
+	startFakeServer(t, manager, "gone")
+
+	for _, name := range []string{"tool", "gone"} {
+		if err := manager.StopServer(context.Background(), name); err != nil {
+			t.Errorf("StopServer(%s) error = %v", name, err)
+		}
+	}
+	want := []string{"rm -f mcp-tool", "rm -f mcp-gone"}
+	if got := dockerCalls(t, logPath); !reflect.DeepEqual(got, want) {
+		t.Errorf("docker calls = %q, want %q", got, want)
+	}
+}
+
+// TestImageAllowlist checks exact, untagged and prefix entries
+func TestImageAllowlist(t *testing.T) {
+	m := &MCPManager{allowedImages: []string{"mcp/filesystem", "mcp/fetch:1.2", "ghcr.io/acme/"}}
+	tests := []struct {
+		image string
+		want  bool
+	}{
+		{"mcp/filesystem", true},
+		{"mcp/filesystem:latest", true},
+		{"mcp/filesystem@sha256:abcd", true},
+		{"mcp/fetch:1.2", true},
+		{"mcp/fetch:latest", false},
+		{"mcp/fetch", false},
+		{"ghcr.io/acme/tools:3", true},
+		{"ghcr.io/acmeevil/tools", false},
+		{"mcp/filesystem-evil", false},
+		{"alpine", false},
+	}
+	for _, tt := range tests {
+		if got := m.imageAllowed(tt.image); got != tt.want {
+			t.Errorf("imageAllowed(%q) = %v, want %v", tt.image, got, tt.want)
+		}
+	}
+	if !(&MCPManager{}).imageAllowed("anything") {
+		t.Error("an empty allowlist should allow any image")
+	}
+}
+
+// TestStartRejectsImageOffAllowlist checks the start endpoint answers 403 for
+// an image off the allowlist, without running docker
+func TestStartRejectsImageOffAllowlist(t *testing.T) {
+	logPath := fakeDocker(t)
+	t.Setenv("MCP_IMAGE_ALLOWLIST", "mcp/filesystem, ghcr.io/acme/")
+	manager, _ := NewMCPManager()
+	e := echo.New()
+	registerRoutes(e, manager)
+
+	start := func(image string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/servers/fs/start", strings.NewReader(`{"image":"`+image+`"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := start("evil/miner"); rec.Code != http.StatusForbidden {
+		t.Errorf("rejected image: status = %d, want 403 (%s)", rec.Code, rec.Body)
+	}
+	if calls := dockerCalls(t, logPath); calls[0] != "" {
+		t.Errorf("docker ran for a rejected image: %q", calls)
+	}
+
+	// An allowed image gets past the check; the broken docker makes it fail later
+	dockerCommand = filepath.Join(t.TempDir(), "missing-docker")
+	if rec := start("mcp/filesystem:latest"); rec.Code != http.StatusInternalServerError {
+		t.Errorf("allowed image: status = %d, want 500 from the missing docker (%s)", rec.Code, rec.Body)
+	}
+}
+
+// TestVolumeAllowlist checks named volumes always pass and bind mounts only
+// from directories on the mount allowlist
+func TestVolumeAllowlist(t *testing.T) {
+	m := &MCPManager{allowedMounts: []string{"/srv/mcp"}}
+	tests := []struct {
+		spec string
+		want bool
+	}{
+		{"mcp-data:/data", true},
+		{"mcp-data:/data:ro", true},
+		{"/data", true},
+		{"/srv/mcp:/data", true},
+		{"/srv/mcp/samples:/data:ro", true},
+		{"/srv/mcp/../../etc:/etc", false},
+		{"/srv/mcpevil:/data", false},
+		{"/:/host", false},
+		{"/var/run/docker.sock:/var/run/docker.sock", false},
+		{"./local:/data", false},
+		{"data", false},
+	}
+	for _, tt := range tests {
+		if got := m.volumeAllowed(tt.spec); got != tt.want {
+			t.Errorf("volumeAllowed(%q) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+	if (&MCPManager{}).volumeAllowed("/:/host") {
+		t.Error("an empty mount allowlist should only allow named volumes")
+	}
+}
+
+// TestConfigRejectsHostMountsAndMasksEnv checks the API refuses bind mounts
+// off the allowlist and bad env names, never shows env values, and keeps
+// the saved values when the masked ones are sent back
+func TestConfigRejectsHostMountsAndMasksEnv(t *testing.T) {
+	logPath := fakeDocker(t)
+	manager, _ := NewMCPManager()
+	e := echo.New()
+	registerRoutes(e, manager)
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, body := range []string{
+		`{"image":"mcp/filesystem","volumes":["/:/host"]}`,
+		`{"image":"mcp/filesystem","volumes":["/var/run/docker.sock:/var/run/docker.sock"]}`,
+	} {
+		if rec := send(http.MethodPost, "/servers/fs/start", body); rec.Code != http.StatusForbidden {
+			t.Errorf("start %s: status = %d, want 403 (%s)", body, rec.Code, rec.Body)
+		}
+		if rec := send(http.MethodPut, "/config/servers/fs", body); rec.Code != http.StatusForbidden {
+			t.Errorf("PUT %s: status = %d, want 403 (%s)", body, rec.Code, rec.Body)
+		}
+	}
+	if rec := send(http.MethodPut, "/config/servers/fs", `{"image":"mcp/filesystem","env":{"A=B":"c"}}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad env name: status = %d, want 400 (%s)", rec.Code, rec.Body)
+	}
+	if calls := dockerCalls(t, logPath); calls[0] != "" {
+		t.Errorf("docker ran for a rejected config: %q", calls)
+	}
+
+	if rec := send(http.MethodPut, "/config/servers/fs", `{"image":"mcp/filesystem","env":{"TOKEN":"s3cret"}}`); rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "s3cret") {
+		t.Fatalf("PUT = %d %s, want 200 without the secret", rec.Code, rec.Body)
+	}
+	rec := send(http.MethodGet, "/config/servers", "")
+	if strings.Contains(rec.Body.String(), "s3cret") || !strings.Contains(rec.Body.String(), `"TOKEN":"****"`) {
+		t.Errorf("GET /config/servers = %s, want the env value masked", rec.Body)
+	}
+
+	// Sending the masked config back keeps the real value
+	send(http.MethodPut, "/config/servers/fs", `{"image":"mcp/filesystem","env":{"TOKEN":"****"}}`)
+	if cfg, _ := manager.configs.Get("fs"); cfg.Env["TOKEN"] != "s3cret" {
+		t.Errorf("saved TOKEN = %q, want the original value", cfg.Env["TOKEN"])
+	}
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// cannedServer registers a server whose next JSON-RPC response is reply
+func cannedServer(m *MCPManager, name, reply string) {
+	s := &MCPServer{
+		Name:         name,
+		stdin:        nopWriteCloser{io.Discard},
+		responseChan: make(chan string, 1),
+	}
+	s.responseChan <- reply
+	m.servers[name] = s
+}
+
+// TestCallExtractsTextContent checks /call returns the text of a standard
+// MCP tool result, the raw result with raw=true, and an error for isError
+func TestCallExtractsTextContent(t *testing.T) {
+	manager, _ := NewMCPManager()
+	e := echo.New()
+	registerRoutes(e, manager)
+	result := `{"content":[{"type":"text","text":"3 files"},{"type":"text","text":"a.bin\nb.bin\nc.bin"}]}`
+
+	call := func(body string) (int, map[string]interface{}) {
+		req := httptest.NewRequest(http.MethodPost, "/servers/fs/call", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		var resp map[string]interface{}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+
+	cannedServer(manager, "fs", `{"jsonrpc":"2.0","id":1,"result":`+result+`}`)
+	code, resp := call(`{"tool":"list"}`)
+	if code != http.StatusOK || resp["result"] != "3 files\na.bin\nb.bin\nc.bin" {
+		t.Errorf("text call = %d %v, want the joined text", code, resp)
+	}
+
+	cannedServer(manager, "fs", `{"jsonrpc":"2.0","id":1,"result":`+result+`}`)
+	code, resp = call(`{"tool":"list","raw":true}`)
+	if raw, ok := resp["result"].(map[string]interface{}); code != http.StatusOK || !ok || raw["content"] == nil {
+		t.Errorf("raw call = %d %v, want the MCP result object", code, resp)
+	}
+
+	cannedServer(manager, "fs", `{"jsonrpc":"2.0","id":1,"result":{"isError":true,"content":[{"type":"text","text":"no such file"}]}}`)
+	code, resp = call(`{"tool":"list"}`)
+	if code != http.StatusInternalServerError || resp["error"] != "MCP error: no such file" {
+		t.Errorf("isError call = %d %v, want an MCP error", code, resp)
+	}
+}
+
+// TestAutostartAfterRestart checks a server flagged autostart through the
+// config API is launched again by a new manager reading the same file
+func TestAutostartAfterRestart(t *testing.T) {
+	logPath := fakeDocker(t)
+	t.Setenv("MCP_CONFIG_FILE", filepath.Join(t.TempDir(), "servers.json"))
+
+	first, err := NewMCPManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	registerRoutes(e, first)
+	put := func(name, body string) {
+		req := httptest.NewRequest(http.MethodPut, "/config/servers/"+name, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("PUT %s = %d %s", name, rec.Code, rec.Body)
+		}
+	}
+	put("fs", `{"image":"mcp/filesystem","env":{"ROOT":"/data"},"volumes":["mcp-data:/data"],"autostart":true}`)
+	put("idle", `{"image":"mcp/fetch"}`)
+
+	// Simulated restart: a new manager loads the saved configs
+	second, err := NewMCPManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.StopAll(context.Background())
+	if got := second.configs.List(); len(got) != 2 || got[0].Name != "fs" || !got[0].Autostart {
+		t.Fatalf("reloaded configs = %+v", got)
+	}
+
+	if started := second.Autostart(context.Background()); !reflect.DeepEqual(started, []string{"fs"}) {
+		t.Fatalf("Autostart() = %v, want [fs]", started)
+	}
+	servers := second.ListServers()
+	if len(servers) != 1 || servers[0]["name"] != "fs" {
+		t.Errorf("running servers = %v, want only fs", servers)
+	}
+
+	calls := dockerCalls(t, logPath)
+	want := "run --rm -i --name mcp-fs --label mcp-server=fs --label managed-by=mcp-docker-manager -e ROOT=/data -v mcp-data:/data mcp/filesystem"
+	if len(calls) == 0 || calls[0] != want {
+		t.Errorf("docker calls = %q, want first %q", calls, want)
+	}
+}
+
+// TestRefreshTools checks refresh-tools re-lists the tools of a running server
+// and updates the list /servers reports
+func TestRefreshTools(t *testing.T) {
+	fakeDocker(t)
+	manager, _ := NewMCPManager()
+	defer manager.StopAll(context.Background())
+	if err := manager.StartServer(context.Background(), ServerConfig{Name: "tools", Image: "mcp/tools"}); err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	registerRoutes(e, manager)
+	request := func(method, path string) (int, []byte) {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec.Code, rec.Body.Bytes()
+	}
+	toolNames := func(tools []Tool) []string {
+		names := make([]string, len(tools))
+		for i, tool := range tools {
+			names[i] = tool.Name
+		}
+		return names
+	}
+
+	if got := toolNames(manager.servers["tools"].tools()); !reflect.DeepEqual(got, []string{"echo"}) {
+		t.Fatalf("tools at start = %v", got)
+	}
+
+	// /servers keeps being read while the tools are replaced (go test -race)
+	stopListing := make(chan struct{})
+	listed := make(chan struct{})
+	go func() {
+		defer close(listed)
+		for {
+			select {
+			case <-stopListing:
+				return
+			default:
+				manager.ListServers()
+			}
+		}
+	}()
+	code, body := request(http.MethodPost, "/servers/tools/refresh-tools")
+	close(stopListing)
+	<-listed
+	var resp struct {
+		Tools []Tool `json:"tools"`
+	}
+	json.Unmarshal(body, &resp)
+	if want := []string{"echo", "reverse"}; code != http.StatusOK || !reflect.DeepEqual(toolNames(resp.Tools), want) {
+		t.Errorf("refresh = %d %s, want tools %v", code, body, want)
+	}
+
+	_, body = request(http.MethodGet, "/servers")
+	if !strings.Contains(string(body), `"reverse"`) {
+		t.Errorf("/servers does not report the refreshed tools: %s", body)
+	}
+
+	if code, _ := request(http.MethodPost, "/servers/missing/refresh-tools"); code != http.StatusNotFound {
+		t.Errorf("refresh of a missing server = %d, want 404", code)
+	}
+}
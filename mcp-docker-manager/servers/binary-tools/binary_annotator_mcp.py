@@ -45,8 +45,8 @@ class BinaryAnnotatorClient:
         self.base_url = base_url
         self.client = httpx.AsyncClient(timeout=30.0)
 
-    async def list_binary_files(self) -> List[Dict[str, Any]]:
-        """List all binary files."""
+    async def list_binary_files(self) -> Dict[str, Any]:
+        """List all binary files, as {"files", "total", "limit", "offset"}."""
         response = await self.client.get(f"{self.base_url}/get/list/binary")
         response.raise_for_status()
         return response.json()
@@ -134,11 +134,14 @@ def calculate_entropy(data: bytes) -> float:
 
 async def _list_binary_files() -> Dict[str, Any]:
     """List all available binary files."""
-    files = await client.list_binary_files()
+    listing = await client.list_binary_files()
+    files = listing["files"]
+    total = listing.get("total", len(files))
     return {
         "files": files,
         "count": len(files),
-        "summary": f"Found {len(files)} binary file(s)"
+        "total": total,
+        "summary": f"Found {total} binary file(s)"
     }
 
 
@@ -179,12 +182,17 @@ async def _search_pattern(
     - hex: Hex pattern (e.g., "FF 00 AA")
     - string-ascii: ASCII string
     - string-utf8: UTF-8 string
+    - string-utf16le, string-utf16be: UTF-16 string (a leading BOM is included in the match)
     - int8, uint8: 8-bit integers
     - int16le, int16be, uint16le, uint16be: 16-bit integers
     - int32le, int32be, uint32le, uint32be: 32-bit integers
     - float32le, float32be: 32-bit floats
     - float64le, float64be: 64-bit floats
-    - timestamp-unix32, timestamp-unix64: Unix timestamps
+    - timestamp-unix32, timestamp-unix64: Unix timestamps (seconds, little-endian)
+    - timestamp-unix32be, timestamp-unix64be: big-endian Unix timestamps
+    - timestamp-unixms64, timestamp-unixms64be: millisecond Unix timestamps
+    - timestamp-filetime64le, timestamp-filetime64be: Windows FILETIME
+    - timestamp-dos: packed DOS date and time (2 s resolution)
     """
     result = await client.search_pattern(file_name, value, search_type)
 
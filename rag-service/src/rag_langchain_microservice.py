@@ -18,9 +18,21 @@ class Settings(BaseModel):
     chunk_size: int = 1000
     chunk_overlap: int = 200
     persist_directory: str = "./chroma_db"
+    # Default search filters, used when a request omits them. Keep in sync
+    # with DefaultRAGMaxResults / DefaultRAGMinScore in backend/services/rag.go.
+    default_max_results: int = 5
+    default_min_score: float = 0.3
+    # Chunking defaults, used when an index request omits them. Changed at
+    # runtime through POST /config.
+    default_chunk_tokens: int = 256
+    default_overlap_tokens: int = 50
 
 
 settings = Settings()
+
+# How many candidates per requested result a search with max_per_document
+# fetches before capping
+MAX_PER_DOCUMENT_OVERFETCH = 4
 os.makedirs(settings.persist_directory, exist_ok=True)
 
 app = FastAPI(title="RAG LangChain Microservice")
@@ -62,8 +74,12 @@ class IndexDocumentRequest(BaseModel):
     content: str
     source: str
     metadata: Optional[Dict[str, str]] = None
-    chunk_tokens: Optional[int] = 256
-    overlap_tokens: Optional[int] = 50
+    chunk_tokens: Optional[int] = None
+    overlap_tokens: Optional[int] = None
+    # Caller's key for the document (e.g. "session_12"). Indexing again with
+    # the same external_id replaces the document's chunks instead of adding
+    # a new document.
+    external_id: Optional[str] = None
 
 
 class ChunkInfo(BaseModel):
@@ -73,15 +89,49 @@ class ChunkInfo(BaseModel):
 
 
 class IndexDocumentResponse(BaseModel):
+    document_id: int
+    chunk_count: int
+    # Kept for older clients: id mirrors document_id, chunks previews each chunk
     id: int
     chunks: List[Dict]
 
 
+class RAGConfig(BaseModel):
+    chunk_tokens: int
+    overlap_tokens: int
+
+
+class RAGConfigUpdate(BaseModel):
+    chunk_tokens: Optional[int] = None
+    overlap_tokens: Optional[int] = None
+
+
 class SearchRequest(BaseModel):
     query: str
     type: Optional[List[str]] = None
-    max_results: Optional[int] = 5
-    min_score: Optional[float] = 0.3
+    max_results: Optional[int] = None
+    min_score: Optional[float] = None
+    # Also return the chunks just before and after each match in its
+    # document, for context that doesn't stop mid-paragraph
+    include_neighbors: bool = False
+    # At most this many chunks of any one document, the best scoring ones,
+    # so a single long document can't fill all the results
+    max_per_document: Optional[int] = None
+
+
+class NeighborChunk(BaseModel):
+    chunk_id: int
+    chunk_index: int
+    content: str
+
+
+class DocumentChunksResponse(BaseModel):
+    document_id: int
+    title: str
+    type: str
+    source: str
+    chunk_count: int
+    chunks: List[NeighborChunk]  # in document order
 
 
 class SearchResult(BaseModel):
@@ -93,6 +143,9 @@ class SearchResult(BaseModel):
     source: str
     score: float
     metadata: Optional[str] = None
+    # With include_neighbors: the preceding and following chunks of the same
+    # document, ordered by chunk_id (the match itself is not repeated)
+    neighbors: Optional[List[NeighborChunk]] = None
 
 
 class SearchResponse(BaseModel):
@@ -109,6 +162,44 @@ async def healthcheck():
     return {"status": "ok"}
 
 
+def current_config() -> RAGConfig:
+    return RAGConfig(
+        chunk_tokens=settings.default_chunk_tokens,
+        overlap_tokens=settings.default_overlap_tokens,
+    )
+
+
+@app.get("/config", response_model=RAGConfig)
+async def get_config():
+    """Chunking defaults applied to index requests that omit them"""
+    return current_config()
+
+
+@app.post("/config", response_model=RAGConfig)
+async def update_config(req: RAGConfigUpdate):
+    """Update the chunking defaults; omitted fields are left unchanged"""
+    chunk_tokens = req.chunk_tokens if req.chunk_tokens is not None else settings.default_chunk_tokens
+    overlap_tokens = req.overlap_tokens if req.overlap_tokens is not None else settings.default_overlap_tokens
+    if chunk_tokens <= 0:
+        raise HTTPException(status_code=400, detail="chunk_tokens must be positive")
+    if overlap_tokens < 0 or overlap_tokens >= chunk_tokens:
+        raise HTTPException(status_code=400, detail="overlap_tokens must be between 0 and chunk_tokens - 1")
+
+    settings.default_chunk_tokens = chunk_tokens
+    settings.default_overlap_tokens = overlap_tokens
+    return current_config()
+
+
+def find_document_by_external_id(external_id: Optional[str]) -> Optional[int]:
+    """ID of the document indexed under external_id, if any"""
+    if not external_id:
+        return None
+    for doc_id, doc in document_store.items():
+        if doc.get("external_id") == external_id:
+            return doc_id
+    return None
+
+
 @app.post("/index/document", response_model=IndexDocumentResponse)
 async def index_document(req: IndexDocumentRequest):
     """
@@ -118,9 +209,16 @@ async def index_document(req: IndexDocumentRequest):
     global next_document_id
 
     try:
+        document_id = next_document_id
+        existing_id = find_document_by_external_id(req.external_id)
+        if existing_id is not None:
+            document_id = existing_id
+
         # Calculate chunk size based on tokens (approximate: 1 token ≈ 4 chars)
-        chunk_size = req.chunk_tokens * 4 if req.chunk_tokens else 1024
-        chunk_overlap = req.overlap_tokens * 4 if req.overlap_tokens else 200
+        chunk_tokens = req.chunk_tokens or settings.default_chunk_tokens
+        overlap_tokens = req.overlap_tokens if req.overlap_tokens is not None else settings.default_overlap_tokens
+        chunk_size = chunk_tokens * 4
+        chunk_overlap = min(overlap_tokens, chunk_tokens - 1) * 4
 
         # Split content into chunks
         text_splitter = RecursiveCharacterTextSplitter(
@@ -130,22 +228,26 @@ async def index_document(req: IndexDocumentRequest):
 
         # Create documents with metadata
         doc_metadata = {
-            "document_id": str(next_document_id),
+            "document_id": str(document_id),
             "type": req.type,
             "title": req.title,
             "source": req.source,
         }
         if req.metadata:
             doc_metadata.update(req.metadata)
+        if req.external_id:
+            doc_metadata["external_id"] = req.external_id
 
         # Create document and split
         doc = Document(page_content=req.content, metadata=doc_metadata)
         chunks = text_splitter.split_documents([doc])
 
-        # Add chunk IDs to metadata
+        # Add chunk IDs to metadata. chunk_index is the same position as an
+        # integer, so chunks sort in document order (chunk_id "10" < "2").
         chunk_info = []
         for i, chunk in enumerate(chunks):
             chunk.metadata["chunk_id"] = str(i)
+            chunk.metadata["chunk_index"] = i
             chunk_info.append({
                 "chunk_id": i,
                 "content": chunk.page_content[:100] + "...",
@@ -155,12 +257,15 @@ async def index_document(req: IndexDocumentRequest):
         # Index in vector store
         embeddings = get_embeddings()
         vectordb = load_vectorstore(embeddings)
+        if existing_id is not None:
+            vectordb.delete(where={"document_id": str(existing_id)})
         vectordb.add_documents(chunks)
         vectordb.persist()
 
         # Store document metadata
-        document_store[next_document_id] = {
-            "id": next_document_id,
+        document_store[document_id] = {
+            "id": document_id,
+            "external_id": req.external_id,
             "type": req.type,
             "title": req.title,
             "source": req.source,
@@ -169,17 +274,84 @@ async def index_document(req: IndexDocumentRequest):
         }
 
         response = IndexDocumentResponse(
-            id=next_document_id,
+            document_id=document_id,
+            chunk_count=len(chunks),
+            id=document_id,
             chunks=chunk_info
         )
 
-        next_document_id += 1
+        if existing_id is None:
+            next_document_id += 1
         return response
 
     except Exception as e:
         raise HTTPException(status_code=500, detail=f"Failed to index document: {str(e)}")
 
 
+def chunk_index(meta: dict) -> int:
+    """Position of a chunk in its document. Chunks indexed before chunk_index
+    was stored, and not yet migrated, only have chunk_id."""
+    if "chunk_index" in meta:
+        return int(meta["chunk_index"])
+    return int(meta.get("chunk_id", 0))
+
+
+def to_chunks(found: dict) -> List[NeighborChunk]:
+    """Chunks of a vector store get() result, in document order"""
+    chunks = [
+        NeighborChunk(chunk_id=int(meta.get("chunk_id", 0)), chunk_index=chunk_index(meta), content=content)
+        for content, meta in zip(found.get("documents") or [], found.get("metadatas") or [])
+    ]
+    return sorted(chunks, key=lambda c: c.chunk_index)
+
+
+def neighbor_chunks(vectordb, document_id: int, chunk_id: int) -> List[NeighborChunk]:
+    """Chunks chunk_id - 1 and chunk_id + 1 of a document, in order"""
+    found = vectordb.get(where={"$and": [
+        {"document_id": str(document_id)},
+        {"chunk_id": {"$in": [str(chunk_id - 1), str(chunk_id + 1)]}},
+    ]})
+    return to_chunks(found)
+
+
+@app.on_event("startup")
+def migrate_chunk_index():
+    """Store chunk_index on chunks indexed before it existed"""
+    try:
+        vectordb = load_vectorstore()
+        found = vectordb.get()
+    except Exception as e:
+        print(f"chunk_index migration skipped: {e}")
+        return
+    ids, metadatas = [], []
+    for chunk_id, meta in zip(found.get("ids") or [], found.get("metadatas") or []):
+        if meta is not None and "chunk_index" not in meta:
+            ids.append(chunk_id)
+            metadatas.append({**meta, "chunk_index": chunk_index(meta)})
+    if ids:
+        vectordb._collection.update(ids=ids, metadatas=metadatas)
+        print(f"chunk_index migration: updated {len(ids)} chunks")
+
+
+@app.get("/document/{document_id}", response_model=DocumentChunksResponse)
+async def get_document(document_id: int):
+    """A document's chunks in the order they appear in it"""
+    vectordb = load_vectorstore()
+    chunks = to_chunks(vectordb.get(where={"document_id": str(document_id)}))
+    if not chunks:
+        raise HTTPException(status_code=404, detail="Document not found")
+
+    doc = document_store.get(document_id, {})
+    return DocumentChunksResponse(
+        document_id=document_id,
+        title=doc.get("title", ""),
+        type=doc.get("type", "document"),
+        source=doc.get("source", ""),
+        chunk_count=len(chunks),
+        chunks=chunks,
+    )
+
+
 @app.post("/search", response_model=SearchResponse)
 async def search(req: SearchRequest):
     """
@@ -190,28 +362,44 @@ async def search(req: SearchRequest):
         embeddings = get_embeddings()
         vectordb = load_vectorstore(embeddings)
 
-        # Perform similarity search with scores
-        docs_and_scores = vectordb.similarity_search_with_score(
-            req.query,
-            k=req.max_results if req.max_results else 5
-        )
+        max_results = req.max_results or settings.default_max_results
+        if req.max_per_document is not None and req.max_per_document < 1:
+            raise HTTPException(status_code=400, detail="max_per_document must be at least 1")
+
+        # Perform similarity search with scores. With a per-document cap,
+        # fetch more candidates so capped documents leave room for others.
+        k = max_results
+        if req.max_per_document:
+            k = max_results * MAX_PER_DOCUMENT_OVERFETCH
+        docs_and_scores = vectordb.similarity_search_with_score(req.query, k=k)
 
+        min_score = req.min_score or settings.default_min_score
         results = []
+        per_document: Dict[int, int] = {}
         for doc, score in docs_and_scores:
+            if len(results) == max_results:
+                break
             # Convert ChromaDB distance to similarity score (lower distance = higher similarity)
             # ChromaDB uses L2 distance, convert to similarity (0-1)
             similarity_score = 1.0 / (1.0 + score)
 
             # Filter by minimum score
-            if similarity_score < (req.min_score if req.min_score else 0.3):
+            if similarity_score < min_score:
                 continue
 
             # Filter by document type if specified
             if req.type and doc.metadata.get("type") not in req.type:
                 continue
 
+            # Results come best first, so the chunks kept are the best ones
+            document_id = int(doc.metadata.get("document_id", 0))
+            if req.max_per_document:
+                if per_document.get(document_id, 0) >= req.max_per_document:
+                    continue
+                per_document[document_id] = per_document.get(document_id, 0) + 1
+
             result = SearchResult(
-                document_id=int(doc.metadata.get("document_id", 0)),
+                document_id=document_id,
                 chunk_id=int(doc.metadata.get("chunk_id", 0)),
                 type=doc.metadata.get("type", "document"),
                 title=doc.metadata.get("title", ""),
@@ -220,6 +408,8 @@ async def search(req: SearchRequest):
                 score=similarity_score,
                 metadata=str(doc.metadata) if doc.metadata else None
             )
+            if req.include_neighbors:
+                result.neighbors = neighbor_chunks(vectordb, result.document_id, result.chunk_id)
             results.append(result)
 
         return SearchResponse(
@@ -228,6 +418,8 @@ async def search(req: SearchRequest):
             count=len(results)
         )
 
+    except HTTPException:
+        raise
     except Exception as e:
         raise HTTPException(status_code=500, detail=f"Search failed: {str(e)}")
 